@@ -1,60 +1,120 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/nikogura/rag-indexer/pkg/config"
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/export"
 	"github.com/nikogura/rag-indexer/pkg/indexer"
 	"github.com/nikogura/rag-indexer/pkg/logging"
 	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/nikogura/rag-indexer/pkg/output"
+	"github.com/nikogura/rag-indexer/pkg/queue"
 	"github.com/nikogura/rag-indexer/pkg/server"
 )
 
-//nolint:gochecknoglobals // Command-line flag
-var mode string
+//nolint:gochecknoglobals // Command-line flags
+var (
+	mode        string
+	environment string
+	configFile  string
+	targetIndex string
+	outputFmt   string
+	localPath   string
+	repoName    string
+	readStdin   bool
+	outPath     string
+	inPath      string
+	snapshot    string
+	tenantName  string
+	dryRun      bool
+)
 
 //nolint:gochecknoinits // Flag initialization
 func init() {
-	flag.StringVar(&mode, "mode", "serve", "Run mode: serve, index, or search")
+	flag.StringVar(&mode, "mode", "serve", "Run mode: serve, index, index-file, search, backfill, worker, export, import, snapshot, or restore")
+	flag.StringVar(&environment, "env", os.Getenv("ENVIRONMENT"), "Named environment to load, e.g. staging or prod (default: $ENVIRONMENT)")
+	flag.StringVar(&configFile, "config", os.Getenv("CONFIG_FILE"), "YAML config file; environment variables override its values (default: $CONFIG_FILE)")
+	flag.StringVar(&targetIndex, "target-index", "", "Index to write embeddings to in backfill mode (default: ES_INDEX, in place)")
+	flag.StringVar(&outputFmt, "output", output.FormatPlain, "Search mode output format: "+strings.Join(output.Formats, ", "))
+	flag.StringVar(&localPath, "path", "", "Local directory to index as-is in index mode, instead of the repositories under REPOS_PATH; the repository root in index-file mode")
+	flag.StringVar(&repoName, "repo-name", "", "Repository name for the documents indexed from -path (default: the directory's name)")
+	flag.BoolVar(&readStdin, "stdin", false, "Read the file's content from standard input in index-file mode")
+	flag.StringVar(&outPath, "out", "", "File to write the index to in export mode, gzipped when it ends in .gz; - for standard output")
+	flag.StringVar(&inPath, "in", "", "File to read documents from in import mode, gunzipped when it ends in .gz; - for standard input")
+	flag.StringVar(&snapshot, "snapshot", "", "Snapshot in SNAPSHOT_REPOSITORY to restore in restore mode")
+	flag.BoolVar(&dryRun, "dry-run", false, "Report what index mode would add, update, and delete per repository without writing to the index")
+	flag.StringVar(&tenantName, "tenant", "", "Tenant to run as, from TENANTS or the config file's tenants (default: the default profile, serving every tenant in serve mode)")
 }
 
 func main() {
 	flag.Parse()
+	validateFlags()
 
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		log.Fatalf("Failed to load config: %s", logging.RedactURLs(err.Error()))
 	}
 
-	// Create structured logger
-	slogger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	slogger := newLogger(cfg)
 	logger := logging.New(slogger)
+	if cfg.Environment != "" {
+		logger.Info("Loaded environment", "environment", cfg.Environment, "index", cfg.ESIndex, "repos", len(cfg.RepoNames()))
+	}
 
 	m := metrics.New()
 
-	es, err := elasticsearch.NewClient(cfg.ESHost, cfg.ESIndex, cfg.ESUsername, cfg.ESPassword, m)
-	if err != nil {
-		log.Fatalf("Failed to connect to Elasticsearch: %v", err)
+	if tenantName != "" {
+		var found bool
+		cfg, found = cfg.TenantConfig(tenantName)
+		if !found {
+			log.Fatalf("Unknown tenant: %s", tenantName)
+		}
+		m = m.ForTenant(tenantName)
+		logger = logging.New(slogger.With("tenant", tenantName))
+		logger.Info("Running as tenant", "tenant", tenantName, "index", cfg.ESIndex, "repos", len(cfg.RepoNames()))
+	}
+
+	if cfg.ESInsecureSkipVerify {
+		logger.Warn("ES_INSECURE_SKIP_VERIFY is set: Elasticsearch certificates are not verified; use ES_CA_FILE instead outside of testing")
 	}
 
-	// Ensure ES index exists with proper mapping
-	err = es.EnsureIndex(context.Background())
+	es, err := elasticsearch.New(cfg, m)
 	if err != nil {
-		log.Fatalf("Failed to ensure Elasticsearch index: %v", err)
+		log.Fatalf("Invalid Elasticsearch configuration: %v", err)
 	}
 
 	idx := indexer.New(cfg, es, m, logger)
+	indexers := []*indexer.Indexer{idx}
+
+	var tenants []servedTenant
+	if mode == "serve" {
+		for _, tenantCfg := range cfg.Tenants {
+			var tenant servedTenant
+			tenant, err = newServedTenant(tenantCfg, m, slogger)
+			if err != nil {
+				log.Fatalf("Invalid Elasticsearch configuration for tenant %s: %v", tenantCfg.Tenant, err)
+			}
+			tenants = append(tenants, tenant)
+			indexers = append(indexers, tenant.indexer)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -64,27 +124,229 @@ func main() {
 
 	go func() {
 		<-sigChan
-		log.Println("Shutdown signal received")
-		cancel()
+		log.Printf("Shutdown signal received, draining in-flight indexing (up to %v)", cfg.ShutdownTimeout)
+		drain(ctx, cancel, indexers, cfg.ShutdownTimeout, sigChan)
 	}()
 
+	if mode != "serve" {
+		err = bootstrapES(ctx, es, cfg.ESStartupTimeout, cfg.ESStartupBackoff, logger)
+		if err != nil {
+			log.Fatalf("Failed to connect to Elasticsearch: %v", err)
+		}
+	}
+
+	runMode(ctx, cfg, idx, es, m, logger, tenants)
+}
+
+// validateFlags exits when the flags don't fit the mode.
+func validateFlags() {
+	if mode == "search" && !output.Valid(outputFmt) {
+		log.Fatalf("Unknown output format: %s (use %s)", outputFmt, strings.Join(output.Formats, ", "))
+	}
+	if (localPath != "" || repoName != "") && mode != "index" && mode != "index-file" {
+		log.Fatal("-path and -repo-name are only used in index and index-file modes")
+	}
+	if repoName != "" && localPath == "" && mode == "index" {
+		log.Fatal("-repo-name requires -path in index mode")
+	}
+	if dryRun && mode != "index" {
+		log.Fatal("-dry-run is only used in index mode")
+	}
+	if readStdin && mode != "index-file" {
+		log.Fatal("-stdin is only used in index-file mode")
+	}
+	if mode == "index-file" && (flag.NArg() != 1 || (repoName == "" && localPath == "")) {
+		log.Fatal("index-file mode takes one file path, relative to the repository root, and -repo-name or -path")
+	}
+	if (outPath != "") != (mode == "export") {
+		log.Fatal("export mode takes -out, which is only used in export mode")
+	}
+	if (inPath != "") != (mode == "import") {
+		log.Fatal("import mode takes -in, which is only used in import mode")
+	}
+	if (snapshot != "") != (mode == "restore") {
+		log.Fatal("restore mode takes -snapshot, which is only used in restore mode")
+	}
+}
+
+// newLogger builds the JSON logger, masking configured secrets in everything
+// it and the standard logger write.
+func newLogger(cfg config.Config) (slogger *slog.Logger) {
+	// Mask configured secrets in everything logged from here on
+	redactor := logging.NewRedactor(cfg.Secrets()...)
+	log.SetOutput(redactor.Writer(os.Stderr))
+
+	// Create structured logger
+	slogger = slog.New(redactor.Handler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	})))
+	return slogger
+}
+
+// runMode runs the selected mode until it finishes or ctx is cancelled.
+func runMode(ctx context.Context, cfg config.Config, idx *indexer.Indexer, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger, tenants []servedTenant) {
 	switch mode {
 	case "serve":
-		runServeMode(ctx, cfg, idx, es, logger)
+		runServeMode(ctx, cfg, idx, es, m, logger, tenants)
 
 	case "index":
 		runIndexMode(ctx, idx)
 
+	case "index-file":
+		runIndexFileMode(ctx, idx)
+
 	case "search":
 		runSearchMode(ctx, es)
 
+	case "backfill":
+		runBackfillMode(ctx, idx)
+
+	case "worker":
+		runWorkerMode(ctx, cfg, idx, es, m, logger)
+
+	case "export":
+		runExportMode(ctx, es)
+
+	case "import":
+		runImportMode(ctx, cfg, es)
+
+	case "snapshot":
+		runSnapshotMode(ctx, idx)
+
+	case "restore":
+		runRestoreMode(ctx, idx)
+
 	default:
-		log.Fatalf("Unknown mode: %s (use serve, index, or search)", mode)
+		log.Fatalf("Unknown mode: %s (use serve, index, index-file, search, backfill, worker, export, import, snapshot, or restore)", mode)
+	}
+}
+
+// drain lets in-flight indexing of each indexer finish its current
+// repository before cancelling ctx, giving up after timeout or on a second
+// signal.
+func drain(ctx context.Context, cancel context.CancelFunc, indexers []*indexer.Indexer, timeout time.Duration, sigChan <-chan os.Signal) {
+	drainCtx, drainCancel := context.WithTimeout(ctx, timeout)
+	defer drainCancel()
+
+	go func() {
+		select {
+		case <-sigChan:
+			log.Println("Second shutdown signal received, stopping now")
+			drainCancel()
+		case <-drainCtx.Done():
+		}
+	}()
+
+	var err error
+	for _, idx := range indexers {
+		err = errors.Join(err, idx.Drain(drainCtx))
+	}
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	} else {
+		log.Println("In-flight indexing finished")
+	}
+	cancel()
+}
+
+// loadConfig loads the configuration for the selected environment, from the
+// config file when one is given.
+func loadConfig() (cfg config.Config, err error) {
+	if configFile != "" {
+		cfg, err = config.LoadFileEnvironment(configFile, environment)
+		return cfg, err
+	}
+
+	cfg, err = config.LoadEnvironment(environment)
+	return cfg, err
+}
+
+// bootstrapES waits for Elasticsearch to become reachable and the index to
+// exist, logging each failed attempt. A zero timeout waits until ctx ends.
+func bootstrapES(ctx context.Context, es *elasticsearch.Client, timeout time.Duration, backoff time.Duration, logger logging.Logger) (err error) {
+	const maxBackoff = 30 * time.Second
+
+	err = es.Bootstrap(ctx, elasticsearch.BootstrapOptions{
+		Timeout:    timeout,
+		Backoff:    backoff,
+		MaxBackoff: maxBackoff,
+		OnRetry: func(attempt int, wait time.Duration, retryErr error) {
+			logger.Warn("Elasticsearch not ready, retrying", "attempt", attempt, "wait", wait, "error", retryErr)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Connected to search backend", "backend", es.Backend(), "version", es.Version())
+	return err
+}
+
+// servedTenant is a tenant's index, served and kept up to date alongside the
+// default profile's.
+type servedTenant struct {
+	config  config.Config
+	es      *elasticsearch.Client
+	indexer *indexer.Indexer
+	metrics *metrics.Metrics
+	logger  logging.Logger
+}
+
+// newServedTenant creates the Elasticsearch client and indexer of a tenant,
+// recording its metrics and logs under its name.
+func newServedTenant(cfg config.Config, m *metrics.Metrics, slogger *slog.Logger) (tenant servedTenant, err error) {
+	tenant = servedTenant{
+		config:  cfg,
+		metrics: m.ForTenant(cfg.Tenant),
+		logger:  logging.New(slogger.With("tenant", cfg.Tenant)),
+	}
+
+	tenant.es, err = elasticsearch.New(cfg, tenant.metrics)
+	if err != nil {
+		return tenant, err
 	}
+	tenant.indexer = indexer.New(cfg, tenant.es, tenant.metrics, tenant.logger)
+	return tenant, err
 }
 
-func runServeMode(ctx context.Context, cfg config.Config, idx *indexer.Indexer, es *elasticsearch.Client, logger logging.Logger) {
-	if cfg.GitOrg != "" && len(cfg.GitRepos) > 0 {
+// runServeMode starts the HTTP server right away and brings up indexing,
+// for the default profile and each tenant, once Elasticsearch is reachable.
+// Until then the server runs degraded: /ready fails and searches return 503.
+func runServeMode(ctx context.Context, cfg config.Config, idx *indexer.Indexer, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger, tenants []servedTenant) {
+	start := func(cfg config.Config, idx *indexer.Indexer, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger) {
+		err := bootstrapES(ctx, es, 0, cfg.ESStartupBackoff, logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Fatalf("Failed to connect to Elasticsearch: %v", err)
+		}
+		startIndexing(ctx, cfg, idx, es, m, logger)
+	}
+
+	srv := server.New(idx, es, cfg, m, logger)
+	go start(cfg, idx, es, m, logger)
+	for _, tenant := range tenants {
+		srv.AddTenant(tenant.config.Tenant, tenant.indexer, tenant.es, tenant.config)
+		go start(tenant.config, tenant.indexer, tenant.es, tenant.metrics, tenant.logger)
+	}
+
+	err := srv.Start(ctx)
+	if err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
+
+// startIndexing runs the initial clone, prune, and index, then starts the
+// background loops. With QUEUE_URL set, the repositories are enqueued for
+// workers instead of indexed here.
+func startIndexing(ctx context.Context, cfg config.Config, idx *indexer.Indexer, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger) {
+	if cfg.QueueURL != "" {
+		startCoordinator(ctx, cfg, idx, es, m, logger)
+		return
+	}
+
+	if cfg.Cloning() {
 		log.Println("Cloning/updating repositories...")
 		err := idx.CloneRepos(ctx)
 		if err != nil {
@@ -92,24 +354,145 @@ func runServeMode(ctx context.Context, cfg config.Config, idx *indexer.Indexer,
 		}
 	}
 
-	log.Println("Running initial index...")
-	count, err := idx.IndexAllRepos(ctx)
+	if cfg.PruneRepos {
+		log.Println("Pruning repositories no longer configured...")
+		pruned, err := idx.PruneRepos(ctx)
+		if err != nil {
+			log.Printf("Warning: failed to prune repos: %v", err)
+		} else {
+			log.Printf("Pruned %d repositories", len(pruned))
+		}
+	}
+
+	rebuilt, err := idx.MigrateSchema(ctx)
 	if err != nil {
-		log.Printf("Warning: initial index failed: %v", err)
-	} else {
-		log.Printf("Initial index complete: %d functions", count)
+		log.Printf("Warning: %v", err)
+	}
+
+	if !rebuilt {
+		log.Println("Running initial index...")
+		count, indexErr := idx.IndexAllRepos(ctx)
+		if indexErr != nil {
+			log.Printf("Warning: initial index failed: %v", indexErr)
+		} else {
+			log.Printf("Initial index complete: %d functions", count)
+		}
+	}
+
+	if len(cfg.WarmupQueries) > 0 {
+		runWarmup(ctx, es, cfg.WarmupQueries)
 	}
 
 	go idx.RunIndexingLoop(ctx)
+	if cfg.DeadLetterMax > 0 && cfg.DeadLetterRetryInterval > 0 {
+		go idx.RunDeadLetterRetrier(ctx)
+	}
+	if cfg.AutoPause {
+		go idx.RunHealthMonitor(ctx)
+	}
+	if cfg.ExportInterval > 0 {
+		go export.New(cfg, es, m, logger).RunExportLoop(ctx)
+	}
+	if cfg.SnapshotInterval > 0 {
+		go idx.RunSnapshotLoop(ctx)
+	}
+	if cfg.RetentionDays > 0 {
+		go idx.RunRetentionLoop(ctx)
+	}
+}
 
-	srv := server.New(idx, es, cfg, logger)
-	err = srv.Start(ctx)
+// startCoordinator enqueues GIT_REPOS and the repositories of sources for
+// queue workers every INDEX_INTERVAL, in place of indexing them in this
+// process. Sources that don't list their repositories are discovered again
+// on each tick.
+func startCoordinator(ctx context.Context, cfg config.Config, idx *indexer.Indexer, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger) {
+	if len(cfg.RepoNames()) == 0 && len(cfg.Sources) == 0 {
+		log.Fatal("QUEUE_URL requires GIT_REPOS or sources: the coordinator enqueues the configured repositories")
+	}
+
+	q, err := queue.New(cfg, m, logger)
 	if err != nil {
-		log.Fatalf("Server error: %v", err)
+		log.Fatalf("Invalid queue configuration: %v", err)
+	}
+
+	if len(cfg.WarmupQueries) > 0 {
+		runWarmup(ctx, es, cfg.WarmupQueries)
+	}
+
+	go func() {
+		defer q.Close()
+		repos := func(ctx context.Context) (repos []string) {
+			var discoverErr error
+			repos, discoverErr = idx.RepoNames(ctx)
+			if discoverErr != nil {
+				logger.Warn("Failed to discover repositories", "error", discoverErr)
+			}
+			return repos
+		}
+		q.RunCoordinator(ctx, repos, cfg.IndexInterval, func() (paused bool) {
+			paused = idx.PauseStatus().Paused || idx.Draining()
+			return paused
+		})
+	}()
+	if cfg.AutoPause {
+		go idx.RunHealthMonitor(ctx)
 	}
+	if cfg.ExportInterval > 0 {
+		go export.New(cfg, es, m, logger).RunExportLoop(ctx)
+	}
+	if cfg.SnapshotInterval > 0 {
+		go idx.RunSnapshotLoop(ctx)
+	}
+	if cfg.RetentionDays > 0 {
+		go idx.RunRetentionLoop(ctx)
+	}
+}
+
+// runWarmup primes Elasticsearch caches with the configured queries before the
+// server starts taking traffic.
+func runWarmup(ctx context.Context, es *elasticsearch.Client, queries []string) {
+	const warmupTimeout = 30 * time.Second
+
+	warmupCtx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+
+	log.Printf("Running %d warm-up queries...", len(queries))
+	start := time.Now()
+	err := es.WarmUp(warmupCtx, queries)
+	if err != nil {
+		log.Printf("Warning: warm-up incomplete: %v", err)
+		return
+	}
+	log.Printf("Warm-up complete in %v", time.Since(start))
 }
 
+// runIndexMode indexes once and exits: the directory given with -path, or
+// every repository under REPOS_PATH.
 func runIndexMode(ctx context.Context, idx *indexer.Indexer) {
+	if dryRun {
+		runDryRun(ctx, idx)
+		return
+	}
+
+	if localPath != "" {
+		log.Printf("Indexing %s...", localPath)
+		count, err := idx.IndexPath(ctx, localPath, repoName)
+		if err != nil {
+			log.Fatalf("Index failed: %v", err)
+		}
+		log.Printf("Index complete: %d functions indexed", count)
+		return
+	}
+
+	rebuilt, err := idx.MigrateSchema(ctx)
+	if err != nil {
+		log.Fatalf("Index failed: %v", err)
+	}
+	if rebuilt {
+		log.Println("Index complete: rebuilt for the current schema")
+		return
+	}
+
 	log.Println("Running one-shot index...")
 	count, err := idx.IndexAllRepos(ctx)
 	if err != nil {
@@ -118,6 +501,205 @@ func runIndexMode(ctx context.Context, idx *indexer.Indexer) {
 	log.Printf("Index complete: %d functions indexed", count)
 }
 
+// runDryRun reports what index mode would change in the index, for -path or
+// every repository under REPOS_PATH, without writing to it. The schema isn't
+// migrated.
+func runDryRun(ctx context.Context, idx *indexer.Indexer) {
+	diffs := make(map[string]indexer.DocumentDiff)
+	if localPath != "" {
+		log.Printf("Previewing %s...", localPath)
+		repo, diff, err := idx.PreviewPath(ctx, localPath, repoName)
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		diffs[repo] = diff
+	} else {
+		log.Println("Running dry run...")
+		var err error
+		diffs, err = idx.PreviewAllRepos(ctx)
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+	}
+
+	for _, repo := range slices.Sorted(maps.Keys(diffs)) {
+		diff := diffs[repo]
+		log.Printf("%s: %d to add, %d to update, %d to delete, %d unchanged, %d skipped as unchanged files", repo, diff.Added, diff.Updated, diff.Deleted, diff.Unchanged, diff.Skipped)
+		logDocumentRefs("+", diff.AddedDocs)
+		logDocumentRefs("~", diff.UpdatedDocs)
+		logDocumentRefs("-", diff.DeletedDocs)
+	}
+	log.Println("Dry run complete: nothing was written")
+}
+
+// logDocumentRefs lists the documents of one kind of change in a dry run.
+func logDocumentRefs(sign string, docs []indexer.DocumentRef) {
+	for _, doc := range docs {
+		log.Printf("  %s %s %s %s", sign, doc.FilePath, doc.Kind, doc.FunctionName)
+	}
+}
+
+// runIndexFileMode indexes the one file named on the command line, replacing
+// its documents, and exits. The file's path is relative to the repository
+// root, the -path directory when given and the repository's clone under
+// REPOS_PATH otherwise; its content is read from standard input with -stdin
+// and from the file, under -path or the working directory, without.
+func runIndexFileMode(ctx context.Context, idx *indexer.Indexer) {
+	rel := filepath.ToSlash(flag.Arg(0))
+
+	var root string
+	if localPath != "" {
+		var err error
+		root, err = filepath.Abs(localPath)
+		if err != nil {
+			log.Fatalf("Failed to resolve %s: %v", localPath, err)
+		}
+		if repoName == "" {
+			repoName = filepath.Base(root)
+		}
+	}
+
+	var content []byte
+	var err error
+	if readStdin {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(filepath.Join(localPath, filepath.FromSlash(rel)))
+	}
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", rel, err)
+	}
+
+	result, err := idx.IndexFile(ctx, repoName, root, rel, content)
+	if err != nil {
+		log.Fatalf("Index failed: %v", err)
+	}
+	if result.Error != "" {
+		log.Printf("Warning: %s did not parse cleanly: %s", rel, result.Error)
+	}
+	log.Printf("Index complete: %d functions indexed from %s, %d documents replaced", result.Indexed, result.FilePath, result.Deleted)
+}
+
+func runBackfillMode(ctx context.Context, idx *indexer.Indexer) {
+	log.Println("Backfilling embeddings...")
+	status, err := idx.BackfillEmbeddings(ctx, targetIndex)
+	if err != nil {
+		log.Fatalf("Backfill failed after %d documents: %v", status.Documents, err)
+	}
+	log.Printf("Backfill complete: %d documents embedded with %s into %s", status.Documents, status.Model, status.TargetIndex)
+}
+
+// runWorkerMode indexes repositories from the queue until shutdown, one job
+// at a time, serving only /health and /metrics. Each worker process is one
+// consumer, named after its host.
+func runWorkerMode(ctx context.Context, cfg config.Config, idx *indexer.Indexer, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger) {
+	q, err := queue.New(cfg, m, logger)
+	if err != nil {
+		log.Fatalf("Invalid queue configuration: %v", err)
+	}
+	defer q.Close()
+
+	go func() {
+		serveErr := server.New(idx, es, cfg, m, logger).StartMetrics(ctx)
+		if serveErr != nil {
+			log.Printf("Warning: metrics server stopped: %v", serveErr)
+		}
+	}()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+
+	if cfg.DeadLetterMax > 0 && cfg.DeadLetterRetryInterval > 0 {
+		go idx.RunDeadLetterRetrier(ctx)
+	}
+
+	q.RunWorker(ctx, idx, fmt.Sprintf("%s-%d", hostname, os.Getpid()))
+}
+
+// runExportMode writes every document in ES_INDEX to -out with its ID, so an
+// index built where the repositories are reachable can be imported into an
+// offline deployment.
+func runExportMode(ctx context.Context, es *elasticsearch.Client) {
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if outPath != "-" {
+		var err error
+		file, err = os.Create(outPath)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", outPath, err)
+		}
+		w = file
+	}
+
+	var zw *gzip.Writer
+	if strings.HasSuffix(outPath, ".gz") {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+
+	count, err := es.Dump(ctx, w)
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil && file != nil {
+		err = file.Close()
+	}
+	if err != nil {
+		log.Fatalf("Export failed after %d documents: %v", count, err)
+	}
+	log.Printf("Export complete: %d documents written to %s", count, outPath)
+}
+
+// runImportMode indexes the documents in -in, a dump from export mode or an
+// exported snapshot, into ES_INDEX.
+func runImportMode(ctx context.Context, cfg config.Config, es *elasticsearch.Client) {
+	var r io.Reader = os.Stdin
+	if inPath != "-" {
+		file, err := os.Open(inPath)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", inPath, err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	if strings.HasSuffix(inPath, ".gz") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", inPath, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	count, err := es.Import(ctx, r, cfg.IndexBulkKB*1024)
+	if err != nil {
+		log.Fatalf("Import failed after %d documents: %v", count, err)
+	}
+	log.Printf("Import complete: %d documents indexed from %s", count, inPath)
+}
+
+// runSnapshotMode snapshots ES_INDEX into SNAPSHOT_REPOSITORY.
+func runSnapshotMode(ctx context.Context, idx *indexer.Indexer) {
+	info, err := idx.Snapshot(ctx, indexer.SnapshotManual)
+	if err != nil {
+		log.Fatalf("Snapshot failed: %v", err)
+	}
+	log.Printf("Snapshot complete: %s of %s", info.Name, strings.Join(info.Indices, ", "))
+}
+
+// runRestoreMode restores -snapshot from SNAPSHOT_REPOSITORY as a new index
+// generation and points the ES_INDEX alias at it.
+func runRestoreMode(ctx context.Context, idx *indexer.Indexer) {
+	restored, err := idx.RestoreSnapshot(ctx, snapshot)
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	log.Printf("Restore complete: %s restored as %s", restored.Snapshot, restored.Index)
+}
+
 func runSearchMode(ctx context.Context, es *elasticsearch.Client) {
 	query := strings.Join(flag.Args(), " ")
 	if query == "" {
@@ -129,15 +711,8 @@ func runSearchMode(ctx context.Context, es *elasticsearch.Client) {
 		log.Fatalf("Search failed: %v", err)
 	}
 
-	if len(results) == 0 {
-		fmt.Println("No results found")
-		return
-	}
-
-	for i, result := range results {
-		fmt.Printf("\n=== Result %d: %s/%s - %s ===\n",
-			i+1, result.Repo, result.FilePath, result.FunctionName)
-		fmt.Printf("Named Returns: %v\n", result.HasNamedReturns)
-		fmt.Printf("\n%s\n", result.Code)
+	err = output.Write(os.Stdout, outputFmt, query, results)
+	if err != nil {
+		log.Fatalf("Failed to write results: %v", err)
 	}
 }
@@ -1,55 +1,317 @@
-// Package config handles application configuration from environment variables.
+// Package config handles application configuration from environment variables
+// and an optional YAML config file.
 package config
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
-// Config holds application configuration from environment variables.
+// defaultLintChecks are the checks run when LINT_CHECKS is unset. govet is
+// opt-in because it needs the Go toolchain and module dependencies at index time.
+const defaultLintChecks = "gofmt,namedreturns,noinlineerr,godot,funlen"
+
+// defaultExcludePatterns are the files skipped when EXCLUDE_PATTERNS is
+// unset: Go tests, generated protobuf and Kubernetes code, and test fixtures.
+const defaultExcludePatterns = "*_test.go,*.pb.go,zz_generated*,testdata/"
+
+// SCHEMA_MIGRATION values: how an index whose mapping is behind the
+// indexer's schema version is brought up to date at startup.
+const (
+	// SchemaMigrationAdditive adds the missing fields to the mapping.
+	SchemaMigrationAdditive = "additive"
+	// SchemaMigrationRebuild rebuilds the index into a new generation.
+	SchemaMigrationRebuild = "rebuild"
+	// SchemaMigrationNone only reports the mismatch.
+	SchemaMigrationNone = "none"
+)
+
+// ProxyNone is the ES_PROXY and GIT_PROXY value connecting directly, ignoring
+// the proxy variables of the environment.
+const ProxyNone = "none"
+
+// ErrUnknownEnvironment is returned when the selected environment is not
+// declared in ENVIRONMENTS.
+var ErrUnknownEnvironment = errors.New("unknown environment")
+
+// ErrExportBucketRequired is returned when exports are scheduled without a bucket.
+var ErrExportBucketRequired = errors.New("EXPORT_BUCKET must be set when EXPORT_INTERVAL is enabled")
+
+// ErrSnapshotRepositoryRequired is returned when snapshot settings are given
+// without a snapshot repository.
+var ErrSnapshotRepositoryRequired = errors.New("SNAPSHOT_REPOSITORY must be set to take snapshots")
+
+// Config holds application configuration from environment variables and the
+// config file.
 type Config struct {
-	ESHost        string
-	ESIndex       string
-	ESUsername    string
-	ESPassword    string
-	ReposPath     string
-	GitOrg        string
-	GitRepos      []string
-	GitURLFormat  string
-	IndexInterval time.Duration
-	HTTPAddr      string
-	LogLevel      string
-	GitSSHKeyPath string
-	GitToken      string
-	Mode          string
-}
-
-// Load loads configuration from environment variables.
+	Environment             string
+	ESHost                  string
+	ESIndex                 string
+	ESUsername              string
+	ESPassword              string
+	ESAPIKey                string
+	ESCloudID               string
+	ESBackend               string
+	ESCAFile                string
+	ESClientCertFile        string
+	ESClientKeyFile         string
+	ESInsecureSkipVerify    bool
+	ESProxy                 string
+	ESStartupTimeout        time.Duration
+	ESStartupBackoff        time.Duration
+	ESBreakerThreshold      int
+	ESBreakerCooldown       time.Duration
+	ESCompression           bool
+	ShutdownTimeout         time.Duration
+	StateFile               string
+	StateCheckpointFiles    int
+	ManifestFile            string
+	DeadLetterFile          string
+	DeadLetterMax           int
+	DeadLetterRetryInterval time.Duration
+	ESIndexTemplate         string
+	ESIndexPatterns         []string
+	ESGenerationFormat      string
+	ESGenerationsKept       int
+	SchemaMigration         string
+	ReposPath               string
+	GitOrg                  string
+	GitRepos                []string
+	PruneRepos              bool
+	GitCloneDepth           int
+	GitCloneFilter          string
+	GitProxy                string
+	QueueURL                string
+	QueueStream             string
+	QueueGroup              string
+	QueueVisibility         time.Duration
+	QueueMaxAttempts        int
+	GitURLFormat            string
+	SourceURLTemplate       string
+	IndexInterval           time.Duration
+	ProgressInterval        time.Duration
+	HTTPAddr                string
+	HTTPReadTimeout         time.Duration
+	HTTPWriteTimeout        time.Duration
+	HTTPIdleTimeout         time.Duration
+	HTTPCompression         bool
+	TLSCertFile             string
+	TLSKeyFile              string
+	TLSClientCAFile         string
+	RateLimitRPS            float64
+	RateLimitBurst          int
+	MaxRequestBodyKB        int
+	LogLevel                string
+	GitSSHKeyPath           string
+	GitToken                string
+	Mode                    string
+	RenameFile              string
+	APIKeys                 []string
+	AdminAPIKeys            []string
+	JWTIssuer               string
+	JWTJWKSURL              string
+	JWTAudience             string
+	MaxSourceKB             int
+	MaxDocsPerRepo          int
+	ChunkMaxLines           int
+	ChunkOverlapLines       int
+	IndexMemoryMB           int
+	IndexBulkKB             int
+	IndexStaleAfter         time.Duration
+	ReadyFailStale          bool
+	DedupIdentical          bool
+	IndexMarkdown           bool
+	IndexOverviews          bool
+	IndexTypes              bool
+	IndexPlatforms          []string
+	Languages               []string
+	IncludePatterns         []string
+	ExcludePatterns         []string
+	SkipDirs                []string
+	IgnoreFiles             []string
+	EnrichCommand           []string
+	EnrichTimeout           time.Duration
+	WarmupQueries           []string
+	AutoPause               bool
+	AutoPauseCPUPercent     int
+	HealthCheckInterval     time.Duration
+	WebhookURLs             []string
+	WebhookFormat           string
+	WebhookFailuresOnly     bool
+	ExportInterval          time.Duration
+	ExportBucket            string
+	ExportPrefix            string
+	ExportEndpoint          string
+	ExportRegion            string
+	ExportAccessKey         string
+	ExportSecretKey         string
+	ExportSessionToken      string
+	ExportRetention         int
+	SnapshotRepository      string
+	SnapshotRepositoryType  string
+	SnapshotSettings        map[string]string
+	SnapshotBeforeRebuild   bool
+	SnapshotInterval        time.Duration
+	SnapshotsKept           int
+	RetentionDays           int
+	RetentionInterval       time.Duration
+	EmbeddingURL            string
+	EmbeddingModel          string
+	EmbeddingAPIKey         string
+	EmbeddingBatchSize      int
+	EmbeddingProvider       string
+	EmbeddingConcurrency    int
+	EmbeddingCacheSize      int
+	EmbeddingCacheIndex     string
+	RerankURL               string
+	RerankAPI               string
+	RerankModel             string
+	RerankAPIKey            string
+	RerankTopK              int
+	RerankTimeout           time.Duration
+	RewriteURL              string
+	RewriteModel            string
+	RewriteAPIKey           string
+	RewriteTimeout          time.Duration
+	RewriteMaxQueries       int
+	SummaryURL              string
+	SummaryModel            string
+	SummaryAPIKey           string
+	SummaryTimeout          time.Duration
+	SummaryRPS              float64
+	SearchRanking           string
+	SearchFieldBoosts       map[string]float64
+	SearchFlagBoosts        map[string]float64
+	SearchMaxQueryLength    int
+	SearchMaxLimit          int
+	SearchMaxFilterValues   int
+	SearchMaxQueries        int
+	LintChecks              []string
+	UsageStats              bool
+	SLOLatencyThreshold     time.Duration
+	SLOObjective            float64
+	Repos                   []RepoConfig
+	Sources                 []SourceConfig
+	// Tenant names the tenant this configuration is for, empty for the
+	// shared one. Tenants holds the configuration of each tenant.
+	Tenant  string
+	Tenants []Config
+}
+
+// Load loads configuration from environment variables for the environment
+// named by ENVIRONMENT, if any.
 func Load() (cfg Config, err error) {
+	cfg, err = LoadEnvironment(os.Getenv("ENVIRONMENT"))
+	return cfg, err
+}
+
+// LoadEnvironment loads configuration for a named environment such as
+// "staging" or "prod". Each variable is read from its environment-prefixed
+// form first (STAGING_ES_INDEX), falling back to the shared one (ES_INDEX).
+// The name must be listed in ENVIRONMENTS. An empty name loads the shared
+// variables only.
+func LoadEnvironment(name string) (cfg Config, err error) {
+	cfg, err = loadEnvironment(envLoader{}, name)
+	return cfg, err
+}
+
+// loadEnvironment loads configuration for a named environment through l,
+// which may carry values from a config file.
+func loadEnvironment(l envLoader, name string) (cfg Config, err error) {
+	environments := l.getEnv("ENVIRONMENTS", "")
+	if name != "" {
+		if !slices.Contains(splitList(environments), name) {
+			err = fmt.Errorf("%w: %q (ENVIRONMENTS=%q)", ErrUnknownEnvironment, name, environments)
+			return cfg, err
+		}
+		l.prefix = envPrefix(name)
+	}
+
+	cfg, err = l.load()
+	cfg.Environment = name
+	for i := range cfg.Tenants {
+		cfg.Tenants[i].Environment = name
+	}
+	return cfg, err
+}
+
+// load reads the configuration through the loader's environment prefix, one
+// section at a time.
+func (l envLoader) load() (cfg Config, err error) {
 	cfg = Config{
-		ESHost:        getEnv("ES_HOST", "http://localhost:9200"),
-		ESIndex:       getEnv("ES_INDEX", "code-index"),
-		ESUsername:    getEnv("ES_USERNAME", ""),
-		ESPassword:    getEnv("ES_PASSWORD", ""),
-		ReposPath:     getEnv("REPOS_PATH", "/repos"),
-		GitOrg:        getEnv("GIT_ORG", ""),
-		GitURLFormat:  getEnv("GIT_URL_TEMPLATE", "git@github.com:{org}/{repo}.git"),
-		HTTPAddr:      getEnv("HTTP_ADDR", ":8080"),
-		LogLevel:      getEnv("LOG_LEVEL", "info"),
-		GitSSHKeyPath: getEnv("GIT_SSH_KEY_PATH", ""),
-		GitToken:      getEnv("GIT_TOKEN", ""),
-	}
-
-	intervalStr := getEnv("INDEX_INTERVAL", "5m")
-	cfg.IndexInterval, err = time.ParseDuration(intervalStr)
+		ESHost:        l.getEnv("ES_HOST", "http://localhost:9200"),
+		ESIndex:       l.getEnv("ES_INDEX", "code-index"),
+		ESUsername:    l.getEnv("ES_USERNAME", ""),
+		ESPassword:    l.getEnv("ES_PASSWORD", ""),
+		ESBackend:     l.getEnv("ES_BACKEND", "auto"),
+		ReposPath:     l.getEnv("REPOS_PATH", "/repos"),
+		GitOrg:        l.getEnv("GIT_ORG", ""),
+		GitURLFormat:  l.getEnv("GIT_URL_TEMPLATE", "git@github.com:{org}/{repo}.git"),
+		HTTPAddr:      l.getEnv("HTTP_ADDR", ":8080"),
+		LogLevel:      l.getEnv("LOG_LEVEL", "info"),
+		GitSSHKeyPath: l.getEnv("GIT_SSH_KEY_PATH", ""),
+		GitToken:      l.getEnv("GIT_TOKEN", ""),
+	}
+
+	err = l.loadSourcesConfig(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = l.loadIndexingConfig(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = l.loadElasticsearchConfig(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = l.loadServerConfig(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = l.loadModelConfig(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = l.loadRetentionConfig(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = l.loadAuthConfig(&cfg)
 	if err != nil {
-		err = fmt.Errorf("invalid INDEX_INTERVAL: %w", err)
 		return cfg, err
 	}
 
-	reposStr := getEnv("GIT_REPOS", "")
+	if l.tenantPrefix == "" {
+		cfg.Tenants, err = l.loadTenants(cfg)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, err
+}
+
+// loadSourcesConfig loads which repositories are indexed, how they are
+// cloned, and how search results link back to them.
+func (l envLoader) loadSourcesConfig(cfg *Config) (err error) {
+	reposStr := l.getEnv("GIT_REPOS", "")
 	if reposStr != "" {
 		cfg.GitRepos = strings.Split(reposStr, ",")
 		for i := range cfg.GitRepos {
@@ -57,7 +319,1570 @@ func Load() (cfg Config, err error) {
 		}
 	}
 
-	return cfg, err
+	cfg.SourceURLTemplate, err = loadSourceURLTemplate("SOURCE_URL_TEMPLATE", l.getEnv("SOURCE_URL_TEMPLATE", ""))
+	if err != nil {
+		return err
+	}
+
+	err = l.loadCloneConfig(cfg)
+	return err
+}
+
+// loadIndexingConfig loads how often and how much is indexed, where indexing
+// progress and failures are kept, and what goes into each document.
+func (l envLoader) loadIndexingConfig(cfg *Config) (err error) {
+	cfg.IndexInterval, err = time.ParseDuration(l.getEnv("INDEX_INTERVAL", "5m"))
+	if err != nil {
+		err = fmt.Errorf("invalid INDEX_INTERVAL: %w", err)
+		return err
+	}
+
+	cfg.MaxSourceKB, err = strconv.Atoi(l.getEnv("ES_MAX_SOURCE_KB", "0"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_MAX_SOURCE_KB: %w", err)
+		return err
+	}
+
+	cfg.MaxDocsPerRepo, err = strconv.Atoi(l.getEnv("MAX_DOCS_PER_REPO", "100000"))
+	if err != nil {
+		err = fmt.Errorf("invalid MAX_DOCS_PER_REPO: %w", err)
+		return err
+	}
+	if cfg.MaxDocsPerRepo < 0 {
+		err = fmt.Errorf("invalid MAX_DOCS_PER_REPO %d: must not be negative", cfg.MaxDocsPerRepo)
+		return err
+	}
+
+	err = l.loadRunConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.LintChecks, err = loadLintChecks(l.getEnv("LINT_CHECKS", defaultLintChecks))
+	if err != nil {
+		return err
+	}
+
+	err = l.loadStateConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadQueueConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadDeadLetterConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadChunkConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadMemoryConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadContentConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadEnrichConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadWebhookConfig(cfg)
+	return err
+}
+
+// loadRunConfig loads how index runs pause under load and how often they
+// report their progress.
+func (l envLoader) loadRunConfig(cfg *Config) (err error) {
+	cfg.AutoPause, err = strconv.ParseBool(l.getEnv("AUTO_PAUSE", "true"))
+	if err != nil {
+		err = fmt.Errorf("invalid AUTO_PAUSE: %w", err)
+		return err
+	}
+
+	cfg.AutoPauseCPUPercent, err = strconv.Atoi(l.getEnv("AUTO_PAUSE_CPU_PERCENT", "90"))
+	if err != nil {
+		err = fmt.Errorf("invalid AUTO_PAUSE_CPU_PERCENT: %w", err)
+		return err
+	}
+
+	cfg.ProgressInterval, err = time.ParseDuration(l.getEnv("PROGRESS_INTERVAL", "10s"))
+	if err != nil {
+		err = fmt.Errorf("invalid PROGRESS_INTERVAL: %w", err)
+		return err
+	}
+	if cfg.ProgressInterval <= 0 {
+		err = fmt.Errorf("invalid PROGRESS_INTERVAL %s: must be positive", cfg.ProgressInterval)
+		return err
+	}
+
+	return err
+}
+
+// loadElasticsearchConfig loads how Elasticsearch is reached and how its
+// index is created.
+func (l envLoader) loadElasticsearchConfig(cfg *Config) (err error) {
+	err = l.loadESAuthConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadESTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadProxyConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadESClientConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadTemplateConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadGenerationConfig(cfg)
+	return err
+}
+
+// loadServerConfig loads the HTTP server, its limits, and how searches are
+// served and watched.
+func (l envLoader) loadServerConfig(cfg *Config) (err error) {
+	cfg.WarmupQueries = splitList(l.getEnv("WARMUP_QUERIES", ""))
+
+	cfg.HealthCheckInterval, err = time.ParseDuration(l.getEnv("HEALTH_CHECK_INTERVAL", "30s"))
+	if err != nil {
+		err = fmt.Errorf("invalid HEALTH_CHECK_INTERVAL: %w", err)
+		return err
+	}
+
+	cfg.UsageStats, err = strconv.ParseBool(l.getEnv("USAGE_STATS", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid USAGE_STATS: %w", err)
+		return err
+	}
+
+	err = l.loadStartupConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadHTTPConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadLimitConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadReadinessConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadSearchConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadSLOConfig(cfg)
+	return err
+}
+
+// loadModelConfig loads the models used for embeddings, reranking, query
+// rewriting, and summaries.
+func (l envLoader) loadModelConfig(cfg *Config) (err error) {
+	err = l.loadEmbeddingConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadRerankConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadRewriteConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadSummaryConfig(cfg)
+	return err
+}
+
+// loadRetentionConfig loads exports, snapshots, and document retention. It
+// runs after loadIndexingConfig, since retention depends on INDEX_INTERVAL.
+func (l envLoader) loadRetentionConfig(cfg *Config) (err error) {
+	err = l.loadExportConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadSnapshotConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = l.loadDocumentRetentionConfig(cfg)
+	return err
+}
+
+// loadAuthConfig loads JWT validation and the API keys. JWT_JWKS_URL requires
+// JWT_ISSUER, since without it a token from any issuer trusting the same keys
+// would be accepted.
+func (l envLoader) loadAuthConfig(cfg *Config) (err error) {
+	cfg.JWTIssuer = l.getEnv("JWT_ISSUER", "")
+	cfg.JWTJWKSURL = l.getEnv("JWT_JWKS_URL", "")
+	cfg.JWTAudience = l.getEnv("JWT_AUDIENCE", "")
+	if cfg.JWTJWKSURL != "" && cfg.JWTIssuer == "" {
+		err = errors.New("JWT_JWKS_URL requires JWT_ISSUER")
+		return err
+	}
+
+	cfg.APIKeys, err = loadAPIKeys(l.getEnv("API_KEYS", ""), l.getEnv("API_KEYS_FILE", ""))
+	if err != nil {
+		return err
+	}
+
+	cfg.AdminAPIKeys = splitList(l.getEnv("ADMIN_API_KEYS", ""))
+	return err
+}
+
+// sourceURLPlaceholders are the fields SOURCE_URL_TEMPLATE and a source's
+// source_url_template may reference.
+//
+//nolint:gochecknoglobals // fixed set of template placeholders
+var sourceURLPlaceholders = []string{"{host}", "{org}", "{repo}", "{commit}", "{path}", "{start_line}", "{end_line}"}
+
+// loadSourceURLTemplate validates the permalink template used to link search
+// results to a code host, such as
+// https://github.com/{org}/{repo}/blob/{commit}/{path}#L{start_line}-L{end_line}.
+// Unknown placeholders are rejected so a typo doesn't render broken links.
+// name is the setting the template comes from, for the error.
+func loadSourceURLTemplate(name string, template string) (validated string, err error) {
+	rest := template
+	for _, placeholder := range sourceURLPlaceholders {
+		rest = strings.ReplaceAll(rest, placeholder, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		err = fmt.Errorf("invalid %s %q: placeholders must be one of %s", name, template, strings.Join(sourceURLPlaceholders, ", "))
+		return validated, err
+	}
+
+	validated = template
+	return validated, err
+}
+
+// loadStartupConfig loads how long and how often to retry reaching
+// Elasticsearch at startup, whether repositories no longer configured are
+// pruned then, and how long shutdown waits for in-flight indexing.
+func (l envLoader) loadStartupConfig(cfg *Config) (err error) {
+	cfg.ESStartupTimeout, err = time.ParseDuration(l.getEnv("ES_STARTUP_TIMEOUT", "5m"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_STARTUP_TIMEOUT: %w", err)
+		return err
+	}
+
+	cfg.ESStartupBackoff, err = time.ParseDuration(l.getEnv("ES_STARTUP_BACKOFF", "1s"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_STARTUP_BACKOFF: %w", err)
+		return err
+	}
+	if cfg.ESStartupBackoff <= 0 {
+		err = fmt.Errorf("invalid ES_STARTUP_BACKOFF %v: must be positive", cfg.ESStartupBackoff)
+		return err
+	}
+
+	cfg.PruneRepos, err = strconv.ParseBool(l.getEnv("PRUNE_REPOS", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid PRUNE_REPOS: %w", err)
+		return err
+	}
+
+	cfg.ShutdownTimeout, err = time.ParseDuration(l.getEnv("SHUTDOWN_TIMEOUT", "5m"))
+	if err != nil {
+		err = fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+		return err
+	}
+	if cfg.ShutdownTimeout < 0 {
+		err = fmt.Errorf("invalid SHUTDOWN_TIMEOUT %v: must not be negative", cfg.ShutdownTimeout)
+		return err
+	}
+
+	return err
+}
+
+// loadStateConfig loads where indexing progress is saved so an interrupted
+// run can resume, and how often, and where the hashes of indexed files are
+// kept so unchanged ones can be skipped, and where the functions of each
+// repository's last run are kept for rename detection. STATE_FILE and
+// RENAME_FILE default to files in REPOS_PATH, next to the clones they
+// describe; "none" disables them. MANIFEST_FILE is off unless set.
+func (l envLoader) loadStateConfig(cfg *Config) (err error) {
+	cfg.StateFile = l.getEnv("STATE_FILE", filepath.Join(cfg.ReposPath, ".rag-indexer-state.json"))
+	if cfg.StateFile == "none" {
+		cfg.StateFile = ""
+	}
+
+	cfg.RenameFile = l.getEnv("RENAME_FILE", filepath.Join(cfg.ReposPath, ".rag-indexer-renames.json"))
+	if cfg.RenameFile == "none" {
+		cfg.RenameFile = ""
+	}
+
+	cfg.ManifestFile = l.getEnv("MANIFEST_FILE", "")
+	if cfg.ManifestFile == "none" {
+		cfg.ManifestFile = ""
+	}
+
+	cfg.StateCheckpointFiles, err = strconv.Atoi(l.getEnv("STATE_CHECKPOINT_FILES", "100"))
+	if err != nil {
+		err = fmt.Errorf("invalid STATE_CHECKPOINT_FILES: %w", err)
+		return err
+	}
+	if cfg.StateCheckpointFiles <= 0 {
+		err = fmt.Errorf("invalid STATE_CHECKPOINT_FILES %d: must be positive", cfg.StateCheckpointFiles)
+		return err
+	}
+
+	return err
+}
+
+// loadCloneConfig loads how much of each repository is cloned: the commits
+// of history, 0 for all, and the partial clone filter, if any.
+func (l envLoader) loadCloneConfig(cfg *Config) (err error) {
+	cfg.GitCloneDepth, err = strconv.Atoi(l.getEnv("GIT_CLONE_DEPTH", "0"))
+	if err != nil {
+		err = fmt.Errorf("invalid GIT_CLONE_DEPTH: %w", err)
+		return err
+	}
+	if cfg.GitCloneDepth < 0 {
+		err = fmt.Errorf("invalid GIT_CLONE_DEPTH %d: must not be negative", cfg.GitCloneDepth)
+		return err
+	}
+
+	filter := l.getEnv("GIT_CLONE_FILTER", "none")
+	switch filter {
+	case "none", "":
+	case "blob:none", "tree:0":
+		cfg.GitCloneFilter = filter
+	default:
+		err = fmt.Errorf("invalid GIT_CLONE_FILTER %q: must be blob:none, tree:0, or none", filter)
+		return err
+	}
+
+	return err
+}
+
+// loadDeadLetterConfig loads where documents that fail to index are kept,
+// how many, and how often they're retried. DEADLETTER_FILE defaults to a file
+// in REPOS_PATH; "none" keeps them in memory only.
+func (l envLoader) loadDeadLetterConfig(cfg *Config) (err error) {
+	cfg.DeadLetterFile = l.getEnv("DEADLETTER_FILE", filepath.Join(cfg.ReposPath, ".rag-indexer-deadletter.json"))
+	if cfg.DeadLetterFile == "none" {
+		cfg.DeadLetterFile = ""
+	}
+
+	cfg.DeadLetterMax, err = strconv.Atoi(l.getEnv("DEADLETTER_MAX", "10000"))
+	if err != nil {
+		err = fmt.Errorf("invalid DEADLETTER_MAX: %w", err)
+		return err
+	}
+	if cfg.DeadLetterMax < 0 {
+		err = fmt.Errorf("invalid DEADLETTER_MAX %d: must not be negative", cfg.DeadLetterMax)
+		return err
+	}
+
+	cfg.DeadLetterRetryInterval, err = time.ParseDuration(l.getEnv("DEADLETTER_RETRY_INTERVAL", "1m"))
+	if err != nil {
+		err = fmt.Errorf("invalid DEADLETTER_RETRY_INTERVAL: %w", err)
+		return err
+	}
+	if cfg.DeadLetterRetryInterval < 0 {
+		err = fmt.Errorf("invalid DEADLETTER_RETRY_INTERVAL %v: must not be negative", cfg.DeadLetterRetryInterval)
+		return err
+	}
+
+	return err
+}
+
+// loadQueueConfig loads the Redis stream index jobs are distributed through
+// when QUEUE_URL is set, and how jobs are retried.
+func (l envLoader) loadQueueConfig(cfg *Config) (err error) {
+	cfg.QueueURL = l.getEnv("QUEUE_URL", "")
+	cfg.QueueStream = l.getEnv("QUEUE_STREAM", "rag-indexer:jobs")
+	cfg.QueueGroup = l.getEnv("QUEUE_GROUP", "rag-indexer-workers")
+
+	cfg.QueueVisibility, err = time.ParseDuration(l.getEnv("QUEUE_VISIBILITY_TIMEOUT", "5m"))
+	if err != nil {
+		err = fmt.Errorf("invalid QUEUE_VISIBILITY_TIMEOUT: %w", err)
+		return err
+	}
+	if cfg.QueueVisibility <= 0 {
+		err = fmt.Errorf("invalid QUEUE_VISIBILITY_TIMEOUT %v: must be positive", cfg.QueueVisibility)
+		return err
+	}
+
+	cfg.QueueMaxAttempts, err = strconv.Atoi(l.getEnv("QUEUE_MAX_ATTEMPTS", "3"))
+	if err != nil {
+		err = fmt.Errorf("invalid QUEUE_MAX_ATTEMPTS: %w", err)
+		return err
+	}
+	if cfg.QueueMaxAttempts <= 0 {
+		err = fmt.Errorf("invalid QUEUE_MAX_ATTEMPTS %d: must be positive", cfg.QueueMaxAttempts)
+		return err
+	}
+
+	return err
+}
+
+// loadESClientConfig loads how many consecutive failed Elasticsearch
+// requests open the client's circuit breaker, how long it stays open before
+// a request is let through to probe for recovery, and whether request bodies
+// are gzipped. A threshold of zero disables the breaker.
+func (l envLoader) loadESClientConfig(cfg *Config) (err error) {
+	cfg.ESBreakerThreshold, err = strconv.Atoi(l.getEnv("ES_BREAKER_THRESHOLD", "5"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_BREAKER_THRESHOLD: %w", err)
+		return err
+	}
+	if cfg.ESBreakerThreshold < 0 {
+		err = fmt.Errorf("invalid ES_BREAKER_THRESHOLD %d: must not be negative", cfg.ESBreakerThreshold)
+		return err
+	}
+
+	cfg.ESBreakerCooldown, err = time.ParseDuration(l.getEnv("ES_BREAKER_COOLDOWN", "30s"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_BREAKER_COOLDOWN: %w", err)
+		return err
+	}
+	if cfg.ESBreakerCooldown <= 0 {
+		err = fmt.Errorf("invalid ES_BREAKER_COOLDOWN %v: must be positive", cfg.ESBreakerCooldown)
+		return err
+	}
+
+	cfg.ESCompression, err = strconv.ParseBool(l.getEnv("ES_COMPRESSION", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_COMPRESSION: %w", err)
+		return err
+	}
+
+	return err
+}
+
+// loadESAuthConfig loads Elastic Cloud settings: an API key to send instead
+// of basic auth, and a cloud ID the cluster's URL is resolved from instead of
+// ES_HOST.
+func (l envLoader) loadESAuthConfig(cfg *Config) (err error) {
+	cfg.ESAPIKey = l.getEnv("ES_API_KEY", "")
+	cfg.ESCloudID = l.getEnv("ES_CLOUD_ID", "")
+
+	if cfg.ESAPIKey != "" && cfg.ESUsername != "" {
+		err = errors.New("ES_API_KEY and ES_USERNAME are mutually exclusive")
+		return err
+	}
+	if cfg.ESCloudID != "" && l.getEnv("ES_HOST", "") != "" {
+		err = errors.New("ES_CLOUD_ID and ES_HOST are mutually exclusive")
+		return err
+	}
+
+	return err
+}
+
+// loadESTLSConfig loads how the Elasticsearch client verifies the cluster:
+// extra CAs to trust beyond the system's, a client certificate to present,
+// or, for testing only, no verification at all.
+func (l envLoader) loadESTLSConfig(cfg *Config) (err error) {
+	cfg.ESCAFile = l.getEnv("ES_CA_FILE", "")
+	cfg.ESClientCertFile = l.getEnv("ES_CLIENT_CERT_FILE", "")
+	cfg.ESClientKeyFile = l.getEnv("ES_CLIENT_KEY_FILE", "")
+
+	if (cfg.ESClientCertFile == "") != (cfg.ESClientKeyFile == "") {
+		err = errors.New("ES_CLIENT_CERT_FILE and ES_CLIENT_KEY_FILE must be set together")
+		return err
+	}
+
+	cfg.ESInsecureSkipVerify, err = strconv.ParseBool(l.getEnv("ES_INSECURE_SKIP_VERIFY", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_INSECURE_SKIP_VERIFY: %w", err)
+		return err
+	}
+	if cfg.ESInsecureSkipVerify && cfg.ESCAFile != "" {
+		err = errors.New("ES_INSECURE_SKIP_VERIFY and ES_CA_FILE are mutually exclusive")
+		return err
+	}
+
+	return err
+}
+
+// loadReadinessConfig loads how long a repository may go without a
+// successful index before it is reported stale, and whether a stale
+// repository fails the readiness probe or only marks the detailed health
+// degraded.
+func (l envLoader) loadReadinessConfig(cfg *Config) (err error) {
+	cfg.IndexStaleAfter, err = time.ParseDuration(l.getEnv("INDEX_STALE_AFTER", "0"))
+	if err != nil {
+		err = fmt.Errorf("invalid INDEX_STALE_AFTER: %w", err)
+		return err
+	}
+	if cfg.IndexStaleAfter < 0 {
+		err = fmt.Errorf("invalid INDEX_STALE_AFTER %v: must not be negative", cfg.IndexStaleAfter)
+		return err
+	}
+
+	cfg.ReadyFailStale, err = strconv.ParseBool(l.getEnv("READY_FAIL_STALE", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid READY_FAIL_STALE: %w", err)
+		return err
+	}
+	if cfg.ReadyFailStale && cfg.IndexStaleAfter == 0 {
+		err = errors.New("READY_FAIL_STALE requires INDEX_STALE_AFTER")
+		return err
+	}
+
+	return err
+}
+
+// loadProxyConfig loads the proxies Elasticsearch and git traffic go through
+// in place of those HTTPS_PROXY, HTTP_PROXY, and NO_PROXY choose. Each is a
+// proxy URL, none to connect directly, or empty to follow the environment.
+func (l envLoader) loadProxyConfig(cfg *Config) (err error) {
+	proxies := []struct {
+		key   string
+		value *string
+	}{
+		{key: "ES_PROXY", value: &cfg.ESProxy},
+		{key: "GIT_PROXY", value: &cfg.GitProxy},
+	}
+
+	for _, proxy := range proxies {
+		*proxy.value = l.getEnv(proxy.key, "")
+		if *proxy.value == "" || *proxy.value == ProxyNone {
+			continue
+		}
+
+		err = validateProxyURL(*proxy.value)
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %w", proxy.key, err)
+			return err
+		}
+	}
+
+	return err
+}
+
+// validateProxyURL checks that value is an http, https, or socks5 URL with a
+// host.
+func validateProxyURL(value string) (err error) {
+	var proxyURL *url.URL
+	proxyURL, err = url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		err = fmt.Errorf("scheme %q is not http, https, or socks5", proxyURL.Scheme)
+		return err
+	}
+	if proxyURL.Host == "" {
+		err = errors.New("missing host")
+	}
+	return err
+}
+
+// loadHTTPConfig loads the API server's timeouts: how long a client may take
+// to send a request, how long a response may take to write, and how long an
+// idle keep-alive connection stays open. Zero disables a timeout. It also
+// loads whether responses are gzipped for clients that accept it.
+func (l envLoader) loadHTTPConfig(cfg *Config) (err error) {
+	timeouts := []struct {
+		key   string
+		def   string
+		value *time.Duration
+	}{
+		{key: "HTTP_READ_TIMEOUT", def: "30s", value: &cfg.HTTPReadTimeout},
+		{key: "HTTP_WRITE_TIMEOUT", def: "60s", value: &cfg.HTTPWriteTimeout},
+		{key: "HTTP_IDLE_TIMEOUT", def: "120s", value: &cfg.HTTPIdleTimeout},
+	}
+
+	for _, timeout := range timeouts {
+		*timeout.value, err = time.ParseDuration(l.getEnv(timeout.key, timeout.def))
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %w", timeout.key, err)
+			return err
+		}
+		if *timeout.value < 0 {
+			err = fmt.Errorf("invalid %s %v: must not be negative", timeout.key, *timeout.value)
+			return err
+		}
+	}
+
+	cfg.HTTPCompression, err = strconv.ParseBool(l.getEnv("HTTP_COMPRESSION", "true"))
+	if err != nil {
+		err = fmt.Errorf("invalid HTTP_COMPRESSION: %w", err)
+		return err
+	}
+
+	return err
+}
+
+// loadTLSConfig loads the certificate and key the API server terminates TLS
+// with, and the CAs client certificates must be signed by for mutual TLS.
+// The certificate and key are set together; client CAs need both.
+func (l envLoader) loadTLSConfig(cfg *Config) (err error) {
+	cfg.TLSCertFile = l.getEnv("TLS_CERT_FILE", "")
+	cfg.TLSKeyFile = l.getEnv("TLS_KEY_FILE", "")
+	cfg.TLSClientCAFile = l.getEnv("TLS_CLIENT_CA_FILE", "")
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		err = errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		return err
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		err = errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		return err
+	}
+
+	return err
+}
+
+// loadLimitConfig loads the per-client rate limit on search and reindex
+// requests, a token bucket refilled at RATE_LIMIT_RPS and holding
+// RATE_LIMIT_BURST requests, and the largest request body they accept. A
+// rate of zero disables rate limiting.
+func (l envLoader) loadLimitConfig(cfg *Config) (err error) {
+	cfg.RateLimitRPS, err = strconv.ParseFloat(l.getEnv("RATE_LIMIT_RPS", "0"), 64)
+	if err != nil {
+		err = fmt.Errorf("invalid RATE_LIMIT_RPS: %w", err)
+		return err
+	}
+	if cfg.RateLimitRPS < 0 {
+		err = fmt.Errorf("invalid RATE_LIMIT_RPS %v: must not be negative", cfg.RateLimitRPS)
+		return err
+	}
+
+	cfg.RateLimitBurst, err = strconv.Atoi(l.getEnv("RATE_LIMIT_BURST", "20"))
+	if err != nil {
+		err = fmt.Errorf("invalid RATE_LIMIT_BURST: %w", err)
+		return err
+	}
+	if cfg.RateLimitBurst <= 0 {
+		err = fmt.Errorf("invalid RATE_LIMIT_BURST %d: must be positive", cfg.RateLimitBurst)
+		return err
+	}
+
+	cfg.MaxRequestBodyKB, err = strconv.Atoi(l.getEnv("MAX_REQUEST_BODY_KB", "1024"))
+	if err != nil {
+		err = fmt.Errorf("invalid MAX_REQUEST_BODY_KB: %w", err)
+		return err
+	}
+	if cfg.MaxRequestBodyKB <= 0 {
+		err = fmt.Errorf("invalid MAX_REQUEST_BODY_KB %d: must be positive", cfg.MaxRequestBodyKB)
+		return err
+	}
+
+	return err
+}
+
+// loadSLOConfig loads the API latency SLO: the latency under which a request
+// counts as good and the fraction of requests that should be good.
+func (l envLoader) loadSLOConfig(cfg *Config) (err error) {
+	cfg.SLOLatencyThreshold, err = time.ParseDuration(l.getEnv("SLO_LATENCY_THRESHOLD", "500ms"))
+	if err != nil {
+		err = fmt.Errorf("invalid SLO_LATENCY_THRESHOLD: %w", err)
+		return err
+	}
+	if cfg.SLOLatencyThreshold <= 0 {
+		err = fmt.Errorf("invalid SLO_LATENCY_THRESHOLD %v: must be positive", cfg.SLOLatencyThreshold)
+		return err
+	}
+
+	cfg.SLOObjective, err = strconv.ParseFloat(l.getEnv("SLO_OBJECTIVE", "0.99"), 64)
+	if err != nil {
+		err = fmt.Errorf("invalid SLO_OBJECTIVE: %w", err)
+		return err
+	}
+	if cfg.SLOObjective <= 0 || cfg.SLOObjective >= 1 {
+		err = fmt.Errorf("invalid SLO_OBJECTIVE %v: must be between 0 and 1", cfg.SLOObjective)
+		return err
+	}
+
+	return err
+}
+
+// loadTemplateConfig loads the index template the indexer manages. The
+// template is named after ES_INDEX and covers it and its "-*" generations
+// unless overridden; "none" disables template management.
+func (l envLoader) loadTemplateConfig(cfg *Config) (err error) {
+	cfg.ESIndexTemplate = l.getEnv("ES_INDEX_TEMPLATE", cfg.ESIndex)
+	patterns := l.getEnv("ES_INDEX_PATTERNS", cfg.ESIndex+","+cfg.ESIndex+"-*")
+	if cfg.ESIndexTemplate == "none" {
+		cfg.ESIndexTemplate = ""
+		return err
+	}
+	if cfg.ESIndexTemplate == "" || strings.ContainsAny(cfg.ESIndexTemplate, ` ,*?"<>|/\#`) {
+		err = fmt.Errorf("invalid ES_INDEX_TEMPLATE %q", cfg.ESIndexTemplate)
+		return err
+	}
+
+	cfg.ESIndexPatterns = splitList(patterns)
+	if len(cfg.ESIndexPatterns) == 0 {
+		err = errors.New("invalid ES_INDEX_PATTERNS: at least one pattern is required")
+		return err
+	}
+
+	return err
+}
+
+// loadGenerationConfig loads how rebuilds name the index generations they
+// create behind the ES_INDEX alias, as a Go time layout appended to ES_INDEX,
+// how many generations are kept for rolling back, and whether an index with
+// an outdated schema is rebuilt.
+func (l envLoader) loadGenerationConfig(cfg *Config) (err error) {
+	cfg.ESGenerationFormat = l.getEnv("ES_GENERATION_FORMAT", "2006-01-02-150405")
+	err = validateGenerationFormat(cfg.ESGenerationFormat)
+	if err != nil {
+		return err
+	}
+
+	cfg.ESGenerationsKept, err = strconv.Atoi(l.getEnv("ES_GENERATIONS_KEPT", "2"))
+	if err != nil {
+		err = fmt.Errorf("invalid ES_GENERATIONS_KEPT: %w", err)
+		return err
+	}
+	if cfg.ESGenerationsKept < 1 {
+		err = fmt.Errorf("invalid ES_GENERATIONS_KEPT %d: must be at least 1", cfg.ESGenerationsKept)
+		return err
+	}
+
+	cfg.SchemaMigration = l.getEnv("SCHEMA_MIGRATION", SchemaMigrationAdditive)
+	switch cfg.SchemaMigration {
+	case SchemaMigrationAdditive, SchemaMigrationRebuild, SchemaMigrationNone:
+	default:
+		err = fmt.Errorf("invalid SCHEMA_MIGRATION %q: must be additive, rebuild, or none", cfg.SchemaMigration)
+		return err
+	}
+
+	return err
+}
+
+// validateGenerationFormat checks that a generation time layout varies with
+// the time, reads back as a time, and formats to characters valid in an
+// index name.
+func validateGenerationFormat(format string) (err error) {
+	first := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	formatted := first.Format(format)
+	_, parseErr := time.Parse(format, formatted)
+
+	switch {
+	case formatted == first.AddDate(1, 1, 1).Add(time.Hour+time.Minute+time.Second).Format(format):
+		err = fmt.Errorf("invalid ES_GENERATION_FORMAT %q: must contain a time layout such as 2006-01-02", format)
+	case parseErr != nil:
+		err = fmt.Errorf("invalid ES_GENERATION_FORMAT %q: %w", format, parseErr)
+	case formatted != strings.ToLower(formatted) || strings.ContainsAny(formatted, ` ,:*?"<>|/\#`):
+		err = fmt.Errorf("invalid ES_GENERATION_FORMAT %q: %q is not valid in an index name", format, formatted)
+	}
+	return err
+}
+
+// loadContentConfig loads which files are indexed and how repeated code is
+// stored.
+func (l envLoader) loadContentConfig(cfg *Config) (err error) {
+	cfg.DedupIdentical, err = strconv.ParseBool(l.getEnv("DEDUP_IDENTICAL", "true"))
+	if err != nil {
+		err = fmt.Errorf("invalid DEDUP_IDENTICAL: %w", err)
+		return err
+	}
+
+	cfg.IndexMarkdown, err = strconv.ParseBool(l.getEnv("INDEX_MARKDOWN", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid INDEX_MARKDOWN: %w", err)
+		return err
+	}
+
+	cfg.IndexOverviews, err = strconv.ParseBool(l.getEnv("INDEX_OVERVIEWS", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid INDEX_OVERVIEWS: %w", err)
+		return err
+	}
+
+	cfg.IndexTypes, err = strconv.ParseBool(l.getEnv("INDEX_TYPES", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid INDEX_TYPES: %w", err)
+		return err
+	}
+
+	cfg.IndexPlatforms, err = loadPlatforms(l.getEnv("INDEX_PLATFORMS", ""))
+	if err != nil {
+		return err
+	}
+
+	cfg.Languages, err = loadLanguages(l.getEnv("LANGUAGES", "go"))
+	if err != nil {
+		return err
+	}
+
+	cfg.IncludePatterns, err = loadPatterns("INCLUDE_PATTERNS", l.getEnv("INCLUDE_PATTERNS", ""))
+	if err != nil {
+		return err
+	}
+
+	cfg.ExcludePatterns, err = loadPatterns("EXCLUDE_PATTERNS", l.getEnv("EXCLUDE_PATTERNS", defaultExcludePatterns))
+	if err != nil {
+		return err
+	}
+
+	cfg.SkipDirs, err = loadPatterns("SKIP_DIRS", l.getEnv("SKIP_DIRS", ""))
+	if err != nil {
+		return err
+	}
+
+	cfg.IgnoreFiles = splitList(l.getEnv("IGNORE_FILES", ".gitignore,.ragignore"))
+	if slices.Equal(cfg.IgnoreFiles, []string{"none"}) {
+		cfg.IgnoreFiles = nil
+	}
+	for _, name := range cfg.IgnoreFiles {
+		if strings.ContainsAny(name, `/\`) {
+			err = fmt.Errorf("invalid IGNORE_FILES entry %q: must be a file name", name)
+			return err
+		}
+	}
+
+	return err
+}
+
+// loadPatterns validates a list of file globs. "none" clears the list.
+func loadPatterns(key string, value string) (patterns []string, err error) {
+	if value == "none" {
+		return patterns, err
+	}
+
+	for _, pattern := range splitList(value) {
+		_, err = path.Match(pattern, "")
+		if err != nil {
+			err = fmt.Errorf("invalid %s entry %q: %w", key, pattern, err)
+			return patterns, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, err
+}
+
+// loadEnrichConfig loads the document enrichment hook: a command, split on
+// whitespace, and how long it may take to answer for one document.
+func (l envLoader) loadEnrichConfig(cfg *Config) (err error) {
+	cfg.EnrichCommand = strings.Fields(l.getEnv("ENRICH_COMMAND", ""))
+
+	cfg.EnrichTimeout, err = time.ParseDuration(l.getEnv("ENRICH_TIMEOUT", "5s"))
+	if err != nil {
+		err = fmt.Errorf("invalid ENRICH_TIMEOUT: %w", err)
+		return err
+	}
+	if cfg.EnrichTimeout <= 0 {
+		err = fmt.Errorf("invalid ENRICH_TIMEOUT %v: must be positive", cfg.EnrichTimeout)
+		return err
+	}
+
+	return err
+}
+
+// loadChunkConfig loads how large functions are split into chunks. A
+// CHUNK_MAX_LINES of zero disables chunking.
+func (l envLoader) loadChunkConfig(cfg *Config) (err error) {
+	cfg.ChunkMaxLines, err = strconv.Atoi(l.getEnv("CHUNK_MAX_LINES", "0"))
+	if err != nil {
+		err = fmt.Errorf("invalid CHUNK_MAX_LINES: %w", err)
+		return err
+	}
+	if cfg.ChunkMaxLines < 0 {
+		err = fmt.Errorf("invalid CHUNK_MAX_LINES %d: must not be negative", cfg.ChunkMaxLines)
+		return err
+	}
+
+	cfg.ChunkOverlapLines, err = strconv.Atoi(l.getEnv("CHUNK_OVERLAP_LINES", "10"))
+	if err != nil {
+		err = fmt.Errorf("invalid CHUNK_OVERLAP_LINES: %w", err)
+		return err
+	}
+	if cfg.ChunkOverlapLines < 0 || (cfg.ChunkMaxLines > 0 && cfg.ChunkOverlapLines >= cfg.ChunkMaxLines) {
+		err = fmt.Errorf("invalid CHUNK_OVERLAP_LINES %d: must be at least 0 and less than CHUNK_MAX_LINES", cfg.ChunkOverlapLines)
+		return err
+	}
+
+	return err
+}
+
+// loadMemoryConfig loads how much memory indexing holds at once: the budget
+// for files being parsed and the size of each bulk request. Zero lifts the
+// budget or sends each document on its own.
+func (l envLoader) loadMemoryConfig(cfg *Config) (err error) {
+	cfg.IndexMemoryMB, err = strconv.Atoi(l.getEnv("INDEX_MEMORY_MB", "512"))
+	if err != nil {
+		err = fmt.Errorf("invalid INDEX_MEMORY_MB: %w", err)
+		return err
+	}
+	if cfg.IndexMemoryMB < 0 {
+		err = fmt.Errorf("invalid INDEX_MEMORY_MB %d: must not be negative", cfg.IndexMemoryMB)
+		return err
+	}
+
+	cfg.IndexBulkKB, err = strconv.Atoi(l.getEnv("INDEX_BULK_KB", "5120"))
+	if err != nil {
+		err = fmt.Errorf("invalid INDEX_BULK_KB: %w", err)
+		return err
+	}
+	if cfg.IndexBulkKB < 0 {
+		err = fmt.Errorf("invalid INDEX_BULK_KB %d: must not be negative", cfg.IndexBulkKB)
+		return err
+	}
+
+	return err
+}
+
+// loadWebhookConfig loads the run notification settings.
+func (l envLoader) loadWebhookConfig(cfg *Config) (err error) {
+	cfg.WebhookURLs = splitList(l.getEnv("WEBHOOK_URLS", ""))
+	cfg.WebhookFormat = l.getEnv("WEBHOOK_FORMAT", "json")
+	if cfg.WebhookFormat != "json" && cfg.WebhookFormat != "slack" {
+		err = fmt.Errorf("invalid WEBHOOK_FORMAT %q: must be json or slack", cfg.WebhookFormat)
+		return err
+	}
+
+	cfg.WebhookFailuresOnly, err = strconv.ParseBool(l.getEnv("WEBHOOK_FAILURES_ONLY", "false"))
+	if err != nil {
+		err = fmt.Errorf("invalid WEBHOOK_FAILURES_ONLY: %w", err)
+		return err
+	}
+
+	return err
+}
+
+// Embedding providers: any OpenAI-compatible /v1/embeddings endpoint, or
+// Ollama's native /api/embed.
+const (
+	EmbeddingProviderOpenAI = "openai"
+	EmbeddingProviderOllama = "ollama"
+)
+
+// defaultOllamaURL is where Ollama listens when it runs beside the indexer.
+const defaultOllamaURL = "http://localhost:11434"
+
+// loadEmbeddingConfig loads the embeddings API settings. With
+// EMBEDDING_PROVIDER ollama, EMBEDDING_URL is Ollama's base URL and defaults
+// to a local instance.
+func (l envLoader) loadEmbeddingConfig(cfg *Config) (err error) {
+	cfg.EmbeddingProvider = l.getEnv("EMBEDDING_PROVIDER", EmbeddingProviderOpenAI)
+	switch cfg.EmbeddingProvider {
+	case EmbeddingProviderOpenAI:
+		cfg.EmbeddingURL = l.getEnv("EMBEDDING_URL", "")
+	case EmbeddingProviderOllama:
+		cfg.EmbeddingURL = l.getEnv("EMBEDDING_URL", defaultOllamaURL)
+	default:
+		err = fmt.Errorf("invalid EMBEDDING_PROVIDER %q: use %s or %s", cfg.EmbeddingProvider, EmbeddingProviderOpenAI, EmbeddingProviderOllama)
+		return err
+	}
+	cfg.EmbeddingModel = l.getEnv("EMBEDDING_MODEL", "")
+	cfg.EmbeddingAPIKey = l.getEnv("EMBEDDING_API_KEY", "")
+
+	cfg.EmbeddingBatchSize, err = strconv.Atoi(l.getEnv("EMBEDDING_BATCH_SIZE", "32"))
+	if err != nil {
+		err = fmt.Errorf("invalid EMBEDDING_BATCH_SIZE: %w", err)
+		return err
+	}
+	if cfg.EmbeddingBatchSize <= 0 {
+		err = fmt.Errorf("invalid EMBEDDING_BATCH_SIZE %d: must be positive", cfg.EmbeddingBatchSize)
+		return err
+	}
+
+	cfg.EmbeddingConcurrency, err = strconv.Atoi(l.getEnv("EMBEDDING_CONCURRENCY", "1"))
+	if err != nil {
+		err = fmt.Errorf("invalid EMBEDDING_CONCURRENCY: %w", err)
+		return err
+	}
+	if cfg.EmbeddingConcurrency <= 0 {
+		err = fmt.Errorf("invalid EMBEDDING_CONCURRENCY %d: must be positive", cfg.EmbeddingConcurrency)
+		return err
+	}
+
+	cfg.EmbeddingCacheSize, err = strconv.Atoi(l.getEnv("EMBEDDING_CACHE_SIZE", "10000"))
+	if err != nil {
+		err = fmt.Errorf("invalid EMBEDDING_CACHE_SIZE: %w", err)
+		return err
+	}
+	if cfg.EmbeddingCacheSize < 0 {
+		err = fmt.Errorf("invalid EMBEDDING_CACHE_SIZE %d: must not be negative", cfg.EmbeddingCacheSize)
+		return err
+	}
+	cfg.EmbeddingCacheIndex = l.getEnv("EMBEDDING_CACHE_INDEX", "")
+
+	return err
+}
+
+// Reranker APIs: Cohere's /v1/rerank, also served by Jina; Voyage AI's; and
+// Hugging Face Text Embeddings Inference, for local cross-encoders.
+const (
+	RerankAPICohere = "cohere"
+	RerankAPIVoyage = "voyage"
+	RerankAPITEI    = "tei"
+)
+
+// maxRerankTopK bounds how many results are sent to the reranker at once.
+const maxRerankTopK = 1000
+
+// loadRerankConfig loads the reranker settings. Reranking is available when
+// RERANK_URL is set; the hosted APIs also need a model.
+func (l envLoader) loadRerankConfig(cfg *Config) (err error) {
+	cfg.RerankURL = l.getEnv("RERANK_URL", "")
+	cfg.RerankModel = l.getEnv("RERANK_MODEL", "")
+	cfg.RerankAPIKey = l.getEnv("RERANK_API_KEY", "")
+
+	cfg.RerankAPI = l.getEnv("RERANK_API", RerankAPICohere)
+	switch cfg.RerankAPI {
+	case RerankAPICohere, RerankAPIVoyage, RerankAPITEI:
+	default:
+		err = fmt.Errorf("invalid RERANK_API %q: use %s, %s, or %s", cfg.RerankAPI, RerankAPICohere, RerankAPIVoyage, RerankAPITEI)
+		return err
+	}
+
+	if cfg.RerankURL != "" && cfg.RerankModel == "" && cfg.RerankAPI != RerankAPITEI {
+		err = fmt.Errorf("RERANK_MODEL is required with RERANK_API=%s", cfg.RerankAPI)
+		return err
+	}
+
+	cfg.RerankTopK, err = strconv.Atoi(l.getEnv("RERANK_TOP_K", "50"))
+	if err != nil {
+		err = fmt.Errorf("invalid RERANK_TOP_K: %w", err)
+		return err
+	}
+	if cfg.RerankTopK <= 0 || cfg.RerankTopK > maxRerankTopK {
+		err = fmt.Errorf("invalid RERANK_TOP_K %d: must be between 1 and %d", cfg.RerankTopK, maxRerankTopK)
+		return err
+	}
+
+	cfg.RerankTimeout, err = time.ParseDuration(l.getEnv("RERANK_TIMEOUT", "5s"))
+	if err != nil {
+		err = fmt.Errorf("invalid RERANK_TIMEOUT: %w", err)
+		return err
+	}
+	if cfg.RerankTimeout <= 0 {
+		err = fmt.Errorf("invalid RERANK_TIMEOUT %s: must be positive", cfg.RerankTimeout)
+		return err
+	}
+
+	return err
+}
+
+// maxRewriteQueries bounds how many rewritten queries a search runs besides
+// the original.
+const maxRewriteQueries = 10
+
+// loadRewriteConfig loads the query rewriting settings. Rewriting is
+// available when REWRITE_URL names an OpenAI-compatible chat completions
+// endpoint, which needs a model.
+func (l envLoader) loadRewriteConfig(cfg *Config) (err error) {
+	cfg.RewriteURL = l.getEnv("REWRITE_URL", "")
+	cfg.RewriteModel = l.getEnv("REWRITE_MODEL", "")
+	cfg.RewriteAPIKey = l.getEnv("REWRITE_API_KEY", "")
+
+	if cfg.RewriteURL != "" && cfg.RewriteModel == "" {
+		err = errors.New("REWRITE_MODEL is required with REWRITE_URL")
+		return err
+	}
+
+	cfg.RewriteTimeout, err = time.ParseDuration(l.getEnv("REWRITE_TIMEOUT", "3s"))
+	if err != nil {
+		err = fmt.Errorf("invalid REWRITE_TIMEOUT: %w", err)
+		return err
+	}
+	if cfg.RewriteTimeout <= 0 {
+		err = fmt.Errorf("invalid REWRITE_TIMEOUT %s: must be positive", cfg.RewriteTimeout)
+		return err
+	}
+
+	cfg.RewriteMaxQueries, err = strconv.Atoi(l.getEnv("REWRITE_MAX_QUERIES", "3"))
+	if err != nil {
+		err = fmt.Errorf("invalid REWRITE_MAX_QUERIES: %w", err)
+		return err
+	}
+	if cfg.RewriteMaxQueries < 1 || cfg.RewriteMaxQueries > maxRewriteQueries {
+		err = fmt.Errorf("invalid REWRITE_MAX_QUERIES %d: must be between 1 and %d", cfg.RewriteMaxQueries, maxRewriteQueries)
+		return err
+	}
+
+	return err
+}
+
+// loadSummaryConfig loads the settings of summaries generated at index time.
+// Summaries are generated when SUMMARY_URL names an OpenAI-compatible chat
+// completions endpoint, which needs a model; SUMMARY_RPS caps the requests
+// sent to it a second.
+func (l envLoader) loadSummaryConfig(cfg *Config) (err error) {
+	cfg.SummaryURL = l.getEnv("SUMMARY_URL", "")
+	cfg.SummaryModel = l.getEnv("SUMMARY_MODEL", "")
+	cfg.SummaryAPIKey = l.getEnv("SUMMARY_API_KEY", "")
+
+	if cfg.SummaryURL != "" && cfg.SummaryModel == "" {
+		err = errors.New("SUMMARY_MODEL is required with SUMMARY_URL")
+		return err
+	}
+
+	cfg.SummaryTimeout, err = time.ParseDuration(l.getEnv("SUMMARY_TIMEOUT", "30s"))
+	if err != nil {
+		err = fmt.Errorf("invalid SUMMARY_TIMEOUT: %w", err)
+		return err
+	}
+	if cfg.SummaryTimeout <= 0 {
+		err = fmt.Errorf("invalid SUMMARY_TIMEOUT %s: must be positive", cfg.SummaryTimeout)
+		return err
+	}
+
+	cfg.SummaryRPS, err = strconv.ParseFloat(l.getEnv("SUMMARY_RPS", "2"), 64)
+	if err != nil {
+		err = fmt.Errorf("invalid SUMMARY_RPS: %w", err)
+		return err
+	}
+	if !(cfg.SummaryRPS > 0) || math.IsInf(cfg.SummaryRPS, 1) {
+		err = fmt.Errorf("invalid SUMMARY_RPS %v: must be a positive number", cfg.SummaryRPS)
+		return err
+	}
+
+	return err
+}
+
+// loadSearchConfig loads the relevance settings searches start from, and the
+// bounds API searches are validated against. Boosts are comma-separated
+// field^weight entries, a bare field weighing 1; the search client checks the
+// names and the ranking mode.
+func (l envLoader) loadSearchConfig(cfg *Config) (err error) {
+	bounds := []struct {
+		key   string
+		def   string
+		value *int
+	}{
+		{key: "SEARCH_MAX_QUERY_LENGTH", def: "1000", value: &cfg.SearchMaxQueryLength},
+		{key: "SEARCH_MAX_LIMIT", def: "100", value: &cfg.SearchMaxLimit},
+		{key: "SEARCH_MAX_FILTER_VALUES", def: "50", value: &cfg.SearchMaxFilterValues},
+		{key: "SEARCH_MAX_QUERIES", def: "20", value: &cfg.SearchMaxQueries},
+	}
+	for _, bound := range bounds {
+		*bound.value, err = strconv.Atoi(l.getEnv(bound.key, bound.def))
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %w", bound.key, err)
+			return err
+		}
+		if *bound.value <= 0 {
+			err = fmt.Errorf("invalid %s %d: must be positive", bound.key, *bound.value)
+			return err
+		}
+	}
+
+	cfg.SearchRanking = l.getEnv("SEARCH_RANKING", "boost")
+
+	cfg.SearchFieldBoosts, err = loadBoosts("SEARCH_FIELD_BOOSTS", l.getEnv("SEARCH_FIELD_BOOSTS", "function_name^3,summary^4,code^2,code_full^2,package"))
+	if err != nil {
+		return err
+	}
+
+	cfg.SearchFlagBoosts, err = loadBoosts("SEARCH_FLAG_BOOSTS", l.getEnv("SEARCH_FLAG_BOOSTS", "has_namedreturns^2,has_error_handling^1.5,uses_panic^0.5,uses_unsafe^0.5"))
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+// loadBoosts parses a list of field^weight entries. Weights must be positive.
+func loadBoosts(key string, value string) (boosts map[string]float64, err error) {
+	for _, entry := range splitList(value) {
+		name, weightStr, weighted := strings.Cut(entry, "^")
+		weight := 1.0
+		if weighted {
+			weight, err = strconv.ParseFloat(weightStr, 64)
+			if err != nil || !(weight > 0) || math.IsInf(weight, 1) {
+				err = fmt.Errorf("invalid %s entry %q: weight must be a positive number", key, entry)
+				return boosts, err
+			}
+		}
+		if name == "" {
+			err = fmt.Errorf("invalid %s entry %q: missing field name", key, entry)
+			return boosts, err
+		}
+
+		if boosts == nil {
+			boosts = make(map[string]float64)
+		}
+		boosts[name] = weight
+	}
+
+	return boosts, err
+}
+
+// loadExportConfig loads object storage export settings. Exports are disabled
+// when EXPORT_INTERVAL is zero; otherwise a bucket is required. Credentials fall
+// back to the standard AWS variables.
+func (l envLoader) loadExportConfig(cfg *Config) (err error) {
+	cfg.ExportBucket = l.getEnv("EXPORT_BUCKET", "")
+	cfg.ExportPrefix = l.getEnv("EXPORT_PREFIX", "rag-indexer/")
+	cfg.ExportRegion = l.getEnv("EXPORT_REGION", "us-east-1")
+	cfg.ExportEndpoint = l.getEnv("EXPORT_ENDPOINT", "https://s3."+cfg.ExportRegion+".amazonaws.com")
+	cfg.ExportAccessKey = l.getEnv("EXPORT_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID"))
+	cfg.ExportSecretKey = l.getEnv("EXPORT_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	cfg.ExportSessionToken = l.getEnv("EXPORT_SESSION_TOKEN", os.Getenv("AWS_SESSION_TOKEN"))
+
+	cfg.ExportInterval, err = time.ParseDuration(l.getEnv("EXPORT_INTERVAL", "0s"))
+	if err != nil {
+		err = fmt.Errorf("invalid EXPORT_INTERVAL: %w", err)
+		return err
+	}
+
+	cfg.ExportRetention, err = strconv.Atoi(l.getEnv("EXPORT_RETENTION", "7"))
+	if err != nil {
+		err = fmt.Errorf("invalid EXPORT_RETENTION: %w", err)
+		return err
+	}
+
+	if cfg.ExportInterval > 0 && cfg.ExportBucket == "" {
+		err = ErrExportBucketRequired
+		return err
+	}
+
+	return err
+}
+
+// loadSnapshotConfig loads Elasticsearch snapshot settings. Snapshots are
+// disabled unless SNAPSHOT_REPOSITORY names a snapshot repository. With
+// SNAPSHOT_REPOSITORY_TYPE set, the indexer registers the repository itself
+// with SNAPSHOT_REPOSITORY_SETTINGS; otherwise it must already be registered.
+func (l envLoader) loadSnapshotConfig(cfg *Config) (err error) {
+	cfg.SnapshotRepository = l.getEnv("SNAPSHOT_REPOSITORY", "")
+	cfg.SnapshotRepositoryType = l.getEnv("SNAPSHOT_REPOSITORY_TYPE", "")
+
+	cfg.SnapshotSettings, err = loadSnapshotSettings(l.getEnv("SNAPSHOT_REPOSITORY_SETTINGS", ""))
+	if err != nil {
+		return err
+	}
+
+	cfg.SnapshotBeforeRebuild, err = strconv.ParseBool(l.getEnv("SNAPSHOT_BEFORE_REBUILD", "true"))
+	if err != nil {
+		err = fmt.Errorf("invalid SNAPSHOT_BEFORE_REBUILD: %w", err)
+		return err
+	}
+
+	cfg.SnapshotInterval, err = time.ParseDuration(l.getEnv("SNAPSHOT_INTERVAL", "0s"))
+	if err != nil {
+		err = fmt.Errorf("invalid SNAPSHOT_INTERVAL: %w", err)
+		return err
+	}
+
+	cfg.SnapshotsKept, err = strconv.Atoi(l.getEnv("SNAPSHOTS_KEPT", "7"))
+	if err != nil {
+		err = fmt.Errorf("invalid SNAPSHOTS_KEPT: %w", err)
+		return err
+	}
+	if cfg.SnapshotsKept < 0 {
+		err = fmt.Errorf("invalid SNAPSHOTS_KEPT %d: must not be negative", cfg.SnapshotsKept)
+		return err
+	}
+
+	configured := cfg.SnapshotRepositoryType != "" || len(cfg.SnapshotSettings) > 0 || cfg.SnapshotInterval > 0
+	if configured && cfg.SnapshotRepository == "" {
+		err = ErrSnapshotRepositoryRequired
+		return err
+	}
+	if len(cfg.SnapshotSettings) > 0 && cfg.SnapshotRepositoryType == "" {
+		err = errors.New("SNAPSHOT_REPOSITORY_SETTINGS requires SNAPSHOT_REPOSITORY_TYPE")
+		return err
+	}
+
+	return err
+}
+
+// loadDocumentRetentionConfig loads document retention settings. With
+// RETENTION_DAYS set, documents whose indexed_at is older are deleted every
+// RETENTION_INTERVAL. Each run rewrites the documents of the files it indexes,
+// so only those of deleted files and of repositories no longer indexed age
+// out; the retention must outlast INDEX_INTERVAL so live documents don't.
+func (l envLoader) loadDocumentRetentionConfig(cfg *Config) (err error) {
+	cfg.RetentionDays, err = strconv.Atoi(l.getEnv("RETENTION_DAYS", "0"))
+	if err != nil {
+		err = fmt.Errorf("invalid RETENTION_DAYS: %w", err)
+		return err
+	}
+	if cfg.RetentionDays < 0 {
+		err = fmt.Errorf("invalid RETENTION_DAYS %d: must not be negative", cfg.RetentionDays)
+		return err
+	}
+
+	cfg.RetentionInterval, err = time.ParseDuration(l.getEnv("RETENTION_INTERVAL", "24h"))
+	if err != nil {
+		err = fmt.Errorf("invalid RETENTION_INTERVAL: %w", err)
+		return err
+	}
+	if cfg.RetentionInterval <= 0 {
+		err = fmt.Errorf("invalid RETENTION_INTERVAL %s: must be positive", cfg.RetentionInterval)
+		return err
+	}
+
+	if cfg.RetentionDays > 0 && cfg.Retention() <= cfg.IndexInterval {
+		err = fmt.Errorf("invalid RETENTION_DAYS %d: must outlast INDEX_INTERVAL %s, or every document would be deleted between runs", cfg.RetentionDays, cfg.IndexInterval)
+		return err
+	}
+
+	return err
+}
+
+// Retention returns how long documents are kept after they were last
+// indexed, or zero when they are kept indefinitely.
+func (c Config) Retention() (retention time.Duration) {
+	retention = time.Duration(c.RetentionDays) * 24 * time.Hour
+	return retention
+}
+
+// loadSnapshotSettings parses a list of key=value snapshot repository
+// settings, such as location=/mnt/backups or bucket=backups,base_path=code.
+func loadSnapshotSettings(value string) (settings map[string]string, err error) {
+	for _, entry := range splitList(value) {
+		key, setting, found := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			err = fmt.Errorf("invalid SNAPSHOT_REPOSITORY_SETTINGS entry %q: want key=value", entry)
+			return settings, err
+		}
+
+		if settings == nil {
+			settings = make(map[string]string)
+		}
+		settings[key] = strings.TrimSpace(setting)
+	}
+
+	return settings, err
+}
+
+// loadAPIKeys combines comma-separated keys with keys read one per line from a file.
+// Blank lines and lines starting with # in the file are ignored.
+func loadAPIKeys(keysStr string, keysFile string) (keys []string, err error) {
+	keys = splitList(keysStr)
+
+	if keysFile == "" {
+		return keys, err
+	}
+
+	var data []byte
+	data, err = os.ReadFile(keysFile)
+	if err != nil {
+		err = fmt.Errorf("failed to read API_KEYS_FILE: %w", err)
+		return keys, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+
+	return keys, err
+}
+
+// loadLintChecks parses the comma-separated lint checks, rejecting unknown
+// names. "none" disables linting.
+func loadLintChecks(value string) (checks []string, err error) {
+	if value == "none" {
+		return checks, err
+	}
+
+	for _, check := range splitList(value) {
+		switch check {
+		case "gofmt", "namedreturns", "noinlineerr", "godot", "funlen", "govet":
+			checks = append(checks, check)
+		default:
+			err = fmt.Errorf("invalid LINT_CHECKS entry %q", check)
+			return checks, err
+		}
+	}
+
+	return checks, err
+}
+
+// loadLanguages validates LANGUAGES, the source languages to index.
+func loadLanguages(value string) (languages []string, err error) {
+	for _, language := range splitList(value) {
+		switch language {
+		case "go", "python", "typescript", "terraform", "protobuf":
+			languages = append(languages, language)
+		default:
+			err = fmt.Errorf("invalid LANGUAGES entry %q", language)
+			return languages, err
+		}
+	}
+
+	if len(languages) == 0 {
+		err = errors.New("LANGUAGES must name at least one language")
+	}
+	return languages, err
+}
+
+// loadPlatforms parses INDEX_PLATFORMS, a comma-separated list of GOOS/GOARCH
+// pairs such as linux/amd64, dropping repeats.
+func loadPlatforms(value string) (platforms []string, err error) {
+	for _, platform := range splitList(value) {
+		goos, goarch, found := strings.Cut(platform, "/")
+		if !found || !validPlatformPart(goos) || !validPlatformPart(goarch) {
+			err = fmt.Errorf("invalid INDEX_PLATFORMS entry %q: want GOOS/GOARCH, such as linux/amd64", platform)
+			return platforms, err
+		}
+		if !slices.Contains(platforms, platform) {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms, err
+}
+
+// validPlatformPart reports whether s can be a GOOS or GOARCH: lower-case
+// letters and digits.
+func validPlatformPart(s string) (valid bool) {
+	valid = s != "" && !strings.ContainsFunc(s, func(r rune) (invalid bool) {
+		invalid = (r < 'a' || r > 'z') && (r < '0' || r > '9')
+		return invalid
+	})
+	return valid
+}
+
+// splitList splits a comma-separated value, trimming spaces and dropping empty items.
+func splitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envLoader reads variables, preferring the environment-prefixed form, then
+// falling back to values from a config file, keyed by lower-case name. It
+// records the keys read in seen, when set.
+type envLoader struct {
+	prefix string
+	file   map[string]string
+	seen   map[string]bool
+	// tenantPrefix and tenant are set while loading a tenant. Its prefixed
+	// variables, then its values keyed by variable name, come first.
+	tenantPrefix string
+	tenant       map[string]string
+	// tenants holds the values of the tenants listed in a config file.
+	tenants []tenantValues
+}
+
+// getEnv returns the tenant's variable or value if set, else the prefixed
+// variable if set, else the shared one, else the config file's value, else
+// the default.
+func (l envLoader) getEnv(key string, defaultVal string) (value string) {
+	if l.seen != nil {
+		l.seen[key] = true
+	}
+
+	if l.tenantPrefix != "" {
+		value = os.Getenv(l.tenantPrefix + key)
+		if value == "" {
+			value = l.tenant[key]
+		}
+		if value != "" {
+			return value
+		}
+	}
+
+	fileVal := l.file[strings.ToLower(key)]
+	if fileVal != "" {
+		defaultVal = fileVal
+	}
+
+	if l.prefix != "" {
+		value = os.Getenv(l.prefix + key)
+		if value != "" {
+			return value
+		}
+	}
+
+	value = getEnv(key, defaultVal)
+	return value
+}
+
+// envPrefix turns an environment name into its variable prefix, e.g.
+// "prod-eu" becomes "PROD_EU_".
+func envPrefix(name string) (prefix string) {
+	prefix = strings.Map(func(r rune) (mapped rune) {
+		mapped = r
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			mapped = '_'
+		}
+		return mapped
+	}, strings.ToUpper(name)) + "_"
+	return prefix
+}
+
+// Secrets returns the configured credentials, to be masked in logs and
+// errors: passwords, tokens, including those of sources, and API keys, and
+// the passwords of QUEUE_URL and the proxies.
+func (c Config) Secrets() (secrets []string) {
+	secrets = []string{
+		c.ESPassword,
+		c.ESAPIKey,
+		c.GitToken,
+		c.ExportSecretKey,
+		c.ExportSessionToken,
+		c.EmbeddingAPIKey,
+		c.RerankAPIKey,
+		c.RewriteAPIKey,
+		c.SummaryAPIKey,
+	}
+	secrets = append(secrets, c.APIKeys...)
+	secrets = append(secrets, c.AdminAPIKeys...)
+	for _, source := range c.Sources {
+		secrets = append(secrets, source.Token)
+	}
+	for _, tenant := range c.Tenants {
+		secrets = append(secrets, tenant.Secrets()...)
+	}
+
+	for _, withPassword := range []string{c.QueueURL, c.ESProxy, c.GitProxy} {
+		parsed, err := url.Parse(withPassword)
+		if err == nil && parsed.User != nil {
+			password, _ := parsed.User.Password()
+			secrets = append(secrets, password)
+		}
+	}
+
+	secrets = slices.DeleteFunc(secrets, func(secret string) bool { return secret == "" })
+	return secrets
 }
 
 func getEnv(key string, defaultVal string) (value string) {
@@ -0,0 +1,552 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// ErrUnknownSetting is returned when a config file sets a key that no
+// variable reads, usually a typo.
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// RepoConfig holds the settings of one repository listed in a config file.
+// Branch is checked out instead of the remote's default branch, and Include
+// limits indexing to the listed paths, relative to the repository root.
+// Modules narrows indexing within the repository's Go modules.
+type RepoConfig struct {
+	Name    string         `yaml:"name"`
+	Branch  string         `yaml:"branch"`
+	Include []string       `yaml:"include"`
+	Modules []ModuleConfig `yaml:"modules"`
+}
+
+// ModuleConfig holds the settings of one Go module of a repository, named by
+// the module path its go.mod declares. Include and Exclude are patterns, as
+// in INCLUDE_PATTERNS and EXCLUDE_PATTERNS, matched against paths relative
+// to the module's directory and applied on top of them.
+type ModuleConfig struct {
+	Path    string   `yaml:"path"`
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Module returns the settings of a repository's Go module by its path, or
+// none when it isn't listed.
+func (r RepoConfig) Module(modulePath string) (module ModuleConfig) {
+	for _, candidate := range r.Modules {
+		if candidate.Path == modulePath {
+			module = candidate
+			return module
+		}
+	}
+	return module
+}
+
+// SourceConfig is a git host and organization listed under sources in a
+// config file. Its repositories are cloned under REPOS_PATH/<name> and
+// indexed as <name>/<repo>, so repositories of the same name in different
+// organizations or on different hosts don't collide.
+type SourceConfig struct {
+	Name string `yaml:"name"`
+	// Host fills {host} in the URL templates. It defaults to github.com.
+	Host string `yaml:"host"`
+	Org  string `yaml:"org"`
+	// URLTemplate is the clone URL, with {host}, {org}, {repo}, and
+	// optionally {token} placeholders. It defaults to
+	// git@{host}:{org}/{repo}.git.
+	URLTemplate string `yaml:"url_template"`
+	// TokenEnv names the variable holding the source's access token, so the
+	// token stays out of the file.
+	TokenEnv   string `yaml:"token_env"`
+	SSHKeyPath string `yaml:"ssh_key_path"`
+	// SourceURLTemplate replaces SOURCE_URL_TEMPLATE for the source's
+	// results.
+	SourceURLTemplate string       `yaml:"source_url_template"`
+	Repos             []RepoConfig `yaml:"repos"`
+	// Kind is the host's API, github or gitlab, used to discover the
+	// organization's repositories when Repos is empty. It defaults to
+	// github.
+	Kind string `yaml:"kind"`
+	// APIURL is the base URL of the host's API. It defaults to
+	// https://api.github.com for github.com, https://{host}/api/v3 for other
+	// GitHub hosts, and https://{host}/api/v4 for GitLab.
+	APIURL string `yaml:"api_url"`
+	// Exclude names discovered repositories not to index.
+	Exclude []string `yaml:"exclude"`
+
+	// Token is the access token read from TokenEnv.
+	Token string `yaml:"-"`
+}
+
+// defaultSourceHost and defaultSourceURLTemplate are a source's host and
+// clone URL when the config file doesn't set them.
+const (
+	defaultSourceHost        = "github.com"
+	defaultSourceURLTemplate = "git@{host}:{org}/{repo}.git"
+)
+
+// The kinds of host a source's repositories can be discovered from.
+const (
+	SourceKindGitHub = "github"
+	SourceKindGitLab = "gitlab"
+)
+
+// Discovers reports whether the source's repositories are discovered from
+// its host's API rather than listed.
+func (s SourceConfig) Discovers() (discovers bool) {
+	discovers = len(s.Repos) == 0
+	return discovers
+}
+
+// fileConfig is the layout of a config file: a value for any variable under
+// its lower-case name, the repositories with their settings, further git
+// sources, and tenants.
+type fileConfig struct {
+	Repos   []RepoConfig           `yaml:"repos"`
+	Sources []SourceConfig         `yaml:"sources"`
+	Tenants []tenantFileConfig     `yaml:"tenants"`
+	Values  map[string]interface{} `yaml:",inline"`
+}
+
+// tenantFileConfig is a tenant listed in a config file: its name, a value
+// for any variable it sets differently from the rest of the file, and its
+// repositories and sources, which replace the file's when set.
+type tenantFileConfig struct {
+	Name    string                 `yaml:"name"`
+	Repos   []RepoConfig           `yaml:"repos"`
+	Sources []SourceConfig         `yaml:"sources"`
+	Values  map[string]interface{} `yaml:",inline"`
+}
+
+// LoadFile loads configuration from a YAML file, with environment variables
+// layered on top, for the environment named by ENVIRONMENT, if any.
+func LoadFile(path string) (cfg Config, err error) {
+	cfg, err = LoadFileEnvironment(path, os.Getenv("ENVIRONMENT"))
+	return cfg, err
+}
+
+// LoadFileEnvironment loads configuration for a named environment from a
+// YAML file. Every variable can be set in the file under its lower-case
+// name, such as es_host or git_repos, with lists as YAML sequences. A
+// variable set in the environment, prefixed or shared, overrides the file.
+// The file's repos list names the repositories to clone, replacing
+// git_repos, with per-repository settings, and its sources list adds
+// repositories from further organizations and hosts. Its tenants list adds
+// tenants, each with its own values, repos, and sources.
+func LoadFileEnvironment(path string, name string) (cfg Config, err error) {
+	var file fileConfig
+	file, err = readConfigFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	var l envLoader
+	var tenantFiles map[string]map[string]string
+	l, tenantFiles, err = newFileLoader(path, file)
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg, err = loadEnvironment(l, name)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Repos = file.Repos
+
+	err = loadSources(file.Sources, cfg.GitRepos)
+	if err != nil {
+		err = fmt.Errorf("invalid sources in %s: %w", path, err)
+		return cfg, err
+	}
+	cfg.Sources = file.Sources
+
+	err = applyTenantFiles(&cfg, path, file, tenantFiles)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = checkUnknownSettings(path, l, tenantFiles)
+	return cfg, err
+}
+
+// readConfigFile reads and parses the YAML file at path, rejecting fields
+// it doesn't know.
+func readConfigFile(path string) (file fileConfig, err error) {
+	var data []byte
+	data, err = os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read config file: %w", err)
+		return file, err
+	}
+
+	err = yaml.UnmarshalStrict(data, &file)
+	if err != nil {
+		err = fmt.Errorf("failed to parse config file %s: %w", path, err)
+		return file, err
+	}
+	return file, err
+}
+
+// newFileLoader builds a loader that reads the file's values, and each
+// tenant's, under the environment. It also returns each tenant's values by
+// their lower-case file keys.
+func newFileLoader(path string, file fileConfig) (l envLoader, tenantFiles map[string]map[string]string, err error) {
+	l = envLoader{file: map[string]string{}, seen: map[string]bool{}}
+	for key, value := range file.Values {
+		l.file[key], err = fileValue(value)
+		if err != nil {
+			err = fmt.Errorf("invalid %s in %s: %w", key, path, err)
+			return l, tenantFiles, err
+		}
+	}
+
+	err = loadRepos(file.Repos, l.file)
+	if err != nil {
+		err = fmt.Errorf("invalid repos in %s: %w", path, err)
+		return l, tenantFiles, err
+	}
+
+	tenantFiles = map[string]map[string]string{}
+	for _, tenant := range file.Tenants {
+		if _, listed := tenantFiles[tenant.Name]; listed {
+			err = fmt.Errorf("tenant %s is listed twice in %s", tenant.Name, path)
+			return l, tenantFiles, err
+		}
+		values := map[string]string{}
+		for key, value := range tenant.Values {
+			values[key], err = fileValue(value)
+			if err != nil {
+				err = fmt.Errorf("invalid %s for tenant %s in %s: %w", key, tenant.Name, path, err)
+				return l, tenantFiles, err
+			}
+		}
+		err = loadRepos(tenant.Repos, values)
+		if err != nil {
+			err = fmt.Errorf("invalid repos for tenant %s in %s: %w", tenant.Name, path, err)
+			return l, tenantFiles, err
+		}
+		tenantFiles[tenant.Name] = values
+
+		upper := make(map[string]string, len(values))
+		for key, value := range values {
+			upper[strings.ToUpper(key)] = value
+		}
+		l.tenants = append(l.tenants, tenantValues{name: tenant.Name, values: upper})
+	}
+
+	return l, tenantFiles, err
+}
+
+// applyTenantFiles gives each tenant the file's repositories and sources,
+// replaced by the tenant's own, each when set.
+func applyTenantFiles(cfg *Config, path string, file fileConfig, tenantFiles map[string]map[string]string) (err error) {
+	for i := range cfg.Tenants {
+		tenant := &cfg.Tenants[i]
+		tenant.Repos = cfg.Repos
+		tenant.Sources = cfg.Sources
+		for _, tenantFile := range file.Tenants {
+			if tenantFile.Name != tenant.Tenant {
+				continue
+			}
+			_, ownRepos := tenantFiles[tenantFile.Name]["git_repos"]
+			if ownRepos {
+				tenant.Repos = tenantFile.Repos
+			}
+			if len(tenantFile.Sources) > 0 {
+				err = loadSources(tenantFile.Sources, tenant.GitRepos)
+				if err != nil {
+					err = fmt.Errorf("invalid sources for tenant %s in %s: %w", tenant.Tenant, path, err)
+					return err
+				}
+				tenant.Sources = tenantFile.Sources
+			}
+		}
+	}
+	return err
+}
+
+// checkUnknownSettings returns ErrUnknownSetting for file keys the loader
+// never read. Every key is read while loading, so one left unread is
+// misspelled.
+func checkUnknownSettings(path string, l envLoader, tenantFiles map[string]map[string]string) (err error) {
+	var unknown []string
+	for key := range l.file {
+		if !l.seen[strings.ToUpper(key)] {
+			unknown = append(unknown, key)
+		}
+	}
+	for tenant, values := range tenantFiles {
+		for key := range values {
+			if !l.seen[strings.ToUpper(key)] {
+				unknown = append(unknown, "tenants."+tenant+"."+key)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		err = fmt.Errorf("%w in %s: %s", ErrUnknownSetting, path, strings.Join(unknown, ", "))
+	}
+	return err
+}
+
+// Repo returns the settings of the repository indexed under name from the
+// config file, or none when it isn't listed there.
+func (c Config) Repo(name string) (repo RepoConfig) {
+	repos := c.Repos
+	sourceName, bare, qualified := strings.Cut(name, "/")
+	if qualified {
+		repos = nil
+		for _, source := range c.Sources {
+			if source.Name == sourceName {
+				repos = source.Repos
+			}
+		}
+		name = bare
+	}
+
+	for _, candidate := range repos {
+		if candidate.Name == name {
+			repo = candidate
+			return repo
+		}
+	}
+	return repo
+}
+
+// RepoNames returns the name each configured repository is indexed under:
+// its own for GIT_REPOS, and <source>/<repo> for those of sources.
+func (c Config) RepoNames() (names []string) {
+	names = append(names, c.GitRepos...)
+	for _, source := range c.Sources {
+		for _, repo := range source.Repos {
+			names = append(names, source.Name+"/"+repo.Name)
+		}
+	}
+	return names
+}
+
+// Cloning reports whether repositories are cloned: those of GIT_REPOS with
+// GIT_ORG set, or those of any source.
+func (c Config) Cloning() (cloning bool) {
+	cloning = (c.GitOrg != "" && len(c.GitRepos) > 0) || len(c.Sources) > 0
+	return cloning
+}
+
+// RepoSource returns the source to clone the repository indexed under name
+// from, and the repository's name there. A plain name is of GIT_ORG, and
+// <source>/<repo> of the named source. found is false when that source
+// isn't configured.
+func (c Config) RepoSource(name string) (source SourceConfig, repo string, found bool) {
+	sourceName, bare, qualified := strings.Cut(name, "/")
+	if !qualified {
+		source = SourceConfig{
+			Host:        defaultSourceHost,
+			Org:         c.GitOrg,
+			URLTemplate: c.GitURLFormat,
+			Token:       c.GitToken,
+			SSHKeyPath:  c.GitSSHKeyPath,
+		}
+		repo = name
+		found = c.GitOrg != ""
+		return source, repo, found
+	}
+
+	for _, candidate := range c.Sources {
+		if candidate.Name == sourceName {
+			source = candidate
+			repo = bare
+			found = true
+			return source, repo, found
+		}
+	}
+	return source, repo, found
+}
+
+// fileValue renders a config file value as its variable would be set: lists
+// are comma-separated.
+func fileValue(value interface{}) (rendered string, err error) {
+	switch typed := value.(type) {
+	case nil:
+	case []interface{}:
+		items := make([]string, 0, len(typed))
+		for _, item := range typed {
+			var itemValue string
+			itemValue, err = fileValue(item)
+			if err != nil {
+				return rendered, err
+			}
+			items = append(items, itemValue)
+		}
+		rendered = strings.Join(items, ",")
+	case map[interface{}]interface{}:
+		err = errors.New("must be a value or a list, not a mapping")
+	default:
+		rendered = fmt.Sprint(typed)
+	}
+	return rendered, err
+}
+
+// loadRepos validates the file's repository list and names the repositories
+// to clone from it.
+func loadRepos(repos []RepoConfig, values map[string]string) (err error) {
+	if len(repos) == 0 {
+		return err
+	}
+	_, hasGitRepos := values["git_repos"]
+	if hasGitRepos {
+		err = errors.New("set repos or git_repos, not both")
+		return err
+	}
+
+	var names []string
+	names, err = validateRepos(repos)
+	if err != nil {
+		return err
+	}
+
+	values["git_repos"] = strings.Join(names, ",")
+	return err
+}
+
+// validateRepos checks a repository list's names and cleans its include
+// paths, returning the names.
+func validateRepos(repos []RepoConfig) (names []string, err error) {
+	names = make([]string, 0, len(repos))
+	for i, repo := range repos {
+		if repo.Name == "" || repo.Name == "." || repo.Name == ".." || strings.ContainsAny(repo.Name, `,/\`) {
+			err = fmt.Errorf("invalid repository name %q", repo.Name)
+			return names, err
+		}
+		if slices.Contains(names, repo.Name) {
+			err = fmt.Errorf("repository %s is listed twice", repo.Name)
+			return names, err
+		}
+		names = append(names, repo.Name)
+
+		for j, include := range repo.Include {
+			include = filepath.Clean(include)
+			if filepath.IsAbs(include) || include == ".." || strings.HasPrefix(include, "../") {
+				err = fmt.Errorf("invalid include path %q for %s: must be inside the repository", repo.Include[j], repo.Name)
+				return names, err
+			}
+			repos[i].Include[j] = include
+		}
+
+		err = validateModules(repo)
+		if err != nil {
+			return names, err
+		}
+	}
+	return names, err
+}
+
+// validateModules checks a repository's module settings: each module listed
+// once, with valid patterns.
+func validateModules(repo RepoConfig) (err error) {
+	var paths []string
+	for _, module := range repo.Modules {
+		if module.Path == "" {
+			err = fmt.Errorf("module of %s without a path", repo.Name)
+			return err
+		}
+		if slices.Contains(paths, module.Path) {
+			err = fmt.Errorf("module %s of %s is listed twice", module.Path, repo.Name)
+			return err
+		}
+		paths = append(paths, module.Path)
+
+		for _, pattern := range slices.Concat(module.Include, module.Exclude) {
+			_, err = path.Match(pattern, "")
+			if err != nil {
+				err = fmt.Errorf("invalid pattern %q for module %s of %s: %w", pattern, module.Path, repo.Name, err)
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// loadSources validates the file's sources, fills in their defaults, and
+// reads their tokens. A source's name is its directory under REPOS_PATH, so
+// it can't be shared with another source or a repository of GIT_REPOS.
+func loadSources(sources []SourceConfig, gitRepos []string) (err error) {
+	names := make([]string, 0, len(sources))
+	for i := range sources {
+		source := &sources[i]
+		if source.Name == "" || source.Name == "." || source.Name == ".." || strings.ContainsAny(source.Name, `,/\`) {
+			err = fmt.Errorf("invalid source name %q", source.Name)
+			return err
+		}
+		if slices.Contains(names, source.Name) || slices.Contains(gitRepos, source.Name) {
+			err = fmt.Errorf("source %s is listed twice or shares its name with a repository", source.Name)
+			return err
+		}
+		names = append(names, source.Name)
+
+		if source.Org == "" {
+			err = fmt.Errorf("source %s needs an org", source.Name)
+			return err
+		}
+		_, err = validateRepos(source.Repos)
+		if err != nil {
+			err = fmt.Errorf("source %s: %w", source.Name, err)
+			return err
+		}
+		_, err = loadSourceURLTemplate("source_url_template for source "+source.Name, source.SourceURLTemplate)
+		if err != nil {
+			return err
+		}
+
+		if source.Host == "" {
+			source.Host = defaultSourceHost
+		}
+		if source.URLTemplate == "" {
+			source.URLTemplate = defaultSourceURLTemplate
+		}
+		err = loadSourceAPI(source)
+		if err != nil {
+			return err
+		}
+		if source.TokenEnv != "" {
+			source.Token = os.Getenv(source.TokenEnv)
+			if source.Token == "" {
+				err = fmt.Errorf("source %s: %s is not set", source.Name, source.TokenEnv)
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// loadSourceAPI checks the kind of a source's host and fills in the URL of
+// its API, which discovers the source's repositories when none are listed.
+func loadSourceAPI(source *SourceConfig) (err error) {
+	switch source.Kind {
+	case "", SourceKindGitHub:
+		source.Kind = SourceKindGitHub
+		if source.APIURL == "" && source.Host == defaultSourceHost {
+			source.APIURL = "https://api.github.com"
+		}
+		if source.APIURL == "" {
+			source.APIURL = "https://" + source.Host + "/api/v3"
+		}
+	case SourceKindGitLab:
+		if source.APIURL == "" {
+			source.APIURL = "https://" + source.Host + "/api/v4"
+		}
+	default:
+		err = fmt.Errorf("source %s: kind must be %s or %s, not %q", source.Name, SourceKindGitHub, SourceKindGitLab, source.Kind)
+		return err
+	}
+
+	source.APIURL = strings.TrimSuffix(source.APIURL, "/")
+	return err
+}
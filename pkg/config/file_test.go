@@ -0,0 +1,329 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a config file in a temporary directory.
+func writeConfigFile(t *testing.T, content string) (path string) {
+	t.Helper()
+
+	path = filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("ES_INDEX", "from-env")
+
+	path := writeConfigFile(t, `
+es_host: http://es.internal:9200
+es_index: from-file
+git_org: myorg
+index_interval: 10m
+languages: [go, python]
+chunk_max_lines: 80
+dedup_identical: false
+repos:
+  - name: api
+    branch: release
+    include: [cmd, ./pkg/]
+    modules:
+      - path: example.com/api/tools
+        exclude: [testdata/, "*_mock.go"]
+  - name: web
+`)
+
+	got, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if got.ESHost != "http://es.internal:9200" {
+		t.Errorf("ESHost = %q, want the file's value", got.ESHost)
+	}
+	if got.ESIndex != "from-env" {
+		t.Errorf("ESIndex = %q, want the environment's value", got.ESIndex)
+	}
+	if got.IndexInterval != 10*time.Minute || got.ChunkMaxLines != 80 || got.DedupIdentical {
+		t.Errorf("IndexInterval, ChunkMaxLines, DedupIdentical = %v, %d, %v", got.IndexInterval, got.ChunkMaxLines, got.DedupIdentical)
+	}
+	if !slices.Equal(got.Languages, []string{"go", "python"}) {
+		t.Errorf("Languages = %v, want [go python]", got.Languages)
+	}
+	if got.ReposPath != "/repos" {
+		t.Errorf("ReposPath = %q, want the default", got.ReposPath)
+	}
+	assertGitReposEqual(t, got.GitRepos, []string{"api", "web"})
+
+	api := got.Repo("api")
+	if api.Branch != "release" || !slices.Equal(api.Include, []string{"cmd", "pkg"}) {
+		t.Errorf("Repo(api) = %+v, want branch release including cmd and pkg", api)
+	}
+	tools := api.Module("example.com/api/tools")
+	if !slices.Equal(tools.Exclude, []string{"testdata/", "*_mock.go"}) || api.Module("example.com/api").Path != "" {
+		t.Errorf("Repo(api).Modules = %+v, want settings for example.com/api/tools only", api.Modules)
+	}
+	if got.Repo("web").Branch != "" || got.Repo("unlisted").Name != "" {
+		t.Errorf("Repo() returned settings for a repository without any")
+	}
+}
+
+func TestLoadFileEnvironment(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PROD_ES_INDEX", "code-prod")
+
+	path := writeConfigFile(t, `
+environments: [staging, prod]
+es_index: code-shared
+`)
+
+	got, err := LoadFileEnvironment(path, "prod")
+	if err != nil {
+		t.Fatalf("LoadFileEnvironment() error = %v", err)
+	}
+	if got.ESIndex != "code-prod" {
+		t.Errorf("ESIndex = %q, want the prefixed variable's value", got.ESIndex)
+	}
+
+	_, err = LoadFileEnvironment(path, "qa")
+	if !errors.Is(err, ErrUnknownEnvironment) {
+		t.Errorf("LoadFileEnvironment(qa) error = %v, want %v", err, ErrUnknownEnvironment)
+	}
+}
+
+func TestLoadFileSources(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("GIT_ORG", "myorg")
+	t.Setenv("GIT_REPOS", "api")
+	t.Setenv("GITLAB_TOKEN", "glpat-secret")
+
+	path := writeConfigFile(t, `
+sources:
+  - name: gitlab
+    kind: gitlab
+    host: gitlab.example.com
+    org: platform
+    url_template: https://oauth2:{token}@{host}/{org}/{repo}.git
+    token_env: GITLAB_TOKEN
+    source_url_template: https://{host}/{org}/{repo}/-/blob/{commit}/{path}
+    repos:
+      - name: deploy
+        branch: stable
+      - name: charts
+  - name: partner
+    org: partner-co
+    repos:
+      - name: sdk
+  - name: internal
+    host: git.example.com
+    org: tools
+    exclude: [sandbox]
+`)
+
+	got, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	want := []string{"api", "gitlab/deploy", "gitlab/charts", "partner/sdk"}
+	if names := got.RepoNames(); !slices.Equal(names, want) {
+		t.Errorf("RepoNames() = %v, want %v", names, want)
+	}
+	if got.Repo("gitlab/deploy").Branch != "stable" {
+		t.Errorf("Repo(gitlab/deploy) = %+v, want branch stable", got.Repo("gitlab/deploy"))
+	}
+
+	source, repo, found := got.RepoSource("gitlab/charts")
+	if !found || repo != "charts" || source.Host != "gitlab.example.com" || source.Token != "glpat-secret" {
+		t.Errorf("RepoSource(gitlab/charts) = %+v, %q, %v, want the gitlab source's charts", source, repo, found)
+	}
+	source, _, _ = got.RepoSource("partner/sdk")
+	if source.Host != "github.com" || source.URLTemplate != "git@{host}:{org}/{repo}.git" {
+		t.Errorf("RepoSource(partner/sdk) = %+v, want the default host and template", source)
+	}
+	source, repo, found = got.RepoSource("api")
+	if !found || repo != "api" || source.Org != "myorg" {
+		t.Errorf("RepoSource(api) = %+v, %q, %v, want GIT_ORG's api", source, repo, found)
+	}
+	if _, _, found = got.RepoSource("other/api"); found {
+		t.Error("RepoSource(other/api) found a source that isn't configured")
+	}
+	if !slices.Contains(got.Secrets(), "glpat-secret") {
+		t.Error("Secrets() is missing the source's token")
+	}
+
+	tests := []struct {
+		name          string
+		wantDiscovers bool
+		wantKind      string
+		wantAPIURL    string
+	}{
+		{name: "gitlab", wantKind: SourceKindGitLab, wantAPIURL: "https://gitlab.example.com/api/v4"},
+		{name: "partner", wantKind: SourceKindGitHub, wantAPIURL: "https://api.github.com"},
+		{name: "internal", wantDiscovers: true, wantKind: SourceKindGitHub, wantAPIURL: "https://git.example.com/api/v3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, _, _ := got.RepoSource(tt.name + "/any")
+			if source.Discovers() != tt.wantDiscovers || source.Kind != tt.wantKind || source.APIURL != tt.wantAPIURL {
+				t.Errorf("source %s = %+v, want discovers %v, kind %s, API %s", tt.name, source, tt.wantDiscovers, tt.wantKind, tt.wantAPIURL)
+			}
+		})
+	}
+}
+
+func TestLoadFileTenants(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TENANT_TEAM_A_LOG_LEVEL", "debug")
+
+	path := writeConfigFile(t, `
+repos:
+  - name: api
+    branch: stable
+sources:
+  - {name: partner, org: partner-co, repos: [{name: sdk}]}
+tenants:
+  - name: team-a
+    es_index: team-a-code
+    log_level: warn
+  - name: team-b
+    repos:
+      - name: ledger
+`)
+
+	got, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	teamA, _ := got.TenantConfig("team-a")
+	if teamA.ESIndex != "team-a-code" || teamA.LogLevel != "debug" {
+		t.Errorf("team-a ESIndex, LogLevel = %q, %q, want the file's index and the variable's level", teamA.ESIndex, teamA.LogLevel)
+	}
+	if names := teamA.RepoNames(); !slices.Equal(names, []string{"api", "partner/sdk"}) || teamA.Repo("api").Branch != "stable" {
+		t.Errorf("team-a RepoNames() = %v, want the file's repositories with their settings", names)
+	}
+
+	teamB, _ := got.TenantConfig("team-b")
+	if names := teamB.RepoNames(); !slices.Equal(names, []string{"ledger", "partner/sdk"}) {
+		t.Errorf("team-b RepoNames() = %v, want its own repositories with the file's sources", names)
+	}
+	if got.LogLevel != "info" || !slices.Equal(got.RepoNames(), []string{"api", "partner/sdk"}) {
+		t.Errorf("default LogLevel, RepoNames() = %q, %v, want the file's", got.LogLevel, got.RepoNames())
+	}
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{
+			name:    "unknown setting",
+			content: "es_hots: http://es:9200\n",
+			wantErr: ErrUnknownSetting,
+		},
+		{
+			name:    "unknown repository setting",
+			content: "repos:\n  - name: api\n    branches: [main]\n",
+		},
+		{
+			name:    "repos and git_repos",
+			content: "git_repos: [api]\nrepos:\n  - name: web\n",
+		},
+		{
+			name:    "repository listed twice",
+			content: "repos:\n  - name: api\n  - name: api\n",
+		},
+		{
+			name:    "include outside the repository",
+			content: "repos:\n  - name: api\n    include: [../other]\n",
+		},
+		{
+			name:    "module without a path",
+			content: "repos:\n  - name: api\n    modules: [{exclude: [\"*\"]}]\n",
+		},
+		{
+			name:    "module listed twice",
+			content: "repos:\n  - name: api\n    modules: [{path: example.com/a}, {path: example.com/a}]\n",
+		},
+		{
+			name:    "invalid module pattern",
+			content: "repos:\n  - name: api\n    modules: [{path: example.com/a, include: [\"[\"]}]\n",
+		},
+		{
+			name:    "source listed twice",
+			content: "sources:\n  - {name: gl, org: a, repos: [{name: x}]}\n  - {name: gl, org: b, repos: [{name: y}]}\n",
+		},
+		{
+			name:    "source without org",
+			content: "sources:\n  - {name: gl, repos: [{name: x}]}\n",
+		},
+		{
+			name:    "source named as a repository",
+			content: "git_repos: [gl]\nsources:\n  - {name: gl, org: a, repos: [{name: x}]}\n",
+		},
+		{
+			name:    "source URL template with an unknown placeholder",
+			content: "sources:\n  - {name: gl, org: a, source_url_template: \"https://{host}/{org}/{repo}/blob/{sha}/{path}\", repos: [{name: x}]}\n",
+		},
+		{
+			name:    "unknown source kind",
+			content: "sources:\n  - {name: gl, org: a, kind: bitbucket}\n",
+		},
+		{
+			name:    "source token unset",
+			content: "sources:\n  - {name: gl, org: a, token_env: UNSET_SOURCE_TOKEN, repos: [{name: x}]}\n",
+		},
+		{
+			name:    "unknown tenant setting",
+			content: "tenants:\n  - name: team-a\n    es_indx: a\n",
+			wantErr: ErrUnknownSetting,
+		},
+		{
+			name:    "tenant listed twice",
+			content: "tenants:\n  - name: team-a\n  - name: team-a\n",
+		},
+		{
+			name:    "mapping value",
+			content: "es_host:\n  url: http://es:9200\n",
+		},
+		{
+			name:    "invalid value",
+			content: "index_interval: often\n",
+		},
+		{
+			name:    "not YAML",
+			content: "es_host: [\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			_, err := LoadFile(writeConfigFile(t, tt.content))
+			if err == nil {
+				t.Fatal("LoadFile() succeeded, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadFile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil {
+		t.Error("LoadFile() of a missing file succeeded, want error")
+	}
+}
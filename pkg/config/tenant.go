@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tenantNamePattern matches valid tenant names, which appear in index names,
+// URL paths, and metric labels.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// tenantValues holds the values a config file sets for one tenant, keyed by
+// variable name.
+type tenantValues struct {
+	name   string
+	values map[string]string
+}
+
+// TenantConfig returns the configuration of the named tenant, and whether
+// it is configured.
+func (c Config) TenantConfig(name string) (tenant Config, found bool) {
+	for _, candidate := range c.Tenants {
+		if candidate.Tenant == name {
+			tenant = candidate
+			found = true
+			return tenant, found
+		}
+	}
+	return tenant, found
+}
+
+// loadTenants loads the tenants listed in TENANTS and in the config file.
+// Each tenant reads its variables prefixed with TENANT_ and its name, e.g.
+// TENANT_TEAM_A_ES_INDEX, then its config file values, then the shared
+// configuration, except that its index, clones, state and dead letter
+// files, queue stream, index template, and export prefix default to its own
+// beside those of base, so tenants don't overwrite each other.
+func (l envLoader) loadTenants(base Config) (tenants []Config, err error) {
+	names := make([]string, 0, len(l.tenants))
+	for _, tenant := range l.tenants {
+		names = append(names, tenant.name)
+	}
+	for _, name := range splitList(l.getEnv("TENANTS", "")) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	indices := map[string]string{base.ESIndex: "the default profile"}
+	prefixes := map[string]string{}
+	for _, name := range names {
+		if !tenantNamePattern.MatchString(name) {
+			err = fmt.Errorf("invalid tenant name %q: must be lower-case letters, digits, '-' and '_'", name)
+			return tenants, err
+		}
+		prefix := "TENANT_" + envPrefix(name)
+		if other, taken := prefixes[prefix]; taken {
+			err = fmt.Errorf("tenants %s and %s share the variable prefix %s", other, name, prefix)
+			return tenants, err
+		}
+		prefixes[prefix] = name
+
+		tl := l
+		tl.tenantPrefix = prefix
+		tl.tenant = tenantDefaults(base, name)
+		for _, tenant := range l.tenants {
+			if tenant.name == name {
+				maps.Copy(tl.tenant, tenant.values)
+			}
+		}
+
+		index := tl.getEnv("ES_INDEX", "")
+		if _, set := tl.tenant["ES_INDEX_PATTERNS"]; !set {
+			tl.tenant["ES_INDEX_PATTERNS"] = index + "," + index + "-*"
+		}
+		if _, set := tl.tenant["ES_INDEX_TEMPLATE"]; !set {
+			tl.tenant["ES_INDEX_TEMPLATE"] = index
+			if base.ESIndexTemplate == "" {
+				tl.tenant["ES_INDEX_TEMPLATE"] = "none"
+			}
+		}
+
+		var cfg Config
+		cfg, err = tl.load()
+		if err != nil {
+			err = fmt.Errorf("tenant %s: %w", name, err)
+			return tenants, err
+		}
+		cfg.Tenant = name
+
+		if other, taken := indices[cfg.ESIndex]; taken {
+			err = fmt.Errorf("tenant %s: ES_INDEX %s is already used by %s", name, cfg.ESIndex, other)
+			return tenants, err
+		}
+		indices[cfg.ESIndex] = "tenant " + name
+
+		tenants = append(tenants, cfg)
+	}
+
+	return tenants, err
+}
+
+// tenantDefaults returns the values a tenant gets in place of base's, so its
+// index and files sit beside base's instead of on top of them.
+func tenantDefaults(base Config, name string) (values map[string]string) {
+	values = map[string]string{
+		"ES_INDEX":        base.ESIndex + "-" + name,
+		"REPOS_PATH":      filepath.Join(base.ReposPath, name),
+		"STATE_FILE":      tenantFile(base.StateFile, name),
+		"DEADLETTER_FILE": tenantFile(base.DeadLetterFile, name),
+		"MANIFEST_FILE":   tenantFile(base.ManifestFile, name),
+		"RENAME_FILE":     tenantFile(base.RenameFile, name),
+		"QUEUE_STREAM":    base.QueueStream + ":" + name,
+		"EXPORT_PREFIX":   base.ExportPrefix + name + "/",
+	}
+	return values
+}
+
+// tenantFile returns the tenant's counterpart of a state file path, with the
+// tenant's name before the extension, or "none" when base has none.
+func tenantFile(path string, name string) (tenantPath string) {
+	if path == "" {
+		tenantPath = "none"
+		return tenantPath
+	}
+	ext := filepath.Ext(path)
+	tenantPath = strings.TrimSuffix(path, ext) + "-" + name + ext
+	return tenantPath
+}
@@ -0,0 +1,236 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrGenerationExists is returned when a new index generation's name is
+// taken, which happens when ES_GENERATION_FORMAT is coarser than the time
+// between rebuilds.
+var ErrGenerationExists = errors.New("index generation already exists")
+
+// Index returns the index or alias the client reads and writes.
+func (es *Client) Index() (index string) {
+	index = es.index
+	return index
+}
+
+// WithIndex returns a client for the same cluster that reads and writes index
+// instead, such as a generation being built before the alias is swapped to it.
+func (es *Client) WithIndex(index string) (client *Client) {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+
+	client = &Client{
+		host:             es.host,
+		index:            index,
+		indexTemplate:    es.indexTemplate,
+		indexPatterns:    es.indexPatterns,
+		templatePriority: es.templatePriority,
+		schemaMigration:  es.schemaMigration,
+		generationFormat: es.generationFormat,
+		generationsKept:  es.generationsKept,
+		username:         es.username,
+		password:         es.password,
+		apiKey:           es.apiKey,
+		configured:       es.configured,
+		client:           es.client,
+		metrics:          es.metrics,
+		backend:          es.backend,
+		version:          es.version,
+	}
+	client.ready.Store(es.ready.Load())
+	return client
+}
+
+// GenerationName returns the name of the index generation built at t: the
+// index name and t in ES_GENERATION_FORMAT, e.g. code-index-2025-01-01-093000.
+func (es *Client) GenerationName(t time.Time) (name string) {
+	name = es.index + "-" + t.UTC().Format(es.generationFormat)
+	return name
+}
+
+// CreateGeneration creates the index generation for a rebuild started at t,
+// with the same settings and mappings EnsureIndex gives the index, and
+// returns its name.
+func (es *Client) CreateGeneration(ctx context.Context, t time.Time) (name string, err error) {
+	name = es.GenerationName(t)
+
+	var exists bool
+	exists, err = es.indexExists(ctx, name)
+	if err != nil {
+		err = fmt.Errorf("failed to check if index exists: %w", err)
+		return name, err
+	}
+	if exists {
+		err = fmt.Errorf("%w: %s", ErrGenerationExists, name)
+		return name, err
+	}
+
+	err = es.createIndex(ctx, name)
+	return name, err
+}
+
+// aliasIndices is the part of a GET _alias response naming the indices.
+type aliasIndices map[string]json.RawMessage
+
+// AliasTargets returns the indices the index name points to as an alias, or
+// none when it is a concrete index or doesn't exist.
+func (es *Client) AliasTargets(ctx context.Context) (indices []string, err error) {
+	indices, err = es.aliasIndices(ctx, fmt.Sprintf("%s/_alias/%s", es.host, es.index))
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		indices = nil
+		err = nil
+	}
+	return indices, err
+}
+
+// SwapAlias points the index name at target in one atomic request, removing
+// it from the generations it pointed to, which are returned. Searches never
+// see a missing or half-built index. When the name is still a concrete
+// index, as before the first rebuild, that index is deleted in the same
+// request, since the alias can't be created alongside it.
+func (es *Client) SwapAlias(ctx context.Context, target string) (previous []string, replacedIndex bool, err error) {
+	previous, err = es.AliasTargets(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to read alias %s: %w", es.index, err)
+		return previous, replacedIndex, err
+	}
+
+	var actions []map[string]interface{}
+	if len(previous) == 0 {
+		replacedIndex, err = es.indexExists(ctx, es.index)
+		if err != nil {
+			err = fmt.Errorf("failed to check if index exists: %w", err)
+			return previous, replacedIndex, err
+		}
+		if replacedIndex {
+			actions = append(actions, map[string]interface{}{
+				"remove_index": map[string]interface{}{"index": es.index},
+			})
+		}
+	}
+
+	for _, index := range previous {
+		if index != target {
+			actions = append(actions, map[string]interface{}{
+				"remove": map[string]interface{}{"index": index, "alias": es.index},
+			})
+		}
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": target, "alias": es.index},
+	})
+
+	_, err = es.doJSON(ctx, http.MethodPost, es.host+"/_aliases", map[string]interface{}{"actions": actions})
+	if err != nil {
+		err = fmt.Errorf("failed to point alias %s at %s: %w", es.index, target, err)
+		return previous, replacedIndex, err
+	}
+
+	return previous, replacedIndex, err
+}
+
+// PruneGenerations deletes the oldest index generations beyond
+// ES_GENERATIONS_KEPT and returns their names. Generations the alias points
+// to are always kept. Indices matching ES_INDEX-* whose suffix isn't a time
+// in ES_GENERATION_FORMAT aren't generations and are left alone.
+func (es *Client) PruneGenerations(ctx context.Context) (deleted []string, err error) {
+	var current []string
+	current, err = es.AliasTargets(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to read alias %s: %w", es.index, err)
+		return deleted, err
+	}
+
+	var generations []string
+	generations, err = es.Generations(ctx)
+	if err != nil {
+		return deleted, err
+	}
+
+	kept := 0
+	for _, name := range generations {
+		if kept < es.generationsKept || slices.Contains(current, name) {
+			kept++
+			continue
+		}
+
+		err = es.DeleteIndex(ctx, name)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, name)
+	}
+
+	return deleted, err
+}
+
+// Generations returns the index generations in the cluster, newest first.
+func (es *Client) Generations(ctx context.Context) (names []string, err error) {
+	var candidates []string
+	candidates, err = es.aliasIndices(ctx, fmt.Sprintf("%s/%s-*/_alias", es.host, es.index))
+	if err != nil {
+		err = fmt.Errorf("failed to list index generations: %w", err)
+		return names, err
+	}
+
+	built := make(map[string]time.Time)
+	for _, name := range candidates {
+		suffix, found := strings.CutPrefix(name, es.index+"-")
+		if !found {
+			continue
+		}
+		t, parseErr := time.Parse(es.generationFormat, suffix)
+		if parseErr != nil {
+			continue
+		}
+		built[name] = t
+		names = append(names, name)
+	}
+
+	slices.SortFunc(names, func(a string, b string) int {
+		return built[b].Compare(built[a])
+	})
+	return names, err
+}
+
+// DeleteIndex deletes the named index.
+func (es *Client) DeleteIndex(ctx context.Context, name string) (err error) {
+	_, err = es.doJSON(ctx, http.MethodDelete, fmt.Sprintf("%s/%s", es.host, name), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to delete index %s: %w", name, err)
+		return err
+	}
+	return err
+}
+
+// aliasIndices returns the index names keying a GET _alias response.
+func (es *Client) aliasIndices(ctx context.Context, url string) (indices []string, err error) {
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return indices, err
+	}
+
+	var response aliasIndices
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		err = fmt.Errorf("failed to decode aliases: %w", err)
+		return indices, err
+	}
+
+	for index := range response {
+		indices = append(indices, index)
+	}
+	slices.Sort(indices)
+	return indices, err
+}
@@ -0,0 +1,168 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCluster keeps the indices and aliases of a cluster in memory and
+// serves the requests the alias methods make.
+type fakeCluster struct {
+	mu      sync.Mutex
+	indices map[string]bool
+	aliases map[string]string
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(name, "_alias/"):
+		alias := strings.TrimPrefix(name, "_alias/")
+		index, found := c.aliases[alias]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{index: map[string]interface{}{"aliases": map[string]interface{}{alias: map[string]interface{}{}}}})
+	case r.Method == http.MethodGet && strings.HasSuffix(name, "-*/_alias"):
+		prefix := strings.TrimSuffix(name, "*/_alias")
+		matched := make(map[string]interface{})
+		for index := range c.indices {
+			if strings.HasPrefix(index, prefix) {
+				matched[index] = map[string]interface{}{"aliases": map[string]interface{}{}}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(matched)
+	case r.Method == http.MethodPost && name == "_aliases":
+		var body struct {
+			Actions []map[string]map[string]string `json:"actions"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		for _, action := range body.Actions {
+			delete(c.indices, action["remove_index"]["index"])
+			delete(c.aliases, action["remove"]["alias"])
+			added := action["add"]
+			if added != nil {
+				c.aliases[added["alias"]] = added["index"]
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodHead:
+		_, isAlias := c.aliases[name]
+		if !c.indices[name] && !isAlias {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		c.indices[name] = true
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodDelete:
+		delete(c.indices, name)
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestGenerations(t *testing.T) {
+	cluster := &fakeCluster{
+		// The index as EnsureIndex created it, and an index that only looks
+		// like a generation.
+		indices: map[string]bool{"test-index": true, "test-index-vectors": true},
+		aliases: make(map[string]string),
+	}
+	srv := httptest.NewServer(cluster)
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	client.generationFormat = "2006-01-02-150405"
+	client.generationsKept = 2
+
+	start := time.Date(2025, 1, 1, 9, 30, 0, 0, time.UTC)
+	var built []string
+	for i := range 3 {
+		name, err := client.CreateGeneration(t.Context(), start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("CreateGeneration() error = %v", err)
+		}
+
+		previous, replacedIndex, err := client.SwapAlias(t.Context(), name)
+		if err != nil {
+			t.Fatalf("SwapAlias(%s) error = %v", name, err)
+		}
+
+		// The first swap replaces the concrete index; later ones move the
+		// alias off the previous generation.
+		wantPrevious := built[max(0, len(built)-1):]
+		if replacedIndex != (i == 0) || !slices.Equal(previous, wantPrevious) {
+			t.Errorf("SwapAlias(%s) = %v, %v, want %v, %v", name, previous, replacedIndex, wantPrevious, i == 0)
+		}
+		built = append(built, name)
+	}
+
+	if built[0] != "test-index-2025-01-01-093000" {
+		t.Errorf("first generation = %q, want test-index-2025-01-01-093000", built[0])
+	}
+	if cluster.indices["test-index"] || cluster.aliases["test-index"] != built[2] {
+		t.Errorf("alias points at %q, want %q, concrete index left: %v", cluster.aliases["test-index"], built[2], cluster.indices["test-index"])
+	}
+
+	_, err := client.CreateGeneration(t.Context(), start)
+	if !errors.Is(err, ErrGenerationExists) {
+		t.Errorf("CreateGeneration() for a taken name error = %v, want ErrGenerationExists", err)
+	}
+
+	deleted, err := client.PruneGenerations(t.Context())
+	if err != nil {
+		t.Fatalf("PruneGenerations() error = %v", err)
+	}
+	if !slices.Equal(deleted, built[:1]) {
+		t.Errorf("PruneGenerations() = %v, want %v", deleted, built[:1])
+	}
+
+	remaining, err := client.Generations(t.Context())
+	if err != nil {
+		t.Fatalf("Generations() error = %v", err)
+	}
+	if !slices.Equal(remaining, []string{built[2], built[1]}) {
+		t.Errorf("Generations() = %v, want newest first %v", remaining, []string{built[2], built[1]})
+	}
+	if !cluster.indices["test-index-vectors"] {
+		t.Error("PruneGenerations() deleted an index that isn't a generation")
+	}
+}
+
+func TestPruneGenerationsKeepsAliasTarget(t *testing.T) {
+	// The alias was rolled back to the oldest generation by hand.
+	cluster := &fakeCluster{
+		indices: map[string]bool{
+			"test-index-2025-01-01-000000": true,
+			"test-index-2025-01-02-000000": true,
+			"test-index-2025-01-03-000000": true,
+		},
+		aliases: map[string]string{"test-index": "test-index-2025-01-01-000000"},
+	}
+	srv := httptest.NewServer(cluster)
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	client.generationFormat = "2006-01-02-150405"
+	client.generationsKept = 1
+
+	deleted, err := client.PruneGenerations(t.Context())
+	if err != nil {
+		t.Fatalf("PruneGenerations() error = %v", err)
+	}
+	if !slices.Equal(deleted, []string{"test-index-2025-01-02-000000"}) {
+		t.Errorf("PruneGenerations() = %v, want only the unused older generation", deleted)
+	}
+}
@@ -0,0 +1,58 @@
+package elasticsearch
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// authorize adds the configured credentials to a request: the API key when
+// one is set, else basic auth when a username is.
+func (es *Client) authorize(req *http.Request) {
+	if es.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+es.apiKey)
+		return
+	}
+
+	if es.username != "" {
+		req.SetBasicAuth(es.username, es.password)
+	}
+}
+
+// cloudIDHost resolves an Elastic Cloud ID to the deployment's Elasticsearch
+// URL. A cloud ID is the deployment name, a colon, and the base64 encoding
+// of "domain[:port]$elasticsearch-id$kibana-id"; the cluster is served at
+// https://elasticsearch-id.domain:port, port 443 unless given.
+func cloudIDHost(cloudID string) (host string, err error) {
+	_, encoded, found := strings.Cut(cloudID, ":")
+	if !found || encoded == "" {
+		err = errors.New("invalid ES_CLOUD_ID: expected <name>:<base64 data>")
+		return host, err
+	}
+
+	var decoded []byte
+	decoded, err = base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid ES_CLOUD_ID: %w", err)
+		return host, err
+	}
+
+	parts := strings.Split(string(decoded), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		err = errors.New("invalid ES_CLOUD_ID: expected domain$elasticsearch-id in the encoded data")
+		return host, err
+	}
+
+	domain, port, hasPort := strings.Cut(parts[0], ":")
+	if !hasPort {
+		port = "443"
+	}
+
+	host = "https://" + parts[1] + "." + domain + ":" + port
+	return host, err
+}
@@ -0,0 +1,79 @@
+package elasticsearch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestCloudIDHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		cloudID string
+		want    string
+		wantErr bool
+	}{
+		{name: "with port", cloudID: "code-index:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbzo5MjQzJGFiYzEyMyRkZWY0NTY=", want: "https://abc123.us-east-1.aws.found.io:9243"},
+		{name: "default port", cloudID: "code-index:ZXVyb3BlLXdlc3QxLmdjcC5jbG91ZC5lcy5pbyRlczEka2Ix", want: "https://es1.europe-west1.gcp.cloud.es.io:443"},
+		{name: "unpadded", cloudID: "code-index:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbzo5MjQzJGFiYzEyMyRkZWY0NTY", want: "https://abc123.us-east-1.aws.found.io:9243"},
+		{name: "missing name separator", cloudID: "dXMtZWFzdC0xLmF3cy5mb3VuZC5pbyRhYmMxMjM=", wantErr: true},
+		{name: "not base64", cloudID: "code-index:not base64!", wantErr: true},
+		{name: "missing elasticsearch id", cloudID: "code-index:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbw==", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cloudIDHost(tt.cloudID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cloudIDHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("cloudIDHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{name: "api key", cfg: config.Config{ESAPIKey: "aWQ6a2V5"}, want: "ApiKey aWQ6a2V5"},
+		{name: "basic auth", cfg: config.Config{ESUsername: "elastic", ESPassword: "changeme"}, want: "Basic ZWxhc3RpYzpjaGFuZ2VtZQ=="},
+		{name: "no credentials"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Authorization")
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			tt.cfg.ESHost = srv.URL
+			es, err := New(tt.cfg, nil)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			err = es.Ping()
+			if err != nil {
+				t.Fatalf("Ping() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	es, err := New(config.Config{ESCloudID: "code-index:ZXVyb3BlLXdlc3QxLmdjcC5jbG91ZC5lcy5pbyRlczEka2Ix"}, nil)
+	if err != nil || es.host != "https://es1.europe-west1.gcp.cloud.es.io:443" {
+		t.Errorf("New() with a cloud ID: host %q, error %v", es.host, err)
+	}
+}
@@ -0,0 +1,143 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+)
+
+// Backend identifies the search engine serving the index.
+type Backend string
+
+// Supported backends. BackendAuto detects the backend from the root endpoint.
+const (
+	BackendAuto          Backend = "auto"
+	BackendElasticsearch Backend = "elasticsearch"
+	BackendOpenSearch    Backend = "opensearch"
+)
+
+// ErrBackendMismatch is returned when the configured backend differs from the detected one.
+var ErrBackendMismatch = errors.New("configured backend does not match server")
+
+// rootResponse is the subset of the root endpoint response used to identify the backend.
+type rootResponse struct {
+	Version struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"`
+	} `json:"version"`
+}
+
+// ParseBackend validates a backend name. An empty name means BackendAuto.
+func ParseBackend(name string) (backend Backend, err error) {
+	backend = Backend(name)
+	switch backend {
+	case "":
+		backend = BackendAuto
+		return backend, err
+	case BackendAuto, BackendElasticsearch, BackendOpenSearch:
+		return backend, err
+	default:
+		err = fmt.Errorf("unknown backend %q (use auto, elasticsearch, or opensearch)", name)
+		return backend, err
+	}
+}
+
+// Backend returns the backend the client is connected to.
+func (es *Client) Backend() (backend Backend) {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+
+	backend = es.backend
+	return backend
+}
+
+// Version returns the server version reported at connection time.
+func (es *Client) Version() (version string) {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+
+	version = es.version
+	return version
+}
+
+// vectorCandidates is how many nearest neighbours each shard considers per
+// result wanted in a vector search.
+const vectorCandidates = 10
+
+// VectorQuery builds a k-nearest-neighbor search body for the backend.
+// Elasticsearch uses the top-level knn option; OpenSearch's k-NN plugin uses a
+// knn query clause. The filter is the body of a bool query the neighbours must
+// match, or nil to search every document.
+func (es *Client) VectorQuery(field string, vector []float32, k int, filter map[string]interface{}) (body map[string]interface{}) {
+	if es.Backend() == BackendOpenSearch {
+		clause := map[string]interface{}{
+			"knn": map[string]interface{}{
+				field: map[string]interface{}{
+					"vector": vector,
+					"k":      k,
+				},
+			},
+		}
+		if filter != nil {
+			boolQuery := maps.Clone(filter)
+			boolQuery["must"] = clause
+			clause = map[string]interface{}{"bool": boolQuery}
+		}
+		body = map[string]interface{}{
+			"size":  k,
+			"query": clause,
+		}
+		return body
+	}
+
+	knn := map[string]interface{}{
+		"field":          field,
+		"query_vector":   vector,
+		"k":              k,
+		"num_candidates": k * vectorCandidates,
+	}
+	if filter != nil {
+		knn["filter"] = map[string]interface{}{"bool": filter}
+	}
+	body = map[string]interface{}{
+		"size": k,
+		"knn":  knn,
+	}
+	return body
+}
+
+// detectBackend identifies the server from its root endpoint and checks it
+// against the configured backend.
+func (es *Client) detectBackend(ctx context.Context, configured Backend) (err error) {
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, es.host, nil)
+	if err != nil {
+		return err
+	}
+
+	var root rootResponse
+	err = json.Unmarshal(body, &root)
+	if err != nil {
+		err = fmt.Errorf("failed to decode server info: %w", err)
+		return err
+	}
+
+	detected := BackendElasticsearch
+	if root.Version.Distribution == string(BackendOpenSearch) {
+		detected = BackendOpenSearch
+	}
+
+	if configured != BackendAuto && configured != detected {
+		err = fmt.Errorf("%w: configured %s, server reports %s", ErrBackendMismatch, configured, detected)
+		return err
+	}
+
+	es.mu.Lock()
+	es.backend = detected
+	es.version = root.Version.Number
+	es.mu.Unlock()
+	return err
+}
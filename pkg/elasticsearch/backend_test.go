@@ -0,0 +1,133 @@
+package elasticsearch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectBackend(t *testing.T) {
+	tests := []struct {
+		name       string
+		root       string
+		configured Backend
+		want       Backend
+		wantErr    error
+	}{
+		{
+			name:       "elasticsearch auto",
+			root:       `{"version":{"number":"8.11.0","build_flavor":"default"}}`,
+			configured: BackendAuto,
+			want:       BackendElasticsearch,
+		},
+		{
+			name:       "opensearch auto",
+			root:       `{"version":{"distribution":"opensearch","number":"2.11.0"}}`,
+			configured: BackendAuto,
+			want:       BackendOpenSearch,
+		},
+		{
+			name:       "opensearch explicit",
+			root:       `{"version":{"distribution":"opensearch","number":"2.11.0"}}`,
+			configured: BackendOpenSearch,
+			want:       BackendOpenSearch,
+		},
+		{
+			name:       "mismatch",
+			root:       `{"version":{"number":"8.11.0"}}`,
+			configured: BackendOpenSearch,
+			wantErr:    ErrBackendMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(tt.root))
+			}))
+			defer srv.Close()
+
+			client := newTestClient(t, srv)
+			err := client.detectBackend(t.Context(), tt.configured)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("detectBackend() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("detectBackend() error = %v", err)
+			}
+			if client.Backend() != tt.want {
+				t.Errorf("Backend() = %q, want %q", client.Backend(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBackend(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Backend
+		wantErr bool
+	}{
+		{input: "", want: BackendAuto},
+		{input: "auto", want: BackendAuto},
+		{input: "elasticsearch", want: BackendElasticsearch},
+		{input: "opensearch", want: BackendOpenSearch},
+		{input: "solr", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseBackend(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBackend(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseBackend(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVectorQuery(t *testing.T) {
+	vector := []float32{0.1, 0.2}
+
+	es := &Client{backend: BackendElasticsearch}
+	body := es.VectorQuery("embedding", vector, 5, nil)
+	knn, ok := body["knn"].(map[string]interface{})
+	if !ok || knn["field"] != "embedding" || knn["num_candidates"] != 50 {
+		t.Errorf("elasticsearch VectorQuery() = %v, want top-level knn on embedding", body)
+	}
+
+	openSearch := &Client{backend: BackendOpenSearch}
+	body = openSearch.VectorQuery("embedding", vector, 5, nil)
+	query, _ := body["query"].(map[string]interface{})
+	clause, _ := query["knn"].(map[string]interface{})
+	if _, found := clause["embedding"]; !found {
+		t.Errorf("opensearch VectorQuery() = %v, want query.knn.embedding", body)
+	}
+	if _, found := body["knn"]; found {
+		t.Error("opensearch VectorQuery() has top-level knn")
+	}
+
+	filter := map[string]interface{}{"filter": []map[string]interface{}{{"term": map[string]interface{}{"repo": "api"}}}}
+	body = es.VectorQuery("embedding", vector, 5, filter)
+	knn, _ = body["knn"].(map[string]interface{})
+	if _, found := knn["filter"]; !found {
+		t.Errorf("elasticsearch VectorQuery() with a filter = %v, want knn.filter", body)
+	}
+	body = openSearch.VectorQuery("embedding", vector, 5, filter)
+	query, _ = body["query"].(map[string]interface{})
+	boolQuery, _ := query["bool"].(map[string]interface{})
+	must, _ := boolQuery["must"].(map[string]interface{})
+	if _, found := must["knn"]; !found || boolQuery["filter"] == nil {
+		t.Errorf("opensearch VectorQuery() with a filter = %v, want query.bool with knn and the filter", body)
+	}
+	if _, found := filter["must"]; found {
+		t.Error("opensearch VectorQuery() modified the filter")
+	}
+}
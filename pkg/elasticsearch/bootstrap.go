@@ -0,0 +1,73 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BootstrapOptions controls how Bootstrap retries while the cluster is
+// unreachable.
+type BootstrapOptions struct {
+	// Timeout bounds the total wait. Zero retries until the context ends.
+	Timeout time.Duration
+	// Backoff is the first wait between attempts; it doubles up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// OnRetry, if set, is called after each failed attempt.
+	OnRetry func(attempt int, wait time.Duration, err error)
+}
+
+// Bootstrap connects to the cluster, detects the backend, and ensures the
+// index exists, retrying with exponential backoff until it succeeds, the
+// timeout passes, or ctx is cancelled. A backend mismatch is not retried.
+func (es *Client) Bootstrap(ctx context.Context, opts BootstrapOptions) (err error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = es.detectBackend(ctx, es.configured)
+		if err == nil {
+			err = es.EnsureIndex(ctx)
+		}
+		if err == nil {
+			es.ready.Store(true)
+			return err
+		}
+
+		if errors.Is(err, ErrBackendMismatch) {
+			return err
+		}
+
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt, backoff, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= retryMultiplier
+		if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// Ready reports whether the client has connected to the cluster.
+func (es *Client) Ready() (ready bool) {
+	ready = es.ready.Load()
+	return ready
+}
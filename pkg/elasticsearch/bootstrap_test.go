@@ -0,0 +1,85 @@
+package elasticsearch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBootstrap(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		failures    int32
+		timeout     time.Duration
+		wantErr     error
+		wantRetries int
+	}{
+		{
+			name:        "succeeds after retries",
+			backend:     "auto",
+			failures:    2,
+			wantRetries: 2,
+		},
+		{
+			name:        "backend mismatch is not retried",
+			backend:     "opensearch",
+			wantErr:     ErrBackendMismatch,
+			wantRetries: 0,
+		},
+		{
+			name:        "gives up at timeout",
+			backend:     "auto",
+			failures:    1000,
+			timeout:     50 * time.Millisecond,
+			wantErr:     ErrBadRequest,
+			wantRetries: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rootCalls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" && rootCalls.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(`{"version":{"number":"8.15.0"}}`))
+			}))
+			defer srv.Close()
+
+			client, err := New(config.Config{ESHost: srv.URL, ESIndex: "test-index", ESBackend: tt.backend}, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			retries := 0
+			err = client.Bootstrap(t.Context(), BootstrapOptions{
+				Timeout: tt.timeout,
+				Backoff: time.Millisecond,
+				OnRetry: func(attempt int, wait time.Duration, retryErr error) {
+					retries++
+				},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Bootstrap() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantRetries >= 0 && retries != tt.wantRetries {
+				t.Errorf("retries = %d, want %d", retries, tt.wantRetries)
+			}
+
+			if client.Ready() != (tt.wantErr == nil) {
+				t.Errorf("Ready() = %v, want %v", client.Ready(), tt.wantErr == nil)
+			}
+		})
+	}
+}
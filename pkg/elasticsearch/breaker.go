@@ -0,0 +1,139 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+)
+
+// ErrCircuitOpen is returned without contacting Elasticsearch while the
+// client's circuit breaker is open. It wraps ErrUnavailable, so callers treat
+// it like any other outage.
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrUnavailable)
+
+// Circuit breaker states, as reported by the breaker state metric.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker for requests to Elasticsearch. After threshold
+// consecutive failed requests it opens and requests fail fast with
+// ErrCircuitOpen. Once cooldown has passed, a single request is let through
+// to probe the cluster: success closes the breaker, failure opens it for
+// another cooldown. A nil breaker lets every request through.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	metrics   *metrics.Metrics
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// newBreaker creates a closed breaker, or returns nil when threshold is zero.
+func newBreaker(threshold int, cooldown time.Duration, m *metrics.Metrics) (b *breaker) {
+	if threshold <= 0 {
+		return b
+	}
+
+	b = &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		metrics:   m,
+		now:       time.Now,
+	}
+	b.setState(breakerClosed)
+	return b
+}
+
+// allow reports whether a request may be sent, returning ErrCircuitOpen if
+// not. When the cooldown has passed it lets one probe through; the caller
+// must then report the request's outcome with success, failure, or abandon.
+func (b *breaker) allow() (err error) {
+	if b == nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			err = ErrCircuitOpen
+			return err
+		}
+		b.setState(breakerHalfOpen)
+	case breakerHalfOpen:
+		// A probe is already in flight.
+		err = ErrCircuitOpen
+	}
+	return err
+}
+
+// success records a request Elasticsearch answered, closing the breaker.
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+// failure records a request that failed to reach Elasticsearch or got a 5xx,
+// opening the breaker after threshold in a row or when a probe fails.
+func (b *breaker) failure() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+		if b.metrics != nil {
+			b.metrics.ESBreakerOpens.Inc()
+		}
+	}
+}
+
+// abandon records a request cancelled by its caller before Elasticsearch
+// answered. It says nothing about the cluster, so a probe is simply given up
+// and the next request probes instead.
+func (b *breaker) abandon() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.setState(breakerOpen)
+	}
+}
+
+// setState changes the state and reports it. The caller holds b.mu, except
+// in newBreaker.
+func (b *breaker) setState(state int) {
+	b.state = state
+	if b.metrics != nil {
+		b.metrics.ESBreakerState.Set(float64(state))
+	}
+}
@@ -0,0 +1,103 @@
+package elasticsearch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBreaker(t *testing.T) {
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	now := time.Unix(1000, 0)
+	b := newBreaker(2, 30*time.Second, m)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() after one failure = %v, want nil", err)
+	}
+	b.failure()
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("allow() after two failures = %v, want ErrCircuitOpen", err)
+	}
+	if got := testutil.ToFloat64(m.ESBreakerState); got != breakerOpen {
+		t.Errorf("breaker state = %v, want open", got)
+	}
+
+	// After the cooldown one probe goes through; others wait for it.
+	now = now.Add(30 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() after cooldown = %v, want probe let through", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow() during probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// A failed probe opens the breaker for another cooldown.
+	b.failure()
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow() after failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// An abandoned probe lets the next request probe instead.
+	now = now.Add(30 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() after cooldown = %v", err)
+	}
+	b.abandon()
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() after abandoned probe = %v, want probe let through", err)
+	}
+
+	b.success()
+	if err := b.allow(); err != nil {
+		t.Errorf("allow() after successful probe = %v, want nil", err)
+	}
+	if got := testutil.ToFloat64(m.ESBreakerState); got != breakerClosed {
+		t.Errorf("breaker state = %v, want closed", got)
+	}
+	if got := testutil.ToFloat64(m.ESBreakerOpens); got != 2 {
+		t.Errorf("breaker opens = %v, want 2", got)
+	}
+
+	var disabled *breaker
+	disabled.failure()
+	if err := disabled.allow(); err != nil {
+		t.Errorf("nil breaker allow() = %v, want nil", err)
+	}
+}
+
+func TestBreakerFailsFast(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	client.breaker = newBreaker(2, time.Minute, client.metrics)
+
+	err := client.IndexDocument(t.Context(), CodeDocument{Repo: "api", FunctionName: "Handle"})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("IndexDocument() error = %v, want ErrCircuitOpen", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want retries stopped once the breaker opened", got)
+	}
+
+	err = client.IndexDocument(t.Context(), CodeDocument{Repo: "api", FunctionName: "Serve"})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("IndexDocument() error = %v, want ErrCircuitOpen", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want no request while open", got)
+	}
+}
@@ -0,0 +1,150 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// bulkIndexAction is the action line sent before each document of a batch.
+// The index comes from the request URL.
+const bulkIndexAction = `{"index":{}}` + "\n"
+
+// DocumentBatch collects code documents for a bulk index request. Documents
+// are encoded as they are added, so the batch knows its size in bytes, and
+// Reset keeps the buffer for the next batch.
+type DocumentBatch struct {
+	body bytes.Buffer
+	docs []CodeDocument
+}
+
+// DocumentFailure is a document of a batch that wasn't indexed, with the
+// error for it.
+type DocumentFailure struct {
+	Document CodeDocument
+	Err      error
+}
+
+// Add encodes doc onto the batch. A document that can't be encoded isn't
+// added, and an ErrEncode error is returned.
+func (b *DocumentBatch) Add(doc CodeDocument) (err error) {
+	var data []byte
+	data, err = json.Marshal(doc)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrEncode, err)
+		return err
+	}
+
+	b.body.WriteString(bulkIndexAction)
+	b.body.Write(data)
+	b.body.WriteByte('\n')
+	b.docs = append(b.docs, doc)
+	return err
+}
+
+// Len returns how many documents the batch holds.
+func (b *DocumentBatch) Len() (n int) {
+	n = len(b.docs)
+	return n
+}
+
+// Size returns the size of the batch's request body in bytes.
+func (b *DocumentBatch) Size() (size int) {
+	size = b.body.Len()
+	return size
+}
+
+// Documents returns the documents in the batch, in the order they were added.
+func (b *DocumentBatch) Documents() (docs []CodeDocument) {
+	docs = b.docs
+	return docs
+}
+
+// Reset empties the batch, keeping its buffers.
+func (b *DocumentBatch) Reset() {
+	b.body.Reset()
+	clear(b.docs)
+	b.docs = b.docs[:0]
+}
+
+// IndexBatch indexes the batch's documents with a single bulk request. An
+// error is returned when the request as a whole fails, in which case none of
+// the documents can be assumed indexed. Otherwise the documents Elasticsearch
+// rejected are returned, each with a StatusError for its item's status. The
+// batch is left as it is.
+func (es *Client) IndexBatch(ctx context.Context, batch *DocumentBatch) (failures []DocumentFailure, err error) {
+	url := fmt.Sprintf("%s/%s/_bulk", es.host, es.index)
+
+	var req *http.Request
+	req, err = es.newBodyRequest(ctx, http.MethodPost, url, "application/x-ndjson", batch.body.Bytes())
+	if err != nil {
+		return failures, err
+	}
+
+	es.authorize(req)
+
+	var resp *http.Response
+	resp, err = es.doRequestWithRetry(req)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("bulk_index", "error").Inc()
+		err = fmt.Errorf("failed to send request: %w", err)
+		return failures, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		es.metrics.ESRequests.WithLabelValues("bulk_index", "error").Inc()
+		err = newStatusError(resp, body)
+		return failures, err
+	}
+
+	failures, err = bulkItemFailures(body, batch.docs)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("bulk_index", "error").Inc()
+		return failures, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("bulk_index", "success").Inc()
+	return failures, err
+}
+
+// bulkItemFailures pairs the failed items of a bulk response with the
+// documents they were sent for. Items come back in the order they were sent.
+func bulkItemFailures(body []byte, docs []CodeDocument) (failures []DocumentFailure, err error) {
+	var resp bulkResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode bulk response: %w", err)
+		return failures, err
+	}
+
+	if len(resp.Items) != len(docs) {
+		err = fmt.Errorf("%w: %d items in response to %d documents", ErrBulkFailed, len(resp.Items), len(docs))
+		return failures, err
+	}
+
+	if !resp.Errors {
+		return failures, err
+	}
+
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < http.StatusMultipleChoices {
+				continue
+			}
+			failures = append(failures, DocumentFailure{
+				Document: docs[i],
+				Err: &StatusError{
+					StatusCode: result.Status,
+					Status:     fmt.Sprintf("%d %s", result.Status, http.StatusText(result.Status)),
+					Body:       result.Error.Type + ": " + result.Error.Reason,
+				},
+			})
+		}
+	}
+	return failures, err
+}
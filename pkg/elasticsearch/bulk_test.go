@@ -0,0 +1,80 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIndexBatch(t *testing.T) {
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test-index/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("request = %s %s as %s, want bulk to the index", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		_, _ = w.Write([]byte(`{"errors":true,"items":[` +
+			`{"index":{"status":201}},` +
+			`{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field"}}},` +
+			`{"index":{"status":201}}]}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	batch := &DocumentBatch{}
+	for _, name := range []string{"Handle", "Serve", "Close"} {
+		err := batch.Add(CodeDocument{Repo: "api", FunctionName: name})
+		if err != nil {
+			t.Fatalf("Add(%s) error = %v", name, err)
+		}
+	}
+
+	failures, err := client.IndexBatch(t.Context(), batch)
+	if err != nil {
+		t.Fatalf("IndexBatch() error = %v", err)
+	}
+
+	if len(lines) != 6 || lines[0] != `{"index":{}}` {
+		t.Fatalf("bulk body = %q, want an action and document line per document", lines)
+	}
+	var doc CodeDocument
+	err = json.Unmarshal([]byte(lines[3]), &doc)
+	if err != nil || doc.FunctionName != "Serve" {
+		t.Errorf("second document = %q, want Serve", lines[3])
+	}
+
+	if len(failures) != 1 || failures[0].Document.FunctionName != "Serve" {
+		t.Fatalf("failures = %+v, want Serve", failures)
+	}
+	if !errors.Is(failures[0].Err, ErrBadRequest) {
+		t.Errorf("failure error = %v, want ErrBadRequest", failures[0].Err)
+	}
+
+	batch.Reset()
+	if batch.Len() != 0 || batch.Size() != 0 {
+		t.Errorf("after Reset() batch holds %d documents in %d bytes, want none", batch.Len(), batch.Size())
+	}
+}
+
+func TestIndexBatchUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	batch := &DocumentBatch{}
+	_ = batch.Add(CodeDocument{Repo: "api", FunctionName: "Handle"})
+
+	failures, err := client.IndexBatch(t.Context(), batch)
+	if !errors.Is(err, ErrBadRequest) || len(failures) != 0 {
+		t.Errorf("IndexBatch() = %v, %v, want the request's error", failures, err)
+	}
+}
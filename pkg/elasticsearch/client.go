@@ -4,11 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/nikogura/rag-indexer/pkg/config"
 	"github.com/nikogura/rag-indexer/pkg/metrics"
 )
 
@@ -18,48 +25,128 @@ const (
 	retryMultiplier = 2
 )
 
-// Client handles Elasticsearch operations.
+// Client handles Elasticsearch and OpenSearch operations.
 type Client struct {
-	host     string
-	index    string
-	username string
-	password string
-	client   *http.Client
-	metrics  *metrics.Metrics
+	host             string
+	index            string
+	indexTemplate    string
+	indexPatterns    []string
+	templatePriority int
+	schemaMigration  string
+	generationFormat string
+	generationsKept  int
+	username         string
+	password         string
+	apiKey           string
+	configured       Backend
+	ranking          string
+	fieldBoosts      map[string]float64
+	flagBoosts       map[string]float64
+	client           *http.Client
+	metrics          *metrics.Metrics
+	breaker          *breaker
+	compress         bool
+	ready            atomic.Bool
+
+	mu      sync.RWMutex
+	backend Backend
+	version string
 }
 
-// NewClient creates a new Elasticsearch client and verifies connectivity.
-func NewClient(host string, index string, username string, password string, m *metrics.Metrics) (client *Client, err error) {
+// New creates a client without contacting the server. Call Bootstrap before
+// relying on backend detection or the index existing.
+func New(cfg config.Config, m *metrics.Metrics) (client *Client, err error) {
+	var backend Backend
+	backend, err = ParseBackend(cfg.ESBackend)
+	if err != nil {
+		return client, err
+	}
+
+	host := cfg.ESHost
+	if cfg.ESCloudID != "" {
+		host, err = cloudIDHost(cfg.ESCloudID)
+		if err != nil {
+			return client, err
+		}
+	}
+
+	err = validateRelevance(cfg)
+	if err != nil {
+		return client, err
+	}
+
+	var transport *http.Transport
+	transport, err = newTransport(cfg)
+	if err != nil {
+		return client, err
+	}
+
 	client = &Client{
-		host:     host,
-		index:    index,
-		username: username,
-		password: password,
-		metrics:  m,
+		host:             host,
+		index:            cfg.ESIndex,
+		indexTemplate:    cfg.ESIndexTemplate,
+		indexPatterns:    cfg.ESIndexPatterns,
+		templatePriority: templatePriority(cfg),
+		schemaMigration:  cfg.SchemaMigration,
+		generationFormat: cfg.ESGenerationFormat,
+		generationsKept:  cfg.ESGenerationsKept,
+		username:         cfg.ESUsername,
+		password:         cfg.ESPassword,
+		apiKey:           cfg.ESAPIKey,
+		configured:       backend,
+		ranking:          cfg.SearchRanking,
+		fieldBoosts:      cfg.SearchFieldBoosts,
+		flagBoosts:       cfg.SearchFlagBoosts,
+		metrics:          m,
+		breaker:          newBreaker(cfg.ESBreakerThreshold, cfg.ESBreakerCooldown, m),
+		compress:         cfg.ESCompression,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
 	}
 
-	err = client.Ping()
+	return client, err
+}
+
+// NewClient creates a new client, verifies connectivity, and detects whether
+// the server is Elasticsearch or OpenSearch.
+func NewClient(cfg config.Config, m *metrics.Metrics) (client *Client, err error) {
+	client, err = New(cfg, m)
+	if err != nil {
+		return client, err
+	}
+
+	err = client.detectBackend(context.Background(), client.configured)
 	if err != nil {
 		client = nil
 		err = fmt.Errorf("failed to connect to Elasticsearch: %w", err)
 		return client, err
 	}
 
+	client.ready.Store(true)
 	return client, err
 }
 
-// doRequestWithRetry executes an HTTP request with exponential backoff retry for 5xx errors.
+// doRequestWithRetry executes an HTTP request with exponential backoff retry
+// for 5xx errors. Each attempt goes through the circuit breaker, so once it
+// opens the remaining attempts, and further requests, fail fast with
+// ErrCircuitOpen.
 func (es *Client) doRequestWithRetry(req *http.Request) (resp *http.Response, err error) {
 	backoff := retryBackoff
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
+		err = es.breaker.allow()
+		if err != nil {
+			resp = nil
+			return resp, err
+		}
+
 		if attempt > 0 {
 			select {
 			case <-req.Context().Done():
-				err = req.Context().Err()
+				es.breaker.abandon()
+				err = classifyTransportError(req.Context().Err())
 				return resp, err
 			case <-time.After(backoff):
 				backoff *= retryMultiplier
@@ -68,22 +155,34 @@ func (es *Client) doRequestWithRetry(req *http.Request) (resp *http.Response, er
 
 		resp, err = es.client.Do(req)
 		if err != nil {
+			if req.Context().Err() != nil {
+				es.breaker.abandon()
+			} else {
+				es.breaker.failure()
+			}
 			// Network error - retry
 			continue
 		}
 
 		// Success or client error (4xx) - don't retry
 		if resp.StatusCode < http.StatusInternalServerError {
+			es.breaker.success()
 			return resp, err
 		}
 
 		// Server error (5xx) - close body and retry
+		es.breaker.failure()
 		_ = resp.Body.Close()
 	}
 
 	// All retries exhausted
-	if err == nil && resp != nil {
-		err = fmt.Errorf("elasticsearch request failed after %d retries: status %d", maxRetries, resp.StatusCode)
+	if err != nil {
+		err = classifyTransportError(err)
+		return resp, err
+	}
+
+	if resp != nil {
+		err = fmt.Errorf("%w: request failed after %d retries: status %d", ErrUnavailable, maxRetries, resp.StatusCode)
 	}
 
 	return resp, err
@@ -97,19 +196,19 @@ func (es *Client) Ping() (err error) {
 		return err
 	}
 
-	if es.username != "" {
-		req.SetBasicAuth(es.username, es.password)
-	}
+	es.authorize(req)
 
 	var resp *http.Response
 	resp, err = es.client.Do(req)
 	if err != nil {
+		err = classifyTransportError(err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= http.StatusMultipleChoices {
-		err = fmt.Errorf("elasticsearch returned status %d", resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		err = newStatusError(resp, body)
 		return err
 	}
 
@@ -121,23 +220,19 @@ func (es *Client) IndexDocument(ctx context.Context, doc CodeDocument) (err erro
 	var data []byte
 	data, err = json.Marshal(doc)
 	if err != nil {
-		err = fmt.Errorf("failed to marshal document: %w", err)
+		err = fmt.Errorf("%w: %w", ErrEncode, err)
 		return err
 	}
 
 	url := fmt.Sprintf("%s/%s/_doc", es.host, es.index)
 
 	var req *http.Request
-	req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	req, err = es.newBodyRequest(ctx, http.MethodPost, url, "application/json", data)
 	if err != nil {
-		err = fmt.Errorf("failed to create request: %w", err)
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	if es.username != "" {
-		req.SetBasicAuth(es.username, es.password)
-	}
+	es.authorize(req)
 
 	var resp *http.Response
 	resp, err = es.doRequestWithRetry(req)
@@ -151,7 +246,7 @@ func (es *Client) IndexDocument(ctx context.Context, doc CodeDocument) (err erro
 	if resp.StatusCode >= http.StatusMultipleChoices {
 		body, _ := io.ReadAll(resp.Body)
 		es.metrics.ESRequests.WithLabelValues("index", "error").Inc()
-		err = fmt.Errorf("elasticsearch error: %s - %s", resp.Status, string(body))
+		err = newStatusError(resp, body)
 		return err
 	}
 
@@ -161,23 +256,14 @@ func (es *Client) IndexDocument(ctx context.Context, doc CodeDocument) (err erro
 
 // Search performs a search query against Elasticsearch.
 func (es *Client) Search(ctx context.Context, query string, limit int) (results []CodeDocument, err error) {
-	if limit <= 0 {
-		limit = 10
-	}
+	results, err = es.SearchWithOptions(ctx, SearchRequest{Query: query, Limit: limit})
+	return results, err
+}
 
-	searchQuery := map[string]interface{}{
-		"query": map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query":  query,
-				"fields": []string{"function_name^3", "code^2", "package"},
-			},
-		},
-		"size": limit,
-		"sort": []map[string]interface{}{
-			{"has_namedreturns": "desc"},
-			{"has_error_handling": "desc"},
-		},
-	}
+// SearchWithOptions performs a search with the request's complexity filters
+// and sort order applied.
+func (es *Client) SearchWithOptions(ctx context.Context, searchReq SearchRequest) (results []CodeDocument, err error) {
+	searchQuery := es.SearchQuery(searchReq)
 
 	var data []byte
 	data, err = json.Marshal(searchQuery)
@@ -196,9 +282,7 @@ func (es *Client) Search(ctx context.Context, query string, limit int) (results
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if es.username != "" {
-		req.SetBasicAuth(es.username, es.password)
-	}
+	es.authorize(req)
 
 	var resp *http.Response
 	resp, err = es.doRequestWithRetry(req)
@@ -212,7 +296,7 @@ func (es *Client) Search(ctx context.Context, query string, limit int) (results
 	if resp.StatusCode >= http.StatusMultipleChoices {
 		body, _ := io.ReadAll(resp.Body)
 		es.metrics.ESRequests.WithLabelValues("search", "error").Inc()
-		err = fmt.Errorf("elasticsearch error: %s - %s", resp.Status, string(body))
+		err = newStatusError(resp, body)
 		return results, err
 	}
 
@@ -225,9 +309,380 @@ func (es *Client) Search(ctx context.Context, query string, limit int) (results
 
 	es.metrics.ESRequests.WithLabelValues("search", "success").Inc()
 
+	results = searchResults(searchReq, searchResp)
+	return results, err
+}
+
+// maxDuplicates is the most copies listed in a collapsed result's
+// Duplicates.
+const maxDuplicates = 10
+
+// searchResults returns the documents a search hit, with their IDs, scores,
+// and collapsed copies, and chunks collapsed when the request asks for it.
+func searchResults(searchReq SearchRequest, searchResp SearchResponse) (results []CodeDocument) {
 	for _, hit := range searchResp.Hits.Hits {
+		hit.Source.ID = hit.ID
+		hit.Source.Score = hit.Score
+		for _, inner := range hit.InnerHits.Duplicates.Hits.Hits {
+			if inner.ID == hit.ID || len(hit.Source.Duplicates) == maxDuplicates {
+				continue
+			}
+			hit.Source.Duplicates = append(hit.Source.Duplicates, Duplicate{
+				ID:        inner.ID,
+				Repo:      inner.Source.Repo,
+				FilePath:  inner.Source.FilePath,
+				StartLine: inner.Source.StartLine,
+				EndLine:   inner.Source.EndLine,
+				Commit:    inner.Source.Commit,
+			})
+		}
 		results = append(results, hit.Source)
 	}
 
-	return results, err
+	if searchReq.CollapseChunks {
+		results = collapseChunks(results, searchReq.Limit)
+	}
+	return results
+}
+
+// collapseOverfetch is how many times the limit is fetched when collapsing
+// chunks, so enough distinct functions remain after the duplicates go.
+const collapseOverfetch = 4
+
+// collapseChunks keeps the first, best-ranked chunk of each chunked function
+// and trims the results to limit. Unchunked documents pass through.
+func collapseChunks(results []CodeDocument, limit int) (collapsed []CodeDocument) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	seen := make(map[string]bool)
+	for _, doc := range results {
+		if len(collapsed) == limit {
+			break
+		}
+
+		if doc.ChunkTotal > 0 {
+			key := doc.Repo + "\x00" + doc.FilePath + "\x00" + doc.FunctionName + "\x00" + doc.ContentHash
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		collapsed = append(collapsed, doc)
+	}
+	return collapsed
+}
+
+// callsFilter matches documents calling any of the names, either exactly as
+// recorded or, for a bare name, as a method on any receiver.
+func callsFilter(names []string) (filter map[string]interface{}) {
+	should := make([]map[string]interface{}, 0, 2*len(names))
+	for _, name := range names {
+		should = append(should,
+			map[string]interface{}{"term": map[string]interface{}{"calls": name}},
+			map[string]interface{}{"wildcard": map[string]interface{}{"calls": map[string]interface{}{"value": "*." + escapeWildcard(name)}}},
+		)
+	}
+
+	filter = map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+	return filter
+}
+
+// platformFilter matches documents without build constraints and those
+// recorded as building on the platform.
+func platformFilter(platform string) (filter map[string]interface{}) {
+	filter = map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				{"bool": map[string]interface{}{"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": "build_constraint"}}}},
+				{"term": map[string]interface{}{"platforms": platform}},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+	return filter
+}
+
+// typesFilter matches documents of any of the types. Documents indexed before
+// doc_type existed have none and count as code.
+func typesFilter(types []string) (filter map[string]interface{}) {
+	should := []map[string]interface{}{
+		{"terms": map[string]interface{}{"doc_type": types}},
+	}
+	if slices.Contains(types, DocTypeCode) {
+		should = append(should, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": "doc_type"}},
+			},
+		})
+	}
+
+	filter = map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+	return filter
+}
+
+// escapeWildcard escapes the characters a wildcard query treats specially.
+func escapeWildcard(value string) (escaped string) {
+	escaped = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`).Replace(value)
+	return escaped
+}
+
+// exemplarRankScript ranks functions with named returns first and error
+// handling second. Type, const, and var declarations have neither, so they
+// rank with the best functions instead of sinking below all of them.
+const exemplarRankScript = `if (doc['kind'].size() > 0 && doc['kind'].value != 'function' && doc['kind'].value != 'method') { return 3; }
+return (doc['has_namedreturns'].value ? 2 : 0) + (doc['has_error_handling'].value ? 1 : 0);`
+
+// preferCallsScript counts how many of the preferred calls a document makes.
+// A bare name in params.calls matches that method on any receiver.
+const preferCallsScript = `int n = 0;
+if (!doc.containsKey('calls')) { return n; }
+for (def p : params.calls) {
+  for (def c : doc['calls']) {
+    if (c == p || c.endsWith('.' + p)) { n++; break; }
+  }
+}
+return n;`
+
+// BuildSearchQuery builds the search body sent for a request. Complexity limits
+// become range filters; SortComplexity puts the simplest functions first.
+// Calls keeps only results that call one of the names, and PreferCalls ranks
+// results by how many of the names they call. Each Metadata entry becomes a
+// term filter on that enrichment field. An empty query matches every document,
+// which lets the facets describe the whole index. FieldBoosts weight the
+// matched fields. The score is multiplied by FlagBoosts unless Ranking is
+// RankingSort, which sorts on the style flags first; whatever is unset takes
+// the defaults. CollapseDuplicates collapses hits on normalized_hash, with
+// the other copies as inner hits.
+func BuildSearchQuery(req SearchRequest) (searchQuery map[string]interface{}) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	if req.CollapseChunks {
+		limit *= collapseOverfetch
+	}
+
+	query := map[string]interface{}{
+		"multi_match": map[string]interface{}{
+			"query":  req.Query,
+			"fields": matchFields(req.FieldBoosts),
+		},
+	}
+	if req.Query == "" {
+		query = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+
+	filters := searchFilters(req)
+	if len(filters) > 0 {
+		query = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   query,
+				"filter": filters,
+			},
+		}
+	}
+
+	if req.Ranking != RankingSort {
+		query = flagBoostQuery(query, req.FlagBoosts)
+	}
+
+	searchQuery = map[string]interface{}{
+		"query": query,
+		"size":  limit,
+		"_source": map[string]interface{}{
+			"excludes": []string{EmbeddingField},
+		},
+		"sort": searchSortOrder(req),
+	}
+	if req.CollapseDuplicates {
+		searchQuery["collapse"] = map[string]interface{}{
+			"field": "normalized_hash",
+			// The copy collapsed into is among the inner hits, so one more
+			// is fetched to leave maxDuplicates others.
+			"inner_hits": map[string]interface{}{
+				"name":    "duplicates",
+				"size":    maxDuplicates + 1,
+				"_source": []string{"repo", "file_path", "start_line", "end_line", "commit"},
+			},
+		}
+	}
+	return searchQuery
+}
+
+// searchFilters builds the filter clauses of a search request: its
+// complexity limits, the fields it restricts to given values, and its
+// metadata terms.
+func searchFilters(req SearchRequest) (filters []map[string]interface{}) {
+	if req.MaxCyclomaticComplexity > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"cyclomatic_complexity": map[string]interface{}{"lte": req.MaxCyclomaticComplexity}},
+		})
+	}
+	if req.MaxCognitiveComplexity > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"cognitive_complexity": map[string]interface{}{"lte": req.MaxCognitiveComplexity}},
+		})
+	}
+	if len(req.Types) > 0 {
+		filters = append(filters, typesFilter(req.Types))
+	}
+	if len(req.Kinds) > 0 {
+		filters = append(filters, map[string]interface{}{
+			"terms": map[string]interface{}{"kind": req.Kinds},
+		})
+	}
+	if len(req.Calls) > 0 {
+		filters = append(filters, callsFilter(req.Calls))
+	}
+	if req.Platform != "" {
+		filters = append(filters, platformFilter(req.Platform))
+	}
+	if req.ExportedOnly {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"exported": true},
+		})
+	}
+	if req.ExcludeDeprecated {
+		filters = append(filters, map[string]interface{}{
+			"bool": map[string]interface{}{"must_not": map[string]interface{}{"term": map[string]interface{}{"deprecated": true}}},
+		})
+	}
+	for _, terms := range []struct {
+		field  string
+		values []string
+	}{
+		{"repo", req.Repos},
+		{"package", req.Packages},
+		{"imports", req.Imports},
+		{"module", req.Modules},
+		{"dependencies", req.Dependencies},
+		{"implements", req.Implements},
+	} {
+		if len(terms.values) > 0 {
+			filters = append(filters, map[string]interface{}{
+				"terms": map[string]interface{}{terms.field: terms.values},
+			})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(req.Metadata)) {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"metadata." + key: req.Metadata[key]},
+		})
+	}
+	return filters
+}
+
+// searchSortOrder builds the sort of a search request. The number of
+// PreferCalls made sorts first, then the complexities with SortComplexity,
+// then the style flags with RankingSort, and the score last.
+func searchSortOrder(req SearchRequest) (sortOrder []map[string]interface{}) {
+	sortOrder = []map[string]interface{}{
+		{"_score": "desc"},
+	}
+	if req.Ranking == RankingSort {
+		sortOrder = append([]map[string]interface{}{
+			{"_script": map[string]interface{}{
+				"type":  "number",
+				"order": "desc",
+				"script": map[string]interface{}{
+					"lang":   "painless",
+					"source": exemplarRankScript,
+				},
+			}},
+		}, sortOrder...)
+	}
+	if req.Sort == SortComplexity {
+		sortOrder = append([]map[string]interface{}{
+			{"cognitive_complexity": "asc"},
+			{"cyclomatic_complexity": "asc"},
+		}, sortOrder...)
+	}
+	if len(req.PreferCalls) > 0 {
+		sortOrder = append([]map[string]interface{}{
+			{"_script": map[string]interface{}{
+				"type":  "number",
+				"order": "desc",
+				"script": map[string]interface{}{
+					"lang":   "painless",
+					"source": preferCallsScript,
+					"params": map[string]interface{}{"calls": req.PreferCalls},
+				},
+			}},
+		}, sortOrder...)
+	}
+	return sortOrder
+}
+
+// WarmUp runs each query once to prime Elasticsearch caches. Failed queries
+// don't stop the rest; their errors are joined into the returned error.
+func (es *Client) WarmUp(ctx context.Context, queries []string) (err error) {
+	var errs []error
+	for _, query := range queries {
+		_, searchErr := es.Search(ctx, query, 10)
+		if searchErr != nil {
+			errs = append(errs, fmt.Errorf("warm-up query %q: %w", query, searchErr))
+		}
+	}
+
+	err = errors.Join(errs...)
+	return err
+}
+
+// doJSON sends an optional JSON payload with retries and returns the response
+// body, treating non-2xx statuses as errors.
+func (es *Client) doJSON(ctx context.Context, method string, url string, payload any) (body []byte, err error) {
+	var reqBody io.Reader
+	if payload != nil {
+		var data []byte
+		data, err = json.Marshal(payload)
+		if err != nil {
+			err = fmt.Errorf("failed to marshal request: %w", err)
+			return body, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		err = fmt.Errorf("failed to create request: %w", err)
+		return body, err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	es.authorize(req)
+
+	var resp *http.Response
+	resp, err = es.doRequestWithRetry(req)
+	if err != nil {
+		return body, err
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read response: %w", err)
+		return body, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		err = newStatusError(resp, body)
+		return body, err
+	}
+
+	return body, err
 }
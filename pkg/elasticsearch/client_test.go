@@ -0,0 +1,278 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestClient returns a client pointed at the given test server with isolated metrics.
+func newTestClient(t *testing.T, srv *httptest.Server) (client *Client) {
+	t.Helper()
+
+	client = &Client{
+		host:    srv.URL,
+		index:   "test-index",
+		client:  srv.Client(),
+		metrics: metrics.NewWithRegisterer(prometheus.NewRegistry()),
+	}
+	return client
+}
+
+func TestWarmUp(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		query, _ := body["query"].(map[string]any)
+		scored, _ := query["function_score"].(map[string]any)
+		query, _ = scored["query"].(map[string]any)
+		match, _ := query["multi_match"].(map[string]any)
+		text, _ := match["query"].(string)
+		queries = append(queries, text)
+
+		if text == "broken" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"hits":{"hits":[]}}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+
+	err := client.WarmUp(t.Context(), []string{"http handler", "broken", "context timeout"})
+	if err == nil {
+		t.Fatal("WarmUp() error = nil, want error for failed query")
+	}
+
+	if len(queries) != 3 {
+		t.Errorf("queries run = %d, want 3", len(queries))
+	}
+
+	err = client.WarmUp(t.Context(), []string{"http handler"})
+	if err != nil {
+		t.Errorf("WarmUp() error = %v", err)
+	}
+}
+
+func TestCollapseChunks(t *testing.T) {
+	results := []CodeDocument{
+		{Repo: "api", FilePath: "gen.go", FunctionName: "Big", ContentHash: "a", ChunkIndex: 2, ChunkTotal: 3},
+		{Repo: "api", FilePath: "h.go", FunctionName: "Handle"},
+		{Repo: "api", FilePath: "gen.go", FunctionName: "Big", ContentHash: "a", ChunkIndex: 1, ChunkTotal: 3},
+		{Repo: "api", FilePath: "gen.go", FunctionName: "Other", ContentHash: "b", ChunkIndex: 1, ChunkTotal: 2},
+		{Repo: "api", FilePath: "s.go", FunctionName: "Serve"},
+	}
+
+	got := collapseChunks(results, 3)
+
+	want := []string{"Big", "Handle", "Other"}
+	if len(got) != len(want) {
+		t.Fatalf("collapseChunks() = %d results, want %d", len(got), len(want))
+	}
+	for i, name := range want {
+		if got[i].FunctionName != name {
+			t.Errorf("result %d = %s, want %s", i, got[i].FunctionName, name)
+		}
+	}
+	if got[0].ChunkIndex != 2 {
+		t.Errorf("kept chunk %d, want the best-ranked chunk 2", got[0].ChunkIndex)
+	}
+}
+
+func TestSearchResultsDuplicates(t *testing.T) {
+	req := SearchRequest{Query: "retry", CollapseDuplicates: true}
+
+	collapse, ok := BuildSearchQuery(req)["collapse"].(map[string]interface{})
+	if !ok || collapse["field"] != "normalized_hash" {
+		t.Fatalf("collapse = %v, want a collapse on normalized_hash", collapse)
+	}
+
+	var resp SearchResponse
+	err := json.Unmarshal([]byte(`{"hits":{"hits":[{"_id":"a","_score":3,"_source":{"repo":"api","function_name":"Retry"},
+		"inner_hits":{"duplicates":{"hits":{"hits":[
+			{"_id":"a","_source":{"repo":"api","file_path":"retry.go"}},
+			{"_id":"b","_source":{"repo":"fork","file_path":"vendor/retry.go","start_line":3,"end_line":9,"commit":"abc123"}}]}}}}]}}`), &resp)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	results := searchResults(req, resp)
+
+	if len(results) != 1 {
+		t.Fatalf("results = %d, want 1", len(results))
+	}
+	want := []Duplicate{{ID: "b", Repo: "fork", FilePath: "vendor/retry.go", StartLine: 3, EndLine: 9, Commit: "abc123"}}
+	if len(results[0].Duplicates) != 1 || results[0].Duplicates[0] != want[0] {
+		t.Errorf("Duplicates = %+v, want %+v without the result itself", results[0].Duplicates, want)
+	}
+}
+
+func TestBuildSearchQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         SearchRequest
+		wantFilters int
+		wantFirst   string
+	}{
+		{
+			name:        "defaults",
+			req:         SearchRequest{Query: "handler"},
+			wantFilters: 0,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "kinds",
+			req:         SearchRequest{Query: "handler", Kinds: []string{KindType, KindInterface}},
+			wantFilters: 1,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "markdown sections",
+			req:         SearchRequest{Query: "runbook", Types: []string{DocTypeMarkdown}, Kinds: []string{KindSection}},
+			wantFilters: 2,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "facet drill-down",
+			req:         SearchRequest{Query: "handler", Repos: []string{"api"}, Packages: []string{"server"}, Imports: []string{"net/http"}},
+			wantFilters: 3,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "implements",
+			req:         SearchRequest{Query: "reader", Implements: []string{"io.Reader"}},
+			wantFilters: 1,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "platform",
+			req:         SearchRequest{Query: "poll", Platform: "linux/amd64"},
+			wantFilters: 1,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "exported only",
+			req:         SearchRequest{Query: "client", ExportedOnly: true},
+			wantFilters: 1,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "exclude deprecated",
+			req:         SearchRequest{Query: "client", ExportedOnly: true, ExcludeDeprecated: true},
+			wantFilters: 2,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "module and dependency filters",
+			req:         SearchRequest{Query: "pool", Modules: []string{"example.com/api"}, Dependencies: []string{"github.com/jackc/pgx/v5"}},
+			wantFilters: 2,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "metadata",
+			req:         SearchRequest{Query: "handler", Metadata: map[string]string{"team": "payments", "tier": "1"}},
+			wantFilters: 2,
+			wantFirst:   "_score",
+		},
+		{
+			name:        "complexity filters and sort",
+			req:         SearchRequest{Query: "handler", MaxCyclomaticComplexity: 10, MaxCognitiveComplexity: 15, Sort: SortComplexity},
+			wantFilters: 2,
+			wantFirst:   "cognitive_complexity",
+		},
+		{
+			name:        "calls filter and preference ahead of complexity sort",
+			req:         SearchRequest{Query: "handler", Calls: []string{"http.Get"}, PreferCalls: []string{"Close"}, Sort: SortComplexity},
+			wantFilters: 1,
+			wantFirst:   "_script",
+		},
+		{
+			name:        "compatibility sort on the style flags",
+			req:         SearchRequest{Query: "handler", Kinds: []string{KindFunction}, Ranking: RankingSort},
+			wantFilters: 1,
+			wantFirst:   "_script",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(BuildSearchQuery(tt.req))
+			if err != nil {
+				t.Fatalf("Failed to marshal query: %v", err)
+			}
+
+			type matchQuery struct {
+				MultiMatch map[string]any `json:"multi_match"`
+				Bool       struct {
+					Filter []map[string]any `json:"filter"`
+				} `json:"bool"`
+			}
+			var body struct {
+				Size  int `json:"size"`
+				Query struct {
+					matchQuery
+					FunctionScore *struct {
+						Query matchQuery `json:"query"`
+					} `json:"function_score"`
+				} `json:"query"`
+				Sort []map[string]any `json:"sort"`
+			}
+			err = json.Unmarshal(data, &body)
+			if err != nil {
+				t.Fatalf("Failed to decode query: %v", err)
+			}
+
+			query := body.Query.matchQuery
+			if body.Query.FunctionScore != nil {
+				query = body.Query.FunctionScore.Query
+			}
+			if (body.Query.FunctionScore == nil) != (tt.req.Ranking == RankingSort) {
+				t.Errorf("function_score present = %v, want it unless sort ranking", body.Query.FunctionScore != nil)
+			}
+
+			if body.Size != 10 {
+				t.Errorf("size = %d, want 10", body.Size)
+			}
+			if len(query.Bool.Filter) != tt.wantFilters {
+				t.Errorf("filters = %d, want %d", len(query.Bool.Filter), tt.wantFilters)
+			}
+			if tt.wantFilters == 0 && query.MultiMatch == nil {
+				t.Error("query is not a bare multi_match")
+			}
+			_, ok := body.Sort[0][tt.wantFirst]
+			if !ok {
+				t.Errorf("first sort = %v, want %s", body.Sort[0], tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestTypesFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		types      []string
+		wantClause int
+	}{
+		{name: "markdown only", types: []string{DocTypeMarkdown}, wantClause: 1},
+		{name: "code matches untyped documents", types: []string{DocTypeCode}, wantClause: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := typesFilter(tt.types)
+			should, ok := filter["bool"].(map[string]interface{})["should"].([]map[string]interface{})
+			if !ok {
+				t.Fatalf("typesFilter() = %v, want a bool should", filter)
+			}
+			if len(should) != tt.wantClause {
+				t.Errorf("should clauses = %d, want %d", len(should), tt.wantClause)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Cluster health statuses reported by Elasticsearch.
+const (
+	HealthGreen  = "green"
+	HealthYellow = "yellow"
+	HealthRed    = "red"
+)
+
+// ClusterHealth is the subset of the _cluster/health response used by the indexer.
+type ClusterHealth struct {
+	Status             string `json:"status"`
+	NumberOfNodes      int    `json:"number_of_nodes"`
+	ActiveShards       int    `json:"active_shards"`
+	UnassignedShards   int    `json:"unassigned_shards"`
+	NumberPendingTasks int    `json:"number_of_pending_tasks"`
+}
+
+// nodesStatsResponse is the subset of the _nodes/stats/os response used by the indexer.
+type nodesStatsResponse struct {
+	Nodes map[string]struct {
+		OS struct {
+			CPU struct {
+				Percent int `json:"percent"`
+			} `json:"cpu"`
+		} `json:"os"`
+	} `json:"nodes"`
+}
+
+// ClusterHealth returns the cluster health status.
+func (es *Client) ClusterHealth(ctx context.Context) (health ClusterHealth, err error) {
+	url := es.host + "/_cluster/health"
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("cluster_health", "error").Inc()
+		err = fmt.Errorf("failed to get cluster health: %w", err)
+		return health, err
+	}
+
+	err = json.Unmarshal(body, &health)
+	if err != nil {
+		err = fmt.Errorf("failed to decode cluster health: %w", err)
+		return health, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("cluster_health", "success").Inc()
+	return health, err
+}
+
+// MaxNodeCPUPercent returns the highest OS CPU usage reported by any node.
+func (es *Client) MaxNodeCPUPercent(ctx context.Context) (percent int, err error) {
+	url := es.host + "/_nodes/stats/os"
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("nodes_stats", "error").Inc()
+		err = fmt.Errorf("failed to get node stats: %w", err)
+		return percent, err
+	}
+
+	var stats nodesStatsResponse
+	err = json.Unmarshal(body, &stats)
+	if err != nil {
+		err = fmt.Errorf("failed to decode node stats: %w", err)
+		return percent, err
+	}
+
+	for _, node := range stats.Nodes {
+		percent = max(percent, node.OS.CPU.Percent)
+	}
+
+	es.metrics.ESRequests.WithLabelValues("nodes_stats", "success").Inc()
+	return percent, err
+}
@@ -0,0 +1,58 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// gzipMinBytes is the smallest request body worth compressing; below it the
+// gzip header outweighs the savings.
+const gzipMinBytes = 1024
+
+// newBodyRequest creates a request sending data as contentType. With
+// ES_COMPRESSION on, a body of gzipMinBytes or more is gzipped and sent with
+// Content-Encoding: gzip. Responses are requested gzipped either way: the
+// transport sends Accept-Encoding: gzip and decompresses transparently.
+func (es *Client) newBodyRequest(ctx context.Context, method string, url string, contentType string, data []byte) (req *http.Request, err error) {
+	encoding := ""
+	if es.compress && len(data) >= gzipMinBytes {
+		data, err = gzipBody(data)
+		if err != nil {
+			return req, err
+		}
+		encoding = "gzip"
+	}
+
+	req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("failed to create request: %w", err)
+		return req, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	return req, err
+}
+
+// gzipBody returns data gzip-compressed.
+func gzipBody(data []byte) (compressed []byte, err error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+
+	_, err = zw.Write(data)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to compress request: %w", err)
+		return compressed, err
+	}
+
+	compressed = buf.Bytes()
+	return compressed, err
+}
@@ -0,0 +1,64 @@
+package elasticsearch
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIndexDocumentCompression(t *testing.T) {
+	var encodings []string
+	var names []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+
+		var doc CodeDocument
+		err := json.NewDecoder(body).Decode(&doc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		names = append(names, doc.FunctionName)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	large := CodeDocument{Repo: "api", FunctionName: "Large", Code: strings.Repeat("x := 1\n", 500)}
+	small := CodeDocument{Repo: "api", FunctionName: "Small", Code: "return"}
+
+	err := client.IndexDocument(t.Context(), large)
+	if err != nil {
+		t.Fatalf("IndexDocument() error = %v", err)
+	}
+
+	client.compress = true
+	for _, doc := range []CodeDocument{large, small} {
+		err = client.IndexDocument(t.Context(), doc)
+		if err != nil {
+			t.Fatalf("IndexDocument(%s) error = %v", doc.FunctionName, err)
+		}
+	}
+
+	wantEncodings := []string{"", "gzip", ""}
+	wantNames := []string{"Large", "Large", "Small"}
+	for i := range wantEncodings {
+		if encodings[i] != wantEncodings[i] || names[i] != wantNames[i] {
+			t.Errorf("request %d = %q with Content-Encoding %q, want %q with %q", i, names[i], encodings[i], wantNames[i], wantEncodings[i])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DeleteFileDocuments deletes every document indexed from one file of a
+// repository, returning how many were removed. The index is refreshed so the
+// removal is visible to the next search.
+func (es *Client) DeleteFileDocuments(ctx context.Context, repo string, filePath string) (deleted int64, err error) {
+	deleted, err = es.deleteByQuery(ctx, "delete_file", map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				{"term": map[string]interface{}{"repo": repo}},
+				{"term": map[string]interface{}{"file_path": filePath}},
+			},
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to delete documents of %s: %w", filePath, err)
+	}
+	return deleted, err
+}
+
+// DeleteRepoDocuments deletes every document indexed from a repository,
+// returning how many were removed.
+func (es *Client) DeleteRepoDocuments(ctx context.Context, repo string) (deleted int64, err error) {
+	deleted, err = es.deleteByQuery(ctx, "delete_repo", map[string]interface{}{
+		"term": map[string]interface{}{"repo": repo},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to delete documents of %s: %w", repo, err)
+	}
+	return deleted, err
+}
+
+// DeleteDocumentsIndexedBefore deletes every document whose indexed_at is
+// before cutoff, returning how many were removed. Documents without
+// indexed_at are kept.
+func (es *Client) DeleteDocumentsIndexedBefore(ctx context.Context, cutoff time.Time) (deleted int64, err error) {
+	deleted, err = es.deleteByQuery(ctx, "delete_stale", map[string]interface{}{
+		"range": map[string]interface{}{
+			"indexed_at": map[string]interface{}{"lt": cutoff.UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to delete documents indexed before %s: %w", cutoff.UTC().Format(time.RFC3339), err)
+	}
+	return deleted, err
+}
+
+// touchScript stamps a document as indexed again at a commit.
+const touchScript = `ctx._source.indexed_at = params.indexed_at; ctx._source.commit = params.commit`
+
+// TouchFileDocuments stamps the documents of a repository's files with a new
+// indexed_at and commit without reindexing them, for files that haven't
+// changed since they were indexed, so retention doesn't prune them. It
+// returns how many were updated.
+func (es *Client) TouchFileDocuments(ctx context.Context, repo string, filePaths []string, commit string, at time.Time) (updated int64, err error) {
+	url := fmt.Sprintf("%s/%s/_update_by_query?conflicts=proceed", es.host, es.index)
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, url, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{
+					{"term": map[string]interface{}{"repo": repo}},
+					{"terms": map[string]interface{}{"file_path": filePaths}},
+				},
+			},
+		},
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": touchScript,
+			"params": map[string]interface{}{"indexed_at": at.UTC().Format(time.RFC3339), "commit": commit},
+		},
+	})
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("touch_files", "error").Inc()
+		err = fmt.Errorf("failed to touch documents of %s: %w", repo, err)
+		return updated, err
+	}
+	es.metrics.ESRequests.WithLabelValues("touch_files", "success").Inc()
+
+	var resp struct {
+		Updated int64 `json:"updated"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return updated, err
+	}
+
+	updated = resp.Updated
+	return updated, err
+}
+
+// deleteByQuery deletes the documents matching query, recording the request
+// under op, and returns how many were removed.
+func (es *Client) deleteByQuery(ctx context.Context, op string, query map[string]interface{}) (deleted int64, err error) {
+	url := fmt.Sprintf("%s/%s/_delete_by_query?conflicts=proceed&refresh=true", es.host, es.index)
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, url, map[string]interface{}{"query": query})
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues(op, "error").Inc()
+		return deleted, err
+	}
+	es.metrics.ESRequests.WithLabelValues(op, "success").Inc()
+
+	var resp struct {
+		Deleted int64 `json:"deleted"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return deleted, err
+	}
+
+	deleted = resp.Deleted
+	return deleted, err
+}
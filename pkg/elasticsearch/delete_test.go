@@ -0,0 +1,146 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeleteFileDocuments(t *testing.T) {
+	var body struct {
+		Query struct {
+			Bool struct {
+				Filter []map[string]map[string]string `json:"filter"`
+			} `json:"bool"`
+		} `json:"query"`
+	}
+	var path, refresh string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		refresh = r.URL.Query().Get("refresh")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"deleted":3}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	deleted, err := client.DeleteFileDocuments(t.Context(), "api", "/repos/api/main.go")
+	if err != nil {
+		t.Fatalf("DeleteFileDocuments() error = %v", err)
+	}
+
+	if deleted != 3 {
+		t.Errorf("deleted = %d, want 3", deleted)
+	}
+	if path != "/test-index/_delete_by_query" {
+		t.Errorf("path = %s, want /test-index/_delete_by_query", path)
+	}
+	if refresh != "true" {
+		t.Errorf("refresh = %q, want true", refresh)
+	}
+
+	terms := make(map[string]string)
+	for _, filter := range body.Query.Bool.Filter {
+		for field, value := range filter["term"] {
+			terms[field] = value
+		}
+	}
+	if terms["repo"] != "api" || terms["file_path"] != "/repos/api/main.go" {
+		t.Errorf("terms = %v, want repo api and file_path /repos/api/main.go", terms)
+	}
+}
+
+func TestDeleteRepoDocuments(t *testing.T) {
+	var body struct {
+		Query struct {
+			Term map[string]string `json:"term"`
+		} `json:"query"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"deleted":42}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	deleted, err := client.DeleteRepoDocuments(t.Context(), "api")
+	if err != nil {
+		t.Fatalf("DeleteRepoDocuments() error = %v", err)
+	}
+
+	if deleted != 42 {
+		t.Errorf("deleted = %d, want 42", deleted)
+	}
+	if body.Query.Term["repo"] != "api" {
+		t.Errorf("term = %v, want repo api", body.Query.Term)
+	}
+}
+
+func TestDeleteDocumentsIndexedBefore(t *testing.T) {
+	var body struct {
+		Query struct {
+			Range map[string]map[string]string `json:"range"`
+		} `json:"query"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"deleted":12}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	cutoff := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	deleted, err := client.DeleteDocumentsIndexedBefore(t.Context(), cutoff)
+	if err != nil {
+		t.Fatalf("DeleteDocumentsIndexedBefore() error = %v", err)
+	}
+
+	if deleted != 12 {
+		t.Errorf("deleted = %d, want 12", deleted)
+	}
+	if got := body.Query.Range["indexed_at"]["lt"]; got != "2026-01-02T03:04:05Z" {
+		t.Errorf("indexed_at lt = %q, want 2026-01-02T03:04:05Z", got)
+	}
+}
+
+func TestTouchFileDocuments(t *testing.T) {
+	var body struct {
+		Query struct {
+			Bool struct {
+				Filter []map[string]map[string]interface{} `json:"filter"`
+			} `json:"bool"`
+		} `json:"query"`
+		Script struct {
+			Params map[string]string `json:"params"`
+		} `json:"script"`
+	}
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"updated":7}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	at := time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)
+	updated, err := client.TouchFileDocuments(t.Context(), "api", []string{"/repos/api/a.go", "/repos/api/b.go"}, "4f9c2e1", at)
+	if err != nil {
+		t.Fatalf("TouchFileDocuments() error = %v", err)
+	}
+
+	if updated != 7 {
+		t.Errorf("updated = %d, want 7", updated)
+	}
+	if path != "/test-index/_update_by_query" {
+		t.Errorf("path = %s, want /test-index/_update_by_query", path)
+	}
+	if len(body.Query.Bool.Filter) != 2 || body.Query.Bool.Filter[0]["term"]["repo"] != "api" || len(body.Query.Bool.Filter[1]["terms"]["file_path"].([]interface{})) != 2 {
+		t.Errorf("filter = %v, want repo api and both files", body.Query.Bool.Filter)
+	}
+	if body.Script.Params["indexed_at"] != "2025-11-03T09:00:00Z" || body.Script.Params["commit"] != "4f9c2e1" {
+		t.Errorf("params = %v, want indexed_at and commit", body.Script.Params)
+	}
+}
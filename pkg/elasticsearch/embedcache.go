@@ -0,0 +1,186 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// embeddingCacheMapping maps only the model and time of cached vectors; the
+// vectors themselves are kept in _source and never searched.
+const embeddingCacheMapping = `{
+  "mappings": {
+    "dynamic": false,
+    "properties": {
+      "model": {"type": "keyword"},
+      "cached_at": {"type": "date"}
+    }
+  }
+}`
+
+// EmbeddingCache keeps embedding vectors in a dedicated index, keyed by a
+// hash of the model and the embedded text, so they outlive the process.
+type EmbeddingCache struct {
+	es      *Client
+	index   string
+	created atomic.Bool
+}
+
+// cachedEmbedding is a document of the embedding cache index.
+type cachedEmbedding struct {
+	Model    string    `json:"model"`
+	Vector   []float32 `json:"vector"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// EmbeddingCache returns the embedding cache kept in index, which is created
+// on first write.
+func (es *Client) EmbeddingCache(index string) (cache *EmbeddingCache) {
+	cache = &EmbeddingCache{es: es, index: index}
+	return cache
+}
+
+// Vectors returns the cached vectors of the ids found, keyed by id. Before
+// the index is created nothing is found.
+func (c *EmbeddingCache) Vectors(ctx context.Context, ids []string) (vectors map[string][]float32, err error) {
+	vectors = make(map[string][]float32, len(ids))
+	if len(ids) == 0 {
+		return vectors, err
+	}
+
+	var body []byte
+	body, err = c.es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_mget", c.es.host, c.index), map[string]interface{}{"ids": ids})
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		err = nil
+		return vectors, err
+	}
+	if err != nil {
+		c.es.metrics.ESRequests.WithLabelValues("embedding_cache_get", "error").Inc()
+		err = fmt.Errorf("failed to read embedding cache %s: %w", c.index, err)
+		return vectors, err
+	}
+	c.es.metrics.ESRequests.WithLabelValues("embedding_cache_get", "success").Inc()
+
+	var resp struct {
+		Docs []struct {
+			ID     string          `json:"_id"`
+			Found  bool            `json:"found"`
+			Source cachedEmbedding `json:"_source"`
+		} `json:"docs"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode embedding cache response: %w", err)
+		return vectors, err
+	}
+
+	for _, doc := range resp.Docs {
+		if doc.Found && len(doc.Source.Vector) > 0 {
+			vectors[doc.ID] = doc.Source.Vector
+		}
+	}
+	return vectors, err
+}
+
+// Put caches vectors the model produced, keyed by id, creating the index
+// first if needed.
+func (c *EmbeddingCache) Put(ctx context.Context, model string, vectors map[string][]float32) (err error) {
+	if len(vectors) == 0 {
+		return err
+	}
+
+	err = c.ensureIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var body bytes.Buffer
+	for id, vector := range vectors {
+		for _, line := range []interface{}{
+			map[string]interface{}{"index": map[string]string{"_index": c.index, "_id": id}},
+			cachedEmbedding{Model: model, Vector: vector, CachedAt: now},
+		} {
+			var data []byte
+			data, err = json.Marshal(line)
+			if err != nil {
+				err = fmt.Errorf("failed to marshal bulk line: %w", err)
+				return err
+			}
+			body.Write(data)
+			body.WriteByte('\n')
+		}
+	}
+
+	var req *http.Request
+	req, err = c.es.newBodyRequest(ctx, http.MethodPost, c.es.host+"/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	c.es.authorize(req)
+
+	var resp *http.Response
+	resp, err = c.es.doRequestWithRetry(req)
+	if err != nil {
+		c.es.metrics.ESRequests.WithLabelValues("embedding_cache_put", "error").Inc()
+		err = fmt.Errorf("failed to write embedding cache %s: %w", c.index, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		c.es.metrics.ESRequests.WithLabelValues("embedding_cache_put", "error").Inc()
+		err = fmt.Errorf("failed to write embedding cache %s: %w", c.index, newStatusError(resp, respBody))
+		return err
+	}
+
+	err = bulkItemsError(respBody)
+	if err != nil {
+		c.es.metrics.ESRequests.WithLabelValues("embedding_cache_put", "error").Inc()
+		return err
+	}
+
+	c.es.metrics.ESRequests.WithLabelValues("embedding_cache_put", "success").Inc()
+	return err
+}
+
+// ensureIndex creates the cache index unless it exists, checking once per
+// process.
+func (c *EmbeddingCache) ensureIndex(ctx context.Context) (err error) {
+	if c.created.Load() {
+		return err
+	}
+
+	var exists bool
+	exists, err = c.es.indexExists(ctx, c.index)
+	if err != nil {
+		err = fmt.Errorf("failed to check if index exists: %w", err)
+		return err
+	}
+
+	if !exists {
+		_, err = c.es.doJSON(ctx, http.MethodPut, fmt.Sprintf("%s/%s", c.es.host, c.index), json.RawMessage(embeddingCacheMapping))
+		// Another process may have created it since the check.
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusBadRequest && strings.Contains(statusErr.Body, "resource_already_exists_exception") {
+			err = nil
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to create embedding cache index %s: %w", c.index, err)
+			return err
+		}
+	}
+
+	c.created.Store(true)
+	return err
+}
@@ -0,0 +1,110 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestEmbeddingCache(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	stored := map[string]cachedEmbedding{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/_bulk":
+			scanner := bufio.NewScanner(r.Body)
+			scanner.Buffer(nil, 1<<20)
+			for scanner.Scan() {
+				var action struct {
+					Index struct {
+						Index string `json:"_index"`
+						ID    string `json:"_id"`
+					} `json:"index"`
+				}
+				_ = json.Unmarshal(scanner.Bytes(), &action)
+				scanner.Scan()
+				var doc cachedEmbedding
+				_ = json.Unmarshal(scanner.Bytes(), &doc)
+				if action.Index.Index != "embedding-cache" {
+					t.Errorf("bulk index = %s, want embedding-cache", action.Index.Index)
+				}
+				stored[action.Index.ID] = doc
+			}
+			_, _ = w.Write([]byte(`{"errors":false,"items":[]}`))
+		case r.URL.Path == "/embedding-cache/_mget":
+			var body struct {
+				IDs []string `json:"ids"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			type doc struct {
+				ID     string          `json:"_id"`
+				Found  bool            `json:"found"`
+				Source cachedEmbedding `json:"_source"`
+			}
+			var resp struct {
+				Docs []doc `json:"docs"`
+			}
+			for _, id := range body.IDs {
+				cached, found := stored[id]
+				resp.Docs = append(resp.Docs, doc{ID: id, Found: found, Source: cached})
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	cache := newTestClient(t, srv).EmbeddingCache("embedding-cache")
+	err := cache.Put(t.Context(), "nomic-embed-text", map[string][]float32{"a1": {0.1, 0.2}})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	err = cache.Put(t.Context(), "nomic-embed-text", map[string][]float32{"b2": {0.3}})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	vectors, err := cache.Vectors(t.Context(), []string{"a1", "b2", "c3"})
+	if err != nil {
+		t.Fatalf("Vectors() error = %v", err)
+	}
+
+	if len(vectors) != 2 || vectors["a1"][1] != 0.2 || vectors["b2"][0] != 0.3 {
+		t.Errorf("Vectors() = %v, want a1 and b2", vectors)
+	}
+	if stored["a1"].Model != "nomic-embed-text" || stored["a1"].CachedAt.IsZero() {
+		t.Errorf("stored = %+v, want model and time", stored["a1"])
+	}
+	want := []string{"HEAD /embedding-cache", "PUT /embedding-cache", "POST /_bulk", "POST /_bulk", "POST /embedding-cache/_mget"}
+	if !slices.Equal(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestEmbeddingCacheMissingIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"type":"index_not_found_exception"},"status":404}`))
+	}))
+	defer srv.Close()
+
+	vectors, err := newTestClient(t, srv).EmbeddingCache("embedding-cache").Vectors(t.Context(), []string{"a1"})
+	if err != nil {
+		t.Fatalf("Vectors() error = %v", err)
+	}
+	if len(vectors) != 0 {
+		t.Errorf("Vectors() = %v, want none", vectors)
+	}
+}
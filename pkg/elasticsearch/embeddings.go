@@ -0,0 +1,232 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Fields holding a document's embedding and the model that produced it.
+const (
+	EmbeddingField      = "embedding"
+	EmbeddingModelField = "embedding_model"
+)
+
+// ErrBulkFailed is returned when some items of a bulk request fail.
+var ErrBulkFailed = errors.New("bulk request had failed items")
+
+// EmbeddingUpdate is a vector to store for a document. When Source is set the
+// document is written whole with the embedding added; otherwise the embedding
+// is applied as a partial update to the existing document.
+type EmbeddingUpdate struct {
+	ID     string
+	Source json.RawMessage
+	Vector []float32
+	Model  string
+}
+
+// bulkResponse is the subset of a _bulk response used to report failures.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// vectorProperties returns the mapping for the embedding fields in the
+// backend's vector syntax.
+func (es *Client) vectorProperties(dims int) (properties map[string]interface{}) {
+	vector := map[string]interface{}{
+		"type":       "dense_vector",
+		"dims":       dims,
+		"index":      true,
+		"similarity": "cosine",
+	}
+	if es.Backend() == BackendOpenSearch {
+		vector = map[string]interface{}{
+			"type":      "knn_vector",
+			"dimension": dims,
+		}
+	}
+
+	properties = map[string]interface{}{
+		EmbeddingField:      vector,
+		EmbeddingModelField: map[string]interface{}{"type": "keyword"},
+	}
+	return properties
+}
+
+// EnsureVectorIndex prepares index to hold embeddings with dims dimensions. A
+// missing index is created with the code mapping plus the vector fields; an
+// existing index has the vector fields added to its mapping, which fails if it
+// already holds vectors of a different dimension.
+func (es *Client) EnsureVectorIndex(ctx context.Context, index string, dims int) (err error) {
+	var exists bool
+	exists, err = es.indexExists(ctx, index)
+	if err != nil {
+		err = fmt.Errorf("failed to check if index exists: %w", err)
+		return err
+	}
+
+	if exists {
+		url := fmt.Sprintf("%s/%s/_mapping", es.host, index)
+		_, err = es.doJSON(ctx, http.MethodPut, url, map[string]interface{}{
+			"properties": es.vectorProperties(dims),
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to add vector mapping to %s: %w", index, err)
+			return err
+		}
+		return err
+	}
+
+	var mapping map[string]interface{}
+	err = json.Unmarshal([]byte(indexMapping), &mapping)
+	if err != nil {
+		err = fmt.Errorf("failed to parse index mapping: %w", err)
+		return err
+	}
+
+	mappings, _ := mapping["mappings"].(map[string]interface{})
+	properties, _ := mappings["properties"].(map[string]interface{})
+	for name, field := range es.vectorProperties(dims) {
+		properties[name] = field
+	}
+
+	if es.Backend() == BackendOpenSearch {
+		settings, _ := mapping["settings"].(map[string]interface{})
+		settings["index.knn"] = true
+	}
+
+	_, err = es.doJSON(ctx, http.MethodPut, fmt.Sprintf("%s/%s", es.host, index), mapping)
+	if err != nil {
+		err = fmt.Errorf("failed to create index %s: %w", index, err)
+		return err
+	}
+
+	return err
+}
+
+// WriteEmbeddings stores embeddings in index with a single bulk request.
+func (es *Client) WriteEmbeddings(ctx context.Context, index string, updates []EmbeddingUpdate) (err error) {
+	var body bytes.Buffer
+	for _, update := range updates {
+		err = writeBulkEmbedding(&body, index, update)
+		if err != nil {
+			return err
+		}
+	}
+
+	var req *http.Request
+	req, err = es.newBodyRequest(ctx, http.MethodPost, es.host+"/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	es.authorize(req)
+
+	var resp *http.Response
+	resp, err = es.doRequestWithRetry(req)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("bulk_embeddings", "error").Inc()
+		err = fmt.Errorf("failed to write embeddings: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		es.metrics.ESRequests.WithLabelValues("bulk_embeddings", "error").Inc()
+		err = fmt.Errorf("failed to write embeddings: %w", newStatusError(resp, respBody))
+		return err
+	}
+
+	err = bulkItemsError(respBody)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("bulk_embeddings", "error").Inc()
+		return err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("bulk_embeddings", "success").Inc()
+	return err
+}
+
+// writeBulkEmbedding appends the action and document lines for one update.
+func writeBulkEmbedding(buf *bytes.Buffer, index string, update EmbeddingUpdate) (err error) {
+	meta := map[string]string{"_index": index, "_id": update.ID}
+
+	var action, doc interface{}
+	if update.Source == nil {
+		action = map[string]interface{}{"update": meta}
+		doc = map[string]interface{}{
+			"doc": map[string]interface{}{
+				EmbeddingField:      update.Vector,
+				EmbeddingModelField: update.Model,
+			},
+		}
+	} else {
+		var source map[string]interface{}
+		err = json.Unmarshal(update.Source, &source)
+		if err != nil {
+			err = fmt.Errorf("failed to decode document %s: %w", update.ID, err)
+			return err
+		}
+		source[EmbeddingField] = update.Vector
+		source[EmbeddingModelField] = update.Model
+
+		action = map[string]interface{}{"index": meta}
+		doc = source
+	}
+
+	for _, line := range []interface{}{action, doc} {
+		var data []byte
+		data, err = json.Marshal(line)
+		if err != nil {
+			err = fmt.Errorf("failed to marshal bulk line: %w", err)
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	return err
+}
+
+// bulkItemsError reports the failed items of a bulk response, if any.
+func bulkItemsError(body []byte) (err error) {
+	var resp bulkResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode bulk response: %w", err)
+		return err
+	}
+
+	if !resp.Errors {
+		return err
+	}
+
+	failed := 0
+	firstReason := ""
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < http.StatusMultipleChoices {
+				continue
+			}
+			failed++
+			if firstReason == "" {
+				firstReason = result.Error.Type + ": " + result.Error.Reason
+			}
+		}
+	}
+
+	err = fmt.Errorf("%w: %d of %d items failed, first: %s", ErrBulkFailed, failed, len(resp.Items), firstReason)
+	return err
+}
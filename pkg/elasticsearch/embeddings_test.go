@@ -0,0 +1,77 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteBulkEmbedding(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     EmbeddingUpdate
+		wantAction string
+		wantDoc    string
+	}{
+		{
+			name:       "in place",
+			update:     EmbeddingUpdate{ID: "a1", Vector: []float32{0.5}, Model: "m2"},
+			wantAction: `{"update":{"_id":"a1","_index":"code-index"}}`,
+			wantDoc:    `{"doc":{"embedding":[0.5],"embedding_model":"m2"}}`,
+		},
+		{
+			name:       "copy to target",
+			update:     EmbeddingUpdate{ID: "a1", Source: json.RawMessage(`{"repo":"api"}`), Vector: []float32{0.5}, Model: "m2"},
+			wantAction: `{"index":{"_id":"a1","_index":"code-index"}}`,
+			wantDoc:    `{"embedding":[0.5],"embedding_model":"m2","repo":"api"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeBulkEmbedding(&buf, "code-index", tt.update)
+			if err != nil {
+				t.Fatalf("writeBulkEmbedding() error = %v", err)
+			}
+
+			want := tt.wantAction + "\n" + tt.wantDoc + "\n"
+			if buf.String() != want {
+				t.Errorf("writeBulkEmbedding() =\n%s\nwant\n%s", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestBulkItemsError(t *testing.T) {
+	err := bulkItemsError([]byte(`{"errors":false,"items":[{"update":{"status":200}}]}`))
+	if err != nil {
+		t.Errorf("bulkItemsError() error = %v, want nil", err)
+	}
+
+	err = bulkItemsError([]byte(`{"errors":true,"items":[` +
+		`{"update":{"status":200}},` +
+		`{"update":{"status":400,"error":{"type":"illegal_argument_exception","reason":"different dims"}}}]}`))
+	if !errors.Is(err, ErrBulkFailed) {
+		t.Fatalf("bulkItemsError() error = %v, want ErrBulkFailed", err)
+	}
+	if !strings.Contains(err.Error(), "1 of 2") || !strings.Contains(err.Error(), "different dims") {
+		t.Errorf("bulkItemsError() error = %v, want count and first reason", err)
+	}
+}
+
+func TestVectorProperties(t *testing.T) {
+	es := &Client{backend: BackendElasticsearch}
+	field, _ := es.vectorProperties(384)[EmbeddingField].(map[string]interface{})
+	if field["type"] != "dense_vector" || field["dims"] != 384 {
+		t.Errorf("elasticsearch vector field = %v, want dense_vector with 384 dims", field)
+	}
+
+	openSearch := &Client{backend: BackendOpenSearch}
+	field, _ = openSearch.vectorProperties(384)[EmbeddingField].(map[string]interface{})
+	if field["type"] != "knn_vector" || field["dimension"] != 384 {
+		t.Errorf("opensearch vector field = %v, want knn_vector with 384 dimension", field)
+	}
+}
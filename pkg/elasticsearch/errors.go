@@ -0,0 +1,79 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Error classes for failed Elasticsearch requests. Use errors.Is to test for
+// them; ErrUnavailable and ErrTimeout are retryable, the others are not.
+var (
+	ErrBadRequest  = errors.New("elasticsearch rejected the request")
+	ErrConflict    = errors.New("elasticsearch conflict")
+	ErrUnavailable = errors.New("elasticsearch unavailable")
+	ErrTimeout     = errors.New("elasticsearch request timed out")
+)
+
+// ErrEncode is returned for a document that can't be encoded as JSON, so was
+// never sent.
+var ErrEncode = errors.New("failed to encode document")
+
+// StatusError is returned when Elasticsearch responds with a non-2xx status.
+// It unwraps to the error class matching the status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+// newStatusError builds a StatusError from a response status and body.
+func newStatusError(resp *http.Response, body []byte) (err *StatusError) {
+	err = &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+	return err
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() (msg string) {
+	msg = fmt.Sprintf("elasticsearch error: %s - %s", e.Status, e.Body)
+	return msg
+}
+
+// Unwrap returns the error class for the status code, or nil if it has none.
+func (e *StatusError) Unwrap() (err error) {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout:
+		err = ErrTimeout
+	case e.StatusCode == http.StatusConflict:
+		err = ErrConflict
+	case e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError:
+		err = ErrUnavailable
+	case e.StatusCode >= http.StatusBadRequest:
+		err = ErrBadRequest
+	}
+	return err
+}
+
+// classifyTransportError wraps an error from sending a request with ErrTimeout
+// or ErrUnavailable, keeping the original error in the chain.
+func classifyTransportError(cause error) (err error) {
+	var netErr net.Error
+	if errors.Is(cause, context.DeadlineExceeded) || (errors.As(cause, &netErr) && netErr.Timeout()) {
+		err = fmt.Errorf("%w: %w", ErrTimeout, cause)
+		return err
+	}
+
+	if errors.Is(cause, context.Canceled) {
+		err = cause
+		return err
+	}
+
+	err = fmt.Errorf("%w: %w", ErrUnavailable, cause)
+	return err
+}
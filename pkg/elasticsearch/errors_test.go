@@ -0,0 +1,83 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusErrorUnwrap(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   error
+	}{
+		{name: "bad request", status: http.StatusBadRequest, want: ErrBadRequest},
+		{name: "not found", status: http.StatusNotFound, want: ErrBadRequest},
+		{name: "request timeout", status: http.StatusRequestTimeout, want: ErrTimeout},
+		{name: "conflict", status: http.StatusConflict, want: ErrConflict},
+		{name: "too many requests", status: http.StatusTooManyRequests, want: ErrUnavailable},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, want: ErrUnavailable},
+		{name: "redirect", status: http.StatusMovedPermanently, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newStatusError(&http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status)}, nil)
+
+			got := err.Unwrap()
+			if !errors.Is(got, tt.want) {
+				t.Errorf("Unwrap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyTransportError(t *testing.T) {
+	tests := []struct {
+		name  string
+		cause error
+		want  error
+	}{
+		{name: "deadline", cause: context.DeadlineExceeded, want: ErrTimeout},
+		{name: "canceled", cause: context.Canceled, want: context.Canceled},
+		{name: "connection refused", cause: errors.New("connection refused"), want: ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyTransportError(tt.cause)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("classifyTransportError() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(got, tt.cause) {
+				t.Errorf("classifyTransportError() = %v, lost cause %v", got, tt.cause)
+			}
+		})
+	}
+}
+
+func TestSearchErrorClass(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"parsing_exception"}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+
+	_, err := client.Search(t.Context(), "query", 10)
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("Search() error = %v, want %v", err, ErrBadRequest)
+	}
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Search() error = %v, want *StatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("StatusCode = %d, want %d", statusErr.StatusCode, http.StatusBadRequest)
+	}
+}
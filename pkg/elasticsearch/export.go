@@ -0,0 +1,384 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// exportBatchSize is the number of documents fetched per scroll page.
+	exportBatchSize = 1000
+	// exportScrollKeepAlive is how long the scroll context lives between pages.
+	exportScrollKeepAlive = "2m"
+	// defaultImportBatchBytes is the bulk request size imports send when
+	// none is given.
+	defaultImportBatchBytes = 5 << 20
+	// maxImportLineBytes bounds one line of an import, a document with its
+	// code and embedding.
+	maxImportLineBytes = 64 << 20
+)
+
+// StoredDocument is a document as stored in the index, with its ID and raw _source.
+type StoredDocument struct {
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+}
+
+// scrollResponse is the subset of a scroll search response used for exports.
+type scrollResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []StoredDocument `json:"hits"`
+	} `json:"hits"`
+}
+
+// Export writes every document in the index to w as newline-delimited JSON,
+// one _source per line. Fields excluded from _source, such as code_full, are
+// not included.
+func (es *Client) Export(ctx context.Context, w io.Writer) (count int64, err error) {
+	err = es.ScrollDocuments(ctx, exportBatchSize, func(docs []StoredDocument) (writeErr error) {
+		for _, doc := range docs {
+			_, writeErr = fmt.Fprintf(w, "%s\n", doc.Source)
+			if writeErr != nil {
+				writeErr = fmt.Errorf("failed to write export: %w", writeErr)
+				return writeErr
+			}
+			count++
+		}
+		return writeErr
+	})
+
+	return count, err
+}
+
+// Dump writes every document in the index to w as newline-delimited JSON, one
+// {"_id": ..., "_source": ...} object per line, for Import to restore with
+// the same IDs. Fields excluded from _source, such as code_full, are not
+// included; embeddings are.
+func (es *Client) Dump(ctx context.Context, w io.Writer) (count int64, err error) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	err = es.ScrollDocuments(ctx, exportBatchSize, func(docs []StoredDocument) (writeErr error) {
+		for _, doc := range docs {
+			writeErr = enc.Encode(doc)
+			if writeErr != nil {
+				writeErr = fmt.Errorf("failed to write dump: %w", writeErr)
+				return writeErr
+			}
+			count++
+		}
+		return writeErr
+	})
+
+	return count, err
+}
+
+// Import indexes the newline-delimited JSON documents read from r into the
+// index with bulk requests of about batchBytes, or 5 MB when batchBytes is 0
+// or less, returning how many were indexed. A line is either a Dump object,
+// whose document keeps its ID, or a bare document, such as a line of an
+// Export snapshot, which gets a new one. The first document with an
+// embedding has the vector fields mapped for its dimensions. Import stops at
+// the first line it can't read or batch Elasticsearch fails; documents keep
+// their IDs, so importing a dump again is safe.
+func (es *Client) Import(ctx context.Context, r io.Reader, batchBytes int) (count int64, err error) {
+	if batchBytes <= 0 {
+		batchBytes = defaultImportBatchBytes
+	}
+	batch := &importBuffer{es: es, maxBytes: batchBytes}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxImportLineBytes)
+
+	vectorsMapped := false
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var id string
+		var source json.RawMessage
+		var dims int
+		id, source, dims, err = parseImportLine(raw)
+		if err != nil {
+			err = fmt.Errorf("line %d: %w", line, err)
+			return batch.indexed, err
+		}
+
+		if dims > 0 && !vectorsMapped {
+			err = es.EnsureVectorIndex(ctx, es.index, dims)
+			if err != nil {
+				return batch.indexed, err
+			}
+			vectorsMapped = true
+		}
+
+		var action []byte
+		action, err = importAction(id)
+		if err != nil {
+			err = fmt.Errorf("line %d: %w", line, err)
+			return batch.indexed, err
+		}
+
+		err = batch.add(ctx, action, source)
+		if err != nil {
+			return batch.indexed, err
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		err = fmt.Errorf("failed to read import after line %d: %w", line, err)
+		return batch.indexed, err
+	}
+
+	err = batch.flush(ctx)
+	count = batch.indexed
+	return count, err
+}
+
+// importBuffer collects the bulk request body of an import, sending it
+// whenever it reaches maxBytes.
+type importBuffer struct {
+	es       *Client
+	maxBytes int
+	body     bytes.Buffer
+	batched  int64
+	indexed  int64
+}
+
+// add appends a document and its bulk action to the batch, sending the batch
+// once it is full.
+func (b *importBuffer) add(ctx context.Context, action []byte, source json.RawMessage) (err error) {
+	b.body.Write(action)
+	b.body.Write(source)
+	b.body.WriteByte('\n')
+	b.batched++
+
+	if b.body.Len() >= b.maxBytes {
+		err = b.flush(ctx)
+	}
+	return err
+}
+
+// flush sends the batched documents, if any, counting them as indexed once
+// Elasticsearch accepts them.
+func (b *importBuffer) flush(ctx context.Context) (err error) {
+	if b.batched == 0 {
+		return err
+	}
+
+	err = b.es.importBatch(ctx, b.body.Bytes())
+	if err != nil {
+		return err
+	}
+	b.indexed += b.batched
+	b.batched = 0
+	b.body.Reset()
+	return err
+}
+
+// importAction returns the bulk action line of an imported document, which
+// keeps its ID when it has one.
+func importAction(id string) (action []byte, err error) {
+	if id == "" {
+		action = []byte(bulkIndexAction)
+		return action, err
+	}
+
+	action, err = json.Marshal(map[string]interface{}{"index": map[string]string{"_id": id}})
+	if err != nil {
+		err = fmt.Errorf("failed to marshal bulk action: %w", err)
+		return action, err
+	}
+	action = append(action, '\n')
+	return action, err
+}
+
+// parseImportLine returns the ID, if any, and source of an import line, and
+// the dimensions of the document's embedding, or 0 when it has none.
+func parseImportLine(raw []byte) (id string, source json.RawMessage, dims int, err error) {
+	var stored StoredDocument
+	err = json.Unmarshal(raw, &stored)
+	if err != nil {
+		err = fmt.Errorf("invalid document: %w", err)
+		return id, source, dims, err
+	}
+
+	id = stored.ID
+	source = stored.Source
+	if source == nil {
+		source = raw
+	}
+
+	var vector struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	err = json.Unmarshal(source, &vector)
+	if err != nil {
+		err = fmt.Errorf("invalid document: %w", err)
+		return id, source, dims, err
+	}
+
+	dims = len(vector.Embedding)
+	return id, source, dims, err
+}
+
+// importBatch sends one bulk request of an import.
+func (es *Client) importBatch(ctx context.Context, data []byte) (err error) {
+	url := fmt.Sprintf("%s/%s/_bulk", es.host, es.index)
+
+	var req *http.Request
+	req, err = es.newBodyRequest(ctx, http.MethodPost, url, "application/x-ndjson", data)
+	if err != nil {
+		return err
+	}
+
+	es.authorize(req)
+
+	var resp *http.Response
+	resp, err = es.doRequestWithRetry(req)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("import", "error").Inc()
+		err = fmt.Errorf("failed to import documents: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		es.metrics.ESRequests.WithLabelValues("import", "error").Inc()
+		err = fmt.Errorf("failed to import documents: %w", newStatusError(resp, respBody))
+		return err
+	}
+
+	err = bulkItemsError(respBody)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("import", "error").Inc()
+		return err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("import", "success").Inc()
+	return err
+}
+
+// ScrollDocuments pages through every document in the index, calling fn with
+// each batch of up to batchSize documents. Iteration stops at the first error.
+func (es *Client) ScrollDocuments(ctx context.Context, batchSize int, fn func(docs []StoredDocument) error) (err error) {
+	err = es.scroll(ctx, map[string]interface{}{
+		"size":  batchSize,
+		"sort":  []string{"_doc"},
+		"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+	}, fn)
+	return err
+}
+
+// RepoDocuments pages through every document indexed from a repository,
+// without its embedding, calling fn with each batch of up to batchSize
+// documents. Iteration stops at the first error. A missing index has none.
+func (es *Client) RepoDocuments(ctx context.Context, repo string, batchSize int, fn func(docs []CodeDocument) error) (err error) {
+	err = es.scroll(ctx, map[string]interface{}{
+		"size":    batchSize,
+		"sort":    []string{"_doc"},
+		"_source": map[string]interface{}{"excludes": []string{EmbeddingField}},
+		"query":   map[string]interface{}{"term": map[string]interface{}{"repo": repo}},
+	}, func(stored []StoredDocument) (pageErr error) {
+		docs := make([]CodeDocument, 0, len(stored))
+		for _, hit := range stored {
+			var doc CodeDocument
+			pageErr = json.Unmarshal(hit.Source, &doc)
+			if pageErr != nil {
+				pageErr = fmt.Errorf("failed to decode document %s: %w", hit.ID, pageErr)
+				return pageErr
+			}
+			doc.ID = hit.ID
+			docs = append(docs, doc)
+		}
+		pageErr = fn(docs)
+		return pageErr
+	})
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		err = nil
+	}
+	return err
+}
+
+// scroll pages through the documents query matches, calling fn with each
+// page. Iteration stops at the first error.
+func (es *Client) scroll(ctx context.Context, query map[string]interface{}, fn func(docs []StoredDocument) error) (err error) {
+	url := fmt.Sprintf("%s/%s/_search?scroll=%s", es.host, es.index, exportScrollKeepAlive)
+
+	var page scrollResponse
+	page, err = es.scrollPage(ctx, url, query)
+	if err != nil {
+		return err
+	}
+
+	scrollID := page.ScrollID
+	defer func() {
+		es.clearScroll(scrollID)
+	}()
+
+	for len(page.Hits.Hits) > 0 {
+		err = fn(page.Hits.Hits)
+		if err != nil {
+			return err
+		}
+
+		page, err = es.scrollPage(ctx, es.host+"/_search/scroll", map[string]interface{}{
+			"scroll":    exportScrollKeepAlive,
+			"scroll_id": scrollID,
+		})
+		if err != nil {
+			return err
+		}
+		if page.ScrollID != "" {
+			scrollID = page.ScrollID
+		}
+	}
+
+	return err
+}
+
+// scrollPage fetches one page of a scroll search.
+func (es *Client) scrollPage(ctx context.Context, url string, payload map[string]interface{}) (page scrollResponse, err error) {
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, url, payload)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("scroll", "error").Inc()
+		err = fmt.Errorf("failed to scroll index: %w", err)
+		return page, err
+	}
+
+	err = json.Unmarshal(body, &page)
+	if err != nil {
+		err = fmt.Errorf("failed to decode scroll response: %w", err)
+		return page, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("scroll", "success").Inc()
+	return page, err
+}
+
+// clearScroll releases a scroll context. Failures are ignored; the context
+// expires on its own after the keep-alive.
+func (es *Client) clearScroll(scrollID string) {
+	if scrollID == "" {
+		return
+	}
+
+	_, _ = es.doJSON(context.Background(), http.MethodDelete, es.host+"/_search/scroll", map[string]interface{}{
+		"scroll_id": scrollID,
+	})
+}
@@ -0,0 +1,171 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/test-index/_search":
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[` +
+				`{"_id":"a","_source":{"repo":"api","function_name":"Handle"}},` +
+				`{"_id":"b","_source":{"repo":"api","function_name":"Serve","embedding":[0.5,1]}}]}}`))
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[]}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	var out bytes.Buffer
+	count, err := es.Dump(t.Context(), &out)
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+
+	want := `{"_id":"a","_source":{"repo":"api","function_name":"Handle"}}` + "\n" +
+		`{"_id":"b","_source":{"repo":"api","function_name":"Serve","embedding":[0.5,1]}}` + "\n"
+	if count != 2 || out.String() != want {
+		t.Errorf("Dump() = %d, %q, want 2, %q", count, out.String(), want)
+	}
+}
+
+func TestImport(t *testing.T) {
+	var mu sync.Mutex
+	var bulks []string
+	var mapping string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/test-index/_bulk":
+			bulks = append(bulks, string(body))
+			_, _ = w.Write([]byte(`{"errors":false,"items":[]}`))
+		case r.URL.Path == "/test-index/_mapping" && r.Method == http.MethodPut:
+			mapping = string(body)
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	input := `{"_id":"a","_source":{"repo":"api","function_name":"Handle"}}` + "\n" +
+		"\n" +
+		`{"_id":"b","_source":{"repo":"api","function_name":"Serve","embedding":[0.5,1,0]}}` + "\n" +
+		`{"repo":"web","function_name":"Render"}` + "\n"
+
+	count, err := es.Import(t.Context(), strings.NewReader(input), 1)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Import() = %d, want 3", count)
+	}
+
+	want := []string{
+		`{"index":{"_id":"a"}}` + "\n" + `{"repo":"api","function_name":"Handle"}` + "\n",
+		`{"index":{"_id":"b"}}` + "\n" + `{"repo":"api","function_name":"Serve","embedding":[0.5,1,0]}` + "\n",
+		`{"index":{}}` + "\n" + `{"repo":"web","function_name":"Render"}` + "\n",
+	}
+	if strings.Join(bulks, "|") != strings.Join(want, "|") {
+		t.Errorf("bulk requests = %q, want %q", bulks, want)
+	}
+
+	var vectors struct {
+		Properties map[string]struct {
+			Dims int `json:"dims"`
+		} `json:"properties"`
+	}
+	err = json.Unmarshal([]byte(mapping), &vectors)
+	if err != nil || vectors.Properties[EmbeddingField].Dims != 3 {
+		t.Errorf("vector mapping = %s, want 3 dimensions", mapping)
+	}
+}
+
+func TestImportFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test-index/_bulk" {
+			_, _ = w.Write([]byte(`{"errors":true,"items":[{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	_, err := es.Import(t.Context(), strings.NewReader("{\"repo\":\"api\"}\nnot json\n"), 0)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Import() error = %v, want the unreadable line named", err)
+	}
+
+	count, err := es.Import(t.Context(), strings.NewReader(`{"repo":"api"}`+"\n"), 0)
+	if !errors.Is(err, ErrBulkFailed) || count != 0 {
+		t.Errorf("Import() = %d, %v, want 0 and ErrBulkFailed", count, err)
+	}
+}
+
+func TestRepoDocuments(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/test-index/_search":
+			body, _ := io.ReadAll(r.Body)
+			query = string(body)
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[` +
+				`{"_id":"a","_source":{"repo":"api","file_path":"main.go","function_name":"Handle"}}]}}`))
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[]}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	var got []CodeDocument
+	err := es.RepoDocuments(t.Context(), "api", 100, func(docs []CodeDocument) (pageErr error) {
+		got = append(got, docs...)
+		return pageErr
+	})
+	if err != nil {
+		t.Fatalf("RepoDocuments() error = %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "a" || got[0].FunctionName != "Handle" {
+		t.Errorf("RepoDocuments() = %+v, want Handle with its ID", got)
+	}
+	if !strings.Contains(query, `"term":{"repo":"api"}`) || !strings.Contains(query, `"excludes":["embedding"]`) {
+		t.Errorf("query = %s, want the repository's documents without embeddings", query)
+	}
+
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer missing.Close()
+
+	err = newTestClient(t, missing).RepoDocuments(t.Context(), "api", 100, func(_ []CodeDocument) (pageErr error) {
+		t.Error("a missing index has documents")
+		return pageErr
+	})
+	if err != nil {
+		t.Errorf("RepoDocuments() on a missing index error = %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DefaultFacetSize is how many values each facet lists when none is asked for.
+const DefaultFacetSize = 10
+
+// FacetBucket is one value of a facet and how many matching documents have it.
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facets counts the documents matching a search by repository, package, and
+// import, most common first, for drill-down filters.
+type Facets struct {
+	Total    int64         `json:"total"`
+	Repos    []FacetBucket `json:"repos"`
+	Packages []FacetBucket `json:"packages"`
+	Imports  []FacetBucket `json:"imports"`
+}
+
+// facetFields maps each facet's aggregation name to the field it counts.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var facetFields = map[string]string{
+	"repos":    "repo",
+	"packages": "package",
+	"imports":  "imports",
+}
+
+// facetsResponse is the subset of the facet aggregation response used by the indexer.
+type facetsResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations map[string]struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int64  `json:"doc_count"`
+		} `json:"buckets"`
+	} `json:"aggregations"`
+}
+
+// BuildFacetQuery builds the aggregation body for the facets of a search. It
+// applies the same query and filters as BuildSearchQuery, returns no hits, and
+// lists up to size values per facet. Counts don't need scores, so the flag
+// boosts are left out.
+func BuildFacetQuery(req SearchRequest, size int) (facetQuery map[string]interface{}) {
+	if size <= 0 {
+		size = DefaultFacetSize
+	}
+
+	aggs := make(map[string]interface{}, len(facetFields))
+	for name, field := range facetFields {
+		aggs[name] = map[string]interface{}{
+			"terms": map[string]interface{}{
+				"field": field,
+				"size":  size,
+			},
+		}
+	}
+
+	facetQuery = map[string]interface{}{
+		"query":            BuildSearchQuery(unboosted(req))["query"],
+		"size":             0,
+		"track_total_hits": true,
+		"aggs":             aggs,
+	}
+	return facetQuery
+}
+
+// Facets returns the repository, package, and import counts of the documents
+// matching a search, listing up to size values for each.
+func (es *Client) Facets(ctx context.Context, req SearchRequest, size int) (facets Facets, err error) {
+	url := fmt.Sprintf("%s/%s/_search", es.host, es.index)
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, url, BuildFacetQuery(req, size))
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("facets", "error").Inc()
+		err = fmt.Errorf("failed to get facets: %w", err)
+		return facets, err
+	}
+
+	var resp facetsResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode facets: %w", err)
+		return facets, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("facets", "success").Inc()
+
+	buckets := func(name string) (values []FacetBucket) {
+		values = []FacetBucket{}
+		for _, bucket := range resp.Aggregations[name].Buckets {
+			values = append(values, FacetBucket{Value: bucket.Key, Count: bucket.DocCount})
+		}
+		return values
+	}
+
+	facets = Facets{
+		Total:    resp.Hits.Total.Value,
+		Repos:    buckets("repos"),
+		Packages: buckets("packages"),
+		Imports:  buckets("imports"),
+	}
+	return facets, err
+}
+
+// unboosted returns the request ranked by sort, whose query carries no score
+// functions.
+func unboosted(req SearchRequest) (out SearchRequest) {
+	out = req
+	out.Ranking = RankingSort
+	return out
+}
@@ -0,0 +1,87 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildFacetQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       SearchRequest
+		size      int
+		wantQuery string
+		wantSize  float64
+	}{
+		{name: "whole index", req: SearchRequest{}, wantQuery: "match_all", wantSize: DefaultFacetSize},
+		{name: "query", req: SearchRequest{Query: "handler"}, size: 25, wantQuery: "multi_match", wantSize: 25},
+		{name: "filtered", req: SearchRequest{Query: "handler", Repos: []string{"api"}}, wantQuery: "bool", wantSize: DefaultFacetSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(BuildFacetQuery(tt.req, tt.size))
+			if err != nil {
+				t.Fatalf("Failed to marshal query: %v", err)
+			}
+
+			var body struct {
+				Size  int                                  `json:"size"`
+				Query map[string]any                       `json:"query"`
+				Aggs  map[string]map[string]map[string]any `json:"aggs"`
+			}
+			err = json.Unmarshal(data, &body)
+			if err != nil {
+				t.Fatalf("Failed to decode query: %v", err)
+			}
+
+			if body.Size != 0 {
+				t.Errorf("size = %d, want 0", body.Size)
+			}
+			_, ok := body.Query[tt.wantQuery]
+			if !ok {
+				t.Errorf("query = %v, want %s", body.Query, tt.wantQuery)
+			}
+			if len(body.Aggs) != 3 {
+				t.Errorf("aggs = %d, want 3", len(body.Aggs))
+			}
+			if body.Aggs["imports"]["terms"]["field"] != "imports" || body.Aggs["imports"]["terms"]["size"] != tt.wantSize {
+				t.Errorf("imports agg = %v, want field imports size %v", body.Aggs["imports"], tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestFacets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"hits": {"total": {"value": 42}, "hits": []},
+			"aggregations": {
+				"repos": {"buckets": [{"key": "api", "doc_count": 30}, {"key": "web", "doc_count": 12}]},
+				"packages": {"buckets": [{"key": "server", "doc_count": 20}]},
+				"imports": {"buckets": []}
+			}
+		}`))
+	}))
+	defer srv.Close()
+
+	facets, err := newTestClient(t, srv).Facets(t.Context(), SearchRequest{Query: "handler"}, 10)
+	if err != nil {
+		t.Fatalf("Facets() error = %v", err)
+	}
+
+	if facets.Total != 42 {
+		t.Errorf("Total = %d, want 42", facets.Total)
+	}
+	if len(facets.Repos) != 2 || facets.Repos[0] != (FacetBucket{Value: "api", Count: 30}) {
+		t.Errorf("Repos = %v, want api first with 30", facets.Repos)
+	}
+	if len(facets.Packages) != 1 || facets.Packages[0].Value != "server" {
+		t.Errorf("Packages = %v, want server", facets.Packages)
+	}
+	if facets.Imports == nil || len(facets.Imports) != 0 {
+		t.Errorf("Imports = %#v, want an empty list", facets.Imports)
+	}
+}
@@ -0,0 +1,82 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// FileKey identifies a document's file across repositories.
+func (d CodeDocument) FileKey() (key string) {
+	key = d.Repo + "\x00" + d.FilePath
+	return key
+}
+
+// FileDocuments returns the KindFile documents of the files the documents
+// given come from, keyed by FileKey. Files without one, indexed before
+// INDEX_OVERVIEWS was set, are left out. Hits are collapsed by file, so of
+// several copies of a file's document the most recently indexed one is
+// returned, and of a chunked one its first chunk. A file's path includes its
+// repository's clone, so it is unique to one repository.
+func (es *Client) FileDocuments(ctx context.Context, docs []CodeDocument) (files map[string]CodeDocument, err error) {
+	files = map[string]CodeDocument{}
+
+	seen := map[string]bool{}
+	var should []map[string]interface{}
+	for _, doc := range docs {
+		key := doc.FileKey()
+		if seen[key] || doc.FilePath == "" {
+			continue
+		}
+		seen[key] = true
+		should = append(should, map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+			{"term": map[string]interface{}{"repo": doc.Repo}},
+			{"term": map[string]interface{}{"file_path": doc.FilePath}},
+		}}})
+	}
+	if len(should) == 0 {
+		return files, err
+	}
+
+	query := map[string]interface{}{
+		"size":     len(should),
+		"collapse": map[string]interface{}{"field": "file_path"},
+		"sort": []map[string]interface{}{
+			{"chunk_index": map[string]interface{}{"order": "asc", "missing": "_first", "unmapped_type": "integer"}},
+			{"indexed_at": map[string]interface{}{"order": "desc", "unmapped_type": "date"}},
+		},
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"filter":               []map[string]interface{}{{"term": map[string]interface{}{"kind": KindFile}}},
+			"should":               should,
+			"minimum_should_match": 1,
+		}},
+	}
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_search", es.host, es.index), query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("file_documents", "error").Inc()
+		err = fmt.Errorf("failed to fetch file documents: %w", err)
+		return files, err
+	}
+
+	var searchResp SearchResponse
+	err = json.Unmarshal(body, &searchResp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return files, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("file_documents", "success").Inc()
+
+	for _, hit := range searchResp.Hits.Hits {
+		hit.Source.ID = hit.ID
+		key := hit.Source.FileKey()
+		_, found := files[key]
+		if !found {
+			files[key] = hit.Source
+		}
+	}
+	return files, err
+}
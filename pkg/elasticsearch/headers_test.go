@@ -0,0 +1,47 @@
+package elasticsearch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFileDocuments(t *testing.T) {
+	var requests int
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		query = string(body)
+		_, _ = w.Write([]byte(`{"hits":{"hits":[` +
+			`{"_id":"f1","_source":{"repo":"api","file_path":"/repos/api/retry.go","kind":"file","code":"package retry\n"}}]}}`))
+	}))
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	files, err := client.FileDocuments(t.Context(), nil)
+	if err != nil || len(files) != 0 || requests != 0 {
+		t.Errorf("FileDocuments() of no results = %v, %v after %d requests, want none without searching", files, err, requests)
+	}
+
+	docs := []CodeDocument{
+		{Repo: "api", FilePath: "/repos/api/retry.go", FunctionName: "Do"},
+		{Repo: "api", FilePath: "/repos/api/retry.go", FunctionName: "Wait"},
+		{Repo: "api", FilePath: "/repos/api/serve.go", FunctionName: "Serve"},
+	}
+	files, err = client.FileDocuments(t.Context(), docs)
+	if err != nil {
+		t.Fatalf("FileDocuments() error = %v", err)
+	}
+
+	if len(files) != 1 || files[docs[0].FileKey()].ID != "f1" {
+		t.Errorf("FileDocuments() = %v, want retry.go's", files)
+	}
+	for _, part := range []string{`{"term":{"kind":"file"}}`, `"collapse":{"field":"file_path"}`, `"size":2`, `{"term":{"file_path":"/repos/api/serve.go"}}`} {
+		if !strings.Contains(query, part) {
+			t.Errorf("query = %s, want %s", query, part)
+		}
+	}
+}
@@ -16,49 +16,153 @@ const indexMapping = `{
     "refresh_interval": "30s"
   },
   "mappings": {
+    "_meta": {"schema_version": 11},
+    "_source": {
+      "excludes": ["code_full"]
+    },
+    "dynamic_templates": [
+      {
+        "metadata_keywords": {
+          "path_match": "metadata.*",
+          "match_mapping_type": "string",
+          "mapping": {"type": "keyword"}
+        }
+      }
+    ],
     "properties": {
       "repo": {"type": "keyword"},
       "file_path": {"type": "keyword"},
+      "doc_type": {"type": "keyword"},
+      "language": {"type": "keyword"},
+      "kind": {"type": "keyword"},
       "function_name": {"type": "keyword"},
+      "receiver": {"type": "keyword"},
+      "exported": {"type": "boolean"},
+      "start_line": {"type": "integer"},
+      "end_line": {"type": "integer"},
       "code": {"type": "text", "analyzer": "standard"},
+      "code_full": {"type": "text", "analyzer": "standard"},
+      "code_truncated": {"type": "boolean"},
+      "summary": {"type": "text", "analyzer": "english"},
+      "summary_model": {"type": "keyword"},
+      "chunk_index": {"type": "integer"},
+      "chunk_total": {"type": "integer"},
       "has_namedreturns": {"type": "boolean"},
       "has_error_handling": {"type": "boolean"},
       "package": {"type": "keyword"},
       "imports": {"type": "keyword"},
+      "module": {"type": "keyword"},
+      "go_version": {"type": "keyword"},
+      "dependencies": {"type": "keyword"},
       "lint_compliant": {"type": "boolean"},
+      "lint_findings": {"type": "keyword"},
+      "cyclomatic_complexity": {"type": "integer"},
+      "cognitive_complexity": {"type": "integer"},
+      "calls": {"type": "keyword"},
+      "references": {"type": "keyword"},
+      "callees": {"type": "keyword"},
+      "uses": {"type": "keyword"},
+      "param_types": {"type": "keyword"},
+      "result_types": {"type": "keyword"},
+      "resolved_calls": {"type": "keyword"},
+      "implements": {"type": "keyword"},
+      "build_constraint": {"type": "keyword"},
+      "build_tags": {"type": "keyword"},
+      "platforms": {"type": "keyword"},
+      "resource_type": {"type": "keyword"},
+      "provider": {"type": "keyword"},
+      "attributes": {"type": "keyword"},
+      "service_name": {"type": "keyword"},
+      "method_name": {"type": "keyword"},
+      "request_type": {"type": "keyword"},
+      "response_type": {"type": "keyword"},
+      "locations": {
+        "properties": {
+          "file_path": {"type": "keyword"},
+          "start_line": {"type": "integer"},
+          "end_line": {"type": "integer"}
+        }
+      },
+      "metadata": {"type": "object"},
+      "has_parse_errors": {"type": "boolean"},
+      "is_test": {"type": "boolean"},
+      "is_generated": {"type": "boolean"},
+      "deprecated": {"type": "boolean"},
+      "markers": {
+        "properties": {
+          "tag": {"type": "keyword"},
+          "line": {"type": "integer"},
+          "text": {"type": "text"}
+        }
+      },
+      "is_test_func": {"type": "boolean"},
+      "test_subjects": {"type": "keyword"},
+      "uses_panic": {"type": "boolean"},
+      "spawns_goroutines": {"type": "boolean"},
+      "uses_unsafe": {"type": "boolean"},
+      "uses_reflection": {"type": "boolean"},
+      "uses_cgo": {"type": "boolean"},
+      "content_hash": {"type": "keyword"},
+      "normalized_hash": {"type": "keyword"},
+      "renamed_from": {"type": "keyword"},
+      "commit": {"type": "keyword"},
       "indexed_at": {"type": "date"}
     }
   }
 }`
 
-// EnsureIndex ensures the index exists with the correct mapping.
-// If the index already exists, this is a no-op.
+// EnsureIndex ensures the index exists with the correct mapping. When
+// ES_INDEX_TEMPLATE is set the index template is installed or updated first
+// and a new index takes its settings and mappings from it; otherwise the
+// mapping is sent inline. An existing index gets any fields it lacks added,
+// unless SCHEMA_MIGRATION is none, and, when additive and no field conflicts,
+// is marked with SchemaVersion.
 func (es *Client) EnsureIndex(ctx context.Context) (err error) {
+	if es.indexTemplate != "" {
+		err = es.putIndexTemplate(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Check if index exists
-	exists, checkErr := es.indexExists(ctx)
+	exists, checkErr := es.indexExists(ctx, es.index)
 	if checkErr != nil {
 		err = fmt.Errorf("failed to check if index exists: %w", checkErr)
 		return err
 	}
 
 	if exists {
+		err = es.syncMapping(ctx)
+		if err != nil {
+			err = fmt.Errorf("failed to update index mapping: %w", err)
+		}
 		return err
 	}
 
-	// Create index with mapping
-	url := fmt.Sprintf("%s/%s", es.host, es.index)
+	err = es.createIndex(ctx, es.index)
+	return err
+}
+
+// createIndex creates the named index, with the mapping inline unless the
+// managed template supplies it.
+func (es *Client) createIndex(ctx context.Context, name string) (err error) {
+	var body io.Reader = http.NoBody
+	if !es.templateCovers(name) {
+		body = bytes.NewBufferString(indexMapping)
+	}
+
+	url := fmt.Sprintf("%s/%s", es.host, name)
 
 	var req *http.Request
-	req, err = http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewBufferString(indexMapping))
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, url, body)
 	if err != nil {
 		err = fmt.Errorf("failed to create request: %w", err)
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if es.username != "" {
-		req.SetBasicAuth(es.username, es.password)
-	}
+	es.authorize(req)
 
 	var resp *http.Response
 	resp, err = es.doRequestWithRetry(req)
@@ -69,17 +173,17 @@ func (es *Client) EnsureIndex(ctx context.Context) (err error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= http.StatusMultipleChoices {
-		body, _ := io.ReadAll(resp.Body)
-		err = fmt.Errorf("elasticsearch error creating index: %s - %s", resp.Status, string(body))
+		respBody, _ := io.ReadAll(resp.Body)
+		err = fmt.Errorf("failed to create index: %w", newStatusError(resp, respBody))
 		return err
 	}
 
 	return err
 }
 
-// indexExists checks if the index exists.
-func (es *Client) indexExists(ctx context.Context) (exists bool, err error) {
-	url := fmt.Sprintf("%s/%s", es.host, es.index)
+// indexExists checks if the named index exists.
+func (es *Client) indexExists(ctx context.Context, index string) (exists bool, err error) {
+	url := fmt.Sprintf("%s/%s", es.host, index)
 
 	var req *http.Request
 	req, err = http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
@@ -87,13 +191,12 @@ func (es *Client) indexExists(ctx context.Context) (exists bool, err error) {
 		return exists, err
 	}
 
-	if es.username != "" {
-		req.SetBasicAuth(es.username, es.password)
-	}
+	es.authorize(req)
 
 	var resp *http.Response
 	resp, err = es.client.Do(req)
 	if err != nil {
+		err = classifyTransportError(err)
 		return exists, err
 	}
 	defer resp.Body.Close()
@@ -108,6 +211,7 @@ func (es *Client) indexExists(ctx context.Context) (exists bool, err error) {
 		return exists, err
 	}
 
-	err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	err = newStatusError(resp, body)
 	return exists, err
 }
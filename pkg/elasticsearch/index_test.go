@@ -0,0 +1,139 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestEnsureIndexSyncsMapping(t *testing.T) {
+	var added map[string]json.RawMessage
+	var templates []map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/test-index/_mapping":
+			// An alias over two indices; "kind" is mapped in only one.
+			_, _ = w.Write([]byte(`{
+				"code-index-1": {"mappings": {"properties": {"repo": {"type": "keyword"}}}},
+				"code-index-2": {"mappings": {"properties": {"repo": {"type": "keyword"}, "kind": {"type": "keyword"}}}}
+			}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/test-index/_mapping":
+			var body struct {
+				DynamicTemplates []map[string]json.RawMessage `json:"dynamic_templates"`
+				Properties       map[string]json.RawMessage   `json:"properties"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			added = body.Properties
+			templates = body.DynamicTemplates
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+
+	err := client.EnsureIndex(t.Context())
+	if err != nil {
+		t.Fatalf("EnsureIndex() error = %v", err)
+	}
+
+	for _, existing := range []string{"repo", "kind"} {
+		_, ok := added[existing]
+		if ok {
+			t.Errorf("mapping update re-added existing field %q", existing)
+		}
+	}
+	for _, missing := range []string{"file_path", "cognitive_complexity", "lint_findings", "metadata"} {
+		_, ok := added[missing]
+		if !ok {
+			t.Errorf("mapping update missing field %q", missing)
+		}
+	}
+	if len(templates) != 1 || templates[0]["metadata_keywords"] == nil {
+		t.Errorf("mapping update dynamic templates = %v, want metadata_keywords", templates)
+	}
+}
+
+func TestEnsureIndexCreate(t *testing.T) {
+	tests := []struct {
+		name          string
+		template      string
+		patterns      []string
+		wantTemplates []string
+		wantInline    bool
+	}{
+		{
+			name:          "template covers index",
+			template:      "test-index",
+			patterns:      []string{"test-index", "test-index-*"},
+			wantTemplates: []string{"/_component_template/test-index-settings", "/_component_template/test-index-mappings", "/_index_template/test-index"},
+			wantInline:    false,
+		},
+		{
+			name:          "template does not cover index",
+			template:      "rag",
+			patterns:      []string{"other-*"},
+			wantTemplates: []string{"/_component_template/rag-settings", "/_component_template/rag-mappings", "/_index_template/rag"},
+			wantInline:    true,
+		},
+		{
+			name:       "templates disabled",
+			wantInline: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var templates []string
+			var composedOf []string
+			var createBody []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodHead:
+					w.WriteHeader(http.StatusNotFound)
+				case r.Method == http.MethodPut && r.URL.Path == "/test-index":
+					createBody, _ = io.ReadAll(r.Body)
+					_, _ = w.Write([]byte(`{"acknowledged":true}`))
+				case r.Method == http.MethodPut:
+					templates = append(templates, r.URL.Path)
+					var body struct {
+						ComposedOf []string `json:"composed_of"`
+					}
+					_ = json.NewDecoder(r.Body).Decode(&body)
+					composedOf = append(composedOf, body.ComposedOf...)
+					_, _ = w.Write([]byte(`{"acknowledged":true}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			client := newTestClient(t, srv)
+			client.indexTemplate = tt.template
+			client.indexPatterns = tt.patterns
+
+			err := client.EnsureIndex(t.Context())
+			if err != nil {
+				t.Fatalf("EnsureIndex() error = %v", err)
+			}
+
+			if !slices.Equal(templates, tt.wantTemplates) {
+				t.Errorf("templates = %v, want %v", templates, tt.wantTemplates)
+			}
+			if tt.template != "" && !slices.Equal(composedOf, []string{tt.template + "-settings", tt.template + "-mappings"}) {
+				t.Errorf("composed_of = %v", composedOf)
+			}
+			inline := len(createBody) > 0
+			if inline != tt.wantInline {
+				t.Errorf("inline mapping sent = %v, want %v", inline, tt.wantInline)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// setLocationsScript replaces a document's locations.
+const setLocationsScript = `ctx._source.locations = params.locations`
+
+// Refresh makes recently indexed documents visible to searches and updates.
+func (es *Client) Refresh(ctx context.Context) (err error) {
+	_, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_refresh", es.host, es.index), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to refresh index: %w", err)
+	}
+	return err
+}
+
+// Flush writes the index's buffered operations to disk, so documents indexed
+// before a shutdown don't depend on translog replay.
+func (es *Client) Flush(ctx context.Context) (err error) {
+	_, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_flush", es.host, es.index), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to flush index: %w", err)
+	}
+	return err
+}
+
+// SetLocations records every location of a duplicated declaration on the
+// indexed copy, identified by its repository, commit, file, name, and content
+// hash. All chunks of a chunked declaration are updated. Call Refresh first
+// when the document was only just indexed.
+func (es *Client) SetLocations(ctx context.Context, canonical CodeDocument, locations []Location) (err error) {
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"repo": canonical.Repo}},
+		{"term": map[string]interface{}{"file_path": canonical.FilePath}},
+		{"term": map[string]interface{}{"function_name": canonical.FunctionName}},
+		{"term": map[string]interface{}{"content_hash": canonical.ContentHash}},
+	}
+	if canonical.Commit != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"commit": canonical.Commit}})
+	}
+
+	url := fmt.Sprintf("%s/%s/_update_by_query?conflicts=proceed", es.host, es.index)
+	_, err = es.doJSON(ctx, http.MethodPost, url, map[string]interface{}{
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": setLocationsScript,
+			"params": map[string]interface{}{"locations": locations},
+		},
+	})
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("update_locations", "error").Inc()
+		err = fmt.Errorf("failed to set locations: %w", err)
+		return err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("update_locations", "success").Inc()
+	return err
+}
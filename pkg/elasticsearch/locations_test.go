@@ -0,0 +1,59 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetLocations(t *testing.T) {
+	var body struct {
+		Query struct {
+			Bool struct {
+				Filter []map[string]map[string]string `json:"filter"`
+			} `json:"bool"`
+		} `json:"query"`
+		Script struct {
+			Params struct {
+				Locations []Location `json:"locations"`
+			} `json:"params"`
+		} `json:"script"`
+	}
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"updated":1}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+	canonical := CodeDocument{Repo: "api", Commit: "4f9c2e1", FilePath: "a_linux.go", FunctionName: "Open", ContentHash: "abc"}
+	locations := []Location{{FilePath: "a_linux.go", StartLine: 3}, {FilePath: "a_darwin.go", StartLine: 7}}
+
+	err := client.SetLocations(t.Context(), canonical, locations)
+	if err != nil {
+		t.Fatalf("SetLocations() error = %v", err)
+	}
+
+	if path != "/test-index/_update_by_query" {
+		t.Errorf("path = %s, want /test-index/_update_by_query", path)
+	}
+
+	terms := make(map[string]string)
+	for _, filter := range body.Query.Bool.Filter {
+		for field, value := range filter["term"] {
+			terms[field] = value
+		}
+	}
+	wantTerms := map[string]string{"repo": "api", "commit": "4f9c2e1", "file_path": "a_linux.go", "function_name": "Open", "content_hash": "abc"}
+	for field, value := range wantTerms {
+		if terms[field] != value {
+			t.Errorf("term %s = %q, want %q", field, terms[field], value)
+		}
+	}
+	if len(body.Script.Params.Locations) != 2 {
+		t.Errorf("locations = %v, want 2", body.Script.Params.Locations)
+	}
+}
@@ -0,0 +1,55 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MarkedDocuments returns a repository's declarations with TODO or FIXME
+// comments, only those with one of tags when any are given, at most limit
+// of them, in order of file and line. Each chunk of a chunked declaration
+// is a document of its own, carrying all of the declaration's markers.
+func (es *Client) MarkedDocuments(ctx context.Context, repo string, tags []string, limit int) (docs []CodeDocument, err error) {
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"repo": repo}},
+		{"exists": map[string]interface{}{"field": "markers.tag"}},
+	}
+	if len(tags) > 0 {
+		filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{"markers.tag": tags}})
+	}
+
+	query := map[string]interface{}{
+		"size": limit,
+		"sort": []map[string]interface{}{
+			{"file_path": map[string]interface{}{"order": "asc"}},
+			{"start_line": map[string]interface{}{"order": "asc", "unmapped_type": "integer"}},
+		},
+		"_source": map[string]interface{}{"excludes": []string{EmbeddingField, "code", "code_full"}},
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+	}
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_search", es.host, es.index), query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("markers", "error").Inc()
+		err = fmt.Errorf("failed to find markers: %w", err)
+		return docs, err
+	}
+
+	var searchResp SearchResponse
+	err = json.Unmarshal(body, &searchResp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return docs, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("markers", "success").Inc()
+
+	for _, hit := range searchResp.Hits.Hits {
+		hit.Source.ID = hit.ID
+		docs = append(docs, hit.Source)
+	}
+	return docs, err
+}
@@ -1,33 +1,387 @@
 // Package elasticsearch provides Elasticsearch client and data models for code indexing.
 package elasticsearch
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
-// CodeDocument represents a Go function indexed in Elasticsearch.
+// Document kinds. Documents indexed before kinds existed have none and are
+// functions or methods.
+const (
+	KindFunction  = "function"
+	KindMethod    = "method"
+	KindType      = "type"
+	KindClass     = "class"
+	KindInterface = "interface"
+	KindConst     = "const"
+	KindVar       = "var"
+	KindSection   = "section"
+	KindResource  = "resource"
+	KindData      = "data"
+	KindModule    = "module"
+	KindVariable  = "variable"
+	KindOutput    = "output"
+	KindProvider  = "provider"
+	KindMessage   = "message"
+	KindService   = "service"
+	KindRPC       = "rpc"
+	KindFile      = "file"
+	KindPackage   = "package"
+)
+
+// Marker tags.
+const (
+	MarkerTodo  = "TODO"
+	MarkerFixme = "FIXME"
+)
+
+// Document types. Documents without one are code.
+const (
+	DocTypeCode     = "code"
+	DocTypeMarkdown = "markdown"
+)
+
+// CodeDocument represents a declaration indexed in Elasticsearch: a
+// function or method, or a type, const, or var declaration, in the source
+// language named by Language; documents without one are Go. Exported marks
+// declarations visible outside their package or module: capitalized Go
+// names, and methods only on capitalized types; Python names without a
+// leading underscore; TypeScript declarations with the export keyword and
+// the public methods of exported classes; every Protobuf declaration; and
+// Terraform variables and outputs. Python and TypeScript classes have
+// KindClass, and their methods are named "Class.method". FunctionName holds
+// the declared name for every kind, and Receiver the type a Go method is
+// declared on.
+// Markdown sections share the index with DocType set to DocTypeMarkdown,
+// Kind to KindSection, and FunctionName to their heading path. Terraform
+// blocks are named by their address, such as aws_s3_bucket.logs, with
+// ResourceType, Provider, and the Attributes set in them. Protobuf
+// services and their rpcs carry ServiceName, and rpcs, named
+// "Service.Method", also MethodName, RequestType, and ResponseType. With
+// INDEX_OVERVIEWS, each source file also has a KindFile document holding
+// its header and an outline of its declarations, named by its base name,
+// and each directory a KindPackage document outlining its files, with
+// FilePath the directory and FunctionName the package. Go declarations
+// list the functions they call in Calls and the types they refer to in
+// References, as written ("Config", "http.Request"), and both again
+// qualified by package name in Callees and Uses ("retry.Do",
+// "retry.Policy.Next", "http.Request"), with the functions, variables, and
+// constants they name without calling them also in Uses. With INDEX_TYPES,
+// type-checking adds a function's ParamTypes and ResultTypes and the
+// ResolvedCalls it makes, by full import path ("*net/http.Request",
+// "net/http.Client.Do"), and the known interfaces a type, or a method's
+// receiver through it, Implements. Go files built only under some
+// constraint, by a //go:build line or their name, give their declarations
+// the BuildConstraint ("linux && amd64") and the BuildTags in it, and with
+// INDEX_PLATFORMS the Platforms ("linux/amd64") among those configured it
+// builds on. Metadata holds fields added by an enrichment hook, such as the
+// owning team.
+// IsTest and IsGenerated mark documents from test files and generated code
+// that the walker's patterns let through. UsesPanic, SpawnsGoroutines,
+// UsesUnsafe, UsesReflection, and UsesCgo mark Go code that calls panic or
+// log.Panic, starts goroutines, or uses the unsafe, reflect, or cgo
+// packages. IsTestFunc marks Go tests, benchmarks, and fuzz targets, and
+// TestSubjects names the functions each appears to test, qualified like
+// Callees. Deprecated marks Go declarations whose doc comment has a
+// "Deprecated:" paragraph and Python ones with a @deprecated decorator, and
+// Markers lists the TODO and FIXME comments in a declaration. Module and
+// GoVersion come from the go.mod of the Go module a file belongs to, and
+// Dependencies lists the module's direct requirements the file imports
+// packages from.
+// NormalizedHash identifies the code across repositories, such as in
+// vendored copies and forks, for collapsing duplicates in search results.
+// Summary is a natural-language description of the code generated at index
+// time, when SUMMARY_URL is set, by the language model SummaryModel names.
+// ID, Score, RerankScore, Duplicates, Context, Tests, and SourceURL are not
+// indexed: ID and Score are the hit's document ID and relevance score,
+// RerankScore is set when a reranker reordered the results, Duplicates lists
+// the other copies of a result collapsed into it, Context holds the
+// declarations a result refers to and Tests the tests linked to it when a
+// search asks for them, and the server fills in SourceURL when rendering
+// results.
 type CodeDocument struct {
-	Repo             string    `json:"repo"`
-	FilePath         string    `json:"file_path"`
-	FunctionName     string    `json:"function_name"`
-	Code             string    `json:"code"`
-	HasNamedReturns  bool      `json:"has_namedreturns"`
-	HasErrorHandling bool      `json:"has_error_handling"`
-	Package          string    `json:"package"`
-	Imports          []string  `json:"imports"`
-	LintCompliant    bool      `json:"lint_compliant"`
-	IndexedAt        time.Time `json:"indexed_at"`
-}
-
-// SearchRequest represents a search query request.
+	Repo                 string            `json:"repo"`
+	FilePath             string            `json:"file_path"`
+	DocType              string            `json:"doc_type,omitempty"`
+	Language             string            `json:"language,omitempty"`
+	Kind                 string            `json:"kind"`
+	FunctionName         string            `json:"function_name"`
+	Receiver             string            `json:"receiver,omitempty"`
+	Exported             bool              `json:"exported,omitempty"`
+	StartLine            int               `json:"start_line,omitempty"`
+	EndLine              int               `json:"end_line,omitempty"`
+	Code                 string            `json:"code"`
+	CodeFull             string            `json:"code_full,omitempty"`
+	CodeTruncated        bool              `json:"code_truncated,omitempty"`
+	Summary              string            `json:"summary,omitempty"`
+	SummaryModel         string            `json:"summary_model,omitempty"`
+	ChunkIndex           int               `json:"chunk_index,omitempty"`
+	ChunkTotal           int               `json:"chunk_total,omitempty"`
+	HasNamedReturns      bool              `json:"has_namedreturns"`
+	HasErrorHandling     bool              `json:"has_error_handling"`
+	Package              string            `json:"package"`
+	Imports              []string          `json:"imports"`
+	Module               string            `json:"module,omitempty"`
+	GoVersion            string            `json:"go_version,omitempty"`
+	Dependencies         []string          `json:"dependencies,omitempty"`
+	LintCompliant        bool              `json:"lint_compliant"`
+	LintFindings         []string          `json:"lint_findings"`
+	CyclomaticComplexity int               `json:"cyclomatic_complexity"`
+	CognitiveComplexity  int               `json:"cognitive_complexity"`
+	Calls                []string          `json:"calls,omitempty"`
+	References           []string          `json:"references,omitempty"`
+	Callees              []string          `json:"callees,omitempty"`
+	Uses                 []string          `json:"uses,omitempty"`
+	ParamTypes           []string          `json:"param_types,omitempty"`
+	ResultTypes          []string          `json:"result_types,omitempty"`
+	ResolvedCalls        []string          `json:"resolved_calls,omitempty"`
+	Implements           []string          `json:"implements,omitempty"`
+	BuildConstraint      string            `json:"build_constraint,omitempty"`
+	BuildTags            []string          `json:"build_tags,omitempty"`
+	Platforms            []string          `json:"platforms,omitempty"`
+	ResourceType         string            `json:"resource_type,omitempty"`
+	Provider             string            `json:"provider,omitempty"`
+	Attributes           []string          `json:"attributes,omitempty"`
+	ServiceName          string            `json:"service_name,omitempty"`
+	MethodName           string            `json:"method_name,omitempty"`
+	RequestType          string            `json:"request_type,omitempty"`
+	ResponseType         string            `json:"response_type,omitempty"`
+	Locations            []Location        `json:"locations,omitempty"`
+	Metadata             map[string]string `json:"metadata,omitempty"`
+	HasParseErrors       bool              `json:"has_parse_errors,omitempty"`
+	IsTest               bool              `json:"is_test,omitempty"`
+	IsGenerated          bool              `json:"is_generated,omitempty"`
+	Deprecated           bool              `json:"deprecated,omitempty"`
+	Markers              []Marker          `json:"markers,omitempty"`
+	IsTestFunc           bool              `json:"is_test_func,omitempty"`
+	TestSubjects         []string          `json:"test_subjects,omitempty"`
+	UsesPanic            bool              `json:"uses_panic,omitempty"`
+	SpawnsGoroutines     bool              `json:"spawns_goroutines,omitempty"`
+	UsesUnsafe           bool              `json:"uses_unsafe,omitempty"`
+	UsesReflection       bool              `json:"uses_reflection,omitempty"`
+	UsesCgo              bool              `json:"uses_cgo,omitempty"`
+	ContentHash          string            `json:"content_hash"`
+	NormalizedHash       string            `json:"normalized_hash,omitempty"`
+	RenamedFrom          string            `json:"renamed_from,omitempty"`
+	Commit               string            `json:"commit,omitempty"`
+	IndexedAt            time.Time         `json:"indexed_at"`
+	ID                   string            `json:"id,omitempty"`
+	Score                float64           `json:"score,omitempty"`
+	RerankScore          float64           `json:"rerank_score,omitempty"`
+	Duplicates           []Duplicate       `json:"duplicates,omitempty"`
+	Context              []CodeDocument    `json:"context,omitempty"`
+	Tests                []CodeDocument    `json:"tests,omitempty"`
+	SourceURL            string            `json:"source_url,omitempty"`
+}
+
+// EmbeddingText returns the text embedded for a document: its qualified
+// function name, its summary when it has one, and the code.
+func (d CodeDocument) EmbeddingText() (text string) {
+	text = d.Package + "." + d.FunctionName + "\n"
+	if d.Summary != "" {
+		text += d.Summary + "\n"
+	}
+	text += d.Code
+	return text
+}
+
+// NormalizedCodeHash returns a hex-encoded SHA-256 of the document's kind,
+// name, and code with each run of whitespace collapsed to a space, so copies
+// differing only in indentation or line endings hash alike. Unlike
+// ContentHash it covers the name, so different functions with the same body
+// don't.
+func (d CodeDocument) NormalizedCodeHash() (hash string) {
+	code := strings.Join(strings.Fields(d.Code), " ")
+	sum := sha256.Sum256([]byte(d.Kind + "\x00" + d.FunctionName + "\x00" + code))
+	hash = hex.EncodeToString(sum[:])
+	return hash
+}
+
+// Duplicate is another indexed copy of a search result's code, identifying
+// where it lives. The server fills in SourceURL as for results.
+type Duplicate struct {
+	ID        string `json:"id"`
+	Repo      string `json:"repo"`
+	FilePath  string `json:"file_path"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	SourceURL string `json:"source_url,omitempty"`
+}
+
+// maxMetadataKeyLength bounds metadata keys, which become field names.
+const maxMetadataKeyLength = 64
+
+// ValidMetadataKey reports whether key can name a metadata field: 1 to 64
+// ASCII letters, digits, underscores, or hyphens. Dots are excluded because
+// Elasticsearch would read them as nested objects.
+func ValidMetadataKey(key string) (valid bool) {
+	if key == "" || len(key) > maxMetadataKeyLength {
+		return valid
+	}
+
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return valid
+		}
+	}
+
+	valid = true
+	return valid
+}
+
+// Marker is a TODO or FIXME comment: its Tag, the line it is on, and the
+// text following the tag.
+type Marker struct {
+	Tag  string `json:"tag"`
+	Line int    `json:"line,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// Location is one place a declaration appears. A document whose code occurs
+// byte-for-byte in several places in a repository lists all of them.
+type Location struct {
+	FilePath  string `json:"file_path"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+}
+
+// TruncateCode limits Code to maxBytes, cutting at a UTF-8 boundary. The
+// complete body moves to CodeFull, which the index mapping keeps searchable
+// but excludes from _source. A maxBytes of zero or less disables truncation.
+func (d *CodeDocument) TruncateCode(maxBytes int) {
+	if maxBytes <= 0 || len(d.Code) <= maxBytes {
+		return
+	}
+
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(d.Code[cut]) {
+		cut--
+	}
+
+	d.CodeFull = d.Code
+	d.Code = d.Code[:cut]
+	d.CodeTruncated = true
+}
+
+// Chunks splits Code into windows of at most maxLines lines, each repeating
+// the last overlapLines lines of the previous one, so very large functions
+// stay within embedding limits and don't dominate text scoring. Chunks keep
+// the function's metadata and carry their own line range, with ChunkIndex
+// counting from 1. A document that fits, or a maxLines of zero or less,
+// is returned unchanged as the only chunk.
+func (d CodeDocument) Chunks(maxLines int, overlapLines int) (chunks []CodeDocument) {
+	lines := strings.SplitAfter(d.Code, "\n")
+	if maxLines <= 0 || len(lines) <= maxLines {
+		chunks = []CodeDocument{d}
+		return chunks
+	}
+
+	step := maxLines - max(overlapLines, 0)
+	if step <= 0 {
+		step = maxLines
+	}
+
+	for start := 0; ; start += step {
+		end := min(start+maxLines, len(lines))
+
+		chunk := d
+		chunk.Code = strings.Join(lines[start:end], "")
+		chunk.ChunkIndex = len(chunks) + 1
+		if d.StartLine > 0 {
+			chunk.StartLine = d.StartLine + start
+			chunk.EndLine = d.StartLine + end - 1
+		}
+		chunks = append(chunks, chunk)
+
+		if end == len(lines) {
+			break
+		}
+	}
+
+	for i := range chunks {
+		chunks[i].ChunkTotal = len(chunks)
+	}
+	return chunks
+}
+
+// SortComplexity orders search results simplest first.
+const SortComplexity = "complexity"
+
+// SearchRequest represents a search query request. Zero complexity limits
+// and empty Kinds or Calls disable the corresponding filter. Calls and
+// PreferCalls name a called function as recorded ("http.Get") or by its bare
+// method name ("Close"), which matches any receiver. Types restricts results
+// to document types; DocTypeCode also matches documents indexed before types
+// existed. Repos, Packages, Imports, Modules, and Dependencies keep
+// documents matching any of the given values, as offered by the facets, and Implements those implementing
+// any of the interfaces, by full import path ("io.Reader"). Platform
+// ("linux/amd64") keeps documents without build constraints and those that
+// build on it, as recorded with INDEX_PLATFORMS. ExportedOnly keeps only
+// exported declarations, a package's public API, and ExcludeDeprecated
+// drops deprecated ones. Metadata keeps only
+// documents whose enrichment fields equal the given values. CollapseChunks returns only the
+// best-scoring chunk of each chunked function. CollapseDuplicates returns only
+// the best-scoring copy of code indexed in several places, listing the
+// others in its Duplicates. IncludeContext adds to each result the types it
+// refers to and the helpers it calls from its own package, and IncludeTests
+// the tests linked to it. Rerank asks the server to
+// reorder the results with the configured reranker; it doesn't change the
+// Elasticsearch query. Ranking, FieldBoosts, and FlagBoosts override the
+// configured relevance settings, weight by weight.
 type SearchRequest struct {
-	Query string `json:"query"`
-	Limit int    `json:"limit"`
+	Query                   string             `json:"query"`
+	Limit                   int                `json:"limit"`
+	MaxCyclomaticComplexity int                `json:"max_cyclomatic_complexity,omitempty"`
+	MaxCognitiveComplexity  int                `json:"max_cognitive_complexity,omitempty"`
+	Sort                    string             `json:"sort,omitempty"`
+	Types                   []string           `json:"types,omitempty"`
+	Kinds                   []string           `json:"kinds,omitempty"`
+	Repos                   []string           `json:"repos,omitempty"`
+	Packages                []string           `json:"packages,omitempty"`
+	Imports                 []string           `json:"imports,omitempty"`
+	Modules                 []string           `json:"modules,omitempty"`
+	Dependencies            []string           `json:"dependencies,omitempty"`
+	Implements              []string           `json:"implements,omitempty"`
+	Platform                string             `json:"platform,omitempty"`
+	ExportedOnly            bool               `json:"exported_only,omitempty"`
+	ExcludeDeprecated       bool               `json:"exclude_deprecated,omitempty"`
+	Calls                   []string           `json:"calls,omitempty"`
+	PreferCalls             []string           `json:"prefer_calls,omitempty"`
+	Metadata                map[string]string  `json:"metadata,omitempty"`
+	CollapseChunks          bool               `json:"collapse_chunks,omitempty"`
+	CollapseDuplicates      bool               `json:"collapse_duplicates,omitempty"`
+	Ranking                 string             `json:"ranking,omitempty"`
+	FieldBoosts             map[string]float64 `json:"field_boosts,omitempty"`
+	FlagBoosts              map[string]float64 `json:"flag_boosts,omitempty"`
+	Rerank                  bool               `json:"rerank,omitempty"`
+	Rewrite                 bool               `json:"rewrite,omitempty"`
+	IncludeContext          bool               `json:"include_context,omitempty"`
+	IncludeTests            bool               `json:"include_tests,omitempty"`
+	Debug                   bool               `json:"debug,omitempty"`
 }
 
 // SearchResponse represents the Elasticsearch search response.
 type SearchResponse struct {
 	Hits struct {
 		Hits []struct {
-			Source CodeDocument `json:"_source"`
+			ID        string       `json:"_id"`
+			Score     float64      `json:"_score"`
+			Source    CodeDocument `json:"_source"`
+			InnerHits struct {
+				Duplicates struct {
+					Hits struct {
+						Hits []struct {
+							ID     string       `json:"_id"`
+							Source CodeDocument `json:"_source"`
+						} `json:"hits"`
+					} `json:"hits"`
+				} `json:"duplicates"`
+			} `json:"inner_hits"`
 		} `json:"hits"`
 	} `json:"hits"`
 }
@@ -2,6 +2,7 @@ package elasticsearch
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 )
@@ -166,3 +167,174 @@ func TestCodeDocumentEmptyImports(t *testing.T) {
 		t.Error("Imports is nil, should be empty slice")
 	}
 }
+
+func TestCodeDocumentTruncateCode(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		maxBytes      int
+		wantCode      string
+		wantFull      string
+		wantTruncated bool
+	}{
+		{
+			name:     "disabled",
+			code:     "func Foo() {}",
+			maxBytes: 0,
+			wantCode: "func Foo() {}",
+		},
+		{
+			name:     "within limit",
+			code:     "func Foo() {}",
+			maxBytes: 100,
+			wantCode: "func Foo() {}",
+		},
+		{
+			name:          "over limit",
+			code:          "func Foo() {}",
+			maxBytes:      8,
+			wantCode:      "func Foo",
+			wantFull:      "func Foo() {}",
+			wantTruncated: true,
+		},
+		{
+			name:          "multibyte boundary",
+			code:          "s := \"héllo\"",
+			maxBytes:      8,
+			wantCode:      "s := \"h",
+			wantFull:      "s := \"héllo\"",
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := CodeDocument{Code: tt.code}
+			doc.TruncateCode(tt.maxBytes)
+
+			if doc.Code != tt.wantCode {
+				t.Errorf("Code = %q, want %q", doc.Code, tt.wantCode)
+			}
+			if doc.CodeFull != tt.wantFull {
+				t.Errorf("CodeFull = %q, want %q", doc.CodeFull, tt.wantFull)
+			}
+			if doc.CodeTruncated != tt.wantTruncated {
+				t.Errorf("CodeTruncated = %v, want %v", doc.CodeTruncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestCodeDocumentChunks(t *testing.T) {
+	code := "l1\nl2\nl3\nl4\nl5\nl6\nl7"
+
+	tests := []struct {
+		name      string
+		maxLines  int
+		overlap   int
+		wantCode  []string
+		wantLines [][2]int
+	}{
+		{
+			name:      "disabled",
+			maxLines:  0,
+			wantCode:  []string{code},
+			wantLines: [][2]int{{10, 16}},
+		},
+		{
+			name:      "fits",
+			maxLines:  7,
+			wantCode:  []string{code},
+			wantLines: [][2]int{{10, 16}},
+		},
+		{
+			name:      "overlapping chunks",
+			maxLines:  3,
+			overlap:   1,
+			wantCode:  []string{"l1\nl2\nl3\n", "l3\nl4\nl5\n", "l5\nl6\nl7"},
+			wantLines: [][2]int{{10, 12}, {12, 14}, {14, 16}},
+		},
+		{
+			name:      "short final chunk",
+			maxLines:  4,
+			overlap:   0,
+			wantCode:  []string{"l1\nl2\nl3\nl4\n", "l5\nl6\nl7"},
+			wantLines: [][2]int{{10, 13}, {14, 16}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := CodeDocument{FunctionName: "Big", Code: code, StartLine: 10, EndLine: 16, ContentHash: "abc"}
+			chunks := doc.Chunks(tt.maxLines, tt.overlap)
+
+			if len(chunks) != len(tt.wantCode) {
+				t.Fatalf("chunks = %d, want %d", len(chunks), len(tt.wantCode))
+			}
+			for i, chunk := range chunks {
+				if chunk.Code != tt.wantCode[i] {
+					t.Errorf("chunk %d Code = %q, want %q", i, chunk.Code, tt.wantCode[i])
+				}
+				if chunk.StartLine != tt.wantLines[i][0] || chunk.EndLine != tt.wantLines[i][1] {
+					t.Errorf("chunk %d lines = %d-%d, want %d-%d", i, chunk.StartLine, chunk.EndLine, tt.wantLines[i][0], tt.wantLines[i][1])
+				}
+				if chunk.FunctionName != "Big" || chunk.ContentHash != "abc" {
+					t.Errorf("chunk %d lost function metadata", i)
+				}
+
+				wantIndex, wantTotal := i+1, len(chunks)
+				if len(chunks) == 1 {
+					wantIndex, wantTotal = 0, 0
+				}
+				if chunk.ChunkIndex != wantIndex || chunk.ChunkTotal != wantTotal {
+					t.Errorf("chunk %d = %d of %d, want %d of %d", i, chunk.ChunkIndex, chunk.ChunkTotal, wantIndex, wantTotal)
+				}
+			}
+		})
+	}
+}
+
+func TestCodeDocumentNormalizedCodeHash(t *testing.T) {
+	doc := CodeDocument{Kind: KindFunction, FunctionName: "Retry", Code: "func Retry() error {\n\treturn nil\n}"}
+
+	tests := []struct {
+		name string
+		doc  CodeDocument
+		same bool
+	}{
+		{name: "reindented with CRLF", doc: CodeDocument{Kind: KindFunction, FunctionName: "Retry", Code: "func Retry() error {\r\n    return nil\r\n}\r\n"}, same: true},
+		{name: "other repository", doc: CodeDocument{Repo: "fork", Kind: KindFunction, FunctionName: "Retry", Code: doc.Code}, same: true},
+		{name: "other name", doc: CodeDocument{Kind: KindFunction, FunctionName: "Again", Code: doc.Code}},
+		{name: "other code", doc: CodeDocument{Kind: KindFunction, FunctionName: "Retry", Code: "func Retry() error {\n\treturn err\n}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same := tt.doc.NormalizedCodeHash() == doc.NormalizedCodeHash()
+			if same != tt.same {
+				t.Errorf("hashes equal = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestValidMetadataKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "team", want: true},
+		{key: "service-tier_2", want: true},
+		{key: "", want: false},
+		{key: "owner.team", want: false},
+		{key: "on call", want: false},
+		{key: strings.Repeat("k", 65), want: false},
+	}
+
+	for _, tt := range tests {
+		got := ValidMetadataKey(tt.key)
+		if got != tt.want {
+			t.Errorf("ValidMetadataKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
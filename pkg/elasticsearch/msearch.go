@@ -0,0 +1,94 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// multiSearchResponse is the subset of an _msearch response used by the
+// indexer. Each response is a search response, or an error with its status.
+type multiSearchResponse struct {
+	Responses []struct {
+		SearchResponse
+
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"responses"`
+}
+
+// MultiSearch runs searches in one _msearch round trip and returns their
+// results in the order of the requests. A search Elasticsearch fails fails
+// them all, with the StatusError of the first to fail.
+func (es *Client) MultiSearch(ctx context.Context, searchReqs []SearchRequest) (results [][]CodeDocument, err error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, searchReq := range searchReqs {
+		// The index is in the URL, so each search's header is empty.
+		err = enc.Encode(struct{}{})
+		if err == nil {
+			err = enc.Encode(es.SearchQuery(searchReq))
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to marshal query: %w", err)
+			return results, err
+		}
+	}
+
+	url := fmt.Sprintf("%s/%s/_msearch", es.host, es.index)
+
+	var req *http.Request
+	req, err = es.newBodyRequest(ctx, http.MethodPost, url, "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return results, err
+	}
+
+	es.authorize(req)
+
+	var resp *http.Response
+	resp, err = es.doRequestWithRetry(req)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("msearch", "error").Inc()
+		err = fmt.Errorf("failed to execute multi-search: %w", err)
+		return results, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(resp.Body)
+		es.metrics.ESRequests.WithLabelValues("msearch", "error").Inc()
+		err = newStatusError(resp, respBody)
+		return results, err
+	}
+
+	var msearchResp multiSearchResponse
+	err = json.NewDecoder(resp.Body).Decode(&msearchResp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return results, err
+	}
+	if len(msearchResp.Responses) != len(searchReqs) {
+		err = fmt.Errorf("multi-search returned %d responses for %d searches", len(msearchResp.Responses), len(searchReqs))
+		return results, err
+	}
+
+	for i, searchResp := range msearchResp.Responses {
+		if searchResp.Error != nil || searchResp.Status >= http.StatusMultipleChoices {
+			es.metrics.ESRequests.WithLabelValues("msearch", "error").Inc()
+			err = fmt.Errorf("search %d failed: %w", i, &StatusError{
+				StatusCode: searchResp.Status,
+				Status:     fmt.Sprintf("%d %s", searchResp.Status, http.StatusText(searchResp.Status)),
+				Body:       string(searchResp.Error),
+			})
+			results = nil
+			return results, err
+		}
+		results = append(results, searchResults(searchReqs[i], searchResp.SearchResponse))
+	}
+
+	es.metrics.ESRequests.WithLabelValues("msearch", "success").Inc()
+	return results, err
+}
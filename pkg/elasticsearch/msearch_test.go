@@ -0,0 +1,69 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMultiSearch(t *testing.T) {
+	var lines []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test-index/_msearch" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("request = %s %s, want ndjson to /test-index/_msearch", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]any
+			err := json.Unmarshal(scanner.Bytes(), &line)
+			if err != nil {
+				t.Errorf("line %q is not JSON: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+
+		_, _ = w.Write([]byte(`{"responses":[` +
+			`{"status":200,"hits":{"hits":[{"_id":"a","_score":2,"_source":{"repo":"api","function_name":"Retry"}}]}},` +
+			`{"status":200,"hits":{"hits":[]}}]}`))
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	results, err := es.MultiSearch(t.Context(), []SearchRequest{{Query: "retry", Limit: 5}, {Query: "backoff"}})
+	if err != nil {
+		t.Fatalf("MultiSearch() error = %v", err)
+	}
+
+	if len(lines) != 4 || len(lines[0]) != 0 || lines[1]["size"] != float64(5) {
+		t.Errorf("body = %v, want an empty header and a query per search", lines)
+	}
+	if len(results) != 2 || len(results[0]) != 1 || len(results[1]) != 0 {
+		t.Fatalf("MultiSearch() = %v, want one result, then none", results)
+	}
+	if results[0][0].ID != "a" || results[0][0].Score != 2 || results[0][0].FunctionName != "Retry" {
+		t.Errorf("result = %+v, want Retry with its ID and score", results[0][0])
+	}
+}
+
+func TestMultiSearchFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"responses":[` +
+			`{"status":200,"hits":{"hits":[]}},` +
+			`{"status":400,"error":{"type":"search_phase_execution_exception"}}]}`))
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	results, err := es.MultiSearch(t.Context(), []SearchRequest{{Query: "retry"}, {Query: "backoff"}})
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("MultiSearch() error = %v, want ErrBadRequest", err)
+	}
+	if results != nil {
+		t.Errorf("MultiSearch() = %v, want no results", results)
+	}
+}
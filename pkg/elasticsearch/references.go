@@ -0,0 +1,61 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// References returns the indexed declarations that use symbol, a
+// package-qualified name such as "retry.Do" or "retry.Policy.Next", by
+// calling it (Callees) or otherwise (Uses), at most limit of them, in
+// repos when any are given. Declarations come back in order of repository,
+// file, and line; each chunk of a chunked one is a document of its own.
+func (es *Client) References(ctx context.Context, symbol string, repos []string, limit int) (docs []CodeDocument, err error) {
+	filters := []map[string]interface{}{}
+	if len(repos) > 0 {
+		filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{"repo": repos}})
+	}
+
+	query := map[string]interface{}{
+		"size": limit,
+		"sort": []map[string]interface{}{
+			{"repo": map[string]interface{}{"order": "asc"}},
+			{"file_path": map[string]interface{}{"order": "asc"}},
+			{"start_line": map[string]interface{}{"order": "asc", "unmapped_type": "integer"}},
+		},
+		"_source": map[string]interface{}{"excludes": []string{EmbeddingField}},
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"filter": filters,
+			"should": []map[string]interface{}{
+				{"term": map[string]interface{}{"callees": symbol}},
+				{"term": map[string]interface{}{"uses": symbol}},
+			},
+			"minimum_should_match": 1,
+		}},
+	}
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_search", es.host, es.index), query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("references", "error").Inc()
+		err = fmt.Errorf("failed to find references: %w", err)
+		return docs, err
+	}
+
+	var searchResp SearchResponse
+	err = json.Unmarshal(body, &searchResp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return docs, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("references", "success").Inc()
+
+	for _, hit := range searchResp.Hits.Hits {
+		hit.Source.ID = hit.ID
+		docs = append(docs, hit.Source)
+	}
+	return docs, err
+}
@@ -0,0 +1,34 @@
+package elasticsearch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		query = string(body)
+		_, _ = w.Write([]byte(`{"hits":{"hits":[{"_id":"h","_source":{"repo":"api","file_path":"server/handler.go","function_name":"Handle","callees":["retry.Do"]}}]}}`))
+	}))
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	docs, err := client.References(t.Context(), "retry.Do", []string{"api"}, 25)
+	if err != nil {
+		t.Fatalf("References() error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].ID != "h" || docs[0].FunctionName != "Handle" {
+		t.Errorf("References() = %+v, want Handle", docs)
+	}
+
+	for _, part := range []string{`{"term":{"callees":"retry.Do"}}`, `{"term":{"uses":"retry.Do"}}`, `{"terms":{"repo":["api"]}}`, `"size":25`} {
+		if !strings.Contains(query, part) {
+			t.Errorf("query = %s, want %s", query, part)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// maxContextLookups caps the distinct declarations IncludeContext looks up
+// for one set of results, so a page of large functions can't make a huge
+// query.
+const maxContextLookups = 200
+
+// contextCandidates is how many matches IncludeContext fetches for each
+// declaration it looks up, leaving room for the same name in other
+// directories of a package and for chunks.
+const contextCandidates = 4
+
+// maxContextPerResult caps the declarations added to one result.
+const maxContextPerResult = 10
+
+// contextLookup is a declaration a result refers to: a type from References
+// or a helper from Calls, in the result's repository and the package named.
+// local lookups are in the result's own package, so they also match only
+// declarations from its directory; the package name alone may be shared by
+// other directories.
+type contextLookup struct {
+	repo  string
+	pkg   string
+	name  string
+	types bool
+	local bool
+	dir   string
+}
+
+// key identifies the declarations a lookup matches in the query.
+func (l contextLookup) key() (key string) {
+	key = l.repo + "\x00" + l.pkg + "\x00" + l.name
+	return key
+}
+
+// matches reports whether doc is the declaration a lookup is for.
+func (l contextLookup) matches(doc CodeDocument) (matches bool) {
+	if doc.Repo != l.repo || doc.Package != l.pkg || doc.FunctionName != l.name {
+		return matches
+	}
+	if l.local && filepath.Dir(doc.FilePath) != l.dir {
+		return matches
+	}
+	if l.types {
+		matches = doc.Kind == KindType || doc.Kind == KindInterface
+		return matches
+	}
+	matches = doc.Kind == KindFunction
+	return matches
+}
+
+// contextLookups lists the declarations a result refers to: the types in its
+// References, bare ones in its own package and qualified ones in the package
+// they name, and the functions in its Calls that are called by bare name, so
+// are from its own package. Method calls can't be resolved without knowing
+// their receiver's type, so they aren't looked up.
+func contextLookups(result CodeDocument) (lookups []contextLookup) {
+	dir := filepath.Dir(result.FilePath)
+	for _, ref := range result.References {
+		pkg, name, qualified := strings.Cut(ref, ".")
+		if !qualified {
+			lookups = append(lookups, contextLookup{repo: result.Repo, pkg: result.Package, name: ref, types: true, local: true, dir: dir})
+			continue
+		}
+		lookups = append(lookups, contextLookup{repo: result.Repo, pkg: pkg, name: name, types: true})
+	}
+	for _, call := range result.Calls {
+		if strings.Contains(call, ".") || call == result.FunctionName {
+			continue
+		}
+		lookups = append(lookups, contextLookup{repo: result.Repo, pkg: result.Package, name: call, local: true, dir: dir})
+	}
+	return lookups
+}
+
+// IncludeContext returns the results with the declarations each refers to in
+// its Context, looked up in one search: the types it references and the
+// helper functions it calls from its own package, as recorded at index time
+// for Go code. Calls to declarations that aren't indexed, such as builtins
+// and other modules, find nothing. Of a chunked declaration, its first chunk
+// is included. The results themselves are unchanged otherwise.
+func (es *Client) IncludeContext(ctx context.Context, results []CodeDocument) (expanded []CodeDocument, err error) {
+	expanded = results
+
+	perResult := make([][]contextLookup, len(results))
+	seen := map[string]bool{}
+	var should []map[string]interface{}
+	for i, result := range results {
+		for _, lookup := range contextLookups(result) {
+			key := lookup.key()
+			if !seen[key] {
+				if len(seen) == maxContextLookups {
+					continue
+				}
+				seen[key] = true
+				should = append(should, map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+					{"term": map[string]interface{}{"repo": lookup.repo}},
+					{"term": map[string]interface{}{"package": lookup.pkg}},
+					{"term": map[string]interface{}{"function_name": lookup.name}},
+				}}})
+			}
+			perResult[i] = append(perResult[i], lookup)
+		}
+	}
+	if len(should) == 0 {
+		return expanded, err
+	}
+
+	query := map[string]interface{}{
+		"size": len(should) * contextCandidates,
+		"sort": []map[string]interface{}{
+			{"chunk_index": map[string]interface{}{"order": "asc", "missing": "_first", "unmapped_type": "integer"}},
+			{"indexed_at": map[string]interface{}{"order": "desc", "unmapped_type": "date"}},
+		},
+		"_source": map[string]interface{}{"excludes": []string{EmbeddingField}},
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				{"terms": map[string]interface{}{"kind": []string{KindFunction, KindType, KindInterface}}},
+			},
+			"should":               should,
+			"minimum_should_match": 1,
+		}},
+	}
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_search", es.host, es.index), query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("include_context", "error").Inc()
+		err = fmt.Errorf("failed to look up context: %w", err)
+		return expanded, err
+	}
+
+	var searchResp SearchResponse
+	err = json.Unmarshal(body, &searchResp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return expanded, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("include_context", "success").Inc()
+
+	candidates := make([]CodeDocument, 0, len(searchResp.Hits.Hits))
+	for _, hit := range searchResp.Hits.Hits {
+		hit.Source.ID = hit.ID
+		candidates = append(candidates, hit.Source)
+	}
+
+	expanded = make([]CodeDocument, len(results))
+	for i, result := range results {
+		expanded[i] = result
+		expanded[i].Context = relatedDeclarations(result, perResult[i], candidates)
+	}
+	return expanded, err
+}
+
+// relatedDeclarations picks the candidate each of a result's lookups is for,
+// the first that matches, leaving out the result itself and declarations
+// already picked, up to maxContextPerResult.
+func relatedDeclarations(result CodeDocument, lookups []contextLookup, candidates []CodeDocument) (related []CodeDocument) {
+	picked := map[string]bool{result.Repo + "\x00" + result.FilePath + "\x00" + result.FunctionName: true}
+	for _, lookup := range lookups {
+		if len(related) == maxContextPerResult {
+			break
+		}
+		for _, candidate := range candidates {
+			key := candidate.Repo + "\x00" + candidate.FilePath + "\x00" + candidate.FunctionName
+			if picked[key] || !lookup.matches(candidate) {
+				continue
+			}
+			picked[key] = true
+			related = append(related, candidate)
+			break
+		}
+	}
+	return related
+}
@@ -0,0 +1,81 @@
+package elasticsearch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIncludeContext(t *testing.T) {
+	var requests int
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		query = string(body)
+		_, _ = w.Write([]byte(`{"hits":{"hits":[` +
+			`{"_id":"p","_source":{"repo":"api","file_path":"/repos/api/retry/policy.go","package":"retry","kind":"type","function_name":"Policy"}},` +
+			`{"_id":"b","_source":{"repo":"api","file_path":"/repos/api/retry/backoff.go","package":"retry","kind":"function","function_name":"backoff"}},` +
+			`{"_id":"o","_source":{"repo":"api","file_path":"/repos/api/other/retry/backoff.go","package":"retry","kind":"function","function_name":"backoff"}},` +
+			`{"_id":"c","_source":{"repo":"api","file_path":"/repos/api/config/config.go","package":"config","kind":"type","function_name":"Config"}}]}}`))
+	}))
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	plain := []CodeDocument{{Repo: "api", FilePath: "/repos/api/README.md", FunctionName: "Usage"}}
+	expanded, err := client.IncludeContext(t.Context(), plain)
+	if err != nil || requests != 0 || len(expanded) != 1 || expanded[0].Context != nil {
+		t.Errorf("IncludeContext() without references = %+v, %v after %d requests, want the results as they were", expanded, err, requests)
+	}
+
+	results := []CodeDocument{
+		{
+			Repo:         "api",
+			FilePath:     "/repos/api/retry/retry.go",
+			Package:      "retry",
+			Kind:         KindFunction,
+			FunctionName: "Do",
+			Calls:        []string{"Do", "backoff", "fmt.Errorf", "time.Sleep"},
+			References:   []string{"Policy", "config.Config"},
+		},
+		{
+			Repo:         "api",
+			FilePath:     "/repos/api/retry/backoff.go",
+			Package:      "retry",
+			Kind:         KindFunction,
+			FunctionName: "backoff",
+			References:   []string{"Policy"},
+		},
+	}
+	expanded, err = client.IncludeContext(t.Context(), results)
+	if err != nil {
+		t.Fatalf("IncludeContext() error = %v", err)
+	}
+
+	ids := func(docs []CodeDocument) (ids string) {
+		for _, doc := range docs {
+			ids += doc.ID
+		}
+		return ids
+	}
+	if got := ids(expanded[0].Context); got != "pcb" {
+		t.Errorf("Do's context = %q, want Policy, Config, and its package's backoff", got)
+	}
+	if got := ids(expanded[1].Context); got != "p" {
+		t.Errorf("backoff's context = %q, want Policy", got)
+	}
+	if results[0].Context != nil {
+		t.Error("IncludeContext() changed the results given")
+	}
+
+	for _, part := range []string{`{"term":{"function_name":"backoff"}}`, `{"term":{"package":"config"}}`, `"size":12`} {
+		if !strings.Contains(query, part) {
+			t.Errorf("query = %s, want %s", query, part)
+		}
+	}
+	if strings.Contains(query, `"Errorf"`) || strings.Contains(query, `{"term":{"function_name":"Do"}}`) {
+		t.Errorf("query = %s, want no lookups of method calls or the result itself", query)
+	}
+}
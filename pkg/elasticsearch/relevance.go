@@ -0,0 +1,211 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// Ranking modes. RankingBoost, the default, multiplies the relevance score by
+// the flag boosts, so a much better text match wins over a style flag.
+// RankingSort keeps the original ordering for compatibility: the style flags
+// sort before relevance, so any declaration or function with named returns
+// outranks every one without.
+const (
+	RankingSort  = "sort"
+	RankingBoost = "boost"
+)
+
+// boostFields are the fields a query matches, in the order it lists them.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var boostFields = []string{"function_name", "summary", "code", "code_full", "package"}
+
+// styleFlags are the boolean fields that can boost a result's score for how
+// it is written. Declarations other than functions and methods have none
+// to set and count as having them all.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var styleFlags = []string{"has_namedreturns", "has_error_handling", "lint_compliant"}
+
+// usageFlags are the boolean fields that can weight a result's score for
+// what its code does. Only code that does it has them, so a weight below 1
+// ranks such code down.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var usageFlags = []string{"uses_panic", "spawns_goroutines", "uses_unsafe", "uses_reflection", "uses_cgo"}
+
+// boostFlags are the boolean fields that can weight a result's score.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var boostFlags = slices.Concat(styleFlags, usageFlags)
+
+// DefaultFieldBoosts returns the field weights used when neither the
+// configuration nor the request sets one. A generated summary describes what
+// the code does in the words a question would use, so it weighs the most.
+func DefaultFieldBoosts() (boosts map[string]float64) {
+	boosts = map[string]float64{"function_name": 3, "summary": 4, "code": 2, "code_full": 2, "package": 1}
+	return boosts
+}
+
+// DefaultFlagBoosts returns the flag weights used in boost ranking when
+// neither the configuration nor the request sets one. They keep the order of
+// the sort mode: named returns count for more than error handling. Code that
+// panics or uses unsafe makes a poor example to follow, so it is ranked down.
+func DefaultFlagBoosts() (boosts map[string]float64) {
+	boosts = map[string]float64{"has_namedreturns": 2, "has_error_handling": 1.5, "uses_panic": 0.5, "uses_unsafe": 0.5}
+	return boosts
+}
+
+// ValidBoostField reports whether a field can be given a boost weight.
+func ValidBoostField(field string) (valid bool) {
+	valid = slices.Contains(boostFields, field)
+	return valid
+}
+
+// ValidBoostFlag reports whether a flag can be given a boost weight.
+func ValidBoostFlag(flag string) (valid bool) {
+	valid = slices.Contains(boostFlags, flag)
+	return valid
+}
+
+// ValidRanking reports whether a ranking mode is known. An empty mode takes
+// the configured default.
+func ValidRanking(ranking string) (valid bool) {
+	valid = ranking == "" || ranking == RankingSort || ranking == RankingBoost
+	return valid
+}
+
+// SearchQuery builds the search body the client sends for a request, with the
+// configured relevance settings under the request's own.
+func (es *Client) SearchQuery(req SearchRequest) (searchQuery map[string]interface{}) {
+	searchQuery = BuildSearchQuery(es.withRelevance(req))
+	return searchQuery
+}
+
+// withRelevance fills in the configured ranking mode and boosts that the
+// request doesn't set. Weights the request sets replace the configured ones
+// field by field.
+func (es *Client) withRelevance(req SearchRequest) (out SearchRequest) {
+	out = req
+	if out.Ranking == "" {
+		out.Ranking = es.ranking
+	}
+	out.FieldBoosts = mergeBoosts(es.fieldBoosts, req.FieldBoosts)
+	out.FlagBoosts = mergeBoosts(es.flagBoosts, req.FlagBoosts)
+	return out
+}
+
+// mergeBoosts returns base with overrides applied, or nil when both are empty.
+func mergeBoosts(base map[string]float64, overrides map[string]float64) (merged map[string]float64) {
+	if len(base) == 0 && len(overrides) == 0 {
+		return merged
+	}
+
+	merged = maps.Clone(base)
+	if merged == nil {
+		merged = make(map[string]float64, len(overrides))
+	}
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// matchFields renders the query's fields with their weights in Elasticsearch's
+// field^weight form, over the defaults.
+func matchFields(boosts map[string]float64) (fields []string) {
+	weights := mergeBoosts(DefaultFieldBoosts(), boosts)
+	for _, field := range boostFields {
+		weight, found := weights[field]
+		if !found {
+			continue
+		}
+		if weight == 1 {
+			fields = append(fields, field)
+			continue
+		}
+		fields = append(fields, field+"^"+strconv.FormatFloat(weight, 'f', -1, 64))
+	}
+	return fields
+}
+
+// flagBoostQuery wraps a query in a function score that multiplies the
+// relevance of each result by the weight of every flag it has, over the
+// defaults. As in the sort mode, declarations other than functions and methods
+// have no style flags to set and count as having them all.
+func flagBoostQuery(query map[string]interface{}, boosts map[string]float64) (boosted map[string]interface{}) {
+	weights := mergeBoosts(DefaultFlagBoosts(), boosts)
+
+	notFunction := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter":   map[string]interface{}{"exists": map[string]interface{}{"field": "kind"}},
+			"must_not": map[string]interface{}{"terms": map[string]interface{}{"kind": []string{KindFunction, KindMethod}}},
+		},
+	}
+
+	functions := make([]map[string]interface{}, 0, len(weights))
+	for _, flag := range boostFlags {
+		weight, found := weights[flag]
+		if !found || weight == 1 {
+			continue
+		}
+		filter := map[string]interface{}{"term": map[string]interface{}{flag: true}}
+		if slices.Contains(styleFlags, flag) {
+			filter = map[string]interface{}{
+				"bool": map[string]interface{}{
+					"should": []map[string]interface{}{
+						filter,
+						notFunction,
+					},
+					"minimum_should_match": 1,
+				},
+			}
+		}
+		functions = append(functions, map[string]interface{}{
+			"filter": filter,
+			"weight": weight,
+		})
+	}
+	if len(functions) == 0 {
+		boosted = query
+		return boosted
+	}
+
+	boosted = map[string]interface{}{
+		"function_score": map[string]interface{}{
+			"query":      query,
+			"functions":  functions,
+			"score_mode": "multiply",
+			"boost_mode": "multiply",
+		},
+	}
+	return boosted
+}
+
+// validateRelevance checks the configured ranking mode, and that the
+// configured boosts name fields and flags a query can weight.
+func validateRelevance(cfg config.Config) (err error) {
+	if !ValidRanking(cfg.SearchRanking) {
+		err = fmt.Errorf("invalid SEARCH_RANKING %q: use %s or %s", cfg.SearchRanking, RankingSort, RankingBoost)
+		return err
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(cfg.SearchFieldBoosts)) {
+		if !ValidBoostField(field) {
+			err = fmt.Errorf("invalid SEARCH_FIELD_BOOSTS field %q: use %s", field, strings.Join(boostFields, ", "))
+			return err
+		}
+	}
+
+	for _, flag := range slices.Sorted(maps.Keys(cfg.SearchFlagBoosts)) {
+		if !ValidBoostFlag(flag) {
+			err = fmt.Errorf("invalid SEARCH_FLAG_BOOSTS flag %q: use %s", flag, strings.Join(boostFlags, ", "))
+			return err
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,174 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestSearchQueryRelevance(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		req           SearchRequest
+		wantFields    []string
+		wantFunctions int
+		wantFirstSort string
+	}{
+		{
+			name:          "defaults",
+			req:           SearchRequest{Query: "handler"},
+			wantFields:    []string{"function_name^3", "summary^4", "code^2", "code_full^2", "package"},
+			wantFunctions: 4,
+			wantFirstSort: "_score",
+		},
+		{
+			name:          "configured field boosts",
+			cfg:           config.Config{SearchFieldBoosts: map[string]float64{"function_name": 5, "package": 0.5}},
+			req:           SearchRequest{Query: "handler"},
+			wantFields:    []string{"function_name^5", "summary^4", "code^2", "code_full^2", "package^0.5"},
+			wantFunctions: 4,
+			wantFirstSort: "_score",
+		},
+		{
+			name:          "request overrides the configuration",
+			cfg:           config.Config{SearchFieldBoosts: map[string]float64{"function_name": 5}},
+			req:           SearchRequest{Query: "handler", FieldBoosts: map[string]float64{"function_name": 1, "code": 4}},
+			wantFields:    []string{"function_name", "summary^4", "code^4", "code_full^2", "package"},
+			wantFunctions: 4,
+			wantFirstSort: "_score",
+		},
+		{
+			name:          "configured sort ranking",
+			cfg:           config.Config{SearchRanking: RankingSort},
+			req:           SearchRequest{Query: "handler"},
+			wantFields:    []string{"function_name^3", "summary^4", "code^2", "code_full^2", "package"},
+			wantFirstSort: "_script",
+		},
+		{
+			name:          "request boost ranking with a neutral flag",
+			req:           SearchRequest{Query: "handler", Ranking: RankingBoost, FlagBoosts: map[string]float64{"has_error_handling": 1, "lint_compliant": 1.2}},
+			wantFields:    []string{"function_name^3", "summary^4", "code^2", "code_full^2", "package"},
+			wantFunctions: 4,
+			wantFirstSort: "_score",
+		},
+		{
+			name:          "request neutralizes the usage flags and weights another",
+			req:           SearchRequest{Query: "handler", FlagBoosts: map[string]float64{"uses_panic": 1, "uses_unsafe": 1, "spawns_goroutines": 0.8}},
+			wantFields:    []string{"function_name^3", "summary^4", "code^2", "code_full^2", "package"},
+			wantFunctions: 3,
+			wantFirstSort: "_score",
+		},
+		{
+			name:          "request sort ranking over configured boost",
+			cfg:           config.Config{SearchRanking: RankingBoost},
+			req:           SearchRequest{Query: "handler", Ranking: RankingSort},
+			wantFields:    []string{"function_name^3", "summary^4", "code^2", "code_full^2", "package"},
+			wantFirstSort: "_script",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, err := New(tt.cfg, nil)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			data, err := json.Marshal(es.SearchQuery(tt.req))
+			if err != nil {
+				t.Fatalf("Failed to marshal query: %v", err)
+			}
+
+			type multiMatch struct {
+				Fields []string `json:"fields"`
+			}
+			var body struct {
+				Query struct {
+					MultiMatch    *multiMatch `json:"multi_match"`
+					FunctionScore struct {
+						Query struct {
+							MultiMatch *multiMatch `json:"multi_match"`
+						} `json:"query"`
+						Functions []map[string]any `json:"functions"`
+					} `json:"function_score"`
+				} `json:"query"`
+				Sort []map[string]any `json:"sort"`
+			}
+			err = json.Unmarshal(data, &body)
+			if err != nil {
+				t.Fatalf("Failed to decode query: %v", err)
+			}
+
+			match := body.Query.MultiMatch
+			if match == nil {
+				match = body.Query.FunctionScore.Query.MultiMatch
+			}
+			if match == nil {
+				t.Fatalf("query = %s, want a multi_match", data)
+			}
+			if !slices.Equal(match.Fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", match.Fields, tt.wantFields)
+			}
+			if len(body.Query.FunctionScore.Functions) != tt.wantFunctions {
+				t.Errorf("boost functions = %d, want %d", len(body.Query.FunctionScore.Functions), tt.wantFunctions)
+			}
+			_, found := body.Sort[0][tt.wantFirstSort]
+			if !found {
+				t.Errorf("first sort = %v, want %s", body.Sort[0], tt.wantFirstSort)
+			}
+		})
+	}
+}
+
+func TestFlagBoostQueryUsageFlags(t *testing.T) {
+	boosted := flagBoostQuery(map[string]interface{}{"match_all": map[string]interface{}{}}, map[string]float64{"has_namedreturns": 1, "has_error_handling": 1})
+	data, err := json.Marshal(boosted)
+	if err != nil {
+		t.Fatalf("Failed to marshal query: %v", err)
+	}
+
+	var body struct {
+		FunctionScore struct {
+			Functions []struct {
+				Filter map[string]any `json:"filter"`
+				Weight float64        `json:"weight"`
+			} `json:"functions"`
+		} `json:"function_score"`
+	}
+	err = json.Unmarshal(data, &body)
+	if err != nil {
+		t.Fatalf("Failed to decode query: %v", err)
+	}
+
+	if len(body.FunctionScore.Functions) != 2 {
+		t.Fatalf("functions = %s, want uses_panic and uses_unsafe", data)
+	}
+	for _, function := range body.FunctionScore.Functions {
+		if _, isTerm := function.Filter["term"]; !isTerm || function.Weight != 0.5 {
+			t.Errorf("function = %+v, want a plain term on the flag weighted 0.5, which other declarations don't count as having", function)
+		}
+	}
+}
+
+func TestNewInvalidRelevance(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{name: "unknown ranking", cfg: config.Config{SearchRanking: "random"}},
+		{name: "unknown field", cfg: config.Config{SearchFieldBoosts: map[string]float64{"docs": 2}}},
+		{name: "unknown flag", cfg: config.Config{SearchFlagBoosts: map[string]float64{"has_tests": 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg, nil)
+			if err == nil {
+				t.Error("New() error = nil, want an error")
+			}
+		})
+	}
+}
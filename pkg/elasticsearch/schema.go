@@ -0,0 +1,196 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// SchemaVersion is the version of indexMapping, recorded as schema_version
+// in the _meta of each index's mapping. Bump it, in indexMapping too,
+// whenever the mapping changes.
+const SchemaVersion = 11
+
+// SchemaStatus compares the mapping of the indices behind ES_INDEX with
+// indexMapping.
+type SchemaStatus struct {
+	// Version is the lowest schema version of the indices, 0 for those
+	// created before versioning.
+	Version int `json:"version"`
+	Wanted  int `json:"wanted"`
+	// Missing lists the fields the indices don't all map.
+	Missing []string `json:"missing,omitempty"`
+	// Conflicts lists the fields an index maps with another type, usually
+	// dynamically before the field was added; only a rebuild changes them.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// Current reports whether the indices are at SchemaVersion and map every
+// field as indexMapping does.
+func (s SchemaStatus) Current() (current bool) {
+	current = s.Version >= s.Wanted && len(s.Missing) == 0 && len(s.Conflicts) == 0
+	return current
+}
+
+// mappingResponse is the part of a GET _mapping response listing each
+// concrete index's schema version and fields.
+type mappingResponse map[string]struct {
+	Mappings struct {
+		Meta struct {
+			SchemaVersion int `json:"schema_version"`
+		} `json:"_meta"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	} `json:"mappings"`
+}
+
+// wantedMapping is the part of indexMapping compared with an index's.
+type wantedMapping struct {
+	Mappings struct {
+		DynamicTemplates json.RawMessage            `json:"dynamic_templates"`
+		Properties       map[string]json.RawMessage `json:"properties"`
+	} `json:"mappings"`
+}
+
+// Schema compares the mapping of the indices behind ES_INDEX with
+// indexMapping.
+func (es *Client) Schema(ctx context.Context) (status SchemaStatus, err error) {
+	var current mappingResponse
+	current, err = es.mapping(ctx)
+	if err != nil {
+		return status, err
+	}
+
+	var wanted wantedMapping
+	wanted, err = decodeIndexMapping()
+	if err != nil {
+		return status, err
+	}
+
+	status = current.compare(wanted)
+	return status, err
+}
+
+// syncMapping adds fields from indexMapping that an existing index lacks, so
+// documents carrying new fields aren't dynamically mapped with the wrong type.
+// Fields that already exist are left alone; the dynamic templates are sent
+// along with any new fields. With SCHEMA_MIGRATION additive and no conflicting
+// fields, the index is marked with SchemaVersion; with rebuild, it keeps its
+// version so the indexer rebuilds it.
+func (es *Client) syncMapping(ctx context.Context) (err error) {
+	if es.schemaMigration == config.SchemaMigrationNone {
+		return err
+	}
+
+	var current mappingResponse
+	current, err = es.mapping(ctx)
+	if err != nil {
+		return err
+	}
+
+	var wanted wantedMapping
+	wanted, err = decodeIndexMapping()
+	if err != nil {
+		return err
+	}
+
+	status := current.compare(wanted)
+	bump := es.schemaMigration != config.SchemaMigrationRebuild && len(status.Conflicts) == 0 && status.Version < SchemaVersion
+	if len(status.Missing) == 0 && !bump {
+		return err
+	}
+
+	update := map[string]interface{}{}
+	if len(status.Missing) > 0 {
+		missing := make(map[string]json.RawMessage, len(status.Missing))
+		for _, name := range status.Missing {
+			missing[name] = wanted.Mappings.Properties[name]
+		}
+		update["dynamic_templates"] = wanted.Mappings.DynamicTemplates
+		update["properties"] = missing
+	}
+	if bump {
+		update["_meta"] = map[string]interface{}{"schema_version": SchemaVersion}
+	}
+
+	_, err = es.doJSON(ctx, http.MethodPut, fmt.Sprintf("%s/%s/_mapping", es.host, es.index), update)
+	return err
+}
+
+// mapping returns the mapping of each index behind ES_INDEX.
+func (es *Client) mapping(ctx context.Context) (current mappingResponse, err error) {
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, fmt.Sprintf("%s/%s/_mapping", es.host, es.index), nil)
+	if err != nil {
+		return current, err
+	}
+
+	err = json.Unmarshal(body, &current)
+	if err != nil {
+		err = fmt.Errorf("failed to decode mapping: %w", err)
+		return current, err
+	}
+	return current, err
+}
+
+// decodeIndexMapping decodes the fields and dynamic templates of
+// indexMapping.
+func decodeIndexMapping() (wanted wantedMapping, err error) {
+	err = json.Unmarshal([]byte(indexMapping), &wanted)
+	if err != nil {
+		err = fmt.Errorf("failed to decode index mapping: %w", err)
+		return wanted, err
+	}
+	return wanted, err
+}
+
+// compare returns the schema status of the indices against wanted. A field
+// mapped in any index isn't missing: with an alias, it is left alone rather
+// than risk a conflict.
+func (m mappingResponse) compare(wanted wantedMapping) (status SchemaStatus) {
+	status.Wanted = SchemaVersion
+	status.Version = SchemaVersion
+	for _, index := range m {
+		status.Version = min(status.Version, index.Mappings.Meta.SchemaVersion)
+	}
+
+	for name, property := range wanted.Mappings.Properties {
+		wantedType := fieldType(property)
+		found := false
+		for _, index := range m {
+			current, mapped := index.Mappings.Properties[name]
+			if !mapped {
+				continue
+			}
+			found = true
+			if fieldType(current) != wantedType && !slices.Contains(status.Conflicts, name) {
+				status.Conflicts = append(status.Conflicts, name)
+			}
+		}
+		if !found {
+			status.Missing = append(status.Missing, name)
+		}
+	}
+
+	slices.Sort(status.Missing)
+	slices.Sort(status.Conflicts)
+	return status
+}
+
+// fieldType returns the type of a field's mapping, "object" for objects,
+// which Elasticsearch returns without one.
+func fieldType(property json.RawMessage) (fieldType string) {
+	var mapping struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(property, &mapping)
+
+	fieldType = mapping.Type
+	if fieldType == "" {
+		fieldType = "object"
+	}
+	return fieldType
+}
@@ -0,0 +1,119 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestIndexMappingSchemaVersion(t *testing.T) {
+	var mapping struct {
+		Mappings struct {
+			Meta struct {
+				SchemaVersion int `json:"schema_version"`
+			} `json:"_meta"`
+		} `json:"mappings"`
+	}
+	err := json.Unmarshal([]byte(indexMapping), &mapping)
+	if err != nil {
+		t.Fatalf("indexMapping is invalid: %v", err)
+	}
+	if mapping.Mappings.Meta.SchemaVersion != SchemaVersion {
+		t.Errorf("indexMapping schema_version = %d, want SchemaVersion %d", mapping.Mappings.Meta.SchemaVersion, SchemaVersion)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// An alias over a versioned index and one from before versioning,
+		// where normalized_hash was mapped dynamically as text.
+		_, _ = w.Write([]byte(`{
+			"code-index-1": {"mappings": {"properties": {"repo": {"type": "keyword"}, "normalized_hash": {"type": "text"}}}},
+			"code-index-2": {"mappings": {"_meta": {"schema_version": 1}, "properties": {"repo": {"type": "keyword"}, "locations": {"properties": {}}}}}
+		}`))
+	}))
+	defer srv.Close()
+
+	status, err := newTestClient(t, srv).Schema(t.Context())
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+
+	if status.Version != 0 || status.Wanted != SchemaVersion || status.Current() {
+		t.Errorf("Schema() = version %d of %d, current %v, want version 0 of %d, outdated", status.Version, status.Wanted, status.Current(), SchemaVersion)
+	}
+	if !slices.Equal(status.Conflicts, []string{"normalized_hash"}) {
+		t.Errorf("Schema() conflicts = %v, want normalized_hash", status.Conflicts)
+	}
+	if slices.Contains(status.Missing, "repo") || slices.Contains(status.Missing, "locations") || !slices.Contains(status.Missing, "file_path") {
+		t.Errorf("Schema() missing = %v, want file_path but not repo or locations", status.Missing)
+	}
+}
+
+func TestSyncMappingSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		migration  string
+		mapping    string
+		wantUpdate bool
+		wantMeta   bool
+	}{
+		{
+			name:       "additive marks an unversioned index",
+			mapping:    `{"code-index": {"mappings": {"properties": {"repo": {"type": "keyword"}}}}}`,
+			migration:  config.SchemaMigrationAdditive,
+			wantUpdate: true,
+			wantMeta:   true,
+		},
+		{
+			name:       "additive leaves a conflicting index unmarked",
+			mapping:    `{"code-index": {"mappings": {"properties": {"repo": {"type": "text"}}}}}`,
+			migration:  config.SchemaMigrationAdditive,
+			wantUpdate: true,
+		},
+		{
+			name:       "rebuild adds fields without marking",
+			mapping:    `{"code-index": {"mappings": {"properties": {"repo": {"type": "keyword"}}}}}`,
+			migration:  config.SchemaMigrationRebuild,
+			wantUpdate: true,
+		},
+		{
+			name:      "none leaves the index alone",
+			mapping:   `{"code-index": {"mappings": {"properties": {"repo": {"type": "keyword"}}}}}`,
+			migration: config.SchemaMigrationNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update map[string]json.RawMessage
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					_ = json.NewDecoder(r.Body).Decode(&update)
+				}
+				_, _ = w.Write([]byte(tt.mapping))
+			}))
+			defer srv.Close()
+
+			es := newTestClient(t, srv)
+			es.schemaMigration = tt.migration
+
+			err := es.syncMapping(t.Context())
+			if err != nil {
+				t.Fatalf("syncMapping() error = %v", err)
+			}
+
+			if (update != nil) != tt.wantUpdate {
+				t.Fatalf("mapping update = %v, want one: %v", update, tt.wantUpdate)
+			}
+			_, meta := update["_meta"]
+			if meta != tt.wantMeta {
+				t.Errorf("mapping update _meta = %s, want it set: %v", update["_meta"], tt.wantMeta)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+)
+
+// Ways of finding similar code. SimilarText compares terms with a
+// more_like_this query; SimilarVector compares embeddings and needs them
+// backfilled into the index.
+const (
+	SimilarText   = "text"
+	SimilarVector = "vector"
+)
+
+// ErrDocumentNotFound is returned when no document has the requested ID.
+var ErrDocumentNotFound = errors.New("document not found")
+
+// SimilarRequest asks for indexed code resembling a snippet, or the document
+// with the given ID. Exactly one of Code and ID is set. Mode is SimilarText
+// (the default) or SimilarVector. Repos, Kinds, and Types narrow the results
+// as in SearchRequest; the document named by ID is never among them.
+type SimilarRequest struct {
+	Code  string   `json:"code,omitempty"`
+	ID    string   `json:"id,omitempty"`
+	Mode  string   `json:"mode,omitempty"`
+	Limit int      `json:"limit"`
+	Repos []string `json:"repos,omitempty"`
+	Kinds []string `json:"kinds,omitempty"`
+	Types []string `json:"types,omitempty"`
+}
+
+// documentResponse is the subset of a GET _doc response used by the indexer.
+type documentResponse struct {
+	Index       string       `json:"_index"`
+	ID          string       `json:"_id"`
+	Version     int64        `json:"_version"`
+	SeqNo       int64        `json:"_seq_no"`
+	PrimaryTerm int64        `json:"_primary_term"`
+	Found       bool         `json:"found"`
+	Source      CodeDocument `json:"_source"`
+}
+
+// FetchedDocument is a document fetched by ID with the metadata
+// Elasticsearch keeps for it. Index is the concrete index holding it, which
+// differs from ES_INDEX when that is an alias. Version, SeqNo, and
+// PrimaryTerm change each time the document is rewritten.
+type FetchedDocument struct {
+	ID          string       `json:"id"`
+	Index       string       `json:"index"`
+	Version     int64        `json:"version"`
+	SeqNo       int64        `json:"seq_no"`
+	PrimaryTerm int64        `json:"primary_term"`
+	Document    CodeDocument `json:"document"`
+}
+
+// Document returns the document with the given ID, or ErrDocumentNotFound.
+func (es *Client) Document(ctx context.Context, id string) (doc CodeDocument, err error) {
+	var fetched FetchedDocument
+	fetched, err = es.FetchDocument(ctx, id)
+	doc = fetched.Document
+	return doc, err
+}
+
+// FetchDocument returns the document with the given ID and its metadata, or
+// ErrDocumentNotFound. The document's ID is set.
+func (es *Client) FetchDocument(ctx context.Context, id string) (fetched FetchedDocument, err error) {
+	docURL := fmt.Sprintf("%s/%s/_doc/%s", es.host, es.index, url.PathEscape(id))
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, docURL, nil)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		err = ErrDocumentNotFound
+		return fetched, err
+	}
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("get", "error").Inc()
+		err = fmt.Errorf("failed to get document: %w", err)
+		return fetched, err
+	}
+
+	var resp documentResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode document: %w", err)
+		return fetched, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("get", "success").Inc()
+
+	if !resp.Found {
+		err = ErrDocumentNotFound
+		return fetched, err
+	}
+
+	fetched = FetchedDocument{
+		ID:          resp.ID,
+		Index:       resp.Index,
+		Version:     resp.Version,
+		SeqNo:       resp.SeqNo,
+		PrimaryTerm: resp.PrimaryTerm,
+		Document:    resp.Source,
+	}
+	fetched.Document.ID = resp.ID
+	return fetched, err
+}
+
+// SimilarDocuments returns the indexed documents most like text, or, when
+// vector is set, nearest to it among documents embedded with model.
+func (es *Client) SimilarDocuments(ctx context.Context, req SimilarRequest, text string, vector []float32, model string) (results []CodeDocument, err error) {
+	query := es.similarQuery(req, text, vector, model)
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_search", es.host, es.index), query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("similar", "error").Inc()
+		err = fmt.Errorf("failed to find similar code: %w", err)
+		return results, err
+	}
+
+	var searchResp SearchResponse
+	err = json.Unmarshal(body, &searchResp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return results, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("similar", "success").Inc()
+
+	for _, hit := range searchResp.Hits.Hits {
+		hit.Source.ID = hit.ID
+		hit.Source.Score = hit.Score
+		results = append(results, hit.Source)
+	}
+
+	return results, err
+}
+
+// similarQuery builds the search body for SimilarDocuments. Text matching
+// uses more_like_this over the code fields. Vector matching uses the
+// backend's kNN syntax from VectorQuery.
+func (es *Client) similarQuery(req SimilarRequest, text string, vector []float32, model string) (query map[string]interface{}) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	filters := []map[string]interface{}{}
+	if len(req.Repos) > 0 {
+		filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{"repo": req.Repos}})
+	}
+	if len(req.Kinds) > 0 {
+		filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{"kind": req.Kinds}})
+	}
+	if len(req.Types) > 0 {
+		filters = append(filters, typesFilter(req.Types))
+	}
+
+	filter := map[string]interface{}{"filter": filters}
+	if req.ID != "" {
+		filter["must_not"] = map[string]interface{}{"ids": map[string]interface{}{"values": []string{req.ID}}}
+	}
+
+	query = map[string]interface{}{
+		"size": limit,
+		"_source": map[string]interface{}{
+			"excludes": []string{EmbeddingField},
+		},
+	}
+
+	if vector == nil {
+		filter["must"] = map[string]interface{}{
+			"more_like_this": map[string]interface{}{
+				"fields":          []string{"code", "code_full"},
+				"like":            text,
+				"min_term_freq":   1,
+				"min_doc_freq":    1,
+				"max_query_terms": 50,
+			},
+		}
+		query["query"] = map[string]interface{}{"bool": filter}
+		return query
+	}
+
+	filters = append(filters, map[string]interface{}{"term": map[string]interface{}{EmbeddingModelField: model}})
+	filter["filter"] = filters
+
+	vectorQuery := es.VectorQuery(EmbeddingField, vector, limit, filter)
+	maps.Copy(query, vectorQuery)
+	return query
+}
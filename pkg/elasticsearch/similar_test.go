@@ -0,0 +1,123 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimilarQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		backend    Backend
+		req        SimilarRequest
+		vector     []float32
+		wantKNN    bool
+		wantMust   string
+		wantNotID  bool
+		wantFilter int
+	}{
+		{name: "snippet", backend: BackendElasticsearch, req: SimilarRequest{Code: "func f() {}"}, wantMust: "more_like_this"},
+		{name: "document excluded", backend: BackendElasticsearch, req: SimilarRequest{ID: "abc", Repos: []string{"api"}}, wantMust: "more_like_this", wantNotID: true, wantFilter: 1},
+		{name: "elasticsearch vector", backend: BackendElasticsearch, req: SimilarRequest{ID: "abc"}, vector: []float32{0.1, 0.2}, wantKNN: true, wantNotID: true, wantFilter: 1},
+		{name: "opensearch vector", backend: BackendOpenSearch, req: SimilarRequest{Code: "x", Kinds: []string{KindFunction}}, vector: []float32{0.1, 0.2}, wantMust: "knn", wantFilter: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &Client{backend: tt.backend}
+			data, err := json.Marshal(es.similarQuery(tt.req, "func f() {}", tt.vector, "model"))
+			if err != nil {
+				t.Fatalf("Failed to marshal query: %v", err)
+			}
+
+			type boolQuery struct {
+				Must    map[string]any   `json:"must"`
+				MustNot map[string]any   `json:"must_not"`
+				Filter  []map[string]any `json:"filter"`
+			}
+			var body struct {
+				Size  int `json:"size"`
+				Query struct {
+					Bool boolQuery `json:"bool"`
+				} `json:"query"`
+				KNN *struct {
+					K      int `json:"k"`
+					Filter struct {
+						Bool boolQuery `json:"bool"`
+					} `json:"filter"`
+				} `json:"knn"`
+			}
+			err = json.Unmarshal(data, &body)
+			if err != nil {
+				t.Fatalf("Failed to decode query: %v", err)
+			}
+
+			if body.Size != 10 {
+				t.Errorf("size = %d, want 10", body.Size)
+			}
+			if (body.KNN != nil) != tt.wantKNN {
+				t.Fatalf("knn = %v, want %v", body.KNN != nil, tt.wantKNN)
+			}
+
+			boolBody := body.Query.Bool
+			if tt.wantKNN {
+				boolBody = body.KNN.Filter.Bool
+			} else {
+				_, ok := boolBody.Must[tt.wantMust]
+				if !ok {
+					t.Errorf("must = %v, want %s", boolBody.Must, tt.wantMust)
+				}
+			}
+			if (boolBody.MustNot != nil) != tt.wantNotID {
+				t.Errorf("must_not = %v, want exclusion %v", boolBody.MustNot, tt.wantNotID)
+			}
+			if len(boolBody.Filter) != tt.wantFilter {
+				t.Errorf("filters = %d, want %d", len(boolBody.Filter), tt.wantFilter)
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/test-index/_doc/abc":
+			_, _ = w.Write([]byte(`{"_index":"test-index-000002","_id":"abc","_version":3,"_seq_no":41,"_primary_term":2,"found":true,"_source":{"repo":"api","function_name":"Handle"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"_id":"missing","found":false}`))
+		}
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	doc, err := es.Document(t.Context(), "abc")
+	if err != nil {
+		t.Fatalf("Document() error = %v", err)
+	}
+	if doc.Repo != "api" || doc.FunctionName != "Handle" {
+		t.Errorf("Document() = %+v, want api Handle", doc)
+	}
+
+	_, err = es.Document(t.Context(), "missing")
+	if !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Document() error = %v, want ErrDocumentNotFound", err)
+	}
+
+	fetched, err := es.FetchDocument(t.Context(), "abc")
+	if err != nil {
+		t.Fatalf("FetchDocument() error = %v", err)
+	}
+	want := FetchedDocument{ID: "abc", Index: "test-index-000002", Version: 3, SeqNo: 41, PrimaryTerm: 2}
+	if fetched.ID != want.ID || fetched.Index != want.Index || fetched.Version != want.Version ||
+		fetched.SeqNo != want.SeqNo || fetched.PrimaryTerm != want.PrimaryTerm {
+		t.Errorf("FetchDocument() = %+v, want metadata %+v", fetched, want)
+	}
+	if fetched.Document.ID != "abc" || fetched.Document.Repo != "api" {
+		t.Errorf("FetchDocument() document = %+v, want api with ID abc", fetched.Document)
+	}
+}
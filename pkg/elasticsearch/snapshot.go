@@ -0,0 +1,249 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrSnapshotNotFound is returned when a snapshot isn't in the repository.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// ErrNoIndex is returned when a snapshot is requested before the index
+// exists.
+var ErrNoIndex = errors.New("index does not exist")
+
+// ErrSnapshotFailed is returned when a snapshot or restore completes without
+// every shard succeeding.
+var ErrSnapshotFailed = errors.New("snapshot failed")
+
+// SnapshotStateSuccess is the state of a snapshot that captured every shard.
+const SnapshotStateSuccess = "SUCCESS"
+
+// SnapshotInfo describes a snapshot in a snapshot repository.
+type SnapshotInfo struct {
+	Name      string         `json:"snapshot"`
+	State     string         `json:"state"`
+	Indices   []string       `json:"indices"`
+	StartTime time.Time      `json:"start_time"`
+	EndTime   time.Time      `json:"end_time"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+}
+
+// snapshotResponse is the subset of a snapshot or restore response used by
+// the indexer.
+type snapshotResponse struct {
+	Snapshot struct {
+		SnapshotInfo
+
+		Shards struct {
+			Total  int `json:"total"`
+			Failed int `json:"failed"`
+		} `json:"shards"`
+	} `json:"snapshot"`
+}
+
+// RegisterSnapshotRepository creates or updates the named snapshot
+// repository, e.g. type fs with a location, or s3 with a bucket.
+func (es *Client) RegisterSnapshotRepository(ctx context.Context, repository string, repoType string, settings map[string]string) (err error) {
+	if settings == nil {
+		settings = map[string]string{}
+	}
+	payload := map[string]interface{}{"type": repoType, "settings": settings}
+
+	_, err = es.doJSON(ctx, http.MethodPut, es.snapshotURL(repository), payload)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("snapshot_repository", "error").Inc()
+		err = fmt.Errorf("failed to register snapshot repository %s: %w", repository, err)
+		return err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("snapshot_repository", "success").Inc()
+	return err
+}
+
+// CreateSnapshot snapshots the indices the index name points to, with their
+// aliases, and waits for it to complete. It returns ErrNoIndex when there is
+// nothing to snapshot yet.
+func (es *Client) CreateSnapshot(ctx context.Context, repository string, name string, metadata map[string]string) (info SnapshotInfo, err error) {
+	var indices []string
+	indices, err = es.AliasTargets(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to read alias %s: %w", es.index, err)
+		return info, err
+	}
+	if len(indices) == 0 {
+		var exists bool
+		exists, err = es.indexExists(ctx, es.index)
+		if err != nil {
+			err = fmt.Errorf("failed to check if index exists: %w", err)
+			return info, err
+		}
+		if !exists {
+			err = fmt.Errorf("%w: %s", ErrNoIndex, es.index)
+			return info, err
+		}
+		indices = []string{es.index}
+	}
+
+	payload := map[string]interface{}{
+		"indices":              strings.Join(indices, ","),
+		"include_global_state": false,
+		"metadata":             metadata,
+	}
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPut, es.snapshotURL(repository, name)+"?wait_for_completion=true", payload)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("snapshot", "error").Inc()
+		err = fmt.Errorf("failed to snapshot %s: %w", es.index, err)
+		return info, err
+	}
+
+	var resp snapshotResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode snapshot: %w", err)
+		return info, err
+	}
+	info = resp.Snapshot.SnapshotInfo
+
+	if info.State != SnapshotStateSuccess {
+		es.metrics.ESRequests.WithLabelValues("snapshot", "error").Inc()
+		err = fmt.Errorf("%w: %s finished %s, %d of %d shards failed", ErrSnapshotFailed, name, info.State, resp.Snapshot.Shards.Failed, resp.Snapshot.Shards.Total)
+		return info, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("snapshot", "success").Inc()
+	return info, err
+}
+
+// Snapshots returns the snapshots in the repository, newest first.
+func (es *Client) Snapshots(ctx context.Context, repository string) (snapshots []SnapshotInfo, err error) {
+	snapshots, err = es.snapshots(ctx, repository, "_all")
+	if err != nil {
+		return snapshots, err
+	}
+
+	slices.SortStableFunc(snapshots, func(a SnapshotInfo, b SnapshotInfo) int {
+		return b.StartTime.Compare(a.StartTime)
+	})
+	return snapshots, err
+}
+
+// Snapshot returns the named snapshot, or ErrSnapshotNotFound.
+func (es *Client) Snapshot(ctx context.Context, repository string, name string) (info SnapshotInfo, err error) {
+	var snapshots []SnapshotInfo
+	snapshots, err = es.snapshots(ctx, repository, name)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		err = fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		return info, err
+	}
+	if err != nil {
+		return info, err
+	}
+	if len(snapshots) == 0 {
+		err = fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		return info, err
+	}
+
+	info = snapshots[0]
+	return info, err
+}
+
+// DeleteSnapshot deletes the named snapshot from the repository.
+func (es *Client) DeleteSnapshot(ctx context.Context, repository string, name string) (err error) {
+	_, err = es.doJSON(ctx, http.MethodDelete, es.snapshotURL(repository, name), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to delete snapshot %s: %w", name, err)
+		return err
+	}
+	return err
+}
+
+// RestoreSnapshot restores the index a snapshot holds as a new index named
+// index, without its aliases, and waits for it to complete. The live index
+// is untouched until the caller points the alias at the restored one.
+func (es *Client) RestoreSnapshot(ctx context.Context, repository string, name string, index string) (err error) {
+	var info SnapshotInfo
+	info, err = es.Snapshot(ctx, repository, name)
+	if err != nil {
+		return err
+	}
+	if len(info.Indices) != 1 {
+		err = fmt.Errorf("snapshot %s holds %d indices, want 1", name, len(info.Indices))
+		return err
+	}
+	source := info.Indices[0]
+
+	payload := map[string]interface{}{
+		"indices":              source,
+		"rename_pattern":       "^" + regexp.QuoteMeta(source) + "$",
+		"rename_replacement":   index,
+		"include_aliases":      false,
+		"include_global_state": false,
+	}
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, es.snapshotURL(repository, name, "_restore")+"?wait_for_completion=true", payload)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("restore", "error").Inc()
+		err = fmt.Errorf("failed to restore snapshot %s: %w", name, err)
+		return err
+	}
+
+	var resp snapshotResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode restore: %w", err)
+		return err
+	}
+	if resp.Snapshot.Shards.Failed > 0 {
+		es.metrics.ESRequests.WithLabelValues("restore", "error").Inc()
+		err = fmt.Errorf("%w: restoring %s, %d of %d shards failed", ErrSnapshotFailed, name, resp.Snapshot.Shards.Failed, resp.Snapshot.Shards.Total)
+		return err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("restore", "success").Inc()
+	return err
+}
+
+// snapshots returns the snapshots of a GET _snapshot request for names.
+func (es *Client) snapshots(ctx context.Context, repository string, names string) (snapshots []SnapshotInfo, err error) {
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, es.snapshotURL(repository, names), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to list snapshots: %w", err)
+		return snapshots, err
+	}
+
+	var resp struct {
+		Snapshots []SnapshotInfo `json:"snapshots"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode snapshots: %w", err)
+		return snapshots, err
+	}
+
+	snapshots = resp.Snapshots
+	return snapshots, err
+}
+
+// snapshotURL returns the URL of a snapshot API path under _snapshot, with
+// each segment escaped.
+func (es *Client) snapshotURL(segments ...string) (u string) {
+	u = es.host + "/_snapshot"
+	for _, segment := range segments {
+		u += "/" + url.PathEscape(segment)
+	}
+	return u
+}
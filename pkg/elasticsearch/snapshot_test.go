@@ -0,0 +1,146 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateSnapshot(t *testing.T) {
+	tests := []struct {
+		name        string
+		alias       bool
+		state       string
+		wantIndices string
+		wantErr     error
+	}{
+		{name: "alias generations", alias: true, state: "SUCCESS", wantIndices: "test-index-2025-01-01-000000"},
+		{name: "concrete index", state: "SUCCESS", wantIndices: "test-index"},
+		{name: "partial snapshot", alias: true, state: "PARTIAL", wantErr: ErrSnapshotFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/_alias/test-index":
+					if !tt.alias {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					_, _ = w.Write([]byte(`{"test-index-2025-01-01-000000":{"aliases":{"test-index":{}}}}`))
+				case r.URL.Path == "/_snapshot/backups/snap-1" && r.Method == http.MethodPut:
+					if r.URL.Query().Get("wait_for_completion") != "true" {
+						t.Errorf("snapshot request %s, want it to wait for completion", r.URL)
+					}
+					_ = json.NewDecoder(r.Body).Decode(&body)
+					_, _ = w.Write([]byte(`{"snapshot":{"snapshot":"snap-1","state":"` + tt.state + `","indices":["x"],"shards":{"total":2,"failed":1}}}`))
+				default:
+					_, _ = w.Write([]byte(`{}`))
+				}
+			}))
+			defer srv.Close()
+
+			es := newTestClient(t, srv)
+
+			info, err := es.CreateSnapshot(t.Context(), "backups", "snap-1", map[string]string{"taken_by": "test"})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("CreateSnapshot() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateSnapshot() error = %v", err)
+			}
+
+			if body["indices"] != tt.wantIndices || body["include_global_state"] != false {
+				t.Errorf("snapshot body = %v, want indices %q without global state", body, tt.wantIndices)
+			}
+			if info.Name != "snap-1" || info.State != SnapshotStateSuccess {
+				t.Errorf("CreateSnapshot() = %+v, want snap-1 succeeded", info)
+			}
+		})
+	}
+}
+
+func TestCreateSnapshotNoIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || r.URL.Path == "/_alias/test-index" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	_, err := es.CreateSnapshot(t.Context(), "backups", "snap-1", nil)
+	if !errors.Is(err, ErrNoIndex) {
+		t.Errorf("CreateSnapshot() error = %v, want ErrNoIndex", err)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_snapshot/backups/_all" {
+			_, _ = w.Write([]byte(`{"snapshots":[` +
+				`{"snapshot":"old","state":"SUCCESS","start_time":"2025-01-01T00:00:00.000Z"},` +
+				`{"snapshot":"new","state":"SUCCESS","start_time":"2025-01-02T00:00:00.000Z","metadata":{"taken_by":"rag-indexer","attempt":2}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	snapshots, err := es.Snapshots(t.Context(), "backups")
+	if err != nil {
+		t.Fatalf("Snapshots() error = %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != "new" || snapshots[1].Name != "old" {
+		t.Errorf("Snapshots() = %+v, want new, then old", snapshots)
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_snapshot/backups/snap-1":
+			_, _ = w.Write([]byte(`{"snapshots":[{"snapshot":"snap-1","state":"SUCCESS","indices":["test-index-2025-01-01-000000"]}]}`))
+		case "/_snapshot/backups/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"type":"snapshot_missing_exception"},"status":404}`))
+		case "/_snapshot/backups/snap-1/_restore":
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			_, _ = w.Write([]byte(`{"snapshot":{"snapshot":"snap-1","indices":["test-index-2025-02-01-000000"],"shards":{"total":1,"failed":0}}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	es := newTestClient(t, srv)
+
+	err := es.RestoreSnapshot(t.Context(), "backups", "snap-1", "test-index-2025-02-01-000000")
+	if err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	if body["indices"] != "test-index-2025-01-01-000000" ||
+		body["rename_pattern"] != `^test-index-2025-01-01-000000$` ||
+		body["rename_replacement"] != "test-index-2025-02-01-000000" ||
+		body["include_aliases"] != false {
+		t.Errorf("restore body = %v, want the index renamed without its aliases", body)
+	}
+
+	err = es.RestoreSnapshot(t.Context(), "backups", "missing", "test-index-2025-02-01-000000")
+	if !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("RestoreSnapshot() error = %v, want ErrSnapshotNotFound", err)
+	}
+}
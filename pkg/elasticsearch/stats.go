@@ -0,0 +1,334 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRepoBuckets bounds the repo terms aggregation used for per-repo counts.
+const maxRepoBuckets = 1000
+
+// maxModuleBuckets bounds the module terms aggregation used for per-module
+// counts within a repository.
+const maxModuleBuckets = 500
+
+// StorageStats is the document count and on-disk size of the index.
+type StorageStats struct {
+	Documents int64 `json:"documents"`
+	SizeBytes int64 `json:"size_in_bytes"`
+}
+
+// indexStatsResponse is the subset of the _stats response used by the indexer.
+type indexStatsResponse struct {
+	All struct {
+		Primaries struct {
+			Docs struct {
+				Count int64 `json:"count"`
+			} `json:"docs"`
+		} `json:"primaries"`
+		Total struct {
+			Store struct {
+				SizeInBytes int64 `json:"size_in_bytes"`
+			} `json:"store"`
+		} `json:"total"`
+	} `json:"_all"`
+}
+
+// generationStatsResponse is the subset of the per-index _stats response
+// that changes whenever searchable content does.
+type generationStatsResponse struct {
+	Indices map[string]struct {
+		Primaries struct {
+			Docs struct {
+				Count   int64 `json:"count"`
+				Deleted int64 `json:"deleted"`
+			} `json:"docs"`
+			Indexing struct {
+				IndexTotal  int64 `json:"index_total"`
+				DeleteTotal int64 `json:"delete_total"`
+			} `json:"indexing"`
+		} `json:"primaries"`
+	} `json:"indices"`
+}
+
+// repoCountsResponse is the subset of the repo terms aggregation response used by the indexer.
+type repoCountsResponse struct {
+	Aggregations struct {
+		Repos struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int64  `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"repos"`
+	} `json:"aggregations"`
+}
+
+// RepoIndexed is when a repository's newest document was indexed, and the
+// commit it was indexed at.
+type RepoIndexed struct {
+	IndexedAt time.Time
+	Commit    string
+}
+
+// lastIndexedResponse is the subset of the repo terms aggregation with each
+// repository's newest document used by the indexer.
+type lastIndexedResponse struct {
+	Aggregations struct {
+		Repos struct {
+			Buckets []struct {
+				Key    string `json:"key"`
+				Latest struct {
+					Hits struct {
+						Hits []struct {
+							Source struct {
+								IndexedAt time.Time `json:"indexed_at"`
+								Commit    string    `json:"commit"`
+							} `json:"_source"`
+						} `json:"hits"`
+					} `json:"hits"`
+				} `json:"latest"`
+			} `json:"buckets"`
+		} `json:"repos"`
+	} `json:"aggregations"`
+}
+
+// moduleCountsResponse is the subset of the repo and module terms
+// aggregation response used by the indexer.
+type moduleCountsResponse struct {
+	Aggregations struct {
+		Repos struct {
+			Buckets []struct {
+				Key     string `json:"key"`
+				Modules struct {
+					Buckets []struct {
+						Key      string `json:"key"`
+						DocCount int64  `json:"doc_count"`
+					} `json:"buckets"`
+				} `json:"modules"`
+			} `json:"buckets"`
+		} `json:"repos"`
+	} `json:"aggregations"`
+}
+
+// StorageStats returns the primary document count and total store size of the index.
+func (es *Client) StorageStats(ctx context.Context) (stats StorageStats, err error) {
+	url := fmt.Sprintf("%s/%s/_stats/docs,store", es.host, es.index)
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("stats", "error").Inc()
+		err = fmt.Errorf("failed to get index stats: %w", err)
+		return stats, err
+	}
+
+	var resp indexStatsResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode index stats: %w", err)
+		return stats, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("stats", "success").Inc()
+
+	stats.Documents = resp.All.Primaries.Docs.Count
+	stats.SizeBytes = resp.All.Total.Store.SizeInBytes
+	return stats, err
+}
+
+// RepoDocumentCounts returns the number of indexed documents per repository.
+func (es *Client) RepoDocumentCounts(ctx context.Context) (counts map[string]int64, err error) {
+	query := map[string]interface{}{
+		"size": 0,
+		"aggs": map[string]interface{}{
+			"repos": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "repo",
+					"size":  maxRepoBuckets,
+				},
+			},
+		},
+	}
+
+	url := fmt.Sprintf("%s/%s/_search", es.host, es.index)
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, url, query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("repo_counts", "error").Inc()
+		err = fmt.Errorf("failed to count documents per repo: %w", err)
+		return counts, err
+	}
+
+	var resp repoCountsResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode repo counts: %w", err)
+		return counts, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("repo_counts", "success").Inc()
+
+	counts = make(map[string]int64, len(resp.Aggregations.Repos.Buckets))
+	for _, bucket := range resp.Aggregations.Repos.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+
+	return counts, err
+}
+
+// ModuleDocumentCounts returns the number of indexed documents per Go module
+// of each repository with any, by module path. Documents outside a module
+// aren't counted.
+func (es *Client) ModuleDocumentCounts(ctx context.Context) (counts map[string]map[string]int64, err error) {
+	query := map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"exists": map[string]interface{}{"field": "module"}},
+		"aggs": map[string]interface{}{
+			"repos": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "repo",
+					"size":  maxRepoBuckets,
+				},
+				"aggs": map[string]interface{}{
+					"modules": map[string]interface{}{
+						"terms": map[string]interface{}{
+							"field": "module",
+							"size":  maxModuleBuckets,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	url := fmt.Sprintf("%s/%s/_search", es.host, es.index)
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, url, query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("module_counts", "error").Inc()
+		err = fmt.Errorf("failed to count documents per module: %w", err)
+		return counts, err
+	}
+
+	var resp moduleCountsResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode module counts: %w", err)
+		return counts, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("module_counts", "success").Inc()
+
+	counts = make(map[string]map[string]int64, len(resp.Aggregations.Repos.Buckets))
+	for _, repo := range resp.Aggregations.Repos.Buckets {
+		if len(repo.Modules.Buckets) == 0 {
+			continue
+		}
+		counts[repo.Key] = make(map[string]int64, len(repo.Modules.Buckets))
+		for _, module := range repo.Modules.Buckets {
+			counts[repo.Key][module.Key] = module.DocCount
+		}
+	}
+
+	return counts, err
+}
+
+// IndexGeneration returns a token that changes whenever what searches of the
+// index can see may have changed: documents written or deleted, a refresh
+// making writes visible, or the alias moving to another index. It can change
+// without the content changing, as when segments merge, but not the reverse.
+func (es *Client) IndexGeneration(ctx context.Context) (generation string, err error) {
+	url := fmt.Sprintf("%s/%s/_stats/docs,indexing", es.host, es.index)
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("generation", "error").Inc()
+		err = fmt.Errorf("failed to get index stats: %w", err)
+		return generation, err
+	}
+
+	var resp generationStatsResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode index stats: %w", err)
+		return generation, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("generation", "success").Inc()
+
+	parts := make([]string, 0, len(resp.Indices))
+	for name, stats := range resp.Indices {
+		primaries := stats.Primaries
+		parts = append(parts, fmt.Sprintf("%s:%d:%d:%d:%d", name, primaries.Docs.Count, primaries.Docs.Deleted,
+			primaries.Indexing.IndexTotal, primaries.Indexing.DeleteTotal))
+	}
+	sort.Strings(parts)
+
+	generation = strings.Join(parts, ",")
+	return generation, err
+}
+
+// RepoLastIndexed returns when each repository's newest document was
+// indexed, and at which commit, from the maximum indexed_at of its documents.
+// Repositories whose documents have no indexed_at are left out.
+func (es *Client) RepoLastIndexed(ctx context.Context) (latest map[string]RepoIndexed, err error) {
+	query := map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"exists": map[string]interface{}{"field": "indexed_at"}},
+		"aggs": map[string]interface{}{
+			"repos": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "repo",
+					"size":  maxRepoBuckets,
+				},
+				"aggs": map[string]interface{}{
+					"latest": map[string]interface{}{
+						"top_hits": map[string]interface{}{
+							"size":    1,
+							"sort":    []map[string]interface{}{{"indexed_at": map[string]interface{}{"order": "desc"}}},
+							"_source": []string{"indexed_at", "commit"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	url := fmt.Sprintf("%s/%s/_search", es.host, es.index)
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, url, query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("repo_last_indexed", "error").Inc()
+		err = fmt.Errorf("failed to find the last index of each repo: %w", err)
+		return latest, err
+	}
+
+	var resp lastIndexedResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode last index of each repo: %w", err)
+		return latest, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("repo_last_indexed", "success").Inc()
+
+	latest = make(map[string]RepoIndexed, len(resp.Aggregations.Repos.Buckets))
+	for _, bucket := range resp.Aggregations.Repos.Buckets {
+		hits := bucket.Latest.Hits.Hits
+		if len(hits) == 0 || hits[0].Source.IndexedAt.IsZero() {
+			continue
+		}
+		latest[bucket.Key] = RepoIndexed{IndexedAt: hits[0].Source.IndexedAt, Commit: hits[0].Source.Commit}
+	}
+
+	return latest, err
+}
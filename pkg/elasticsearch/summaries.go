@@ -0,0 +1,62 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// summaryPageSize is how many documents each page of a summary lookup holds.
+const summaryPageSize = 1000
+
+// SummaryKey identifies the code a summary was generated for: the
+// declaration's name and content hash, so a summary is reused only while
+// neither changes.
+func (d CodeDocument) SummaryKey() (key string) {
+	key = d.FunctionName + "\x00" + d.ContentHash
+	return key
+}
+
+// Summaries returns the summaries model generated for the repository's
+// indexed documents, or only those of filePath when it is set, keyed by
+// SummaryKey, so an index run can reuse them for code that hasn't changed. A
+// missing index has none.
+func (es *Client) Summaries(ctx context.Context, repo string, filePath string, model string) (summaries map[string]string, err error) {
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"repo": repo}},
+		{"term": map[string]interface{}{"summary_model": model}},
+		{"exists": map[string]interface{}{"field": "summary"}},
+	}
+	if filePath != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"file_path": filePath}})
+	}
+
+	summaries = map[string]string{}
+	err = es.scroll(ctx, map[string]interface{}{
+		"size":    summaryPageSize,
+		"sort":    []string{"_doc"},
+		"_source": []string{"function_name", "content_hash", "summary"},
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+	}, func(docs []StoredDocument) (pageErr error) {
+		for _, stored := range docs {
+			var doc CodeDocument
+			pageErr = json.Unmarshal(stored.Source, &doc)
+			if pageErr != nil {
+				pageErr = fmt.Errorf("failed to decode document %s: %w", stored.ID, pageErr)
+				return pageErr
+			}
+			if doc.ContentHash != "" && doc.Summary != "" {
+				summaries[doc.SummaryKey()] = doc.Summary
+			}
+		}
+		return pageErr
+	})
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		err = nil
+	}
+	return summaries, err
+}
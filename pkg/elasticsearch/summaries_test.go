@@ -0,0 +1,57 @@
+package elasticsearch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSummaries(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/test-index/_search":
+			body, _ := io.ReadAll(r.Body)
+			query = string(body)
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[` +
+				`{"_id":"a","_source":{"function_name":"Retry","content_hash":"h1","summary":"Retries a call with backoff."}},` +
+				`{"_id":"b","_source":{"function_name":"Retry","content_hash":"h1","summary":"Retries a call with backoff."}},` +
+				`{"_id":"c","_source":{"function_name":"Serve","summary":"Serves requests."}}]}}`))
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[]}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	summaries, err := newTestClient(t, srv).Summaries(t.Context(), "api", "pkg/retry.go", "llama3.2")
+	if err != nil {
+		t.Fatalf("Summaries() error = %v", err)
+	}
+
+	key := CodeDocument{FunctionName: "Retry", ContentHash: "h1"}.SummaryKey()
+	if len(summaries) != 1 || summaries[key] != "Retries a call with backoff." {
+		t.Errorf("Summaries() = %v, want Retry's only", summaries)
+	}
+	for _, filter := range []string{`{"term":{"repo":"api"}}`, `{"term":{"summary_model":"llama3.2"}}`, `{"term":{"file_path":"pkg/retry.go"}}`} {
+		if !strings.Contains(query, filter) {
+			t.Errorf("query = %s, want filter %s", query, filter)
+		}
+	}
+}
+
+func TestSummariesMissingIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"type":"index_not_found_exception"},"status":404}`))
+	}))
+	defer srv.Close()
+
+	summaries, err := newTestClient(t, srv).Summaries(t.Context(), "api", "", "llama3.2")
+	if err != nil || len(summaries) != 0 {
+		t.Errorf("Summaries() = %v, %v, want none without error", summaries, err)
+	}
+}
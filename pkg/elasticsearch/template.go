@@ -0,0 +1,97 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// indexTemplatePriority ranks the indexer's template above the built-in
+// templates Elasticsearch ships with, which use priority 100 and below.
+const indexTemplatePriority = 200
+
+// templatePriority returns the priority of the configuration's template. A
+// tenant's index patterns, such as code-index-team-a-*, also match the
+// default profile's code-index-*, and Elasticsearch refuses overlapping
+// templates of equal priority, so tenants' templates rank one higher.
+func templatePriority(cfg config.Config) (priority int) {
+	priority = indexTemplatePriority
+	if cfg.Tenant != "" {
+		priority++
+	}
+	return priority
+}
+
+// templateOwner marks templates the indexer manages in their _meta.
+const templateOwner = "rag-indexer"
+
+// putIndexTemplate installs the settings and mappings from indexMapping as two
+// component templates and an index template composing them, so every index
+// matching the patterns (new generations, rollover targets) is created with
+// them. Existing templates are overwritten so they track this release.
+func (es *Client) putIndexTemplate(ctx context.Context) (err error) {
+	var mapping struct {
+		Settings json.RawMessage `json:"settings"`
+		Mappings json.RawMessage `json:"mappings"`
+	}
+	err = json.Unmarshal([]byte(indexMapping), &mapping)
+	if err != nil {
+		err = fmt.Errorf("failed to decode index mapping: %w", err)
+		return err
+	}
+
+	components := []struct {
+		name     string
+		template map[string]interface{}
+	}{
+		{name: es.indexTemplate + "-settings", template: map[string]interface{}{"settings": mapping.Settings}},
+		{name: es.indexTemplate + "-mappings", template: map[string]interface{}{"mappings": mapping.Mappings}},
+	}
+
+	composedOf := make([]string, 0, len(components))
+	for _, component := range components {
+		_, err = es.doJSON(ctx, http.MethodPut, fmt.Sprintf("%s/_component_template/%s", es.host, component.name), map[string]interface{}{
+			"template": component.template,
+			"_meta":    map[string]interface{}{"managed_by": templateOwner},
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to put component template %s: %w", component.name, err)
+			return err
+		}
+		composedOf = append(composedOf, component.name)
+	}
+
+	_, err = es.doJSON(ctx, http.MethodPut, fmt.Sprintf("%s/_index_template/%s", es.host, es.indexTemplate), map[string]interface{}{
+		"index_patterns": es.indexPatterns,
+		"composed_of":    composedOf,
+		"priority":       es.templatePriority,
+		"_meta":          map[string]interface{}{"managed_by": templateOwner},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to put index template %s: %w", es.indexTemplate, err)
+		return err
+	}
+
+	return err
+}
+
+// templateCovers reports whether the managed index template applies to the
+// named index, so creating it needs no explicit mapping.
+func (es *Client) templateCovers(index string) (covered bool) {
+	if es.indexTemplate == "" {
+		return covered
+	}
+
+	for _, pattern := range es.indexPatterns {
+		matched, matchErr := path.Match(pattern, index)
+		if matchErr == nil && matched {
+			covered = true
+			return covered
+		}
+	}
+	return covered
+}
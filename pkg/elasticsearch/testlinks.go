@@ -0,0 +1,121 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// testCandidates is how many tests IncludeTests fetches for each result,
+// leaving room for chunks of long tests.
+const testCandidates = 10
+
+// maxTestsPerResult caps the tests added to one result.
+const maxTestsPerResult = 5
+
+// testSubject returns the symbol tests of a result record it under in their
+// TestSubjects, such as "retry.Do" or "retry.Policy.Next", or "" for
+// documents other than Go functions and methods, and for tests themselves.
+// Of the other languages' functions, only Go's record a package.
+func testSubject(doc CodeDocument) (symbol string) {
+	if doc.IsTestFunc || doc.Package == "" {
+		return symbol
+	}
+
+	switch {
+	case doc.Kind == KindFunction:
+		symbol = doc.Package + "." + doc.FunctionName
+	case doc.Kind == KindMethod && doc.Receiver != "":
+		symbol = doc.Package + "." + doc.Receiver + "." + doc.FunctionName
+	}
+	return symbol
+}
+
+// IncludeTests returns the results with the tests, benchmarks, and fuzz
+// targets linked to each at index time in its Tests, looked up in one
+// search in the result's repository. Of a chunked test, its first chunk is
+// included. Results that aren't Go functions or methods, and those indexed
+// before their receiver was recorded, get none. The results themselves are
+// unchanged otherwise.
+func (es *Client) IncludeTests(ctx context.Context, results []CodeDocument) (expanded []CodeDocument, err error) {
+	expanded = results
+
+	seen := map[string]bool{}
+	var should []map[string]interface{}
+	for _, result := range results {
+		symbol := testSubject(result)
+		key := result.Repo + "\x00" + symbol
+		if symbol == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		should = append(should, map[string]interface{}{"bool": map[string]interface{}{"filter": []map[string]interface{}{
+			{"term": map[string]interface{}{"repo": result.Repo}},
+			{"term": map[string]interface{}{"test_subjects": symbol}},
+		}}})
+	}
+	if len(should) == 0 {
+		return expanded, err
+	}
+
+	query := map[string]interface{}{
+		"size": len(should) * testCandidates,
+		"sort": []map[string]interface{}{
+			{"chunk_index": map[string]interface{}{"order": "asc", "missing": "_first", "unmapped_type": "integer"}},
+			{"file_path": map[string]interface{}{"order": "asc"}},
+			{"start_line": map[string]interface{}{"order": "asc", "unmapped_type": "integer"}},
+		},
+		"_source": map[string]interface{}{"excludes": []string{EmbeddingField}},
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				{"term": map[string]interface{}{"is_test_func": true}},
+			},
+			"should":               should,
+			"minimum_should_match": 1,
+		}},
+	}
+
+	var body []byte
+	body, err = es.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_search", es.host, es.index), query)
+	if err != nil {
+		es.metrics.ESRequests.WithLabelValues("include_tests", "error").Inc()
+		err = fmt.Errorf("failed to look up tests: %w", err)
+		return expanded, err
+	}
+
+	var searchResp SearchResponse
+	err = json.Unmarshal(body, &searchResp)
+	if err != nil {
+		err = fmt.Errorf("failed to decode response: %w", err)
+		return expanded, err
+	}
+
+	es.metrics.ESRequests.WithLabelValues("include_tests", "success").Inc()
+
+	expanded = make([]CodeDocument, len(results))
+	for i, result := range results {
+		expanded[i] = result
+		symbol := testSubject(result)
+		if symbol == "" {
+			continue
+		}
+
+		picked := map[string]bool{}
+		for _, hit := range searchResp.Hits.Hits {
+			test := hit.Source
+			key := test.FilePath + "\x00" + test.FunctionName
+			if test.Repo != result.Repo || picked[key] || !slices.Contains(test.TestSubjects, symbol) {
+				continue
+			}
+			picked[key] = true
+			test.ID = hit.ID
+			expanded[i].Tests = append(expanded[i].Tests, test)
+			if len(expanded[i].Tests) == maxTestsPerResult {
+				break
+			}
+		}
+	}
+	return expanded, err
+}
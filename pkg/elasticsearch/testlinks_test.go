@@ -0,0 +1,61 @@
+package elasticsearch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIncludeTests(t *testing.T) {
+	var requests int
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		query = string(body)
+		_, _ = w.Write([]byte(`{"hits":{"hits":[` +
+			`{"_id":"d1","_source":{"repo":"api","file_path":"retry/retry_test.go","function_name":"TestDo","is_test_func":true,"test_subjects":["retry.Do"]}},` +
+			`{"_id":"d2","_source":{"repo":"api","file_path":"retry/retry_test.go","function_name":"TestDo","chunk_index":2,"is_test_func":true,"test_subjects":["retry.Do"]}},` +
+			`{"_id":"n","_source":{"repo":"api","file_path":"retry/policy_test.go","function_name":"TestPolicy_Next","is_test_func":true,"test_subjects":["retry.Policy.Next"]}},` +
+			`{"_id":"o","_source":{"repo":"web","file_path":"retry/retry_test.go","function_name":"TestDo","is_test_func":true,"test_subjects":["retry.Do"]}}]}}`))
+	}))
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	plain := []CodeDocument{{Repo: "api", FilePath: "retry/retry_test.go", Package: "retry", Kind: KindFunction, FunctionName: "TestDo", IsTestFunc: true}}
+	expanded, err := client.IncludeTests(t.Context(), plain)
+	if err != nil || requests != 0 || expanded[0].Tests != nil {
+		t.Errorf("IncludeTests() of a test = %+v, %v after %d requests, want the results as they were", expanded, err, requests)
+	}
+
+	results := []CodeDocument{
+		{Repo: "api", FilePath: "retry/retry.go", Package: "retry", Kind: KindFunction, FunctionName: "Do"},
+		{Repo: "api", FilePath: "retry/policy.go", Package: "retry", Kind: KindMethod, Receiver: "Policy", FunctionName: "Next"},
+		{Repo: "api", FilePath: "retry/policy.go", Package: "retry", Kind: KindType, FunctionName: "Policy"},
+	}
+	expanded, err = client.IncludeTests(t.Context(), results)
+	if err != nil {
+		t.Fatalf("IncludeTests() error = %v", err)
+	}
+
+	if len(expanded[0].Tests) != 1 || expanded[0].Tests[0].ID != "d1" {
+		t.Errorf("Do's tests = %+v, want the first chunk of TestDo in its repository", expanded[0].Tests)
+	}
+	if len(expanded[1].Tests) != 1 || expanded[1].Tests[0].ID != "n" {
+		t.Errorf("Next's tests = %+v, want TestPolicy_Next", expanded[1].Tests)
+	}
+	if expanded[2].Tests != nil {
+		t.Errorf("Policy's tests = %+v, want none for a type", expanded[2].Tests)
+	}
+	if results[0].Tests != nil {
+		t.Error("IncludeTests() changed the results given")
+	}
+
+	for _, part := range []string{`{"term":{"test_subjects":"retry.Do"}}`, `{"term":{"test_subjects":"retry.Policy.Next"}}`, `{"term":{"is_test_func":true}}`, `"size":20`} {
+		if !strings.Contains(query, part) {
+			t.Errorf("query = %s, want %s", query, part)
+		}
+	}
+}
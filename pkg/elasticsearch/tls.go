@@ -0,0 +1,83 @@
+package elasticsearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// newTransport returns the HTTP transport for talking to the cluster. It
+// trusts the system CAs plus those in ES_CA_FILE, presents the client
+// certificate in ES_CLIENT_CERT_FILE when set, and skips verification
+// entirely with ES_INSECURE_SKIP_VERIFY. Requests go through ES_PROXY when
+// set, or the proxy HTTPS_PROXY, HTTP_PROXY, and NO_PROXY choose.
+func newTransport(cfg config.Config) (transport *http.Transport, err error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.ESCAFile != "" {
+		tlsConfig.RootCAs, err = caPool(cfg.ESCAFile)
+		if err != nil {
+			return transport, err
+		}
+	}
+
+	if cfg.ESClientCertFile != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(cfg.ESClientCertFile, cfg.ESClientKeyFile)
+		if err != nil {
+			err = fmt.Errorf("failed to load ES_CLIENT_CERT_FILE: %w", err)
+			return transport, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Opt-in, and warned about at startup.
+	tlsConfig.InsecureSkipVerify = cfg.ESInsecureSkipVerify
+
+	transport = http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	switch cfg.ESProxy {
+	case "":
+		transport.Proxy = http.ProxyFromEnvironment
+	case config.ProxyNone:
+		transport.Proxy = nil
+	default:
+		var proxyURL *url.URL
+		proxyURL, err = url.Parse(cfg.ESProxy)
+		if err != nil {
+			err = fmt.Errorf("invalid ES_PROXY: %w", err)
+			return transport, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return transport, err
+}
+
+// caPool returns the system CAs with those in path added.
+func caPool(path string) (pool *x509.CertPool, err error) {
+	var pem []byte
+	pem, err = os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read ES_CA_FILE: %w", err)
+		return pool, err
+	}
+
+	pool, err = x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+		err = nil
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("no certificates found in ES_CA_FILE %s", path)
+		return pool, err
+	}
+
+	return pool, err
+}
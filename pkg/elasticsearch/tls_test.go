@@ -0,0 +1,146 @@
+package elasticsearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestNewTransport(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The server's own certificate doubles as the CA and the client
+	// certificate.
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	key, err := x509.MarshalPKCS8PrivateKey(srv.TLS.Certificates[0].PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}))
+	notPEM := filepath.Join(dir, "not.pem")
+	writeFile(t, notPEM, []byte("not a certificate"))
+
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		wantStatus int
+		wantErr    bool
+		wantReqErr bool
+	}{
+		{name: "unknown CA rejected", wantReqErr: true},
+		{name: "CA file trusted", cfg: config.Config{ESCAFile: caFile}, wantStatus: http.StatusUnauthorized},
+		{name: "client certificate presented", cfg: config.Config{ESCAFile: caFile, ESClientCertFile: caFile, ESClientKeyFile: keyFile}, wantStatus: http.StatusOK},
+		{name: "verification skipped", cfg: config.Config{ESInsecureSkipVerify: true}, wantStatus: http.StatusUnauthorized},
+		{name: "missing CA file", cfg: config.Config{ESCAFile: filepath.Join(dir, "missing.crt")}, wantErr: true},
+		{name: "CA file without certificates", cfg: config.Config{ESCAFile: notPEM}, wantErr: true},
+		{name: "unreadable client certificate", cfg: config.Config{ESClientCertFile: notPEM, ESClientKeyFile: keyFile}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := newTransport(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer transport.CloseIdleConnections()
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			if (err != nil) != tt.wantReqErr {
+				t.Fatalf("request error = %v, wantReqErr %v", err, tt.wantReqErr)
+			}
+			if tt.wantReqErr {
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNewTransportProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "")
+
+	tests := []struct {
+		name        string
+		proxy       string
+		wantProxied bool
+	}{
+		{name: "configured proxy", proxy: proxy.URL, wantProxied: true},
+		{name: "no proxy", proxy: config.ProxyNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxied = nil
+			transport, err := newTransport(config.Config{ESProxy: tt.proxy})
+			if err != nil {
+				t.Fatalf("newTransport() error = %v", err)
+			}
+			defer transport.CloseIdleConnections()
+
+			// The host doesn't resolve, so only a proxied request succeeds.
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://es.invalid:9200/", nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if (len(proxied) == 1) != tt.wantProxied {
+				t.Errorf("proxied requests = %v, want proxied %v", proxied, tt.wantProxied)
+			}
+			if tt.wantProxied && proxied[0] != "http://es.invalid:9200/" {
+				t.Errorf("proxied %q, want the cluster's URL", proxied[0])
+			}
+		})
+	}
+}
+
+// writeFile writes a test fixture.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
@@ -0,0 +1,85 @@
+package embedding
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+// cacheKey identifies an embedded text by the SHA-256 of the model and the
+// text.
+type cacheKey [sha256.Size]byte
+
+// cacheEntry is a cached vector, kept in the cache's recency list.
+type cacheEntry struct {
+	key    cacheKey
+	vector []float32
+}
+
+// vectorCache holds the vectors of recently embedded texts, keyed by a hash
+// of their content, so unchanged code isn't sent to the model again. The
+// least recently used vectors are evicted beyond size.
+type vectorCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]*list.Element
+	recency *list.List
+}
+
+// newVectorCache returns a cache holding up to size vectors, or nil when size
+// is zero and caching is disabled.
+func newVectorCache(size int) (cache *vectorCache) {
+	if size <= 0 {
+		return cache
+	}
+
+	cache = &vectorCache{
+		size:    size,
+		entries: make(map[cacheKey]*list.Element, size),
+		recency: list.New(),
+	}
+	return cache
+}
+
+// get returns the cached vector for key, if any. A nil cache holds nothing.
+func (c *vectorCache) get(key cacheKey) (vector []float32, found bool) {
+	if c == nil {
+		return vector, found
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return vector, found
+	}
+	c.recency.MoveToFront(element)
+	entry, _ := element.Value.(*cacheEntry)
+	vector = entry.vector
+	return vector, found
+}
+
+// put caches vector for key, evicting the least recently used vector when
+// the cache is full.
+func (c *vectorCache) put(key cacheKey, vector []float32) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, found := c.entries[key]; found {
+		entry, _ := element.Value.(*cacheEntry)
+		entry.vector = vector
+		c.recency.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.recency.PushFront(&cacheEntry{key: key, vector: vector})
+	if c.recency.Len() > c.size {
+		oldest, _ := c.recency.Remove(c.recency.Back()).(*cacheEntry)
+		delete(c.entries, oldest.key)
+	}
+}
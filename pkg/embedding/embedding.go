@@ -0,0 +1,346 @@
+// Package embedding generates vector embeddings for code through an
+// OpenAI-compatible embeddings API or Ollama's native one.
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+)
+
+// ErrNotConfigured is returned when embeddings are requested without EMBEDDING_URL.
+var ErrNotConfigured = errors.New("EMBEDDING_URL and EMBEDDING_MODEL must be set for embeddings")
+
+// Client requests embeddings from an OpenAI-compatible /v1/embeddings
+// endpoint, as served by OpenAI, vLLM, and LocalAI, or from Ollama's
+// /api/embed. Texts are sent in batches of EMBEDDING_BATCH_SIZE, up to
+// EMBEDDING_CONCURRENCY at a time. The vectors of recently embedded texts are
+// cached in memory by content hash and, with a store, in an index that
+// outlives the process.
+type Client struct {
+	url         string
+	provider    string
+	model       string
+	apiKey      string
+	batchSize   int
+	concurrency int
+	cache       *vectorCache
+	store       *elasticsearch.EmbeddingCache
+	metrics     *metrics.Metrics
+	client      *http.Client
+}
+
+// embeddingsRequest is the request body of the embeddings API, and of
+// Ollama's.
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embeddingsResponse is the subset of the embeddings API response used here.
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// ollamaResponse is the subset of Ollama's /api/embed response used here,
+// with the vectors in input order.
+type ollamaResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// New creates an embeddings client from cfg. Vectors missing from the memory
+// cache are looked up in store, when it's set, before being embedded, and
+// cache lookups are counted in m, when it's set. It returns ErrNotConfigured
+// when no endpoint or model is set.
+func New(cfg config.Config, m *metrics.Metrics, store *elasticsearch.EmbeddingCache) (client *Client, err error) {
+	if cfg.EmbeddingURL == "" || cfg.EmbeddingModel == "" {
+		err = ErrNotConfigured
+		return client, err
+	}
+
+	url := cfg.EmbeddingURL
+	if cfg.EmbeddingProvider == config.EmbeddingProviderOllama {
+		url = strings.TrimSuffix(url, "/") + "/api/embed"
+	}
+
+	client = &Client{
+		url:         url,
+		provider:    cfg.EmbeddingProvider,
+		model:       cfg.EmbeddingModel,
+		apiKey:      cfg.EmbeddingAPIKey,
+		batchSize:   cfg.EmbeddingBatchSize,
+		concurrency: max(cfg.EmbeddingConcurrency, 1),
+		cache:       newVectorCache(cfg.EmbeddingCacheSize),
+		store:       store,
+		metrics:     m,
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+	return client, err
+}
+
+// Model returns the name of the embedding model.
+func (c *Client) Model() (model string) {
+	model = c.model
+	return model
+}
+
+// Embed returns one vector per input text, in input order. Cached texts
+// aren't sent again, and neither are repeats within texts.
+func (c *Client) Embed(ctx context.Context, texts []string) (vectors [][]float32, err error) {
+	vectors = make([][]float32, len(texts))
+	positions := map[cacheKey][]int{}
+	var missing []string
+	var keys []cacheKey
+	for i, text := range texts {
+		key := c.key(text)
+		if vector, cached := c.cache.get(key); cached {
+			vectors[i] = vector
+			continue
+		}
+		if _, pending := positions[key]; !pending {
+			missing = append(missing, text)
+			keys = append(keys, key)
+		}
+		positions[key] = append(positions[key], i)
+	}
+	if c.cache != nil {
+		misses := 0
+		for _, key := range keys {
+			misses += len(positions[key])
+		}
+		c.observe("memory", "hit", len(texts)-misses)
+		c.observe("memory", "miss", misses)
+	}
+
+	fill := func(key cacheKey, vector []float32) {
+		c.cache.put(key, vector)
+		for _, position := range positions[key] {
+			vectors[position] = vector
+		}
+	}
+
+	missing, keys = c.lookup(ctx, missing, keys, fill)
+	if len(missing) == 0 {
+		return vectors, err
+	}
+
+	var embedded [][]float32
+	embedded, err = c.embedBatches(ctx, missing)
+	if err != nil {
+		return vectors, err
+	}
+
+	for i, key := range keys {
+		fill(key, embedded[i])
+	}
+	c.save(ctx, keys, embedded)
+	return vectors, err
+}
+
+// key returns the cache key of a text embedded with the client's model.
+func (c *Client) key(text string) (key cacheKey) {
+	key = sha256.Sum256([]byte(c.model + "\x00" + text))
+	return key
+}
+
+// lookup passes the vectors the store holds for texts to fill, and returns
+// the texts it doesn't hold, with their keys. A store that can't be read is
+// counted and skipped, so the texts are embedded instead.
+func (c *Client) lookup(ctx context.Context, texts []string, keys []cacheKey, fill func(cacheKey, []float32)) (remaining []string, remainingKeys []cacheKey) {
+	if c.store == nil || len(texts) == 0 {
+		remaining = texts
+		remainingKeys = keys
+		return remaining, remainingKeys
+	}
+
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = hex.EncodeToString(key[:])
+	}
+
+	stored, err := c.store.Vectors(ctx, ids)
+	if err != nil {
+		c.observe("index", "error", len(texts))
+		remaining = texts
+		remainingKeys = keys
+		return remaining, remainingKeys
+	}
+
+	for i, key := range keys {
+		vector, found := stored[ids[i]]
+		if !found {
+			remaining = append(remaining, texts[i])
+			remainingKeys = append(remainingKeys, key)
+			continue
+		}
+		fill(key, vector)
+	}
+	c.observe("index", "hit", len(texts)-len(remaining))
+	c.observe("index", "miss", len(remaining))
+	return remaining, remainingKeys
+}
+
+// save writes newly embedded vectors to the store. A failed write only
+// means they're embedded again next time; Elasticsearch request metrics
+// record it.
+func (c *Client) save(ctx context.Context, keys []cacheKey, vectors [][]float32) {
+	if c.store == nil {
+		return
+	}
+
+	entries := make(map[string][]float32, len(keys))
+	for i, key := range keys {
+		entries[hex.EncodeToString(key[:])] = vectors[i]
+	}
+	_ = c.store.Put(ctx, c.model, entries)
+}
+
+// observe counts cache lookups of texts.
+func (c *Client) observe(cache string, result string, texts int) {
+	if c.metrics == nil || texts == 0 {
+		return
+	}
+	c.metrics.EmbeddingCache.WithLabelValues(cache, result).Add(float64(texts))
+}
+
+// embedBatches embeds texts in batches of batchSize, running up to
+// concurrency requests at once. The first failure cancels the rest.
+func (c *Client) embedBatches(ctx context.Context, texts []string) (vectors [][]float32, err error) {
+	size := c.batchSize
+	if size <= 0 {
+		size = len(texts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	vectors = make([][]float32, len(texts))
+	slots := make(chan struct{}, c.concurrency)
+	var failed sync.Once
+	var wg sync.WaitGroup
+	for start := 0; start < len(texts); start += size {
+		end := min(start+size, len(texts))
+		wg.Go(func() {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			batch, batchErr := c.embedBatch(ctx, texts[start:end])
+			if batchErr != nil {
+				failed.Do(func() {
+					err = batchErr
+					cancel()
+				})
+				return
+			}
+			copy(vectors[start:end], batch)
+		})
+	}
+	wg.Wait()
+
+	return vectors, err
+}
+
+// embedBatch requests the vectors of one batch of texts from the provider.
+func (c *Client) embedBatch(ctx context.Context, texts []string) (vectors [][]float32, err error) {
+	request := embeddingsRequest{Model: c.model, Input: texts}
+
+	if c.provider == config.EmbeddingProviderOllama {
+		var parsed ollamaResponse
+		err = c.post(ctx, request, &parsed)
+		if err != nil {
+			return vectors, err
+		}
+		if len(parsed.Embeddings) != len(texts) {
+			err = fmt.Errorf("embeddings API returned %d vectors for %d inputs", len(parsed.Embeddings), len(texts))
+			return vectors, err
+		}
+		vectors = parsed.Embeddings
+		return vectors, err
+	}
+
+	var parsed embeddingsResponse
+	err = c.post(ctx, request, &parsed)
+	if err != nil {
+		return vectors, err
+	}
+
+	if len(parsed.Data) != len(texts) {
+		err = fmt.Errorf("embeddings API returned %d vectors for %d inputs", len(parsed.Data), len(texts))
+		return vectors, err
+	}
+
+	vectors = make([][]float32, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			err = fmt.Errorf("embeddings API returned out-of-range index %d", item.Index)
+			return vectors, err
+		}
+		vectors[item.Index] = item.Embedding
+	}
+
+	return vectors, err
+}
+
+// post sends an embeddings request and decodes the response into parsed.
+func (c *Client) post(ctx context.Context, request embeddingsRequest, parsed any) (err error) {
+	var data []byte
+	data, err = json.Marshal(request)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal embeddings request: %w", err)
+		return err
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("failed to create embeddings request: %w", err)
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	var resp *http.Response
+	resp, err = c.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to request embeddings: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("embeddings API returned status %d: %s", resp.StatusCode, body)
+		return err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(parsed)
+	if err != nil {
+		err = fmt.Errorf("failed to decode embeddings response: %w", err)
+		return err
+	}
+	return err
+}
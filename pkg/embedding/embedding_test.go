@@ -0,0 +1,340 @@
+package embedding
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEmbed(t *testing.T) {
+	var gotAuth string
+	var gotReq embeddingsRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		// Out of order to check vectors are placed by index.
+		_, _ = w.Write([]byte(`{"data":[{"index":1,"embedding":[0.3,0.4]},{"index":0,"embedding":[0.1,0.2]}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := New(config.Config{EmbeddingURL: srv.URL, EmbeddingModel: "code-embed-v2", EmbeddingAPIKey: "sk-test"}, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	vectors, err := client.Embed(t.Context(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	if gotAuth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q, want bearer API key", gotAuth)
+	}
+	if gotReq.Model != "code-embed-v2" || len(gotReq.Input) != 2 {
+		t.Errorf("request = %+v, want model and two inputs", gotReq)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 0.1 || vectors[1][0] != 0.3 {
+		t.Errorf("Embed() = %v, want vectors in input order", vectors)
+	}
+}
+
+func TestEmbedOllama(t *testing.T) {
+	var gotPath string
+	var gotReq embeddingsRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		_, _ = w.Write([]byte(`{"model":"nomic-embed-text","embeddings":[[0.1,0.2],[0.3,0.4]]}`))
+	}))
+	defer srv.Close()
+
+	client, err := New(config.Config{EmbeddingProvider: config.EmbeddingProviderOllama, EmbeddingURL: srv.URL + "/", EmbeddingModel: "nomic-embed-text"}, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	vectors, err := client.Embed(t.Context(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	if gotPath != "/api/embed" {
+		t.Errorf("path = %s, want /api/embed", gotPath)
+	}
+	if gotReq.Model != "nomic-embed-text" || len(gotReq.Input) != 2 {
+		t.Errorf("request = %+v, want model and two inputs", gotReq)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 0.1 || vectors[1][0] != 0.3 {
+		t.Errorf("Embed() = %v, want vectors in input order", vectors)
+	}
+}
+
+// vectorServer answers Ollama embedding requests with a one-dimensional
+// vector per input holding its length, recording each request's inputs.
+func vectorServer(t *testing.T) (srv *httptest.Server, requests *[][]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	requests = &[][]string{}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embeddingsRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		*requests = append(*requests, req.Input)
+		mu.Unlock()
+
+		resp := ollamaResponse{}
+		for _, input := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(len(input))})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func TestEmbedBatches(t *testing.T) {
+	srv, requests := vectorServer(t)
+	client, err := New(config.Config{
+		EmbeddingProvider:    config.EmbeddingProviderOllama,
+		EmbeddingURL:         srv.URL,
+		EmbeddingModel:       "m",
+		EmbeddingBatchSize:   2,
+		EmbeddingConcurrency: 2,
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	vectors, err := client.Embed(t.Context(), texts)
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	if len(*requests) != 3 {
+		t.Errorf("requests = %v, want 3 batches", *requests)
+	}
+	for _, batch := range *requests {
+		if len(batch) > 2 {
+			t.Errorf("batch %v exceeds EMBEDDING_BATCH_SIZE", batch)
+		}
+	}
+	for i, text := range texts {
+		if vectors[i][0] != float32(len(text)) {
+			t.Errorf("vectors[%d] = %v, want the vector of %q", i, vectors[i], text)
+		}
+	}
+}
+
+func TestEmbedBatchesConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	release := make(chan struct{})
+	var released sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := peak.Load()
+			if current <= seen || peak.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		if current == 2 {
+			released.Do(func() { close(release) })
+		}
+		<-release
+
+		var req embeddingsRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_, _ = w.Write([]byte(`{"embeddings":[` + strings.Repeat(`[1],`, len(req.Input)-1) + `[1]]}`))
+	}))
+	defer srv.Close()
+
+	client, err := New(config.Config{
+		EmbeddingProvider:    config.EmbeddingProviderOllama,
+		EmbeddingURL:         srv.URL,
+		EmbeddingModel:       "m",
+		EmbeddingBatchSize:   1,
+		EmbeddingConcurrency: 2,
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = client.Embed(t.Context(), []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrent requests = %d, want EMBEDDING_CONCURRENCY 2", peak.Load())
+	}
+}
+
+func TestEmbedCache(t *testing.T) {
+	srv, requests := vectorServer(t)
+	client, err := New(config.Config{
+		EmbeddingProvider:  config.EmbeddingProviderOllama,
+		EmbeddingURL:       srv.URL,
+		EmbeddingModel:     "m",
+		EmbeddingCacheSize: 2,
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = client.Embed(t.Context(), []string{"a", "bb", "a"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	vectors, err := client.Embed(t.Context(), []string{"bb", "ccc", "a"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	want := [][]string{{"a", "bb"}, {"ccc"}}
+	if len(*requests) != len(want) || strings.Join((*requests)[0], ",") != "a,bb" || strings.Join((*requests)[1], ",") != "ccc" {
+		t.Errorf("requests = %v, want %v", *requests, want)
+	}
+	if vectors[0][0] != 2 || vectors[1][0] != 3 || vectors[2][0] != 1 {
+		t.Errorf("Embed() = %v, want vectors in input order", vectors)
+	}
+
+	// "bb" was least recently used when "ccc" was added to the full cache.
+	_, err = client.Embed(t.Context(), []string{"bb"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if len(*requests) != 3 {
+		t.Errorf("requests = %v, want the evicted text embedded again", *requests)
+	}
+}
+
+func TestEmbedStore(t *testing.T) {
+	model, requests := vectorServer(t)
+
+	// The cache index holds "a", embedded earlier with the same model.
+	stored := map[string]bool{}
+	var written []string
+	var mu sync.Mutex
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/embedding-cache/_mget":
+			var body struct {
+				IDs []string `json:"ids"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			docs := make([]string, 0, len(body.IDs))
+			for _, id := range body.IDs {
+				if stored[id] {
+					docs = append(docs, `{"_id":"`+id+`","found":true,"_source":{"vector":[9]}}`)
+				}
+			}
+			_, _ = w.Write([]byte(`{"docs":[` + strings.Join(docs, ",") + `]}`))
+		case "/_bulk":
+			data, _ := io.ReadAll(r.Body)
+			written = append(written, string(data))
+			_, _ = w.Write([]byte(`{"errors":false}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	cfg := config.Config{
+		EmbeddingProvider: config.EmbeddingProviderOllama,
+		EmbeddingURL:      model.URL,
+		EmbeddingModel:    "m",
+		ESHost:            es.URL,
+		ESIndex:           "code-index",
+	}
+	esClient, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client, err := New(cfg, m, esClient.EmbeddingCache("embedding-cache"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	key := client.key("a")
+	stored[hex.EncodeToString(key[:])] = true
+
+	vectors, err := client.Embed(t.Context(), []string{"a", "bb"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	if vectors[0][0] != 9 || vectors[1][0] != 2 {
+		t.Errorf("Embed() = %v, want the stored vector for a and an embedded one for bb", vectors)
+	}
+	if len(*requests) != 1 || strings.Join((*requests)[0], ",") != "bb" {
+		t.Errorf("requests = %v, want only bb embedded", *requests)
+	}
+	bbKey := client.key("bb")
+	if len(written) != 1 || !strings.Contains(written[0], hex.EncodeToString(bbKey[:])) {
+		t.Errorf("written = %v, want the vector of bb stored", written)
+	}
+	if got := testutil.ToFloat64(m.EmbeddingCache.WithLabelValues("index", "hit")); got != 1 {
+		t.Errorf("index hits = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.EmbeddingCache.WithLabelValues("index", "miss")); got != 1 {
+		t.Errorf("index misses = %v, want 1", got)
+	}
+}
+
+func TestEmbedErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: `{"error":"boom"}`},
+		{name: "count mismatch", status: http.StatusOK, body: `{"data":[{"index":0,"embedding":[0.1]}]}`},
+		{name: "index out of range", status: http.StatusOK, body: `{"data":[{"index":0,"embedding":[0.1]},{"index":5,"embedding":[0.2]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			client, err := New(config.Config{EmbeddingURL: srv.URL, EmbeddingModel: "m"}, nil, nil)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = client.Embed(t.Context(), []string{"a", "b"})
+			if err == nil {
+				t.Error("Embed() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewNotConfigured(t *testing.T) {
+	_, err := New(config.Config{EmbeddingModel: "m"}, nil, nil)
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("New() error = %v, want ErrNotConfigured", err)
+	}
+}
@@ -0,0 +1,251 @@
+// Package enrich adds custom fields to documents before they are indexed,
+// so teams can attach ownership, tier, or other catalog data without
+// changing the indexer.
+package enrich
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// ErrHookExited is returned when the hook process exits while the indexer
+// is waiting for its answer.
+var ErrHookExited = errors.New("enrichment hook exited")
+
+// ErrHookTimeout is returned when the hook doesn't answer within its timeout.
+var ErrHookTimeout = errors.New("enrichment hook timed out")
+
+// maxResponseBytes bounds one line of hook output.
+const maxResponseBytes = 1 << 20
+
+// Hook enriches documents before they are indexed. Enrich may add entries
+// to the document's Metadata; a document it fails on is indexed without
+// them. Close releases the hook at the end of an index run.
+type Hook interface {
+	Enrich(ctx context.Context, doc *elasticsearch.CodeDocument) (err error)
+	Close() (err error)
+}
+
+// Exec is a Hook backed by an external command speaking JSON lines. The
+// command is started on the first document and kept running: each document
+// is written to its stdin as one line of JSON, and it answers each with one
+// line holding a JSON object of string fields, such as
+// {"team":"payments","tier":"1"}, or {} to add nothing. Its stderr is
+// passed through to the indexer's. A command that fails, times out, or
+// answers with anything else is stopped and started again for the next
+// document.
+type Exec struct {
+	command []string
+	timeout time.Duration
+	mu      sync.Mutex
+	proc    *process
+}
+
+// process is one running instance of the hook command.
+type process struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte
+	done  chan struct{}
+}
+
+// NewExec creates a hook running command, which must answer each document
+// within timeout.
+func NewExec(command []string, timeout time.Duration) (hook *Exec) {
+	hook = &Exec{
+		command: command,
+		timeout: timeout,
+	}
+	return hook
+}
+
+// Enrich sends the document to the hook and merges the fields it answers
+// with into the document's Metadata.
+func (e *Exec) Enrich(ctx context.Context, doc *elasticsearch.CodeDocument) (err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var request []byte
+	request, err = json.Marshal(doc)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal document: %w", err)
+		return err
+	}
+
+	if e.proc == nil {
+		e.proc, err = startProcess(e.command)
+		if err != nil {
+			return err
+		}
+	}
+
+	var line []byte
+	line, err = e.exchange(ctx, append(request, '\n'))
+	if err != nil {
+		e.proc.stop()
+		e.proc = nil
+		return err
+	}
+
+	var fields map[string]string
+	err = json.Unmarshal(line, &fields)
+	if err != nil {
+		e.proc.stop()
+		e.proc = nil
+		err = fmt.Errorf("invalid enrichment hook response: must be a JSON object of strings: %w", err)
+		return err
+	}
+
+	for key := range fields {
+		if !elasticsearch.ValidMetadataKey(key) {
+			err = fmt.Errorf("invalid enrichment hook response: invalid field name %q", key)
+			return err
+		}
+	}
+
+	for key, value := range fields {
+		if doc.Metadata == nil {
+			doc.Metadata = make(map[string]string, len(fields))
+		}
+		doc.Metadata[key] = value
+	}
+	return err
+}
+
+// exchange writes a request to the running process and waits for its
+// answer.
+func (e *Exec) exchange(ctx context.Context, request []byte) (line []byte, err error) {
+	written := make(chan error, 1)
+	go func() {
+		_, writeErr := e.proc.stdin.Write(request)
+		written <- writeErr
+	}()
+
+	timer := time.NewTimer(e.timeout)
+	defer timer.Stop()
+
+	received := false
+	for !received {
+		select {
+		case writeErr := <-written:
+			if writeErr != nil {
+				err = fmt.Errorf("failed to write to enrichment hook: %w", writeErr)
+				return line, err
+			}
+			written = nil
+		case next, ok := <-e.proc.lines:
+			if !ok {
+				err = ErrHookExited
+				return line, err
+			}
+			line = next
+			received = true
+		case <-timer.C:
+			err = fmt.Errorf("%w after %v", ErrHookTimeout, e.timeout)
+			return line, err
+		case <-ctx.Done():
+			err = ctx.Err()
+			return line, err
+		}
+	}
+
+	return line, err
+}
+
+// Close stops the hook process, giving it the timeout to exit after its
+// stdin is closed.
+func (e *Exec) Close() (err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.proc == nil {
+		return err
+	}
+
+	proc := e.proc
+	e.proc = nil
+
+	_ = proc.stdin.Close()
+	timer := time.AfterFunc(e.timeout, func() {
+		_ = proc.cmd.Process.Kill()
+	})
+	defer timer.Stop()
+
+	close(proc.done)
+	err = proc.cmd.Wait()
+	if err != nil {
+		err = fmt.Errorf("enrichment hook failed: %w", err)
+	}
+	return err
+}
+
+// startProcess starts the hook command with a goroutine reading its answers.
+func startProcess(command []string) (proc *process, err error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+
+	var stdin io.WriteCloser
+	stdin, err = cmd.StdinPipe()
+	if err != nil {
+		err = fmt.Errorf("failed to start enrichment hook: %w", err)
+		return proc, err
+	}
+
+	var stdout io.ReadCloser
+	stdout, err = cmd.StdoutPipe()
+	if err != nil {
+		err = fmt.Errorf("failed to start enrichment hook: %w", err)
+		return proc, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		err = fmt.Errorf("failed to start enrichment hook: %w", err)
+		return proc, err
+	}
+
+	proc = &process{
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan []byte),
+		done:  make(chan struct{}),
+	}
+	go proc.read(stdout)
+
+	return proc, err
+}
+
+// read sends each line of output to lines until the output ends or the
+// process is stopped.
+func (p *process) read(stdout io.Reader) {
+	defer close(p.lines)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxResponseBytes)
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		select {
+		case p.lines <- line:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// stop kills the process after a failed exchange.
+func (p *process) stop() {
+	close(p.done)
+	_ = p.stdin.Close()
+	_ = p.cmd.Process.Kill()
+	_ = p.cmd.Wait()
+}
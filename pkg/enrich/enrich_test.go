@@ -0,0 +1,130 @@
+package enrich
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// shellHook runs script under sh as the hook command.
+func shellHook(script string, timeout time.Duration) (hook *Exec) {
+	hook = NewExec([]string{"sh", "-c", script}, timeout)
+	return hook
+}
+
+func TestExecEnrich(t *testing.T) {
+	// Answers with the owner of each document's repo, and tier 1 for the
+	// payments service.
+	hook := shellHook(`while read -r doc; do
+  case "$doc" in
+    *'"repo":"payments"'*) echo '{"team":"payments","tier":"1"}' ;;
+    *) echo '{}' ;;
+  esac
+done`, 5*time.Second)
+	defer hook.Close()
+
+	tests := []struct {
+		name string
+		doc  elasticsearch.CodeDocument
+		want map[string]string
+	}{
+		{
+			name: "fields added",
+			doc:  elasticsearch.CodeDocument{Repo: "payments", FunctionName: "Charge"},
+			want: map[string]string{"team": "payments", "tier": "1"},
+		},
+		{
+			name: "existing fields kept",
+			doc:  elasticsearch.CodeDocument{Repo: "payments", Metadata: map[string]string{"source": "catalog"}},
+			want: map[string]string{"source": "catalog", "team": "payments", "tier": "1"},
+		},
+		{
+			name: "nothing added",
+			doc:  elasticsearch.CodeDocument{Repo: "web"},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := tt.doc
+			err := hook.Enrich(t.Context(), &doc)
+			if err != nil {
+				t.Fatalf("Enrich() error = %v", err)
+			}
+			if len(doc.Metadata) != len(tt.want) {
+				t.Fatalf("Metadata = %v, want %v", doc.Metadata, tt.want)
+			}
+			for key, value := range tt.want {
+				if doc.Metadata[key] != value {
+					t.Errorf("Metadata[%q] = %q, want %q", key, doc.Metadata[key], value)
+				}
+			}
+		})
+	}
+
+	err := hook.Close()
+	if err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestExecEnrichFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr error
+	}{
+		{
+			name:    "timeout",
+			script:  `exec sleep 5`,
+			wantErr: ErrHookTimeout,
+		},
+		{
+			name:    "exit",
+			script:  `read -r doc`,
+			wantErr: ErrHookExited,
+		},
+		{
+			name:   "not an object of strings",
+			script: `while read -r doc; do echo '{"tier":1}'; done`,
+		},
+		{
+			name:   "invalid field name",
+			script: `while read -r doc; do echo '{"owner.team":"payments"}'; done`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := shellHook(tt.script, 200*time.Millisecond)
+			defer hook.Close()
+
+			// The hook is restarted after a failure, so every document fails
+			// the same way.
+			for range 2 {
+				doc := elasticsearch.CodeDocument{Repo: "payments"}
+				err := hook.Enrich(t.Context(), &doc)
+				if err == nil {
+					t.Fatal("Enrich() succeeded, want error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("Enrich() error = %v, want %v", err, tt.wantErr)
+				}
+				if doc.Metadata != nil {
+					t.Errorf("Metadata = %v, want none", doc.Metadata)
+				}
+			}
+		})
+	}
+}
+
+func TestExecCloseWithoutStart(t *testing.T) {
+	hook := NewExec([]string{"does-not-exist"}, time.Second)
+	err := hook.Close()
+	if err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+// Package export writes scheduled NDJSON snapshots of the index to
+// S3-compatible object storage and prunes old snapshots.
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+)
+
+// snapshotSuffix is the file extension of exported snapshots.
+const snapshotSuffix = ".ndjson.gz"
+
+// Result describes a completed export.
+type Result struct {
+	Key       string `json:"key"`
+	Documents int64  `json:"documents"`
+	SizeBytes int64  `json:"size_in_bytes"`
+	Pruned    int    `json:"pruned"`
+}
+
+// Exporter writes gzipped NDJSON snapshots of the index to object storage.
+type Exporter struct {
+	config  config.Config
+	es      *elasticsearch.Client
+	store   *objectStore
+	metrics *metrics.Metrics
+	logger  logging.Logger
+}
+
+// New creates an Exporter from the export settings in cfg.
+func New(cfg config.Config, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger) (exporter *Exporter) {
+	exporter = &Exporter{
+		config: cfg,
+		es:     es,
+		store: &objectStore{
+			endpoint:     cfg.ExportEndpoint,
+			bucket:       cfg.ExportBucket,
+			region:       cfg.ExportRegion,
+			accessKey:    cfg.ExportAccessKey,
+			secretKey:    cfg.ExportSecretKey,
+			sessionToken: cfg.ExportSessionToken,
+			client: &http.Client{
+				Timeout: 30 * time.Minute,
+			},
+			now: time.Now,
+		},
+		metrics: m,
+		logger:  logger,
+	}
+	return exporter
+}
+
+// RunExportLoop exports the index every ExportInterval until ctx ends.
+func (e *Exporter) RunExportLoop(ctx context.Context) {
+	ticker := time.NewTicker(e.config.ExportInterval)
+	defer ticker.Stop()
+
+	e.logger.Info("Starting export scheduler", "interval", e.config.ExportInterval, "bucket", e.config.ExportBucket)
+
+	for {
+		select {
+		case <-ticker.C:
+			result, err := e.Export(ctx)
+			if err != nil {
+				e.logger.Error("Index export failed", "error", err)
+				continue
+			}
+			e.logger.Info("Index export complete", "key", result.Key, "documents", result.Documents,
+				"size_bytes", result.SizeBytes, "pruned", result.Pruned)
+
+		case <-ctx.Done():
+			e.logger.Info("Export scheduler stopped")
+			return
+		}
+	}
+}
+
+// Export writes a snapshot of the index to object storage and then removes
+// snapshots beyond the retention count.
+func (e *Exporter) Export(ctx context.Context) (result Result, err error) {
+	result, err = e.upload(ctx)
+	if err != nil {
+		e.metrics.Exports.WithLabelValues("error").Inc()
+		return result, err
+	}
+
+	e.metrics.Exports.WithLabelValues("success").Inc()
+	e.metrics.LastSuccessfulExport.SetToCurrentTime()
+
+	result.Pruned, err = e.prune(ctx)
+	if err != nil {
+		err = fmt.Errorf("export uploaded but retention failed: %w", err)
+		return result, err
+	}
+
+	return result, err
+}
+
+// upload streams the index into a temporary gzip file and uploads it.
+func (e *Exporter) upload(ctx context.Context) (result Result, err error) {
+	var tmp *os.File
+	tmp, err = os.CreateTemp("", "rag-indexer-export-*"+snapshotSuffix)
+	if err != nil {
+		err = fmt.Errorf("failed to create temp file: %w", err)
+		return result, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, hash))
+
+	result.Documents, err = e.es.Export(ctx, gz)
+	if err != nil {
+		err = fmt.Errorf("failed to export index: %w", err)
+		return result, err
+	}
+
+	err = gz.Close()
+	if err != nil {
+		err = fmt.Errorf("failed to compress export: %w", err)
+		return result, err
+	}
+
+	result.SizeBytes, err = tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		err = fmt.Errorf("failed to size export: %w", err)
+		return result, err
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		err = fmt.Errorf("failed to rewind export: %w", err)
+		return result, err
+	}
+
+	result.Key = e.snapshotKey(e.store.now())
+	err = e.store.put(ctx, result.Key, tmp, result.SizeBytes, hex.EncodeToString(hash.Sum(nil)))
+	return result, err
+}
+
+// prune deletes the oldest snapshots beyond the retention count. A retention
+// of zero or less keeps every snapshot.
+func (e *Exporter) prune(ctx context.Context) (deleted int, err error) {
+	if e.config.ExportRetention <= 0 {
+		return deleted, err
+	}
+
+	var keys []string
+	keys, err = e.store.list(ctx, e.snapshotPrefix())
+	if err != nil {
+		return deleted, err
+	}
+
+	var snapshots []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, snapshotSuffix) {
+			snapshots = append(snapshots, key)
+		}
+	}
+
+	// Keys embed a fixed-width UTC timestamp, so lexical order is chronological.
+	sort.Strings(snapshots)
+
+	for len(snapshots) > e.config.ExportRetention {
+		err = e.store.delete(ctx, snapshots[0])
+		if err != nil {
+			return deleted, err
+		}
+		snapshots = snapshots[1:]
+		deleted++
+	}
+
+	return deleted, err
+}
+
+// snapshotPrefix is the key prefix shared by all snapshots of the index.
+func (e *Exporter) snapshotPrefix() (prefix string) {
+	prefix = e.config.ExportPrefix + e.config.ESIndex + "-"
+	return prefix
+}
+
+// snapshotKey returns the object key for a snapshot taken at the given time.
+func (e *Exporter) snapshotKey(at time.Time) (key string) {
+	key = e.snapshotPrefix() + at.UTC().Format(amzDateFormat) + snapshotSuffix
+	return key
+}
@@ -0,0 +1,158 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeBucket is an in-memory S3-compatible bucket supporting put, list, and delete.
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), sigV4Algorithm) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		b.objects[key] = body
+	case http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}
+		for name := range b.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, struct {
+					Key string `xml:"Key"`
+				}{Key: name})
+			}
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	}
+}
+
+func (b *fakeBucket) keys() (keys []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestExport(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			_, _ = w.Write([]byte(`{"version":{"number":"8.11.0"}}`))
+		case r.URL.Path == "/code-index/_search":
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[` +
+				`{"_source":{"repo":"api","function_name":"Handle"}},` +
+				`{"_source":{"repo":"api","function_name":"Serve"}}]}}`))
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[]}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	bucket := &fakeBucket{objects: map[string][]byte{
+		"exports/code-index-20240101T000000Z.ndjson.gz":  nil,
+		"exports/code-index-20240102T000000Z.ndjson.gz":  nil,
+		"exports/other-index-20240101T000000Z.ndjson.gz": nil,
+	}}
+	s3 := httptest.NewServer(bucket)
+	defer s3.Close()
+
+	cfg := config.Config{
+		ESHost:          es.URL,
+		ESIndex:         "code-index",
+		ExportEndpoint:  s3.URL,
+		ExportBucket:    "bucket",
+		ExportPrefix:    "exports/",
+		ExportRegion:    "us-east-1",
+		ExportAccessKey: "key",
+		ExportSecretKey: "secret",
+		ExportRetention: 2,
+	}
+
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	exporter := New(cfg, client, m, logging.New(slog.New(slog.DiscardHandler)))
+	exporter.store.now = func() (now time.Time) {
+		now = time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+		return now
+	}
+
+	result, err := exporter.Export(t.Context())
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	wantKey := "exports/code-index-20240103T000000Z.ndjson.gz"
+	if result.Key != wantKey || result.Documents != 2 || result.Pruned != 1 {
+		t.Errorf("Export() = %+v, want key %s, 2 documents, 1 pruned", result, wantKey)
+	}
+
+	wantKeys := []string{
+		"exports/code-index-20240102T000000Z.ndjson.gz",
+		wantKey,
+		"exports/other-index-20240101T000000Z.ndjson.gz",
+	}
+	got := bucket.keys()
+	if strings.Join(got, ",") != strings.Join(wantKeys, ",") {
+		t.Errorf("bucket keys = %v, want %v", got, wantKeys)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(bucket.objects[wantKey]))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"Serve"`) {
+		t.Errorf("snapshot lines = %q, want 2 NDJSON documents", lines)
+	}
+}
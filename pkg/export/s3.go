@@ -0,0 +1,300 @@
+package export
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sigV4Algorithm identifies AWS Signature Version 4 in the Authorization header.
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	// amzDateFormat is the timestamp format used by SigV4.
+	amzDateFormat = "20060102T150405Z"
+	// emptyPayloadHash is the SHA-256 of an empty body.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// objectStore is a minimal client for S3-compatible object storage, signing
+// requests with AWS Signature Version 4. Buckets are addressed path-style so
+// the same client works against AWS S3, GCS interoperability (HMAC keys), and
+// MinIO.
+type objectStore struct {
+	endpoint     string
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	now          func() time.Time
+}
+
+// listBucketResult is the subset of a ListObjectsV2 response used for retention.
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// put uploads body as the object key. payloadHash is the hex SHA-256 of body.
+func (s *objectStore) put(ctx context.Context, key string, body io.Reader, size int64, payloadHash string) (err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key, nil), body)
+	if err != nil {
+		err = fmt.Errorf("failed to create upload request: %w", err)
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+
+	_, err = s.do(req, payloadHash)
+	if err != nil {
+		err = fmt.Errorf("failed to upload %s: %w", key, err)
+		return err
+	}
+
+	return err
+}
+
+// list returns the keys of all objects under prefix.
+func (s *objectStore) list(ctx context.Context, prefix string) (keys []string, err error) {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL("", query), nil)
+		if err != nil {
+			err = fmt.Errorf("failed to create list request: %w", err)
+			return keys, err
+		}
+
+		var body []byte
+		body, err = s.do(req, emptyPayloadHash)
+		if err != nil {
+			err = fmt.Errorf("failed to list %s: %w", prefix, err)
+			return keys, err
+		}
+
+		var result listBucketResult
+		err = xml.Unmarshal(body, &result)
+		if err != nil {
+			err = fmt.Errorf("failed to decode object listing: %w", err)
+			return keys, err
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, err
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// delete removes the object key.
+func (s *objectStore) delete(ctx context.Context, key string) (err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key, nil), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create delete request: %w", err)
+		return err
+	}
+
+	_, err = s.do(req, emptyPayloadHash)
+	if err != nil {
+		err = fmt.Errorf("failed to delete %s: %w", key, err)
+		return err
+	}
+
+	return err
+}
+
+// objectURL builds the path-style URL for a key in the bucket.
+func (s *objectStore) objectURL(key string, query url.Values) (objectURL string) {
+	objectURL = strings.TrimSuffix(s.endpoint, "/") + "/" + s.bucket + "/" + key
+	if len(query) > 0 {
+		objectURL += "?" + query.Encode()
+	}
+	return objectURL
+}
+
+// do signs and sends the request, returning the response body. Non-2xx
+// statuses are errors.
+func (s *objectStore) do(req *http.Request, payloadHash string) (body []byte, err error) {
+	s.sign(req, payloadHash)
+
+	var resp *http.Response
+	resp, err = s.client.Do(req)
+	if err != nil {
+		return body, err
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read response: %w", err)
+		return body, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("object store returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return body, err
+	}
+
+	return body, err
+}
+
+// sign adds SigV4 authentication headers to the request. All headers already
+// set on the request are signed along with the host.
+func (s *objectStore) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	canonicalHeaders, signedHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalHeaders returns the SigV4 canonical header block and signed header list.
+func canonicalHeaders(req *http.Request) (canonical string, signed string) {
+	values := map[string]string{"host": req.URL.Host}
+	for name, vals := range req.Header {
+		values[strings.ToLower(name)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	canonical = b.String()
+	signed = strings.Join(names, ";")
+	return canonical, signed
+}
+
+// canonicalURI URI-encodes each segment of the request path.
+func canonicalURI(u *url.URL) (uri string) {
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+
+	uri = strings.Join(segments, "/")
+	if uri == "" {
+		uri = "/"
+	}
+	return uri
+}
+
+// canonicalQuery returns the query string sorted and encoded for SigV4.
+func canonicalQuery(u *url.URL) (query string) {
+	params := u.Query()
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		vals := params[key]
+		sort.Strings(vals)
+		for _, val := range vals {
+			parts = append(parts, uriEncode(key)+"="+uriEncode(val))
+		}
+	}
+
+	query = strings.Join(parts, "&")
+	return query
+}
+
+// uriEncode percent-encodes everything except RFC 3986 unreserved characters.
+func uriEncode(value string) (encoded string) {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		if isUnreserved(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	encoded = b.String()
+	return encoded
+}
+
+// isUnreserved reports whether c is an RFC 3986 unreserved character.
+func isUnreserved(c byte) (unreserved bool) {
+	unreserved = (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+	return unreserved
+}
+
+// hashHex returns the hex SHA-256 of data.
+func hashHex(data []byte) (hash string) {
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+	return hash
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key.
+func hmacSHA256(key []byte, data string) (mac []byte) {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	mac = h.Sum(nil)
+	return mac
+}
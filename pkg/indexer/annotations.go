@@ -0,0 +1,43 @@
+package indexer
+
+import (
+	"go/ast"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/parser"
+)
+
+// setAnnotations records the TODO and FIXME comments in a Go declaration,
+// from its doc comment to its end, and whether the doc comment deprecates
+// it. Comments in between declarations belong to neither.
+func (v *astVisitor) setAnnotations(doc *elasticsearch.CodeDocument, node ast.Node, docComment *ast.CommentGroup) {
+	start := node.Pos()
+	if docComment != nil {
+		start = docComment.Pos()
+		doc.Deprecated = isDeprecated(docComment)
+	}
+
+	for _, group := range v.comments {
+		if group.End() <= start || group.Pos() >= node.End() {
+			continue
+		}
+		for _, comment := range group.List {
+			doc.Markers = append(doc.Markers, parser.CommentMarkers(comment.Text, v.fset.Position(comment.Slash).Line)...)
+		}
+	}
+}
+
+// isDeprecated reports whether a doc comment has a paragraph starting with
+// "Deprecated:", the convention go doc and linters recognize.
+func isDeprecated(docComment *ast.CommentGroup) (deprecated bool) {
+	paragraphStart := true
+	for _, line := range strings.Split(docComment.Text(), "\n") {
+		if paragraphStart && strings.HasPrefix(line, "Deprecated:") {
+			deprecated = true
+			return deprecated
+		}
+		paragraphStart = strings.TrimSpace(line) == ""
+	}
+	return deprecated
+}
@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestAnnotations(t *testing.T) {
+	const src = `package retry
+
+// Do retries work.
+//
+// Deprecated: use DoContext.
+func Do(work func() error) (err error) {
+	// TODO: honour a policy
+	err = work()
+	return err
+}
+
+// FIXME: unused since the rewrite
+
+// DoContext retries work until ctx is done. It is not Deprecated: the
+// word has to open a paragraph.
+func DoContext(work func() error) (err error) {
+	err = work() // FIXME(nik) check ctx
+	return err
+}
+
+type (
+	// Policy says how often to retry.
+	//
+	// Deprecated: retries are fixed.
+	Policy struct{}
+
+	// TODO: add jitter
+	Backoff int
+)
+
+// Deprecated: set Timeout on the client instead.
+var DefaultTimeout = 5
+`
+
+	docs, err := parseGoFile("retry/retry.go", []byte(src), nil, nil)
+	if err != nil {
+		t.Fatalf("parseGoFile() error = %v", err)
+	}
+
+	got := map[string]elasticsearch.CodeDocument{}
+	for _, doc := range docs {
+		got[doc.FunctionName] = doc
+	}
+
+	tests := []struct {
+		name       string
+		deprecated bool
+		markers    []elasticsearch.Marker
+	}{
+		{name: "Do", deprecated: true, markers: []elasticsearch.Marker{{Tag: "TODO", Line: 7, Text: "honour a policy"}}},
+		{name: "DoContext", markers: []elasticsearch.Marker{{Tag: "FIXME", Line: 17, Text: "check ctx"}}},
+		{name: "Policy", deprecated: true},
+		{name: "Backoff", markers: []elasticsearch.Marker{{Tag: "TODO", Line: 27, Text: "add jitter"}}},
+		{name: "DefaultTimeout", deprecated: true},
+	}
+	for _, tt := range tests {
+		doc := got[tt.name]
+		if doc.Deprecated != tt.deprecated {
+			t.Errorf("%s Deprecated = %v, want %v", tt.name, doc.Deprecated, tt.deprecated)
+		}
+		if !slices.Equal(doc.Markers, tt.markers) {
+			t.Errorf("%s Markers = %+v, want %+v", tt.name, doc.Markers, tt.markers)
+		}
+	}
+}
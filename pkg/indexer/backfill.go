@@ -0,0 +1,227 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/embedding"
+)
+
+// ErrBackfillInProgress is returned when an embedding backfill is already running.
+var ErrBackfillInProgress = errors.New("embedding backfill already in progress")
+
+// errEmptyEmbedding is returned when the embeddings API returns zero-length vectors.
+var errEmptyEmbedding = errors.New("embedding model returned an empty vector")
+
+// BackfillStatus describes the latest embedding backfill.
+type BackfillStatus struct {
+	State       JobState   `json:"state"`
+	Model       string     `json:"model,omitempty"`
+	SourceIndex string     `json:"source_index,omitempty"`
+	TargetIndex string     `json:"target_index,omitempty"`
+	Documents   int64      `json:"documents"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// backfillTracker records the latest backfill and allows one at a time.
+type backfillTracker struct {
+	mu     sync.Mutex
+	status BackfillStatus
+}
+
+// start claims the backfill slot, failing if a backfill is already running.
+func (bt *backfillTracker) start(model string, source string, target string) (status BackfillStatus, err error) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	if bt.status.State == JobRunning {
+		status = bt.status
+		err = ErrBackfillInProgress
+		return status, err
+	}
+
+	now := time.Now()
+	bt.status = BackfillStatus{
+		State:       JobRunning,
+		Model:       model,
+		SourceIndex: source,
+		TargetIndex: target,
+		StartedAt:   &now,
+	}
+
+	status = bt.status
+	return status, err
+}
+
+// progress adds to the count of embedded documents.
+func (bt *backfillTracker) progress(documents int) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	bt.status.Documents += int64(documents)
+}
+
+// finish records the outcome of the backfill.
+func (bt *backfillTracker) finish(runErr error) (status BackfillStatus) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	now := time.Now()
+	bt.status.FinishedAt = &now
+	bt.status.State = JobCompleted
+	if runErr != nil {
+		bt.status.State = JobFailed
+		bt.status.Error = runErr.Error()
+	}
+
+	status = bt.status
+	return status
+}
+
+// get returns the latest backfill status.
+func (bt *backfillTracker) get() (status BackfillStatus) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	status = bt.status
+	return status
+}
+
+// BackfillEmbeddings re-embeds every document in the index with the configured
+// embedding model and blocks until done. Vectors are written in place, or, when
+// target names another index, documents are copied there with their vectors so
+// a model with different dimensions can be rolled out without touching the
+// live index.
+func (idx *Indexer) BackfillEmbeddings(ctx context.Context, target string) (status BackfillStatus, err error) {
+	var embedder *embedding.Client
+	embedder, status, err = idx.startBackfill(target)
+	if err != nil {
+		return status, err
+	}
+
+	err = idx.runBackfill(ctx, embedder, status.TargetIndex)
+	status = idx.backfill.finish(err)
+	return status, err
+}
+
+// StartEmbeddingBackfill runs BackfillEmbeddings in the background and returns
+// its initial status.
+func (idx *Indexer) StartEmbeddingBackfill(ctx context.Context, target string) (status BackfillStatus, err error) {
+	var embedder *embedding.Client
+	embedder, status, err = idx.startBackfill(target)
+	if err != nil {
+		return status, err
+	}
+
+	go func() {
+		runErr := idx.runBackfill(ctx, embedder, status.TargetIndex)
+		final := idx.backfill.finish(runErr)
+		if runErr != nil {
+			idx.logger.Error("Embedding backfill failed", "target", final.TargetIndex, "documents", final.Documents, "error", runErr)
+			return
+		}
+		idx.logger.Info("Embedding backfill complete", "target", final.TargetIndex, "documents", final.Documents)
+	}()
+
+	return status, err
+}
+
+// startBackfill claims the backfill slot for the indexer's embedder. An
+// empty target means the configured index.
+func (idx *Indexer) startBackfill(target string) (embedder *embedding.Client, status BackfillStatus, err error) {
+	embedder = idx.embedder
+	if embedder == nil {
+		err = embedding.ErrNotConfigured
+		return embedder, status, err
+	}
+
+	if target == "" {
+		target = idx.config.ESIndex
+	}
+
+	status, err = idx.backfill.start(embedder.Model(), idx.config.ESIndex, target)
+	return embedder, status, err
+}
+
+// EmbeddingBackfillStatus returns the status of the latest embedding backfill.
+func (idx *Indexer) EmbeddingBackfillStatus() (status BackfillStatus) {
+	status = idx.backfill.get()
+	return status
+}
+
+// runBackfill scrolls the index in pages of EMBEDDING_CONCURRENCY batches, so
+// the embedder can send them at once, embeds each page, and writes the
+// vectors to target. The vector mapping is set up from the first page, once
+// the model's dimensions are known.
+func (idx *Indexer) runBackfill(ctx context.Context, embedder *embedding.Client, target string) (err error) {
+	inPlace := target == idx.config.ESIndex
+	mapped := false
+
+	page := idx.config.EmbeddingBatchSize * max(idx.config.EmbeddingConcurrency, 1)
+	err = idx.es.ScrollDocuments(ctx, page, func(docs []elasticsearch.StoredDocument) (batchErr error) {
+		texts := make([]string, len(docs))
+		for i, doc := range docs {
+			texts[i], batchErr = embeddingText(doc.Source)
+			if batchErr != nil {
+				return batchErr
+			}
+		}
+
+		var vectors [][]float32
+		vectors, batchErr = embedder.Embed(ctx, texts)
+		if batchErr != nil {
+			return batchErr
+		}
+
+		if !mapped {
+			if len(vectors[0]) == 0 {
+				batchErr = errEmptyEmbedding
+				return batchErr
+			}
+			batchErr = idx.es.EnsureVectorIndex(ctx, target, len(vectors[0]))
+			if batchErr != nil {
+				return batchErr
+			}
+			mapped = true
+		}
+
+		updates := make([]elasticsearch.EmbeddingUpdate, len(docs))
+		for i, doc := range docs {
+			updates[i] = elasticsearch.EmbeddingUpdate{ID: doc.ID, Vector: vectors[i], Model: embedder.Model()}
+			if !inPlace {
+				updates[i].Source = doc.Source
+			}
+		}
+
+		batchErr = idx.es.WriteEmbeddings(ctx, target, updates)
+		if batchErr != nil {
+			return batchErr
+		}
+
+		idx.backfill.progress(len(docs))
+		return batchErr
+	})
+
+	return err
+}
+
+// embeddingText returns the text embedded for a stored document: its
+// qualified function name followed by the code.
+func embeddingText(source json.RawMessage) (text string, err error) {
+	var doc elasticsearch.CodeDocument
+	err = json.Unmarshal(source, &doc)
+	if err != nil {
+		err = fmt.Errorf("failed to decode document: %w", err)
+		return text, err
+	}
+
+	text = doc.EmbeddingText()
+	return text, err
+}
@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/embedding"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBackfillEmbeddingsInPlace(t *testing.T) {
+	var bulkBody string
+	var mappingUpdated bool
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/code-index/_search":
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[` +
+				`{"_id":"d1","_source":{"package":"api","function_name":"Handle","code":"func Handle() {}"}},` +
+				`{"_id":"d2","_source":{"package":"api","function_name":"Serve","code":"func Serve() {}"}}]}}`))
+		case r.URL.Path == "/_search/scroll" && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[]}}`))
+		case r.URL.Path == "/code-index/_mapping":
+			mappingUpdated = true
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		case r.URL.Path == "/_bulk":
+			body, _ := io.ReadAll(r.Body)
+			bulkBody = string(body)
+			_, _ = w.Write([]byte(`{"errors":false,"items":[]}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	var inputs []string
+	embedder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		inputs = append(inputs, req.Input...)
+		_, _ = w.Write([]byte(`{"data":[{"index":0,"embedding":[0.1,0.2]},{"index":1,"embedding":[0.3,0.4]}]}`))
+	}))
+	defer embedder.Close()
+
+	cfg := config.Config{
+		ESHost:             es.URL,
+		ESIndex:            "code-index",
+		EmbeddingURL:       embedder.URL,
+		EmbeddingModel:     "code-embed-v2",
+		EmbeddingBatchSize: 2,
+	}
+
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	idx := New(cfg, client, m, nil)
+	status, err := idx.BackfillEmbeddings(t.Context(), "")
+	if err != nil {
+		t.Fatalf("BackfillEmbeddings() error = %v", err)
+	}
+
+	if status.State != JobCompleted || status.Documents != 2 || status.TargetIndex != "code-index" {
+		t.Errorf("status = %+v, want completed in-place backfill of 2 documents", status)
+	}
+	if !mappingUpdated {
+		t.Error("vector mapping was not added to the existing index")
+	}
+	if len(inputs) != 2 || inputs[0] != "api.Handle\nfunc Handle() {}" {
+		t.Errorf("embedded texts = %q", inputs)
+	}
+	if strings.Count(bulkBody, `"update"`) != 2 || !strings.Contains(bulkBody, `"embedding_model":"code-embed-v2"`) {
+		t.Errorf("bulk body = %s, want two embedding updates", bulkBody)
+	}
+}
+
+func TestBackfillEmbeddingsNotConfigured(t *testing.T) {
+	idx := New(config.Config{ESIndex: "code-index"}, nil, nil, nil)
+
+	_, err := idx.StartEmbeddingBackfill(t.Context(), "")
+	if !errors.Is(err, embedding.ErrNotConfigured) {
+		t.Errorf("StartEmbeddingBackfill() error = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestBackfillTrackerSingleActive(t *testing.T) {
+	tracker := &backfillTracker{}
+
+	_, err := tracker.start("m", "code-index", "code-index")
+	if err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	_, err = tracker.start("m", "code-index", "code-index")
+	if !errors.Is(err, ErrBackfillInProgress) {
+		t.Errorf("second start() error = %v, want ErrBackfillInProgress", err)
+	}
+
+	tracker.finish(nil)
+	_, err = tracker.start("m", "code-index", "code-index-v2")
+	if err != nil {
+		t.Errorf("start() after finish error = %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseFootprint is a rough ratio of the memory a file takes while it is
+// parsed, counting its content, syntax tree, and documents, to its size.
+const parseFootprint = 8
+
+// memoryBudget limits the memory held by files being parsed at once, across
+// every run, path, and file being indexed. Each file reserves its estimated
+// footprint before it is read and releases it once its documents are sent;
+// files wait in turn while the budget is spent. A file larger than the whole
+// budget waits for all of it and is parsed alone. A nil budget is unlimited.
+type memoryBudget struct {
+	size     int64
+	reserved prometheus.Gauge
+	mu       sync.Mutex
+	used     int64
+	waiters  []*budgetWaiter
+}
+
+// budgetWaiter is a reservation waiting for budget to be released.
+type budgetWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// newMemoryBudget creates a budget of megabytes, or returns nil for an
+// unlimited one when megabytes isn't positive.
+func newMemoryBudget(megabytes int, m *metrics.Metrics) (budget *memoryBudget) {
+	if megabytes <= 0 {
+		return budget
+	}
+
+	budget = &memoryBudget{size: int64(megabytes) << 20}
+	if m != nil {
+		budget.reserved = m.ParseMemoryReserved
+	}
+	return budget
+}
+
+// forFile reserves the estimated footprint of parsing a file of size bytes,
+// waiting until enough of the budget is free or ctx ends. It returns the
+// amount reserved, to be given back with release.
+func (b *memoryBudget) forFile(ctx context.Context, size int64) (reserved int64, err error) {
+	if b == nil {
+		return reserved, err
+	}
+
+	n := min(size*parseFootprint, b.size)
+
+	b.mu.Lock()
+	if len(b.waiters) == 0 && b.used+n <= b.size {
+		b.take(n)
+		b.mu.Unlock()
+		reserved = n
+		return reserved, err
+	}
+
+	w := &budgetWaiter{n: n, ready: make(chan struct{})}
+	b.waiters = append(b.waiters, w)
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		reserved = n
+		return reserved, err
+	case <-ctx.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		// Granted as ctx ended; hand it on.
+		b.take(-n)
+	default:
+		b.waiters = slices.DeleteFunc(b.waiters, func(other *budgetWaiter) bool { return other == w })
+	}
+	b.grant()
+
+	err = ctx.Err()
+	return reserved, err
+}
+
+// release gives back a reservation, letting waiting files through in turn.
+func (b *memoryBudget) release(reserved int64) {
+	if b == nil || reserved == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.take(-reserved)
+	b.grant()
+}
+
+// grant hands free budget to waiters in the order they arrived. Callers hold
+// b.mu.
+func (b *memoryBudget) grant() {
+	for len(b.waiters) > 0 && b.used+b.waiters[0].n <= b.size {
+		w := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		b.take(w.n)
+		close(w.ready)
+	}
+}
+
+// take adds n to the budget in use. Callers hold b.mu.
+func (b *memoryBudget) take(n int64) {
+	b.used += n
+	if b.reserved != nil {
+		b.reserved.Set(float64(b.used))
+	}
+}
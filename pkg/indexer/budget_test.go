@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	budget := newMemoryBudget(1, m)
+	const quarter = 1 << 18 / parseFootprint
+
+	first, err := budget.forFile(t.Context(), 3*quarter)
+	if err != nil {
+		t.Fatalf("forFile() error = %v", err)
+	}
+	if got := testutil.ToFloat64(m.ParseMemoryReserved); got != 3<<18 {
+		t.Errorf("reserved = %v, want %v", got, 3<<18)
+	}
+
+	// A file too large for what's left waits for the release.
+	granted := make(chan int64)
+	go func() {
+		reserved, _ := budget.forFile(context.Background(), 1<<30)
+		granted <- reserved
+	}()
+
+	// A file that would fit still waits its turn.
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	waitForWaiters(t, budget, 1)
+	_, err = budget.forFile(ctx, quarter)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("forFile() behind a waiter error = %v, want deadline exceeded", err)
+	}
+
+	budget.release(first)
+	second := <-granted
+	if second != 1<<20 {
+		t.Errorf("oversized file reserved %d, want the whole budget", second)
+	}
+	budget.release(second)
+	if got := testutil.ToFloat64(m.ParseMemoryReserved); got != 0 {
+		t.Errorf("reserved after release = %v, want 0", got)
+	}
+
+	var unlimited *memoryBudget
+	reserved, err := unlimited.forFile(t.Context(), 1<<40)
+	if err != nil || reserved != 0 {
+		t.Errorf("nil budget forFile() = %d, %v, want 0, nil", reserved, err)
+	}
+	unlimited.release(reserved)
+}
+
+// waitForWaiters waits until n reservations are queued on the budget.
+func waitForWaiters(t *testing.T, budget *memoryBudget, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		budget.mu.Lock()
+		queued := len(budget.waiters)
+		budget.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued reservations", n)
+}
@@ -0,0 +1,177 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// knownOS are the GOOS values a file name suffix can constrain a file to, as
+// go/build knows them.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"hurd": true, "illumos": true, "ios": true, "js": true, "linux": true, "nacl": true,
+	"netbsd": true, "openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+	"windows": true, "zos": true,
+}
+
+// knownArch are the GOARCH values a file name suffix can constrain a file
+// to, as go/build knows them.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true,
+	"arm64": true, "arm64be": true, "loong64": true, "mips": true, "mipsle": true,
+	"mips64": true, "mips64le": true, "mips64p32": true, "mips64p32le": true,
+	"ppc": true, "ppc64": true, "ppc64le": true, "riscv": true, "riscv64": true,
+	"s390": true, "s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+}
+
+// unixOS are the GOOS values the "unix" build tag matches.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var unixOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"hurd": true, "illumos": true, "ios": true, "linux": true, "netbsd": true,
+	"openbsd": true, "solaris": true,
+}
+
+// buildConstraint returns the constraint a Go file builds under, or nil for
+// none: its //go:build line, or its // +build lines when it has only those,
+// and the GOOS and GOARCH its name implies, as in foo_linux_arm64.go.
+func buildConstraint(file *ast.File, filePath string) (expr constraint.Expr) {
+	var plusBuild constraint.Expr
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			switch {
+			case constraint.IsGoBuild(comment.Text):
+				parsed, err := constraint.Parse(comment.Text)
+				if err == nil && expr == nil {
+					expr = parsed
+				}
+			case constraint.IsPlusBuild(comment.Text):
+				parsed, err := constraint.Parse(comment.Text)
+				if err == nil {
+					plusBuild = andConstraint(plusBuild, parsed)
+				}
+			}
+		}
+	}
+	if expr == nil {
+		expr = plusBuild
+	}
+
+	expr = andConstraint(expr, fileNameConstraint(filePath))
+	return expr
+}
+
+// fileNameConstraint returns the GOOS and GOARCH a Go file's name restricts
+// it to, or nil when it doesn't, following go/build's rules: the last one or
+// two underscore-separated elements, after any _test, name a known GOOS, a
+// known GOARCH, or a GOOS then a GOARCH.
+func fileNameConstraint(filePath string) (expr constraint.Expr) {
+	name := strings.TrimSuffix(filepath.Base(filePath), ".go")
+	name = strings.TrimSuffix(name, "_test")
+	_, name, found := strings.Cut(name, "_")
+	if !found {
+		return expr
+	}
+
+	parts := strings.Split(name, "_")
+	last := parts[len(parts)-1]
+	switch {
+	case len(parts) >= 2 && knownOS[parts[len(parts)-2]] && knownArch[last]:
+		expr = &constraint.AndExpr{X: &constraint.TagExpr{Tag: parts[len(parts)-2]}, Y: &constraint.TagExpr{Tag: last}}
+	case knownOS[last] || knownArch[last]:
+		expr = &constraint.TagExpr{Tag: last}
+	}
+	return expr
+}
+
+// andConstraint joins two constraints, either of which may be nil.
+func andConstraint(x constraint.Expr, y constraint.Expr) (expr constraint.Expr) {
+	switch {
+	case x == nil:
+		expr = y
+	case y == nil:
+		expr = x
+	default:
+		expr = &constraint.AndExpr{X: x, Y: y}
+	}
+	return expr
+}
+
+// constraintTags lists the tags a constraint mentions, sorted and without
+// duplicates.
+func constraintTags(expr constraint.Expr) (tags []string) {
+	seen := map[string]bool{}
+	var visit func(expr constraint.Expr)
+	visit = func(expr constraint.Expr) {
+		switch e := expr.(type) {
+		case *constraint.TagExpr:
+			if !seen[e.Tag] {
+				seen[e.Tag] = true
+				tags = append(tags, e.Tag)
+			}
+		case *constraint.NotExpr:
+			visit(e.X)
+		case *constraint.AndExpr:
+			visit(e.X)
+			visit(e.Y)
+		case *constraint.OrExpr:
+			visit(e.X)
+			visit(e.Y)
+		}
+	}
+	visit(expr)
+
+	sort.Strings(tags)
+	return tags
+}
+
+// buildPlatforms lists the platforms, as "goos/goarch", that a constraint,
+// as a document records it, is satisfied on, in the order given. Release
+// tags such as go1.21 and the gc compiler are taken as satisfied, and custom
+// tags, cgo included, as not, as in a plain go build.
+func buildPlatforms(buildConstraint string, platforms []string) (matched []string) {
+	expr, err := constraint.Parse("//go:build " + buildConstraint)
+	if err != nil {
+		return matched
+	}
+
+	for _, platform := range platforms {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		satisfied := expr.Eval(func(tag string) (ok bool) {
+			ok = matchBuildTag(tag, goos, goarch)
+			return ok
+		})
+		if satisfied {
+			matched = append(matched, platform)
+		}
+	}
+	return matched
+}
+
+// matchBuildTag reports whether a build tag is satisfied on a platform.
+func matchBuildTag(tag string, goos string, goarch string) (ok bool) {
+	switch {
+	case tag == goos || tag == goarch || tag == "gc" || strings.HasPrefix(tag, "go1."):
+		ok = true
+	case tag == "unix":
+		ok = unixOS[goos]
+	case tag == "linux":
+		ok = goos == "android"
+	case tag == "solaris":
+		ok = goos == "illumos"
+	case tag == "darwin":
+		ok = goos == "ios"
+	}
+	return ok
+}
@@ -0,0 +1,95 @@
+package indexer
+
+import (
+	"go/parser"
+	"go/token"
+	"slices"
+	"testing"
+)
+
+func TestBuildConstraint(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		src      string
+		want     string
+		wantTags []string
+	}{
+		{name: "none", path: "server.go", src: "package server\n"},
+		{name: "go:build", path: "poll.go", src: "//go:build linux && !android\n\npackage poll\n", want: "linux && !android", wantTags: []string{"android", "linux"}},
+		{name: "plus build", path: "poll.go", src: "// +build linux darwin\n// +build amd64\n\npackage poll\n", want: "(linux || darwin) && amd64", wantTags: []string{"amd64", "darwin", "linux"}},
+		{name: "go:build wins", path: "poll.go", src: "//go:build windows\n// +build linux\n\npackage poll\n", want: "windows", wantTags: []string{"windows"}},
+		{name: "file name os", path: "pkg/poll_windows.go", src: "package poll\n", want: "windows", wantTags: []string{"windows"}},
+		{name: "file name os and arch", path: "poll_linux_arm64_test.go", src: "package poll\n", want: "linux && arm64", wantTags: []string{"arm64", "linux"}},
+		{name: "file name and line", path: "poll_amd64.go", src: "//go:build linux\n\npackage poll\n", want: "linux && amd64", wantTags: []string{"amd64", "linux"}},
+		{name: "bare os name", path: "linux.go", src: "package poll\n"},
+		{name: "unknown suffix", path: "poll_other.go", src: "package poll\n"},
+		{name: "after package clause", path: "poll.go", src: "package poll\n\n//go:build linux\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parser.ParseFile(token.NewFileSet(), tt.path, tt.src, parser.ParseComments)
+			if err != nil {
+				t.Fatalf("ParseFile() error = %v", err)
+			}
+
+			expr := buildConstraint(file, tt.path)
+			got := ""
+			if expr != nil {
+				got = expr.String()
+			}
+			if got != tt.want || !slices.Equal(constraintTags(expr), tt.wantTags) {
+				t.Errorf("buildConstraint() = %q with tags %v, want %q with %v", got, constraintTags(expr), tt.want, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestBuildPlatforms(t *testing.T) {
+	platforms := []string{"linux/amd64", "linux/arm64", "darwin/arm64", "windows/amd64", "android/arm64"}
+	tests := []struct {
+		constraint string
+		want       []string
+	}{
+		{constraint: "linux", want: []string{"linux/amd64", "linux/arm64", "android/arm64"}},
+		{constraint: "linux && !android", want: []string{"linux/amd64", "linux/arm64"}},
+		{constraint: "unix && arm64", want: []string{"linux/arm64", "darwin/arm64", "android/arm64"}},
+		{constraint: "windows || go1.21", want: platforms},
+		{constraint: "integration"},
+		{constraint: "!cgo && amd64", want: []string{"linux/amd64", "windows/amd64"}},
+		{constraint: "linux &&"},
+	}
+
+	for _, tt := range tests {
+		got := buildPlatforms(tt.constraint, platforms)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("buildPlatforms(%q) = %v, want %v", tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestGoLanguageBuildConstraint(t *testing.T) {
+	language := &goLanguage{platforms: []string{"linux/amd64", "darwin/arm64"}}
+
+	docs, err := language.ParseFile("poll_linux.go", []byte("package poll\n\nfunc Wait() {}\n\ntype FD int\n"))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("ParseFile() = %d documents, want 2", len(docs))
+	}
+	for _, doc := range docs {
+		if doc.BuildConstraint != "linux" || !slices.Equal(doc.BuildTags, []string{"linux"}) || !slices.Equal(doc.Platforms, []string{"linux/amd64"}) {
+			t.Errorf("%s: constraint %q, tags %v, platforms %v; want linux on linux/amd64", doc.FunctionName, doc.BuildConstraint, doc.BuildTags, doc.Platforms)
+		}
+	}
+
+	docs, err = language.ParseFile("poll.go", []byte("package poll\n\nfunc Wait() {}\n"))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if docs[0].BuildConstraint != "" || docs[0].Platforms != nil {
+		t.Errorf("unconstrained file: constraint %q, platforms %v; want none", docs[0].BuildConstraint, docs[0].Platforms)
+	}
+}
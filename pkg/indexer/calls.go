@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"go/ast"
+	"sort"
+)
+
+// calledFunctions lists the functions and methods invoked in a function body,
+// sorted and without duplicates. Calls are recorded as written: a bare
+// identifier ("helper"), a package function ("http.Get"), or a method on a
+// receiver chain ("resp.Body.Close"). When the receiver isn't a plain chain of
+// identifiers, such as a call result or index expression, only the method
+// name is kept. Calls through function literals and other expressions are
+// skipped. Without type information, conversions like string(b) and builtins
+// like len are indistinguishable from calls and are included.
+func calledFunctions(funcDecl *ast.FuncDecl) (calls []string) {
+	if funcDecl.Body == nil {
+		return calls
+	}
+
+	seen := make(map[string]bool)
+	ast.Inspect(funcDecl.Body, func(n ast.Node) (descend bool) {
+		descend = true
+
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return descend
+		}
+
+		name := callName(call.Fun)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			calls = append(calls, name)
+		}
+		return descend
+	})
+
+	sort.Strings(calls)
+	return calls
+}
+
+// callName renders the function expression of a call, or returns an empty
+// string when it isn't a named function or method.
+func callName(fun ast.Expr) (name string) {
+	switch expr := fun.(type) {
+	case *ast.Ident:
+		name = expr.Name
+	case *ast.SelectorExpr:
+		name = expr.Sel.Name
+		receiver := selectorChain(expr.X)
+		if receiver != "" {
+			name = receiver + "." + name
+		}
+	case *ast.IndexExpr:
+		// Explicit instantiation of a generic function: Map[int](xs).
+		name = callName(expr.X)
+	case *ast.IndexListExpr:
+		name = callName(expr.X)
+	case *ast.ParenExpr:
+		name = callName(expr.X)
+	}
+	return name
+}
+
+// selectorChain renders an expression made only of identifiers and selectors,
+// such as "resp.Body", and returns an empty string for anything else.
+func selectorChain(expr ast.Expr) (chain string) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		chain = e.Name
+	case *ast.SelectorExpr:
+		parent := selectorChain(e.X)
+		if parent != "" {
+			chain = parent + "." + e.Sel.Name
+		}
+	}
+	return chain
+}
@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"testing"
+)
+
+func TestCalledFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		funcCode string
+		want     []string
+	}{
+		{
+			name: "no calls",
+			funcCode: `func Foo() (result int) {
+	result = 1
+	return result
+}`,
+			want: nil,
+		},
+		{
+			name: "package functions and methods deduplicated",
+			funcCode: `func Foo(url string) (err error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		err = fmt.Errorf("get: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+	err = fmt.Errorf("status %d", resp.StatusCode)
+	return err
+}`,
+			want: []string{"fmt.Errorf", "http.Get", "resp.Body.Close"},
+		},
+		{
+			name: "receiver that is not a selector chain",
+			funcCode: `func Foo(s *Server) {
+	s.router().Handle("/", nil)
+	handlers[0].Serve()
+}`,
+			want: []string{"Handle", "Serve", "s.router"},
+		},
+		{
+			name: "generic instantiation and function literals",
+			funcCode: `func Foo(xs []int) {
+	Map[int, string](xs, strconv.Itoa)
+	func() {
+		helper()
+	}()
+}`,
+			want: []string{"Map", "helper"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			node, err := parser.ParseFile(fset, "", "package test\n\n"+tt.funcCode, 0)
+			if err != nil {
+				t.Fatalf("Failed to parse code: %v", err)
+			}
+
+			funcDecl, ok := node.Decls[0].(*ast.FuncDecl)
+			if !ok {
+				t.Fatal("No function declaration found")
+			}
+
+			got := calledFunctions(funcDecl)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("calledFunctions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// cyclomaticComplexity counts the independent paths through a function, as
+// gocyclo does: one plus each if, for, range, non-default case, and && or ||.
+func cyclomaticComplexity(funcDecl *ast.FuncDecl) (complexity int) {
+	complexity = 1
+	if funcDecl.Body == nil {
+		return complexity
+	}
+
+	ast.Inspect(funcDecl.Body, func(n ast.Node) (descend bool) {
+		switch node := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if node.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				complexity++
+			}
+		}
+		descend = true
+		return descend
+	})
+
+	return complexity
+}
+
+// cognitiveComplexity scores how hard a function is to read, following the
+// SonarSource definition: branches and loops cost more the deeper they are
+// nested, and each run of mixed && and || operators costs one.
+func cognitiveComplexity(funcDecl *ast.FuncDecl) (complexity int) {
+	if funcDecl.Body == nil {
+		return complexity
+	}
+
+	counter := &cognitiveCounter{}
+	counter.walk(funcDecl.Body, 0)
+	complexity = counter.score
+	return complexity
+}
+
+// cognitiveCounter accumulates cognitive complexity while tracking nesting.
+type cognitiveCounter struct {
+	score int
+}
+
+// walk scores a node at the given nesting level. Structures that nest are
+// handled explicitly so their bodies are walked one level deeper.
+func (c *cognitiveCounter) walk(node ast.Node, nesting int) {
+	if node == nil {
+		return
+	}
+
+	ast.Inspect(node, func(n ast.Node) (descend bool) {
+		switch stmt := n.(type) {
+		case *ast.IfStmt:
+			c.ifStmt(stmt, nesting, false)
+			return descend
+		case *ast.ForStmt:
+			c.score += 1 + nesting
+			c.walk(stmt.Init, nesting)
+			c.walk(stmt.Cond, nesting)
+			c.walk(stmt.Post, nesting)
+			c.walk(stmt.Body, nesting+1)
+			return descend
+		case *ast.RangeStmt:
+			c.score += 1 + nesting
+			c.walk(stmt.X, nesting)
+			c.walk(stmt.Body, nesting+1)
+			return descend
+		case *ast.SwitchStmt:
+			c.score += 1 + nesting
+			c.walk(stmt.Init, nesting)
+			c.walk(stmt.Tag, nesting)
+			c.walk(stmt.Body, nesting+1)
+			return descend
+		case *ast.TypeSwitchStmt:
+			c.score += 1 + nesting
+			c.walk(stmt.Init, nesting)
+			c.walk(stmt.Body, nesting+1)
+			return descend
+		case *ast.SelectStmt:
+			c.score += 1 + nesting
+			c.walk(stmt.Body, nesting+1)
+			return descend
+		case *ast.FuncLit:
+			c.walk(stmt.Body, nesting+1)
+			return descend
+		case *ast.BranchStmt:
+			if stmt.Label != nil {
+				c.score++
+			}
+		case *ast.BinaryExpr:
+			if stmt.Op == token.LAND || stmt.Op == token.LOR {
+				c.logicalExpr(stmt, nesting)
+				return descend
+			}
+		}
+		descend = true
+		return descend
+	})
+}
+
+// ifStmt scores an if statement and its else chain. An else if or else costs
+// one regardless of nesting; the if itself also pays for its depth.
+func (c *cognitiveCounter) ifStmt(stmt *ast.IfStmt, nesting int, elseIf bool) {
+	if elseIf {
+		c.score++
+	} else {
+		c.score += 1 + nesting
+	}
+
+	c.walk(stmt.Init, nesting)
+	c.walk(stmt.Cond, nesting)
+	c.walk(stmt.Body, nesting+1)
+
+	switch elseStmt := stmt.Else.(type) {
+	case *ast.IfStmt:
+		c.ifStmt(elseStmt, nesting, true)
+	case *ast.BlockStmt:
+		c.score++
+		c.walk(elseStmt, nesting+1)
+	}
+}
+
+// logicalExpr scores a chain of && and || operators: one for each run of the
+// same operator. Operands are walked for nested function literals.
+func (c *cognitiveCounter) logicalExpr(expr *ast.BinaryExpr, nesting int) {
+	var ops []token.Token
+	var operands []ast.Expr
+	flattenLogical(expr, &ops, &operands)
+
+	for i, op := range ops {
+		if i == 0 || op != ops[i-1] {
+			c.score++
+		}
+	}
+
+	for _, operand := range operands {
+		c.walk(operand, nesting)
+	}
+}
+
+// flattenLogical lists the operators of a logical expression in source order
+// along with its non-logical operands. Parentheses don't start a new chain.
+func flattenLogical(expr ast.Expr, ops *[]token.Token, operands *[]ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		if e.Op == token.LAND || e.Op == token.LOR {
+			flattenLogical(e.X, ops, operands)
+			*ops = append(*ops, e.Op)
+			flattenLogical(e.Y, ops, operands)
+			return
+		}
+	case *ast.ParenExpr:
+		flattenLogical(e.X, ops, operands)
+		return
+	}
+
+	*operands = append(*operands, expr)
+}
@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestComplexity(t *testing.T) {
+	tests := []struct {
+		name           string
+		funcCode       string
+		wantCyclomatic int
+		wantCognitive  int
+	}{
+		{
+			name: "straight line",
+			funcCode: `func Foo() (result int) {
+	result = 1
+	return result
+}`,
+			wantCyclomatic: 1,
+			wantCognitive:  0,
+		},
+		{
+			name: "if else chain",
+			funcCode: `func Foo(n int) (result string) {
+	if n < 0 {
+		result = "negative"
+	} else if n == 0 {
+		result = "zero"
+	} else {
+		result = "positive"
+	}
+	return result
+}`,
+			wantCyclomatic: 3,
+			wantCognitive:  3,
+		},
+		{
+			name: "nested loop and condition",
+			funcCode: `func Foo(items []int) (total int) {
+	for _, item := range items {
+		if item > 0 && item < 100 {
+			total += item
+		}
+	}
+	return total
+}`,
+			wantCyclomatic: 4,
+			wantCognitive:  4,
+		},
+		{
+			name: "switch with mixed operators",
+			funcCode: `func Foo(a bool, b bool, c bool, n int) (ok bool) {
+	switch n {
+	case 1:
+		ok = a && b || c
+	case 2:
+		ok = true
+	default:
+		ok = false
+	}
+	return ok
+}`,
+			wantCyclomatic: 5,
+			wantCognitive:  3,
+		},
+		{
+			name: "function literal nests",
+			funcCode: `func Foo(items []int) {
+	go func() {
+		for range items {
+			continue
+		}
+	}()
+}`,
+			wantCyclomatic: 2,
+			wantCognitive:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			node, err := parser.ParseFile(fset, "", "package test\n\n"+tt.funcCode, 0)
+			if err != nil {
+				t.Fatalf("Failed to parse code: %v", err)
+			}
+
+			funcDecl, ok := node.Decls[0].(*ast.FuncDecl)
+			if !ok {
+				t.Fatal("No function declaration found")
+			}
+
+			cyclomatic := cyclomaticComplexity(funcDecl)
+			if cyclomatic != tt.wantCyclomatic {
+				t.Errorf("cyclomaticComplexity() = %d, want %d", cyclomatic, tt.wantCyclomatic)
+			}
+
+			cognitive := cognitiveComplexity(funcDecl)
+			if cognitive != tt.wantCognitive {
+				t.Errorf("cognitiveComplexity() = %d, want %d", cognitive, tt.wantCognitive)
+			}
+		})
+	}
+}
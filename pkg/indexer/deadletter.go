@@ -0,0 +1,342 @@
+package indexer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+)
+
+// DeadLetter is a document that failed to index, kept to be retried rather
+// than lost until the repository is next indexed.
+type DeadLetter struct {
+	ID       string `json:"id"`
+	Repo     string `json:"repo"`
+	FilePath string `json:"file_path"`
+	Name     string `json:"name"`
+	Error    string `json:"error"`
+	// Permanent is set when Elasticsearch rejected the document, as for a
+	// mapping error. Such documents are only retried on request.
+	Permanent   bool                       `json:"permanent"`
+	Attempts    int                        `json:"attempts"`
+	FirstFailed time.Time                  `json:"first_failed"`
+	LastFailed  time.Time                  `json:"last_failed"`
+	Document    elasticsearch.CodeDocument `json:"document"`
+}
+
+// ReplayResult reports the outcome of replaying dead letters.
+type ReplayResult struct {
+	Replayed  int `json:"replayed"`
+	Failed    int `json:"failed"`
+	Remaining int `json:"remaining"`
+}
+
+// deadLetterStore keeps documents that failed to index, oldest first, up to
+// a limit, saved to a JSON file when it has a path. Writes are batched:
+// changes are saved by flush, after each repository and retry pass.
+type deadLetterStore struct {
+	path    string
+	limit   int
+	metrics *metrics.Metrics
+	logger  logging.Logger
+
+	mu      sync.Mutex
+	letters []DeadLetter
+	dirty   bool
+}
+
+// openDeadLetterStore loads the dead letters saved at path. A missing file
+// starts empty; an unreadable one is logged and replaced on the next flush.
+// A limit of zero keeps nothing.
+func openDeadLetterStore(path string, limit int, m *metrics.Metrics, logger logging.Logger) (store *deadLetterStore) {
+	store = &deadLetterStore{
+		path:    path,
+		limit:   limit,
+		metrics: m,
+		logger:  logger,
+	}
+	if path == "" || limit <= 0 {
+		return store
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &store.letters)
+	}
+	if err != nil {
+		logger.Warn("Failed to load dead letters, starting empty", "path", path, "error", err)
+		store.letters = nil
+	}
+	if len(store.letters) > limit {
+		store.letters = store.letters[len(store.letters)-limit:]
+	}
+	store.updateGauge()
+	return store
+}
+
+// add keeps a document that failed to index with cause. When the store is
+// full the oldest letter is dropped to make room.
+func (s *deadLetterStore) add(doc elasticsearch.CodeDocument, cause error) {
+	if s.limit <= 0 {
+		return
+	}
+
+	id, err := newDeadLetterID()
+	if err != nil {
+		s.logger.Warn("Failed to keep dead letter", "repo", doc.Repo, "file", doc.FilePath, "error", err)
+		return
+	}
+
+	now := time.Now()
+	letter := DeadLetter{
+		ID:          id,
+		Repo:        doc.Repo,
+		FilePath:    doc.FilePath,
+		Name:        doc.FunctionName,
+		Error:       cause.Error(),
+		Permanent:   errors.Is(cause, elasticsearch.ErrBadRequest),
+		Attempts:    1,
+		FirstFailed: now,
+		LastFailed:  now,
+		Document:    doc,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.letters) >= s.limit {
+		dropped := s.letters[0]
+		s.letters = s.letters[1:]
+		s.logger.Warn("Dead letter store full, dropping oldest", "repo", dropped.Repo, "file", dropped.FilePath, "name", dropped.Name)
+	}
+	s.letters = append(s.letters, letter)
+	s.dirty = true
+	s.updateGauge()
+}
+
+// list returns the letters of repo, or all letters when repo is empty.
+func (s *deadLetterStore) list(repo string) (letters []DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters = []DeadLetter{}
+	for _, letter := range s.letters {
+		if repo == "" || letter.Repo == repo {
+			letters = append(letters, letter)
+		}
+	}
+	return letters
+}
+
+// drop discards the letters of repo, or all letters when repo is empty.
+func (s *deadLetterStore) drop(repo string) (dropped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.letters[:0]
+	for _, letter := range s.letters {
+		if repo == "" || letter.Repo == repo {
+			dropped++
+			continue
+		}
+		kept = append(kept, letter)
+	}
+	s.letters = kept
+	if dropped > 0 {
+		s.dirty = true
+		s.updateGauge()
+	}
+	return dropped
+}
+
+// replay indexes the letters of repo, or all letters when repo is empty,
+// through es again, removing those that succeed. Permanent failures are
+// skipped unless includePermanent is set. The store isn't locked while
+// documents are sent, so indexing can add letters meanwhile.
+func (s *deadLetterStore) replay(ctx context.Context, es *elasticsearch.Client, repo string, includePermanent bool) (result ReplayResult, err error) {
+	var pending []DeadLetter
+	for _, letter := range s.list(repo) {
+		if includePermanent || !letter.Permanent {
+			pending = append(pending, letter)
+		}
+	}
+
+	replayed := make(map[string]bool)
+	failed := make(map[string]error)
+	for _, letter := range pending {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+
+		indexErr := es.IndexDocument(ctx, letter.Document)
+		if indexErr != nil {
+			failed[letter.ID] = indexErr
+			s.observeReplay("error")
+			continue
+		}
+		replayed[letter.ID] = true
+		s.observeReplay("success")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	kept := s.letters[:0]
+	for _, letter := range s.letters {
+		if replayed[letter.ID] {
+			result.Replayed++
+			continue
+		}
+		if indexErr, found := failed[letter.ID]; found {
+			letter.Attempts++
+			letter.LastFailed = now
+			letter.Error = indexErr.Error()
+			letter.Permanent = errors.Is(indexErr, elasticsearch.ErrBadRequest)
+			result.Failed++
+		}
+		kept = append(kept, letter)
+	}
+	s.letters = kept
+	if len(replayed) > 0 || len(failed) > 0 {
+		s.dirty = true
+		s.updateGauge()
+	}
+
+	for _, letter := range s.letters {
+		if repo == "" || letter.Repo == repo {
+			result.Remaining++
+		}
+	}
+	return result, err
+}
+
+// flush saves the letters if they changed since the last flush.
+func (s *deadLetterStore) flush() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" || !s.dirty {
+		return err
+	}
+
+	data, err := json.Marshal(s.letters)
+	if err != nil {
+		err = fmt.Errorf("failed to encode dead letters: %w", err)
+		return err
+	}
+
+	err = replaceFile(s.path, data)
+	if err != nil {
+		err = fmt.Errorf("failed to write dead letters: %w", err)
+		return err
+	}
+
+	s.dirty = false
+	return err
+}
+
+// updateGauge reports the number of letters. The caller holds s.mu, except
+// while opening the store.
+func (s *deadLetterStore) updateGauge() {
+	if s.metrics != nil {
+		s.metrics.DeadLetters.Set(float64(len(s.letters)))
+	}
+}
+
+// observeReplay counts a replayed letter by status.
+func (s *deadLetterStore) observeReplay(status string) {
+	if s.metrics != nil {
+		s.metrics.DeadLetterReplays.WithLabelValues(status).Inc()
+	}
+}
+
+// newDeadLetterID returns a random hex dead letter identifier.
+func newDeadLetterID() (id string, err error) {
+	buf := make([]byte, 8)
+	_, err = rand.Read(buf)
+	if err != nil {
+		err = fmt.Errorf("failed to generate dead letter ID: %w", err)
+		return id, err
+	}
+
+	id = hex.EncodeToString(buf)
+	return id, err
+}
+
+// flushDeadLetters saves the dead letters, logging a failure.
+func (idx *Indexer) flushDeadLetters() {
+	err := idx.deadLetters.flush()
+	if err != nil {
+		idx.logger.Warn("Failed to save dead letters", "error", err)
+	}
+}
+
+// DeadLetters returns the documents that failed to index and are kept for
+// retry, for repo or for all repositories when repo is empty.
+func (idx *Indexer) DeadLetters(repo string) (letters []DeadLetter) {
+	letters = idx.deadLetters.list(repo)
+	return letters
+}
+
+// ReplayDeadLetters indexes the dead letters of repo, or all of them when
+// repo is empty, again, including those Elasticsearch rejected before.
+// Letters that index are removed.
+func (idx *Indexer) ReplayDeadLetters(ctx context.Context, repo string) (result ReplayResult, err error) {
+	result, err = idx.deadLetters.replay(ctx, idx.es, repo, true)
+	idx.flushDeadLetters()
+	return result, err
+}
+
+// DiscardDeadLetters drops the dead letters of repo, or all of them when repo
+// is empty, without indexing them.
+func (idx *Indexer) DiscardDeadLetters(repo string) (discarded int) {
+	discarded = idx.deadLetters.drop(repo)
+	idx.flushDeadLetters()
+	return discarded
+}
+
+// RunDeadLetterRetrier replays dead letters every DEADLETTER_RETRY_INTERVAL
+// until ctx ends. Documents Elasticsearch rejected aren't retried, and
+// nothing is while indexing is paused or shutting down.
+func (idx *Indexer) RunDeadLetterRetrier(ctx context.Context) {
+	ticker := time.NewTicker(idx.config.DeadLetterRetryInterval)
+	defer ticker.Stop()
+
+	idx.logger.Info("Starting dead letter retrier", "interval", idx.config.DeadLetterRetryInterval)
+
+	for {
+		select {
+		case <-ticker.C:
+			if idx.Draining() || idx.pause.status().Paused || len(idx.deadLetters.list("")) == 0 {
+				continue
+			}
+
+			result, err := idx.deadLetters.replay(ctx, idx.es, "", false)
+			idx.flushDeadLetters()
+			if err != nil {
+				continue
+			}
+			if result.Replayed > 0 || result.Failed > 0 {
+				idx.logger.Info("Retried dead letters", "replayed", result.Replayed, "failed", result.Failed, "remaining", result.Remaining)
+			}
+
+		case <-ctx.Done():
+			idx.logger.Info("Dead letter retrier stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package indexer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	logger := logging.New(slog.New(slog.DiscardHandler))
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	path := filepath.Join(t.TempDir(), "deadletter.json")
+
+	store := openDeadLetterStore(path, 2, m, logger)
+	store.add(elasticsearch.CodeDocument{Repo: "api", FunctionName: "First"}, elasticsearch.ErrUnavailable)
+	store.add(elasticsearch.CodeDocument{Repo: "api", FunctionName: "Second"}, elasticsearch.ErrBadRequest)
+	store.add(elasticsearch.CodeDocument{Repo: "web", FunctionName: "Third"}, elasticsearch.ErrTimeout)
+
+	letters := store.list("")
+	if len(letters) != 2 || letters[0].Name != "Second" || letters[1].Name != "Third" {
+		t.Fatalf("list() = %+v, want the two newest letters", letters)
+	}
+	if !letters[0].Permanent || letters[1].Permanent {
+		t.Errorf("Permanent = %v, %v, want only the rejected document permanent", letters[0].Permanent, letters[1].Permanent)
+	}
+
+	err := store.flush()
+	if err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+
+	reloaded := openDeadLetterStore(path, 2, m, logger)
+	if got := reloaded.list("web"); len(got) != 1 || got[0].Name != "Third" {
+		t.Errorf("list(web) = %+v after reload", got)
+	}
+	if dropped := reloaded.drop("api"); dropped != 1 {
+		t.Errorf("drop(api) = %d, want 1", dropped)
+	}
+	if got := reloaded.list(""); len(got) != 1 {
+		t.Errorf("list() = %+v after drop, want one letter", got)
+	}
+
+	disabled := openDeadLetterStore("", 0, m, logger)
+	disabled.add(elasticsearch.CodeDocument{Repo: "api"}, elasticsearch.ErrUnavailable)
+	if got := disabled.list(""); len(got) != 0 {
+		t.Errorf("list() = %+v with DEADLETTER_MAX 0, want none", got)
+	}
+}
+
+func TestDeadLettersFromIndexRun(t *testing.T) {
+	var flakyUp atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var doc elasticsearch.CodeDocument
+		_ = json.NewDecoder(r.Body).Decode(&doc)
+		switch {
+		case doc.FunctionName == "Bad":
+			http.Error(w, `{"error":"mapper_parsing_exception"}`, http.StatusBadRequest)
+		case doc.FunctionName == "Flaky" && !flakyUp.Load():
+			http.Error(w, `{"error":"es_rejected_execution_exception"}`, http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	repo := t.TempDir()
+	err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc Good() {}\n\nfunc Bad() {}\n\nfunc Flaky() {}\n"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "deadletter.json")
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", Languages: []string{"go"}, DeadLetterFile: path, DeadLetterMax: 100}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, clientErr := elasticsearch.NewClient(cfg, m)
+	if clientErr != nil {
+		t.Fatalf("NewClient() error = %v", clientErr)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	_, err = idx.indexRepository(t.Context(), es, "api", repo)
+	if err != nil {
+		t.Fatalf("indexRepository() error = %v", err)
+	}
+	if got := idx.DeadLetters("api"); len(got) != 2 {
+		t.Fatalf("DeadLetters(api) = %+v, want Bad and Flaky", got)
+	}
+	// Only the rejected document counts as a failure of the run.
+	if got := idx.ParseFailures("api"); len(got) != 1 || got[0].Class != parseErrorClassESReject || got[0].FilePath != "main.go" {
+		t.Errorf("ParseFailures(api) = %+v, want Bad in main.go rejected", got)
+	}
+
+	// The retrier skips documents Elasticsearch rejected.
+	flakyUp.Store(true)
+	result, err := idx.deadLetters.replay(t.Context(), es, "", false)
+	if err != nil || result.Replayed != 1 || result.Failed != 0 || result.Remaining != 1 {
+		t.Errorf("replay() = %+v, %v, want Flaky replayed and Bad left", result, err)
+	}
+
+	// A requested replay retries them too.
+	result, err = idx.ReplayDeadLetters(t.Context(), "api")
+	if err != nil || result.Replayed != 0 || result.Failed != 1 || result.Remaining != 1 {
+		t.Errorf("ReplayDeadLetters() = %+v, %v, want Bad failed again", result, err)
+	}
+	if got := idx.DeadLetters("api"); len(got) != 1 || got[0].Name != "Bad" || got[0].Attempts != 2 {
+		t.Errorf("DeadLetters(api) = %+v, want Bad after two attempts", got)
+	}
+
+	// Indexing the repository again supersedes the old letters.
+	_, err = idx.indexRepository(t.Context(), es, "api", repo)
+	if err != nil {
+		t.Fatalf("indexRepository() error = %v", err)
+	}
+	reloaded := openDeadLetterStore(path, 100, m, idx.logger).list("api")
+	if len(reloaded) != 1 || reloaded[0].Attempts != 1 {
+		t.Errorf("saved dead letters = %+v, want Bad from the latest run", reloaded)
+	}
+
+	if discarded := idx.DiscardDeadLetters(""); discarded != 1 {
+		t.Errorf("DiscardDeadLetters() = %d, want 1", discarded)
+	}
+}
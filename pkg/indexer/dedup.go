@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// duplicateGroup is a declaration whose code appears in several places. The
+// first copy seen is the one indexed; canonical holds only the fields that
+// identify it, not its code.
+type duplicateGroup struct {
+	canonical elasticsearch.CodeDocument
+	locations []elasticsearch.Location
+}
+
+// duplicateTracker finds byte-identical declarations within one repository
+// run, such as copied files or build-tagged variants, so only one copy is
+// indexed. With variants, declarations under different build constraints
+// are never copies, so each platform's variant is indexed. A nil tracker
+// treats every declaration as unique.
+type duplicateTracker struct {
+	groups   map[string]*duplicateGroup
+	order    []string
+	variants bool
+}
+
+// newDuplicateTracker creates a tracker when deduplication is enabled and
+// returns nil otherwise. variants keeps build-constrained variants apart.
+func newDuplicateTracker(enabled bool, variants bool) (tracker *duplicateTracker) {
+	if !enabled {
+		return tracker
+	}
+
+	tracker = &duplicateTracker{groups: make(map[string]*duplicateGroup), variants: variants}
+	return tracker
+}
+
+// claim reports whether doc is the first copy of its code and should be
+// indexed. Later copies only add their location to the first.
+func (dt *duplicateTracker) claim(doc elasticsearch.CodeDocument) (first bool) {
+	if dt == nil {
+		first = true
+		return first
+	}
+
+	identity := doc.Kind + "\x00" + doc.Code
+	if dt.variants {
+		identity += "\x00" + doc.BuildConstraint
+	}
+	sum := sha256.Sum256([]byte(identity))
+	key := hex.EncodeToString(sum[:])
+	location := elasticsearch.Location{FilePath: doc.FilePath, StartLine: doc.StartLine, EndLine: doc.EndLine}
+
+	group, ok := dt.groups[key]
+	if ok {
+		group.locations = append(group.locations, location)
+		return first
+	}
+
+	canonical := elasticsearch.CodeDocument{
+		Repo:         doc.Repo,
+		Commit:       doc.Commit,
+		FilePath:     doc.FilePath,
+		FunctionName: doc.FunctionName,
+		ContentHash:  doc.ContentHash,
+	}
+	dt.groups[key] = &duplicateGroup{canonical: canonical, locations: []elasticsearch.Location{location}}
+	dt.order = append(dt.order, key)
+	first = true
+	return first
+}
+
+// duplicates returns the groups with more than one location, in the order
+// their first copies were seen.
+func (dt *duplicateTracker) duplicates() (groups []duplicateGroup) {
+	if dt == nil {
+		return groups
+	}
+
+	for _, key := range dt.order {
+		group := dt.groups[key]
+		if len(group.locations) > 1 {
+			groups = append(groups, *group)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestDuplicateTracker(t *testing.T) {
+	tracker := newDuplicateTracker(true, false)
+
+	docs := []struct {
+		doc       elasticsearch.CodeDocument
+		wantFirst bool
+	}{
+		{doc: elasticsearch.CodeDocument{FilePath: "a_linux.go", Kind: elasticsearch.KindFunction, FunctionName: "Open", Code: "func Open() {}", StartLine: 3}, wantFirst: true},
+		{doc: elasticsearch.CodeDocument{FilePath: "a_other.go", Kind: elasticsearch.KindFunction, FunctionName: "Close", Code: "func Close() {}", StartLine: 5}, wantFirst: true},
+		{doc: elasticsearch.CodeDocument{FilePath: "a_darwin.go", Kind: elasticsearch.KindFunction, FunctionName: "Open", Code: "func Open() {}", StartLine: 7}, wantFirst: false},
+		{doc: elasticsearch.CodeDocument{FilePath: "copy/a.go", Kind: elasticsearch.KindFunction, FunctionName: "Open", Code: "func Open() {}", StartLine: 3}, wantFirst: false},
+		{doc: elasticsearch.CodeDocument{FilePath: "b.go", Kind: elasticsearch.KindFunction, FunctionName: "Open", Code: "func Open() { }", StartLine: 1}, wantFirst: true},
+	}
+
+	for i, tt := range docs {
+		first := tracker.claim(tt.doc)
+		if first != tt.wantFirst {
+			t.Errorf("claim(doc %d) = %v, want %v", i, first, tt.wantFirst)
+		}
+	}
+
+	groups := tracker.duplicates()
+	if len(groups) != 1 {
+		t.Fatalf("duplicates() = %d groups, want 1", len(groups))
+	}
+	if groups[0].canonical.FilePath != "a_linux.go" || groups[0].canonical.Code != "" {
+		t.Errorf("canonical = %+v, want a_linux.go without code", groups[0].canonical)
+	}
+	want := []elasticsearch.Location{
+		{FilePath: "a_linux.go", StartLine: 3},
+		{FilePath: "a_darwin.go", StartLine: 7},
+		{FilePath: "copy/a.go", StartLine: 3},
+	}
+	if len(groups[0].locations) != len(want) {
+		t.Fatalf("locations = %v, want %v", groups[0].locations, want)
+	}
+	for i := range want {
+		if groups[0].locations[i] != want[i] {
+			t.Errorf("locations[%d] = %v, want %v", i, groups[0].locations[i], want[i])
+		}
+	}
+
+	variants := newDuplicateTracker(true, true)
+	linux := elasticsearch.CodeDocument{FilePath: "a_linux.go", Kind: elasticsearch.KindFunction, Code: "func Open() {}", BuildConstraint: "linux"}
+	darwin := elasticsearch.CodeDocument{FilePath: "a_darwin.go", Kind: elasticsearch.KindFunction, Code: "func Open() {}", BuildConstraint: "darwin"}
+	linuxCopy := elasticsearch.CodeDocument{FilePath: "copy/a_linux.go", Kind: elasticsearch.KindFunction, Code: "func Open() {}", BuildConstraint: "linux"}
+	if !variants.claim(linux) || !variants.claim(darwin) || variants.claim(linuxCopy) {
+		t.Error("tracker keeping variants didn't index each platform's variant once")
+	}
+
+	disabled := newDuplicateTracker(false, false)
+	if !disabled.claim(docs[0].doc) || !disabled.claim(docs[0].doc) {
+		t.Error("disabled tracker rejected a copy")
+	}
+	if len(disabled.duplicates()) != 0 {
+		t.Error("disabled tracker reported duplicates")
+	}
+}
@@ -0,0 +1,197 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// discoverTimeout bounds each request to a host's API while discovering a
+// source's repositories.
+const discoverTimeout = 30 * time.Second
+
+// discoverPageSize is how many repositories are asked for per page.
+const discoverPageSize = 100
+
+// hostRepo is a repository as the GitHub and GitLab APIs list it. GitHub
+// names it by name and GitLab by path.
+type hostRepo struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Archived bool   `json:"archived"`
+}
+
+// repoDiscovery holds the repositories last discovered for each source that
+// doesn't list its own.
+type repoDiscovery struct {
+	client *http.Client
+	mu     sync.Mutex
+	repos  map[string][]string
+}
+
+// newRepoDiscovery creates an empty discovery.
+func newRepoDiscovery() (discovery *repoDiscovery) {
+	discovery = &repoDiscovery{
+		client: &http.Client{
+			Timeout: discoverTimeout,
+		},
+		repos: make(map[string][]string),
+	}
+	return discovery
+}
+
+// RepoNames discovers the repositories of the sources that don't list
+// their own and returns the name every configured repository is indexed
+// under. A source whose discovery fails keeps the repositories it was last
+// discovered with, and the failure is returned along with the names.
+func (idx *Indexer) RepoNames(ctx context.Context) (names []string, err error) {
+	err = idx.discoverRepos(ctx)
+	names = idx.repoNames()
+	return names, err
+}
+
+// repoNames returns the configured repositories' names, with those last
+// discovered for sources, without asking the hosts again.
+func (idx *Indexer) repoNames() (names []string) {
+	names = idx.config.RepoNames()
+
+	idx.discovery.mu.Lock()
+	defer idx.discovery.mu.Unlock()
+
+	for _, source := range idx.config.Sources {
+		for _, repo := range idx.discovery.repos[source.Name] {
+			names = append(names, source.Name+"/"+repo)
+		}
+	}
+	return names
+}
+
+// discoverRepos lists the repositories of each source that doesn't list its
+// own from its host's API. Archived repositories and those the source
+// excludes are left out.
+func (idx *Indexer) discoverRepos(ctx context.Context) (err error) {
+	var errs []error
+	for _, source := range idx.config.Sources {
+		if !source.Discovers() {
+			continue
+		}
+
+		repos, discoverErr := idx.discovery.list(ctx, source)
+		if discoverErr != nil {
+			errs = append(errs, fmt.Errorf("failed to discover repositories of source %s: %w", source.Name, discoverErr))
+			continue
+		}
+
+		idx.discovery.mu.Lock()
+		idx.discovery.repos[source.Name] = repos
+		idx.discovery.mu.Unlock()
+		idx.logger.Info("Discovered repositories", "source", source.Name, "repos", len(repos))
+	}
+
+	err = errors.Join(errs...)
+	return err
+}
+
+// list pages through the repositories of the source's organization, sorted
+// by name.
+func (d *repoDiscovery) list(ctx context.Context, source config.SourceConfig) (repos []string, err error) {
+	next := sourceReposURL(source)
+	for next != "" {
+		var page []hostRepo
+		page, next, err = d.page(ctx, source, next)
+		if err != nil {
+			return repos, err
+		}
+
+		for _, repo := range page {
+			name := repo.Name
+			if source.Kind == config.SourceKindGitLab {
+				name = repo.Path
+			}
+			if repo.Archived || !validRepoComponent(name) || slices.Contains(source.Exclude, name) {
+				continue
+			}
+			repos = append(repos, name)
+		}
+	}
+
+	sort.Strings(repos)
+	return repos, err
+}
+
+// page fetches one page of repositories and returns the URL of the next
+// page from the Link header, or empty on the last one.
+func (d *repoDiscovery) page(ctx context.Context, source config.SourceConfig, target string) (repos []hostRepo, next string, err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create request: %w", err)
+		return repos, next, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if source.Token != "" && source.Kind == config.SourceKindGitLab {
+		req.Header.Set("PRIVATE-TOKEN", source.Token)
+	} else if source.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+source.Token)
+	}
+
+	var resp *http.Response
+	resp, err = d.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to list repositories: %w", err)
+		return repos, next, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to list repositories: status %d", resp.StatusCode)
+		return repos, next, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&repos)
+	if err != nil {
+		err = fmt.Errorf("failed to decode repositories: %w", err)
+		return repos, next, err
+	}
+
+	next = nextPageURL(resp.Header.Get("Link"))
+	return repos, next, err
+}
+
+// sourceReposURL returns the first page of the source organization's
+// repositories: an organization's on GitHub, and a group's, without its
+// subgroups, on GitLab.
+func sourceReposURL(source config.SourceConfig) (target string) {
+	query := url.Values{"per_page": {fmt.Sprint(discoverPageSize)}}
+	if source.Kind == config.SourceKindGitLab {
+		target = source.APIURL + "/groups/" + url.PathEscape(source.Org) + "/projects?" + query.Encode()
+		return target
+	}
+
+	target = source.APIURL + "/orgs/" + url.PathEscape(source.Org) + "/repos?" + query.Encode()
+	return target
+}
+
+// nextPageURL returns the rel="next" URL of a Link header, as GitHub and
+// GitLab paginate with, or empty when there is none.
+func nextPageURL(link string) (next string) {
+	for part := range strings.SplitSeq(link, ",") {
+		target, params, found := strings.Cut(part, ";")
+		if !found || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		next = strings.Trim(strings.TrimSpace(target), "<>")
+		return next
+	}
+	return next
+}
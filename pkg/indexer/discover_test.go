@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+func TestDiscoverRepos(t *testing.T) {
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/orgs/acme/repos" && r.URL.Query().Get("page") == "":
+			if r.Header.Get("Authorization") != "Bearer ghp-secret" {
+				t.Errorf("GitHub Authorization = %q, want the source's token", r.Header.Get("Authorization"))
+			}
+			w.Header().Set("Link", `<http://`+r.Host+`/orgs/acme/repos?page=2>; rel="next", <http://`+r.Host+`/orgs/acme/repos?page=2>; rel="last"`)
+			_ = json.NewEncoder(w).Encode([]hostRepo{{Name: "web"}, {Name: "legacy", Archived: true}, {Name: "sandbox"}})
+		case r.URL.Path == "/orgs/acme/repos":
+			_ = json.NewEncoder(w).Encode([]hostRepo{{Name: "api"}, {Name: ".."}})
+		case r.URL.Path == "/groups/platform/tools/projects":
+			if r.Header.Get("PRIVATE-TOKEN") != "glpat-secret" {
+				t.Errorf("GitLab PRIVATE-TOKEN = %q, want the source's token", r.Header.Get("PRIVATE-TOKEN"))
+			}
+			_ = json.NewEncoder(w).Encode([]hostRepo{{Name: "Deploy Tool", Path: "deploy"}})
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := config.Config{
+		GitRepos: []string{"core"},
+		Sources: []config.SourceConfig{
+			{Name: "github", Kind: config.SourceKindGitHub, APIURL: srv.URL, Org: "acme", Token: "ghp-secret", Exclude: []string{"sandbox"}},
+			{Name: "gitlab", Kind: config.SourceKindGitLab, APIURL: srv.URL, Org: "platform/tools", Token: "glpat-secret"},
+			{Name: "listed", Kind: config.SourceKindGitHub, APIURL: srv.URL, Org: "partner", Repos: []config.RepoConfig{{Name: "sdk"}}},
+		},
+	}
+	idx := New(cfg, nil, nil, logging.New(slog.New(slog.DiscardHandler)))
+
+	names, err := idx.RepoNames(t.Context())
+	if err != nil {
+		t.Fatalf("RepoNames() error = %v", err)
+	}
+	want := []string{"core", "listed/sdk", "github/api", "github/web", "gitlab/deploy"}
+	if !slices.Equal(names, want) {
+		t.Errorf("RepoNames() = %v, want %v", names, want)
+	}
+
+	// A failed discovery keeps the repositories found last time.
+	failing.Store(true)
+	names, err = idx.RepoNames(t.Context())
+	if err == nil {
+		t.Error("RepoNames() succeeded while the host fails, want error")
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("RepoNames() after a failure = %v, want %v", names, want)
+	}
+
+	_, err = idx.PruneRepos(t.Context())
+	if err == nil {
+		t.Error("PruneRepos() succeeded while discovery fails, want error")
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{name: "none", link: "", want: ""},
+		{name: "next", link: `<https://api.github.com/orgs/acme/repos?page=2>; rel="next", <https://api.github.com/orgs/acme/repos?page=5>; rel="last"`, want: "https://api.github.com/orgs/acme/repos?page=2"},
+		{name: "last page", link: `<https://gitlab.com/api/v4/groups/a/projects?page=1>; rel="first", <https://gitlab.com/api/v4/groups/a/projects?page=1>; rel="prev"`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextPageURL(tt.link); got != tt.want {
+				t.Errorf("nextPageURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
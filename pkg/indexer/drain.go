@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrShuttingDown is returned for index runs requested, or cut short, after
+// Drain was called.
+var ErrShuttingDown = errors.New("indexer is shutting down")
+
+// Drain prepares the indexer for shutdown. No new index run starts, and the
+// run in progress stops once its current repository is indexed, so no
+// repository is left half updated. Drain returns when that run is over, or
+// with an error when ctx ends first; cancel the context the run was started
+// with afterwards to stop it outright.
+func (idx *Indexer) Drain(ctx context.Context) (err error) {
+	idx.draining.Store(true)
+
+	idle := make(chan struct{})
+	go func() {
+		idx.mu.Lock()
+		idx.mu.Unlock() //nolint:staticcheck // The lock only waits out the run in progress.
+		close(idle)
+	}()
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		err = fmt.Errorf("in-flight indexing did not finish: %w", ctx.Err())
+		return err
+	}
+
+	idx.flushDeadLetters()
+
+	// Documents are written one request at a time, so nothing is buffered on
+	// this side; flush Elasticsearch's own buffers to disk.
+	err = idx.es.Flush(ctx)
+	return err
+}
+
+// Draining reports whether Drain has been called.
+func (idx *Indexer) Draining() (draining bool) {
+	draining = idx.draining.Load()
+	return draining
+}
@@ -0,0 +1,114 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDrainFinishesCurrentRepo(t *testing.T) {
+	var idx *Indexer
+	var mu sync.Mutex
+	var indexedRepos []string
+	var flushed bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_doc"):
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			if len(indexedRepos) == 0 || indexedRepos[len(indexedRepos)-1] != doc.Repo {
+				indexedRepos = append(indexedRepos, doc.Repo)
+			}
+			// Shutdown begins while the first repository is indexing.
+			idx.draining.Store(true)
+		case strings.HasSuffix(r.URL.Path, "/_flush"):
+			flushed = true
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	reposPath := t.TempDir()
+	for _, repo := range []string{"alpha", "beta"} {
+		err := os.MkdirAll(filepath.Join(reposPath, repo, ".git"), 0o755)
+		if err != nil {
+			t.Fatalf("failed to create repo: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(reposPath, repo, "main.go"), []byte("package main\n\nfunc A() {}\n\nfunc B() {}\n"), 0o600)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "code-index", ReposPath: reposPath, Languages: []string{"go"}}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx = New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	count, err := idx.IndexAllRepos(t.Context())
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("IndexAllRepos() error = %v, want %v", err, ErrShuttingDown)
+	}
+	if count != 2 || len(indexedRepos) != 1 || indexedRepos[0] != "alpha" {
+		t.Errorf("indexed %d functions from %v, want both functions of alpha only", count, indexedRepos)
+	}
+
+	err = idx.Drain(t.Context())
+	if err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	if !flushed {
+		t.Error("Drain() did not flush the index")
+	}
+
+	_, err = idx.StartReindex(t.Context(), ReindexOptions{})
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("StartReindex() error = %v, want %v", err, ErrShuttingDown)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	cfg := config.Config{ESHost: "http://127.0.0.1:1", ESIndex: "code-index"}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.New(cfg, m)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	// An index run that never finishes.
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	err = idx.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !idx.Draining() {
+		t.Error("Draining() = false after Drain()")
+	}
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/nikogura/rag-indexer/pkg/enrich"
+)
+
+// ErrInvalidFilePath is returned by IndexFile for a repository name or file
+// path that would leave the repository.
+var ErrInvalidFilePath = errors.New("file path must be relative to the repository and stay inside it")
+
+// ErrUnsupportedFile is returned by IndexFile for a file none of the
+// configured languages parse.
+var ErrUnsupportedFile = errors.New("no configured language parses the file")
+
+// FileResult reports the outcome of indexing a single file.
+type FileResult struct {
+	Repo     string `json:"repo"`
+	Path     string `json:"path"`
+	FilePath string `json:"file_path"`
+	Deleted  int64  `json:"deleted"`
+	Indexed  int    `json:"indexed"`
+	// Error describes a parse failure. Declarations recovered from the
+	// file are still indexed.
+	Error string `json:"error,omitempty"`
+}
+
+// IndexFile indexes one file of a repository from the content given, such as
+// an editor buffer, replacing the documents previously indexed from it so
+// its declarations are searchable at once. rel is the file's slash-separated
+// path from the repository root, which is root when set and the repository's
+// clone under REPOS_PATH otherwise; documents record the file under the
+// root, as a full index run would. A file that fails to parse keeps the
+// declarations recovered from it and reports the failure in the result.
+// With INDEX_OVERVIEWS its file document is replaced too, but its package's
+// document waits for the next run over the repository.
+func (idx *Indexer) IndexFile(ctx context.Context, repoName string, root string, rel string, content []byte) (result FileResult, err error) {
+	result = FileResult{Repo: repoName, Path: rel}
+
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		err = fmt.Errorf("%w: %s", ErrInvalidFilePath, rel)
+		return result, err
+	}
+	if root == "" {
+		if !validRepoName(repoName) {
+			err = fmt.Errorf("%w: repository %q", ErrInvalidFilePath, repoName)
+			return result, err
+		}
+		root = filepath.Join(idx.config.ReposPath, repoName)
+	}
+
+	filePath := filepath.Join(root, filepath.FromSlash(rel))
+	result.FilePath = filePath
+
+	languages := idx.languages(nil, nil)
+	if languages.ForFile(filePath) == nil {
+		err = fmt.Errorf("%w: %s", ErrUnsupportedFile, rel)
+		return result, err
+	}
+
+	var reserved int64
+	reserved, err = idx.parseBudget.forFile(ctx, int64(len(content)))
+	if err != nil {
+		return result, err
+	}
+	defer idx.parseBudget.release(reserved)
+
+	commit, _ := gitHeadCommit(ctx, root)
+
+	// Read the file's summaries before its documents are deleted.
+	summaries := idx.summarizer(ctx, repoName, filePath)
+
+	result.Deleted, err = idx.es.DeleteFileDocuments(ctx, repoName, filePath)
+	if err != nil {
+		return result, err
+	}
+
+	// The index no longer holds what the file manifest recorded for the
+	// file, so the next run indexes it whatever its content on disk.
+	forgetErr := idx.manifests.forgetFile(repoName, path.Clean(rel))
+	if forgetErr != nil {
+		idx.logger.Warn("Failed to update file manifest", "repo", repoName, "file", filePath, "error", forgetErr)
+	}
+
+	walker := &fileWalker{
+		ctx:            ctx,
+		es:             idx.es,
+		repoName:       repoName,
+		root:           root,
+		commit:         commit,
+		languages:      languages,
+		metrics:        idx.metrics,
+		logger:         idx.logger,
+		renames:        idx.renames,
+		maxSourceBytes: idx.config.MaxSourceKB * 1024,
+		chunkMaxLines:  idx.config.ChunkMaxLines,
+		chunkOverlap:   idx.config.ChunkOverlapLines,
+		deadLetters:    idx.deadLetters,
+		batch:          idx.documentBatch(),
+		bulkBytes:      idx.config.IndexBulkKB * 1024,
+		summaries:      summaries,
+		overviews:      newOverviewTracker(idx.config.IndexOverviews),
+		modules:        newGoModules(root, idx.config.Repo(repoName)),
+	}
+	defer idx.flushDeadLetters()
+
+	if len(idx.config.EnrichCommand) > 0 {
+		hook := enrich.NewExec(idx.config.EnrichCommand, idx.config.EnrichTimeout)
+		walker.hook = hook
+		defer func() {
+			closeErr := hook.Close()
+			if closeErr != nil {
+				idx.logger.Warn("Enrichment hook did not exit cleanly", "repo", repoName, "error", closeErr)
+			}
+		}()
+	}
+
+	var parseErr error
+	result.Indexed, parseErr = walker.indexContent(filePath, content)
+	if parseErr != nil {
+		failure := newParseFailure(repoName, path.Clean(rel), parseErr)
+		idx.logger.Warn("Failed to index file", "repo", repoName, "file", filePath, "error_class", failure.Class, "recovered", result.Indexed, "error", parseErr)
+		idx.metrics.ObserveParseError(repoName, failure.Class, failure.FilePath)
+		result.Error = parseErr.Error()
+		idx.notifications.publish(Notification{Type: NotificationError, Repo: repoName, File: rel, Commit: commit, Error: result.Error})
+	}
+	idx.metrics.FunctionsIndexed.WithLabelValues(repoName).Add(float64(result.Indexed))
+
+	err = idx.es.Refresh(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	idx.notifications.publish(Notification{Type: NotificationFileIndexed, Repo: repoName, File: rel, Commit: commit, Documents: result.Indexed, Deleted: result.Deleted})
+	return result, err
+}
@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestIndexFile(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var docs []elasticsearch.CodeDocument
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_delete_by_query"):
+			_, _ = w.Write([]byte(`{"deleted":2}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/_doc"):
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			docs = append(docs, doc)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	reposPath := t.TempDir()
+	tests := []struct {
+		name         string
+		repo         string
+		root         string
+		rel          string
+		content      string
+		wantErr      error
+		wantFilePath string
+		wantNames    []string
+		wantTest     bool
+		wantParseErr bool
+	}{
+		{
+			name:         "clone under repos path",
+			repo:         "api",
+			rel:          "pkg/server/handler.go",
+			content:      "package server\n\nfunc Handle() {}\n\nfunc Serve() {}\n",
+			wantFilePath: filepath.Join(reposPath, "api", "pkg", "server", "handler.go"),
+			wantNames:    []string{"Handle", "Serve"},
+		},
+		{
+			name:         "explicit root",
+			repo:         "api",
+			root:         "/work/api",
+			rel:          "store_test.go",
+			content:      "package store\n\nfunc TestOpen() {}\n",
+			wantFilePath: "/work/api/store_test.go",
+			wantNames:    []string{"TestOpen"},
+			wantTest:     true,
+		},
+		{
+			name:         "unsaved edit with a syntax error",
+			repo:         "api",
+			rel:          "main.go",
+			content:      "package main\n\nfunc Before() {}\n\nfunc Broken( {\n",
+			wantFilePath: filepath.Join(reposPath, "api", "main.go"),
+			wantNames:    []string{"Before"},
+			wantParseErr: true,
+		},
+		{name: "escaping path", repo: "api", rel: "../other/main.go", wantErr: ErrInvalidFilePath},
+		{name: "absolute path", repo: "api", rel: "/etc/main.go", wantErr: ErrInvalidFilePath},
+		{name: "escaping repo", repo: "..", rel: "main.go", wantErr: ErrInvalidFilePath},
+		{name: "unsupported language", repo: "api", rel: "script.py", wantErr: ErrUnsupportedFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", ReposPath: reposPath, Languages: []string{"go"}}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, clientErr := elasticsearch.NewClient(cfg, m)
+			if clientErr != nil {
+				t.Fatalf("NewClient() error = %v", clientErr)
+			}
+			idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+			requests = nil
+			docs = nil
+
+			result, err := idx.IndexFile(t.Context(), tt.repo, tt.root, tt.rel, []byte(tt.content))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("IndexFile() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(requests) != 0 {
+					t.Errorf("requests = %v, want none", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IndexFile() error = %v", err)
+			}
+
+			if result.Deleted != 2 || result.Indexed != len(tt.wantNames) || result.FilePath != tt.wantFilePath {
+				t.Errorf("IndexFile() = %+v, want 2 deleted, %d indexed at %s", result, len(tt.wantNames), tt.wantFilePath)
+			}
+			if (result.Error != "") != tt.wantParseErr {
+				t.Errorf("result error = %q, want parse error %v", result.Error, tt.wantParseErr)
+			}
+			if requests[0] != "/test-index/_delete_by_query" || requests[len(requests)-1] != "/test-index/_refresh" {
+				t.Errorf("requests = %v, want a delete first and a refresh last", requests)
+			}
+
+			var names []string
+			for _, doc := range docs {
+				names = append(names, doc.FunctionName)
+				if doc.Repo != tt.repo || doc.FilePath != tt.wantFilePath || doc.IsTest != tt.wantTest {
+					t.Errorf("document = %s %s test=%v, want %s %s test=%v", doc.Repo, doc.FilePath, doc.IsTest, tt.repo, tt.wantFilePath, tt.wantTest)
+				}
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("indexed = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// generatedHeader matches the line marking a file as generated, in the form
+// Go tooling recognizes; # comments cover generated Python.
+//
+//nolint:gochecknoglobals // compiled once
+var generatedHeader = regexp.MustCompile(`^(//|#) Code generated .* DO NOT EDIT\.$`)
+
+// matchesPattern reports whether a repository-relative, slash-separated path
+// matches a glob. A pattern ending in a slash matches directories only. A
+// pattern without any other slash matches the base name at any depth, and
+// one with a slash matches the whole relative path.
+func matchesPattern(pattern string, rel string, dir bool) (matched bool) {
+	if strings.HasSuffix(pattern, "/") {
+		if !dir {
+			return matched
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	name := rel
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(rel)
+	}
+
+	matched, _ = path.Match(pattern, name)
+	return matched
+}
+
+// matchesAny reports whether the path matches one of the patterns.
+func matchesAny(patterns []string, rel string, dir bool) (matched bool) {
+	for _, pattern := range patterns {
+		if matchesPattern(pattern, rel, dir) {
+			matched = true
+			return matched
+		}
+	}
+	return matched
+}
+
+// selected reports whether the walker should descend into a directory or
+// index a file, given its include and exclude patterns and those of the Go
+// module it is in. Excluded paths are skipped; with include patterns set,
+// only the files matching one are kept.
+func (fw *fileWalker) selected(filePath string, dir bool) (selected bool) {
+	rel := fw.relPath(filePath)
+	if rel == "." {
+		selected = true
+		return selected
+	}
+
+	if matchesAny(fw.excludePatterns, rel, dir) {
+		return selected
+	}
+	if !dir && len(fw.includePatterns) > 0 && !matchesAny(fw.includePatterns, rel, dir) {
+		return selected
+	}
+	if !fw.module(filePath, dir).selects(filePath, dir) {
+		return selected
+	}
+
+	selected = true
+	return selected
+}
+
+// relPath returns the slash-separated path of a file relative to the
+// repository root, or the path itself when it isn't under the root.
+func (fw *fileWalker) relPath(filePath string) (rel string) {
+	rel, relErr := filepath.Rel(fw.root, filePath)
+	if relErr != nil || strings.HasPrefix(rel, "..") {
+		rel = filePath
+	}
+	rel = filepath.ToSlash(rel)
+	return rel
+}
+
+// isTestFile reports whether a file, by its repository-relative path, holds
+// tests by the naming conventions of the supported languages or sits in a
+// testdata directory.
+func isTestFile(rel string) (test bool) {
+	if strings.Contains("/"+rel, "/testdata/") {
+		test = true
+		return test
+	}
+
+	name := path.Base(rel)
+	switch {
+	case strings.HasSuffix(name, "_test.go"), strings.HasSuffix(name, "_test.py"):
+		test = true
+	case strings.HasPrefix(name, "test_") && strings.HasSuffix(name, ".py"):
+		test = true
+	case strings.Contains(name, ".test.") || strings.Contains(name, ".spec."):
+		test = true
+	}
+	return test
+}
+
+// isGenerated reports whether a file carries a "Code generated ... DO NOT
+// EDIT." line ahead of its first line of code.
+func isGenerated(content []byte) (generated bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if generatedHeader.MatchString(line) {
+			generated = true
+			return generated
+		}
+		if line != "" && !strings.HasPrefix(line, "//") && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "/*") && !strings.HasPrefix(line, "*") {
+			return generated
+		}
+	}
+	return generated
+}
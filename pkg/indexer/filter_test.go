@@ -0,0 +1,161 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		rel     string
+		dir     bool
+		want    bool
+	}{
+		{name: "base name at depth", pattern: "*_test.go", rel: "pkg/store/store_test.go", want: true},
+		{name: "base name mismatch", pattern: "*_test.go", rel: "pkg/store/store.go", want: false},
+		{name: "prefix glob", pattern: "zz_generated*", rel: "apis/v1/zz_generated.deepcopy.go", want: true},
+		{name: "directory pattern", pattern: "testdata/", rel: "pkg/parser/testdata", dir: true, want: true},
+		{name: "directory pattern skips files", pattern: "testdata/", rel: "pkg/testdata", want: false},
+		{name: "relative path", pattern: "internal/*.go", rel: "internal/x.go", want: true},
+		{name: "relative path at depth", pattern: "internal/*.go", rel: "pkg/internal/x.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchesPattern(tt.pattern, tt.rel, tt.dir)
+			if got != tt.want {
+				t.Errorf("matchesPattern(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTestFile(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{rel: "pkg/store/store_test.go", want: true},
+		{rel: "tools/test_build.py", want: true},
+		{rel: "tools/build_test.py", want: true},
+		{rel: "web/src/app.spec.ts", want: true},
+		{rel: "web/src/app.test.tsx", want: true},
+		{rel: "pkg/parser/testdata/sample.go", want: true},
+		{rel: "testdata/sample.go", want: true},
+		{rel: "pkg/store/store.go", want: false},
+		{rel: "pkg/testing/helpers.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			got := isTestFile(tt.rel)
+			if got != tt.want {
+				t.Errorf("isTestFile(%q) = %v, want %v", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "go header", content: "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage pb\n", want: true},
+		{name: "after build tags", content: "//go:build linux\n\n// Code generated by stringer; DO NOT EDIT.\n\npackage p\n", want: true},
+		{name: "python header", content: "#!/usr/bin/env python\n# Code generated by gen.py. DO NOT EDIT.\nimport os\n", want: true},
+		{name: "hand written", content: "// Package p does things.\npackage p\n", want: false},
+		{name: "marker after code", content: "package p\n\n// Code generated by hand. DO NOT EDIT.\n", want: false},
+		{name: "missing period", content: "// Code generated by tool. DO NOT EDIT\npackage p\n", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isGenerated([]byte(tt.content))
+			if got != tt.want {
+				t.Errorf("isGenerated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkPatterns(t *testing.T) {
+	repo := t.TempDir()
+	files := map[string]string{
+		"store.go":                 "package store\n\nfunc Open() {}\n",
+		"store_test.go":            "package store\n\nfunc TestOpen() {}\n",
+		"api.pb.go":                "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage store\n\nfunc Marshal() {}\n",
+		"enum_string.go":           "// Code generated by \"stringer\"; DO NOT EDIT.\n\npackage store\n\nfunc String() {}\n",
+		"zz_generated.deepcopy.go": "package store\n\nfunc DeepCopy() {}\n",
+		"testdata/fixture.go":      "package fixture\n\nfunc Fixture() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o750)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name:    "default excludes",
+			exclude: []string{"*_test.go", "*.pb.go", "zz_generated*", "testdata/"},
+			want:    []string{"Open", "String generated"},
+		},
+		{
+			name: "tests indexed anyway",
+			want: []string{"DeepCopy", "Fixture test", "Marshal generated", "Open", "String generated", "TestOpen test"},
+		},
+		{
+			name:    "include patterns",
+			include: []string{"*_test.go", "testdata/*.go"},
+			exclude: []string{"*.pb.go"},
+			want:    []string{"Fixture test", "TestOpen test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, docs := newTestWalker(t, "repo")
+			fw.pause = newPauseGate()
+			fw.root = repo
+			fw.includePatterns = tt.include
+			fw.excludePatterns = tt.exclude
+			err := filepath.Walk(repo, fw.walk)
+			if err != nil {
+				t.Fatalf("walk error = %v", err)
+			}
+
+			var got []string
+			for _, doc := range *docs {
+				label := doc.FunctionName
+				if doc.IsTest {
+					label += " test"
+				}
+				if doc.IsGenerated {
+					label += " generated"
+				}
+				got = append(got, label)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("indexed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,21 +5,48 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/logging"
 )
 
-// gitClone clones a git repository to the target directory.
+// cloneOptions limit how much of a repository a clone keeps on disk.
+type cloneOptions struct {
+	// depth is how many commits of history to fetch; 0 fetches all of it.
+	depth int
+	// filter is a partial clone filter, such as blob:none, or empty for a
+	// full clone.
+	filter string
+}
+
+// gitClone clones a git repository to the target directory, checking out
+// branch, or the remote's default branch when empty, with the history and
+// objects opts allow, through proxy as buildGitEnv sets it. Credentials in
+// the URL are masked in the error git's output is reported in.
 // Uses a 5-minute timeout for clone operations.
-func gitClone(ctx context.Context, url string, target string, sshKeyPath string, sshCommand string) (err error) {
+func gitClone(ctx context.Context, url string, target string, branch string, opts cloneOptions, sshKeyPath string, sshCommand string, proxy string) (err error) {
 	const cloneTimeout = 5 * time.Minute
 
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, cloneTimeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "git", "clone", url, target)
-	cmd.Env = buildGitEnv(sshKeyPath, sshCommand)
+	args := []string{"clone"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	if opts.depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.depth))
+	}
+	if opts.filter != "" {
+		args = append(args, "--filter="+opts.filter)
+	}
+	cmd := exec.CommandContext(ctx, "git", append(args, "--", url, target)...)
+	cmd.Env = buildGitEnv(sshKeyPath, sshCommand, proxy)
 
 	var output []byte
 	output, err = cmd.CombinedOutput()
@@ -28,24 +55,36 @@ func gitClone(ctx context.Context, url string, target string, sshKeyPath string,
 			err = fmt.Errorf("git clone timed out after %v: %w", cloneTimeout, err)
 			return err
 		}
-		err = fmt.Errorf("git clone failed: %w: %s", err, string(output))
+		err = fmt.Errorf("git clone failed: %w: %s", err, logging.RedactURLs(string(output)))
 		return err
 	}
 
 	return err
 }
 
-// gitFetch fetches updates from remote and resets to origin/HEAD.
+// gitFetch fetches updates from remote and resets to origin/HEAD, or to
+// branch on the remote when set. A shallow clone stays opts.depth commits
+// deep; one cloned shallow is fetched in full once opts.depth is 0. A partial
+// clone keeps the filter it was cloned with. The fetch goes through proxy as
+// buildGitEnv sets it.
 // Uses a 2-minute timeout for fetch operations.
-func gitFetch(ctx context.Context, repoPath string, sshKeyPath string, sshCommand string) (err error) {
+func gitFetch(ctx context.Context, repoPath string, branch string, opts cloneOptions, sshKeyPath string, sshCommand string, proxy string) (err error) {
 	const fetchTimeout = 2 * time.Minute
 
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, fetchTimeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "fetch", "--all")
-	cmd.Env = buildGitEnv(sshKeyPath, sshCommand)
+	args := []string{"-C", repoPath, "fetch", "--all"}
+	switch {
+	case opts.depth > 0:
+		args = append(args, "--depth", strconv.Itoa(opts.depth))
+	case gitIsShallow(ctx, repoPath):
+		args = append(args, "--unshallow")
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = buildGitEnv(sshKeyPath, sshCommand, proxy)
 
 	var output []byte
 	output, err = cmd.CombinedOutput()
@@ -54,12 +93,16 @@ func gitFetch(ctx context.Context, repoPath string, sshKeyPath string, sshComman
 			err = fmt.Errorf("git fetch timed out after %v: %w", fetchTimeout, err)
 			return err
 		}
-		err = fmt.Errorf("git fetch failed: %w: %s", err, string(output))
+		err = fmt.Errorf("git fetch failed: %w: %s", err, logging.RedactURLs(string(output)))
 		return err
 	}
 
-	cmd = exec.CommandContext(ctx, "git", "-C", repoPath, "reset", "--hard", "origin/HEAD")
-	cmd.Env = buildGitEnv(sshKeyPath, sshCommand)
+	target := "origin/HEAD"
+	if branch != "" {
+		target = "origin/" + branch
+	}
+	cmd = exec.CommandContext(ctx, "git", "-C", repoPath, "reset", "--hard", target, "--")
+	cmd.Env = buildGitEnv(sshKeyPath, sshCommand, proxy)
 
 	output, err = cmd.CombinedOutput()
 	if err != nil {
@@ -67,17 +110,60 @@ func gitFetch(ctx context.Context, repoPath string, sshKeyPath string, sshComman
 			err = fmt.Errorf("git reset timed out after %v: %w", fetchTimeout, err)
 			return err
 		}
-		err = fmt.Errorf("git reset failed: %w: %s", err, string(output))
+		err = fmt.Errorf("git reset failed: %w: %s", err, logging.RedactURLs(string(output)))
 		return err
 	}
 
 	return err
 }
 
-// buildGitEnv constructs the environment for git commands with SSH configuration.
-func buildGitEnv(sshKeyPath string, sshCommand string) (env []string) {
+// gitHeadCommit returns the commit SHA checked out in the repository.
+func gitHeadCommit(ctx context.Context, repoPath string) (sha string, err error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-parse", "HEAD")
+
+	var output []byte
+	output, err = cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("git rev-parse failed: %w", err)
+		return sha, err
+	}
+
+	sha = strings.TrimSpace(string(output))
+	return sha, err
+}
+
+// gitIsShallow reports whether the repository is a shallow clone.
+func gitIsShallow(ctx context.Context, repoPath string) (shallow bool) {
+	output, err := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-parse", "--is-shallow-repository").Output()
+	shallow = err == nil && strings.TrimSpace(string(output)) == "true"
+	return shallow
+}
+
+// proxyVariables are the environment variables git, through curl, picks an
+// HTTP proxy from.
+//
+//nolint:gochecknoglobals // constant list
+var proxyVariables = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy"}
+
+// buildGitEnv constructs the environment for git commands with SSH and proxy
+// configuration. A proxy URL is set as git's http.proxy through the
+// environment, so its credentials stay off the command line; config.ProxyNone
+// drops the proxy variables so git connects directly; and an empty proxy
+// leaves git to the proxy variables it inherits.
+func buildGitEnv(sshKeyPath string, sshCommand string, proxy string) (env []string) {
 	env = os.Environ()
 
+	switch proxy {
+	case "":
+	case config.ProxyNone:
+		env = slices.DeleteFunc(env, func(variable string) bool {
+			name, _, _ := strings.Cut(variable, "=")
+			return slices.Contains(proxyVariables, name)
+		})
+	default:
+		env = withGitConfig(env, "http.proxy", proxy)
+	}
+
 	// If custom SSH command is provided, use it
 	if sshCommand != "" {
 		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=%s", sshCommand))
@@ -94,11 +180,31 @@ func buildGitEnv(sshKeyPath string, sshCommand string) (env []string) {
 	return env
 }
 
-// buildRepoURL constructs a repository URL from template, org, repo name, and optional token.
-func buildRepoURL(urlFormat string, org string, repo string, token string) (url string) {
-	url = strings.ReplaceAll(urlFormat, "{org}", org)
+// withGitConfig adds a git config setting to env with GIT_CONFIG_COUNT, after
+// any the environment already sets that way.
+func withGitConfig(env []string, key string, value string) (withConfig []string) {
+	count, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	withConfig = append(env,
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, value),
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", count+1),
+	)
+	return withConfig
+}
+
+// buildRepoURL constructs a repository URL from template, host, org, repo
+// name, and optional token. A template with a {token} placeholder places the
+// token itself; otherwise it is added as the user info of an https URL.
+func buildRepoURL(urlFormat string, host string, org string, repo string, token string) (url string) {
+	url = strings.ReplaceAll(urlFormat, "{host}", host)
+	url = strings.ReplaceAll(url, "{org}", org)
 	url = strings.ReplaceAll(url, "{repo}", repo)
 
+	if strings.Contains(url, "{token}") {
+		url = strings.ReplaceAll(url, "{token}", token)
+		return url
+	}
+
 	if token != "" {
 		url = strings.Replace(url, "https://", fmt.Sprintf("https://%s@", token), 1)
 	}
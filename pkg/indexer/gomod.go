@@ -0,0 +1,191 @@
+package indexer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// goModule is what a go.mod file declares: the module's path, the Go
+// version it is written for, and the modules it requires directly. The
+// module's directory and its include and exclude patterns from the config
+// file are set when it is found in a repository.
+type goModule struct {
+	dir       string
+	path      string
+	goVersion string
+	requires  []string
+	include   []string
+	exclude   []string
+}
+
+// parseGoMod reads a go.mod file. Requirements marked "// indirect" are left
+// out, as are replace and exclude directives.
+func parseGoMod(goMod string) (module goModule, err error) {
+	file, err := os.Open(goMod)
+	if err != nil {
+		return module, err
+	}
+	defer file.Close()
+
+	inRequire := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, comment, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire:
+			module.addRequire(fields[0], comment)
+		case fields[0] == "module" && len(fields) == 2 && module.path == "":
+			module.path = unquoteModulePath(fields[1])
+		case fields[0] == "go" && len(fields) == 2:
+			module.goVersion = fields[1]
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) == 3:
+			module.addRequire(fields[1], comment)
+		}
+	}
+
+	err = scanner.Err()
+	if err == nil && module.path == "" {
+		err = fmt.Errorf("%s declares no module", goMod)
+	}
+	return module, err
+}
+
+// addRequire records a requirement unless its comment marks it indirect.
+func (m *goModule) addRequire(modulePath string, comment string) {
+	if strings.TrimSpace(comment) == "indirect" || strings.HasPrefix(strings.TrimSpace(comment), "indirect;") {
+		return
+	}
+	m.requires = append(m.requires, unquoteModulePath(modulePath))
+}
+
+// unquoteModulePath removes the quotes a go.mod may put around a path.
+func unquoteModulePath(quoted string) (modulePath string) {
+	modulePath = quoted
+	unquoted, err := strconv.Unquote(quoted)
+	if err == nil {
+		modulePath = unquoted
+	}
+	return modulePath
+}
+
+// annotate records the module on a document from one of its files, with the
+// direct requirements the file imports packages of. An import belongs to the
+// requirement with the longest path it falls under, so one of
+// github.com/jackc/pgx/v5 isn't credited to github.com/jackc/pgx.
+func (m *goModule) annotate(doc *elasticsearch.CodeDocument) {
+	if m == nil {
+		return
+	}
+
+	doc.Module = m.path
+	doc.GoVersion = m.goVersion
+	doc.Dependencies = nil
+	for _, imported := range doc.Imports {
+		provider := ""
+		for _, required := range m.requires {
+			if len(required) > len(provider) && (imported == required || strings.HasPrefix(imported, required+"/")) {
+				provider = required
+			}
+		}
+		if provider != "" && !slices.Contains(doc.Dependencies, provider) {
+			doc.Dependencies = append(doc.Dependencies, provider)
+		}
+	}
+}
+
+// selects reports whether the module's include and exclude patterns let the
+// walker descend into a directory or index a file within it.
+func (m *goModule) selects(filePath string, dir bool) (selected bool) {
+	selected = true
+	if m == nil {
+		return selected
+	}
+
+	rel, err := filepath.Rel(m.dir, filePath)
+	if err != nil || rel == "." {
+		return selected
+	}
+	rel = filepath.ToSlash(rel)
+
+	switch {
+	case matchesAny(m.exclude, rel, dir):
+		selected = false
+	case !dir && len(m.include) > 0 && !matchesAny(m.include, rel, dir):
+		selected = false
+	}
+	return selected
+}
+
+// goModules finds the Go module a repository's files belong to: the one
+// whose go.mod is in the nearest directory at or above a file's, within the
+// repository. Each directory is looked at once.
+type goModules struct {
+	root     string
+	settings config.RepoConfig
+	dirs     map[string]*goModule
+}
+
+// newGoModules finds modules under root, applying the module settings of the
+// repository's config.
+func newGoModules(root string, settings config.RepoConfig) (modules *goModules) {
+	modules = &goModules{root: filepath.Clean(root), settings: settings, dirs: map[string]*goModule{}}
+	return modules
+}
+
+// forFile returns the module a file belongs to, or nil when it is in none or
+// its go.mod can't be read.
+func (m *goModules) forFile(filePath string) (module *goModule) {
+	if m == nil {
+		return module
+	}
+	module = m.forDir(filepath.Dir(filePath))
+	return module
+}
+
+// forDir returns the module a directory belongs to.
+func (m *goModules) forDir(dir string) (module *goModule) {
+	if m == nil {
+		return module
+	}
+	module, found := m.dirs[dir]
+	if found {
+		return module
+	}
+
+	goMod := filepath.Join(dir, "go.mod")
+	_, statErr := os.Stat(goMod)
+	rel, relErr := filepath.Rel(m.root, dir)
+	switch {
+	case statErr == nil:
+		parsed, err := parseGoMod(goMod)
+		if err == nil {
+			settings := m.settings.Module(parsed.path)
+			parsed.dir = dir
+			parsed.include = settings.Include
+			parsed.exclude = settings.Exclude
+			module = &parsed
+		}
+	case relErr == nil && rel != "." && filepath.IsLocal(rel):
+		module = m.forDir(filepath.Dir(dir))
+	}
+
+	m.dirs[dir] = module
+	return module
+}
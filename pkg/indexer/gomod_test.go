@@ -0,0 +1,166 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestParseGoMod(t *testing.T) {
+	tests := []struct {
+		content      string
+		wantPath     string
+		wantVersion  string
+		wantRequires []string
+		wantErr      bool
+	}{
+		{content: "module example.com/a\n", wantPath: "example.com/a"},
+		{content: "// comment\nmodule \"example.com/b\" // quoted\n\ngo 1.22\n", wantPath: "example.com/b", wantVersion: "1.22"},
+		{
+			content:      "module example.com/c\n\ngo 1.23.1\n\nrequire github.com/jackc/pgx/v5 v5.7.1\n\nrequire (\n\tgithub.com/google/uuid v1.6.0\n\tgolang.org/x/text v0.21.0 // indirect\n\t\"example.com/quoted\" v1.0.0\n)\n\nreplace example.com/quoted => ../quoted\n",
+			wantPath:     "example.com/c",
+			wantVersion:  "1.23.1",
+			wantRequires: []string{"github.com/jackc/pgx/v5", "github.com/google/uuid", "example.com/quoted"},
+		},
+		{content: "modules example.com/d\n", wantErr: true},
+		{content: "go 1.22\n", wantVersion: "1.22", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "go.mod")
+		err := os.WriteFile(path, []byte(tt.content), 0o600)
+		if err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		got, err := parseGoMod(path)
+		if (err != nil) != tt.wantErr || got.path != tt.wantPath || got.goVersion != tt.wantVersion || !slices.Equal(got.requires, tt.wantRequires) {
+			t.Errorf("parseGoMod(%q) = %+v, %v; want %q, %q, %v, error %v", tt.content, got, err, tt.wantPath, tt.wantVersion, tt.wantRequires, tt.wantErr)
+		}
+	}
+}
+
+func TestGoModulesForFile(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":               "module example.com/root\n\ngo 1.22\n\nrequire github.com/jackc/pgx/v5 v5.7.1\n",
+		"pkg/db/db.go":         "package db\n",
+		"tools/go.mod":         "module example.com/root/tools\n\ngo 1.23\n",
+		"tools/gen/gen.go":     "package main\n",
+		"broken/go.mod":        "go 1.22\n",
+		"broken/cmd/main.go":   "package main\n",
+		"examples/x/readme.md": "# x\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	modules := newGoModules(root, config.RepoConfig{})
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "pkg/db/db.go", want: "example.com/root"},
+		{file: "tools/gen/gen.go", want: "example.com/root/tools"},
+		{file: "broken/cmd/main.go", want: ""},
+		{file: "examples/x/readme.md", want: "example.com/root"},
+	}
+	for _, tt := range tests {
+		module := modules.forFile(filepath.Join(root, tt.file))
+		got := ""
+		if module != nil {
+			got = module.path
+		}
+		if got != tt.want {
+			t.Errorf("forFile(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+
+	outside := newGoModules(filepath.Join(root, "pkg"), config.RepoConfig{})
+	if module := outside.forFile(filepath.Join(root, "pkg", "db", "db.go")); module != nil {
+		t.Errorf("forFile() found %q above the repository root", module.path)
+	}
+}
+
+func TestGoModuleAnnotate(t *testing.T) {
+	module := &goModule{
+		path:      "example.com/api",
+		goVersion: "1.23",
+		requires:  []string{"github.com/jackc/pgx/v5", "github.com/google/uuid", "github.com/jackc/pgx"},
+	}
+	doc := elasticsearch.CodeDocument{Imports: []string{"context", "github.com/jackc/pgx/v5/pgxpool", "github.com/google/uuid"}}
+	module.annotate(&doc)
+
+	if doc.Module != "example.com/api" || doc.GoVersion != "1.23" {
+		t.Errorf("annotate() set module %q, Go %q", doc.Module, doc.GoVersion)
+	}
+	want := []string{"github.com/jackc/pgx/v5", "github.com/google/uuid"}
+	if !slices.Equal(doc.Dependencies, want) {
+		t.Errorf("annotate() dependencies = %v, want %v", doc.Dependencies, want)
+	}
+
+	var none *goModule
+	none.annotate(&doc)
+	if doc.Module != "example.com/api" {
+		t.Error("a nil module changed the document")
+	}
+}
+
+func TestWalkModules(t *testing.T) {
+	repo := t.TempDir()
+	files := map[string]string{
+		"go.mod":                               "module example.com/mono\n",
+		"cmd/main.go":                          "package main\n\nfunc Run() {}\n",
+		"services/billing/go.mod":              "module example.com/mono/billing\n",
+		"services/billing/invoice.go":          "package billing\n\nfunc Invoice() {}\n",
+		"services/billing/internal/db/db.go":   "package db\n\nfunc Query() {}\n",
+		"services/billing/mock_invoice.go":     "package billing\n\nfunc MockInvoice() {}\n",
+		"services/legacy/go.mod":               "module example.com/mono/legacy\n",
+		"services/legacy/old.go":               "package legacy\n\nfunc Old() {}\n",
+		"services/legacy/internal/compat/c.go": "package compat\n\nfunc Compat() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o750)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	fw, docs := newTestWalker(t, "repo")
+	fw.pause = newPauseGate()
+	fw.root = repo
+	fw.modules = newGoModules(repo, config.RepoConfig{Modules: []config.ModuleConfig{
+		{Path: "example.com/mono/billing", Include: []string{"*.go"}, Exclude: []string{"internal/", "mock_*"}},
+		{Path: "example.com/mono/legacy", Exclude: []string{"*"}},
+	}})
+	err := filepath.Walk(repo, fw.walk)
+	if err != nil {
+		t.Fatalf("walk error = %v", err)
+	}
+
+	var got []string
+	for _, doc := range *docs {
+		got = append(got, doc.FunctionName+" "+doc.Module)
+	}
+	slices.Sort(got)
+	want := []string{"Invoice example.com/mono/billing", "Run example.com/mono"}
+	if !slices.Equal(got, want) {
+		t.Errorf("indexed = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,193 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern from a .gitignore-style file.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher applies the ignore files found while walking a repository.
+// Rules are kept per directory, relative to the repository root, and apply
+// to the paths below it; as in git, the last matching rule wins and deeper
+// files override shallower ones.
+type ignoreMatcher struct {
+	names []string
+	rules map[string][]ignoreRule
+}
+
+// newIgnoreMatcher returns a matcher reading the ignore files with the given
+// names, such as .gitignore, from each directory walked.
+func newIgnoreMatcher(names []string) (m *ignoreMatcher) {
+	m = &ignoreMatcher{names: names, rules: make(map[string][]ignoreRule)}
+	return m
+}
+
+// load reads the ignore files in a directory, at dir on disk and rel from the
+// repository root, replacing any rules loaded for it before. Missing or
+// unreadable files are skipped.
+func (m *ignoreMatcher) load(dir string, rel string) {
+	if m == nil {
+		return
+	}
+
+	delete(m.rules, rel)
+
+	for _, name := range m.names {
+		file, openErr := os.Open(filepath.Join(dir, name))
+		if openErr != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			rule, ok := parseIgnoreRule(scanner.Text())
+			if ok {
+				m.rules[rel] = append(m.rules[rel], rule)
+			}
+		}
+		_ = file.Close()
+	}
+}
+
+// ignored reports whether the slash-separated path rel, relative to the
+// repository root, is ignored by the rules loaded for its parent directories.
+func (m *ignoreMatcher) ignored(rel string, dir bool) (ignored bool) {
+	if m == nil || len(m.rules) == 0 {
+		return ignored
+	}
+
+	parts := strings.Split(rel, "/")
+	for depth := range parts {
+		base := strings.Join(parts[:depth], "/")
+		if depth == 0 {
+			base = "."
+		}
+		sub := strings.Join(parts[depth:], "/")
+		for _, rule := range m.rules[base] {
+			if rule.dirOnly && !dir {
+				continue
+			}
+			if rule.pattern.MatchString(sub) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// ignored reports whether the repository's ignore files exclude a path.
+func (fw *fileWalker) ignored(filePath string, dir bool) (ignored bool) {
+	rel := fw.relPath(filePath)
+	if rel == "." {
+		return ignored
+	}
+
+	ignored = fw.ignores.ignored(rel, dir)
+	return ignored
+}
+
+// parseIgnoreRule compiles one line of an ignore file, reporting false for
+// blank lines and comments. A pattern with a slash before its end is anchored
+// to the file's directory; one without matches a name at any depth.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, ok
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, `\`)
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule, ok
+	}
+
+	prefix := "^(?:.*/)?"
+	if anchored {
+		prefix = "^"
+	}
+
+	var compileErr error
+	rule.pattern, compileErr = regexp.Compile(prefix + globRegexp(line) + "$")
+	if compileErr != nil {
+		return rule, ok
+	}
+
+	ok = true
+	return rule, ok
+}
+
+// globRegexp translates a gitignore glob to a regular expression: * and ?
+// stay within a path segment, ** crosses them, and brackets keep their
+// meaning.
+func globRegexp(glob string) (expr string) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr = b.String()
+	return expr
+}
+
+// skippedDir reports whether a directory name is one of the configured
+// extra directories to skip.
+func skippedDir(patterns []string, name string) (skipped bool) {
+	for _, pattern := range patterns {
+		matched, _ := path.Match(pattern, name)
+		if matched {
+			skipped = true
+			return skipped
+		}
+	}
+	return skipped
+}
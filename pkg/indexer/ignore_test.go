@@ -0,0 +1,123 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m := newIgnoreMatcher(nil)
+	for rel, lines := range map[string][]string{
+		".":   {"# build output", "dist/", "*.log", "!keep.log", "/generated", "docs/**/*.tmp", `\#notes`},
+		"web": {"out", "!dist/"},
+	} {
+		for _, line := range lines {
+			rule, ok := parseIgnoreRule(line)
+			if ok {
+				m.rules[rel] = append(m.rules[rel], rule)
+			}
+		}
+	}
+
+	tests := []struct {
+		rel  string
+		dir  bool
+		want bool
+	}{
+		{rel: "dist", dir: true, want: true},
+		{rel: "pkg/dist", dir: true, want: true},
+		{rel: "dist", want: false},
+		{rel: "server.log", want: true},
+		{rel: "pkg/trace.log", want: true},
+		{rel: "keep.log", want: false},
+		{rel: "generated", dir: true, want: true},
+		{rel: "pkg/generated", dir: true, want: false},
+		{rel: "docs/a/b/c.tmp", want: true},
+		{rel: "docs/c.tmp", want: true},
+		{rel: "src/c.tmp", want: false},
+		{rel: "#notes", want: true},
+		{rel: "web/out", dir: true, want: true},
+		{rel: "out", dir: true, want: false},
+		{rel: "web/dist", dir: true, want: false},
+		{rel: "main.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			got := m.ignored(tt.rel, tt.dir)
+			if got != tt.want {
+				t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkIgnoreFiles(t *testing.T) {
+	repo := t.TempDir()
+	files := map[string]string{
+		".gitignore":            "build/\n*.gen.go\n",
+		"main.go":               "package main\n\nfunc main() {}\n",
+		"api.gen.go":            "package main\n\nfunc Generated() {}\n",
+		"build/out.go":          "package build\n\nfunc Built() {}\n",
+		"bazel-out/x/x.go":      "package x\n\nfunc Bazel() {}\n",
+		"web/.ragignore":        "legacy.go\n",
+		"web/legacy.go":         "package web\n\nfunc Legacy() {}\n",
+		"web/handler.go":        "package web\n\nfunc Handle() {}\n",
+		"web/legacy/current.go": "package legacy\n\nfunc Current() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o750)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		ignoreFiles []string
+		skipDirs    []string
+		want        []string
+	}{
+		{
+			name:        "ignore files and skip dirs",
+			ignoreFiles: []string{".gitignore", ".ragignore"},
+			skipDirs:    []string{"bazel-*"},
+			want:        []string{"Current", "Handle", "main"},
+		},
+		{
+			name: "nothing ignored",
+			want: []string{"Bazel", "Built", "Current", "Generated", "Handle", "Legacy", "main"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, docs := newTestWalker(t, "repo")
+			fw.pause = newPauseGate()
+			fw.root = repo
+			fw.skipDirs = tt.skipDirs
+			fw.ignores = newIgnoreMatcher(tt.ignoreFiles)
+			err := filepath.Walk(repo, fw.walk)
+			if err != nil {
+				t.Fatalf("walk error = %v", err)
+			}
+
+			var got []string
+			for _, doc := range *docs {
+				got = append(got, doc.FunctionName)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("indexed = %s, want %s", strings.Join(got, ","), strings.Join(tt.want, ","))
+			}
+		})
+	}
+}
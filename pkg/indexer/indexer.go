@@ -8,40 +8,97 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nikogura/rag-indexer/pkg/config"
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/embedding"
+	"github.com/nikogura/rag-indexer/pkg/enrich"
+	"github.com/nikogura/rag-indexer/pkg/lint"
 	"github.com/nikogura/rag-indexer/pkg/logging"
 	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/nikogura/rag-indexer/pkg/summary"
+	"github.com/nikogura/rag-indexer/pkg/webhook"
 )
 
-// ErrGitConfigRequired is returned when GIT_ORG and GIT_REPOS are not configured.
-var ErrGitConfigRequired = errors.New("GIT_ORG and GIT_REPOS must be set for cloning")
+// ErrGitConfigRequired is returned when neither GIT_ORG and GIT_REPOS nor
+// sources are configured, or a repository's source isn't.
+var ErrGitConfigRequired = errors.New("GIT_ORG and GIT_REPOS, or sources, must be set for cloning")
+
+// ErrDocumentLimit is returned when a repository produces more documents than
+// MAX_DOCS_PER_REPO allows. Indexing of the repository stops at the limit.
+var ErrDocumentLimit = errors.New("repository exceeded the document limit")
 
 // Indexer handles code indexing operations.
 type Indexer struct {
-	config  config.Config
-	es      *elasticsearch.Client
-	metrics *metrics.Metrics
-	logger  logging.Logger
-	mu      sync.Mutex
+	config        config.Config
+	es            *elasticsearch.Client
+	metrics       *metrics.Metrics
+	logger        logging.Logger
+	renames       *renameTracker
+	quarantine    *parseQuarantine
+	jobs          *jobTracker
+	notifications *notificationHub
+	pause         *pauseGate
+	history       *indexHistory
+	webhooks      *webhook.Notifier
+	backfill      *backfillTracker
+	embedder      *embedding.Client
+	summaries     *summary.Client
+	linter        *lint.Linter
+	state         *stateStore
+	manifests     *manifestStore
+	deadLetters   *deadLetterStore
+	parseBudget   *memoryBudget
+	discovery     *repoDiscovery
+	mu            sync.Mutex
+	draining      atomic.Bool
+	snapshotRepo  atomic.Bool
 }
 
 // New creates a new Indexer instance.
 func New(cfg config.Config, es *elasticsearch.Client, m *metrics.Metrics, logger logging.Logger) (indexer *Indexer) {
+	state := openStateStore(cfg.StateFile, logger)
+
+	// The embedder lives as long as the indexer so its cache carries over
+	// between backfills; without EMBEDDING_URL it stays nil.
+	var store *elasticsearch.EmbeddingCache
+	if es != nil && cfg.EmbeddingCacheIndex != "" {
+		store = es.EmbeddingCache(cfg.EmbeddingCacheIndex)
+	}
+	embedder, _ := embedding.New(cfg, m, store)
+	summaries, _ := summary.New(cfg)
+
 	indexer = &Indexer{
-		config:  cfg,
-		es:      es,
-		metrics: m,
-		logger:  logger,
+		config:        cfg,
+		es:            es,
+		metrics:       m,
+		logger:        logger,
+		renames:       openRenameTracker(cfg.RenameFile, logger),
+		quarantine:    newParseQuarantine(state),
+		jobs:          newJobTracker(),
+		notifications: newNotificationHub(),
+		pause:         newPauseGate(),
+		history:       newIndexHistory(),
+		webhooks:      webhook.New(cfg, logger),
+		backfill:      &backfillTracker{},
+		embedder:      embedder,
+		summaries:     summaries,
+		linter:        lint.New(cfg.LintChecks),
+		state:         state,
+		manifests:     openManifestStore(cfg.ManifestFile, logger),
+		deadLetters:   openDeadLetterStore(cfg.DeadLetterFile, cfg.DeadLetterMax, m, logger),
+		parseBudget:   newMemoryBudget(cfg.IndexMemoryMB, m),
+		discovery:     newRepoDiscovery(),
 	}
 	return indexer
 }
 
-// CloneRepos clones or updates git repositories configured in the application.
+// CloneRepos clones or updates the repositories of GIT_REPOS and of every
+// source, discovering those of sources that don't list them.
 func (idx *Indexer) CloneRepos(ctx context.Context) (err error) {
-	if idx.config.GitOrg == "" || len(idx.config.GitRepos) == 0 {
+	if !idx.config.Cloning() {
 		err = ErrGitConfigRequired
 		return err
 	}
@@ -52,7 +109,12 @@ func (idx *Indexer) CloneRepos(ctx context.Context) (err error) {
 		return err
 	}
 
-	for _, repo := range idx.config.GitRepos {
+	repos, discoverErr := idx.RepoNames(ctx)
+	if discoverErr != nil {
+		idx.logger.Warn("Failed to discover repositories", "error", discoverErr)
+	}
+
+	for _, repo := range repos {
 		cloneErr := idx.cloneOrUpdateRepo(ctx, repo)
 		if cloneErr != nil {
 			idx.logger.Warn("Failed to process repository", "repo", repo, "error", cloneErr)
@@ -62,16 +124,25 @@ func (idx *Indexer) CloneRepos(ctx context.Context) (err error) {
 	return err
 }
 
-// cloneOrUpdateRepo clones a repo if it doesn't exist, or updates it if it does.
+// cloneOrUpdateRepo clones a repo if it doesn't exist, or updates it if it
+// does, from its source's host with the source's credentials. The clone of
+// a source's repository is kept under REPOS_PATH/<source>.
 func (idx *Indexer) cloneOrUpdateRepo(ctx context.Context, repo string) (err error) {
-	repoURL := buildRepoURL(idx.config.GitURLFormat, idx.config.GitOrg, repo, idx.config.GitToken)
+	source, name, found := idx.config.RepoSource(repo)
+	if !found {
+		err = fmt.Errorf("%w: no source for %s", ErrGitConfigRequired, repo)
+		return err
+	}
+
+	repoURL := buildRepoURL(source.URLTemplate, source.Host, source.Org, name, source.Token)
+	branch := idx.config.Repo(repo).Branch
 	targetDir := filepath.Join(idx.config.ReposPath, repo)
 
 	var statErr error
 	_, statErr = os.Stat(filepath.Join(targetDir, ".git"))
 	if statErr == nil {
 		idx.logger.Info("Repository already exists, fetching updates", "repo", repo)
-		err = gitFetch(ctx, targetDir, idx.config.GitSSHKeyPath, os.Getenv("GIT_SSH_COMMAND"))
+		err = gitFetch(ctx, targetDir, branch, idx.cloneOptions(), source.SSHKeyPath, os.Getenv("GIT_SSH_COMMAND"), idx.config.GitProxy)
 		if err != nil {
 			err = fmt.Errorf("failed to fetch: %w", err)
 			return err
@@ -80,7 +151,7 @@ func (idx *Indexer) cloneOrUpdateRepo(ctx context.Context, repo string) (err err
 	}
 
 	idx.logger.Info("Cloning repository", "repo", repo)
-	err = gitClone(ctx, repoURL, targetDir, idx.config.GitSSHKeyPath, os.Getenv("GIT_SSH_COMMAND"))
+	err = gitClone(ctx, repoURL, targetDir, branch, idx.cloneOptions(), source.SSHKeyPath, os.Getenv("GIT_SSH_COMMAND"), idx.config.GitProxy)
 	if err != nil {
 		err = fmt.Errorf("failed to clone: %w", err)
 		return err
@@ -89,26 +160,148 @@ func (idx *Indexer) cloneOrUpdateRepo(ctx context.Context, repo string) (err err
 	return err
 }
 
+// cloneOptions returns how much of each repository GIT_CLONE_DEPTH and
+// GIT_CLONE_FILTER keep on disk. Indexing reads only the checked-out tree,
+// so shallow and partial clones index the same as full ones.
+func (idx *Indexer) cloneOptions() (opts cloneOptions) {
+	opts = cloneOptions{
+		depth:  idx.config.GitCloneDepth,
+		filter: idx.config.GitCloneFilter,
+	}
+	return opts
+}
+
 // IndexAllRepos indexes all git repositories found in the configured repos path.
 func (idx *Indexer) IndexAllRepos(ctx context.Context) (totalCount int, err error) {
+	totalCount, err = idx.indexAllRepos(ctx, "", ReindexOptions{})
+	return totalCount, err
+}
+
+// ReindexOptions controls a reindex started through StartReindex.
+type ReindexOptions struct {
+	// Rebuild indexes into a new index generation and swaps the ES_INDEX
+	// alias to it once every repository succeeds, instead of writing to the
+	// live index.
+	Rebuild bool `json:"rebuild"`
+	// DryRun walks and parses every repository and reports what indexing
+	// them would change, without writing to the index.
+	DryRun bool `json:"dry_run"`
+}
+
+// StartReindex queues a tracked reindex of all repositories, or a dry run of
+// one with opts.DryRun, and runs it in the background. It returns
+// ErrReindexInProgress, along with the active job, if a tracked reindex is
+// already queued or running, and ErrShuttingDown once the indexer is
+// draining.
+func (idx *Indexer) StartReindex(ctx context.Context, opts ReindexOptions) (job Job, err error) {
+	if idx.Draining() {
+		err = ErrShuttingDown
+		return job, err
+	}
+
+	job, err = idx.jobs.create(opts)
+	if err != nil {
+		return job, err
+	}
+
+	go func() {
+		var count int
+		var runErr error
+		if opts.DryRun {
+			_, count, runErr = idx.previewAllRepos(ctx, job.ID)
+		} else {
+			count, runErr = idx.indexAllRepos(ctx, job.ID, opts)
+		}
+		idx.jobs.finish(job.ID, runErr)
+		if runErr != nil {
+			idx.logger.Error("Reindex job failed", "job", job.ID, "error", runErr)
+			return
+		}
+		idx.logger.Info("Reindex job complete", "job", job.ID, "functions", count)
+	}()
+
+	return job, err
+}
+
+// Job returns the reindex job with the given ID.
+func (idx *Indexer) Job(id string) (job Job, found bool) {
+	job, found = idx.jobs.get(id)
+	return job, found
+}
+
+// JobEvents returns a channel receiving the progress events of the reindex
+// job with the given ID, closed when the job finishes, and a function to
+// stop receiving them.
+func (idx *Indexer) JobEvents(id string) (events <-chan ProgressEvent, unsubscribe func(), found bool) {
+	events, unsubscribe, found = idx.jobs.subscribe(id)
+	return events, unsubscribe, found
+}
+
+// Notifications returns a channel receiving every notification of a change
+// to the index from now on, closed if the subscriber falls behind, and a
+// function to stop receiving them.
+func (idx *Indexer) Notifications() (events <-chan Notification, unsubscribe func()) {
+	events, unsubscribe = idx.notifications.subscribe()
+	return events, unsubscribe
+}
+
+// indexAllRepos indexes every git repository cloned under the repos path, reporting
+// progress to the job with the given ID when it is non-empty. A rebuild
+// writes to a new index generation instead of the live index. Configured
+// webhooks are notified when the run ends. Once the indexer is draining, no
+// further repository is started and the run ends with ErrShuttingDown.
+func (idx *Indexer) indexAllRepos(ctx context.Context, jobID string, opts ReindexOptions) (totalCount int, err error) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	var entries []os.DirEntry
-	entries, err = os.ReadDir(idx.config.ReposPath)
+	if idx.Draining() {
+		err = ErrShuttingDown
+		return totalCount, err
+	}
+
+	started := time.Now()
+	var results []webhook.RepoResult
+	defer func() {
+		idx.notifyRun(ctx, jobID, started, totalCount, results, err)
+	}()
+
+	var repos []string
+	repos, err = idx.clonedRepos()
 	if err != nil {
-		err = fmt.Errorf("failed to read repos directory: %w", err)
 		return totalCount, err
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+	idx.jobs.start(jobID, repos)
+
+	target := idx.es
+	if opts.Rebuild {
+		var generation string
+		generation, err = idx.es.CreateGeneration(ctx, started)
+		if err != nil {
+			err = fmt.Errorf("failed to create index generation: %w", err)
+			return totalCount, err
+		}
+		idx.jobs.setIndex(jobID, generation)
+		idx.logger.Info("Rebuilding into new index generation", "index", generation, "alias", idx.es.Index())
+		target = idx.es.WithIndex(generation)
+	}
+
+	for _, repo := range repos {
+		if idx.Draining() {
+			idx.logger.Warn("Shutting down, skipping remaining repositories", "indexed", len(results), "skipped", len(repos)-len(results))
+			err = ErrShuttingDown
+			break
 		}
 
-		count, indexErr := idx.indexRepoIfValid(ctx, entry.Name())
+		idx.jobs.repoStarted(jobID, repo)
+
+		repoStart := time.Now()
+		count, indexErr := idx.indexRepository(ctx, target, repo, filepath.Join(idx.config.ReposPath, repo))
+		idx.jobs.repoFinished(jobID, repo, count, indexErr)
+		idx.jobs.repoFailures(jobID, repo, idx.failuresSince(repo, repoStart))
+		results = append(results, newRepoResult(repo, count, time.Since(repoStart), indexErr))
 		if indexErr != nil {
-			idx.logger.Error("Failed to index repository", "repo", entry.Name(), "error", indexErr)
+			idx.logger.Error("Failed to index repository", "repo", repo, "error", indexErr)
 			continue
 		}
 
@@ -116,62 +309,467 @@ func (idx *Indexer) IndexAllRepos(ctx context.Context) (totalCount int, err erro
 		idx.metrics.ReposIndexed.Inc()
 	}
 
+	if opts.Rebuild {
+		rebuildErr := idx.finishRebuild(ctx, target, len(repos), results)
+		if err == nil {
+			err = rebuildErr
+		}
+	}
+
 	return totalCount, err
 }
 
-// indexRepoIfValid checks if a directory is a valid git repo and indexes it.
-func (idx *Indexer) indexRepoIfValid(ctx context.Context, name string) (count int, err error) {
-	repoPath := filepath.Join(idx.config.ReposPath, name)
+// finishRebuild swaps the alias to a rebuilt generation once every one of the
+// repos repositories indexed into it, then deletes generations beyond
+// ES_GENERATIONS_KEPT. A rebuild that failed, was cancelled, or stopped short
+// for shutdown is deleted instead, leaving the alias on the previous
+// generation. With SNAPSHOT_BEFORE_REBUILD, the index being replaced is
+// snapshotted before the swap, and a failed snapshot abandons the rebuild.
+func (idx *Indexer) finishRebuild(ctx context.Context, target *elasticsearch.Client, repos int, results []webhook.RepoResult) (err error) {
+	generation := target.Index()
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == webhook.StatusFailed {
+			failed++
+		}
+	}
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("rebuild cancelled: %w", ctx.Err())
+	case failed > 0:
+		err = fmt.Errorf("rebuild aborted: %d of %d repositories failed", failed, len(results))
+	case len(results) < repos:
+		err = fmt.Errorf("rebuild aborted: %d of %d repositories indexed before shutdown", len(results), repos)
+	}
+	if err != nil {
+		deleteErr := idx.es.DeleteIndex(context.WithoutCancel(ctx), generation)
+		if deleteErr != nil {
+			idx.logger.Warn("Failed to delete abandoned index generation", "index", generation, "error", deleteErr)
+		}
+		return err
+	}
 
-	gitPath := filepath.Join(repoPath, ".git")
-	var statErr error
-	_, statErr = os.Stat(gitPath)
-	if os.IsNotExist(statErr) {
-		return count, err
+	// Make every document searchable before the alias points at them.
+	err = target.Refresh(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to refresh %s: %w", generation, err)
+		return err
 	}
 
-	count, err = idx.IndexRepository(ctx, repoPath)
+	// Keep a copy of the index being replaced, which may be pruned, or
+	// deleted outright when it is still a concrete index.
+	err = idx.snapshotBeforeRebuild(ctx)
 	if err != nil {
-		return count, err
+		err = fmt.Errorf("rebuild aborted: snapshot failed: %w", err)
+		deleteErr := idx.es.DeleteIndex(context.WithoutCancel(ctx), generation)
+		if deleteErr != nil {
+			idx.logger.Warn("Failed to delete abandoned index generation", "index", generation, "error", deleteErr)
+		}
+		return err
 	}
 
-	return count, err
+	_, err = idx.swapGeneration(ctx, generation)
+	return err
+}
+
+// swapGeneration points the ES_INDEX alias at generation and deletes the old
+// generations beyond ES_GENERATIONS_KEPT. It returns the generations the
+// alias pointed to.
+func (idx *Indexer) swapGeneration(ctx context.Context, generation string) (previous []string, err error) {
+	var replacedIndex bool
+	previous, replacedIndex, err = idx.es.SwapAlias(ctx, generation)
+	if err != nil {
+		return previous, err
+	}
+	if replacedIndex {
+		idx.logger.Warn("Replaced concrete index with alias; it could not be kept for rollback", "alias", idx.es.Index(), "index", generation)
+	}
+	idx.logger.Info("Swapped index alias to new generation", "alias", idx.es.Index(), "index", generation, "previous", previous)
+	idx.notifications.publish(Notification{Type: NotificationIndexSwapped, Index: generation})
+
+	deleted, pruneErr := idx.es.PruneGenerations(ctx)
+	if pruneErr != nil {
+		idx.logger.Warn("Failed to delete old index generations", "error", pruneErr)
+	}
+	if len(deleted) > 0 {
+		idx.logger.Info("Deleted old index generations", "indices", deleted, "kept", idx.config.ESGenerationsKept)
+	}
+
+	return previous, err
+}
+
+// failuresSince returns the repository's parse and index failures recorded
+// since start, leaving out those of earlier runs when this one stopped
+// before its walk.
+func (idx *Indexer) failuresSince(repo string, start time.Time) (failures []ParseFailure) {
+	for _, failure := range idx.quarantine.list(repo) {
+		if !failure.FailedAt.Before(start) {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// newRepoResult describes a repository's outcome for webhook notifications.
+func newRepoResult(repo string, count int, duration time.Duration, indexErr error) (result webhook.RepoResult) {
+	result = webhook.RepoResult{
+		Repo:            repo,
+		Status:          webhook.StatusCompleted,
+		Functions:       count,
+		DurationSeconds: duration.Seconds(),
+	}
+	if indexErr != nil {
+		result.Status = webhook.StatusFailed
+		result.Error = indexErr.Error()
+	}
+	return result
+}
+
+// notifyRun sends the outcome of an index run to the configured webhooks. The
+// run counts as failed if it errored or any repository failed; an error
+// notification is published for a run that errored.
+func (idx *Indexer) notifyRun(ctx context.Context, jobID string, started time.Time, count int, results []webhook.RepoResult, runErr error) {
+	finished := time.Now()
+	event := webhook.RunEvent{
+		Status:          webhook.StatusCompleted,
+		JobID:           jobID,
+		Functions:       count,
+		DurationSeconds: finished.Sub(started).Seconds(),
+		StartedAt:       started,
+		FinishedAt:      finished,
+		Repos:           results,
+	}
+
+	for _, result := range results {
+		if result.Status == webhook.StatusFailed {
+			event.Status = webhook.StatusFailed
+		}
+	}
+	if runErr != nil {
+		event.Status = webhook.StatusFailed
+		event.Error = runErr.Error()
+		idx.notifications.publish(Notification{Type: NotificationError, Job: jobID, Error: runErr.Error()})
+	}
+	if event.Repos == nil {
+		event.Repos = []webhook.RepoResult{}
+	}
+
+	// Notify even if the run was cancelled by shutdown. Errors are logged by the
+	// notifier; a failed webhook shouldn't fail the run.
+	_ = idx.webhooks.Notify(context.WithoutCancel(ctx), event)
+}
+
+// clonedRepos returns the names of the repositories cloned under the repos
+// path: each git repository directly under it, and each under the directory
+// of a source, named source/repo. A missing directory has none.
+func (idx *Indexer) clonedRepos() (repos []string, err error) {
+	repos, err = gitRepos(idx.config.ReposPath, "")
+	if err != nil {
+		return repos, err
+	}
+
+	for _, source := range idx.config.Sources {
+		var sourced []string
+		sourced, err = gitRepos(filepath.Join(idx.config.ReposPath, source.Name), source.Name+"/")
+		if err != nil {
+			return repos, err
+		}
+		repos = append(repos, sourced...)
+	}
+	return repos, err
+}
+
+// gitRepos returns the git repositories directly under dir, each name given
+// prefix.
+func gitRepos(dir string, prefix string) (repos []string, err error) {
+	entries, readErr := os.ReadDir(dir)
+	if readErr != nil {
+		if !os.IsNotExist(readErr) {
+			err = fmt.Errorf("failed to read repos directory: %w", readErr)
+		}
+		return repos, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && isGitRepo(filepath.Join(dir, entry.Name())) {
+			repos = append(repos, prefix+entry.Name())
+		}
+	}
+	return repos, err
+}
+
+// isGitRepo reports whether the directory contains a .git entry.
+func isGitRepo(repoPath string) (isRepo bool) {
+	_, statErr := os.Stat(filepath.Join(repoPath, ".git"))
+	isRepo = !os.IsNotExist(statErr)
+	return isRepo
 }
 
 // IndexRepository indexes a single repository by walking its file tree.
 func (idx *Indexer) IndexRepository(ctx context.Context, repoPath string) (count int, err error) {
-	repoName := filepath.Base(repoPath)
+	count, err = idx.indexRepository(ctx, idx.es, filepath.Base(repoPath), repoPath)
+	return count, err
+}
+
+// IndexPath indexes the working tree of a local directory as it is on disk,
+// under repoName, or the directory's name when repoName is empty. The
+// directory needn't be a git checkout and nothing is cloned or fetched; when
+// it is in one, documents record its HEAD commit.
+func (idx *Indexer) IndexPath(ctx context.Context, dir string, repoName string) (count int, err error) {
+	var absDir string
+	absDir, repoName, err = resolveLocalRepo(dir, repoName)
+	if err != nil {
+		return count, err
+	}
+
+	count, err = idx.indexRepository(ctx, idx.es, repoName, absDir)
+	return count, err
+}
+
+// resolveLocalRepo returns the absolute path of a local directory to index
+// and the repository name its documents get: repoName, or the directory's
+// name when repoName is empty.
+func resolveLocalRepo(dir string, repoName string) (absDir string, repo string, err error) {
+	absDir, err = filepath.Abs(dir)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve %s: %w", dir, err)
+		return absDir, repo, err
+	}
+
+	var info os.FileInfo
+	info, err = os.Stat(absDir)
+	if err != nil {
+		err = fmt.Errorf("failed to read %s: %w", dir, err)
+		return absDir, repo, err
+	}
+	if !info.IsDir() {
+		err = fmt.Errorf("%s is not a directory", dir)
+		return absDir, repo, err
+	}
+
+	repo = repoName
+	if repo == "" {
+		repo = filepath.Base(absDir)
+	}
+	return absDir, repo, err
+}
+
+// indexRepository indexes a single repository into the index es writes to.
+// The commit is read from git when the directory is in a checkout. Progress
+// through the live index is saved to STATE_FILE, and a run interrupted at the
+// same commit picks up after the last file saved. With MANIFEST_FILE, runs
+// into the live index skip the files whose content hasn't changed since the
+// last one.
+func (idx *Indexer) indexRepository(ctx context.Context, es *elasticsearch.Client, repoName string, repoPath string) (count int, err error) {
 	idx.logger.Info("Indexing repository", "repo", repoName)
 
+	commit, commitErr := gitHeadCommit(ctx, repoPath)
+	if commitErr != nil && isGitRepo(repoPath) {
+		idx.logger.Warn("Failed to read repository commit", "repo", repoName, "error", commitErr)
+	}
+
+	// Only runs into the live index resume or keep dead letters; a
+	// rebuild's generation is deleted when it's interrupted.
+	var checkpoint *checkpointer
+	var deadLetters *deadLetterStore
+	var manifest *manifestRun
+	if es == idx.es {
+		if idx.config.StateFile != "" {
+			checkpoint = newCheckpointer(idx.state, idx.logger, repoName, commit, idx.config.StateCheckpointFiles)
+		}
+		manifest = idx.startManifest(ctx, repoName)
+		deadLetters = idx.deadLetters
+		// This run indexes the repository's documents afresh, superseding
+		// the dead letters of earlier runs, unless it resumes one.
+		if checkpoint.resumedDocuments() == 0 {
+			deadLetters.drop(repoName)
+		}
+		defer idx.flushDeadLetters()
+	}
+
 	start := time.Now()
-	count, err = idx.walkAndIndexRepo(ctx, repoName, repoPath)
+	idx.renames.begin(repoName)
+	count, err = idx.walkAndIndexRepo(ctx, es, repoName, repoPath, commit, checkpoint, deadLetters, manifest, nil)
+	checkpoint.finish(ctx, count, err)
+	if err == nil {
+		idx.finishManifest(ctx, repoName, commit, manifest)
+	}
+	if err != nil {
+		idx.renames.discard(repoName)
+	} else {
+		renameErr := idx.renames.commit(repoName)
+		if renameErr != nil {
+			idx.logger.Warn("Failed to save rename history", "repo", repoName, "error", renameErr)
+		}
+	}
 
 	duration := time.Since(start)
 	idx.metrics.IndexingDuration.WithLabelValues(repoName).Observe(duration.Seconds())
 	if err == nil {
+		idx.history.recordSuccess(repoName, time.Now(), commit)
 		idx.metrics.LastSuccessfulIndex.WithLabelValues(repoName).SetToCurrentTime()
 		idx.metrics.FunctionsIndexed.WithLabelValues(repoName).Add(float64(count))
 	}
 
+	// A rebuild's documents aren't searchable until its generation is
+	// swapped in, which sends a notification of its own.
+	switch {
+	case err != nil:
+		idx.notifications.publish(Notification{Type: NotificationError, Repo: repoName, Commit: commit, Error: err.Error()})
+	case es == idx.es:
+		idx.notifications.publish(Notification{Type: NotificationRepoIndexed, Repo: repoName, Commit: commit, Documents: count})
+	}
+
 	return count, err
 }
 
-// walkAndIndexRepo walks the repository tree and indexes Go files.
-func (idx *Indexer) walkAndIndexRepo(ctx context.Context, repoName string, repoPath string) (totalFunctions int, walkErr error) {
+// walkAndIndexRepo walks the repository tree and indexes the files of the
+// configured languages, under the repository's include paths when the config
+// file sets them and as filtered by INCLUDE_PATTERNS and EXCLUDE_PATTERNS.
+// SKIP_DIRS and the repository's own ignore files, IGNORE_FILES, leave out
+// further directories and files. The enrichment hook, when configured, runs for the length
+// of the walk, and functions and methods are summarized when SUMMARY_URL is set. With INDEX_TYPES, the repository's
+// Go packages are type-checked first. With INDEX_OVERVIEWS, each directory's package document is
+// indexed once the whole tree has been. Files the checkpoint says were indexed already are skipped,
+// as are those the manifest, when set, has unchanged, and documents that fail to index are kept in
+// deadLetters when it's set. With a preview, the documents are collected there instead of being
+// indexed, without summaries, and the walk's parse failures and duplicates aren't recorded.
+func (idx *Indexer) walkAndIndexRepo(ctx context.Context, es *elasticsearch.Client, repoName string, repoPath string, commit string, checkpoint *checkpointer, deadLetters *deadLetterStore, manifest *manifestRun, preview *documentPreview) (totalFunctions int, walkErr error) {
 	walker := &fileWalker{
-		ctx:      ctx,
-		es:       idx.es,
-		repoName: repoName,
-		metrics:  idx.metrics,
-		logger:   idx.logger,
+		ctx:             ctx,
+		es:              es,
+		repoName:        repoName,
+		root:            repoPath,
+		include:         idx.config.Repo(repoName).Include,
+		includePatterns: idx.config.IncludePatterns,
+		excludePatterns: idx.config.ExcludePatterns,
+		skipDirs:        idx.config.SkipDirs,
+		ignores:         newIgnoreMatcher(idx.config.IgnoreFiles),
+		commit:          commit,
+		languages:       idx.languages(idx.vetRepo(ctx, repoName, repoPath), idx.typeCheckRepo(ctx, repoName, repoPath)),
+		metrics:         idx.metrics,
+		logger:          idx.logger,
+		renames:         idx.renames,
+		pause:           idx.pause,
+		maxSourceBytes:  idx.config.MaxSourceKB * 1024,
+		maxDocs:         idx.config.MaxDocsPerRepo,
+		chunkMaxLines:   idx.config.ChunkMaxLines,
+		chunkOverlap:    idx.config.ChunkOverlapLines,
+		dups:            newDuplicateTracker(idx.config.DedupIdentical, len(idx.config.IndexPlatforms) > 0),
+		checkpoint:      checkpoint,
+		deadLetters:     deadLetters,
+		budget:          idx.parseBudget,
+		batch:           idx.documentBatch(),
+		bulkBytes:       idx.config.IndexBulkKB * 1024,
+		totalCount:      checkpoint.resumedDocuments(),
+		overviews:       newOverviewTracker(idx.config.IndexOverviews),
+		modules:         newGoModules(repoPath, idx.config.Repo(repoName)),
+		manifest:        manifest,
+		preview:         preview,
+	}
+	if preview != nil {
+		walker.batch = nil
+	} else {
+		walker.summaries = idx.summarizer(ctx, repoName, "")
+	}
+
+	if len(idx.config.EnrichCommand) > 0 {
+		hook := enrich.NewExec(idx.config.EnrichCommand, idx.config.EnrichTimeout)
+		walker.hook = hook
+		defer func() {
+			closeErr := hook.Close()
+			if closeErr != nil {
+				idx.logger.Warn("Enrichment hook did not exit cleanly", "repo", repoName, "error", closeErr)
+			}
+		}()
 	}
 
+	walker.progress = newProgressReporter(idx, repoName, walker.countFiles())
 	walkErr = filepath.Walk(repoPath, walker.walk)
+	walker.progress.finish(walker.totalCount)
+	// A resumed run saw only part of the tree, so its package documents
+	// would leave out the files indexed before it.
+	if walkErr == nil && checkpoint.resumedDocuments() == 0 {
+		walker.indexPackages()
+	}
 	totalFunctions = walker.totalCount
+	if preview == nil {
+		quarantineErr := idx.quarantine.replace(repoName, walker.failures)
+		if quarantineErr != nil {
+			idx.logger.Warn("Failed to save parse failures", "repo", repoName, "error", quarantineErr)
+		}
+		idx.recordDuplicates(ctx, es, repoName, walker.dups.duplicates())
+	}
+
+	if errors.Is(walkErr, ErrDocumentLimit) {
+		idx.logger.Error("Repository hit document limit; remaining files were not indexed",
+			"repo", repoName, "limit", idx.config.MaxDocsPerRepo, "indexed", totalFunctions)
+		idx.metrics.DocumentLimitHits.WithLabelValues(repoName).Inc()
+		walkErr = fmt.Errorf("%w: MAX_DOCS_PER_REPO=%d", ErrDocumentLimit, idx.config.MaxDocsPerRepo)
+	}
 
 	return totalFunctions, walkErr
 }
 
+// documentBatch returns a batch for a walker to send its documents in bulk,
+// or nil when INDEX_BULK_KB is zero and each document is sent on its own.
+func (idx *Indexer) documentBatch() (batch *elasticsearch.DocumentBatch) {
+	if idx.config.IndexBulkKB > 0 {
+		batch = &elasticsearch.DocumentBatch{}
+	}
+	return batch
+}
+
+// recordDuplicates lists every location of each duplicated declaration on
+// its indexed copy. Failures are logged; the copy stays searchable without
+// the extra locations.
+func (idx *Indexer) recordDuplicates(ctx context.Context, es *elasticsearch.Client, repoName string, groups []duplicateGroup) {
+	if len(groups) == 0 {
+		return
+	}
+
+	err := es.Refresh(ctx)
+	if err != nil {
+		idx.logger.Warn("Failed to record duplicate locations", "repo", repoName, "error", err)
+		return
+	}
+
+	skipped := 0
+	for _, group := range groups {
+		skipped += len(group.locations) - 1
+		err = es.SetLocations(ctx, group.canonical, group.locations)
+		if err != nil {
+			idx.logger.Warn("Failed to record duplicate locations", "repo", repoName, "file", group.canonical.FilePath, "name", group.canonical.FunctionName, "error", err)
+		}
+	}
+
+	idx.logger.Info("Deduplicated identical declarations", "repo", repoName, "declarations", len(groups), "copies_skipped", skipped)
+}
+
+// vetRepo runs go vet over the repository when the govet check is enabled.
+// Failures are logged and leave functions without vet findings.
+func (idx *Indexer) vetRepo(ctx context.Context, repoName string, repoPath string) (findings map[string][]lint.Finding) {
+	if !idx.linter.Enabled(lint.CheckGovet) {
+		return findings
+	}
+
+	var err error
+	findings, err = lint.VetRepo(ctx, repoPath)
+	if err != nil {
+		idx.logger.Warn("Failed to run go vet", "repo", repoName, "error", err)
+	}
+
+	return findings
+}
+
+// ParseFailures returns files that failed to parse in the latest run of each
+// repository. An empty repo returns failures for all repositories.
+func (idx *Indexer) ParseFailures(repo string) (failures []ParseFailure) {
+	failures = idx.quarantine.list(repo)
+	return failures
+}
+
 // RunIndexingLoop runs periodic reindexing in the background.
 func (idx *Indexer) RunIndexingLoop(ctx context.Context) {
 	ticker := time.NewTicker(idx.config.IndexInterval)
@@ -182,9 +780,20 @@ func (idx *Indexer) RunIndexingLoop(ctx context.Context) {
 	for {
 		select {
 		case <-ticker.C:
+			if idx.Draining() {
+				idx.logger.Info("Shutting down, skipping periodic reindex")
+				continue
+			}
+
+			pauseStatus := idx.pause.status()
+			if pauseStatus.Paused {
+				idx.logger.Info("Indexing paused, skipping periodic reindex", "manual", pauseStatus.Manual, "auto_reason", pauseStatus.AutoReason)
+				continue
+			}
+
 			idx.logger.Info("Running periodic reindex")
 
-			if idx.config.GitOrg != "" && len(idx.config.GitRepos) > 0 {
+			if idx.config.Cloning() {
 				repoErr := idx.CloneRepos(ctx)
 				if repoErr != nil {
 					idx.logger.Error("Error updating repos", "error", repoErr)
@@ -0,0 +1,186 @@
+package indexer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRebuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxDocs     int
+		wantErr     bool
+		wantSwapped bool
+		wantDeleted bool
+	}{
+		{name: "alias swapped after every repository indexes", maxDocs: 100, wantSwapped: true},
+		{name: "generation deleted when a repository fails", maxDocs: 1, wantErr: true, wantDeleted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				mu.Unlock()
+
+				// Nothing exists yet: no generations, and no alias or index
+				// named code-index.
+				if r.Method == http.MethodHead || strings.HasPrefix(r.URL.Path, "/_alias/") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			reposPath := t.TempDir()
+			repo := filepath.Join(reposPath, "service")
+			err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755)
+			if err != nil {
+				t.Fatalf("failed to create repo: %v", err)
+			}
+			err = os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc A() {}\n\nfunc B() {}\n"), 0o600)
+			if err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			cfg := config.Config{
+				ESHost:             srv.URL,
+				ESIndex:            "code-index",
+				ESGenerationFormat: "2006-01-02-150405",
+				ESGenerationsKept:  2,
+				ReposPath:          reposPath,
+				Languages:          []string{"go"},
+				MaxDocsPerRepo:     tt.maxDocs,
+			}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, err := elasticsearch.NewClient(cfg, m)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+			job, err := idx.jobs.create(ReindexOptions{Rebuild: true})
+			if err != nil {
+				t.Fatalf("create() error = %v", err)
+			}
+			_, err = idx.indexAllRepos(t.Context(), job.ID, ReindexOptions{Rebuild: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("indexAllRepos() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			job, _ = idx.Job(job.ID)
+			generation := "/" + job.Index
+			if !strings.HasPrefix(job.Index, "code-index-") {
+				t.Fatalf("job index = %q, want a code-index generation", job.Index)
+			}
+
+			var wroteGeneration, wroteLive, swapped, deleted bool
+			for _, request := range requests {
+				switch request {
+				case "POST " + generation + "/_doc":
+					wroteGeneration = true
+				case "POST /code-index/_doc":
+					wroteLive = true
+				case "POST /_aliases":
+					swapped = true
+				case "DELETE " + generation:
+					deleted = true
+				}
+			}
+			if !wroteGeneration || wroteLive {
+				t.Errorf("documents written to the generation %v, to the live index %v; want only the generation", wroteGeneration, wroteLive)
+			}
+			if swapped != tt.wantSwapped || deleted != tt.wantDeleted {
+				t.Errorf("alias swapped %v, generation deleted %v, want %v, %v: %v", swapped, deleted, tt.wantSwapped, tt.wantDeleted, requests)
+			}
+		})
+	}
+}
+
+func TestIndexPath(t *testing.T) {
+	var mu sync.Mutex
+	var repos []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_doc") {
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			mu.Lock()
+			repos = append(repos, doc.Repo)
+			mu.Unlock()
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	workspace := filepath.Join(t.TempDir(), "workspace")
+	err := os.MkdirAll(filepath.Join(workspace, "pkg"), 0o750)
+	if err != nil {
+		t.Fatalf("failed to create workspace: %v", err)
+	}
+	for name, content := range map[string]string{
+		"main.go":     "package main\n\nfunc main() {}\n",
+		"pkg/util.go": "package pkg\n\nfunc Util() {}\n",
+	} {
+		err = os.WriteFile(filepath.Join(workspace, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		dir       string
+		repoName  string
+		wantRepo  string
+		wantCount int
+		wantErr   bool
+	}{
+		{name: "named", dir: workspace, repoName: "myproject", wantRepo: "myproject", wantCount: 2},
+		{name: "directory name", dir: workspace, wantRepo: "workspace", wantCount: 2},
+		{name: "missing", dir: filepath.Join(workspace, "missing"), wantErr: true},
+		{name: "file", dir: filepath.Join(workspace, "main.go"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos = nil
+			cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", Languages: []string{"go"}}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, clientErr := elasticsearch.NewClient(cfg, m)
+			if clientErr != nil {
+				t.Fatalf("NewClient() error = %v", clientErr)
+			}
+			idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+			count, indexErr := idx.IndexPath(t.Context(), tt.dir, tt.repoName)
+			if (indexErr != nil) != tt.wantErr {
+				t.Fatalf("IndexPath() error = %v, wantErr %v", indexErr, tt.wantErr)
+			}
+			if count != tt.wantCount {
+				t.Errorf("IndexPath() = %d, want %d", count, tt.wantCount)
+			}
+			for _, repo := range repos {
+				if repo != tt.wantRepo {
+					t.Errorf("document repo = %q, want %q", repo, tt.wantRepo)
+				}
+			}
+		})
+	}
+}
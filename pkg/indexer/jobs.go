@@ -0,0 +1,391 @@
+package indexer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxRetainedJobs bounds how many finished jobs are kept for status lookups.
+const maxRetainedJobs = 50
+
+// maxJobFailedFiles bounds the failures listed per repository in a job's
+// status; the per-class counts cover the rest.
+const maxJobFailedFiles = 20
+
+// ErrReindexInProgress is returned when a reindex job is already queued or running.
+var ErrReindexInProgress = errors.New("reindex already in progress")
+
+// JobState is the lifecycle state of a reindex job or of one repository within it.
+type JobState string
+
+// Job and repository states.
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobCompleted JobState = "completed"
+	JobFailed    JobState = "failed"
+)
+
+// RepoProgress tracks a single repository within a reindex job. While it
+// runs, FilesProcessed, FilesTotal, FunctionsIndexed, and ETASeconds are
+// updated every PROGRESS_INTERVAL. Errors counts the files and documents
+// that failed by class, and FailedFiles lists the first of them. In a dry
+// run, Diff is what the run would change in the index.
+type RepoProgress struct {
+	Repo             string         `json:"repo"`
+	State            JobState       `json:"state"`
+	FunctionsIndexed int            `json:"functions_indexed"`
+	FilesProcessed   int            `json:"files_processed,omitempty"`
+	FilesTotal       int            `json:"files_total,omitempty"`
+	ETASeconds       int            `json:"eta_seconds,omitempty"`
+	Error            string         `json:"error,omitempty"`
+	Errors           map[string]int `json:"errors,omitempty"`
+	FailedFiles      []ParseFailure `json:"failed_files,omitempty"`
+	Diff             *DocumentDiff  `json:"diff,omitempty"`
+}
+
+// Job describes a reindex run triggered through the API.
+type Job struct {
+	ID               string         `json:"id"`
+	State            JobState       `json:"state"`
+	FunctionsIndexed int            `json:"functions_indexed"`
+	Repos            []RepoProgress `json:"repos"`
+	Rebuild          bool           `json:"rebuild,omitempty"`
+	DryRun           bool           `json:"dry_run,omitempty"`
+	Index            string         `json:"index,omitempty"`
+	Error            string         `json:"error,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+	StartedAt        *time.Time     `json:"started_at,omitempty"`
+	FinishedAt       *time.Time     `json:"finished_at,omitempty"`
+}
+
+// jobTracker records reindex jobs and ensures only one is active at a time.
+// Methods called with an empty job ID are no-ops so untracked runs can share
+// the same code path. Subscribers receive the progress events of a job until
+// it finishes.
+type jobTracker struct {
+	mu          sync.Mutex
+	jobs        map[string]*Job
+	order       []string
+	active      string
+	subscribers map[string][]chan ProgressEvent
+}
+
+// newJobTracker creates an empty job tracker.
+func newJobTracker() (tracker *jobTracker) {
+	tracker = &jobTracker{
+		jobs:        make(map[string]*Job),
+		subscribers: make(map[string][]chan ProgressEvent),
+	}
+	return tracker
+}
+
+// create registers a new queued job, failing if another job is still active.
+func (jt *jobTracker) create(opts ReindexOptions) (job Job, err error) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	if jt.active != "" {
+		job = jt.jobs[jt.active].snapshot()
+		err = ErrReindexInProgress
+		return job, err
+	}
+
+	var id string
+	id, err = newJobID()
+	if err != nil {
+		return job, err
+	}
+
+	created := &Job{
+		ID:        id,
+		State:     JobQueued,
+		Repos:     []RepoProgress{},
+		Rebuild:   opts.Rebuild,
+		DryRun:    opts.DryRun,
+		CreatedAt: time.Now(),
+	}
+
+	jt.jobs[id] = created
+	jt.order = append(jt.order, id)
+	jt.active = id
+	jt.prune()
+
+	job = created.snapshot()
+	return job, err
+}
+
+// get returns a copy of the job with the given ID.
+func (jt *jobTracker) get(id string) (job Job, found bool) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	stored, found := jt.jobs[id]
+	if !found {
+		return job, found
+	}
+
+	job = stored.snapshot()
+	return job, found
+}
+
+// start marks the job running with the repositories it is about to index.
+func (jt *jobTracker) start(id string, repos []string) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	job, found := jt.jobs[id]
+	if !found {
+		return
+	}
+
+	now := time.Now()
+	job.State = JobRunning
+	job.StartedAt = &now
+	for _, repo := range repos {
+		job.Repos = append(job.Repos, RepoProgress{Repo: repo, State: JobQueued})
+	}
+}
+
+// setIndex records the index generation a rebuild job writes to.
+func (jt *jobTracker) setIndex(id string, index string) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	job, found := jt.jobs[id]
+	if found {
+		job.Index = index
+	}
+}
+
+// repoStarted marks a repository within the job as running.
+func (jt *jobTracker) repoStarted(id string, repo string) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	progress := jt.repoProgress(id, repo)
+	if progress != nil {
+		progress.State = JobRunning
+	}
+}
+
+// repoFinished records the outcome of indexing a repository within the job.
+func (jt *jobTracker) repoFinished(id string, repo string, count int, repoErr error) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	progress := jt.repoProgress(id, repo)
+	if progress == nil {
+		return
+	}
+
+	progress.FunctionsIndexed = count
+	if repoErr != nil {
+		progress.State = JobFailed
+		progress.Error = repoErr.Error()
+		return
+	}
+
+	progress.State = JobCompleted
+	jt.jobs[id].FunctionsIndexed += count
+}
+
+// repoFailures records the files and documents of a repository within the
+// job that failed to parse or index.
+func (jt *jobTracker) repoFailures(id string, repo string, failures []ParseFailure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	progress := jt.repoProgress(id, repo)
+	if progress == nil {
+		return
+	}
+
+	progress.Errors = make(map[string]int)
+	for _, failure := range failures {
+		progress.Errors[failure.Class]++
+	}
+	progress.FailedFiles = failures[:min(len(failures), maxJobFailedFiles)]
+}
+
+// progress records a repository's progress on the active job, when that job
+// is running the repository, and sends it to the job's subscribers. Progress
+// of an untracked run is ignored.
+func (jt *jobTracker) progress(event ProgressEvent) {
+	if jt == nil {
+		return
+	}
+
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	job, found := jt.jobs[jt.active]
+	if !found || job.State != JobRunning {
+		return
+	}
+	progress := jt.repoProgress(job.ID, event.Repo)
+	if progress == nil || progress.State != JobRunning {
+		return
+	}
+
+	progress.FilesProcessed = event.FilesProcessed
+	progress.FilesTotal = event.FilesTotal
+	progress.FunctionsIndexed = event.FunctionsIndexed
+	progress.ETASeconds = event.ETASeconds
+
+	event.Job = job.ID
+	for _, events := range jt.subscribers[job.ID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel receiving the job's progress events, closed
+// when the job finishes, and a function to stop receiving them. A subscriber
+// that falls behind misses events rather than holding up the run. The
+// channel of a finished job is closed at once.
+func (jt *jobTracker) subscribe(id string) (events <-chan ProgressEvent, unsubscribe func(), found bool) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	job, found := jt.jobs[id]
+	if !found {
+		return events, unsubscribe, found
+	}
+
+	subscription := make(chan ProgressEvent, progressSubscriberBuffer)
+	events = subscription
+	unsubscribe = func() {
+		jt.mu.Lock()
+		defer jt.mu.Unlock()
+
+		jt.subscribers[id] = slices.DeleteFunc(jt.subscribers[id], func(c chan ProgressEvent) (match bool) {
+			match = c == subscription
+			return match
+		})
+		if len(jt.subscribers[id]) == 0 {
+			delete(jt.subscribers, id)
+		}
+	}
+
+	if job.FinishedAt != nil {
+		close(subscription)
+		return events, unsubscribe, found
+	}
+	jt.subscribers[id] = append(jt.subscribers[id], subscription)
+	return events, unsubscribe, found
+}
+
+// repoDiff records what a dry run of a repository within the job would
+// change in the index.
+func (jt *jobTracker) repoDiff(id string, repo string, diff DocumentDiff) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	progress := jt.repoProgress(id, repo)
+	if progress != nil {
+		progress.Diff = &diff
+	}
+}
+
+// finish records the final outcome of the job and releases the active slot.
+// The job fails if the run failed or any repository failed.
+func (jt *jobTracker) finish(id string, runErr error) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	job, found := jt.jobs[id]
+	if !found {
+		return
+	}
+
+	now := time.Now()
+	job.FinishedAt = &now
+	job.State = JobCompleted
+
+	failedRepos := 0
+	for _, progress := range job.Repos {
+		if progress.State == JobFailed {
+			failedRepos++
+		}
+	}
+
+	switch {
+	case runErr != nil:
+		job.State = JobFailed
+		job.Error = runErr.Error()
+	case failedRepos > 0:
+		job.State = JobFailed
+		job.Error = fmt.Sprintf("%d of %d repositories failed", failedRepos, len(job.Repos))
+	}
+
+	if jt.active == id {
+		jt.active = ""
+	}
+
+	for _, events := range jt.subscribers[id] {
+		close(events)
+	}
+	delete(jt.subscribers, id)
+}
+
+// repoProgress finds a repository's progress entry. Callers must hold jt.mu.
+func (jt *jobTracker) repoProgress(id string, repo string) (progress *RepoProgress) {
+	job, found := jt.jobs[id]
+	if !found {
+		return progress
+	}
+
+	for i := range job.Repos {
+		if job.Repos[i].Repo == repo {
+			progress = &job.Repos[i]
+			return progress
+		}
+	}
+
+	return progress
+}
+
+// prune drops the oldest finished jobs beyond maxRetainedJobs. Callers must hold jt.mu.
+func (jt *jobTracker) prune() {
+	for len(jt.order) > maxRetainedJobs {
+		oldest := jt.order[0]
+		if oldest == jt.active {
+			return
+		}
+		delete(jt.jobs, oldest)
+		jt.order = jt.order[1:]
+	}
+}
+
+// snapshot returns a copy of the job that is safe to use without the lock.
+// A repository's failures are set once and never changed, so they're shared.
+func (j *Job) snapshot() (job Job) {
+	job = *j
+	job.Repos = append([]RepoProgress{}, j.Repos...)
+	return job
+}
+
+// newJobID returns a random hex job identifier.
+func newJobID() (id string, err error) {
+	buf := make([]byte, 8)
+	_, err = rand.Read(buf)
+	if err != nil {
+		err = fmt.Errorf("failed to generate job ID: %w", err)
+		return id, err
+	}
+
+	id = hex.EncodeToString(buf)
+	return id, err
+}
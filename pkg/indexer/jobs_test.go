@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestJobTrackerLifecycle(t *testing.T) {
+	tracker := newJobTracker()
+
+	job, err := tracker.create(ReindexOptions{})
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+	if job.State != JobQueued {
+		t.Errorf("State = %v, want %v", job.State, JobQueued)
+	}
+
+	active, err := tracker.create(ReindexOptions{})
+	if !errors.Is(err, ErrReindexInProgress) {
+		t.Errorf("create() error = %v, want %v", err, ErrReindexInProgress)
+	}
+	if active.ID != job.ID {
+		t.Errorf("active job ID = %v, want %v", active.ID, job.ID)
+	}
+
+	tracker.start(job.ID, []string{"repo-a", "repo-b"})
+	tracker.repoStarted(job.ID, "repo-a")
+
+	running, _ := tracker.get(job.ID)
+	if running.State != JobRunning {
+		t.Errorf("State = %v, want %v", running.State, JobRunning)
+	}
+	if running.Repos[0].State != JobRunning || running.Repos[1].State != JobQueued {
+		t.Errorf("Repo states = %v/%v, want running/queued", running.Repos[0].State, running.Repos[1].State)
+	}
+
+	tracker.repoFinished(job.ID, "repo-a", 10, nil)
+	tracker.repoStarted(job.ID, "repo-b")
+	tracker.repoFinished(job.ID, "repo-b", 5, nil)
+	tracker.finish(job.ID, nil)
+
+	done, found := tracker.get(job.ID)
+	if !found {
+		t.Fatal("Job not found")
+	}
+	if done.State != JobCompleted {
+		t.Errorf("State = %v, want %v", done.State, JobCompleted)
+	}
+	if done.FunctionsIndexed != 15 {
+		t.Errorf("FunctionsIndexed = %d, want 15", done.FunctionsIndexed)
+	}
+	if done.StartedAt == nil || done.FinishedAt == nil {
+		t.Error("StartedAt or FinishedAt not set")
+	}
+
+	_, err = tracker.create(ReindexOptions{})
+	if err != nil {
+		t.Errorf("create() after finish error = %v", err)
+	}
+}
+
+func TestJobTrackerRepoFailure(t *testing.T) {
+	tracker := newJobTracker()
+
+	job, err := tracker.create(ReindexOptions{})
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+
+	tracker.start(job.ID, []string{"repo-a", "repo-b"})
+	tracker.repoFinished(job.ID, "repo-a", 3, nil)
+	tracker.repoFinished(job.ID, "repo-b", 0, errors.New("walk failed"))
+	tracker.finish(job.ID, nil)
+
+	done, _ := tracker.get(job.ID)
+	if done.State != JobFailed {
+		t.Errorf("State = %v, want %v", done.State, JobFailed)
+	}
+	if done.Repos[1].Error != "walk failed" {
+		t.Errorf("Repo error = %q, want %q", done.Repos[1].Error, "walk failed")
+	}
+	if done.FunctionsIndexed != 3 {
+		t.Errorf("FunctionsIndexed = %d, want 3", done.FunctionsIndexed)
+	}
+}
+
+func TestJobTrackerRepoFailures(t *testing.T) {
+	tracker := newJobTracker()
+
+	job, err := tracker.create(ReindexOptions{})
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+	tracker.start(job.ID, []string{"repo-a"})
+
+	var failures []ParseFailure
+	for i := range maxJobFailedFiles + 5 {
+		class := parseErrorClassSyntax
+		if i%5 == 0 {
+			class = parseErrorClassESReject
+		}
+		failures = append(failures, ParseFailure{Repo: "repo-a", FilePath: fmt.Sprintf("f%d.go", i), Class: class})
+	}
+	tracker.repoFailures(job.ID, "repo-a", failures)
+	tracker.repoFinished(job.ID, "repo-a", 10, nil)
+
+	done, _ := tracker.get(job.ID)
+	progress := done.Repos[0]
+	if progress.Errors[parseErrorClassSyntax] != 20 || progress.Errors[parseErrorClassESReject] != 5 {
+		t.Errorf("Errors = %v, want 20 syntax and 5 es_reject", progress.Errors)
+	}
+	if len(progress.FailedFiles) != maxJobFailedFiles {
+		t.Errorf("FailedFiles = %d, want %d", len(progress.FailedFiles), maxJobFailedFiles)
+	}
+}
+
+func TestJobTrackerPrune(t *testing.T) {
+	tracker := newJobTracker()
+
+	var first string
+	for i := range maxRetainedJobs + 5 {
+		job, err := tracker.create(ReindexOptions{})
+		if err != nil {
+			t.Fatalf("create() error = %v", err)
+		}
+		if i == 0 {
+			first = job.ID
+		}
+		tracker.finish(job.ID, nil)
+	}
+
+	_, found := tracker.get(first)
+	if found {
+		t.Error("oldest job was not pruned")
+	}
+	if len(tracker.jobs) != maxRetainedJobs {
+		t.Errorf("retained jobs = %d, want %d", len(tracker.jobs), maxRetainedJobs)
+	}
+}
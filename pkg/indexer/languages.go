@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"path/filepath"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/lint"
+	"github.com/nikogura/rag-indexer/pkg/parser"
+)
+
+// languageGo is the Language name of the Go parser.
+const languageGo = "go"
+
+// goLanguage parses Go files with go/parser, linting each function with the
+// run's linter and the repository's go vet findings, and adding what
+// type-checking the repository resolved when INDEX_TYPES is set. Documents
+// with build constraints list which of platforms, from INDEX_PLATFORMS,
+// they build on.
+type goLanguage struct {
+	linter      *lint.Linter
+	vetFindings map[string][]lint.Finding
+	semantics   *semanticIndex
+	platforms   []string
+}
+
+// Name returns "go".
+func (g *goLanguage) Name() (name string) {
+	name = languageGo
+	return name
+}
+
+// Extensions returns the Go source extension.
+func (g *goLanguage) Extensions() (extensions []string) {
+	extensions = []string{".go"}
+	return extensions
+}
+
+// ParseFile extracts the file's declarations, recovering what it can from
+// files with syntax errors.
+func (g *goLanguage) ParseFile(path string, content []byte) (docs []elasticsearch.CodeDocument, err error) {
+	docs, err = parseGoFile(path, content, g.linter, g.vetFindingsFor(path))
+	g.semantics.enrich(path, docs)
+
+	var platforms []string
+	if len(docs) > 0 && docs[0].BuildConstraint != "" && len(g.platforms) > 0 {
+		platforms = buildPlatforms(docs[0].BuildConstraint, g.platforms)
+	}
+	for i := range docs {
+		docs[i].Language = languageGo
+		if docs[i].BuildConstraint != "" {
+			docs[i].Platforms = platforms
+		}
+	}
+	return docs, err
+}
+
+// vetFindingsFor returns the go vet findings for a file, which are keyed by
+// absolute path.
+func (g *goLanguage) vetFindingsFor(path string) (findings []lint.Finding) {
+	if len(g.vetFindings) == 0 {
+		return findings
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return findings
+	}
+
+	findings = g.vetFindings[absPath]
+	return findings
+}
+
+// languages builds the parsers for one index run from LANGUAGES, adding
+// Markdown when INDEX_MARKDOWN is set. Go files get the repository's vet
+// findings and resolved types, when there are any.
+func (idx *Indexer) languages(vetFindings map[string][]lint.Finding, semantics *semanticIndex) (registry *parser.Registry) {
+	var languages []parser.Language
+	for _, name := range idx.config.Languages {
+		switch name {
+		case languageGo:
+			languages = append(languages, &goLanguage{linter: idx.linter, vetFindings: vetFindings, semantics: semantics, platforms: idx.config.IndexPlatforms})
+		case parser.LanguagePython:
+			languages = append(languages, parser.Python{})
+		case parser.LanguageTypeScript:
+			languages = append(languages, parser.TypeScript{})
+		case parser.LanguageTerraform:
+			languages = append(languages, parser.Terraform{})
+		case parser.LanguageProtobuf:
+			languages = append(languages, parser.Protobuf{})
+		}
+	}
+
+	if idx.config.IndexMarkdown {
+		languages = append(languages, markdownLanguage{})
+	}
+
+	registry = parser.NewRegistry(languages...)
+	return registry
+}
@@ -0,0 +1,298 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// touchBatchFiles bounds how many files one request stamping unchanged
+// files' documents names.
+const touchBatchFiles = 1000
+
+// ManifestFile is a file indexed cleanly by a repository's latest run: the
+// hash of its content and how many documents it has in the index.
+type ManifestFile struct {
+	Hash      string `json:"hash"`
+	Documents int    `json:"documents"`
+}
+
+// RepoManifest lists the files of a repository's latest completed run, by
+// path relative to the repository root, with the settings they were
+// indexed with.
+type RepoManifest struct {
+	Settings string                  `json:"settings"`
+	Files    map[string]ManifestFile `json:"files"`
+}
+
+// manifestStore keeps each repository's manifest in a JSON file, so a run
+// can skip the files that haven't changed since the last one. A store
+// without a path keeps nothing.
+type manifestStore struct {
+	path  string
+	mu    sync.Mutex
+	repos map[string]RepoManifest
+}
+
+// openManifestStore loads the manifests saved at path. A missing file
+// starts empty; an unreadable one is logged and replaced on the next save.
+func openManifestStore(path string, logger logging.Logger) (store *manifestStore) {
+	store = &manifestStore{
+		path:  path,
+		repos: make(map[string]RepoManifest),
+	}
+	if path == "" {
+		return store
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &store.repos)
+	}
+	if err != nil {
+		logger.Warn("Failed to load file manifest, starting fresh", "path", path, "error", err)
+		store.repos = make(map[string]RepoManifest)
+	}
+	return store
+}
+
+// enabled reports whether the store keeps manifests.
+func (s *manifestStore) enabled() (enabled bool) {
+	enabled = s != nil && s.path != ""
+	return enabled
+}
+
+// get returns the repository's manifest.
+func (s *manifestStore) get(repo string) (manifest RepoManifest, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	manifest, found = s.repos[repo]
+	return manifest, found
+}
+
+// save records the repository's manifest and writes the store.
+func (s *manifestStore) save(repo string, manifest RepoManifest) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.repos[repo] = manifest
+	err = s.write()
+	return err
+}
+
+// forget drops the manifest of a deleted repository.
+func (s *manifestStore) forget(repo string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.repos[repo]; !found {
+		return err
+	}
+	delete(s.repos, repo)
+	err = s.write()
+	return err
+}
+
+// forgetFile drops a file from its repository's manifest, so the next run
+// indexes it again whatever its content.
+func (s *manifestStore) forgetFile(repo string, rel string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.repos[repo].Files[rel]; !found {
+		return err
+	}
+	delete(s.repos[repo].Files, rel)
+	err = s.write()
+	return err
+}
+
+// write replaces the manifest file. The caller holds s.mu.
+func (s *manifestStore) write() (err error) {
+	if s.path == "" {
+		return err
+	}
+
+	data, err := json.Marshal(s.repos)
+	if err != nil {
+		err = fmt.Errorf("failed to encode file manifest: %w", err)
+		return err
+	}
+
+	err = replaceFile(s.path, data)
+	if err != nil {
+		err = fmt.Errorf("failed to write file manifest: %w", err)
+	}
+	return err
+}
+
+// manifestSettings fingerprints the settings that shape the documents
+// indexed from a file, beyond its content. A manifest recorded under other
+// settings is ignored, so changing them reindexes everything.
+func manifestSettings(cfg config.Config) (settings string) {
+	data, _ := json.Marshal(struct {
+		Schema        int
+		Index         string
+		MaxSourceKB   int
+		ChunkMaxLines int
+		ChunkOverlap  int
+		Dedup         bool
+		Types         bool
+		Platforms     []string
+		Lint          []string
+		Enrich        []string
+		Embedding     string
+		Summary       string
+	}{
+		Schema:        elasticsearch.SchemaVersion,
+		Index:         cfg.ESIndex,
+		MaxSourceKB:   cfg.MaxSourceKB,
+		ChunkMaxLines: cfg.ChunkMaxLines,
+		ChunkOverlap:  cfg.ChunkOverlapLines,
+		Dedup:         cfg.DedupIdentical,
+		Types:         cfg.IndexTypes,
+		Platforms:     cfg.IndexPlatforms,
+		Lint:          cfg.LintChecks,
+		Enrich:        cfg.EnrichCommand,
+		Embedding:     cfg.EmbeddingURL + " " + cfg.EmbeddingModel,
+		Summary:       cfg.SummaryURL + " " + cfg.SummaryModel,
+	})
+	settings = contentHash(data)
+	return settings
+}
+
+// manifestRun compares a walk's files with the previous run's manifest and
+// records the files it indexes cleanly for the next one. A nil manifestRun
+// skips nothing, for runs that don't keep a manifest.
+type manifestRun struct {
+	previous       map[string]ManifestFile
+	current        RepoManifest
+	unchangedFiles []unchangedFile
+	unchangedDocs  int
+}
+
+// unchangedFile is a file a run skipped, by its path relative to the
+// repository root and the path its documents record.
+type unchangedFile struct {
+	rel      string
+	filePath string
+}
+
+// newManifestRun starts comparing against the previous manifest when it
+// was recorded under the same settings.
+func newManifestRun(previous RepoManifest, settings string) (run *manifestRun) {
+	run = &manifestRun{current: RepoManifest{Settings: settings, Files: make(map[string]ManifestFile)}}
+	if previous.Settings == settings {
+		run.previous = previous.Files
+	}
+	return run
+}
+
+// unchanged reports whether a file has the content it had when the previous
+// run indexed it, carrying it over to the new manifest when it does, and
+// how many documents it has.
+func (r *manifestRun) unchanged(rel string, filePath string, hash string) (documents int, unchanged bool) {
+	if r == nil {
+		return documents, unchanged
+	}
+
+	file, found := r.previous[rel]
+	if !found || file.Hash != hash {
+		return documents, unchanged
+	}
+
+	r.current.Files[rel] = file
+	r.unchangedFiles = append(r.unchangedFiles, unchangedFile{rel: rel, filePath: filePath})
+	r.unchangedDocs += file.Documents
+	documents = file.Documents
+	unchanged = true
+	return documents, unchanged
+}
+
+// record adds a file indexed cleanly to the new manifest.
+func (r *manifestRun) record(rel string, hash string, documents int) {
+	if r == nil {
+		return
+	}
+
+	r.current.Files[rel] = ManifestFile{Hash: hash, Documents: documents}
+}
+
+// startManifest returns what a repository's run into the live index compares
+// its files with, or nil without MANIFEST_FILE. The previous manifest is
+// only trusted while the index holds at least as many of the repository's
+// documents as it lists, so an index wiped or restored from an older export
+// is filled in again.
+func (idx *Indexer) startManifest(ctx context.Context, repo string) (run *manifestRun) {
+	if !idx.manifests.enabled() {
+		return run
+	}
+
+	settings := manifestSettings(idx.config)
+	previous, found := idx.manifests.get(repo)
+	if found && previous.Settings == settings {
+		listed := 0
+		for _, file := range previous.Files {
+			listed += file.Documents
+		}
+		counts, err := idx.es.RepoDocumentCounts(ctx)
+		if err != nil || counts[repo] < int64(listed) {
+			idx.logger.Warn("Index doesn't hold the documents the file manifest lists, indexing every file", "repo", repo, "listed", listed, "indexed", counts[repo], "error", err)
+			previous = RepoManifest{}
+		}
+	}
+
+	run = newManifestRun(previous, settings)
+	return run
+}
+
+// finishManifest saves a completed run's manifest: the files it indexed
+// cleanly and those it found unchanged. Files deleted since the previous run
+// drop out. With RETENTION_DAYS, the unchanged files' documents are stamped
+// as indexed now, at the run's commit, so they aren't pruned as stale; files
+// whose documents couldn't be stamped are left out, to be indexed again.
+func (idx *Indexer) finishManifest(ctx context.Context, repo string, commit string, run *manifestRun) {
+	if run == nil {
+		return
+	}
+
+	if len(run.unchangedFiles) > 0 {
+		idx.logger.Info("Skipped unchanged files", "repo", repo, "files", len(run.unchangedFiles), "documents", run.unchangedDocs)
+	}
+
+	if idx.config.Retention() > 0 {
+		now := time.Now()
+		for batch := range slices.Chunk(run.unchangedFiles, touchBatchFiles) {
+			filePaths := make([]string, 0, len(batch))
+			for _, file := range batch {
+				filePaths = append(filePaths, file.filePath)
+			}
+
+			_, err := idx.es.TouchFileDocuments(ctx, repo, filePaths, commit, now)
+			if err != nil {
+				idx.logger.Warn("Failed to stamp unchanged files as indexed", "repo", repo, "files", len(batch), "error", err)
+				for _, file := range batch {
+					delete(run.current.Files, file.rel)
+				}
+			}
+		}
+	}
+
+	err := idx.manifests.save(repo, run.current)
+	if err != nil {
+		idx.logger.Warn("Failed to save file manifest", "repo", repo, "error", err)
+	}
+}
@@ -0,0 +1,173 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestManifestStoreReload(t *testing.T) {
+	logger := logging.New(slog.New(slog.DiscardHandler))
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	store := openManifestStore(path, logger)
+	err := store.save("api", RepoManifest{Settings: "s1", Files: map[string]ManifestFile{
+		"main.go":       {Hash: "aaa", Documents: 3},
+		"pkg/server.go": {Hash: "bbb", Documents: 5},
+	}})
+	if err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	err = store.save("web", RepoManifest{Settings: "s1"})
+	if err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	err = store.forget("web")
+	if err != nil {
+		t.Fatalf("forget() error = %v", err)
+	}
+	err = store.forgetFile("api", "main.go")
+	if err != nil {
+		t.Fatalf("forgetFile() error = %v", err)
+	}
+
+	reloaded := openManifestStore(path, logger)
+	got, found := reloaded.get("api")
+	want := map[string]ManifestFile{"pkg/server.go": {Hash: "bbb", Documents: 5}}
+	if !found || got.Settings != "s1" || len(got.Files) != 1 || got.Files["pkg/server.go"] != want["pkg/server.go"] {
+		t.Errorf("get(api) = %+v, %v after reload, want %v", got, found, want)
+	}
+	if _, found = reloaded.get("web"); found {
+		t.Error("get(web) found a forgotten manifest")
+	}
+	if openManifestStore("", logger).enabled() {
+		t.Error("a store without a path is enabled")
+	}
+}
+
+func TestNewManifestRun(t *testing.T) {
+	previous := RepoManifest{Settings: "s1", Files: map[string]ManifestFile{"a.go": {Hash: "aaa", Documents: 2}}}
+
+	run := newManifestRun(previous, "s1")
+	if _, unchanged := run.unchanged("a.go", "/repos/api/a.go", "changed"); unchanged {
+		t.Error("a file with new content is unchanged")
+	}
+	documents, unchanged := run.unchanged("a.go", "/repos/api/a.go", "aaa")
+	if !unchanged || documents != 2 || run.current.Files["a.go"].Documents != 2 {
+		t.Errorf("unchanged() = %d, %v, want 2 documents carried over", documents, unchanged)
+	}
+
+	if _, unchanged = newManifestRun(previous, "s2").unchanged("a.go", "/repos/api/a.go", "aaa"); unchanged {
+		t.Error("a file recorded under other settings is unchanged")
+	}
+
+	var none *manifestRun
+	if _, unchanged = none.unchanged("a.go", "/repos/api/a.go", "aaa"); unchanged {
+		t.Error("a nil run skipped a file")
+	}
+	none.record("a.go", "aaa", 2)
+}
+
+func TestSkipUnchangedFiles(t *testing.T) {
+	var mu sync.Mutex
+	var indexed, touched []string
+	repoDocs := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_doc"):
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			indexed = append(indexed, filepath.Base(doc.FilePath))
+		case strings.HasSuffix(r.URL.Path, "/_update_by_query"):
+			var body struct {
+				Query struct {
+					Bool struct {
+						Filter []map[string]map[string][]string `json:"filter"`
+					} `json:"bool"`
+				} `json:"query"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			for _, filePath := range body.Query.Bool.Filter[1]["terms"]["file_path"] {
+				touched = append(touched, filepath.Base(filePath))
+			}
+		case strings.HasSuffix(r.URL.Path, "/_search"):
+			_, _ = fmt.Fprintf(w, `{"aggregations":{"repos":{"buckets":[{"key":"api","doc_count":%d}]}}}`, repoDocs)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	repo := t.TempDir()
+	writeFile := func(name string, content string) {
+		err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	writeFile("a.go", "package main\n\nfunc A() {}\n")
+	writeFile("b.go", "package main\n\nfunc B() {}\n\nfunc B2() {}\n")
+	writeFile("c.go", "package main\n\nfunc C() {}\n")
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", Languages: []string{"go"}, ManifestFile: manifestPath, RetentionDays: 30}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	run := func() (count int) {
+		indexed, touched = nil, nil
+		count, err = idx.indexRepository(t.Context(), es, "api", repo)
+		if err != nil {
+			t.Fatalf("indexRepository() error = %v", err)
+		}
+		slices.Sort(indexed)
+		slices.Sort(touched)
+		return count
+	}
+
+	count := run()
+	if !slices.Equal(indexed, []string{"a.go", "b.go", "b.go", "c.go"}) || count != 4 || touched != nil {
+		t.Errorf("first run indexed %v for %d documents and touched %v, want every file", indexed, count, touched)
+	}
+
+	repoDocs = 4
+	writeFile("b.go", "package main\n\nfunc B() { println() }\n")
+	err = os.Remove(filepath.Join(repo, "c.go"))
+	if err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	count = run()
+	if !slices.Equal(indexed, []string{"b.go"}) || count != 2 || !slices.Equal(touched, []string{"a.go"}) {
+		t.Errorf("second run indexed %v for %d documents and touched %v, want b.go indexed and a.go touched", indexed, count, touched)
+	}
+	manifest, _ := openManifestStore(manifestPath, idx.logger).get("api")
+	if len(manifest.Files) != 2 || manifest.Files["b.go"].Documents != 1 {
+		t.Errorf("saved manifest = %+v, want a.go and b.go with one document", manifest.Files)
+	}
+
+	repoDocs = 1
+	run()
+	if !slices.Equal(indexed, []string{"a.go", "b.go"}) {
+		t.Errorf("run against an index missing documents indexed %v, want every file", indexed)
+	}
+}
@@ -0,0 +1,174 @@
+package indexer
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// languageMarkdown is the Language name of the Markdown parser.
+const languageMarkdown = "markdown"
+
+// markdownLanguage splits Markdown files into sections at their headings,
+// each indexed as a document with DocTypeMarkdown.
+type markdownLanguage struct{}
+
+// Name returns "markdown".
+func (markdownLanguage) Name() (name string) {
+	name = languageMarkdown
+	return name
+}
+
+// Extensions returns the Markdown file extensions.
+func (markdownLanguage) Extensions() (extensions []string) {
+	extensions = []string{".md", ".markdown"}
+	return extensions
+}
+
+// markdownSection is the text under one heading, up to the next heading of
+// any level. Title is the path of headings leading to it, such as
+// "Deployment > Troubleshooting".
+type markdownSection struct {
+	title     string
+	body      string
+	startLine int
+	endLine   int
+}
+
+// ParseFile returns a document for each section with content. Sections go
+// through the same chunking, deduplication, and document limit as code.
+func (markdownLanguage) ParseFile(path string, content []byte) (docs []elasticsearch.CodeDocument, err error) {
+	for _, section := range markdownSections(string(content), filepath.Base(path)) {
+		docs = append(docs, elasticsearch.CodeDocument{
+			FilePath:     path,
+			DocType:      elasticsearch.DocTypeMarkdown,
+			Kind:         elasticsearch.KindSection,
+			FunctionName: section.title,
+			StartLine:    section.startLine,
+			EndLine:      section.endLine,
+			Code:         section.body,
+			ContentHash:  contentHash([]byte(sectionContent(section.body))),
+			IndexedAt:    time.Now(),
+		})
+	}
+	return docs, err
+}
+
+// markdownSections splits a document at its ATX headings ("# Title" through
+// "###### Title"), ignoring lines inside fenced code blocks. Text before the
+// first heading is titled with the file name. Sections with nothing but a
+// heading are skipped, since their text lives in their subsections.
+func markdownSections(content string, fileName string) (sections []markdownSection) {
+	lines := strings.SplitAfter(content, "\n")
+
+	var headings []string
+	current := markdownSection{title: fileName, startLine: 1}
+	var body []string
+	fence := ""
+
+	flush := func(endLine int) {
+		current.endLine = endLine
+		current.body = strings.Join(body, "")
+		if strings.TrimSpace(sectionContent(current.body)) != "" {
+			sections = append(sections, current)
+		}
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			body = append(body, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			body = append(body, line)
+			continue
+		}
+
+		level, text := markdownHeading(line)
+		if level == 0 {
+			body = append(body, line)
+			continue
+		}
+
+		flush(i)
+		if len(headings) >= level {
+			headings = headings[:level-1]
+		}
+		for len(headings) < level-1 {
+			headings = append(headings, "")
+		}
+		headings = append(headings, text)
+
+		current = markdownSection{title: headingPath(headings), startLine: i + 1}
+		body = []string{line}
+	}
+
+	lastLine := len(lines)
+	if strings.HasSuffix(content, "\n") {
+		lastLine--
+	}
+	flush(lastLine)
+
+	return sections
+}
+
+// markdownHeading returns the level and text of an ATX heading line, or a
+// level of zero when the line isn't one.
+func markdownHeading(line string) (level int, text string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "    ") {
+		return level, text
+	}
+	line = strings.TrimLeft(line, " ")
+
+	hashes := len(line) - len(strings.TrimLeft(line, "#"))
+	if hashes == 0 || hashes > 6 {
+		return level, text
+	}
+	rest := line[hashes:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return level, text
+	}
+
+	// A closing run of #s is dropped only when set off by a space, so
+	// "# C#" keeps its title.
+	level = hashes
+	text = strings.TrimSpace(rest)
+	closed := strings.TrimRight(text, "#")
+	if closed == "" || strings.HasSuffix(closed, " ") {
+		text = strings.TrimSpace(closed)
+	}
+	return level, text
+}
+
+// headingPath joins the non-empty headings leading to a section.
+func headingPath(headings []string) (title string) {
+	var parts []string
+	for _, heading := range headings {
+		if heading != "" {
+			parts = append(parts, heading)
+		}
+	}
+	title = strings.Join(parts, " > ")
+	return title
+}
+
+// sectionContent drops a section's heading line, so a section keeps its
+// content hash when only its title changes.
+func sectionContent(body string) (content string) {
+	content = body
+	level, _ := markdownHeading(body)
+	if level == 0 {
+		return content
+	}
+
+	_, content, _ = strings.Cut(body, "\n")
+	return content
+}
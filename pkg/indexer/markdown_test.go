@@ -0,0 +1,117 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestMarkdownSections(t *testing.T) {
+	type section struct {
+		title     string
+		startLine int
+		endLine   int
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []section
+	}{
+		{
+			name:    "no headings",
+			content: "Just some notes.\nMore notes.\n",
+			want:    []section{{title: "NOTES.md", startLine: 1, endLine: 2}},
+		},
+		{
+			name: "nested headings with preamble",
+			content: `Intro text.
+
+# Design
+
+Overview.
+
+## Storage
+
+Uses Elasticsearch.
+
+### Mapping ###
+
+Keyword fields.
+
+## API
+
+REST.
+`,
+			want: []section{
+				{title: "NOTES.md", startLine: 1, endLine: 2},
+				{title: "Design", startLine: 3, endLine: 6},
+				{title: "Design > Storage", startLine: 7, endLine: 10},
+				{title: "Design > Storage > Mapping", startLine: 11, endLine: 14},
+				{title: "Design > API", startLine: 15, endLine: 17},
+			},
+		},
+		{
+			name: "heading-only sections and fenced code",
+			content: `# Runbook
+## Restart
+
+` + "```bash" + `
+# not a heading
+kubectl rollout restart deploy/indexer
+` + "```" + `
+#hashtag is not a heading
+# C#
+Notes.`,
+			want: []section{
+				{title: "Runbook > Restart", startLine: 2, endLine: 8},
+				{title: "C#", startLine: 9, endLine: 10},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := markdownSections(tt.content, "NOTES.md")
+			if len(got) != len(tt.want) {
+				t.Fatalf("markdownSections() = %d sections %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got[i].title != want.title || got[i].startLine != want.startLine || got[i].endLine != want.endLine {
+					t.Errorf("section %d = %q lines %d-%d, want %q lines %d-%d",
+						i, got[i].title, got[i].startLine, got[i].endLine, want.title, want.startLine, want.endLine)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexMarkdownFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "DESIGN.md")
+	err := os.WriteFile(path, []byte("# Design\n\nOverview.\n\n## Storage\n\nUses Elasticsearch.\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	fw, docs := newTestWalker(t, "docs-repo")
+	count, err := fw.indexFile(path)
+	if err != nil {
+		t.Fatalf("indexFile() error = %v", err)
+	}
+	if count != 2 || len(*docs) != 2 {
+		t.Fatalf("indexFile() = %d documents, sent %d, want 2", count, len(*docs))
+	}
+
+	doc := (*docs)[1]
+	if doc.DocType != elasticsearch.DocTypeMarkdown || doc.Kind != elasticsearch.KindSection {
+		t.Errorf("doc_type, kind = %q, %q, want markdown, section", doc.DocType, doc.Kind)
+	}
+	if doc.FunctionName != "Design > Storage" || doc.StartLine != 5 || doc.EndLine != 7 {
+		t.Errorf("section = %q lines %d-%d, want \"Design > Storage\" lines 5-7", doc.FunctionName, doc.StartLine, doc.EndLine)
+	}
+	if doc.ContentHash != contentHash([]byte("\nUses Elasticsearch.\n")) {
+		t.Error("content hash includes the heading")
+	}
+}
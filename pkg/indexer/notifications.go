@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"sync"
+	"time"
+)
+
+// notificationSubscriberBuffer is how many notifications a subscriber can
+// have waiting before it is disconnected for falling behind.
+const notificationSubscriberBuffer = 64
+
+// Notification types.
+const (
+	// NotificationRepoIndexed is sent when a repository's run into the live
+	// index completes.
+	NotificationRepoIndexed = "repo_indexed"
+	// NotificationFileIndexed is sent when a single file is indexed.
+	NotificationFileIndexed = "file_indexed"
+	// NotificationDocumentsDeleted is sent when a repository is deleted or
+	// retention prunes stale documents.
+	NotificationDocumentsDeleted = "documents_deleted"
+	// NotificationIndexSwapped is sent when the ES_INDEX alias moves to a
+	// rebuilt or restored generation, replacing every document at once.
+	NotificationIndexSwapped = "index_swapped"
+	// NotificationError is sent when a repository, file, or run fails.
+	NotificationError = "error"
+)
+
+// NotificationTypes lists every notification type.
+//
+//nolint:gochecknoglobals // Fixed list of notification types.
+var NotificationTypes = []string{
+	NotificationRepoIndexed,
+	NotificationFileIndexed,
+	NotificationDocumentsDeleted,
+	NotificationIndexSwapped,
+	NotificationError,
+}
+
+// Notification describes a change to the index, or a failure to make one,
+// for caches and UIs to invalidate on. Repo is empty for changes to the whole
+// index, such as a swap or a retention pass.
+type Notification struct {
+	Type      string    `json:"type"`
+	Repo      string    `json:"repo,omitempty"`
+	File      string    `json:"file,omitempty"`
+	Job       string    `json:"job,omitempty"`
+	Index     string    `json:"index,omitempty"`
+	Commit    string    `json:"commit,omitempty"`
+	Documents int       `json:"documents,omitempty"`
+	Deleted   int64     `json:"deleted,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// notificationHub fans notifications out to subscribers. A subscriber that
+// falls behind has its channel closed rather than miss a notification
+// unknowingly, so it can reconnect and start from fresh state.
+type notificationHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Notification]struct{}
+}
+
+// newNotificationHub creates a hub without subscribers.
+func newNotificationHub() (hub *notificationHub) {
+	hub = &notificationHub{
+		subscribers: make(map[chan Notification]struct{}),
+	}
+	return hub
+}
+
+// publish stamps the notification with the current time and sends it to
+// every subscriber, disconnecting those whose buffer is full.
+func (h *notificationHub) publish(notification Notification) {
+	notification.Time = time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for events := range h.subscribers {
+		select {
+		case events <- notification:
+		default:
+			close(events)
+			delete(h.subscribers, events)
+		}
+	}
+}
+
+// subscribe returns a channel receiving every notification published from
+// now on, closed if the subscriber falls behind, and a function to stop
+// receiving them.
+func (h *notificationHub) subscribe() (events <-chan Notification, unsubscribe func()) {
+	subscription := make(chan Notification, notificationSubscriberBuffer)
+
+	h.mu.Lock()
+	h.subscribers[subscription] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers, subscription)
+	}
+
+	events = subscription
+	return events, unsubscribe
+}
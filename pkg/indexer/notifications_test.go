@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"testing"
+)
+
+func TestNotificationHub(t *testing.T) {
+	hub := newNotificationHub()
+
+	events, unsubscribe := hub.subscribe()
+	slow, _ := hub.subscribe()
+
+	hub.publish(Notification{Type: NotificationRepoIndexed, Repo: "api", Documents: 3})
+
+	notification := <-events
+	if notification.Type != NotificationRepoIndexed || notification.Repo != "api" || notification.Documents != 3 {
+		t.Errorf("notification = %+v, want api indexed with 3 documents", notification)
+	}
+	if notification.Time.IsZero() {
+		t.Error("notification has no time")
+	}
+
+	// The slow subscriber's buffer fills, and the next notification
+	// disconnects it; the other keeps reading.
+	for range notificationSubscriberBuffer {
+		hub.publish(Notification{Type: NotificationError})
+		<-events
+	}
+	hub.publish(Notification{Type: NotificationError})
+	hub.publish(Notification{Type: NotificationError})
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != notificationSubscriberBuffer {
+		t.Errorf("slow subscriber received %d notifications before closing, want %d", received, notificationSubscriberBuffer)
+	}
+	if len(events) != 2 {
+		t.Errorf("subscriber keeping up has %d notifications waiting, want 2", len(events))
+	}
+
+	unsubscribe()
+	hub.publish(Notification{Type: NotificationError})
+	if len(events) != 2 {
+		t.Error("unsubscribed subscriber still receives notifications")
+	}
+}
@@ -0,0 +1,265 @@
+package indexer
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/parser"
+)
+
+// maxHeaderLines caps the lines of a file's header kept in its file
+// document: the package clause, doc comment, and imports fit in far fewer.
+const maxHeaderLines = 60
+
+// maxOutlineLines caps the declarations listed in a file or package
+// document, so a huge file or directory doesn't make a huge document.
+const maxOutlineLines = 200
+
+// lineComments maps languages to the prefix of their line comments, which
+// label the files in a package outline. Languages not listed use "//".
+//
+//nolint:gochecknoglobals // fixed lookup table
+var lineComments = map[string]string{
+	parser.LanguagePython:    "#",
+	parser.LanguageTerraform: "#",
+}
+
+// fileDocument builds the KindFile document of a parsed file from its
+// declarations: the file's header, everything before its first declaration,
+// such as the package clause, doc comment, and imports, followed by the
+// signature of each top-level declaration. A file without declarations has
+// none, and neither does a Markdown file, whose sections are its outline.
+func fileDocument(filePath string, content []byte, docs []elasticsearch.CodeDocument) (doc elasticsearch.CodeDocument, ok bool) {
+	if len(docs) == 0 || docs[0].DocType == elasticsearch.DocTypeMarkdown {
+		return doc, ok
+	}
+
+	first := docs[0]
+	for _, decl := range docs[1:] {
+		if decl.StartLine > 0 && (first.StartLine == 0 || decl.StartLine < first.StartLine) {
+			first = decl
+		}
+	}
+
+	header := fileHeader(content, first.StartLine)
+	outline := strings.Join(outlineLines(docs), "\n")
+	code := strings.TrimSpace(header + "\n\n" + outline)
+
+	doc = elasticsearch.CodeDocument{
+		FilePath:        filePath,
+		Language:        first.Language,
+		Kind:            elasticsearch.KindFile,
+		FunctionName:    filepath.Base(filePath),
+		Code:            code + "\n",
+		Package:         first.Package,
+		Imports:         first.Imports,
+		ContentHash:     contentHash([]byte(code)),
+		BuildConstraint: first.BuildConstraint,
+		BuildTags:       first.BuildTags,
+		Platforms:       first.Platforms,
+	}
+	ok = true
+	return doc, ok
+}
+
+// fileHeader returns the lines of content before the line a file's first
+// declaration starts at, less the declaration's own leading comment, at
+// most maxHeaderLines of them.
+func fileHeader(content []byte, firstLine int) (header string) {
+	if firstLine <= 1 {
+		return header
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	lines = lines[:min(firstLine-1, len(lines))]
+	for end := len(lines); end > 0; end-- {
+		if !isCommentLine(lines[end-1]) {
+			lines = lines[:end]
+			break
+		}
+	}
+	lines = lines[:min(len(lines), maxHeaderLines)]
+	header = strings.TrimSpace(strings.Join(lines, ""))
+	if !utf8.ValidString(header) {
+		header = strings.ToValidUTF8(header, "")
+	}
+	return header
+}
+
+// outlineLines returns the signature of each top-level declaration: the
+// first line of its code, without its body's braces. Methods of classes,
+// named "Class.method", are listed under their class.
+func outlineLines(docs []elasticsearch.CodeDocument) (lines []string) {
+	for _, doc := range docs {
+		if len(lines) == maxOutlineLines {
+			break
+		}
+		line := signature(doc.Code)
+		if line == "" {
+			continue
+		}
+		if doc.Kind == elasticsearch.KindMethod && doc.Language != "" && doc.Language != languageGo {
+			line = "    " + line
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// signature returns the first non-blank line of code, skipping comments
+// and decorators, without a trailing opening brace or empty body.
+func signature(code string) (line string) {
+	for candidate := range strings.SplitSeq(code, "\n") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "" || strings.HasPrefix(candidate, "//") || strings.HasPrefix(candidate, "#") ||
+			strings.HasPrefix(candidate, "/*") || strings.HasPrefix(candidate, "*") || strings.HasPrefix(candidate, "@") {
+			continue
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(candidate, "{}"), "{")
+		line = strings.TrimSpace(line)
+		return line
+	}
+	return line
+}
+
+// packageOutline collects the files of one directory for its package
+// document.
+type packageOutline struct {
+	dir      string
+	language string
+	name     string
+	doc      string
+	files    map[string][]string
+}
+
+// overviewTracker collects the file documents of an index run by directory,
+// to build a package document for each directory at the end of the run.
+type overviewTracker struct {
+	packages map[string]*packageOutline
+}
+
+// newOverviewTracker returns a tracker, or nil when overviews are off.
+func newOverviewTracker(enabled bool) (tracker *overviewTracker) {
+	if enabled {
+		tracker = &overviewTracker{packages: map[string]*packageOutline{}}
+	}
+	return tracker
+}
+
+// add records a file's declarations for its directory's package document.
+// Test files are left out, as are unexported declarations. The first file
+// whose header opens with a comment gives the package its doc.
+func (ot *overviewTracker) add(file elasticsearch.CodeDocument, docs []elasticsearch.CodeDocument) {
+	if ot == nil || file.IsTest {
+		return
+	}
+
+	dir := filepath.Dir(file.FilePath)
+	pkg, found := ot.packages[dir]
+	if !found {
+		pkg = &packageOutline{dir: dir, language: file.Language, files: map[string][]string{}}
+		ot.packages[dir] = pkg
+	}
+	if pkg.name == "" {
+		pkg.name = file.Package
+	}
+	if pkg.doc == "" {
+		pkg.doc = leadingComment(file.Code)
+	}
+
+	var exported []elasticsearch.CodeDocument
+	for _, doc := range docs {
+		if isExported(doc) {
+			exported = append(exported, doc)
+		}
+	}
+	pkg.files[file.FunctionName] = outlineLines(exported)
+}
+
+// documents returns the package document of each directory seen, in order
+// of their paths. A package document opens with the package's doc comment,
+// then lists each file, by a comment naming it, with its exported
+// declarations.
+func (ot *overviewTracker) documents() (docs []elasticsearch.CodeDocument) {
+	if ot == nil {
+		return docs
+	}
+
+	for _, dir := range slices.Sorted(maps.Keys(ot.packages)) {
+		pkg := ot.packages[dir]
+		comment := lineComments[pkg.language]
+		if comment == "" {
+			comment = "//"
+		}
+
+		var b strings.Builder
+		if pkg.doc != "" {
+			b.WriteString(pkg.doc + "\n\n")
+		}
+		listed := 0
+		for _, name := range slices.Sorted(maps.Keys(pkg.files)) {
+			b.WriteString(comment + " " + name + "\n")
+			for _, line := range pkg.files[name] {
+				if listed == maxOutlineLines {
+					break
+				}
+				b.WriteString(line + "\n")
+				listed++
+			}
+		}
+
+		name := pkg.name
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		code := b.String()
+		docs = append(docs, elasticsearch.CodeDocument{
+			FilePath:     dir,
+			Language:     pkg.language,
+			Kind:         elasticsearch.KindPackage,
+			FunctionName: name,
+			Package:      pkg.name,
+			Code:         code,
+			ContentHash:  contentHash([]byte(code)),
+		})
+	}
+	return docs
+}
+
+// leadingComment returns the comment lines a file header opens with, such
+// as a Go package doc comment, or "" when it doesn't open with one.
+func leadingComment(header string) (comment string) {
+	var lines []string
+	for line := range strings.SplitSeq(header, "\n") {
+		if !isCommentLine(line) || strings.TrimSpace(line) == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	comment = strings.Join(lines, "\n")
+	return comment
+}
+
+// isCommentLine reports whether a line is blank or a line comment.
+func isCommentLine(line string) (comment bool) {
+	trimmed := strings.TrimSpace(line)
+	comment = trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#")
+	return comment
+}
+
+// isExported reports whether a declaration belongs in its package's
+// outline: whether its parser found it exported for Go, Python, and
+// TypeScript, and always otherwise.
+func isExported(doc elasticsearch.CodeDocument) (exported bool) {
+	switch doc.Language {
+	case "", languageGo, parser.LanguagePython, parser.LanguageTypeScript:
+		exported = doc.Exported
+	default:
+		exported = true
+	}
+	return exported
+}
@@ -0,0 +1,146 @@
+package indexer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const retrySource = `// Package retry retries calls.
+package retry
+
+import "time"
+
+// Do calls fn until it succeeds.
+func Do(fn func() error) (err error) {
+	return fn()
+}
+
+func backoff(n int) (d time.Duration) {
+	return time.Duration(n) * time.Second
+}
+
+// Policy configures retries.
+type Policy struct {
+	Attempts int
+}
+`
+
+func TestFileDocument(t *testing.T) {
+	docs, err := parseGoFile("/repos/api/retry/retry.go", []byte(retrySource), nil, nil)
+	if err != nil {
+		t.Fatalf("parseGoFile() error = %v", err)
+	}
+
+	doc, ok := fileDocument("/repos/api/retry/retry.go", []byte(retrySource), docs)
+	if !ok {
+		t.Fatal("fileDocument() found no declarations")
+	}
+
+	want := "// Package retry retries calls.\npackage retry\n\nimport \"time\"\n\n" +
+		"func Do(fn func() error) (err error)\nfunc backoff(n int) (d time.Duration)\ntype Policy struct\n"
+	if doc.Code != want {
+		t.Errorf("code = %q, want %q", doc.Code, want)
+	}
+	if doc.Kind != elasticsearch.KindFile || doc.FunctionName != "retry.go" || doc.Package != "retry" || doc.ContentHash == "" {
+		t.Errorf("document = %+v, want retry.go's file document", doc)
+	}
+
+	_, ok = fileDocument("README.md", []byte("# Usage\n"), []elasticsearch.CodeDocument{{DocType: elasticsearch.DocTypeMarkdown, Kind: elasticsearch.KindSection}})
+	if ok {
+		t.Error("fileDocument() made a file document for Markdown")
+	}
+}
+
+func TestOverviewTracker(t *testing.T) {
+	var ot *overviewTracker
+	ot.add(elasticsearch.CodeDocument{}, nil)
+	if docs := ot.documents(); len(docs) != 0 {
+		t.Errorf("disabled tracker documents = %v, want none", docs)
+	}
+
+	ot = newOverviewTracker(true)
+	add := func(filePath string, source string, test bool) {
+		docs, err := parseGoFile(filePath, []byte(source), nil, nil)
+		if err != nil {
+			t.Fatalf("parseGoFile() error = %v", err)
+		}
+		file, _ := fileDocument(filePath, []byte(source), docs)
+		file.IsTest = test
+		ot.add(file, docs)
+	}
+	add("/repos/api/retry/retry.go", retrySource, false)
+	add("/repos/api/retry/jitter.go", "package retry\n\nfunc Jitter() {}\n", false)
+	add("/repos/api/retry/retry_test.go", "package retry\n\nfunc TestDo() {}\n", true)
+
+	docs := ot.documents()
+	if len(docs) != 1 {
+		t.Fatalf("documents() = %d documents, want 1", len(docs))
+	}
+	want := "// Package retry retries calls.\n\n// jitter.go\nfunc Jitter()\n// retry.go\nfunc Do(fn func() error) (err error)\ntype Policy struct\n"
+	if docs[0].Code != want {
+		t.Errorf("package code = %q, want %q", docs[0].Code, want)
+	}
+	if docs[0].Kind != elasticsearch.KindPackage || docs[0].FunctionName != "retry" || docs[0].FilePath != "/repos/api/retry" {
+		t.Errorf("package document = %+v, want retry's", docs[0])
+	}
+}
+
+func TestIndexOverviews(t *testing.T) {
+	var mu sync.Mutex
+	var indexed []elasticsearch.CodeDocument
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test-index/_doc" {
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			mu.Lock()
+			indexed = append(indexed, doc)
+			mu.Unlock()
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer es.Close()
+
+	workspace := t.TempDir()
+	writeErr := os.WriteFile(filepath.Join(workspace, "retry.go"), []byte(retrySource), 0o600)
+	if writeErr != nil {
+		t.Fatalf("failed to write file: %v", writeErr)
+	}
+
+	cfg := config.Config{ESHost: es.URL, ESIndex: "test-index", Languages: []string{"go"}, IndexOverviews: true}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx := New(cfg, client, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	count, err := idx.IndexPath(t.Context(), workspace, "retry")
+	if err != nil {
+		t.Fatalf("IndexPath() error = %v", err)
+	}
+
+	var kinds []string
+	for _, doc := range indexed {
+		kinds = append(kinds, doc.Kind)
+	}
+	want := "file,function,function,type,package"
+	if strings.Join(kinds, ",") != want || count != 5 {
+		t.Errorf("indexed %d documents of kinds %v, want %s", count, kinds, want)
+	}
+	if pkg := indexed[len(indexed)-1]; pkg.Repo != "retry" || pkg.FilePath != workspace {
+		t.Errorf("package document = %+v, want the workspace's in repo retry", pkg)
+	}
+}
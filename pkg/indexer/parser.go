@@ -1,59 +1,68 @@
 package indexer
 
 import (
-	"context"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
-	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/lint"
 )
 
-// indexFile parses a Go file and indexes all functions found within it.
-func indexFile(ctx context.Context, es *elasticsearch.Client, logger logging.Logger, repo string, filePath string) (funcCount int, parseErr error) {
+// parseGoFile parses Go source into documents for its functions and its
+// type, const, and var declarations. Files with syntax errors are parsed
+// best-effort: whatever declarations the parser recovered are returned and
+// flagged with HasParseErrors when they overlap an error, along with the
+// syntax errors so the file is reported. Only files without a readable
+// package clause produce nothing. Documents of a file with build
+// constraints, in its //go:build line or implied by its name, record them.
+func parseGoFile(filePath string, content []byte, linter *lint.Linter, vetFindings []lint.Finding) (docs []elasticsearch.CodeDocument, parseErr error) {
 	fset := token.NewFileSet()
 
 	var node *ast.File
-	node, parseErr = parser.ParseFile(fset, filePath, nil, parser.ParseComments)
-	if parseErr != nil {
-		parseErr = fmt.Errorf("failed to parse file: %w", parseErr)
-		return funcCount, parseErr
+	node, parseErr = parser.ParseFile(fset, filePath, content, parser.ParseComments)
+	var syntaxErrs scanner.ErrorList
+	if parseErr != nil && (!errors.As(parseErr, &syntaxErrs) || node == nil || node.Name == nil || node.Name.Name == "") {
+		return docs, parseErr
 	}
 
-	pkgName := node.Name.Name
 	var imports []string
 	for _, imp := range node.Imports {
 		imports = append(imports, strings.Trim(imp.Path.Value, `"`))
 	}
 
-	var content []byte
-	content, parseErr = os.ReadFile(filePath)
-	if parseErr != nil {
-		parseErr = fmt.Errorf("failed to read file: %w", parseErr)
-		return funcCount, parseErr
-	}
-
 	visitor := &astVisitor{
-		ctx:      ctx,
-		es:       es,
-		logger:   logger,
-		fset:     fset,
-		content:  content,
-		repo:     repo,
-		filePath: filePath,
-		pkgName:  pkgName,
-		imports:  imports,
+		fset:        fset,
+		content:     content,
+		linter:      linter,
+		vetFindings: vetFindings,
+		filePath:    filePath,
+		pkgName:     node.Name.Name,
+		imports:     imports,
+		importPaths: importPaths(node),
+		comments:    node.Comments,
+		syntaxErrs:  syntaxErrs,
+		symbols:     newSymbolResolver(fset, node),
 	}
 
 	ast.Inspect(node, visitor.Visit)
-	funcCount = visitor.funcCount
-
-	return funcCount, parseErr
+	docs = visitor.docs
+
+	expr := buildConstraint(node, filePath)
+	if expr != nil {
+		tags := constraintTags(expr)
+		for i := range docs {
+			docs[i].BuildConstraint = expr.String()
+			docs[i].BuildTags = tags
+		}
+	}
+	return docs, parseErr
 }
 
 // extractFunctionDoc extracts metadata and code from a function declaration.
@@ -61,31 +70,153 @@ func extractFunctionDoc(
 	funcDecl *ast.FuncDecl,
 	fset *token.FileSet,
 	content []byte,
-	repo string,
 	filePath string,
 	pkgName string,
 	imports []string,
 ) (doc elasticsearch.CodeDocument) {
 	doc = elasticsearch.CodeDocument{
-		Repo:         repo,
 		FilePath:     filePath,
+		DocType:      elasticsearch.DocTypeCode,
+		Kind:         elasticsearch.KindFunction,
 		FunctionName: funcDecl.Name.Name,
 		Package:      pkgName,
 		Imports:      imports,
 		IndexedAt:    time.Now(),
 	}
 
+	// A method is only reachable from other packages through an exported
+	// type.
+	doc.Exported = token.IsExported(funcDecl.Name.Name)
+	if funcDecl.Recv != nil {
+		doc.Kind = elasticsearch.KindMethod
+		doc.Receiver = receiverTypeName(funcDecl)
+		doc.Exported = doc.Exported && token.IsExported(doc.Receiver)
+	}
+
 	start := fset.Position(funcDecl.Pos()).Offset
 	end := fset.Position(funcDecl.End()).Offset
 	doc.Code = string(content[start:end])
+	doc.StartLine, doc.EndLine = lineRange(fset, funcDecl.Pos(), funcDecl.End())
+
+	nameEnd := fset.Position(funcDecl.Name.End()).Offset
+	doc.ContentHash = contentHash(content[nameEnd:end])
 
 	doc.HasNamedReturns = hasNamedReturns(funcDecl)
 	doc.HasErrorHandling = strings.Contains(doc.Code, "if err != nil")
-	doc.LintCompliant = false
+	doc.CyclomaticComplexity = cyclomaticComplexity(funcDecl)
+	doc.CognitiveComplexity = cognitiveComplexity(funcDecl)
+	doc.Calls = calledFunctions(funcDecl)
+	doc.References = referencedTypes(funcDecl, "", funcDecl.Type.TypeParams)
 
 	return doc
 }
 
+// extractDeclDocs builds documents for a type, const, or var declaration.
+// Each type spec becomes its own document; a const or var declaration is kept
+// whole so iota groups stay together, and is named after its first identifier.
+// Imports produce no documents.
+func extractDeclDocs(
+	genDecl *ast.GenDecl,
+	fset *token.FileSet,
+	content []byte,
+	filePath string,
+	pkgName string,
+	imports []string,
+) (docs []elasticsearch.CodeDocument) {
+	newDoc := func(kind string, name *ast.Ident, code string, hashFrom token.Pos, end token.Pos) (doc elasticsearch.CodeDocument) {
+		doc = elasticsearch.CodeDocument{
+			FilePath:     filePath,
+			DocType:      elasticsearch.DocTypeCode,
+			Kind:         kind,
+			FunctionName: name.Name,
+			Exported:     token.IsExported(name.Name),
+			Code:         code,
+			Package:      pkgName,
+			Imports:      imports,
+			IndexedAt:    time.Now(),
+		}
+		doc.ContentHash = contentHash(content[fset.Position(hashFrom).Offset:fset.Position(end).Offset])
+		return doc
+	}
+
+	switch genDecl.Tok {
+	case token.TYPE:
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+
+			kind := elasticsearch.KindType
+			_, isInterface := typeSpec.Type.(*ast.InterfaceType)
+			if isInterface {
+				kind = elasticsearch.KindInterface
+			}
+
+			start, end := typeSpec.Pos(), typeSpec.End()
+			code := "type " + sourceText(fset, content, start, end)
+			if !genDecl.Lparen.IsValid() {
+				start, end = genDecl.Pos(), genDecl.End()
+				code = sourceText(fset, content, start, end)
+			}
+			doc := newDoc(kind, typeSpec.Name, code, typeSpec.Name.End(), typeSpec.End())
+			doc.StartLine, doc.EndLine = lineRange(fset, start, end)
+			doc.References = referencedTypes(typeSpec, typeSpec.Name.Name, typeSpec.TypeParams)
+			docs = append(docs, doc)
+		}
+
+	case token.CONST, token.VAR:
+		kind := elasticsearch.KindConst
+		if genDecl.Tok == token.VAR {
+			kind = elasticsearch.KindVar
+		}
+
+		valueSpec, ok := genDecl.Specs[0].(*ast.ValueSpec)
+		if !ok || len(valueSpec.Names) == 0 {
+			return docs
+		}
+
+		code := sourceText(fset, content, genDecl.Pos(), genDecl.End())
+		doc := newDoc(kind, valueSpec.Names[0], code, valueSpec.Names[0].End(), genDecl.End())
+		doc.Exported = exportsValue(genDecl)
+		doc.StartLine, doc.EndLine = lineRange(fset, genDecl.Pos(), genDecl.End())
+		docs = append(docs, doc)
+	}
+
+	return docs
+}
+
+// exportsValue reports whether a const or var declaration declares any
+// exported name.
+func exportsValue(genDecl *ast.GenDecl) (exported bool) {
+	for _, spec := range genDecl.Specs {
+		valueSpec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		for _, name := range valueSpec.Names {
+			if name.IsExported() {
+				exported = true
+				return exported
+			}
+		}
+	}
+	return exported
+}
+
+// sourceText returns the file content between two positions.
+func sourceText(fset *token.FileSet, content []byte, start token.Pos, end token.Pos) (text string) {
+	text = string(content[fset.Position(start).Offset:fset.Position(end).Offset])
+	return text
+}
+
+// lineRange returns the 1-based first and last lines of a source range.
+func lineRange(fset *token.FileSet, start token.Pos, end token.Pos) (startLine int, endLine int) {
+	startLine = fset.Position(start).Line
+	endLine = fset.Position(end).Line
+	return startLine, endLine
+}
+
 // hasNamedReturns checks if a function has named return values.
 func hasNamedReturns(funcDecl *ast.FuncDecl) (named bool) {
 	if funcDecl.Type.Results == nil {
@@ -102,3 +233,11 @@ func hasNamedReturns(funcDecl *ast.FuncDecl) (named bool) {
 
 	return named
 }
+
+// contentHash returns a hex-encoded SHA-256 of the given source. Callers hash
+// everything after the function name so renamed functions keep their hash.
+func contentHash(src []byte) (hash string) {
+	sum := sha256.Sum256(src)
+	hash = hex.EncodeToString(sum[:])
+	return hash
+}
@@ -5,10 +5,12 @@ import (
 	"go/parser"
 	"go/token"
 	"os"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/lint"
 )
 
 func TestHasNamedReturns(t *testing.T) {
@@ -130,11 +132,8 @@ func TestFunc(ctx context.Context, input string) (result string, err error) {
 	imports := []string{"context", "errors"}
 	content := []byte(funcCode)
 
-	doc := extractFunctionDoc(funcDecl, fset, content, "testrepo", "test.go", "test", imports)
+	doc := extractFunctionDoc(funcDecl, fset, content, "test.go", "test", imports)
 
-	if doc.Repo != "testrepo" {
-		t.Errorf("Repo = %v, want testrepo", doc.Repo)
-	}
 	if doc.FilePath != "test.go" {
 		t.Errorf("FilePath = %v, want test.go", doc.FilePath)
 	}
@@ -196,7 +195,7 @@ func Simple(x int) (result int) {
 	}
 
 	content := []byte(funcCode)
-	doc := extractFunctionDoc(funcDecl, fset, content, "testrepo", "test.go", "test", nil)
+	doc := extractFunctionDoc(funcDecl, fset, content, "test.go", "test", nil)
 
 	if doc.HasErrorHandling {
 		t.Error("HasErrorHandling = true, want false")
@@ -236,7 +235,7 @@ func TestExtractFunctionDocRealFile(t *testing.T) {
 
 	ast.Inspect(node, func(n ast.Node) (shouldContinue bool) {
 		if funcDecl, ok := n.(*ast.FuncDecl); ok {
-			doc := extractFunctionDoc(funcDecl, fset, content, "testrepo", testFile, "testdata", nil)
+			doc := extractFunctionDoc(funcDecl, fset, content, testFile, "testdata", nil)
 			foundFuncs[doc.FunctionName] = doc
 		}
 		shouldContinue = true
@@ -296,7 +295,7 @@ func TestFunc() (result string) {
 	})
 
 	content := []byte(funcCode)
-	doc := extractFunctionDoc(funcDecl, fset, content, "testrepo", "test.go", "test", nil)
+	doc := extractFunctionDoc(funcDecl, fset, content, "test.go", "test", nil)
 
 	if doc.Code == "" {
 		t.Fatal("Code is empty")
@@ -310,6 +309,52 @@ func TestFunc() (result string) {
 	}
 }
 
+func TestExtractFunctionDocContentHash(t *testing.T) {
+	funcCode := `package test
+
+func Original(x int) (result int) {
+	result = x * 2
+	return result
+}
+
+func Renamed(x int) (result int) {
+	result = x * 2
+	return result
+}
+
+func Changed(x int) (result int) {
+	result = x * 3
+	return result
+}`
+
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, "test.go", funcCode, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse code: %v", err)
+	}
+
+	content := []byte(funcCode)
+	hashes := make(map[string]string)
+	for _, decl := range node.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		doc := extractFunctionDoc(funcDecl, fset, content, "test.go", "test", nil)
+		hashes[doc.FunctionName] = doc.ContentHash
+	}
+
+	if hashes["Original"] == "" {
+		t.Fatal("ContentHash is empty")
+	}
+	if hashes["Original"] != hashes["Renamed"] {
+		t.Errorf("ContentHash differs after rename: %v vs %v", hashes["Original"], hashes["Renamed"])
+	}
+	if hashes["Original"] == hashes["Changed"] {
+		t.Error("ContentHash matches for different function bodies")
+	}
+}
+
 func containsString(s string, substr string) (result bool) {
 	result = len(s) >= len(substr) && findString(s, substr)
 	return result
@@ -325,3 +370,188 @@ func findString(s string, substr string) (found bool) {
 	found = false
 	return found
 }
+
+func TestLintFunction(t *testing.T) {
+	funcCode := `package test
+
+// Foo returns a value.
+func Foo() (string, error) {
+	return "", nil
+}
+
+// Bar returns a value.
+func Bar() (result string) {
+	return result
+}
+`
+
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, "test.go", funcCode, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Failed to parse code: %v", err)
+	}
+
+	visitor := &astVisitor{
+		fset:        fset,
+		linter:      lint.New([]string{lint.CheckNamedReturns, lint.CheckGovet}),
+		vetFindings: []lint.Finding{{Rule: "govet/printf", Line: 10}},
+	}
+
+	tests := []struct {
+		name          string
+		decl          int
+		wantFindings  []string
+		wantCompliant bool
+	}{
+		{
+			name:          "builtin finding",
+			decl:          0,
+			wantFindings:  []string{lint.CheckNamedReturns},
+			wantCompliant: false,
+		},
+		{
+			name:          "vet finding in range",
+			decl:          1,
+			wantFindings:  []string{"govet/printf"},
+			wantCompliant: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			funcDecl, ok := node.Decls[tt.decl].(*ast.FuncDecl)
+			if !ok {
+				t.Fatal("No function declaration found")
+			}
+
+			doc := extractFunctionDoc(funcDecl, fset, []byte(funcCode), "test.go", "test", nil)
+			visitor.lintFunction(funcDecl, &doc)
+
+			if !slices.Equal(doc.LintFindings, tt.wantFindings) {
+				t.Errorf("LintFindings = %v, want %v", doc.LintFindings, tt.wantFindings)
+			}
+			if doc.LintCompliant != tt.wantCompliant {
+				t.Errorf("LintCompliant = %v, want %v", doc.LintCompliant, tt.wantCompliant)
+			}
+		})
+	}
+
+	visitor.linter = lint.New([]string{lint.CheckNamedReturns})
+	visitor.vetFindings = nil
+	funcDecl, ok := node.Decls[1].(*ast.FuncDecl)
+	if !ok {
+		t.Fatal("No function declaration found")
+	}
+	doc := extractFunctionDoc(funcDecl, fset, []byte(funcCode), "test.go", "test", nil)
+	visitor.lintFunction(funcDecl, &doc)
+	if !doc.LintCompliant || len(doc.LintFindings) != 0 {
+		t.Errorf("clean function: LintCompliant = %v, LintFindings = %v, want compliant", doc.LintCompliant, doc.LintFindings)
+	}
+}
+
+func TestExtractDeclDocs(t *testing.T) {
+	src := `package test
+
+import "io"
+
+// Handler serves requests.
+type Handler struct {
+	name string
+}
+
+type (
+	Reader interface {
+		Read() (err error)
+	}
+	ID string
+)
+
+const (
+	StateIdle = iota
+	StateBusy
+)
+
+var defaultReader io.Reader
+
+func (h *Handler) Serve() {
+	type local struct{}
+}
+
+func (ID) String() (s string) {
+	return s
+}
+
+func (r reader) Read() (err error) {
+	return err
+}
+`
+
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, "test.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Failed to parse code: %v", err)
+	}
+
+	var got []elasticsearch.CodeDocument
+	for _, decl := range node.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		got = append(got, extractDeclDocs(genDecl, fset, []byte(src), "test.go", "test", nil)...)
+	}
+
+	want := []struct {
+		kind     string
+		name     string
+		code     string
+		lines    [2]int
+		exported bool
+	}{
+		{kind: elasticsearch.KindType, name: "Handler", code: "type Handler struct {\n\tname string\n}", lines: [2]int{6, 8}, exported: true},
+		{kind: elasticsearch.KindInterface, name: "Reader", code: "type Reader interface {\n\t\tRead() (err error)\n\t}", lines: [2]int{11, 13}, exported: true},
+		{kind: elasticsearch.KindType, name: "ID", code: "type ID string", lines: [2]int{14, 14}, exported: true},
+		{kind: elasticsearch.KindConst, name: "StateIdle", code: "const (\n\tStateIdle = iota\n\tStateBusy\n)", lines: [2]int{17, 20}, exported: true},
+		{kind: elasticsearch.KindVar, name: "defaultReader", code: "var defaultReader io.Reader", lines: [2]int{22, 22}},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("documents = %d, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || got[i].FunctionName != w.name {
+			t.Errorf("doc[%d] = %s %s, want %s %s", i, got[i].Kind, got[i].FunctionName, w.kind, w.name)
+		}
+		if got[i].Code != w.code {
+			t.Errorf("doc[%d].Code = %q, want %q", i, got[i].Code, w.code)
+		}
+		if got[i].ContentHash == "" {
+			t.Errorf("doc[%d].ContentHash is empty", i)
+		}
+		if got[i].Exported != w.exported {
+			t.Errorf("doc[%d].Exported = %v, want %v", i, got[i].Exported, w.exported)
+		}
+		if got[i].StartLine != w.lines[0] || got[i].EndLine != w.lines[1] {
+			t.Errorf("doc[%d] lines = %d-%d, want %d-%d", i, got[i].StartLine, got[i].EndLine, w.lines[0], w.lines[1])
+		}
+	}
+
+	var methods []elasticsearch.CodeDocument
+	for _, decl := range node.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if ok {
+			methods = append(methods, extractFunctionDoc(funcDecl, fset, []byte(src), "test.go", "test", nil))
+		}
+	}
+	if methods[0].Kind != elasticsearch.KindMethod {
+		t.Errorf("method Kind = %q, want %q", methods[0].Kind, elasticsearch.KindMethod)
+	}
+	if methods[0].StartLine != 24 || methods[0].EndLine != 26 {
+		t.Errorf("method lines = %d-%d, want 24-26", methods[0].StartLine, methods[0].EndLine)
+	}
+	for i, want := range []bool{true, true, false} {
+		if methods[i].Exported != want {
+			t.Errorf("%s Exported = %v, want %v, exported only on an exported type", methods[i].FunctionName, methods[i].Exported, want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// PauseStatus describes whether indexing is paused and why.
+type PauseStatus struct {
+	Paused     bool       `json:"paused"`
+	Manual     bool       `json:"manual"`
+	AutoReason string     `json:"auto_reason,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// pauseGate blocks indexing while an operator or the health monitor has
+// paused it. Manual and automatic pauses are tracked separately so a
+// recovering cluster doesn't lift an operator's pause.
+type pauseGate struct {
+	mu         sync.Mutex
+	manual     bool
+	autoReason string
+	since      time.Time
+	resumed    chan struct{}
+}
+
+// newPauseGate creates an unpaused gate.
+func newPauseGate() (gate *pauseGate) {
+	gate = &pauseGate{}
+	return gate
+}
+
+// setManual sets or clears the operator pause.
+func (g *pauseGate) setManual(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wasPaused := g.paused()
+	g.manual = paused
+	g.transition(wasPaused)
+}
+
+// setAuto sets the automatic pause reason; an empty reason clears it.
+func (g *pauseGate) setAuto(reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wasPaused := g.paused()
+	g.autoReason = reason
+	g.transition(wasPaused)
+}
+
+// status returns the current pause state.
+func (g *pauseGate) status() (status PauseStatus) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status = PauseStatus{
+		Paused:     g.paused(),
+		Manual:     g.manual,
+		AutoReason: g.autoReason,
+	}
+	if status.Paused {
+		since := g.since
+		status.Since = &since
+	}
+
+	return status
+}
+
+// wait blocks while the gate is paused. It returns the context's error if the
+// context ends first. A nil gate never pauses.
+func (g *pauseGate) wait(ctx context.Context) (err error) {
+	if g == nil {
+		return err
+	}
+
+	for {
+		g.mu.Lock()
+		if !g.paused() {
+			g.mu.Unlock()
+			return err
+		}
+		resumed := g.resumed
+		g.mu.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return err
+		}
+	}
+}
+
+// paused reports whether either pause is active. Callers must hold g.mu.
+func (g *pauseGate) paused() (paused bool) {
+	paused = g.manual || g.autoReason != ""
+	return paused
+}
+
+// transition opens or releases waiters after a state change. Callers must hold g.mu.
+func (g *pauseGate) transition(wasPaused bool) {
+	isPaused := g.paused()
+
+	if !wasPaused && isPaused {
+		g.since = time.Now()
+		g.resumed = make(chan struct{})
+		return
+	}
+
+	if wasPaused && !isPaused {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// Pause stops indexing until Resume is called. In-flight runs stop before the next file.
+func (idx *Indexer) Pause() (status PauseStatus) {
+	idx.pause.setManual(true)
+	idx.logger.Warn("Indexing paused by operator")
+	status = idx.pause.status()
+	return status
+}
+
+// Resume lifts an operator pause. Indexing stays paused while the health
+// monitor reports an unhealthy cluster.
+func (idx *Indexer) Resume() (status PauseStatus) {
+	idx.pause.setManual(false)
+	idx.logger.Info("Indexing resumed by operator")
+	status = idx.pause.status()
+	return status
+}
+
+// PauseStatus returns whether indexing is paused and why.
+func (idx *Indexer) PauseStatus() (status PauseStatus) {
+	status = idx.pause.status()
+	return status
+}
+
+// RunHealthMonitor periodically checks Elasticsearch and pauses indexing while
+// the cluster is red, unreachable, or above the configured CPU threshold.
+func (idx *Indexer) RunHealthMonitor(ctx context.Context) {
+	ticker := time.NewTicker(idx.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	idx.logger.Info("Starting cluster health monitor", "interval", idx.config.HealthCheckInterval)
+
+	for {
+		select {
+		case <-ticker.C:
+			reason := idx.clusterPauseReason(ctx)
+			previous := idx.pause.status().AutoReason
+			idx.pause.setAuto(reason)
+
+			if reason != "" && previous == "" {
+				idx.logger.Warn("Indexing auto-paused", "reason", reason)
+			}
+			if reason == "" && previous != "" {
+				idx.logger.Info("Indexing auto-pause lifted", "previous_reason", previous)
+			}
+
+		case <-ctx.Done():
+			idx.logger.Info("Cluster health monitor stopped")
+			return
+		}
+	}
+}
+
+// clusterPauseReason returns why indexing should be paused, or an empty string if the cluster is healthy.
+func (idx *Indexer) clusterPauseReason(ctx context.Context) (reason string) {
+	health, err := idx.es.ClusterHealth(ctx)
+	if err != nil {
+		reason = fmt.Sprintf("cluster health unavailable: %v", err)
+		return reason
+	}
+
+	if health.Status == elasticsearch.HealthRed {
+		reason = "cluster health is red"
+		return reason
+	}
+
+	if idx.config.AutoPauseCPUPercent <= 0 {
+		return reason
+	}
+
+	cpu, err := idx.es.MaxNodeCPUPercent(ctx)
+	if err != nil {
+		reason = fmt.Sprintf("node stats unavailable: %v", err)
+		return reason
+	}
+
+	if cpu >= idx.config.AutoPauseCPUPercent {
+		reason = fmt.Sprintf("node CPU at %d%% (threshold %d%%)", cpu, idx.config.AutoPauseCPUPercent)
+		return reason
+	}
+
+	return reason
+}
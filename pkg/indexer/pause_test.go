@@ -0,0 +1,205 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPauseGate(t *testing.T) {
+	gate := newPauseGate()
+
+	err := gate.wait(t.Context())
+	if err != nil {
+		t.Fatalf("wait() on open gate error = %v", err)
+	}
+
+	gate.setManual(true)
+	gate.setAuto("cluster health is red")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- gate.wait(t.Context())
+	}()
+
+	gate.setManual(false)
+	select {
+	case <-done:
+		t.Fatal("wait() returned while auto pause still active")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	status := gate.status()
+	if !status.Paused || status.Manual || status.AutoReason == "" || status.Since == nil {
+		t.Errorf("status = %+v, want auto-paused only", status)
+	}
+
+	gate.setAuto("")
+	select {
+	case waitErr := <-done:
+		if waitErr != nil {
+			t.Errorf("wait() error = %v", waitErr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait() did not return after resume")
+	}
+
+	if gate.status().Paused {
+		t.Error("status().Paused = true after resume")
+	}
+
+	var none *pauseGate
+	err = none.wait(t.Context())
+	if err != nil {
+		t.Errorf("wait() on nil gate error = %v", err)
+	}
+}
+
+func TestPauseGateContextCancel(t *testing.T) {
+	gate := newPauseGate()
+	gate.setManual(true)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := gate.wait(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("wait() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestIndexRepositoryWaitsWhilePaused(t *testing.T) {
+	var indexed atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_doc") {
+			indexed.Add(1)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	repo := t.TempDir()
+	err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", Languages: []string{"go"}, MaxDocsPerRepo: 100}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+	idx.Pause()
+
+	done := make(chan error, 1)
+	go func() {
+		_, indexErr := idx.IndexRepository(t.Context(), repo)
+		done <- indexErr
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("IndexRepository() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if indexed.Load() != 0 {
+		t.Fatalf("indexed %d documents while paused", indexed.Load())
+	}
+
+	idx.Resume()
+	select {
+	case indexErr := <-done:
+		if indexErr != nil {
+			t.Fatalf("IndexRepository() error = %v", indexErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("IndexRepository() did not finish after resume")
+	}
+	if indexed.Load() != 1 {
+		t.Errorf("indexed %d documents, want 1", indexed.Load())
+	}
+}
+
+func TestClusterPauseReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		health     string
+		cpu        string
+		threshold  int
+		wantPaused bool
+	}{
+		{
+			name:       "healthy",
+			health:     `{"status":"green"}`,
+			cpu:        `{"nodes":{"a":{"os":{"cpu":{"percent":40}}}}}`,
+			threshold:  90,
+			wantPaused: false,
+		},
+		{
+			name:       "red cluster",
+			health:     `{"status":"red"}`,
+			cpu:        `{"nodes":{"a":{"os":{"cpu":{"percent":40}}}}}`,
+			threshold:  90,
+			wantPaused: true,
+		},
+		{
+			name:       "high cpu",
+			health:     `{"status":"yellow"}`,
+			cpu:        `{"nodes":{"a":{"os":{"cpu":{"percent":40}}},"b":{"os":{"cpu":{"percent":95}}}}}`,
+			threshold:  90,
+			wantPaused: true,
+		},
+		{
+			name:       "cpu check disabled",
+			health:     `{"status":"green"}`,
+			cpu:        `{"nodes":{"a":{"os":{"cpu":{"percent":99}}}}}`,
+			threshold:  0,
+			wantPaused: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/_cluster/health":
+					_, _ = w.Write([]byte(tt.health))
+				case "/_nodes/stats/os":
+					_, _ = w.Write([]byte(tt.cpu))
+				default:
+					_, _ = w.Write([]byte(`{}`))
+				}
+			}))
+			defer srv.Close()
+
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, err := elasticsearch.NewClient(config.Config{ESHost: srv.URL, ESIndex: "test-index"}, m)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			idx := New(config.Config{AutoPauseCPUPercent: tt.threshold}, es, m, nil)
+
+			reason := idx.clusterPauseReason(t.Context())
+			if (reason != "") != tt.wantPaused {
+				t.Errorf("clusterPauseReason() = %q, wantPaused %v", reason, tt.wantPaused)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package indexer
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// previewPageSize is how many of a repository's indexed documents each page
+// of a dry run's comparison reads.
+const previewPageSize = 1000
+
+// maxPreviewSamples bounds the documents a dry run lists for each kind of
+// change; the counts cover the rest.
+const maxPreviewSamples = 20
+
+// DocumentRef identifies a document across runs by the file, declaration,
+// and chunk it covers, so a declaration keeps its identity when lines above
+// it move.
+type DocumentRef struct {
+	FilePath        string `json:"file_path"`
+	Kind            string `json:"kind"`
+	FunctionName    string `json:"function_name"`
+	Receiver        string `json:"receiver,omitempty"`
+	BuildConstraint string `json:"build_constraint,omitempty"`
+	ChunkIndex      int    `json:"chunk_index,omitempty"`
+}
+
+// DocumentDiff is what indexing a repository would change in the index,
+// comparing the documents of each file with those indexed from it. Added
+// documents have no indexed copy, updated ones differ from every indexed
+// copy, and unchanged ones match one. Deleted documents are indexed but no
+// longer written, from declarations gone from their file or files since
+// removed, so they go stale until RETENTION_DAYS prunes them. Skipped
+// documents are those of the files MANIFEST_FILE has unchanged, which the
+// run leaves as they are. The first documents of each change are listed.
+type DocumentDiff struct {
+	Added       int           `json:"added"`
+	Updated     int           `json:"updated"`
+	Deleted     int           `json:"deleted"`
+	Unchanged   int           `json:"unchanged"`
+	Skipped     int           `json:"skipped"`
+	AddedDocs   []DocumentRef `json:"added_docs,omitempty"`
+	UpdatedDocs []DocumentRef `json:"updated_docs,omitempty"`
+	DeletedDocs []DocumentRef `json:"deleted_docs,omitempty"`
+}
+
+// plannedDocument is a document a dry run would index.
+type plannedDocument struct {
+	ref         DocumentRef
+	fingerprint string
+}
+
+// documentPreview collects the documents a dry run's walk would index, in
+// the order it would index them, in place of sending them to Elasticsearch,
+// and the files the manifest lets it skip, with how many documents they have.
+type documentPreview struct {
+	planned      []plannedDocument
+	skippedFiles map[string]bool
+	skipped      int
+}
+
+// newDocumentPreview creates an empty preview.
+func newDocumentPreview() (preview *documentPreview) {
+	preview = &documentPreview{skippedFiles: make(map[string]bool)}
+	return preview
+}
+
+// newDocumentRef returns a document's identity.
+func newDocumentRef(doc elasticsearch.CodeDocument) (ref DocumentRef) {
+	ref = DocumentRef{
+		FilePath:        doc.FilePath,
+		Kind:            doc.Kind,
+		FunctionName:    doc.FunctionName,
+		Receiver:        doc.Receiver,
+		BuildConstraint: doc.BuildConstraint,
+		ChunkIndex:      doc.ChunkIndex,
+	}
+	return ref
+}
+
+// documentFingerprint hashes what a document would store, leaving out what
+// differs from run to run whatever the code: when and at which commit it was
+// indexed, its summary, the duplicate locations recorded after the walk, and
+// the full code, which isn't kept in _source.
+func documentFingerprint(doc elasticsearch.CodeDocument) (fingerprint string) {
+	doc.ID = ""
+	doc.Commit = ""
+	doc.IndexedAt = time.Time{}
+	doc.Summary = ""
+	doc.SummaryModel = ""
+	doc.CodeFull = ""
+	doc.RenamedFrom = ""
+	doc.Locations = nil
+	doc.Duplicates = nil
+	doc.Score = 0
+	doc.RerankScore = 0
+	doc.Context = nil
+	doc.Tests = nil
+	doc.SourceURL = ""
+
+	data, _ := json.Marshal(doc)
+	fingerprint = contentHash(data)
+	return fingerprint
+}
+
+// add records a document the run would index.
+func (p *documentPreview) add(doc elasticsearch.CodeDocument) {
+	p.planned = append(p.planned, plannedDocument{ref: newDocumentRef(doc), fingerprint: documentFingerprint(doc)})
+}
+
+// skip records a file the manifest has unchanged, whose indexed documents
+// the run leaves as they are.
+func (p *documentPreview) skip(filePath string, documents int) {
+	p.skippedFiles[filePath] = true
+	p.skipped += documents
+}
+
+// diff compares the documents the run would index from each file with those
+// indexed from it. Full runs append documents beside the earlier copies, so
+// a document is unchanged when any indexed copy of it matches, and indexed
+// documents the run wouldn't write again are deleted, unless their file is
+// skipped.
+func (p *documentPreview) diff(ctx context.Context, es *elasticsearch.Client, repo string) (diff DocumentDiff, err error) {
+	indexed := make(map[string]map[DocumentRef]map[string]bool)
+	err = es.RepoDocuments(ctx, repo, previewPageSize, func(docs []elasticsearch.CodeDocument) (pageErr error) {
+		for _, doc := range docs {
+			ref := newDocumentRef(doc)
+			if indexed[ref.FilePath] == nil {
+				indexed[ref.FilePath] = make(map[DocumentRef]map[string]bool)
+			}
+			if indexed[ref.FilePath][ref] == nil {
+				indexed[ref.FilePath][ref] = make(map[string]bool)
+			}
+			indexed[ref.FilePath][ref][documentFingerprint(doc)] = true
+		}
+		return pageErr
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to read indexed documents: %w", err)
+		return diff, err
+	}
+
+	diff.Skipped = p.skipped
+	written := make(map[DocumentRef]bool, len(p.planned))
+	for _, doc := range p.planned {
+		written[doc.ref] = true
+		copies, found := indexed[doc.ref.FilePath][doc.ref]
+		switch {
+		case !found:
+			diff.Added++
+			diff.AddedDocs = appendSample(diff.AddedDocs, doc.ref)
+		case copies[doc.fingerprint]:
+			diff.Unchanged++
+		default:
+			diff.Updated++
+			diff.UpdatedDocs = appendSample(diff.UpdatedDocs, doc.ref)
+		}
+	}
+
+	var deleted []DocumentRef
+	for filePath, refs := range indexed {
+		if p.skippedFiles[filePath] {
+			continue
+		}
+		for ref := range refs {
+			if !written[ref] {
+				deleted = append(deleted, ref)
+			}
+		}
+	}
+	slices.SortFunc(deleted, compareDocumentRefs)
+	diff.Deleted = len(deleted)
+	diff.DeletedDocs = deleted[:min(len(deleted), maxPreviewSamples)]
+	return diff, err
+}
+
+// appendSample lists a changed document unless maxPreviewSamples already are.
+func appendSample(samples []DocumentRef, ref DocumentRef) (appended []DocumentRef) {
+	appended = samples
+	if len(appended) < maxPreviewSamples {
+		appended = append(appended, ref)
+	}
+	return appended
+}
+
+// compareDocumentRefs orders documents by file, then declaration and chunk.
+func compareDocumentRefs(a DocumentRef, b DocumentRef) (order int) {
+	order = cmp.Or(
+		strings.Compare(a.FilePath, b.FilePath),
+		strings.Compare(a.FunctionName, b.FunctionName),
+		strings.Compare(a.Receiver, b.Receiver),
+		strings.Compare(a.Kind, b.Kind),
+		strings.Compare(a.BuildConstraint, b.BuildConstraint),
+		cmp.Compare(a.ChunkIndex, b.ChunkIndex),
+	)
+	return order
+}
+
+// PreviewAllRepos reports what indexing every repository cloned under the
+// repos path would change in the index, without writing to it, keyed by
+// repository. A repository that fails to walk is logged and left out.
+func (idx *Indexer) PreviewAllRepos(ctx context.Context) (diffs map[string]DocumentDiff, err error) {
+	diffs, _, err = idx.previewAllRepos(ctx, "")
+	return diffs, err
+}
+
+// PreviewPath reports what indexing the working tree of a local directory
+// would change in the index, as IndexPath would index it, without writing
+// to it. It returns the repository name the documents would have.
+func (idx *Indexer) PreviewPath(ctx context.Context, dir string, repoName string) (repo string, diff DocumentDiff, err error) {
+	var absDir string
+	absDir, repo, err = resolveLocalRepo(dir, repoName)
+	if err != nil {
+		return repo, diff, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	diff, _, err = idx.previewRepository(ctx, repo, absDir)
+	return repo, diff, err
+}
+
+// previewAllRepos runs a dry run over every cloned repository, reporting
+// progress and each repository's changes to the job with the given ID when
+// it is non-empty, and returns how many documents the run would index.
+// Nothing is written and no webhooks are notified.
+func (idx *Indexer) previewAllRepos(ctx context.Context, jobID string) (diffs map[string]DocumentDiff, totalCount int, err error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.Draining() {
+		err = ErrShuttingDown
+		return diffs, totalCount, err
+	}
+
+	var repos []string
+	repos, err = idx.clonedRepos()
+	if err != nil {
+		return diffs, totalCount, err
+	}
+
+	idx.jobs.start(jobID, repos)
+
+	diffs = make(map[string]DocumentDiff, len(repos))
+	for _, repo := range repos {
+		if idx.Draining() {
+			err = ErrShuttingDown
+			break
+		}
+
+		idx.jobs.repoStarted(jobID, repo)
+
+		diff, count, previewErr := idx.previewRepository(ctx, repo, filepath.Join(idx.config.ReposPath, repo))
+		idx.jobs.repoFinished(jobID, repo, count, previewErr)
+		if previewErr != nil {
+			idx.logger.Error("Failed to preview repository", "repo", repo, "error", previewErr)
+			continue
+		}
+
+		idx.jobs.repoDiff(jobID, repo, diff)
+		diffs[repo] = diff
+		totalCount += count
+	}
+
+	return diffs, totalCount, err
+}
+
+// previewRepository walks and parses a repository as indexRepository would,
+// skipping the files the manifest has unchanged, collecting its documents
+// instead of indexing them, and compares them with those indexed. No
+// summaries are generated, and neither the checkpoint, the manifest, dead
+// letters, parse failures, nor renames are recorded. It returns how many
+// documents a run would index.
+func (idx *Indexer) previewRepository(ctx context.Context, repoName string, repoPath string) (diff DocumentDiff, count int, err error) {
+	idx.logger.Info("Previewing repository", "repo", repoName)
+
+	commit, commitErr := gitHeadCommit(ctx, repoPath)
+	if commitErr != nil && isGitRepo(repoPath) {
+		idx.logger.Warn("Failed to read repository commit", "repo", repoName, "error", commitErr)
+	}
+
+	// The manifest is read to skip what a run would, but never saved.
+	manifest := idx.startManifest(ctx, repoName)
+	preview := newDocumentPreview()
+	idx.renames.begin(repoName)
+	count, err = idx.walkAndIndexRepo(ctx, idx.es, repoName, repoPath, commit, nil, nil, manifest, preview)
+	idx.renames.discard(repoName)
+	if err != nil {
+		return diff, count, err
+	}
+
+	diff, err = preview.diff(ctx, idx.es, repoName)
+	if err != nil {
+		return diff, count, err
+	}
+
+	idx.logger.Info("Previewed repository", "repo", repoName, "added", diff.Added, "updated", diff.Updated, "deleted", diff.Deleted, "unchanged", diff.Unchanged, "skipped", diff.Skipped)
+	return diff, count, err
+}
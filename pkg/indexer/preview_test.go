@@ -0,0 +1,134 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPreviewPath(t *testing.T) {
+	var mu sync.Mutex
+	var stored []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_doc"):
+			body, _ := io.ReadAll(r.Body)
+			stored = append(stored, fmt.Sprintf(`{"_id":"%d","_source":%s}`, len(stored), body))
+		case r.URL.Path == "/test-index/_search":
+			_, _ = fmt.Fprintf(w, `{"_scroll_id":"s1","hits":{"hits":[%s]}}`, strings.Join(stored, ","))
+			return
+		case r.URL.Path == "/_search/scroll":
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	repo := t.TempDir()
+	writeFile := func(name string, content string) {
+		err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	writeFile("a.go", "package main\n\nfunc A() {}\n")
+	writeFile("b.go", "package main\n\nfunc B() {}\n")
+	writeFile("c.go", "package main\n\nfunc C() {}\n")
+	writeFile("e.go", "package main\n\nfunc E() {}\n\nfunc Gone() {}\n")
+
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", Languages: []string{"go"}}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	_, err = idx.IndexPath(t.Context(), repo, "api")
+	if err != nil {
+		t.Fatalf("IndexPath() error = %v", err)
+	}
+	indexed := len(stored)
+
+	writeFile("a.go", "package main\n\n// A does nothing.\nfunc A() {}\n")
+	writeFile("b.go", "package main\n\nfunc B() { println() }\n")
+	writeFile("d.go", "package main\n\nfunc D() {}\n")
+	writeFile("e.go", "package main\n\nfunc E() {}\n")
+	err = os.Remove(filepath.Join(repo, "c.go"))
+	if err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+
+	name, diff, err := idx.PreviewPath(t.Context(), repo, "api")
+	if err != nil {
+		t.Fatalf("PreviewPath() error = %v", err)
+	}
+	if name != "api" || len(stored) != indexed {
+		t.Errorf("PreviewPath() previewed %q and wrote %d documents, want api and none", name, len(stored)-indexed)
+	}
+
+	// C's file is removed and Gone is removed from its file.
+	if diff.Added != 1 || diff.Updated != 2 || diff.Deleted != 2 || diff.Unchanged != 1 || diff.Skipped != 0 {
+		t.Errorf("diff = %+v, want 1 added, 2 updated, 2 deleted, 1 unchanged", diff)
+	}
+	if len(diff.AddedDocs) != 1 || diff.AddedDocs[0].FunctionName != "D" {
+		t.Errorf("added = %+v, want D", diff.AddedDocs)
+	}
+	if len(diff.UpdatedDocs) != 2 || diff.UpdatedDocs[0].FunctionName != "A" || diff.UpdatedDocs[1].FunctionName != "B" {
+		t.Errorf("updated = %+v, want A and B", diff.UpdatedDocs)
+	}
+	if len(diff.DeletedDocs) != 2 || diff.DeletedDocs[0].FunctionName != "C" || diff.DeletedDocs[1].FunctionName != "Gone" {
+		t.Errorf("deleted = %+v, want C and Gone", diff.DeletedDocs)
+	}
+
+	writeFile("a.go", "package main\n\nfunc A() {}\n")
+	_, diff, err = idx.PreviewPath(t.Context(), repo, "api")
+	if err != nil {
+		t.Fatalf("PreviewPath() error = %v", err)
+	}
+	if diff.Unchanged != 2 || diff.Updated != 1 {
+		t.Errorf("diff = %+v, want A and E unchanged and B updated", diff)
+	}
+}
+
+func TestDocumentFingerprint(t *testing.T) {
+	doc := elasticsearch.CodeDocument{Repo: "api", FilePath: "main.go", FunctionName: "Run", Code: "func Run() {}", Commit: "abc"}
+	rerun := doc
+	rerun.Commit = "def"
+	rerun.ID = "x"
+	rerun.Summary = "Runs."
+
+	if documentFingerprint(doc) != documentFingerprint(rerun) {
+		t.Error("a document indexed again at another commit has a new fingerprint")
+	}
+
+	changed := doc
+	changed.Code = "func Run() { println() }"
+	if documentFingerprint(doc) == documentFingerprint(changed) {
+		t.Error("a document with new code has the same fingerprint")
+	}
+
+	var stored elasticsearch.CodeDocument
+	data, _ := json.Marshal(doc)
+	_ = json.Unmarshal(data, &stored)
+	if documentFingerprint(doc) != documentFingerprint(stored) {
+		t.Error("a document read back from the index has a new fingerprint")
+	}
+}
@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+)
+
+// progressSubscriberBuffer is how many progress events a subscriber that
+// falls behind can have waiting before further ones are dropped for it.
+const progressSubscriberBuffer = 16
+
+// ProgressEvent reports how far an index run of a repository has got: the
+// files it has processed of those it will parse, the documents indexed so
+// far, and, once it has processed a file, an estimate of the seconds left at
+// its rate so far.
+type ProgressEvent struct {
+	Job              string    `json:"job,omitempty"`
+	Repo             string    `json:"repo"`
+	FilesProcessed   int       `json:"files_processed"`
+	FilesTotal       int       `json:"files_total"`
+	FunctionsIndexed int       `json:"functions_indexed"`
+	ETASeconds       int       `json:"eta_seconds"`
+	Time             time.Time `json:"time"`
+}
+
+// progressReporter reports a repository's run every PROGRESS_INTERVAL: in
+// the log, to the code_indexer_index_progress gauges, and to the running
+// reindex job, if any. A nil progressReporter reports nothing.
+type progressReporter struct {
+	repo      string
+	total     int
+	processed int
+	interval  time.Duration
+	started   time.Time
+	reported  time.Time
+	jobs      *jobTracker
+	metrics   *metrics.Metrics
+	logger    logging.Logger
+}
+
+// newProgressReporter starts reporting a run of the repository that will
+// parse total files.
+func newProgressReporter(idx *Indexer, repo string, total int) (reporter *progressReporter) {
+	now := time.Now()
+	reporter = &progressReporter{
+		repo:     repo,
+		total:    total,
+		interval: idx.config.ProgressInterval,
+		started:  now,
+		reported: now,
+		jobs:     idx.jobs,
+		metrics:  idx.metrics,
+		logger:   idx.logger,
+	}
+	reporter.report(0)
+	return reporter
+}
+
+// fileDone counts a file processed, with the documents indexed so far, and
+// reports once PROGRESS_INTERVAL has passed since the last report.
+func (p *progressReporter) fileDone(functions int) {
+	if p == nil {
+		return
+	}
+
+	p.processed++
+	if time.Since(p.reported) >= p.interval {
+		p.report(functions)
+	}
+}
+
+// finish reports the run's final count.
+func (p *progressReporter) finish(functions int) {
+	if p == nil {
+		return
+	}
+	p.report(functions)
+}
+
+// report sends the run's progress to the log, metrics, and job.
+func (p *progressReporter) report(functions int) {
+	now := time.Now()
+	p.reported = now
+
+	event := ProgressEvent{
+		Repo:             p.repo,
+		FilesProcessed:   p.processed,
+		FilesTotal:       max(p.total, p.processed),
+		FunctionsIndexed: functions,
+		Time:             now,
+	}
+	if p.processed > 0 {
+		perFile := now.Sub(p.started) / time.Duration(p.processed)
+		event.ETASeconds = int((perFile * time.Duration(event.FilesTotal-p.processed)).Seconds())
+		p.logger.Info("Indexing progress", "repo", p.repo, "files", event.FilesProcessed, "total", event.FilesTotal,
+			"functions", functions, "eta_seconds", event.ETASeconds)
+	}
+
+	if p.metrics != nil {
+		p.metrics.IndexProgress.WithLabelValues(p.repo, "files_processed").Set(float64(event.FilesProcessed))
+		p.metrics.IndexProgress.WithLabelValues(p.repo, "files_total").Set(float64(event.FilesTotal))
+		p.metrics.IndexProgress.WithLabelValues(p.repo, "functions_indexed").Set(float64(functions))
+		p.metrics.IndexProgress.WithLabelValues(p.repo, "eta_seconds").Set(float64(event.ETASeconds))
+	}
+
+	p.jobs.progress(event)
+}
@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+func TestProgressReporter(t *testing.T) {
+	tracker := newJobTracker()
+	job, err := tracker.create(ReindexOptions{})
+	if err != nil {
+		t.Fatalf("create() error = %v", err)
+	}
+	events, unsubscribe, found := tracker.subscribe(job.ID)
+	if !found {
+		t.Fatal("subscribe() didn't find the job")
+	}
+	defer unsubscribe()
+
+	reporter := &progressReporter{
+		repo:    "api",
+		total:   4,
+		started: time.Now().Add(-2 * time.Second),
+		jobs:    tracker,
+		logger:  logging.New(slog.New(slog.DiscardHandler)),
+	}
+
+	// Progress of a run that isn't the job's is ignored.
+	reporter.fileDone(3)
+	if len(events) != 0 {
+		t.Errorf("an untracked run sent %d events", len(events))
+	}
+
+	tracker.start(job.ID, []string{"api"})
+	tracker.repoStarted(job.ID, "api")
+	reporter.fileDone(7)
+
+	event := <-events
+	if event.Job != job.ID || event.Repo != "api" || event.FilesProcessed != 2 || event.FilesTotal != 4 || event.FunctionsIndexed != 7 {
+		t.Errorf("event = %+v, want 2 of 4 files and 7 functions of api", event)
+	}
+	if event.ETASeconds < 1 || event.ETASeconds > 3 {
+		t.Errorf("ETASeconds = %d, want about 2 for half the files in 2s", event.ETASeconds)
+	}
+
+	running, _ := tracker.get(job.ID)
+	if progress := running.Repos[0]; progress.FilesProcessed != 2 || progress.FilesTotal != 4 || progress.FunctionsIndexed != 7 {
+		t.Errorf("job progress = %+v, want 2 of 4 files and 7 functions", progress)
+	}
+
+	tracker.repoFinished(job.ID, "api", 7, nil)
+	tracker.finish(job.ID, nil)
+	if _, open := <-events; open {
+		t.Error("events still open after the job finished")
+	}
+
+	finished, _, _ := tracker.subscribe(job.ID)
+	if _, open := <-finished; open {
+		t.Error("subscribing to a finished job didn't close its events")
+	}
+	if _, _, found = tracker.subscribe("missing"); found {
+		t.Error("subscribe() found an unknown job")
+	}
+
+	var none *progressReporter
+	none.fileDone(1)
+	none.finish(1)
+}
+
+func TestCountFiles(t *testing.T) {
+	repo := t.TempDir()
+	files := map[string]string{
+		"main.go":             "package main\n",
+		"pkg/a.go":            "package pkg\n",
+		"pkg/notes.txt":       "notes\n",
+		"vendor/dep/dep.go":   "package dep\n",
+		"generated/gen.go":    "package generated\n",
+		".gitignore":          "generated/\n",
+		"docs/guide/index.md": "# Guide\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o750)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	fw, _ := newTestWalker(t, "repo")
+	fw.root = repo
+	fw.ignores = newIgnoreMatcher([]string{".gitignore"})
+
+	if got := fw.countFiles(); got != 3 {
+		t.Errorf("countFiles() = %d, want main.go, pkg/a.go, and docs/guide/index.md", got)
+	}
+	if got := fw.countFiles(); got != 3 {
+		t.Errorf("countFiles() a second time = %d, want 3", got)
+	}
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"errors"
+	"go/scanner"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// Error classes used as the class label on the ParseErrors metric: files
+// that failed to parse or read, and documents that couldn't be encoded or
+// that Elasticsearch rejected.
+const (
+	parseErrorClassSyntax   = "syntax"
+	parseErrorClassRead     = "read"
+	parseErrorClassEncode   = "encode"
+	parseErrorClassESReject = "es_reject"
+	parseErrorClassOther    = "other"
+)
+
+// ParseFailure describes a file that could not be parsed during indexing, or
+// a document from it that could not be indexed, by its path relative to the
+// repository root. Recovered counts the declarations still indexed from a
+// file with syntax errors.
+type ParseFailure struct {
+	Repo      string    `json:"repo"`
+	FilePath  string    `json:"file_path"`
+	Error     string    `json:"error"`
+	Class     string    `json:"class"`
+	Line      int       `json:"line"`
+	Recovered int       `json:"recovered"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// parseQuarantine holds the files that failed to parse in the latest run of
+// each repository. It is saved with the indexing state, so the list survives
+// a restart.
+type parseQuarantine struct {
+	mu     sync.RWMutex
+	byRepo map[string][]ParseFailure
+	store  *stateStore
+}
+
+// newParseQuarantine creates a quarantine holding the failures saved in the
+// state store.
+func newParseQuarantine(store *stateStore) (q *parseQuarantine) {
+	q = &parseQuarantine{
+		byRepo: store.parseFailures(),
+		store:  store,
+	}
+	return q
+}
+
+// replace sets the failures for a repository, dropping files that have since
+// been fixed, and saves them.
+func (q *parseQuarantine) replace(repo string, failures []ParseFailure) (err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(failures) == 0 {
+		delete(q.byRepo, repo)
+	} else {
+		q.byRepo[repo] = failures
+	}
+
+	err = q.store.saveParseFailures(repo, failures)
+	return err
+}
+
+// list returns the quarantined files, optionally filtered by repository,
+// sorted by repository and file path.
+func (q *parseQuarantine) list(repo string) (failures []ParseFailure) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	failures = make([]ParseFailure, 0)
+	for name, repoFailures := range q.byRepo {
+		if repo != "" && name != repo {
+			continue
+		}
+		failures = append(failures, repoFailures...)
+	}
+
+	sort.Slice(failures, func(i, j int) (less bool) {
+		if failures[i].Repo != failures[j].Repo {
+			less = failures[i].Repo < failures[j].Repo
+			return less
+		}
+		less = failures[i].FilePath < failures[j].FilePath
+		return less
+	})
+
+	return failures
+}
+
+// newParseFailure builds a quarantine entry for the file at rel, relative to
+// the repository root, extracting the first failing line
+// from Go scanner errors when available.
+func newParseFailure(repo string, rel string, err error) (failure ParseFailure) {
+	failure = ParseFailure{
+		Repo:     repo,
+		FilePath: rel,
+		Error:    err.Error(),
+		Class:    classifyParseError(err),
+		FailedAt: time.Now(),
+	}
+
+	var errList scanner.ErrorList
+	if errors.As(err, &errList) && len(errList) > 0 {
+		failure.Line = errList[0].Pos.Line
+		return failure
+	}
+
+	var scanErr *scanner.Error
+	if errors.As(err, &scanErr) {
+		failure.Line = scanErr.Pos.Line
+	}
+
+	return failure
+}
+
+// classifyParseError maps an indexing error to a bounded set of classes.
+func classifyParseError(err error) (class string) {
+	var errList scanner.ErrorList
+	var scanErr *scanner.Error
+	if errors.As(err, &errList) || errors.As(err, &scanErr) {
+		class = parseErrorClassSyntax
+		return class
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		class = parseErrorClassRead
+		return class
+	}
+
+	if errors.Is(err, elasticsearch.ErrEncode) {
+		class = parseErrorClassEncode
+		return class
+	}
+
+	if errors.Is(err, elasticsearch.ErrBadRequest) {
+		class = parseErrorClassESReject
+		return class
+	}
+
+	class = parseErrorClassOther
+	return class
+}
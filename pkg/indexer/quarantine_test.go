@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+func TestParseQuarantine(t *testing.T) {
+	logger := logging.New(slog.New(slog.DiscardHandler))
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := openStateStore(path, logger)
+	q := newParseQuarantine(store)
+
+	fw, _ := newTestWalker(t, "repo-a")
+	_, parseErr := fw.indexFile("testdata/invalid.go")
+	if parseErr == nil {
+		t.Fatal("Expected parse error for invalid file")
+	}
+
+	replaceFailures(t, q, "repo-b", []ParseFailure{newParseFailure("repo-b", "b.go", parseErr)})
+	replaceFailures(t, q, "repo-a", []ParseFailure{
+		newParseFailure("repo-a", "z.go", parseErr),
+		newParseFailure("repo-a", "testdata/invalid.go", parseErr),
+	})
+
+	all := q.list("")
+	if len(all) != 3 {
+		t.Fatalf("list() length = %d, want 3", len(all))
+	}
+	if all[0].Repo != "repo-a" || all[0].FilePath != "testdata/invalid.go" {
+		t.Errorf("list()[0] = %s/%s, want repo-a/testdata/invalid.go", all[0].Repo, all[0].FilePath)
+	}
+	if all[0].Line != 6 {
+		t.Errorf("Line = %d, want 6", all[0].Line)
+	}
+	if all[0].Class != parseErrorClassSyntax {
+		t.Errorf("Class = %v, want %v", all[0].Class, parseErrorClassSyntax)
+	}
+	if all[0].Error == "" {
+		t.Error("Error is empty")
+	}
+
+	filtered := q.list("repo-b")
+	if len(filtered) != 1 {
+		t.Errorf("list(repo-b) length = %d, want 1", len(filtered))
+	}
+
+	// Saving progress keeps the failures.
+	saveErr := store.save("repo-b", RepoCheckpoint{State: JobCompleted})
+	if saveErr != nil {
+		t.Fatalf("save() error = %v", saveErr)
+	}
+
+	// The quarantine survives a restart.
+	reloaded := newParseQuarantine(openStateStore(path, logger)).list("")
+	if len(reloaded) != 3 || reloaded[0].FilePath != "testdata/invalid.go" || reloaded[0].Line != 6 {
+		t.Errorf("list() after reload = %+v, want the 3 failures", reloaded)
+	}
+
+	replaceFailures(t, q, "repo-a", nil)
+	remaining := q.list("")
+	if len(remaining) != 1 {
+		t.Errorf("list() after fix length = %d, want 1", len(remaining))
+	}
+	if reloaded := newParseQuarantine(openStateStore(path, logger)).list(""); len(reloaded) != 1 {
+		t.Errorf("list() after fix and reload length = %d, want 1", len(reloaded))
+	}
+}
+
+// replaceFailures sets the repository's failures, failing the test if they
+// can't be saved.
+func replaceFailures(t *testing.T, q *parseQuarantine, repo string, failures []ParseFailure) {
+	t.Helper()
+
+	err := q.replace(repo, failures)
+	if err != nil {
+		t.Fatalf("replace() error = %v", err)
+	}
+}
+
+func TestClassifyParseError(t *testing.T) {
+	fw, _ := newTestWalker(t, "repo")
+	_, syntaxErr := fw.indexFile("testdata/invalid.go")
+	_, readErr := fw.indexFile("testdata/missing.go")
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "syntax error",
+			err:  syntaxErr,
+			want: parseErrorClassSyntax,
+		},
+		{
+			name: "read error",
+			err:  readErr,
+			want: parseErrorClassRead,
+		},
+		{
+			name: "document not encodable",
+			err:  fmt.Errorf("%w: json: unsupported value: NaN", elasticsearch.ErrEncode),
+			want: parseErrorClassEncode,
+		},
+		{
+			name: "document rejected",
+			err:  &elasticsearch.StatusError{StatusCode: 400, Status: "400 Bad Request"},
+			want: parseErrorClassESReject,
+		},
+		{
+			name: "elasticsearch unavailable",
+			err:  &elasticsearch.StatusError{StatusCode: 503, Status: "503 Service Unavailable"},
+			want: parseErrorClassOther,
+		},
+		{
+			name: "other error",
+			err:  errors.New("boom"),
+			want: parseErrorClassOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyParseError(tt.err)
+			if got != tt.want {
+				t.Errorf("classifyParseError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package indexer
+
+import (
+	"go/ast"
+	"sort"
+)
+
+// predeclaredTypes are Go's built-in type names, which reference no
+// declaration.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var predeclaredTypes = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true, "int8": true, "int16": true,
+	"int32": true, "int64": true, "rune": true, "string": true, "uint": true, "uint8": true,
+	"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+// referencedTypes lists the types a declaration refers to, sorted and
+// without duplicates: in its signature, its fields, and the composite
+// literals, variable declarations, type assertions, and new and make calls
+// of its body. Types are recorded as written: a bare name ("Config") for the
+// declaring package's own, or a qualified one ("http.Request"). Predeclared
+// types, the declaration's own name, and its type parameters are left out.
+// Without type information, a name in a conversion or a type switch case
+// isn't seen.
+func referencedTypes(node ast.Node, self string, typeParams *ast.FieldList) (refs []string) {
+	skip := map[string]bool{self: true}
+	if typeParams != nil {
+		for _, field := range typeParams.List {
+			for _, name := range field.Names {
+				skip[name.Name] = true
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !skip[name] && !predeclaredTypes[name] && !seen[name] {
+			seen[name] = true
+			refs = append(refs, name)
+		}
+	}
+
+	ast.Inspect(node, func(n ast.Node) (descend bool) {
+		descend = true
+
+		switch expr := n.(type) {
+		case *ast.Field:
+			typeNames(expr.Type, add)
+		case *ast.CompositeLit:
+			typeNames(expr.Type, add)
+		case *ast.ValueSpec:
+			typeNames(expr.Type, add)
+		case *ast.TypeAssertExpr:
+			typeNames(expr.Type, add)
+		case *ast.TypeSpec:
+			typeNames(expr.Type, add)
+		case *ast.CallExpr:
+			fun, ok := expr.Fun.(*ast.Ident)
+			if ok && (fun.Name == "new" || fun.Name == "make") && len(expr.Args) > 0 {
+				typeNames(expr.Args[0], add)
+			}
+		}
+		return descend
+	})
+
+	sort.Strings(refs)
+	return refs
+}
+
+// typeNames passes each named type in a type expression to add. Struct,
+// interface, and function types are left to the caller's walk, which sees
+// their fields.
+func typeNames(expr ast.Expr, add func(name string)) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		add(e.Name)
+	case *ast.SelectorExpr:
+		pkg, ok := e.X.(*ast.Ident)
+		if ok {
+			add(pkg.Name + "." + e.Sel.Name)
+		}
+	case *ast.StarExpr:
+		typeNames(e.X, add)
+	case *ast.ParenExpr:
+		typeNames(e.X, add)
+	case *ast.ArrayType:
+		typeNames(e.Elt, add)
+	case *ast.Ellipsis:
+		typeNames(e.Elt, add)
+	case *ast.MapType:
+		typeNames(e.Key, add)
+		typeNames(e.Value, add)
+	case *ast.ChanType:
+		typeNames(e.Value, add)
+	case *ast.IndexExpr:
+		typeNames(e.X, add)
+		typeNames(e.Index, add)
+	case *ast.IndexListExpr:
+		typeNames(e.X, add)
+		for _, index := range e.Indices {
+			typeNames(index, add)
+		}
+	}
+}
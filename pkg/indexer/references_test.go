@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"testing"
+)
+
+func TestReferencedTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{
+			name: "predeclared types only",
+			code: `func Foo(n int) (s string, err error) {
+	return s, err
+}`,
+			want: nil,
+		},
+		{
+			name: "signature, receiver, and body",
+			code: `func (s *Server) Handle(w http.ResponseWriter, r *http.Request) (resp Response) {
+	var opts Options
+	req := &SearchRequest{Query: r.URL.Query().Get("q")}
+	cache := make(map[string][]*Result)
+	if h, ok := s.handler.(Handler); ok {
+		h.Serve(req)
+	}
+	buf := new(bytes.Buffer)
+	return resp
+}`,
+			want: []string{"Handler", "Options", "Response", "Result", "SearchRequest", "Server", "bytes.Buffer", "http.Request", "http.ResponseWriter"},
+		},
+		{
+			name: "type parameters left out",
+			code: `func Map[T any, U Stringer](xs []T, fn func(T) U) (out []U) {
+	return out
+}`,
+			want: []string{"Stringer"},
+		},
+		{
+			name: "struct fields, without the type itself",
+			code: `type Node struct {
+	Parent   *Node
+	Children []*Node
+	Config   config.Config
+	Handlers map[string]func(Event) error
+}`,
+			want: []string{"Event", "config.Config"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			node, err := parser.ParseFile(fset, "", "package test\n\n"+tt.code, 0)
+			if err != nil {
+				t.Fatalf("Failed to parse code: %v", err)
+			}
+
+			var got []string
+			switch decl := node.Decls[0].(type) {
+			case *ast.FuncDecl:
+				got = referencedTypes(decl, "", decl.Type.TypeParams)
+			case *ast.GenDecl:
+				spec, _ := decl.Specs[0].(*ast.TypeSpec)
+				got = referencedTypes(spec, spec.Name.Name, spec.TypeParams)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("referencedTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
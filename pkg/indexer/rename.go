@@ -0,0 +1,244 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// renameEntry is a function seen in an index run: the hash of its content and
+// the identity it was renamed or moved from, if it was.
+type renameEntry struct {
+	Hash        string `json:"hash"`
+	RenamedFrom string `json:"renamed_from,omitempty"`
+}
+
+// renameFiles holds the functions seen in one index run of a repository, by
+// path relative to the repository root and then by declarationKey.
+type renameFiles map[string]map[string]renameEntry
+
+// renameRun is a completed index run of a repository, with its functions'
+// identities indexed by content hash. A hash shared by several functions
+// maps to an empty identity, since it can't identify a rename.
+type renameRun struct {
+	files  renameFiles
+	hashes map[string]string
+}
+
+// newRenameRun indexes the functions of a completed run by content hash.
+func newRenameRun(files renameFiles) (run *renameRun) {
+	run = &renameRun{
+		files:  files,
+		hashes: make(map[string]string),
+	}
+	for filePath, functions := range files {
+		for key, entry := range functions {
+			id := documentIdentity(filePath, key)
+			existing, seen := run.hashes[entry.Hash]
+			if seen && existing != id {
+				run.hashes[entry.Hash] = ""
+				continue
+			}
+			run.hashes[entry.Hash] = id
+		}
+	}
+	return run
+}
+
+// renameTracker remembers the functions seen in the previous index run of each
+// repository so functions that moved or were renamed can be detected. With a
+// path, the previous runs are kept in a JSON file, so detection survives a
+// restart and a renamed function keeps its RenamedFrom on later runs.
+type renameTracker struct {
+	path     string
+	mu       sync.Mutex
+	previous map[string]*renameRun
+	current  map[string]renameFiles
+}
+
+// openRenameTracker loads the runs saved at path. A missing file starts
+// empty; an unreadable one is logged and replaced on the next commit.
+func openRenameTracker(path string, logger logging.Logger) (tracker *renameTracker) {
+	tracker = &renameTracker{
+		path:     path,
+		previous: make(map[string]*renameRun),
+		current:  make(map[string]renameFiles),
+	}
+	if path == "" {
+		return tracker
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tracker
+	}
+	saved := make(map[string]renameFiles)
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		logger.Warn("Failed to load rename history, starting fresh", "path", path, "error", err)
+		return tracker
+	}
+
+	for repo, files := range saved {
+		tracker.previous[repo] = newRenameRun(files)
+	}
+	return tracker
+}
+
+// begin starts collecting functions for a new run of the given repository.
+func (rt *renameTracker) begin(repo string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.current[repo] = make(renameFiles)
+}
+
+// observe records the document, found in the file at rel, for the current
+// run. A function seen in the previous run keeps the RenamedFrom it had
+// there; a new one gets RenamedFrom when its content matches exactly one
+// function from the previous run under a different identity.
+func (rt *renameTracker) observe(repo string, rel string, doc *elasticsearch.CodeDocument) {
+	if doc.ContentHash == "" {
+		return
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	key := declarationKey(doc)
+	id := documentIdentity(rel, key)
+
+	previous, ok := rt.previous[repo]
+	if ok {
+		entry, existed := previous.files[rel][key]
+		prevID := previous.hashes[doc.ContentHash]
+		switch {
+		case existed:
+			doc.RenamedFrom = entry.RenamedFrom
+		case prevID != "" && prevID != id:
+			doc.RenamedFrom = prevID
+		}
+	}
+
+	current, ok := rt.current[repo]
+	if !ok {
+		return
+	}
+	if current[rel] == nil {
+		current[rel] = make(map[string]renameEntry)
+	}
+	current[rel][key] = renameEntry{Hash: doc.ContentHash, RenamedFrom: doc.RenamedFrom}
+}
+
+// carry copies the functions the previous run saw in the file at rel into
+// the current run, for a file the current run skips because it hasn't
+// changed or was indexed before an interruption.
+func (rt *renameTracker) carry(repo string, rel string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	current, ok := rt.current[repo]
+	previous, found := rt.previous[repo]
+	if !ok || !found {
+		return
+	}
+
+	functions, found := previous.files[rel]
+	if found && current[rel] == nil {
+		current[rel] = maps.Clone(functions)
+	}
+}
+
+// commit promotes the functions collected during the current run so the next
+// run of the repository compares against them, and saves them.
+func (rt *renameTracker) commit(repo string) (err error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	current, ok := rt.current[repo]
+	if !ok {
+		return err
+	}
+
+	rt.previous[repo] = newRenameRun(current)
+	delete(rt.current, repo)
+	err = rt.write()
+	return err
+}
+
+// discard drops the functions collected during a failed run of the repository.
+func (rt *renameTracker) discard(repo string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	delete(rt.current, repo)
+}
+
+// forget drops every function recorded for a deleted repository.
+func (rt *renameTracker) forget(repo string) (err error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	delete(rt.current, repo)
+	if _, found := rt.previous[repo]; !found {
+		return err
+	}
+	delete(rt.previous, repo)
+	err = rt.write()
+	return err
+}
+
+// write replaces the rename history file. The caller holds rt.mu.
+func (rt *renameTracker) write() (err error) {
+	if rt.path == "" {
+		return err
+	}
+
+	saved := make(map[string]renameFiles, len(rt.previous))
+	for repo, run := range rt.previous {
+		saved[repo] = run.files
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		err = fmt.Errorf("failed to encode rename history: %w", err)
+		return err
+	}
+
+	err = replaceFile(rt.path, data)
+	if err != nil {
+		err = fmt.Errorf("failed to write rename history: %w", err)
+	}
+	return err
+}
+
+// documentIdentity builds the identity used to refer to a function across
+// runs from its file's repository-relative path and its declarationKey.
+func documentIdentity(rel string, key string) (id string) {
+	id = rel + ":" + key
+	return id
+}
+
+// declarationKey names a document within its file: its name, qualified by
+// its receiver for a method, and its chunk for a chunk of a longer
+// declaration, so methods of different types and chunks of one declaration
+// don't collide.
+func declarationKey(doc *elasticsearch.CodeDocument) (key string) {
+	key = doc.FunctionName
+	if doc.Receiver != "" {
+		key = doc.Receiver + "." + key
+	}
+	if doc.ChunkIndex > 0 {
+		key += "#" + strconv.Itoa(doc.ChunkIndex)
+	}
+	return key
+}
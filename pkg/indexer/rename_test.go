@@ -0,0 +1,261 @@
+package indexer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRenameTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []elasticsearch.CodeDocument
+		current  elasticsearch.CodeDocument
+		want     string
+	}{
+		{
+			name:     "first run has no history",
+			previous: nil,
+			current:  elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "New", ContentHash: "h1"},
+			want:     "",
+		},
+		{
+			name: "renamed function",
+			previous: []elasticsearch.CodeDocument{
+				{FilePath: "a.go", FunctionName: "Old", ContentHash: "h1"},
+			},
+			current: elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "New", ContentHash: "h1"},
+			want:    "a.go:Old",
+		},
+		{
+			name: "moved function",
+			previous: []elasticsearch.CodeDocument{
+				{FilePath: "a.go", FunctionName: "Func", ContentHash: "h1"},
+			},
+			current: elasticsearch.CodeDocument{FilePath: "b.go", FunctionName: "Func", ContentHash: "h1"},
+			want:    "a.go:Func",
+		},
+		{
+			name: "unchanged function",
+			previous: []elasticsearch.CodeDocument{
+				{FilePath: "a.go", FunctionName: "Func", ContentHash: "h1"},
+			},
+			current: elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "Func", ContentHash: "h1"},
+			want:    "",
+		},
+		{
+			name: "existing identity is not a rename",
+			previous: []elasticsearch.CodeDocument{
+				{FilePath: "a.go", FunctionName: "Old", ContentHash: "h1"},
+				{FilePath: "a.go", FunctionName: "Func", ContentHash: "h2"},
+			},
+			current: elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "Func", ContentHash: "h1"},
+			want:    "",
+		},
+		{
+			name: "moved method with a same-named method on another receiver",
+			previous: []elasticsearch.CodeDocument{
+				{FilePath: "a.go", FunctionName: "Close", Receiver: "Reader", ContentHash: "h1"},
+				{FilePath: "a.go", FunctionName: "Close", Receiver: "Writer", ContentHash: "h2"},
+			},
+			current: elasticsearch.CodeDocument{FilePath: "b.go", FunctionName: "Close", Receiver: "Reader", ContentHash: "h1"},
+			want:    "a.go:Reader.Close",
+		},
+		{
+			name: "moved chunk",
+			previous: []elasticsearch.CodeDocument{
+				{FilePath: "a.go", FunctionName: "Long", ChunkIndex: 1, ContentHash: "h1"},
+				{FilePath: "a.go", FunctionName: "Long", ChunkIndex: 2, ContentHash: "h2"},
+			},
+			current: elasticsearch.CodeDocument{FilePath: "b.go", FunctionName: "Long", ChunkIndex: 1, ContentHash: "h1"},
+			want:    "a.go:Long#1",
+		},
+		{
+			name: "ambiguous hash",
+			previous: []elasticsearch.CodeDocument{
+				{FilePath: "a.go", FunctionName: "One", ContentHash: "h1"},
+				{FilePath: "a.go", FunctionName: "Two", ContentHash: "h1"},
+			},
+			current: elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "Three", ContentHash: "h1"},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := openRenameTracker("", logging.New(slog.New(slog.DiscardHandler)))
+
+			if tt.previous != nil {
+				tracker.begin("repo")
+				for i := range tt.previous {
+					tracker.observe("repo", tt.previous[i].FilePath, &tt.previous[i])
+				}
+				commitRenames(t, tracker, "repo")
+			}
+
+			tracker.begin("repo")
+			doc := tt.current
+			tracker.observe("repo", doc.FilePath, &doc)
+
+			if doc.RenamedFrom != tt.want {
+				t.Errorf("RenamedFrom = %q, want %q", doc.RenamedFrom, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameTrackerDiscard(t *testing.T) {
+	tracker := openRenameTracker("", logging.New(slog.New(slog.DiscardHandler)))
+
+	tracker.begin("repo")
+	old := elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "Old", ContentHash: "h1"}
+	tracker.observe("repo", old.FilePath, &old)
+	commitRenames(t, tracker, "repo")
+
+	tracker.begin("repo")
+	failed := elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "Other", ContentHash: "h2"}
+	tracker.observe("repo", failed.FilePath, &failed)
+	tracker.discard("repo")
+
+	tracker.begin("repo")
+	renamed := elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "New", ContentHash: "h1"}
+	tracker.observe("repo", renamed.FilePath, &renamed)
+
+	if renamed.RenamedFrom != "a.go:Old" {
+		t.Errorf("RenamedFrom = %q, want %q", renamed.RenamedFrom, "a.go:Old")
+	}
+}
+
+func TestRenameTrackerPersists(t *testing.T) {
+	logger := logging.New(slog.New(slog.DiscardHandler))
+	path := filepath.Join(t.TempDir(), "renames.json")
+
+	tracker := openRenameTracker(path, logger)
+	tracker.begin("repo")
+	old := elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "Old", ContentHash: "h1"}
+	tracker.observe("repo", old.FilePath, &old)
+	kept := elasticsearch.CodeDocument{FilePath: "b.go", FunctionName: "Kept", ContentHash: "h2"}
+	tracker.observe("repo", kept.FilePath, &kept)
+	commitRenames(t, tracker, "repo")
+
+	// A restart still detects the rename.
+	tracker = openRenameTracker(path, logger)
+	tracker.begin("repo")
+	renamed := elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "New", ContentHash: "h1"}
+	tracker.observe("repo", renamed.FilePath, &renamed)
+	if renamed.RenamedFrom != "a.go:Old" {
+		t.Errorf("RenamedFrom after restart = %q, want %q", renamed.RenamedFrom, "a.go:Old")
+	}
+	// b.go was indexed before an interruption, so its functions carry over.
+	tracker.carry("repo", "b.go")
+	commitRenames(t, tracker, "repo")
+
+	// Later runs keep the rename, even once the function is edited.
+	tracker = openRenameTracker(path, logger)
+	tracker.begin("repo")
+	edited := elasticsearch.CodeDocument{FilePath: "a.go", FunctionName: "New", ContentHash: "h3"}
+	tracker.observe("repo", edited.FilePath, &edited)
+	if edited.RenamedFrom != "a.go:Old" {
+		t.Errorf("RenamedFrom on a later run = %q, want %q", edited.RenamedFrom, "a.go:Old")
+	}
+	moved := elasticsearch.CodeDocument{FilePath: "c.go", FunctionName: "Kept", ContentHash: "h2"}
+	tracker.observe("repo", moved.FilePath, &moved)
+	if moved.RenamedFrom != "b.go:Kept" {
+		t.Errorf("RenamedFrom of a function from a skipped file = %q, want %q", moved.RenamedFrom, "b.go:Kept")
+	}
+	commitRenames(t, tracker, "repo")
+
+	err := tracker.forget("repo")
+	if err != nil {
+		t.Fatalf("forget() error = %v", err)
+	}
+	tracker = openRenameTracker(path, logger)
+	tracker.begin("repo")
+	again := elasticsearch.CodeDocument{FilePath: "d.go", FunctionName: "New", ContentHash: "h3"}
+	tracker.observe("repo", again.FilePath, &again)
+	if again.RenamedFrom != "" {
+		t.Errorf("RenamedFrom after forget = %q, want none", again.RenamedFrom)
+	}
+}
+
+func TestIndexPathRenamedFrom(t *testing.T) {
+	var mu sync.Mutex
+	var docs []elasticsearch.CodeDocument
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_doc") {
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			mu.Lock()
+			docs = append(docs, doc)
+			mu.Unlock()
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", Languages: []string{"go"}}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	repo := t.TempDir()
+	code := "package main\n\ntype Reader struct{}\n\ntype Writer struct{}\n\n" +
+		"func (Reader) Close() error { return nil }\n\nfunc (Writer) Close() error { println(); return nil }\n"
+	err = os.WriteFile(filepath.Join(repo, "a.go"), []byte(code), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	_, err = idx.IndexPath(t.Context(), repo, "api")
+	if err != nil {
+		t.Fatalf("IndexPath() error = %v", err)
+	}
+
+	err = os.Rename(filepath.Join(repo, "a.go"), filepath.Join(repo, "b.go"))
+	if err != nil {
+		t.Fatalf("failed to move file: %v", err)
+	}
+	docs = nil
+	_, err = idx.IndexPath(t.Context(), repo, "api")
+	if err != nil {
+		t.Fatalf("IndexPath() error = %v", err)
+	}
+
+	got := map[string]string{}
+	for _, doc := range docs {
+		if doc.FunctionName == "Close" {
+			got[doc.Receiver] = doc.RenamedFrom
+		}
+	}
+	want := map[string]string{"Reader": "a.go:Reader.Close", "Writer": "a.go:Writer.Close"}
+	for receiver, renamedFrom := range want {
+		if got[receiver] != renamedFrom {
+			t.Errorf("RenamedFrom of %s.Close = %q, want %q", receiver, got[receiver], renamedFrom)
+		}
+	}
+}
+
+// commitRenames commits the repository's run, failing the test if it can't
+// be saved.
+func commitRenames(t *testing.T, tracker *renameTracker, repo string) {
+	t.Helper()
+
+	err := tracker.commit(repo)
+	if err != nil {
+		t.Fatalf("commit() error = %v", err)
+	}
+}
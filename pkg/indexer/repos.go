@@ -0,0 +1,235 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidRepoName is returned for a repository name that isn't a single
+// directory under REPOS_PATH, or under a source's directory.
+var ErrInvalidRepoName = errors.New("invalid repository name")
+
+// ErrRepoNotFound is returned by DeleteRepo for a repository with neither
+// indexed documents nor a clone.
+var ErrRepoNotFound = errors.New("repository not found")
+
+// RepoDeletion reports what was removed for a deleted repository.
+type RepoDeletion struct {
+	Repo         string `json:"repo"`
+	Deleted      int64  `json:"deleted"`
+	CloneRemoved bool   `json:"clone_removed"`
+}
+
+// validRepoName reports whether name names a directory directly under
+// REPOS_PATH, or a source's repository as source/repo.
+func validRepoName(name string) (valid bool) {
+	source, repo, qualified := strings.Cut(name, "/")
+	if qualified && !validRepoComponent(source) {
+		return valid
+	}
+	if !qualified {
+		repo = source
+	}
+
+	valid = validRepoComponent(repo)
+	return valid
+}
+
+// validRepoComponent reports whether name is a single directory name.
+func validRepoComponent(name string) (valid bool) {
+	valid = name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+	return valid
+}
+
+// DeleteRepo removes a repository's documents and its clone under REPOS_PATH,
+// along with its run history and parse errors. It returns
+// ErrReindexInProgress rather than wait while an index run holds the
+// repositories. A repository still in GIT_REPOS is cloned and indexed again
+// by the next run.
+func (idx *Indexer) DeleteRepo(ctx context.Context, repo string) (deletion RepoDeletion, err error) {
+	if !validRepoName(repo) {
+		err = fmt.Errorf("%w: %q", ErrInvalidRepoName, repo)
+		return deletion, err
+	}
+
+	if !idx.mu.TryLock() {
+		err = ErrReindexInProgress
+		return deletion, err
+	}
+	defer idx.mu.Unlock()
+
+	deletion, err = idx.deleteRepo(ctx, repo)
+	if err != nil {
+		return deletion, err
+	}
+	if deletion.Deleted == 0 && !deletion.CloneRemoved {
+		err = fmt.Errorf("%w: %s", ErrRepoNotFound, repo)
+	}
+	return deletion, err
+}
+
+// UpdateAndIndexRepo clones a repository of GIT_ORG, or source/repo of a
+// source, under REPOS_PATH, or fetches it when already cloned, and indexes
+// it. It waits for a run in
+// progress and while indexing is paused. Queue workers index each job's
+// repository through it.
+func (idx *Indexer) UpdateAndIndexRepo(ctx context.Context, repo string) (count int, err error) {
+	if !validRepoName(repo) {
+		err = fmt.Errorf("%w: %q", ErrInvalidRepoName, repo)
+		return count, err
+	}
+	_, _, found := idx.config.RepoSource(repo)
+	if !found {
+		err = ErrGitConfigRequired
+		return count, err
+	}
+
+	err = idx.pause.wait(ctx)
+	if err != nil {
+		return count, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.Draining() {
+		err = ErrShuttingDown
+		return count, err
+	}
+
+	err = os.MkdirAll(idx.config.ReposPath, 0755)
+	if err != nil {
+		err = fmt.Errorf("failed to create repos directory: %w", err)
+		return count, err
+	}
+
+	err = idx.cloneOrUpdateRepo(ctx, repo)
+	if err != nil {
+		err = fmt.Errorf("failed to update %s: %w", repo, err)
+		return count, err
+	}
+
+	count, err = idx.indexRepository(ctx, idx.es, repo, filepath.Join(idx.config.ReposPath, repo))
+	if err == nil {
+		idx.metrics.ReposIndexed.Inc()
+	}
+	return count, err
+}
+
+// PruneRepos deletes every repository that has documents in the index or a
+// clone under REPOS_PATH but is no longer listed in GIT_REPOS or a source's
+// repos, or discovered for a source that doesn't list them. It refuses to
+// run without any, which would prune everything, and when discovery fails,
+// which could prune repositories that still exist. Repositories that fail
+// to delete are logged and left for the next prune.
+func (idx *Indexer) PruneRepos(ctx context.Context) (deletions []RepoDeletion, err error) {
+	var configured []string
+	configured, err = idx.RepoNames(ctx)
+	if err != nil {
+		return deletions, err
+	}
+	if len(configured) == 0 {
+		err = ErrGitConfigRequired
+		return deletions, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var counts map[string]int64
+	counts, err = idx.es.RepoDocumentCounts(ctx)
+	if err != nil {
+		return deletions, err
+	}
+
+	known := make(map[string]bool, len(counts))
+	for repo := range counts {
+		known[repo] = true
+	}
+
+	var cloned []string
+	cloned, err = idx.clonedRepos()
+	if err != nil {
+		return deletions, err
+	}
+	for _, repo := range cloned {
+		known[repo] = true
+	}
+
+	var stale []string
+	for repo := range known {
+		if !slices.Contains(configured, repo) {
+			stale = append(stale, repo)
+		}
+	}
+	sort.Strings(stale)
+
+	for _, repo := range stale {
+		deletion, deleteErr := idx.deleteRepo(ctx, repo)
+		if deleteErr != nil {
+			idx.logger.Warn("Failed to prune repository", "repo", repo, "error", deleteErr)
+			continue
+		}
+		idx.logger.Info("Pruned repository no longer configured", "repo", repo, "documents", deletion.Deleted, "clone_removed", deletion.CloneRemoved)
+		deletions = append(deletions, deletion)
+	}
+
+	return deletions, err
+}
+
+// deleteRepo removes a repository's documents, clone, and in-memory state.
+// The caller holds idx.mu. A name that can't be a directory under REPOS_PATH,
+// such as one indexed from -path, only has its documents removed.
+func (idx *Indexer) deleteRepo(ctx context.Context, repo string) (deletion RepoDeletion, err error) {
+	deletion = RepoDeletion{Repo: repo}
+
+	deletion.Deleted, err = idx.es.DeleteRepoDocuments(ctx, repo)
+	if err != nil {
+		return deletion, err
+	}
+
+	if validRepoName(repo) {
+		clone := filepath.Join(idx.config.ReposPath, repo)
+		_, statErr := os.Lstat(clone)
+		if statErr == nil {
+			err = os.RemoveAll(clone)
+			if err != nil {
+				err = fmt.Errorf("failed to remove clone of %s: %w", repo, err)
+				return deletion, err
+			}
+			deletion.CloneRemoved = true
+		}
+	}
+
+	forgetErr := idx.state.forget(repo)
+	if forgetErr != nil {
+		idx.logger.Warn("Failed to remove indexing state", "repo", repo, "error", forgetErr)
+	}
+	forgetErr = idx.manifests.forget(repo)
+	if forgetErr != nil {
+		idx.logger.Warn("Failed to remove file manifest", "repo", repo, "error", forgetErr)
+	}
+	idx.history.forget(repo)
+	idx.deadLetters.drop(repo)
+	idx.flushDeadLetters()
+	forgetErr = idx.quarantine.replace(repo, nil)
+	if forgetErr != nil {
+		idx.logger.Warn("Failed to remove parse failures", "repo", repo, "error", forgetErr)
+	}
+	forgetErr = idx.renames.forget(repo)
+	if forgetErr != nil {
+		idx.logger.Warn("Failed to remove rename history", "repo", repo, "error", forgetErr)
+	}
+	idx.metrics.ForgetRepo(repo)
+
+	if deletion.Deleted > 0 {
+		idx.notifications.publish(Notification{Type: NotificationDocumentsDeleted, Repo: repo, Deleted: deletion.Deleted})
+	}
+	return deletion, err
+}
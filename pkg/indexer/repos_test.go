@@ -0,0 +1,229 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// repoDeleteServer fakes Elasticsearch for repository deletion: counts holds
+// each repository's documents, and delete-by-query requests remove them.
+func repoDeleteServer(t *testing.T, counts map[string]int64) (srv *httptest.Server, deletedRepos func() []string) {
+	var mu sync.Mutex
+	var deleted []string
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_delete_by_query"):
+			var body struct {
+				Query struct {
+					Term map[string]string `json:"term"`
+				} `json:"query"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			repo := body.Query.Term["repo"]
+			deleted = append(deleted, repo)
+			_ = json.NewEncoder(w).Encode(map[string]int64{"deleted": counts[repo]})
+
+		case strings.HasSuffix(r.URL.Path, "/_search"):
+			var buckets []map[string]interface{}
+			for repo, count := range counts {
+				buckets = append(buckets, map[string]interface{}{"key": repo, "doc_count": count})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"aggregations": map[string]interface{}{"repos": map[string]interface{}{"buckets": buckets}},
+			})
+
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	deletedRepos = func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Sorted(slices.Values(deleted))
+	}
+	return srv, deletedRepos
+}
+
+// makeClone creates a directory that looks like a git clone under reposPath.
+func makeClone(t *testing.T, reposPath string, repo string) {
+	err := os.MkdirAll(filepath.Join(reposPath, repo, ".git"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create clone: %v", err)
+	}
+}
+
+func TestDeleteRepo(t *testing.T) {
+	tests := []struct {
+		name        string
+		repo        string
+		clone       bool
+		documents   int64
+		wantErr     error
+		wantDeleted int64
+		wantRemoved bool
+	}{
+		{name: "documents and clone", repo: "api", clone: true, documents: 12, wantDeleted: 12, wantRemoved: true},
+		{name: "clone only", repo: "api", clone: true, wantRemoved: true},
+		{name: "documents only", repo: "api", documents: 3, wantDeleted: 3},
+		{name: "unknown repo", repo: "api", wantErr: ErrRepoNotFound},
+		{name: "source repo", repo: "gitlab/deploy", clone: true, documents: 5, wantDeleted: 5, wantRemoved: true},
+		{name: "escaping name", repo: "..", wantErr: ErrInvalidRepoName},
+		{name: "escaping source repo", repo: "gitlab/..", wantErr: ErrInvalidRepoName},
+		{name: "nested name", repo: "gitlab/platform/deploy", wantErr: ErrInvalidRepoName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := repoDeleteServer(t, map[string]int64{tt.repo: tt.documents})
+			reposPath := t.TempDir()
+			if tt.clone {
+				makeClone(t, reposPath, tt.repo)
+			}
+
+			cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", ReposPath: reposPath}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, clientErr := elasticsearch.NewClient(cfg, m)
+			if clientErr != nil {
+				t.Fatalf("NewClient() error = %v", clientErr)
+			}
+			idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+			quarantineErr := idx.quarantine.replace(tt.repo, []ParseFailure{{Repo: tt.repo, FilePath: "broken.go"}})
+			if quarantineErr != nil {
+				t.Fatalf("replace() error = %v", quarantineErr)
+			}
+
+			deletion, err := idx.DeleteRepo(t.Context(), tt.repo)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DeleteRepo() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DeleteRepo() error = %v", err)
+			}
+
+			if deletion.Deleted != tt.wantDeleted || deletion.CloneRemoved != tt.wantRemoved {
+				t.Errorf("DeleteRepo() = %+v, want %d deleted, clone removed %v", deletion, tt.wantDeleted, tt.wantRemoved)
+			}
+			_, statErr := os.Stat(filepath.Join(reposPath, tt.repo))
+			if !os.IsNotExist(statErr) {
+				t.Errorf("clone still exists: %v", statErr)
+			}
+			if failures := idx.ParseFailures(tt.repo); len(failures) != 0 {
+				t.Errorf("ParseFailures() = %v, want none", failures)
+			}
+		})
+	}
+}
+
+func TestDeleteRepoDuringIndexing(t *testing.T) {
+	srv, deletedRepos := repoDeleteServer(t, map[string]int64{"api": 1})
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", ReposPath: t.TempDir()}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, clientErr := elasticsearch.NewClient(cfg, m)
+	if clientErr != nil {
+		t.Fatalf("NewClient() error = %v", clientErr)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	idx.mu.Lock()
+	_, err := idx.DeleteRepo(t.Context(), "api")
+	idx.mu.Unlock()
+
+	if !errors.Is(err, ErrReindexInProgress) {
+		t.Errorf("DeleteRepo() error = %v, want %v", err, ErrReindexInProgress)
+	}
+	if deleted := deletedRepos(); len(deleted) != 0 {
+		t.Errorf("deleted = %v, want none", deleted)
+	}
+}
+
+func TestPruneRepos(t *testing.T) {
+	srv, deletedRepos := repoDeleteServer(t, map[string]int64{"api": 10, "old-docs": 4})
+	reposPath := t.TempDir()
+	makeClone(t, reposPath, "api")
+	makeClone(t, reposPath, "old-clone")
+	makeClone(t, reposPath, "gitlab/deploy")
+	makeClone(t, reposPath, "gitlab/retired")
+	err := os.MkdirAll(filepath.Join(reposPath, "scratch"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	cfg := config.Config{
+		ESHost:    srv.URL,
+		ESIndex:   "test-index",
+		ReposPath: reposPath,
+		GitRepos:  []string{"api"},
+		Sources:   []config.SourceConfig{{Name: "gitlab", Org: "platform", Repos: []config.RepoConfig{{Name: "deploy"}}}},
+	}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, clientErr := elasticsearch.NewClient(cfg, m)
+	if clientErr != nil {
+		t.Fatalf("NewClient() error = %v", clientErr)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	deletions, err := idx.PruneRepos(t.Context())
+	if err != nil {
+		t.Fatalf("PruneRepos() error = %v", err)
+	}
+
+	want := []RepoDeletion{
+		{Repo: "gitlab/retired", CloneRemoved: true},
+		{Repo: "old-clone", CloneRemoved: true},
+		{Repo: "old-docs", Deleted: 4},
+	}
+	if !slices.Equal(deletions, want) {
+		t.Errorf("PruneRepos() = %+v, want %+v", deletions, want)
+	}
+	if deleted := deletedRepos(); !slices.Equal(deleted, []string{"gitlab/retired", "old-clone", "old-docs"}) {
+		t.Errorf("deleted = %v, want gitlab/retired, old-clone, and old-docs", deleted)
+	}
+	for dir, wantExists := range map[string]bool{"api": true, "gitlab/deploy": true, "gitlab/retired": false, "old-clone": false, "scratch": true} {
+		_, statErr := os.Stat(filepath.Join(reposPath, dir))
+		if (statErr == nil) != wantExists {
+			t.Errorf("%s exists = %v, want %v", dir, statErr == nil, wantExists)
+		}
+	}
+}
+
+func TestPruneReposWithoutGitRepos(t *testing.T) {
+	srv, deletedRepos := repoDeleteServer(t, map[string]int64{"api": 10})
+	cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", ReposPath: t.TempDir()}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, clientErr := elasticsearch.NewClient(cfg, m)
+	if clientErr != nil {
+		t.Fatalf("NewClient() error = %v", clientErr)
+	}
+	idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	_, err := idx.PruneRepos(t.Context())
+	if !errors.Is(err, ErrGitConfigRequired) {
+		t.Errorf("PruneRepos() error = %v, want %v", err, ErrGitConfigRequired)
+	}
+	if deleted := deletedRepos(); len(deleted) != 0 {
+		t.Errorf("deleted = %v, want none", deleted)
+	}
+}
@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"context"
+	"time"
+)
+
+// PruneStale deletes the documents whose indexed_at is older than
+// RETENTION_DAYS, returning how many were removed. Every run rewrites the
+// documents of the files it indexes, so these are documents of files since
+// deleted and of repositories no longer indexed. It does nothing when
+// RETENTION_DAYS isn't set.
+func (idx *Indexer) PruneStale(ctx context.Context) (deleted int64, err error) {
+	retention := idx.config.Retention()
+	if retention <= 0 {
+		return deleted, err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	deleted, err = idx.es.DeleteDocumentsIndexedBefore(ctx, cutoff)
+	if err != nil {
+		return deleted, err
+	}
+	idx.logger.Info("Pruned stale documents", "index", idx.es.Index(), "indexed_before", cutoff.UTC().Format(time.RFC3339), "deleted", deleted)
+	if deleted > 0 {
+		idx.notifications.publish(Notification{Type: NotificationDocumentsDeleted, Index: idx.es.Index(), Deleted: deleted})
+	}
+	return deleted, err
+}
+
+// RunRetentionLoop prunes stale documents every RETENTION_INTERVAL until ctx
+// is done. While indexing is paused or draining nothing is refreshed, so
+// pruning waits too. A failed pass is logged and retried at the next
+// interval.
+func (idx *Indexer) RunRetentionLoop(ctx context.Context) {
+	ticker := time.NewTicker(idx.config.RetentionInterval)
+	defer ticker.Stop()
+
+	idx.logger.Info("Starting retention loop", "interval", idx.config.RetentionInterval, "retention_days", idx.config.RetentionDays)
+
+	for {
+		select {
+		case <-ticker.C:
+			if idx.Draining() || idx.pause.status().Paused {
+				idx.logger.Info("Indexing paused, skipping retention pass")
+				continue
+			}
+
+			_, err := idx.PruneStale(ctx)
+			if err != nil {
+				idx.logger.Error("Retention pass failed", "error", err)
+			}
+
+		case <-ctx.Done():
+			idx.logger.Info("Retention loop stopped")
+			return
+		}
+	}
+}
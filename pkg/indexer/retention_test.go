@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPruneStale(t *testing.T) {
+	tests := []struct {
+		name        string
+		days        int
+		wantRequest bool
+		wantDeleted int64
+	}{
+		{name: "retention disabled", days: 0},
+		{name: "retention set", days: 30, wantRequest: true, wantDeleted: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cutoff string
+			requested := false
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/code-index/_delete_by_query" {
+					_, _ = w.Write([]byte(`{}`))
+					return
+				}
+				requested = true
+				var body struct {
+					Query struct {
+						Range map[string]map[string]string `json:"range"`
+					} `json:"query"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				cutoff = body.Query.Range["indexed_at"]["lt"]
+				_, _ = w.Write([]byte(`{"deleted":4}`))
+			}))
+			defer srv.Close()
+
+			cfg := config.Config{ESHost: srv.URL, ESIndex: "code-index", RetentionDays: tt.days}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, err := elasticsearch.NewClient(cfg, m)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+			deleted, err := idx.PruneStale(t.Context())
+			if err != nil {
+				t.Fatalf("PruneStale() error = %v", err)
+			}
+
+			if deleted != tt.wantDeleted {
+				t.Errorf("deleted = %d, want %d", deleted, tt.wantDeleted)
+			}
+			if requested != tt.wantRequest {
+				t.Fatalf("requested = %v, want %v", requested, tt.wantRequest)
+			}
+			if !tt.wantRequest {
+				return
+			}
+
+			got, err := time.Parse(time.RFC3339, cutoff)
+			if err != nil {
+				t.Fatalf("cutoff %q: %v", cutoff, err)
+			}
+			want := time.Now().Add(-time.Duration(tt.days) * 24 * time.Hour)
+			if got.Before(want.Add(-time.Minute)) || got.After(want.Add(time.Minute)) {
+				t.Errorf("cutoff = %v, want about %v", got, want)
+			}
+		})
+	}
+}
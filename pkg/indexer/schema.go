@@ -0,0 +1,46 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// MigrateSchema checks the index's mapping against the indexer's schema
+// version. Bootstrapping already added missing fields; with SCHEMA_MIGRATION
+// rebuild, an index still behind is rebuilt from the repositories into a new
+// generation, which the alias is swapped to. Otherwise a mismatch is only
+// logged, with the fields that need a rebuild. rebuilt reports whether a
+// rebuild ran and succeeded, so the caller can skip its own full index.
+func (idx *Indexer) MigrateSchema(ctx context.Context) (rebuilt bool, err error) {
+	var status elasticsearch.SchemaStatus
+	status, err = idx.es.Schema(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to read index schema: %w", err)
+		return rebuilt, err
+	}
+	if status.Current() {
+		return rebuilt, err
+	}
+
+	if idx.config.SchemaMigration != config.SchemaMigrationRebuild {
+		idx.logger.Warn("Index schema is out of date; set SCHEMA_MIGRATION=rebuild or start a rebuild to update it",
+			"index", idx.es.Index(), "version", status.Version, "wanted", status.Wanted,
+			"missing", status.Missing, "conflicts", status.Conflicts)
+		return rebuilt, err
+	}
+
+	idx.logger.Info("Index schema is out of date, rebuilding",
+		"index", idx.es.Index(), "version", status.Version, "wanted", status.Wanted,
+		"missing", status.Missing, "conflicts", status.Conflicts)
+	_, err = idx.indexAllRepos(ctx, "", ReindexOptions{Rebuild: true})
+	if err != nil {
+		err = fmt.Errorf("schema migration rebuild failed: %w", err)
+		return rebuilt, err
+	}
+
+	rebuilt = true
+	return rebuilt, err
+}
@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMigrateSchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		migration   string
+		mapping     string
+		wantRebuilt bool
+	}{
+		{
+			name:        "outdated with rebuild",
+			migration:   config.SchemaMigrationRebuild,
+			mapping:     `{"code-index": {"mappings": {"properties": {"repo": {"type": "keyword"}}}}}`,
+			wantRebuilt: true,
+		},
+		{
+			name:      "outdated without rebuild",
+			migration: config.SchemaMigrationNone,
+			mapping:   `{"code-index": {"mappings": {"properties": {"repo": {"type": "keyword"}}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				mu.Unlock()
+
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/code-index/_mapping":
+					_, _ = w.Write([]byte(tt.mapping))
+				case r.Method == http.MethodHead:
+					w.WriteHeader(http.StatusNotFound)
+				default:
+					_, _ = w.Write([]byte(`{}`))
+				}
+			}))
+			defer srv.Close()
+
+			cfg := config.Config{
+				ESHost:             srv.URL,
+				ESIndex:            "code-index",
+				ESGenerationFormat: "2006-01-02-150405",
+				ESGenerationsKept:  2,
+				ReposPath:          t.TempDir(),
+				SchemaMigration:    tt.migration,
+			}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, err := elasticsearch.NewClient(cfg, m)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+
+			rebuilt, err := idx.MigrateSchema(t.Context())
+			if err != nil {
+				t.Fatalf("MigrateSchema() error = %v", err)
+			}
+			if rebuilt != tt.wantRebuilt {
+				t.Errorf("MigrateSchema() rebuilt = %v, want %v", rebuilt, tt.wantRebuilt)
+			}
+			if swapped := slices.Contains(requests, "POST /_aliases"); swapped != tt.wantRebuilt {
+				t.Errorf("alias swapped = %v, want %v: %v", swapped, tt.wantRebuilt, requests)
+			}
+		})
+	}
+}
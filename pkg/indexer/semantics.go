@@ -0,0 +1,605 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// typeCheckTimeout bounds type-checking one repository's Go packages.
+const typeCheckTimeout = 5 * time.Minute
+
+// knownInterfaces are the standard library interfaces a type is checked
+// against, besides error and the interfaces its own module declares. Those
+// of a package are only checked when the module imports it.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var knownInterfaces = map[string][]string{
+	"io":                  {"Reader", "Writer", "Closer", "ReadCloser", "WriteCloser", "ReadWriter", "ReaderFrom", "WriterTo", "Seeker"},
+	"fmt":                 {"Stringer", "GoStringer", "Formatter"},
+	"sort":                {"Interface"},
+	"container/heap":      {"Interface"},
+	"encoding":            {"TextMarshaler", "TextUnmarshaler", "BinaryMarshaler", "BinaryUnmarshaler"},
+	"encoding/json":       {"Marshaler", "Unmarshaler"},
+	"flag":                {"Value"},
+	"context":             {"Context"},
+	"net/http":            {"Handler", "RoundTripper"},
+	"database/sql":        {"Scanner"},
+	"database/sql/driver": {"Valuer"},
+	"hash":                {"Hash"},
+	"log/slog":            {"Handler", "LogValuer"},
+}
+
+// stdlib imports standard library packages from GOROOT's source. It is
+// shared by every run, since the standard library doesn't change while the
+// indexer runs and type-checking it is what takes longest.
+//
+//nolint:gochecknoglobals // process-wide cache
+var stdlib = &stdlibImporter{}
+
+// stdlibImporter type-checks standard library packages from source on first
+// use and keeps them.
+type stdlibImporter struct {
+	mu       sync.Mutex
+	importer types.ImporterFrom
+}
+
+// Import returns the standard library package at path.
+func (s *stdlibImporter) Import(path string) (pkg *types.Package, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.importer == nil {
+		s.importer, _ = importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	}
+	pkg, err = s.importer.ImportFrom(path, build.Default.GOROOT, 0)
+	return pkg, err
+}
+
+// declSemantics is what type-checking resolved about one declaration.
+type declSemantics struct {
+	paramTypes    []string
+	resultTypes   []string
+	resolvedCalls []string
+	implements    []string
+}
+
+// semanticIndex holds the resolved declarations of a repository's Go files,
+// keyed by absolute file path and then by declKey.
+type semanticIndex struct {
+	files map[string]map[string]declSemantics
+}
+
+// declKey identifies a declaration within its file by its name and first
+// line, as its document records them, since a method's name alone doesn't.
+func declKey(name string, line int) (key string) {
+	key = name + ":" + strconv.Itoa(line)
+	return key
+}
+
+// enrich adds to the documents parsed from a file what type-checking
+// resolved about their declarations. A nil index, or a file it doesn't
+// cover, leaves them as they are.
+func (s *semanticIndex) enrich(path string, docs []elasticsearch.CodeDocument) {
+	if s == nil {
+		return
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	decls, found := s.files[absPath]
+	if !found {
+		return
+	}
+
+	for i := range docs {
+		decl, ok := decls[declKey(docs[i].FunctionName, docs[i].StartLine)]
+		if !ok {
+			continue
+		}
+		docs[i].ParamTypes = decl.paramTypes
+		docs[i].ResultTypes = decl.resultTypes
+		docs[i].ResolvedCalls = decl.resolvedCalls
+		docs[i].Implements = decl.implements
+	}
+}
+
+// typeCheckRepo type-checks the Go packages of each module in the
+// repository when INDEX_TYPES is set. Failures are logged and leave
+// declarations without resolved types.
+func (idx *Indexer) typeCheckRepo(ctx context.Context, repoName string, repoPath string) (index *semanticIndex) {
+	if !idx.config.IndexTypes {
+		return index
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, typeCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	index, packages, err := typeCheckModules(ctx, repoPath)
+	if err != nil {
+		idx.logger.Warn("Failed to type-check Go packages", "repo", repoName, "packages", packages, "error", err)
+		return index
+	}
+
+	idx.logger.Info("Type-checked Go packages", "repo", repoName, "packages", packages, "duration", time.Since(start))
+	return index
+}
+
+// typeCheckModules type-checks the packages of every Go module under root,
+// returning what it resolved about their declarations. An error stops it,
+// but what was checked before is returned.
+func typeCheckModules(ctx context.Context, root string) (index *semanticIndex, packages int, err error) {
+	index = &semanticIndex{files: map[string]map[string]declSemantics{}}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return index, packages, err
+	}
+
+	var modules []string
+	err = filepath.WalkDir(absRoot, func(path string, entry os.DirEntry, walkErr error) (procErr error) {
+		if walkErr != nil {
+			return procErr
+		}
+		if entry.IsDir() && path != absRoot && ignoredGoDir(entry.Name()) {
+			procErr = filepath.SkipDir
+			return procErr
+		}
+		if !entry.IsDir() && entry.Name() == "go.mod" {
+			modules = append(modules, filepath.Dir(path))
+		}
+		return procErr
+	})
+	if err != nil {
+		return index, packages, err
+	}
+
+	for _, dir := range modules {
+		var module goModule
+		module, err = parseGoMod(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return index, packages, err
+		}
+
+		checker := newModuleChecker(ctx, dir, module.path)
+		err = checker.checkAll()
+		packages += checker.record(index)
+		if err != nil {
+			return index, packages, err
+		}
+	}
+	return index, packages, err
+}
+
+// ignoredGoDir reports whether the go command leaves out a directory's
+// packages: dependencies and build output, testdata, and names starting
+// with "." or "_".
+func ignoredGoDir(name string) (ignored bool) {
+	ignored = skippedDirs[name] || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+	return ignored
+}
+
+// checkedPackage is a type-checked package and the files it was checked
+// from.
+type checkedPackage struct {
+	pkg   *types.Package
+	files []*ast.File
+	info  *types.Info
+}
+
+// moduleChecker type-checks the packages of one module from source. Its
+// own packages are checked as they're imported, the standard library comes
+// from stdlib, and other imports are stood in for by empty packages, so
+// what they declare stays unresolved.
+type moduleChecker struct {
+	ctx        context.Context
+	fset       *token.FileSet
+	root       string
+	modulePath string
+	packages   map[string]*checkedPackage
+	checking   map[string]bool
+	imported   map[string]*types.Package
+}
+
+// newModuleChecker returns a checker for the module at root.
+func newModuleChecker(ctx context.Context, root string, modulePath string) (checker *moduleChecker) {
+	checker = &moduleChecker{
+		ctx:        ctx,
+		fset:       token.NewFileSet(),
+		root:       root,
+		modulePath: modulePath,
+		packages:   map[string]*checkedPackage{},
+		checking:   map[string]bool{},
+		imported:   map[string]*types.Package{},
+	}
+	return checker
+}
+
+// checkAll type-checks every package of the module, leaving out nested
+// modules, which are checked on their own.
+func (c *moduleChecker) checkAll() (err error) {
+	err = filepath.WalkDir(c.root, func(path string, entry os.DirEntry, walkErr error) (procErr error) {
+		if walkErr != nil || !entry.IsDir() {
+			return procErr
+		}
+		if path != c.root {
+			_, statErr := os.Stat(filepath.Join(path, "go.mod"))
+			if ignoredGoDir(entry.Name()) || statErr == nil {
+				procErr = filepath.SkipDir
+				return procErr
+			}
+		}
+
+		procErr = c.ctx.Err()
+		if procErr != nil {
+			return procErr
+		}
+
+		rel, _ := filepath.Rel(c.root, path)
+		c.check(c.importPath(rel), path)
+		return procErr
+	})
+	return err
+}
+
+// importPath returns the import path of the module's package in the
+// directory rel, relative to its root.
+func (c *moduleChecker) importPath(rel string) (importPath string) {
+	importPath = c.modulePath
+	if rel != "." {
+		importPath += "/" + filepath.ToSlash(rel)
+	}
+	return importPath
+}
+
+// check type-checks the package in dir, once, returning nil when dir has
+// no Go files for this platform or is already being checked, as in an
+// import cycle. Type errors are ignored: what resolves is kept.
+func (c *moduleChecker) check(importPath string, dir string) (checked *checkedPackage) {
+	checked, found := c.packages[importPath]
+	if found || c.checking[importPath] {
+		return checked
+	}
+	c.checking[importPath] = true
+	defer delete(c.checking, importPath)
+
+	buildPkg, err := build.Default.ImportDir(dir, 0)
+	var noGo *build.NoGoError
+	if errors.As(err, &noGo) || buildPkg == nil || len(buildPkg.GoFiles) == 0 {
+		c.packages[importPath] = nil
+		return checked
+	}
+
+	checked = &checkedPackage{
+		info: &types.Info{
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+		},
+	}
+	for _, name := range buildPkg.GoFiles {
+		file, parseErr := parser.ParseFile(c.fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if file == nil || file.Name == nil || (parseErr != nil && file.Name.Name == "") {
+			continue
+		}
+		checked.files = append(checked.files, file)
+	}
+	if len(checked.files) == 0 {
+		c.packages[importPath] = nil
+		checked = nil
+		return checked
+	}
+
+	conf := types.Config{
+		Importer: c,
+		Error:    func(error) {},
+	}
+	checked.pkg, _ = conf.Check(importPath, c.fset, checked.files, checked.info)
+	c.packages[importPath] = checked
+	return checked
+}
+
+// Import implements types.Importer for the module's packages.
+func (c *moduleChecker) Import(importPath string) (pkg *types.Package, err error) {
+	if importPath == c.modulePath || strings.HasPrefix(importPath, c.modulePath+"/") {
+		rel := strings.TrimPrefix(strings.TrimPrefix(importPath, c.modulePath), "/")
+		checked := c.check(importPath, filepath.Join(c.root, filepath.FromSlash(rel)))
+		if checked != nil && checked.pkg != nil {
+			pkg = checked.pkg
+			return pkg, err
+		}
+	}
+
+	first, _, _ := strings.Cut(importPath, "/")
+	if !strings.Contains(first, ".") && importPath != "C" {
+		stdPkg, importErr := stdlib.Import(importPath)
+		if importErr == nil {
+			c.imported[importPath] = stdPkg
+			pkg = stdPkg
+			return pkg, err
+		}
+	}
+
+	pkg = types.NewPackage(importPath, importName(importPath))
+	pkg.MarkComplete()
+	return pkg, err
+}
+
+// interfaces lists the interfaces the module's types are checked against:
+// error, the known standard library interfaces of the packages it imports,
+// and the non-generic interfaces with methods its own packages declare.
+func (c *moduleChecker) interfaces() (ifaces []*types.TypeName) {
+	add := func(obj types.Object) {
+		typeName, ok := obj.(*types.TypeName)
+		if !ok || typeName.IsAlias() {
+			return
+		}
+		named, ok := typeName.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() > 0 {
+			return
+		}
+		iface, ok := named.Underlying().(*types.Interface)
+		if ok && iface.IsMethodSet() && iface.NumMethods() > 0 {
+			ifaces = append(ifaces, typeName)
+		}
+	}
+
+	add(types.Universe.Lookup("error"))
+	for importPath, names := range knownInterfaces {
+		pkg, found := c.imported[importPath]
+		if !found {
+			continue
+		}
+		for _, name := range names {
+			add(pkg.Scope().Lookup(name))
+		}
+	}
+	for _, checked := range c.packages {
+		if checked == nil || checked.pkg == nil {
+			continue
+		}
+		scope := checked.pkg.Scope()
+		for _, name := range scope.Names() {
+			add(scope.Lookup(name))
+		}
+	}
+	return ifaces
+}
+
+// record adds what was resolved about the declarations of the module's
+// packages to index, returning how many packages were checked.
+func (c *moduleChecker) record(index *semanticIndex) (packages int) {
+	ifaces := c.interfaces()
+	for _, checked := range c.packages {
+		if checked == nil || checked.pkg == nil {
+			continue
+		}
+		packages++
+		for _, file := range checked.files {
+			decls := map[string]declSemantics{}
+			for _, decl := range file.Decls {
+				c.recordDecl(checked, decl, ifaces, decls)
+			}
+			if len(decls) > 0 {
+				index.files[c.fset.Position(file.Pos()).Filename] = decls
+			}
+		}
+	}
+	return packages
+}
+
+// recordDecl records a function's resolved signature and calls, and the
+// interfaces a type, or a method's receiver through that method,
+// implements. Keys use the lines extractFunctionDoc and extractDeclDocs
+// give the declarations' documents.
+func (c *moduleChecker) recordDecl(checked *checkedPackage, decl ast.Decl, ifaces []*types.TypeName, decls map[string]declSemantics) {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		fn, ok := checked.info.Defs[decl.Name].(*types.Func)
+		if !ok {
+			return
+		}
+		sig, _ := fn.Type().(*types.Signature)
+		if sig == nil {
+			return
+		}
+
+		var semantics declSemantics
+		semantics.paramTypes = tupleTypes(sig.Params(), sig.Variadic(), decl.Type.Params)
+		semantics.resultTypes = tupleTypes(sig.Results(), false, decl.Type.Results)
+		semantics.resolvedCalls = resolvedCalls(checked.info, decl)
+		if sig.Recv() != nil {
+			named := namedType(sig.Recv().Type())
+			if named != nil {
+				semantics.implements = implemented(named, ifaces, decl.Name.Name)
+			}
+		}
+		decls[declKey(decl.Name.Name, c.fset.Position(decl.Pos()).Line)] = semantics
+
+	case *ast.GenDecl:
+		if decl.Tok != token.TYPE {
+			return
+		}
+		for _, spec := range decl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			typeName, ok := checked.info.Defs[typeSpec.Name].(*types.TypeName)
+			if !ok || typeName.IsAlias() {
+				continue
+			}
+			named, ok := typeName.Type().(*types.Named)
+			if !ok {
+				continue
+			}
+			_, isInterface := named.Underlying().(*types.Interface)
+			if isInterface || named.TypeParams().Len() > 0 {
+				continue
+			}
+
+			implements := implemented(named, ifaces, "")
+			if len(implements) == 0 {
+				continue
+			}
+			start := typeSpec.Pos()
+			if !decl.Lparen.IsValid() {
+				start = decl.Pos()
+			}
+			decls[declKey(typeSpec.Name.Name, c.fset.Position(start).Line)] = declSemantics{implements: implements}
+		}
+	}
+}
+
+// qualifiedType writes a type with the full import path of each package
+// it names, such as *net/http.Request.
+func qualifiedType(t types.Type) (name string) {
+	name = types.TypeString(t, func(pkg *types.Package) (qualifier string) {
+		qualifier = pkg.Path()
+		return qualifier
+	})
+	return name
+}
+
+// tupleTypes lists the types of a signature's parameters or results, the
+// last of a variadic signature written as "...T". A type naming what
+// couldn't be resolved, such as a third-party package's, is listed as
+// written in fields instead.
+func tupleTypes(tuple *types.Tuple, variadic bool, fields *ast.FieldList) (names []string) {
+	var written []ast.Expr
+	if fields != nil {
+		for _, field := range fields.List {
+			for range max(len(field.Names), 1) {
+				written = append(written, field.Type)
+			}
+		}
+	}
+
+	for i := range tuple.Len() {
+		t := tuple.At(i).Type()
+		name := qualifiedType(t)
+		slice, isSlice := t.(*types.Slice)
+		if variadic && isSlice && i == tuple.Len()-1 {
+			name = "..." + qualifiedType(slice.Elem())
+		}
+		if strings.Contains(name, "invalid type") && len(written) == tuple.Len() {
+			name = types.ExprString(written[i])
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// resolvedCalls lists the package-level functions and methods a function
+// calls that type-checking resolved, by full import path, as
+// "net/http.Get" or "net/http.Client.Do", sorted and without duplicates.
+// Interface methods are named by their interface.
+func resolvedCalls(info *types.Info, funcDecl *ast.FuncDecl) (calls []string) {
+	if funcDecl.Body == nil {
+		return calls
+	}
+
+	seen := map[string]bool{}
+	ast.Inspect(funcDecl.Body, func(n ast.Node) (descend bool) {
+		descend = true
+
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return descend
+		}
+
+		var ident *ast.Ident
+		switch fun := ast.Unparen(call.Fun).(type) {
+		case *ast.Ident:
+			ident = fun
+		case *ast.SelectorExpr:
+			ident = fun.Sel
+		case *ast.IndexExpr:
+			ident, _ = fun.X.(*ast.Ident)
+		case *ast.IndexListExpr:
+			ident, _ = fun.X.(*ast.Ident)
+		}
+		if ident == nil {
+			return descend
+		}
+
+		fn, ok := info.Uses[ident].(*types.Func)
+		if !ok || fn.Pkg() == nil {
+			return descend
+		}
+
+		name := fn.Pkg().Path() + "." + fn.Name()
+		sig, _ := fn.Type().(*types.Signature)
+		if sig != nil && sig.Recv() != nil {
+			named := namedType(sig.Recv().Type())
+			if named == nil {
+				return descend
+			}
+			name = fn.Pkg().Path() + "." + named.Obj().Name() + "." + fn.Name()
+		}
+		if !seen[name] {
+			seen[name] = true
+			calls = append(calls, name)
+		}
+		return descend
+	})
+
+	sort.Strings(calls)
+	return calls
+}
+
+// implemented lists the interfaces a named type, or a pointer to it,
+// implements, qualified by full import path, sorted. Given a method, only
+// the interfaces that have a method of that name are listed, those the
+// method helps implement.
+func implemented(named *types.Named, ifaces []*types.TypeName, method string) (names []string) {
+	if named.TypeParams().Len() > 0 {
+		return names
+	}
+
+	pointer := types.NewPointer(named)
+	for _, typeName := range ifaces {
+		iface, _ := typeName.Type().Underlying().(*types.Interface)
+		if iface == nil {
+			continue
+		}
+		if method != "" && !hasMethod(iface, method) {
+			continue
+		}
+		if types.Implements(named, iface) || types.Implements(pointer, iface) {
+			names = append(names, qualifiedType(typeName.Type()))
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// hasMethod reports whether an interface has a method named name.
+func hasMethod(iface *types.Interface, name string) (found bool) {
+	for i := range iface.NumMethods() {
+		if iface.Method(i).Name() == name {
+			found = true
+			return found
+		}
+	}
+	return found
+}
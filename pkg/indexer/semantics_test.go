@@ -0,0 +1,140 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestTypeCheckModules(t *testing.T) {
+	repo := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop // the shop\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+import "fmt"
+
+// Store keeps items.
+type Store interface {
+	Get(key string) (value string, err error)
+}
+
+type Memory struct {
+	items map[string]string
+}
+
+func (m *Memory) Get(key string) (value string, err error) {
+	value, found := m.items[key]
+	if !found {
+		err = fmt.Errorf("no %s", key)
+	}
+	return value, err
+}
+
+func (m Memory) String() (s string) {
+	s = fmt.Sprint(len(m.items))
+	return s
+}
+`,
+		"cart/cart.go": `package cart
+
+import (
+	"io"
+	"strings"
+
+	"example.com/shop/store"
+	"example.org/money"
+)
+
+func Load(s store.Store, w io.Writer, keys ...string) (total money.Amount, err error) {
+	for _, key := range keys {
+		var value string
+		value, err = s.Get(strings.TrimSpace(key))
+		if err != nil {
+			return total, err
+		}
+		_, err = io.WriteString(w, value)
+	}
+	money.Add(total)
+	return total, err
+}
+`,
+		"cart/cart_test.go": "package cart\n\nfunc helper() {}\n",
+		"testdata/bad.go":   "package bad\n\nfunc Broken() {\n",
+		"tools/go.mod":      "module example.com/shop/tools\n",
+		"tools/gen.go":      "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0o750)
+		if err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	index, packages, err := typeCheckModules(t.Context(), repo)
+	if err != nil {
+		t.Fatalf("typeCheckModules() error = %v", err)
+	}
+	if packages != 3 {
+		t.Errorf("packages = %d, want store, cart, and the nested tools module's", packages)
+	}
+
+	parse := func(name string) (docs map[string]elasticsearch.CodeDocument) {
+		path := filepath.Join(repo, name)
+		content, readErr := os.ReadFile(path)
+		if readErr != nil {
+			t.Fatalf("ReadFile() error = %v", readErr)
+		}
+		language := &goLanguage{semantics: index}
+		parsed, parseErr := language.ParseFile(path, content)
+		if parseErr != nil {
+			t.Fatalf("ParseFile() error = %v", parseErr)
+		}
+		docs = map[string]elasticsearch.CodeDocument{}
+		for _, doc := range parsed {
+			docs[doc.Kind+" "+doc.FunctionName] = doc
+		}
+		return docs
+	}
+
+	cart := parse("cart/cart.go")
+	load := cart["function Load"]
+	if want := []string{"example.com/shop/store.Store", "io.Writer", "...string"}; !slices.Equal(load.ParamTypes, want) {
+		t.Errorf("Load ParamTypes = %v, want %v", load.ParamTypes, want)
+	}
+	if want := []string{"money.Amount", "error"}; !slices.Equal(load.ResultTypes, want) {
+		t.Errorf("Load ResultTypes = %v, want %v, unresolved money as written", load.ResultTypes, want)
+	}
+	if want := []string{"example.com/shop/store.Store.Get", "io.WriteString", "strings.TrimSpace"}; !slices.Equal(load.ResolvedCalls, want) {
+		t.Errorf("Load ResolvedCalls = %v, want %v", load.ResolvedCalls, want)
+	}
+
+	store := parse("store/store.go")
+	if want := []string{"example.com/shop/store.Store", "fmt.Stringer"}; !slices.Equal(store["type Memory"].Implements, want) {
+		t.Errorf("Memory Implements = %v, want %v", store["type Memory"].Implements, want)
+	}
+	if want := []string{"example.com/shop/store.Store"}; !slices.Equal(store["method Get"].Implements, want) {
+		t.Errorf("Get Implements = %v, want %v", store["method Get"].Implements, want)
+	}
+	if want := []string{"fmt.Stringer"}; !slices.Equal(store["method String"].Implements, want) {
+		t.Errorf("String Implements = %v, want %v", store["method String"].Implements, want)
+	}
+	if store["interface Store"].Implements != nil {
+		t.Errorf("Store Implements = %v, want none for an interface", store["interface Store"].Implements)
+	}
+
+	var nilIndex *semanticIndex
+	docs := []elasticsearch.CodeDocument{{FunctionName: "Load", StartLine: 11}}
+	nilIndex.enrich(filepath.Join(repo, "cart/cart.go"), docs)
+	if docs[0].ParamTypes != nil {
+		t.Error("a nil index enriched documents")
+	}
+}
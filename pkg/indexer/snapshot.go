@@ -0,0 +1,204 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// ErrSnapshotsDisabled is returned for snapshot operations when
+// SNAPSHOT_REPOSITORY isn't set.
+var ErrSnapshotsDisabled = errors.New("snapshots are disabled: SNAPSHOT_REPOSITORY is not set")
+
+// Reasons a snapshot is taken, recorded in its name and metadata.
+const (
+	SnapshotManual    = "manual"
+	SnapshotScheduled = "scheduled"
+	SnapshotRebuild   = "rebuild"
+)
+
+// snapshotTakenBy marks the snapshots the indexer takes, which are the only
+// ones SNAPSHOTS_KEPT prunes.
+const snapshotTakenBy = "rag-indexer"
+
+// RestoredSnapshot describes a snapshot restored as a new index generation.
+type RestoredSnapshot struct {
+	Snapshot string   `json:"snapshot"`
+	Index    string   `json:"index"`
+	Previous []string `json:"previous,omitempty"`
+}
+
+// Snapshot snapshots the index into SNAPSHOT_REPOSITORY as
+// ES_INDEX-<reason>-<time>, then deletes the indexer's oldest snapshots of
+// the index beyond SNAPSHOTS_KEPT.
+func (idx *Indexer) Snapshot(ctx context.Context, reason string) (info elasticsearch.SnapshotInfo, err error) {
+	repository := idx.config.SnapshotRepository
+	if repository == "" {
+		err = ErrSnapshotsDisabled
+		return info, err
+	}
+
+	err = idx.ensureSnapshotRepository(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	name := fmt.Sprintf("%s-%s-%s", idx.es.Index(), reason, time.Now().UTC().Format("20060102-150405"))
+	metadata := map[string]string{"taken_by": snapshotTakenBy, "index": idx.es.Index(), "reason": reason}
+	info, err = idx.es.CreateSnapshot(ctx, repository, name, metadata)
+	if err != nil {
+		return info, err
+	}
+	idx.logger.Info("Took snapshot", "snapshot", name, "repository", repository, "reason", reason, "indices", info.Indices)
+
+	idx.pruneSnapshots(ctx)
+	return info, err
+}
+
+// Snapshots returns the snapshots in SNAPSHOT_REPOSITORY, newest first.
+func (idx *Indexer) Snapshots(ctx context.Context) (snapshots []elasticsearch.SnapshotInfo, err error) {
+	if idx.config.SnapshotRepository == "" {
+		err = ErrSnapshotsDisabled
+		return snapshots, err
+	}
+
+	err = idx.ensureSnapshotRepository(ctx)
+	if err != nil {
+		return snapshots, err
+	}
+
+	snapshots, err = idx.es.Snapshots(ctx, idx.config.SnapshotRepository)
+	return snapshots, err
+}
+
+// RestoreSnapshot restores the named snapshot as a new index generation and
+// swaps the ES_INDEX alias to it, as a rebuild does. The index it replaces is
+// kept as a generation, subject to ES_GENERATIONS_KEPT. It returns
+// ErrReindexInProgress rather than wait while an index run holds the index.
+// The next run brings the restored documents up to date.
+func (idx *Indexer) RestoreSnapshot(ctx context.Context, name string) (restored RestoredSnapshot, err error) {
+	if idx.config.SnapshotRepository == "" {
+		err = ErrSnapshotsDisabled
+		return restored, err
+	}
+
+	if !idx.mu.TryLock() {
+		err = ErrReindexInProgress
+		return restored, err
+	}
+	defer idx.mu.Unlock()
+
+	err = idx.ensureSnapshotRepository(ctx)
+	if err != nil {
+		return restored, err
+	}
+
+	restored = RestoredSnapshot{Snapshot: name, Index: idx.es.GenerationName(time.Now())}
+	err = idx.es.RestoreSnapshot(ctx, idx.config.SnapshotRepository, name, restored.Index)
+	if err != nil {
+		return restored, err
+	}
+	idx.logger.Info("Restored snapshot", "snapshot", name, "index", restored.Index)
+
+	restored.Previous, err = idx.swapGeneration(ctx, restored.Index)
+	if err != nil {
+		deleteErr := idx.es.DeleteIndex(context.WithoutCancel(ctx), restored.Index)
+		if deleteErr != nil {
+			idx.logger.Warn("Failed to delete restored index", "index", restored.Index, "error", deleteErr)
+		}
+		return restored, err
+	}
+
+	return restored, err
+}
+
+// RunSnapshotLoop snapshots the index every SNAPSHOT_INTERVAL until ctx is
+// done. A failed snapshot is logged and retried at the next interval.
+func (idx *Indexer) RunSnapshotLoop(ctx context.Context) {
+	ticker := time.NewTicker(idx.config.SnapshotInterval)
+	defer ticker.Stop()
+
+	idx.logger.Info("Starting snapshot loop", "interval", idx.config.SnapshotInterval, "repository", idx.config.SnapshotRepository)
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := idx.Snapshot(ctx, SnapshotScheduled)
+			if err != nil {
+				idx.logger.Error("Scheduled snapshot failed", "error", err)
+			}
+
+		case <-ctx.Done():
+			idx.logger.Info("Snapshot loop stopped")
+			return
+		}
+	}
+}
+
+// snapshotBeforeRebuild snapshots the live index before a rebuild replaces
+// it, when SNAPSHOT_BEFORE_REBUILD is set. There is nothing to snapshot
+// before the index is first built.
+func (idx *Indexer) snapshotBeforeRebuild(ctx context.Context) (err error) {
+	if idx.config.SnapshotRepository == "" || !idx.config.SnapshotBeforeRebuild {
+		return err
+	}
+
+	_, err = idx.Snapshot(ctx, SnapshotRebuild)
+	if errors.Is(err, elasticsearch.ErrNoIndex) {
+		idx.logger.Info("No index to snapshot before rebuild", "index", idx.es.Index())
+		err = nil
+	}
+	return err
+}
+
+// ensureSnapshotRepository registers SNAPSHOT_REPOSITORY once per process
+// when SNAPSHOT_REPOSITORY_TYPE is set. Otherwise the repository is expected
+// to be registered already.
+func (idx *Indexer) ensureSnapshotRepository(ctx context.Context) (err error) {
+	if idx.config.SnapshotRepositoryType == "" || idx.snapshotRepo.Load() {
+		return err
+	}
+
+	err = idx.es.RegisterSnapshotRepository(ctx, idx.config.SnapshotRepository, idx.config.SnapshotRepositoryType, idx.config.SnapshotSettings)
+	if err != nil {
+		return err
+	}
+	idx.snapshotRepo.Store(true)
+	return err
+}
+
+// pruneSnapshots deletes the indexer's oldest snapshots of the index beyond
+// SNAPSHOTS_KEPT. Snapshots taken by anything else are left alone. Failures
+// are logged; the snapshot just taken stands either way.
+func (idx *Indexer) pruneSnapshots(ctx context.Context) {
+	if idx.config.SnapshotsKept == 0 {
+		return
+	}
+
+	snapshots, err := idx.es.Snapshots(ctx, idx.config.SnapshotRepository)
+	if err != nil {
+		idx.logger.Warn("Failed to list snapshots for pruning", "error", err)
+		return
+	}
+
+	kept := 0
+	for _, snapshot := range snapshots {
+		if snapshot.Metadata["taken_by"] != snapshotTakenBy || snapshot.Metadata["index"] != idx.es.Index() {
+			continue
+		}
+		if kept < idx.config.SnapshotsKept {
+			kept++
+			continue
+		}
+
+		err = idx.es.DeleteSnapshot(ctx, idx.config.SnapshotRepository, snapshot.Name)
+		if err != nil {
+			idx.logger.Warn("Failed to delete old snapshot", "snapshot", snapshot.Name, "error", err)
+			return
+		}
+		idx.logger.Info("Deleted old snapshot", "snapshot", snapshot.Name, "kept", idx.config.SnapshotsKept)
+	}
+}
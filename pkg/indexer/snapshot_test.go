@@ -0,0 +1,178 @@
+package indexer
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newSnapshotIndexer returns an indexer snapshotting code-index into the
+// backups repository of the fake Elasticsearch handler.
+func newSnapshotIndexer(t *testing.T, handler http.HandlerFunc, kept int) (idx *Indexer) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := config.Config{
+		ESHost:                 srv.URL,
+		ESIndex:                "code-index",
+		ESGenerationFormat:     "2006-01-02-150405",
+		ESGenerationsKept:      2,
+		SnapshotRepository:     "backups",
+		SnapshotRepositoryType: "fs",
+		SnapshotSettings:       map[string]string{"location": "/mnt/backups"},
+		SnapshotBeforeRebuild:  true,
+		SnapshotsKept:          kept,
+	}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx = New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+	return idx
+}
+
+func TestSnapshot(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	idx := newSnapshotIndexer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/_alias/code-index":
+			_, _ = w.Write([]byte(`{"code-index-2025-01-03-000000":{"aliases":{"code-index":{}}}}`))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_snapshot/backups/code-index-manual-"):
+			_, _ = w.Write([]byte(`{"snapshot":{"snapshot":"code-index-manual-1","state":"SUCCESS","indices":["code-index-2025-01-03-000000"]}}`))
+		case r.URL.Path == "/_snapshot/backups/_all":
+			_, _ = w.Write([]byte(`{"snapshots":[` +
+				`{"snapshot":"newest","start_time":"2025-01-03T00:00:00Z","metadata":{"taken_by":"rag-indexer","index":"code-index"}},` +
+				`{"snapshot":"other-tool","start_time":"2025-01-02T12:00:00Z"},` +
+				`{"snapshot":"other-index","start_time":"2025-01-02T06:00:00Z","metadata":{"taken_by":"rag-indexer","index":"docs-index"}},` +
+				`{"snapshot":"newer","start_time":"2025-01-02T00:00:00Z","metadata":{"taken_by":"rag-indexer","index":"code-index"}},` +
+				`{"snapshot":"oldest","start_time":"2025-01-01T00:00:00Z","metadata":{"taken_by":"rag-indexer","index":"code-index"}}]}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}, 2)
+
+	info, err := idx.Snapshot(t.Context(), SnapshotManual)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if info.State != elasticsearch.SnapshotStateSuccess {
+		t.Errorf("Snapshot() state = %q, want SUCCESS", info.State)
+	}
+
+	_, err = idx.Snapshot(t.Context(), SnapshotManual)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	registered := 0
+	var deleted []string
+	for _, request := range requests {
+		switch {
+		case request == "PUT /_snapshot/backups":
+			registered++
+		case strings.HasPrefix(request, "DELETE /_snapshot/backups/"):
+			deleted = append(deleted, strings.TrimPrefix(request, "DELETE /_snapshot/backups/"))
+		}
+	}
+	if registered != 1 {
+		t.Errorf("repository registered %d times, want once", registered)
+	}
+	if !slices.Equal(deleted, []string{"oldest", "oldest"}) {
+		t.Errorf("deleted snapshots = %v, want only the indexer's oldest of code-index, once per snapshot", deleted)
+	}
+}
+
+func TestSnapshotBeforeRebuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   bool
+		state   string
+		wantErr bool
+	}{
+		{name: "snapshot taken", index: true, state: "SUCCESS"},
+		{name: "nothing to snapshot", state: "SUCCESS"},
+		{name: "snapshot failed", index: true, state: "FAILED", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newSnapshotIndexer(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/_alias/code-index" || (r.Method == http.MethodHead && !tt.index):
+					w.WriteHeader(http.StatusNotFound)
+				case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_snapshot/backups/code-index-rebuild-"):
+					_, _ = w.Write([]byte(`{"snapshot":{"snapshot":"code-index-rebuild-1","state":"` + tt.state + `"}}`))
+				default:
+					_, _ = w.Write([]byte(`{}`))
+				}
+			}, 0)
+
+			err := idx.snapshotBeforeRebuild(t.Context())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("snapshotBeforeRebuild() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	idx := newSnapshotIndexer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/_alias/code-index":
+			_, _ = w.Write([]byte(`{"code-index-2025-01-03-000000":{"aliases":{"code-index":{}}}}`))
+		case r.URL.Path == "/_snapshot/backups/snap-1":
+			_, _ = w.Write([]byte(`{"snapshots":[{"snapshot":"snap-1","indices":["code-index-2025-01-01-000000"]}]}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}, 0)
+
+	restored, err := idx.RestoreSnapshot(t.Context(), "snap-1")
+	if err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	if !strings.HasPrefix(restored.Index, "code-index-") || !slices.Equal(restored.Previous, []string{"code-index-2025-01-03-000000"}) {
+		t.Errorf("RestoreSnapshot() = %+v, want a new generation replacing code-index-2025-01-03-000000", restored)
+	}
+	if !slices.Contains(requests, "POST /_snapshot/backups/snap-1/_restore") || !slices.Contains(requests, "POST /_aliases") {
+		t.Errorf("requests = %v, want a restore, then an alias swap", requests)
+	}
+
+	idx.mu.Lock()
+	_, err = idx.RestoreSnapshot(t.Context(), "snap-1")
+	idx.mu.Unlock()
+	if !errors.Is(err, ErrReindexInProgress) {
+		t.Errorf("RestoreSnapshot() during a run error = %v, want ErrReindexInProgress", err)
+	}
+
+	idx.config.SnapshotRepository = ""
+	_, err = idx.Snapshots(t.Context())
+	if !errors.Is(err, ErrSnapshotsDisabled) {
+		t.Errorf("Snapshots() error = %v, want ErrSnapshotsDisabled", err)
+	}
+}
@@ -0,0 +1,293 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// RepoCheckpoint is the persisted progress of a repository's latest index
+// run. A run that was still running when the process died is resumed from
+// FilesDone when the repository is next indexed at the same commit.
+// ParseFailures are the files and documents that failed in its latest walk.
+type RepoCheckpoint struct {
+	State         JobState       `json:"state"`
+	Commit        string         `json:"commit,omitempty"`
+	FilesDone     int            `json:"files_done"`
+	LastFile      string         `json:"last_file,omitempty"`
+	Documents     int            `json:"documents"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	ParseFailures []ParseFailure `json:"parse_failures,omitempty"`
+}
+
+// stateStore keeps each repository's checkpoint in a JSON file, so progress
+// survives a crash. A store without a path keeps nothing.
+type stateStore struct {
+	path  string
+	mu    sync.Mutex
+	repos map[string]RepoCheckpoint
+}
+
+// openStateStore loads the checkpoints saved at path. A missing file starts
+// empty; an unreadable one is logged and replaced on the next save.
+func openStateStore(path string, logger logging.Logger) (store *stateStore) {
+	store = &stateStore{
+		path:  path,
+		repos: make(map[string]RepoCheckpoint),
+	}
+	if path == "" {
+		return store
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &store.repos)
+	}
+	if err != nil {
+		logger.Warn("Failed to load indexing state, starting fresh", "path", path, "error", err)
+		store.repos = make(map[string]RepoCheckpoint)
+	}
+	return store
+}
+
+// get returns the repository's checkpoint.
+func (s *stateStore) get(repo string) (checkpoint RepoCheckpoint, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, found = s.repos[repo]
+	return checkpoint, found
+}
+
+// save records the repository's checkpoint, keeping its parse failures, and
+// writes the store.
+func (s *stateStore) save(repo string, checkpoint RepoCheckpoint) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint.UpdatedAt = time.Now()
+	checkpoint.ParseFailures = s.repos[repo].ParseFailures
+	s.repos[repo] = checkpoint
+	err = s.write()
+	return err
+}
+
+// parseFailures returns the parse failures saved for each repository.
+func (s *stateStore) parseFailures() (byRepo map[string][]ParseFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byRepo = make(map[string][]ParseFailure)
+	for repo, checkpoint := range s.repos {
+		if len(checkpoint.ParseFailures) > 0 {
+			byRepo[repo] = checkpoint.ParseFailures
+		}
+	}
+	return byRepo
+}
+
+// saveParseFailures records the failures of the repository's latest walk,
+// leaving its progress alone, and writes the store.
+func (s *stateStore) saveParseFailures(repo string, failures []ParseFailure) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, found := s.repos[repo]
+	if !found && len(failures) == 0 {
+		return err
+	}
+	if len(checkpoint.ParseFailures) == 0 && len(failures) == 0 {
+		return err
+	}
+
+	checkpoint.ParseFailures = failures
+	s.repos[repo] = checkpoint
+	err = s.write()
+	return err
+}
+
+// forget drops the checkpoint of a deleted repository.
+func (s *stateStore) forget(repo string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.repos[repo]; !found {
+		return err
+	}
+	delete(s.repos, repo)
+	err = s.write()
+	return err
+}
+
+// write replaces the state file. The caller holds s.mu.
+func (s *stateStore) write() (err error) {
+	if s.path == "" {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s.repos, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("failed to encode indexing state: %w", err)
+		return err
+	}
+
+	err = replaceFile(s.path, data)
+	if err != nil {
+		err = fmt.Errorf("failed to write indexing state: %w", err)
+	}
+	return err
+}
+
+// replaceFile writes data to a temporary file next to path and renames it
+// over path, so a crash mid-write leaves the previous content intact.
+func replaceFile(path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// checkpointer saves a repository's progress through a walk every few files
+// and skips the files an interrupted run already indexed. A nil checkpointer
+// does nothing, for runs that aren't resumable.
+type checkpointer struct {
+	store       *stateStore
+	logger      logging.Logger
+	repo        string
+	commit      string
+	every       int
+	resume      int
+	resumedDocs int
+	seen        int
+	done        int
+	last        string
+	docs        int
+	failed      bool
+}
+
+// newCheckpointer starts tracking a run of the repository at commit,
+// resuming the previous run if it was interrupted at the same commit.
+// Runs without a commit can't tell whether the tree changed and always
+// start over.
+func newCheckpointer(store *stateStore, logger logging.Logger, repo string, commit string, every int) (c *checkpointer) {
+	c = &checkpointer{
+		store:  store,
+		logger: logger,
+		repo:   repo,
+		commit: commit,
+		every:  every,
+	}
+
+	previous, found := store.get(repo)
+	if found && previous.State == JobRunning && commit != "" && previous.Commit == commit {
+		c.resume = previous.FilesDone
+		c.done = previous.FilesDone
+		c.last = previous.LastFile
+		c.resumedDocs = previous.Documents
+		c.docs = previous.Documents
+		logger.Info("Resuming interrupted index run", "repo", repo, "commit", commit, "files_done", previous.FilesDone, "last_file", previous.LastFile)
+	}
+	return c
+}
+
+// resumedDocuments returns how many documents the interrupted run indexed.
+func (c *checkpointer) resumedDocuments() (documents int) {
+	if c == nil {
+		return documents
+	}
+
+	documents = c.resumedDocs
+	return documents
+}
+
+// skip reports whether the next file of the walk was indexed by the
+// interrupted run.
+func (c *checkpointer) skip() (skip bool) {
+	if c == nil {
+		return skip
+	}
+
+	c.seen++
+	skip = c.seen <= c.resume
+	return skip
+}
+
+// fileDone counts a file as indexed, saving progress every few files. A file
+// cut short by cancellation isn't counted, so a resumed run indexes it again.
+func (c *checkpointer) fileDone(ctx context.Context, rel string, documents int) {
+	if c == nil || ctx.Err() != nil {
+		return
+	}
+
+	c.done++
+	c.last = rel
+	c.docs = documents
+	if c.every > 0 && c.done%c.every == 0 {
+		c.save(JobRunning, documents)
+	}
+}
+
+// finish saves the run's outcome. A cancelled run keeps its progress up to
+// the last file completed so the next one resumes; a failed run is started
+// over.
+func (c *checkpointer) finish(ctx context.Context, documents int, runErr error) {
+	if c == nil {
+		return
+	}
+
+	switch {
+	case runErr == nil:
+		c.save(JobCompleted, documents)
+	case ctx.Err() != nil:
+		c.save(JobRunning, c.docs)
+	default:
+		c.save(JobFailed, documents)
+	}
+}
+
+// save writes the checkpoint. Indexing carries on without resumability
+// rather than fail, so the first failure is logged and later saves are
+// skipped.
+func (c *checkpointer) save(state JobState, documents int) {
+	if c.failed {
+		return
+	}
+
+	err := c.store.save(c.repo, RepoCheckpoint{
+		State:     state,
+		Commit:    c.commit,
+		FilesDone: c.done,
+		LastFile:  c.last,
+		Documents: documents,
+	})
+	if err != nil {
+		c.failed = true
+		c.logger.Warn("Failed to save indexing state; this run can't be resumed", "repo", c.repo, "error", err)
+	}
+}
@@ -0,0 +1,180 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStateStoreReload(t *testing.T) {
+	logger := logging.New(slog.New(slog.DiscardHandler))
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	store := openStateStore(path, logger)
+	err := store.save("api", RepoCheckpoint{State: JobRunning, Commit: "abc123", FilesDone: 200, LastFile: "pkg/server.go", Documents: 1500})
+	if err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	err = store.save("web", RepoCheckpoint{State: JobCompleted, Commit: "def456"})
+	if err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	err = store.forget("web")
+	if err != nil {
+		t.Fatalf("forget() error = %v", err)
+	}
+
+	reloaded := openStateStore(path, logger)
+	got, found := reloaded.get("api")
+	if !found || got.State != JobRunning || got.Commit != "abc123" || got.FilesDone != 200 || got.LastFile != "pkg/server.go" || got.Documents != 1500 {
+		t.Errorf("get(api) = %+v, %v after reload", got, found)
+	}
+	if _, found = reloaded.get("web"); found {
+		t.Error("get(web) found a forgotten checkpoint")
+	}
+
+	err = os.WriteFile(path, []byte("{not json"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to corrupt state: %v", err)
+	}
+	if _, found = openStateStore(path, logger).get("api"); found {
+		t.Error("corrupt state file was loaded")
+	}
+}
+
+func TestResumeInterruptedRun(t *testing.T) {
+	var mu sync.Mutex
+	var files []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_doc") {
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			mu.Lock()
+			files = append(files, filepath.Base(doc.FilePath))
+			mu.Unlock()
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	repo := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.go", "d.go"} {
+		err := os.WriteFile(filepath.Join(repo, name), []byte("package main\n\nfunc F() {}\n"), 0o600)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		previous  RepoCheckpoint
+		commit    string
+		wantFiles []string
+		wantCount int
+	}{
+		{
+			name:      "interrupted at the same commit",
+			previous:  RepoCheckpoint{State: JobRunning, Commit: "abc", FilesDone: 2, LastFile: "b.go", Documents: 2},
+			commit:    "abc",
+			wantFiles: []string{"c.go", "d.go"},
+			wantCount: 4,
+		},
+		{
+			name:      "interrupted at another commit",
+			previous:  RepoCheckpoint{State: JobRunning, Commit: "old", FilesDone: 2, Documents: 2},
+			commit:    "abc",
+			wantFiles: []string{"a.go", "b.go", "c.go", "d.go"},
+			wantCount: 4,
+		},
+		{
+			name:      "completed",
+			previous:  RepoCheckpoint{State: JobCompleted, Commit: "abc", FilesDone: 4, Documents: 4},
+			commit:    "abc",
+			wantFiles: []string{"a.go", "b.go", "c.go", "d.go"},
+			wantCount: 4,
+		},
+		{
+			name:      "no commit",
+			previous:  RepoCheckpoint{State: JobRunning, FilesDone: 2, Documents: 2},
+			wantFiles: []string{"a.go", "b.go", "c.go", "d.go"},
+			wantCount: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files = nil
+			statePath := filepath.Join(t.TempDir(), "state.json")
+			cfg := config.Config{ESHost: srv.URL, ESIndex: "test-index", Languages: []string{"go"}, StateFile: statePath, StateCheckpointFiles: 1}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, clientErr := elasticsearch.NewClient(cfg, m)
+			if clientErr != nil {
+				t.Fatalf("NewClient() error = %v", clientErr)
+			}
+			idx := New(cfg, es, m, logging.New(slog.New(slog.DiscardHandler)))
+			saveErr := idx.state.save("api", tt.previous)
+			if saveErr != nil {
+				t.Fatalf("save() error = %v", saveErr)
+			}
+
+			checkpoint := newCheckpointer(idx.state, idx.logger, "api", tt.commit, cfg.StateCheckpointFiles)
+			count, err := idx.walkAndIndexRepo(t.Context(), es, "api", repo, tt.commit, checkpoint, nil, nil, nil)
+			checkpoint.finish(t.Context(), count, err)
+			if err != nil {
+				t.Fatalf("walkAndIndexRepo() error = %v", err)
+			}
+
+			slices.Sort(files)
+			if !slices.Equal(files, tt.wantFiles) || count != tt.wantCount {
+				t.Errorf("indexed %v for %d documents, want %v for %d", files, count, tt.wantFiles, tt.wantCount)
+			}
+
+			got, _ := openStateStore(statePath, idx.logger).get("api")
+			if got.State != JobCompleted || got.FilesDone != 4 || got.LastFile != "d.go" || got.Documents != 4 {
+				t.Errorf("saved checkpoint = %+v, want 4 files and documents completed through d.go", got)
+			}
+		})
+	}
+}
+
+func TestCheckpointKeptOnCancel(t *testing.T) {
+	logger := logging.New(slog.New(slog.DiscardHandler))
+	store := openStateStore(filepath.Join(t.TempDir(), "state.json"), logger)
+
+	checkpoint := newCheckpointer(store, logger, "api", "abc", 100)
+	checkpoint.fileDone(t.Context(), "a.go", 3)
+	checkpoint.fileDone(t.Context(), "b.go", 5)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	checkpoint.fileDone(ctx, "c.go", 6)
+	checkpoint.finish(ctx, 6, ctx.Err())
+
+	got, _ := store.get("api")
+	if got.State != JobRunning || got.FilesDone != 2 || got.LastFile != "b.go" || got.Documents != 5 {
+		t.Errorf("checkpoint = %+v, want running after 2 files and 5 documents through b.go", got)
+	}
+
+	resumed := newCheckpointer(store, logger, "api", "abc", 100)
+	var skipped []bool
+	for range 3 {
+		skipped = append(skipped, resumed.skip())
+	}
+	if !slices.Equal(skipped, []bool{true, true, false}) {
+		t.Errorf("skip() = %v, want the first 2 files skipped", skipped)
+	}
+}
@@ -0,0 +1,285 @@
+package indexer
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// RepoStats summarizes the index state of a single repository. Modules
+// breaks its documents down by the Go module they belong to, for
+// repositories with any.
+type RepoStats struct {
+	Repo                string        `json:"repo"`
+	Documents           int64         `json:"documents"`
+	LastSuccessfulIndex *time.Time    `json:"last_successful_index,omitempty"`
+	Commit              string        `json:"commit,omitempty"`
+	ParseErrors         int           `json:"parse_errors"`
+	Modules             []ModuleStats `json:"modules,omitempty"`
+}
+
+// ModuleStats is how many documents of a repository belong to one of its Go
+// modules.
+type ModuleStats struct {
+	Module    string `json:"module"`
+	Documents int64  `json:"documents"`
+}
+
+// IndexStats summarizes the index state across all repositories.
+type IndexStats struct {
+	Index          string      `json:"index"`
+	TotalFunctions int64       `json:"total_functions"`
+	SizeBytes      int64       `json:"size_in_bytes"`
+	ParseErrors    int         `json:"parse_errors"`
+	Repos          []RepoStats `json:"repos"`
+}
+
+// RepoFreshness describes when a repository was last indexed successfully and
+// at which commit, so consumers can tell whether a result may be stale.
+type RepoFreshness struct {
+	LastIndexed *time.Time `json:"last_indexed,omitempty"`
+	Commit      string     `json:"commit,omitempty"`
+}
+
+// indexRecord is a successful index of a repository.
+type indexRecord struct {
+	at     time.Time
+	commit string
+}
+
+// RepoHealth is how fresh a repository's index is, for the detailed health
+// report.
+type RepoHealth struct {
+	Repo        string     `json:"repo"`
+	LastIndexed *time.Time `json:"last_indexed,omitempty"`
+	Commit      string     `json:"commit,omitempty"`
+	AgeSeconds  int64      `json:"age_seconds"`
+	Stale       bool       `json:"stale"`
+}
+
+// freshnessCacheTTL is how long the last index of each repository, read from
+// the index, is reused before it is read again.
+const freshnessCacheTTL = 30 * time.Second
+
+// indexHistory records when each repository was last indexed successfully:
+// by this process, and, from the newest document of each repository in the
+// index, by any process, so freshness survives a restart and covers runs
+// made elsewhere.
+type indexHistory struct {
+	mu          sync.RWMutex
+	started     time.Time
+	lastSuccess map[string]indexRecord
+	indexed     map[string]indexRecord
+	fetched     time.Time
+}
+
+// newIndexHistory creates an empty index history, started now.
+func newIndexHistory() (history *indexHistory) {
+	history = &indexHistory{
+		started:     time.Now(),
+		lastSuccess: make(map[string]indexRecord),
+	}
+	return history
+}
+
+// recordSuccess notes a successful index of the repository at the given commit.
+func (h *indexHistory) recordSuccess(repo string, at time.Time, commit string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastSuccess[repo] = indexRecord{at: at, commit: commit}
+}
+
+// forget drops the record of a deleted repository.
+func (h *indexHistory) forget(repo string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.lastSuccess, repo)
+	delete(h.indexed, repo)
+}
+
+// stale reports whether the last index read from the index is due to be read
+// again at now, claiming the refresh when it is so concurrent callers keep
+// using the cached one meanwhile.
+func (h *indexHistory) stale(now time.Time) (stale bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stale = now.Sub(h.fetched) >= freshnessCacheTTL
+	if stale {
+		h.fetched = now
+	}
+	return stale
+}
+
+// cache replaces the last index of each repository read from the index.
+func (h *indexHistory) cache(latest map[string]elasticsearch.RepoIndexed) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.indexed = make(map[string]indexRecord, len(latest))
+	for repo, last := range latest {
+		h.indexed[repo] = indexRecord{at: last.IndexedAt, commit: last.Commit}
+	}
+}
+
+// freshness returns the last successful index of each repository, the later
+// of this process's runs and the newest document in the index. A run that
+// found nothing changed writes no documents, so only the former sees it.
+func (h *indexHistory) freshness() (repos map[string]RepoFreshness) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	records := maps.Clone(h.indexed)
+	if records == nil {
+		records = make(map[string]indexRecord, len(h.lastSuccess))
+	}
+	for repo, record := range h.lastSuccess {
+		if indexed, found := records[repo]; !found || record.at.After(indexed.at) {
+			records[repo] = record
+		}
+	}
+
+	repos = make(map[string]RepoFreshness, len(records))
+	for repo, record := range records {
+		at := record.at
+		repos[repo] = RepoFreshness{LastIndexed: &at, Commit: record.commit}
+	}
+	return repos
+}
+
+// freshness returns the last successful index of each repository, reading
+// the newest document of each from the index at most every
+// freshnessCacheTTL. When the index can't be read, the last read is kept.
+func (idx *Indexer) freshness(ctx context.Context) (repos map[string]RepoFreshness) {
+	if idx.es != nil && idx.history.stale(time.Now()) {
+		latest, err := idx.es.RepoLastIndexed(ctx)
+		if err != nil {
+			idx.logger.Warn("Failed to read the last index of each repository", "error", err)
+		} else {
+			idx.history.cache(latest)
+		}
+	}
+
+	repos = idx.history.freshness()
+	return repos
+}
+
+// RepoFreshness returns the last successful index of each named repository.
+// Repositories never indexed have an empty entry.
+func (idx *Indexer) RepoFreshness(ctx context.Context, repos []string) (freshness map[string]RepoFreshness) {
+	known := idx.freshness(ctx)
+
+	freshness = make(map[string]RepoFreshness, len(repos))
+	for _, repo := range repos {
+		freshness[repo] = known[repo]
+	}
+	return freshness
+}
+
+// RepoHealth returns the freshness at now of every configured repository and
+// every one in the index, sorted by name. A repository's age counts
+// from its last successful index, or from startup when it hasn't had one, and
+// it is stale once the age passes INDEX_STALE_AFTER. Without a threshold
+// nothing is stale.
+func (idx *Indexer) RepoHealth(ctx context.Context, now time.Time) (repos []RepoHealth) {
+	known := idx.freshness(ctx)
+
+	names := idx.repoNames()
+	for repo := range known {
+		if !slices.Contains(names, repo) {
+			names = append(names, repo)
+		}
+	}
+	sort.Strings(names)
+
+	repos = make([]RepoHealth, 0, len(names))
+	for _, repo := range names {
+		health := RepoHealth{Repo: repo}
+		since := idx.history.started
+		if fresh, found := known[repo]; found {
+			health.LastIndexed = fresh.LastIndexed
+			health.Commit = fresh.Commit
+			since = *fresh.LastIndexed
+		}
+
+		age := now.Sub(since)
+		health.AgeSeconds = int64(age.Seconds())
+		health.Stale = idx.config.IndexStaleAfter > 0 && age > idx.config.IndexStaleAfter
+		repos = append(repos, health)
+	}
+	return repos
+}
+
+// Stats combines Elasticsearch document counts, index size, and the last
+// index of each repository with the indexer's record of parse errors.
+func (idx *Indexer) Stats(ctx context.Context) (stats IndexStats, err error) {
+	stats = IndexStats{
+		Index: idx.config.ESIndex,
+		Repos: []RepoStats{},
+	}
+
+	storage, err := idx.es.StorageStats(ctx)
+	if err != nil {
+		return stats, err
+	}
+	stats.TotalFunctions = storage.Documents
+	stats.SizeBytes = storage.SizeBytes
+
+	counts, err := idx.es.RepoDocumentCounts(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	byRepo := make(map[string]*RepoStats)
+	repoStats := func(repo string) (entry *RepoStats) {
+		entry, found := byRepo[repo]
+		if !found {
+			entry = &RepoStats{Repo: repo}
+			byRepo[repo] = entry
+		}
+		return entry
+	}
+
+	for repo, count := range counts {
+		repoStats(repo).Documents = count
+	}
+
+	moduleCounts, err := idx.es.ModuleDocumentCounts(ctx)
+	if err != nil {
+		return stats, err
+	}
+	for repo, modules := range moduleCounts {
+		entry := repoStats(repo)
+		for _, module := range slices.Sorted(maps.Keys(modules)) {
+			entry.Modules = append(entry.Modules, ModuleStats{Module: module, Documents: modules[module]})
+		}
+	}
+
+	for repo, fresh := range idx.freshness(ctx) {
+		entry := repoStats(repo)
+		entry.LastSuccessfulIndex = fresh.LastIndexed
+		entry.Commit = fresh.Commit
+	}
+
+	for _, failure := range idx.quarantine.list("") {
+		repoStats(failure.Repo).ParseErrors++
+		stats.ParseErrors++
+	}
+
+	for _, entry := range byRepo {
+		stats.Repos = append(stats.Repos, *entry)
+	}
+	sort.Slice(stats.Repos, func(i, j int) (less bool) {
+		less = stats.Repos[i].Repo < stats.Repos[j].Repo
+		return less
+	})
+
+	return stats, err
+}
@@ -0,0 +1,183 @@
+package indexer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_stats/docs,store"):
+			_, _ = w.Write([]byte(`{"_all":{"primaries":{"docs":{"count":150}},"total":{"store":{"size_in_bytes":2048}}}}`))
+		case strings.HasSuffix(r.URL.Path, "/_search"):
+			_, _ = w.Write([]byte(`{"aggregations":{"repos":{"buckets":[{"key":"repo-a","doc_count":100,"modules":{"buckets":[{"key":"example.com/a/tools","doc_count":30},{"key":"example.com/a","doc_count":60}]}},{"key":"repo-b","doc_count":50}]}}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(config.Config{ESHost: srv.URL, ESIndex: "code-index"}, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	idx := New(config.Config{ESIndex: "code-index"}, es, m, nil)
+	lastRun := time.Date(2025, 10, 28, 12, 0, 0, 0, time.UTC)
+	idx.history.recordSuccess("repo-a", lastRun, "4f9c2e1")
+	idx.quarantine.replace("repo-c", []ParseFailure{newParseFailure("repo-c", "broken.go", errors.New("boom"))})
+
+	stats, err := idx.Stats(t.Context())
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+
+	if stats.Index != "code-index" {
+		t.Errorf("Index = %v, want code-index", stats.Index)
+	}
+	if stats.TotalFunctions != 150 {
+		t.Errorf("TotalFunctions = %d, want 150", stats.TotalFunctions)
+	}
+	if stats.SizeBytes != 2048 {
+		t.Errorf("SizeBytes = %d, want 2048", stats.SizeBytes)
+	}
+	if stats.ParseErrors != 1 {
+		t.Errorf("ParseErrors = %d, want 1", stats.ParseErrors)
+	}
+	if len(stats.Repos) != 3 {
+		t.Fatalf("Repos length = %d, want 3", len(stats.Repos))
+	}
+
+	repoA := stats.Repos[0]
+	if repoA.Repo != "repo-a" || repoA.Documents != 100 {
+		t.Errorf("Repos[0] = %+v, want repo-a with 100 documents", repoA)
+	}
+	if repoA.LastSuccessfulIndex == nil || !repoA.LastSuccessfulIndex.Equal(lastRun) {
+		t.Errorf("LastSuccessfulIndex = %v, want %v", repoA.LastSuccessfulIndex, lastRun)
+	}
+	if repoA.Commit != "4f9c2e1" {
+		t.Errorf("Commit = %q, want 4f9c2e1", repoA.Commit)
+	}
+	wantModules := []ModuleStats{{Module: "example.com/a", Documents: 60}, {Module: "example.com/a/tools", Documents: 30}}
+	if !slices.Equal(repoA.Modules, wantModules) || stats.Repos[1].Modules != nil {
+		t.Errorf("Modules = %+v and %+v, want %+v for repo-a only", repoA.Modules, stats.Repos[1].Modules, wantModules)
+	}
+	if stats.Repos[2].Repo != "repo-c" || stats.Repos[2].ParseErrors != 1 {
+		t.Errorf("Repos[2] = %+v, want repo-c with 1 parse error", stats.Repos[2])
+	}
+}
+
+func TestRepoFreshness(t *testing.T) {
+	idx := New(config.Config{}, nil, nil, nil)
+	lastRun := time.Date(2025, 10, 28, 12, 0, 0, 0, time.UTC)
+	idx.history.recordSuccess("repo-a", lastRun, "4f9c2e1")
+	idx.history.recordSuccess("repo-b", lastRun, "8d0a7b3")
+
+	freshness := idx.RepoFreshness(t.Context(), []string{"repo-a", "repo-new"})
+
+	if len(freshness) != 2 {
+		t.Fatalf("RepoFreshness() returned %d repos, want 2", len(freshness))
+	}
+	if freshness["repo-a"].Commit != "4f9c2e1" || !freshness["repo-a"].LastIndexed.Equal(lastRun) {
+		t.Errorf("repo-a = %+v, want commit 4f9c2e1 at %v", freshness["repo-a"], lastRun)
+	}
+	if freshness["repo-new"].LastIndexed != nil {
+		t.Errorf("repo-new = %+v, want empty entry", freshness["repo-new"])
+	}
+}
+
+func TestRepoFreshnessFromIndex(t *testing.T) {
+	var searches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/_search") {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		searches.Add(1)
+		_, _ = w.Write([]byte(`{"aggregations":{"repos":{"buckets":[` +
+			`{"key":"repo-a","latest":{"hits":{"hits":[{"_source":{"indexed_at":"2025-10-28T12:00:00Z","commit":"4f9c2e1"}}]}}},` +
+			`{"key":"repo-b","latest":{"hits":{"hits":[{"_source":{"indexed_at":"2025-10-28T12:00:00Z","commit":"8d0a7b3"}}]}}}]}}}`))
+	}))
+	defer srv.Close()
+
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	es, err := elasticsearch.NewClient(config.Config{ESHost: srv.URL, ESIndex: "code-index"}, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// A fresh process knows the last index of repositories it hasn't run,
+	// and its own later runs win over the index.
+	idx := New(config.Config{ESIndex: "code-index"}, es, m, nil)
+	lastRun := time.Date(2025, 10, 28, 13, 0, 0, 0, time.UTC)
+	idx.history.recordSuccess("repo-b", lastRun, "c0ffee0")
+
+	freshness := idx.RepoFreshness(t.Context(), []string{"repo-a", "repo-b", "repo-new"})
+
+	indexedAt := time.Date(2025, 10, 28, 12, 0, 0, 0, time.UTC)
+	if freshness["repo-a"].LastIndexed == nil || !freshness["repo-a"].LastIndexed.Equal(indexedAt) || freshness["repo-a"].Commit != "4f9c2e1" {
+		t.Errorf("repo-a = %+v, want commit 4f9c2e1 at %v", freshness["repo-a"], indexedAt)
+	}
+	if freshness["repo-b"].LastIndexed == nil || !freshness["repo-b"].LastIndexed.Equal(lastRun) || freshness["repo-b"].Commit != "c0ffee0" {
+		t.Errorf("repo-b = %+v, want commit c0ffee0 at %v", freshness["repo-b"], lastRun)
+	}
+	if freshness["repo-new"].LastIndexed != nil {
+		t.Errorf("repo-new = %+v, want empty entry", freshness["repo-new"])
+	}
+
+	// The aggregation is cached.
+	idx.RepoHealth(t.Context(), time.Now())
+	if got := searches.Load(); got != 1 {
+		t.Errorf("searched %d times, want 1", got)
+	}
+}
+
+func TestRepoHealth(t *testing.T) {
+	idx := New(config.Config{GitRepos: []string{"repo-a", "repo-new"}, IndexStaleAfter: time.Hour}, nil, nil, nil)
+	now := idx.history.started.Add(3 * time.Hour)
+	idx.history.recordSuccess("repo-a", now.Add(-10*time.Minute), "4f9c2e1")
+	idx.history.recordSuccess("repo-old", now.Add(-2*time.Hour), "8d0a7b3")
+
+	repos := idx.RepoHealth(t.Context(), now)
+
+	want := []struct {
+		repo  string
+		age   int64
+		stale bool
+	}{
+		{repo: "repo-a", age: 600, stale: false},
+		{repo: "repo-new", age: 3 * 3600, stale: true},
+		{repo: "repo-old", age: 2 * 3600, stale: true},
+	}
+	if len(repos) != len(want) {
+		t.Fatalf("RepoHealth() = %+v, want %d repos", repos, len(want))
+	}
+	for i, w := range want {
+		if repos[i].Repo != w.repo || repos[i].AgeSeconds != w.age || repos[i].Stale != w.stale {
+			t.Errorf("RepoHealth()[%d] = %+v, want %s aged %ds, stale %v", i, repos[i], w.repo, w.age, w.stale)
+		}
+	}
+	if repos[0].Commit != "4f9c2e1" || repos[1].LastIndexed != nil {
+		t.Errorf("RepoHealth() = %+v, want repo-a's commit and no index of repo-new", repos)
+	}
+
+	idx.config.IndexStaleAfter = 0
+	for _, repo := range idx.RepoHealth(t.Context(), now) {
+		if repo.Stale {
+			t.Errorf("%s stale without a threshold", repo.Repo)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package indexer
+
+import (
+	"context"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/nikogura/rag-indexer/pkg/summary"
+)
+
+// summarizer gives the functions and methods of one repository's index run
+// their summaries, reusing those already indexed for unchanged code.
+type summarizer struct {
+	client   *summary.Client
+	repo     string
+	previous map[string]string
+	metrics  *metrics.Metrics
+	logger   logging.Logger
+}
+
+// summarizer returns the summarizer for an index run of the repository, or
+// of one of its files when filePath is set, or nil when SUMMARY_URL isn't
+// set. The summaries already indexed are read from the live index first, so
+// a rebuild reuses them too; if they can't be read, every summary is
+// generated again.
+func (idx *Indexer) summarizer(ctx context.Context, repo string, filePath string) (s *summarizer) {
+	if idx.summaries == nil {
+		return s
+	}
+
+	previous, err := idx.es.Summaries(ctx, repo, filePath, idx.summaries.Model())
+	if err != nil {
+		idx.logger.Warn("Failed to read indexed summaries; generating them all", "repo", repo, "error", err)
+		previous = map[string]string{}
+	}
+
+	s = &summarizer{
+		client:   idx.summaries,
+		repo:     repo,
+		previous: previous,
+		metrics:  idx.metrics,
+		logger:   idx.logger,
+	}
+	return s
+}
+
+// apply sets the summary of a function or method, reusing the one indexed
+// for the same name and content or else asking the model. A document the
+// model fails on is indexed without one.
+func (s *summarizer) apply(ctx context.Context, doc *elasticsearch.CodeDocument) {
+	if s == nil || doc.ContentHash == "" || doc.IsGenerated {
+		return
+	}
+	if doc.Kind != elasticsearch.KindFunction && doc.Kind != elasticsearch.KindMethod {
+		return
+	}
+
+	key := doc.SummaryKey()
+	text, found := s.previous[key]
+	if found {
+		s.metrics.Summaries.WithLabelValues("reused").Inc()
+	} else {
+		var err error
+		text, err = s.client.Summarize(ctx, *doc)
+		if err != nil {
+			s.logger.Warn("Failed to summarize declaration", "repo", s.repo, "file", doc.FilePath, "name", doc.FunctionName, "error", err)
+			s.metrics.Summaries.WithLabelValues("error").Inc()
+			return
+		}
+		s.metrics.Summaries.WithLabelValues("generated").Inc()
+		s.previous[key] = text
+	}
+
+	doc.Summary = text
+	doc.SummaryModel = s.client.Model()
+}
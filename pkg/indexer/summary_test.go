@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSummaries(t *testing.T) {
+	var mu sync.Mutex
+	indexed := map[string]elasticsearch.CodeDocument{}
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/test-index/_doc":
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			indexed[doc.FunctionName] = doc
+			_, _ = w.Write([]byte(`{}`))
+		case "/test-index/_search":
+			var hits []elasticsearch.StoredDocument
+			for name, doc := range indexed {
+				source, _ := json.Marshal(doc)
+				hits = append(hits, elasticsearch.StoredDocument{ID: name, Source: source})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"_scroll_id": "s1", "hits": map[string]interface{}{"hits": hits}})
+		case "/_search/scroll":
+			_, _ = w.Write([]byte(`{"_scroll_id":"s1","hits":{"hits":[]}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	var calls int
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		calls++
+		content := fmt.Sprintf("Summary %d.", calls)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+	defer model.Close()
+
+	workspace := t.TempDir()
+	write := func(content string) {
+		writeErr := os.WriteFile(filepath.Join(workspace, "retry.go"), []byte(content), 0o600)
+		if writeErr != nil {
+			t.Fatalf("failed to write file: %v", writeErr)
+		}
+	}
+	write("package retry\n\nfunc Do() {}\n\nfunc Wait() {}\n\ntype Policy struct{}\n")
+
+	cfg := config.Config{
+		ESHost:         es.URL,
+		ESIndex:        "test-index",
+		Languages:      []string{"go"},
+		SummaryURL:     model.URL,
+		SummaryModel:   "llama3.2",
+		SummaryTimeout: time.Second,
+		SummaryRPS:     1000,
+	}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	idx := New(cfg, client, m, logging.New(slog.New(slog.DiscardHandler)))
+
+	_, err = idx.IndexPath(t.Context(), workspace, "retry")
+	if err != nil {
+		t.Fatalf("IndexPath() error = %v", err)
+	}
+	if indexed["Do"].Summary == "" || indexed["Wait"].Summary == "" || indexed["Do"].SummaryModel != "llama3.2" {
+		t.Errorf("functions indexed as %+v and %+v, want summaries by llama3.2", indexed["Do"], indexed["Wait"])
+	}
+	if indexed["Policy"].Summary != "" {
+		t.Errorf("type summary = %q, want none", indexed["Policy"].Summary)
+	}
+	if calls != 2 {
+		t.Errorf("model calls = %d, want 2", calls)
+	}
+
+	// Only the changed function is summarized again.
+	previous := indexed["Do"].Summary
+	write("package retry\n\nfunc Do() {}\n\nfunc Wait() { Do() }\n\ntype Policy struct{}\n")
+	_, err = idx.IndexPath(t.Context(), workspace, "retry")
+	if err != nil {
+		t.Fatalf("IndexPath() error = %v", err)
+	}
+	if calls != 3 || indexed["Do"].Summary != previous || indexed["Wait"].Summary != "Summary 3." {
+		t.Errorf("after an edit: %d model calls, Do %q, Wait %q; want 3 calls, Do %q, Wait regenerated", calls, indexed["Do"].Summary, indexed["Wait"].Summary, previous)
+	}
+	if got := testutil.ToFloat64(m.Summaries.WithLabelValues("reused")); got != 1 {
+		t.Errorf("reused summaries = %v, want 1", got)
+	}
+}
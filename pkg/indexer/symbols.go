@@ -0,0 +1,308 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// majorVersion matches the major version element of a module path, such as
+// the v2 of example.com/lib/v2, which isn't the package's name.
+//
+//nolint:gochecknoglobals // compiled once
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// symbolResolver qualifies the functions, methods, and types a file's
+// declarations use as "pkg.Name" or "pkg.Type.Method", by package name, so
+// a use can be matched to the declaration it names in any file. The file
+// is type-checked on its own with go/types, imports stood in for by empty
+// packages, which resolves what the file itself declares, local variables'
+// types included. What it can't resolve, declared in other files of the
+// package or in other packages, falls back on the syntax: a bare name is
+// the file's package's, a method called on the receiver is the receiver
+// type's, and other method calls are left out.
+type symbolResolver struct {
+	pkgName string
+	info    *types.Info
+	imports map[string]string
+}
+
+// newSymbolResolver type-checks a parsed file for resolving its symbols.
+// Type errors, which a file checked without its package and imports is
+// full of, are ignored.
+func newSymbolResolver(fset *token.FileSet, file *ast.File) (r *symbolResolver) {
+	r = &symbolResolver{
+		pkgName: file.Name.Name,
+		info: &types.Info{
+			Uses:       map[*ast.Ident]types.Object{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+		},
+		imports: map[string]string{},
+	}
+
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importName(importPath)
+		local := name
+		if imp.Name != nil {
+			local = imp.Name.Name
+		}
+		r.imports[local] = name
+	}
+
+	conf := types.Config{
+		Importer: importerFunc(func(importPath string) (pkg *types.Package, err error) {
+			pkg = types.NewPackage(importPath, importName(importPath))
+			pkg.MarkComplete()
+			return pkg, err
+		}),
+		Error: func(error) {},
+	}
+	_, _ = conf.Check(file.Name.Name, fset, []*ast.File{file}, r.info)
+	return r
+}
+
+// importerFunc adapts a function to types.Importer.
+type importerFunc func(path string) (pkg *types.Package, err error)
+
+// Import implements types.Importer.
+func (f importerFunc) Import(path string) (pkg *types.Package, err error) {
+	pkg, err = f(path)
+	return pkg, err
+}
+
+// importName guesses the name of the package at an import path: its last
+// element, before any major version element, without a "go-" prefix or a
+// ".v3"-style suffix, such as yaml for gopkg.in/yaml.v3.
+func importName(importPath string) (name string) {
+	name = path.Base(importPath)
+	if majorVersion.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	name, _, _ = strings.Cut(name, ".")
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.ReplaceAll(name, "-", "_")
+	return name
+}
+
+// callees lists the functions and methods a function calls, qualified,
+// sorted and without duplicates. Builtins, conversions, and calls of
+// function values aren't included.
+func (r *symbolResolver) callees(funcDecl *ast.FuncDecl) (callees []string) {
+	if funcDecl.Body == nil {
+		return callees
+	}
+
+	receiver, receiverType := receiverNames(funcDecl)
+	seen := make(map[string]bool)
+	ast.Inspect(funcDecl.Body, func(n ast.Node) (descend bool) {
+		descend = true
+
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return descend
+		}
+
+		var symbol string
+		switch fun := ast.Unparen(call.Fun).(type) {
+		case *ast.Ident:
+			symbol = r.identSymbol(fun, true)
+		case *ast.IndexExpr:
+			ident, isIdent := fun.X.(*ast.Ident)
+			if isIdent {
+				symbol = r.identSymbol(ident, true)
+			}
+		case *ast.SelectorExpr:
+			symbol = r.selectorSymbol(fun, receiver, receiverType)
+		}
+		if symbol != "" && !seen[symbol] {
+			seen[symbol] = true
+			callees = append(callees, symbol)
+		}
+		return descend
+	})
+
+	sort.Strings(callees)
+	return callees
+}
+
+// uses lists the package-level symbols a declaration refers to other than
+// by calling them, qualified, sorted and without duplicates: the types in
+// refs, as written in its References, and the functions, variables, and
+// constants it names, such as a handler passed as a value. A nil node
+// qualifies refs alone.
+func (r *symbolResolver) uses(node ast.Node, refs []string) (uses []string) {
+	seen := make(map[string]bool)
+	add := func(symbol string) {
+		if symbol != "" && !seen[symbol] {
+			seen[symbol] = true
+			uses = append(uses, symbol)
+		}
+	}
+
+	for _, ref := range refs {
+		add(r.qualify(ref))
+	}
+
+	called := make(map[ast.Node]bool)
+	var visit func(n ast.Node) (descend bool)
+	visit = func(n ast.Node) (descend bool) {
+		descend = true
+
+		switch expr := n.(type) {
+		case *ast.CallExpr:
+			called[ast.Unparen(expr.Fun)] = true
+		case *ast.SelectorExpr:
+			// The selected name is a field or method, never a
+			// package-level declaration of its own.
+			descend = false
+			pkg, ok := expr.X.(*ast.Ident)
+			if ok {
+				_, isPkg := r.info.Uses[pkg].(*types.PkgName)
+				if isPkg {
+					if !called[expr] {
+						add(r.imports[pkg.Name] + "." + expr.Sel.Name)
+					}
+					return descend
+				}
+			}
+			ast.Inspect(expr.X, visit)
+		case *ast.Ident:
+			if !called[expr] {
+				add(r.identSymbol(expr, false))
+			}
+		}
+		return descend
+	}
+	if node != nil {
+		ast.Inspect(node, visit)
+	}
+
+	sort.Strings(uses)
+	return uses
+}
+
+// qualify qualifies a name as written in the file, a bare one by the
+// file's package and a selector by the package its import names.
+func (r *symbolResolver) qualify(name string) (symbol string) {
+	qualifier, local, qualified := strings.Cut(name, ".")
+	if !qualified {
+		symbol = r.pkgName + "." + name
+		return symbol
+	}
+
+	pkg, found := r.imports[qualifier]
+	if found {
+		symbol = pkg + "." + local
+	}
+	return symbol
+}
+
+// identSymbol qualifies an identifier naming a package-level declaration.
+// An identifier the file doesn't declare is taken for one declared in
+// another file of its package when it is called, and left out otherwise,
+// since it may as well be a struct field in a literal.
+func (r *symbolResolver) identSymbol(ident *ast.Ident, call bool) (symbol string) {
+	obj, found := r.info.Uses[ident]
+	if !found {
+		if call && ident.Name != "_" {
+			symbol = r.pkgName + "." + ident.Name
+		}
+		return symbol
+	}
+
+	switch obj.(type) {
+	case *types.Func, *types.Var, *types.Const:
+		if obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope() {
+			symbol = obj.Pkg().Name() + "." + obj.Name()
+		}
+	}
+	return symbol
+}
+
+// selectorSymbol qualifies the function or method a selector calls: a
+// package's function, a method go/types resolved, or a method called on
+// the function's receiver.
+func (r *symbolResolver) selectorSymbol(sel *ast.SelectorExpr, receiver string, receiverType string) (symbol string) {
+	ident, isIdent := sel.X.(*ast.Ident)
+	if isIdent {
+		_, isPkg := r.info.Uses[ident].(*types.PkgName)
+		if isPkg {
+			symbol = r.imports[ident.Name] + "." + sel.Sel.Name
+			return symbol
+		}
+	}
+
+	selection, found := r.info.Selections[sel]
+	if found && selection.Kind() == types.MethodVal {
+		named := namedType(selection.Recv())
+		if named != nil && named.Obj().Pkg() != nil {
+			symbol = named.Obj().Pkg().Name() + "." + named.Obj().Name() + "." + sel.Sel.Name
+		}
+		return symbol
+	}
+
+	if isIdent && receiver != "" && ident.Name == receiver {
+		symbol = r.pkgName + "." + receiverType + "." + sel.Sel.Name
+	}
+	return symbol
+}
+
+// namedType returns the named type of a method's receiver, through a
+// pointer, or nil for an unnamed one.
+func namedType(t types.Type) (named *types.Named) {
+	pointer, isPointer := t.(*types.Pointer)
+	if isPointer {
+		t = pointer.Elem()
+	}
+	named, _ = t.(*types.Named)
+	return named
+}
+
+// receiverNames returns the name of a method's receiver and of its type,
+// or "" for a function or an unnamed receiver.
+func receiverNames(funcDecl *ast.FuncDecl) (receiver string, receiverType string) {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 || len(funcDecl.Recv.List[0].Names) == 0 {
+		return receiver, receiverType
+	}
+
+	receiverType = receiverTypeName(funcDecl)
+	if receiverType != "" {
+		receiver = funcDecl.Recv.List[0].Names[0].Name
+	}
+	return receiver, receiverType
+}
+
+// receiverTypeName returns the name of the type a method is declared on,
+// without pointer or type parameters, or "" for a function.
+func receiverTypeName(funcDecl *ast.FuncDecl) (name string) {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return name
+	}
+
+	expr := funcDecl.Recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+			continue
+		case *ast.IndexExpr:
+			expr = e.X
+			continue
+		case *ast.IndexListExpr:
+			expr = e.X
+			continue
+		case *ast.Ident:
+			name = e.Name
+		}
+		return name
+	}
+}
@@ -0,0 +1,101 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"testing"
+)
+
+func TestSymbolResolver(t *testing.T) {
+	const src = `package retry
+
+import (
+	"net/http"
+	yaml "gopkg.in/yaml.v3"
+	"example.com/lib/v2"
+)
+
+type Policy struct{}
+
+func (p *Policy) Next() {}
+
+var defaultPolicy = &Policy{}
+
+func Do(c *http.Client, req *http.Request) (err error) {
+	p := &Policy{}
+	p.Next()
+	backoff(len(req.Header))
+	_ = yaml.Unmarshal(nil, nil)
+	lib.Run(handle, defaultPolicy, http.MethodGet)
+	c.Do(req)
+	return err
+}
+
+func (s *Server) serve() {
+	s.route()
+	s.mux.Handle()
+}
+`
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "retry.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse code: %v", err)
+	}
+	r := newSymbolResolver(fset, file)
+
+	funcs := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if ok {
+			funcs[funcDecl.Name.Name] = funcDecl
+		}
+	}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{
+			name: "callees",
+			got:  r.callees(funcs["Do"]),
+			want: []string{"lib.Run", "retry.Policy.Next", "retry.backoff", "yaml.Unmarshal"},
+		},
+		{
+			name: "uses",
+			got:  r.uses(funcs["Do"], []string{"Policy", "http.Client", "http.Request"}),
+			want: []string{"http.Client", "http.MethodGet", "http.Request", "retry.Policy", "retry.defaultPolicy"},
+		},
+		{
+			name: "calls on the receiver",
+			got:  r.callees(funcs["serve"]),
+			want: []string{"retry.Server.route"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !slices.Equal(tt.got, tt.want) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportName(t *testing.T) {
+	for path, want := range map[string]string{
+		"net/http":                    "http",
+		"gopkg.in/yaml.v3":            "yaml",
+		"github.com/jackc/pgx/v5":     "pgx",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+		"github.com/google/go-github": "github",
+		"example.com/some-lib":        "some_lib",
+	} {
+		if got := importName(path); got != want {
+			t.Errorf("importName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
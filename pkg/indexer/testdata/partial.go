@@ -0,0 +1,22 @@
+package testdata
+
+// This file contains an unresolved merge conflict for testing best-effort parsing
+
+func Before() (result int) {
+	result = 1
+	return result
+}
+
+func Conflicted() (result int) {
+<<<<<<< HEAD
+	result = 1
+=======
+	result = 2
+>>>>>>> feature
+	return result
+}
+
+func After() (result string) {
+	result = "ok"
+	return result
+}
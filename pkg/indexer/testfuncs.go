@@ -0,0 +1,94 @@
+package indexer
+
+import (
+	"go/ast"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// testFuncPrefixes are the name prefixes go test runs functions by.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var testFuncPrefixes = []string{"Test", "Benchmark", "Fuzz"}
+
+// isTestFunc reports whether a declaration in a _test.go file is a test,
+// benchmark, or fuzz target go test runs: a function, not a method, named
+// with one of testFuncPrefixes and then nothing or anything but a lowercase
+// letter. TestMain sets up a package's tests rather than being one.
+func isTestFunc(funcDecl *ast.FuncDecl, filePath string) (test bool) {
+	if !strings.HasSuffix(filePath, "_test.go") || funcDecl.Recv != nil || funcDecl.Name.Name == "TestMain" {
+		return test
+	}
+
+	_, test = testFuncSuffix(funcDecl.Name.Name)
+	return test
+}
+
+// testFuncSuffix returns what follows a test function's prefix, such as
+// "Client_Get" for TestClient_Get, and whether the name has one.
+func testFuncSuffix(name string) (suffix string, found bool) {
+	for _, prefix := range testFuncPrefixes {
+		rest, hasPrefix := strings.CutPrefix(name, prefix)
+		if !hasPrefix {
+			continue
+		}
+		first, _ := utf8.DecodeRuneInString(rest)
+		if rest == "" || !unicode.IsLower(first) {
+			suffix = rest
+			found = true
+			return suffix, found
+		}
+	}
+	return suffix, found
+}
+
+// testSubjects guesses the functions a test exercises, qualified like
+// Callees ("retry.Do", "retry.Policy.Next"). Of the functions it calls, those
+// whose name, with any receiver type, the test's name begins with, ignoring
+// case and underscores, are taken, the longest such match winning:
+// TestParseFileErrors tests parseFile rather than parse. When none of its
+// callees match, which happens when a method's receiver is declared in
+// another file, a name like TestClient_Get or TestClient_Get_missing is
+// taken to mean Client.Get in the test's package if the test calls a Get
+// method.
+func testSubjects(name string, pkgName string, callees []string, calls []string) (subjects []string) {
+	suffix, found := testFuncSuffix(name)
+	if !found || suffix == "" {
+		return subjects
+	}
+
+	key := strings.ToLower(strings.ReplaceAll(suffix, "_", ""))
+	longest := 0
+	for _, callee := range callees {
+		_, symbol, qualified := strings.Cut(callee, ".")
+		if !qualified {
+			continue
+		}
+		candidate := strings.ToLower(strings.ReplaceAll(symbol, ".", ""))
+		switch {
+		case !strings.HasPrefix(key, candidate) || len(candidate) < longest:
+		case len(candidate) > longest:
+			longest = len(candidate)
+			subjects = []string{callee}
+		default:
+			subjects = append(subjects, callee)
+		}
+	}
+	if subjects != nil {
+		return subjects
+	}
+
+	typeName, method, found := strings.Cut(suffix, "_")
+	method, _, _ = strings.Cut(method, "_")
+	if !found || typeName == "" || method == "" {
+		return subjects
+	}
+	for _, call := range calls {
+		if call == method || strings.HasSuffix(call, "."+method) {
+			subjects = []string{strings.TrimSuffix(pkgName, "_test") + "." + typeName + "." + method}
+			return subjects
+		}
+	}
+	return subjects
+}
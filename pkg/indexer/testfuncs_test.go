@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTestFuncs(t *testing.T) {
+	const src = `package retry
+
+import (
+	"testing"
+
+	"example.com/retry/policy"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestDo(t *testing.T) {
+	Do(nil)
+	DoWithContext(nil)
+}
+
+func TestDoWithContextTimeout(t *testing.T) {
+	Do(nil)
+	DoWithContext(nil)
+}
+
+func TestPolicy_Next_exhausted(t *testing.T) {
+	p := NewPolicy()
+	p.Next()
+}
+
+func BenchmarkBackoff(b *testing.B) {
+	for b.Loop() {
+		backoff(1)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) {
+		policy.Parse(s)
+	})
+}
+
+func Testify(t *testing.T) {}
+
+func helper(t *testing.T) {}
+`
+
+	docs, err := parseGoFile("retry/retry_test.go", []byte(src), nil, nil)
+	if err != nil {
+		t.Fatalf("parseGoFile() error = %v", err)
+	}
+
+	got := map[string][]string{}
+	for _, doc := range docs {
+		if doc.IsTestFunc {
+			got[doc.FunctionName] = doc.TestSubjects
+		}
+	}
+	want := map[string][]string{
+		"TestDo":                    {"retry.Do"},
+		"TestDoWithContextTimeout":  {"retry.DoWithContext"},
+		"TestPolicy_Next_exhausted": {"retry.Policy.Next"},
+		"BenchmarkBackoff":          {"retry.backoff"},
+		"FuzzParse":                 {"policy.Parse"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("test functions = %v, want %v", got, want)
+	}
+	for name, subjects := range want {
+		if !slices.Equal(got[name], subjects) {
+			t.Errorf("%s TestSubjects = %v, want %v", name, got[name], subjects)
+		}
+	}
+
+	docs, err = parseGoFile("retry/retry.go", []byte(src), nil, nil)
+	if err != nil {
+		t.Fatalf("parseGoFile() error = %v", err)
+	}
+	for _, doc := range docs {
+		if doc.IsTestFunc {
+			t.Errorf("%s outside a _test.go file is a test function", doc.FunctionName)
+		}
+	}
+}
+
+func TestTestSubjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		callees []string
+		calls   []string
+		want    []string
+	}{
+		{name: "TestClient_Get", callees: []string{"es.Client.Get", "es.NewClient"}, want: []string{"es.Client.Get"}},
+		{name: "TestClient_Get", calls: []string{"client.Get"}, want: []string{"api.Client.Get"}},
+		{name: "TestClient_Get", calls: []string{"client.Put"}},
+		{name: "TestParse", callees: []string{"api.parseFile"}},
+		{name: "TestNew", callees: []string{"api.New", "api.NewClient"}, want: []string{"api.New"}},
+		{name: "Test", callees: []string{"api.Run"}},
+	}
+
+	for _, tt := range tests {
+		got := testSubjects(tt.name, "api_test", tt.callees, tt.calls)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("testSubjects(%q, %v, %v) = %v, want %v", tt.name, tt.callees, tt.calls, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// importPaths maps the names a file's imports are referred to by to their
+// paths. Blank and dot imports aren't referred to by name and are left out.
+func importPaths(file *ast.File) (paths map[string]string) {
+	paths = make(map[string]string, len(file.Imports))
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name := importName(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		paths[name] = importPath
+	}
+	return paths
+}
+
+// setUsageFlags flags what a declaration's code does that retrieval may want
+// to rank down or filter: calling panic or log.Panic, starting goroutines,
+// and using the unsafe, reflect, or cgo ("C") packages. A name that info
+// resolves to something other than the builtin panic or an imported
+// package, such as a local function or variable, is left alone.
+func setUsageFlags(doc *elasticsearch.CodeDocument, node ast.Node, paths map[string]string, info *types.Info) {
+	ast.Inspect(node, func(n ast.Node) (descend bool) {
+		descend = true
+
+		switch expr := n.(type) {
+		case *ast.GoStmt:
+			doc.SpawnsGoroutines = true
+		case *ast.CallExpr:
+			ident, ok := ast.Unparen(expr.Fun).(*ast.Ident)
+			if ok && ident.Name == "panic" {
+				obj := info.Uses[ident]
+				_, builtin := obj.(*types.Builtin)
+				doc.UsesPanic = doc.UsesPanic || obj == nil || builtin
+			}
+		case *ast.SelectorExpr:
+			pkg, ok := expr.X.(*ast.Ident)
+			if !ok {
+				return descend
+			}
+			obj, resolved := info.Uses[pkg]
+			_, isPkg := obj.(*types.PkgName)
+			if resolved && !isPkg {
+				return descend
+			}
+			switch paths[pkg.Name] {
+			case "unsafe":
+				doc.UsesUnsafe = true
+			case "reflect":
+				doc.UsesReflection = true
+			case "C":
+				doc.UsesCgo = true
+			case "log":
+				doc.UsesPanic = doc.UsesPanic || strings.HasPrefix(expr.Sel.Name, "Panic")
+			}
+		}
+		return descend
+	})
+}
@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"testing"
+)
+
+func TestUsageFlags(t *testing.T) {
+	const src = `package poll
+
+// #include <unistd.h>
+import "C"
+
+import (
+	"log"
+	"reflect"
+	"unsafe"
+)
+
+type Header struct {
+	data unsafe.Pointer
+}
+
+var kind = reflect.TypeOf(0).Kind()
+
+func Must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func Fatal() {
+	log.Panicf("no")
+}
+
+func Start(work func()) {
+	go work()
+}
+
+func Sleep() {
+	C.sleep(1)
+}
+
+func Shadowed(log Logger) {
+	panic := func(string) {}
+	panic("no")
+	log.Panic()
+}
+
+func Clean() {
+	_ = Header{}
+}
+`
+	docs, err := parseGoFile("poll.go", []byte(src), nil, nil)
+	if err != nil {
+		t.Fatalf("parseGoFile() error = %v", err)
+	}
+
+	type flags struct {
+		panics, goroutines, unsafe, reflection, cgo bool
+	}
+	want := map[string]flags{
+		"Header":   {unsafe: true},
+		"kind":     {reflection: true},
+		"Must":     {panics: true},
+		"Fatal":    {panics: true},
+		"Start":    {goroutines: true},
+		"Sleep":    {cgo: true},
+		"Shadowed": {},
+		"Clean":    {},
+	}
+	for _, doc := range docs {
+		wantFlags, found := want[doc.FunctionName]
+		if !found {
+			continue
+		}
+		got := flags{doc.UsesPanic, doc.SpawnsGoroutines, doc.UsesUnsafe, doc.UsesReflection, doc.UsesCgo}
+		if got != wantFlags {
+			t.Errorf("%s flags = %+v, want %+v", doc.FunctionName, got, wantFlags)
+		}
+		delete(want, doc.FunctionName)
+	}
+	if len(want) > 0 {
+		t.Errorf("no documents for %v", want)
+	}
+}
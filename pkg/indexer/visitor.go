@@ -1,45 +1,107 @@
 package indexer
 
 import (
-	"context"
 	"go/ast"
+	"go/scanner"
 	"go/token"
+	"sort"
 
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
-	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/lint"
 )
 
-// astVisitor visits AST nodes and indexes functions.
+// astVisitor visits AST nodes and collects documents for declarations.
 type astVisitor struct {
-	ctx       context.Context
-	es        *elasticsearch.Client
-	logger    logging.Logger
-	fset      *token.FileSet
-	content   []byte
-	repo      string
-	filePath  string
-	pkgName   string
-	imports   []string
-	funcCount int
+	fset        *token.FileSet
+	content     []byte
+	linter      *lint.Linter
+	vetFindings []lint.Finding
+	filePath    string
+	pkgName     string
+	imports     []string
+	importPaths map[string]string
+	comments    []*ast.CommentGroup
+	syntaxErrs  scanner.ErrorList
+	symbols     *symbolResolver
+	docs        []elasticsearch.CodeDocument
 }
 
-// Visit implements ast.Visitor interface for function indexing.
+// Visit implements ast.Visitor interface for function and declaration
+// indexing. Only top-level declarations are indexed; function bodies are not
+// descended into.
 func (v *astVisitor) Visit(n ast.Node) (shouldContinue bool) {
-	funcDecl, ok := n.(*ast.FuncDecl)
-	if !ok {
-		shouldContinue = true
+	switch decl := n.(type) {
+	case *ast.FuncDecl:
+		if v.fset.File(decl.End()) == nil {
+			// The parser couldn't find the end of a truncated declaration,
+			// as in a file still being edited.
+			return shouldContinue
+		}
+		doc := extractFunctionDoc(decl, v.fset, v.content, v.filePath, v.pkgName, v.imports)
+		doc.Callees = v.symbols.callees(decl)
+		doc.Uses = v.symbols.uses(decl, doc.References)
+		if isTestFunc(decl, v.filePath) {
+			doc.IsTestFunc = true
+			doc.TestSubjects = testSubjects(decl.Name.Name, v.pkgName, doc.Callees, doc.Calls)
+		}
+		setUsageFlags(&doc, decl, v.importPaths, v.symbols.info)
+		v.setAnnotations(&doc, decl, decl.Doc)
+		v.lintFunction(decl, &doc)
+		doc.HasParseErrors = v.hasParseErrors(decl)
+		v.docs = append(v.docs, doc)
 		return shouldContinue
-	}
-
-	doc := extractFunctionDoc(funcDecl, v.fset, v.content, v.repo, v.filePath, v.pkgName, v.imports)
 
-	indexErr := v.es.IndexDocument(v.ctx, doc)
-	if indexErr != nil {
-		v.logger.Warn("Failed to index function", "function", doc.FunctionName, "error", indexErr)
-	} else {
-		v.funcCount++
+	case *ast.GenDecl:
+		hasParseErrors := v.hasParseErrors(decl)
+		for i, doc := range extractDeclDocs(decl, v.fset, v.content, v.filePath, v.pkgName, v.imports) {
+			// Each type spec has its own document; a const or var
+			// declaration is one document.
+			var node ast.Node = decl
+			docComment := decl.Doc
+			if decl.Tok == token.TYPE {
+				doc.Uses = v.symbols.uses(nil, doc.References)
+				node = decl.Specs[i]
+				typeSpec, ok := node.(*ast.TypeSpec)
+				if ok && decl.Lparen.IsValid() {
+					docComment = typeSpec.Doc
+				}
+			}
+			setUsageFlags(&doc, node, v.importPaths, v.symbols.info)
+			v.setAnnotations(&doc, node, docComment)
+			doc.HasParseErrors = hasParseErrors
+			v.docs = append(v.docs, doc)
+		}
+		return shouldContinue
 	}
 
 	shouldContinue = true
 	return shouldContinue
 }
+
+// hasParseErrors reports whether any syntax error in the file falls within
+// the declaration's lines.
+func (v *astVisitor) hasParseErrors(decl ast.Decl) (found bool) {
+	startLine := v.fset.Position(decl.Pos()).Line
+	endLine := v.fset.Position(decl.End()).Line
+	for _, syntaxErr := range v.syntaxErrs {
+		if syntaxErr.Pos.Line >= startLine && syntaxErr.Pos.Line <= endLine {
+			found = true
+			return found
+		}
+	}
+	return found
+}
+
+// lintFunction records the lint rules the function violates. A function is
+// compliant only when linting is enabled and nothing was found.
+func (v *astVisitor) lintFunction(funcDecl *ast.FuncDecl, doc *elasticsearch.CodeDocument) {
+	findings := v.linter.CheckFunction(v.fset, funcDecl, []byte(doc.Code))
+
+	startLine := v.fset.Position(funcDecl.Pos()).Line
+	endLine := v.fset.Position(funcDecl.End()).Line
+	findings = append(findings, lint.FindingsInRange(v.vetFindings, startLine, endLine)...)
+	sort.Strings(findings)
+
+	doc.LintFindings = findings
+	doc.LintCompliant = v.linter.Active() && len(findings) == 0
+}
@@ -1,23 +1,88 @@
 package indexer
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/enrich"
 	"github.com/nikogura/rag-indexer/pkg/logging"
 	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/nikogura/rag-indexer/pkg/parser"
 )
 
-// fileWalker handles walking a repository tree and indexing Go files.
+// skippedDirs are directories holding dependencies or build output rather
+// than the repository's own code.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var skippedDirs = map[string]bool{
+	"vendor":       true,
+	".git":         true,
+	"node_modules": true,
+	"__pycache__":  true,
+	".venv":        true,
+	".terraform":   true,
+}
+
+// maxPooledBuffer is the largest file buffer kept for reuse. Bigger ones are
+// left to the garbage collector so one huge file doesn't pin its memory.
+const maxPooledBuffer = 1 << 20
+
+// fileBuffers holds buffers for reading files, reused across files and runs.
+//
+//nolint:gochecknoglobals // shared buffer pool
+var fileBuffers = sync.Pool{
+	New: func() (buf any) {
+		buf = &bytes.Buffer{}
+		return buf
+	},
+}
+
+// fileWalker handles walking a repository tree and indexing the files its
+// languages parse.
 type fileWalker struct {
-	ctx        context.Context
-	es         *elasticsearch.Client
-	repoName   string
-	metrics    *metrics.Metrics
-	logger     logging.Logger
-	totalCount int
+	ctx             context.Context
+	es              *elasticsearch.Client
+	repoName        string
+	root            string
+	include         []string
+	includePatterns []string
+	excludePatterns []string
+	skipDirs        []string
+	ignores         *ignoreMatcher
+	commit          string
+	languages       *parser.Registry
+	hook            enrich.Hook
+	summaries       *summarizer
+	overviews       *overviewTracker
+	modules         *goModules
+	manifest        *manifestRun
+	preview         *documentPreview
+	progress        *progressReporter
+	failedDocs      int
+	droppedDocs     int
+	metrics         *metrics.Metrics
+	logger          logging.Logger
+	renames         *renameTracker
+	pause           *pauseGate
+	maxSourceBytes  int
+	maxDocs         int
+	chunkMaxLines   int
+	chunkOverlap    int
+	dups            *duplicateTracker
+	checkpoint      *checkpointer
+	deadLetters     *deadLetterStore
+	budget          *memoryBudget
+	batch           *elasticsearch.DocumentBatch
+	bulkBytes       int
+	limitReached    bool
+	totalCount      int
+	failures        []ParseFailure
 }
 
 // walk processes a single file or directory in the tree.
@@ -27,22 +92,393 @@ func (fw *fileWalker) walk(path string, info os.FileInfo, pathErr error) (procEr
 		return procErr
 	}
 
-	if info.IsDir() && (info.Name() == "vendor" || info.Name() == ".git") {
-		procErr = filepath.SkipDir
+	parse, procErr := fw.admit(path, info)
+	if !parse {
 		return procErr
 	}
 
-	if filepath.Ext(path) != ".go" {
+	if fw.checkpoint.skip() {
+		fw.renames.carry(fw.repoName, fw.relPath(path))
+		fw.progress.fileDone(fw.totalCount)
 		return procErr
 	}
 
-	fileCount, indexErr := indexFile(fw.ctx, fw.es, fw.logger, fw.repoName, path)
-	if indexErr != nil {
-		fw.logger.Warn("Failed to index file", "file", path, "error", indexErr)
-		fw.metrics.ParseErrors.WithLabelValues(fw.repoName, path).Inc()
+	procErr = fw.pause.wait(fw.ctx)
+	if procErr != nil {
 		return procErr
 	}
 
+	reserved, procErr := fw.budget.forFile(fw.ctx, info.Size())
+	if procErr != nil {
+		return procErr
+	}
+
+	fileCount, indexErr := fw.indexFile(path)
+	fw.budget.release(reserved)
 	fw.totalCount += fileCount
+	if indexErr != nil {
+		failure := newParseFailure(fw.repoName, fw.relPath(path), indexErr)
+		failure.Recovered = fileCount
+		fw.logger.Warn("Failed to index file", "repo", fw.repoName, "file", path, "error_class", failure.Class, "recovered", fileCount, "error", indexErr)
+		fw.metrics.ObserveParseError(fw.repoName, failure.Class, failure.FilePath)
+		fw.failures = append(fw.failures, failure)
+	}
+	fw.checkpoint.fileDone(fw.ctx, fw.relPath(path), fw.totalCount)
+	fw.progress.fileDone(fw.totalCount)
+
+	if fw.limitReached {
+		procErr = ErrDocumentLimit
+	}
+
 	return procErr
 }
+
+// admit reports whether the walk parses a file, or, for a directory it
+// leaves out, returns filepath.SkipDir. The ignore files of each directory
+// it enters are loaded.
+func (fw *fileWalker) admit(path string, info os.FileInfo) (parse bool, procErr error) {
+	if info.IsDir() && (skippedDirs[info.Name()] || skippedDir(fw.skipDirs, info.Name())) {
+		procErr = filepath.SkipDir
+		return parse, procErr
+	}
+
+	if !fw.included(path, info.IsDir()) || !fw.selected(path, info.IsDir()) || fw.ignored(path, info.IsDir()) {
+		if info.IsDir() {
+			procErr = filepath.SkipDir
+		}
+		return parse, procErr
+	}
+
+	if info.IsDir() {
+		fw.ignores.load(path, fw.relPath(path))
+		return parse, procErr
+	}
+
+	parse = fw.languages.ForFile(path) != nil
+	return parse, procErr
+}
+
+// countFiles returns how many files a walk of the tree would parse, for
+// reporting its progress. Counting stops at a path that can't be read,
+// where the walk itself would fail.
+func (fw *fileWalker) countFiles() (total int) {
+	_ = filepath.Walk(fw.root, func(path string, info os.FileInfo, pathErr error) (procErr error) {
+		if pathErr != nil {
+			procErr = pathErr
+			return procErr
+		}
+
+		var parse bool
+		parse, procErr = fw.admit(path, info)
+		if parse {
+			total++
+		}
+		return procErr
+	})
+	return total
+}
+
+// module returns the Go module a directory or file belongs to.
+func (fw *fileWalker) module(path string, dir bool) (module *goModule) {
+	if dir {
+		module = fw.modules.forDir(path)
+		return module
+	}
+	module = fw.modules.forFile(path)
+	return module
+}
+
+// included reports whether path is under one of the include paths, or, for
+// a directory, leads to one. Everything is included when none are set.
+func (fw *fileWalker) included(path string, dir bool) (included bool) {
+	rel, relErr := filepath.Rel(fw.root, path)
+	if len(fw.include) == 0 || relErr != nil || rel == "." {
+		included = true
+		return included
+	}
+
+	for _, include := range fw.include {
+		if include == "." || rel == include || strings.HasPrefix(rel, include+string(filepath.Separator)) {
+			included = true
+			return included
+		}
+		if dir && strings.HasPrefix(include, rel+string(filepath.Separator)) {
+			included = true
+			return included
+		}
+	}
+	return included
+}
+
+// indexFile reads a file from disk into a pooled buffer and indexes it with
+// indexContent, unless the manifest has it unchanged since the last run, and
+// records it in the manifest when all of its documents were indexed.
+func (fw *fileWalker) indexFile(filePath string) (docCount int, err error) {
+	if fw.languages.ForFile(filePath) == nil {
+		err = fmt.Errorf("no parser for %s", filepath.Ext(filePath))
+		return docCount, err
+	}
+
+	buf, _ := fileBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			fileBuffers.Put(buf)
+		}
+	}()
+
+	readErr := readFileInto(buf, filePath)
+	if readErr != nil {
+		err = fmt.Errorf("failed to read file: %w", readErr)
+		return docCount, err
+	}
+
+	content := buf.Bytes()
+	rel := fw.relPath(filePath)
+	var hash string
+	if fw.manifest != nil {
+		hash = contentHash(content)
+	}
+	documents, unchanged := fw.manifest.unchanged(rel, filePath, hash)
+	if unchanged {
+		fw.renames.carry(fw.repoName, rel)
+		fw.outline(filePath, content)
+		if fw.preview != nil {
+			fw.preview.skip(filePath, documents)
+		}
+		docCount = documents
+		return docCount, err
+	}
+
+	// Documents copy what they keep of the content, so the buffer can be
+	// reused once they're sent.
+	failed, dropped := fw.failedDocs, fw.droppedDocs
+	docCount, err = fw.indexContent(filePath, content)
+	// A file with copies of code indexed from elsewhere is indexed again
+	// next time, in case the other copy goes away.
+	if err == nil && !fw.limitReached && fw.failedDocs == failed && fw.droppedDocs == dropped {
+		fw.manifest.record(rel, hash, docCount)
+	}
+	return docCount, err
+}
+
+// outline adds a file the manifest has unchanged to its package's document,
+// without indexing it, when the walk writes package documents.
+func (fw *fileWalker) outline(filePath string, content []byte) {
+	if fw.overviews == nil {
+		return
+	}
+
+	docs, _ := fw.languages.ForFile(filePath).ParseFile(filePath, content)
+	file, ok := fileDocument(filePath, content, docs)
+	if ok {
+		file.IsTest = isTestFile(fw.relPath(filePath))
+		fw.overviews.add(file, docs)
+	}
+}
+
+// readFileInto replaces the contents of buf with the file at filePath.
+func readFileInto(buf *bytes.Buffer, filePath string) (err error) {
+	var file *os.File
+	file, err = os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf.Reset()
+	var info os.FileInfo
+	info, err = file.Stat()
+	if err == nil {
+		buf.Grow(int(info.Size()) + bytes.MinRead)
+	}
+
+	_, err = buf.ReadFrom(file)
+	return err
+}
+
+// indexContent parses a file's content with the language registered for its
+// extension and indexes the documents found under filePath. Documents a
+// parser recovered from a malformed file are indexed before its error is
+// returned. With INDEX_OVERVIEWS, the file's own KindFile document comes
+// first, and its declarations are recorded for its package document.
+// Documents still batched are sent before it returns, so the file is done
+// when it does.
+func (fw *fileWalker) indexContent(filePath string, content []byte) (docCount int, err error) {
+	language := fw.languages.ForFile(filePath)
+	if language == nil {
+		err = fmt.Errorf("no parser for %s", filepath.Ext(filePath))
+		return docCount, err
+	}
+
+	test := isTestFile(fw.relPath(filePath))
+	generated := isGenerated(content)
+	module := fw.modules.forFile(filePath)
+
+	docs, parseErr := language.ParseFile(filePath, content)
+	if fw.overviews != nil {
+		file, ok := fileDocument(filePath, content, docs)
+		if ok {
+			file.IsTest = test
+			file.IsGenerated = generated
+			fw.overviews.add(file, docs)
+			docs = append([]elasticsearch.CodeDocument{file}, docs...)
+		}
+	}
+	for _, doc := range docs {
+		doc.IsTest = test
+		doc.IsGenerated = generated
+		module.annotate(&doc)
+		docCount += fw.index(doc, fw.totalCount+docCount)
+		if fw.limitReached {
+			break
+		}
+	}
+	docCount -= fw.flush()
+
+	if parseErr != nil {
+		err = fmt.Errorf("failed to parse file: %w", parseErr)
+	}
+	return docCount, err
+}
+
+// indexPackages indexes the package document of each directory whose files
+// the walk indexed with INDEX_OVERVIEWS.
+func (fw *fileWalker) indexPackages() {
+	for _, doc := range fw.overviews.documents() {
+		fw.modules.forDir(doc.FilePath).annotate(&doc)
+		fw.totalCount += fw.index(doc, fw.totalCount)
+		if fw.limitReached {
+			break
+		}
+	}
+	fw.totalCount -= fw.flush()
+}
+
+// documentFailed logs a document that failed to index. One that couldn't be
+// encoded or that Elasticsearch rejected won't index on a plain retry, so it
+// is also counted and listed with the run's failures, like a file that failed
+// to parse.
+func (fw *fileWalker) documentFailed(doc elasticsearch.CodeDocument, indexErr error) {
+	class := classifyParseError(indexErr)
+	fw.logger.Warn("Failed to index declaration", "repo", fw.repoName, "file", doc.FilePath, "name", doc.FunctionName,
+		"kind", doc.Kind, "chunk", doc.ChunkIndex, "error_class", class, "error", indexErr)
+	if class != parseErrorClassEncode && class != parseErrorClassESReject {
+		return
+	}
+
+	failure := newParseFailure(fw.repoName, fw.relPath(doc.FilePath), fmt.Errorf("%s: %w", doc.FunctionName, indexErr))
+	fw.metrics.ObserveParseError(fw.repoName, failure.Class, failure.FilePath)
+	fw.failures = append(fw.failures, failure)
+}
+
+// index stamps the document with the run's repository and commit, checks it
+// for renames, passes it through the enrichment hook, summarizes it, splits
+// it into chunks when it is too long, hashes each chunk's code for collapsing
+// copies across repositories, and sends the chunks to Elasticsearch, adds
+// them to the bulk batch, or, in a dry run, to the preview, returning how
+// many were indexed. Copies of code already
+// indexed in this run and documents past the repository's limit, given the
+// count indexed so far, are dropped. Chunks that fail to index are kept as
+// dead letters for retry.
+func (fw *fileWalker) index(doc elasticsearch.CodeDocument, indexed int) (count int) {
+	doc.Repo = fw.repoName
+	doc.Commit = fw.commit
+	fw.renames.observe(fw.repoName, fw.relPath(doc.FilePath), &doc)
+	if !fw.dups.claim(doc) {
+		fw.droppedDocs++
+		return count
+	}
+
+	if fw.hook != nil {
+		enrichErr := fw.hook.Enrich(fw.ctx, &doc)
+		if enrichErr != nil {
+			fw.logger.Warn("Failed to enrich document", "repo", fw.repoName, "file", doc.FilePath, "name", doc.FunctionName, "error", enrichErr)
+			fw.metrics.EnrichErrors.WithLabelValues(fw.repoName).Inc()
+		}
+	}
+
+	fw.summaries.apply(fw.ctx, &doc)
+
+	for _, chunk := range doc.Chunks(fw.chunkMaxLines, fw.chunkOverlap) {
+		if fw.maxDocs > 0 && indexed+count >= fw.maxDocs {
+			fw.limitReached = true
+			return count
+		}
+
+		chunk.NormalizedHash = chunk.NormalizedCodeHash()
+		chunk.TruncateCode(fw.maxSourceBytes)
+
+		if fw.preview != nil {
+			fw.preview.add(chunk)
+			count++
+			continue
+		}
+
+		if fw.batch != nil {
+			count += fw.queue(chunk)
+			continue
+		}
+
+		indexErr := fw.es.IndexDocument(fw.ctx, chunk)
+		if indexErr != nil {
+			fw.indexFailed(chunk, indexErr)
+			continue
+		}
+
+		count++
+	}
+	return count
+}
+
+// queue adds a document to the bulk batch, sending the batch once it reaches
+// INDEX_BULK_KB. It returns how many documents it added, less those of the
+// batch that failed to index when it was sent.
+func (fw *fileWalker) queue(doc elasticsearch.CodeDocument) (added int) {
+	addErr := fw.batch.Add(doc)
+	if addErr != nil {
+		fw.indexFailed(doc, addErr)
+		return added
+	}
+
+	added = 1
+	if fw.batch.Size() >= fw.bulkBytes {
+		added -= fw.flush()
+	}
+	return added
+}
+
+// flush sends the documents in the bulk batch, if any, and returns how many
+// failed to index. When the request as a whole fails, all of them have.
+func (fw *fileWalker) flush() (failed int) {
+	if fw.batch == nil || fw.batch.Len() == 0 {
+		return failed
+	}
+	defer fw.batch.Reset()
+
+	failures, batchErr := fw.es.IndexBatch(fw.ctx, fw.batch)
+	if batchErr != nil {
+		for _, doc := range fw.batch.Documents() {
+			fw.indexFailed(doc, batchErr)
+		}
+		failed = fw.batch.Len()
+		return failed
+	}
+
+	for _, failure := range failures {
+		fw.indexFailed(failure.Document, failure.Err)
+	}
+	failed = len(failures)
+	return failed
+}
+
+// indexFailed handles a document that failed to index, keeping it as a dead
+// letter for retry.
+func (fw *fileWalker) indexFailed(doc elasticsearch.CodeDocument, indexErr error) {
+	fw.failedDocs++
+	fw.documentFailed(doc, indexErr)
+	// A document cut short by cancellation is indexed again by the resumed
+	// run.
+	if fw.deadLetters != nil && fw.ctx.Err() == nil {
+		fw.deadLetters.add(doc, indexErr)
+	}
+}
@@ -0,0 +1,432 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/nikogura/rag-indexer/pkg/parser"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestWalker returns a file walker whose documents are captured by a fake
+// Elasticsearch instead of being indexed.
+func newTestWalker(t *testing.T, repo string) (fw *fileWalker, docs *[]elasticsearch.CodeDocument) {
+	t.Helper()
+
+	var mu sync.Mutex
+	docs = &[]elasticsearch.CodeDocument{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_doc") {
+			var doc elasticsearch.CodeDocument
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			mu.Lock()
+			*docs = append(*docs, doc)
+			mu.Unlock()
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	es, err := elasticsearch.NewClient(config.Config{ESHost: srv.URL, ESIndex: "code-index"}, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	fw = &fileWalker{
+		ctx:       t.Context(),
+		es:        es,
+		repoName:  repo,
+		logger:    logging.New(slog.New(slog.DiscardHandler)),
+		renames:   openRenameTracker("", logging.New(slog.New(slog.DiscardHandler))),
+		languages: parser.NewRegistry(&goLanguage{}, markdownLanguage{}, parser.Python{}),
+	}
+	return fw, docs
+}
+
+func TestIndexFileBestEffort(t *testing.T) {
+	noPackage := filepath.Join(t.TempDir(), "nopackage.go")
+	err := os.WriteFile(noPackage, []byte("func Orphan() {}\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		file        string
+		wantErr     bool
+		wantDocs    []string
+		wantFlagged []string
+	}{
+		{
+			name:     "clean file",
+			file:     "testdata/sample.go",
+			wantErr:  false,
+			wantDocs: []string{"ComplexFunction", "FunctionNoErrorHandling", "FunctionNoReturns", "FunctionWithErrorHandling", "FunctionWithNamedReturns", "FunctionWithUnnamedReturns", "process"},
+		},
+		{
+			name:        "merge conflict keeps recovered declarations",
+			file:        "testdata/partial.go",
+			wantErr:     true,
+			wantDocs:    []string{"After", "Before", "Conflicted"},
+			wantFlagged: []string{"Conflicted"},
+		},
+		{
+			name:     "missing package clause drops the file",
+			file:     noPackage,
+			wantErr:  true,
+			wantDocs: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, docs := newTestWalker(t, "repo")
+
+			count, indexErr := fw.indexFile(tt.file)
+			if (indexErr != nil) != tt.wantErr {
+				t.Fatalf("indexFile() error = %v, wantErr %v", indexErr, tt.wantErr)
+			}
+			if indexErr != nil && classifyParseError(indexErr) != parseErrorClassSyntax {
+				t.Errorf("error class = %v, want %v", classifyParseError(indexErr), parseErrorClassSyntax)
+			}
+
+			var names []string
+			var flagged []string
+			for _, doc := range *docs {
+				if doc.Repo != "repo" || doc.Language != languageGo {
+					t.Errorf("%s repo, language = %q, %q, want repo, go", doc.FunctionName, doc.Repo, doc.Language)
+				}
+				if doc.NormalizedHash == "" || doc.NormalizedHash != doc.NormalizedCodeHash() {
+					t.Errorf("%s normalized hash = %q, want the hash of its code", doc.FunctionName, doc.NormalizedHash)
+				}
+				names = append(names, doc.FunctionName)
+				if doc.HasParseErrors {
+					flagged = append(flagged, doc.FunctionName)
+				}
+			}
+			slices.Sort(names)
+
+			if count != len(tt.wantDocs) {
+				t.Errorf("indexFile() count = %d, want %d", count, len(tt.wantDocs))
+			}
+			if !slices.Equal(names, tt.wantDocs) {
+				t.Errorf("indexed = %v, want %v", names, tt.wantDocs)
+			}
+			if !slices.Equal(flagged, tt.wantFlagged) {
+				t.Errorf("flagged = %v, want %v", flagged, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+func TestIndexFileDocumentLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxDocs   int
+		priorDocs int
+		wantCount int
+		wantLimit bool
+	}{
+		{
+			name:      "unlimited",
+			maxDocs:   0,
+			wantCount: 7,
+			wantLimit: false,
+		},
+		{
+			name:      "exactly at limit",
+			maxDocs:   7,
+			wantCount: 7,
+			wantLimit: false,
+		},
+		{
+			name:      "stops at limit",
+			maxDocs:   3,
+			wantCount: 3,
+			wantLimit: true,
+		},
+		{
+			name:      "earlier files count toward limit",
+			maxDocs:   10,
+			priorDocs: 8,
+			wantCount: 2,
+			wantLimit: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, docs := newTestWalker(t, "repo")
+			fw.maxDocs = tt.maxDocs
+			fw.totalCount = tt.priorDocs
+
+			count, err := fw.indexFile("testdata/sample.go")
+			if err != nil {
+				t.Fatalf("indexFile() error = %v", err)
+			}
+
+			if count != tt.wantCount || len(*docs) != tt.wantCount {
+				t.Errorf("indexed %d (sent %d), want %d", count, len(*docs), tt.wantCount)
+			}
+			if fw.limitReached != tt.wantLimit {
+				t.Errorf("limitReached = %v, want %v", fw.limitReached, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestIndexFileBulk(t *testing.T) {
+	tests := []struct {
+		name         string
+		bulkBytes    int
+		wantRequests int
+	}{
+		{
+			name:         "one request for the file",
+			bulkBytes:    1 << 20,
+			wantRequests: 1,
+		},
+		{
+			name:         "flushed by size",
+			bulkBytes:    1,
+			wantRequests: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			var sent []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/code-index/_bulk" {
+					_, _ = w.Write([]byte(`{}`))
+					return
+				}
+				requests++
+
+				var items []string
+				decoder := json.NewDecoder(r.Body)
+				for decoder.More() {
+					var action, doc elasticsearch.CodeDocument
+					_ = decoder.Decode(&action)
+					_ = decoder.Decode(&doc)
+					sent = append(sent, doc.FunctionName)
+					if doc.FunctionName == "process" {
+						items = append(items, `{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}`)
+						continue
+					}
+					items = append(items, `{"index":{"status":201}}`)
+				}
+				_, _ = w.Write([]byte(`{"errors":true,"items":[` + strings.Join(items, ",") + `]}`))
+			}))
+			defer srv.Close()
+
+			fw, _ := newTestWalker(t, "repo")
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			es, err := elasticsearch.NewClient(config.Config{ESHost: srv.URL, ESIndex: "code-index"}, m)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			fw.es = es
+			fw.metrics = m
+			fw.batch = &elasticsearch.DocumentBatch{}
+			fw.bulkBytes = tt.bulkBytes
+
+			count, err := fw.indexFile("testdata/sample.go")
+			if err != nil {
+				t.Fatalf("indexFile() error = %v", err)
+			}
+
+			if requests != tt.wantRequests || len(sent) != 7 {
+				t.Errorf("sent %d documents in %d requests, want 7 in %d", len(sent), requests, tt.wantRequests)
+			}
+			if count != 6 {
+				t.Errorf("indexFile() count = %d, want 6 without the rejected document", count)
+			}
+			if len(fw.failures) != 1 || fw.failures[0].Class != parseErrorClassESReject {
+				t.Errorf("failures = %+v, want the rejected document", fw.failures)
+			}
+			if fw.batch.Len() != 0 {
+				t.Errorf("batch holds %d documents after the file, want none", fw.batch.Len())
+			}
+		})
+	}
+}
+
+func TestWalkSelectsLanguageByExtension(t *testing.T) {
+	repo := t.TempDir()
+	files := map[string]string{
+		"main.go":                  "package main\n\nfunc main() {}\n",
+		"tools/build.py":           "def build():\n    pass\n",
+		"notes.txt":                "def not_python():\n",
+		"node_modules/lib/x.py":    "def vendored():\n    pass\n",
+		"docs/README.md":           "# Usage\n\nRun it.\n",
+		"web/src/app.ts":           "export function render() {}\n",
+		"tools/__pycache__/b.py":   "def cached():\n    pass\n",
+		"vendor/example.com/x.go":  "package x\n\nfunc Vendored() {}\n",
+		"tools/build_test.py":      "def test_build():\n    pass\n",
+		"tools/empty.py":           "",
+		"docs/adr/0001-storage.md": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o750)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	fw, docs := newTestWalker(t, "repo")
+	fw.pause = newPauseGate()
+	err := filepath.Walk(repo, fw.walk)
+	if err != nil {
+		t.Fatalf("walk error = %v", err)
+	}
+
+	var got []string
+	for _, doc := range *docs {
+		got = append(got, doc.Language+":"+doc.FunctionName)
+	}
+	slices.Sort(got)
+
+	want := []string{":Usage", "go:main", "python:build", "python:test_build"}
+	if !slices.Equal(got, want) {
+		t.Errorf("indexed = %v, want %v", got, want)
+	}
+	if fw.totalCount != len(want) {
+		t.Errorf("totalCount = %d, want %d", fw.totalCount, len(want))
+	}
+}
+
+func TestWalkIncludePaths(t *testing.T) {
+	repo := t.TempDir()
+	for _, name := range []string{"cmd/api/main.go", "pkg/store/store.go", "pkg/web/web.go", "internal/x.go", "main.go"} {
+		path := filepath.Join(repo, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o750)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		fn := strings.TrimSuffix(filepath.Base(name), ".go")
+		err = os.WriteFile(path, []byte("package p\n\nfunc "+fn+"() {}\n"), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		want    []string
+	}{
+		{
+			name: "everything by default",
+			want: []string{"main", "main", "store", "web", "x"},
+		},
+		{
+			name:    "directories",
+			include: []string{"cmd", "pkg/store"},
+			want:    []string{"main", "store"},
+		},
+		{
+			name:    "single file",
+			include: []string{"main.go"},
+			want:    []string{"main"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, docs := newTestWalker(t, "repo")
+			fw.pause = newPauseGate()
+			fw.root = repo
+			fw.include = tt.include
+			err := filepath.Walk(repo, fw.walk)
+			if err != nil {
+				t.Fatalf("walk error = %v", err)
+			}
+
+			var got []string
+			for _, doc := range *docs {
+				got = append(got, doc.FunctionName)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("indexed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeHook tags every document with its file's directory as the owning team,
+// failing for files in failDir.
+type fakeHook struct {
+	failDir string
+}
+
+func (h fakeHook) Enrich(_ context.Context, doc *elasticsearch.CodeDocument) (err error) {
+	dir := filepath.Base(filepath.Dir(doc.FilePath))
+	if dir == h.failDir {
+		err = errors.New("catalog unavailable")
+		return err
+	}
+
+	doc.Metadata = map[string]string{"team": dir}
+	return err
+}
+
+func (h fakeHook) Close() (err error) {
+	return err
+}
+
+func TestIndexEnrichesDocuments(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"payments", "search"} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0o755)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(root, dir, "api.go"), []byte("package "+dir+"\n\nfunc Handle"+dir+"() {}\n"), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	fw, docs := newTestWalker(t, "repo")
+	fw.metrics = metrics.NewWithRegisterer(prometheus.NewRegistry())
+	fw.hook = fakeHook{failDir: "search"}
+
+	for _, dir := range []string{"payments", "search"} {
+		_, err := fw.indexFile(filepath.Join(root, dir, "api.go"))
+		if err != nil {
+			t.Fatalf("indexFile() error = %v", err)
+		}
+	}
+
+	if len(*docs) != 2 {
+		t.Fatalf("indexed %d documents, want 2", len(*docs))
+	}
+	if (*docs)[0].Metadata["team"] != "payments" {
+		t.Errorf("payments metadata = %v, want team payments", (*docs)[0].Metadata)
+	}
+	if (*docs)[1].Metadata != nil {
+		t.Errorf("document the hook failed on has metadata %v", (*docs)[1].Metadata)
+	}
+}
@@ -0,0 +1,170 @@
+// Package lint runs style checks against indexed functions so search results
+// can be ranked by lint compliance.
+package lint
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Built-in check IDs. Each is also the rule ID reported in findings.
+const (
+	CheckGofmt        = "gofmt"
+	CheckNamedReturns = "namedreturns"
+	CheckNoInlineErr  = "noinlineerr"
+	CheckGodot        = "godot"
+	CheckFunlen       = "funlen"
+	CheckGovet        = "govet"
+)
+
+// funlen limits, matching the repository's golangci-lint settings.
+const (
+	maxFuncLines      = 100
+	maxFuncStatements = 50
+)
+
+// Linter runs the enabled checks against functions.
+type Linter struct {
+	checks map[string]bool
+}
+
+// New creates a Linter running the given checks. Unknown names are ignored;
+// configuration validates them.
+func New(checks []string) (linter *Linter) {
+	linter = &Linter{checks: make(map[string]bool, len(checks))}
+	for _, check := range checks {
+		linter.checks[check] = true
+	}
+	return linter
+}
+
+// Enabled reports whether the check is enabled. A nil Linter has no checks.
+func (l *Linter) Enabled(check string) (enabled bool) {
+	enabled = l != nil && l.checks[check]
+	return enabled
+}
+
+// Active reports whether any check is enabled.
+func (l *Linter) Active() (active bool) {
+	active = l != nil && len(l.checks) > 0
+	return active
+}
+
+// CheckFunction returns the sorted IDs of the built-in rules the function
+// violates. src is the function's source text.
+func (l *Linter) CheckFunction(fset *token.FileSet, decl *ast.FuncDecl, src []byte) (rules []string) {
+	if l.Enabled(CheckGofmt) && !isFormatted(src) {
+		rules = append(rules, CheckGofmt)
+	}
+
+	if l.Enabled(CheckNamedReturns) && hasUnnamedResults(decl) {
+		rules = append(rules, CheckNamedReturns)
+	}
+
+	if l.Enabled(CheckNoInlineErr) && hasInlineErr(decl) {
+		rules = append(rules, CheckNoInlineErr)
+	}
+
+	if l.Enabled(CheckGodot) && decl.Doc != nil && !strings.HasSuffix(strings.TrimSpace(decl.Doc.Text()), ".") {
+		rules = append(rules, CheckGodot)
+	}
+
+	if l.Enabled(CheckFunlen) && tooLong(fset, decl) {
+		rules = append(rules, CheckFunlen)
+	}
+
+	sort.Strings(rules)
+	return rules
+}
+
+// isFormatted reports whether the declaration is already gofmt-formatted.
+func isFormatted(src []byte) (formatted bool) {
+	out, err := format.Source(src)
+	if err != nil {
+		return formatted
+	}
+
+	formatted = bytes.Equal(out, src)
+	return formatted
+}
+
+// hasUnnamedResults reports whether the function returns values without naming them.
+func hasUnnamedResults(decl *ast.FuncDecl) (unnamed bool) {
+	if decl.Type.Results == nil {
+		return unnamed
+	}
+
+	for _, field := range decl.Type.Results.List {
+		if len(field.Names) == 0 {
+			unnamed = true
+			return unnamed
+		}
+	}
+
+	return unnamed
+}
+
+// hasInlineErr reports whether the function assigns an error in an if
+// statement's init, as in `if err := f(); err != nil`.
+func hasInlineErr(decl *ast.FuncDecl) (found bool) {
+	if decl.Body == nil {
+		return found
+	}
+
+	ast.Inspect(decl.Body, func(n ast.Node) (descend bool) {
+		ifStmt, ok := n.(*ast.IfStmt)
+		if ok && ifStmt.Init != nil {
+			assign, isAssign := ifStmt.Init.(*ast.AssignStmt)
+			if isAssign && assignsErr(assign) {
+				found = true
+			}
+		}
+		descend = !found
+		return descend
+	})
+
+	return found
+}
+
+// assignsErr reports whether the assignment targets a variable named err.
+func assignsErr(assign *ast.AssignStmt) (assigns bool) {
+	for _, lhs := range assign.Lhs {
+		ident, ok := lhs.(*ast.Ident)
+		if ok && ident.Name == "err" {
+			assigns = true
+			return assigns
+		}
+	}
+	return assigns
+}
+
+// tooLong reports whether the function exceeds the funlen line or statement limits.
+func tooLong(fset *token.FileSet, decl *ast.FuncDecl) (long bool) {
+	if decl.Body == nil {
+		return long
+	}
+
+	lines := fset.Position(decl.Body.Rbrace).Line - fset.Position(decl.Body.Lbrace).Line - 1
+	if lines > maxFuncLines {
+		long = true
+		return long
+	}
+
+	statements := 0
+	ast.Inspect(decl.Body, func(n ast.Node) (descend bool) {
+		_, isStmt := n.(ast.Stmt)
+		_, isBlock := n.(*ast.BlockStmt)
+		if isStmt && !isBlock {
+			statements++
+		}
+		descend = true
+		return descend
+	})
+
+	long = statements > maxFuncStatements
+	return long
+}
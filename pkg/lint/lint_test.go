@@ -0,0 +1,163 @@
+package lint
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckFunction(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []string
+		src    string
+		want   []string
+	}{
+		{
+			name:   "compliant",
+			checks: []string{CheckGofmt, CheckNamedReturns, CheckNoInlineErr, CheckGodot, CheckFunlen},
+			src: `// Foo returns a value.
+func Foo() (result string, err error) {
+	err = bar()
+	if err != nil {
+		return result, err
+	}
+	return result, err
+}`,
+			want: nil,
+		},
+		{
+			name:   "unnamed returns",
+			checks: []string{CheckNamedReturns},
+			src: `func Foo() (string, error) {
+	return "", nil
+}`,
+			want: []string{CheckNamedReturns},
+		},
+		{
+			name:   "inline err",
+			checks: []string{CheckNoInlineErr},
+			src: `func Foo() (err error) {
+	if err := bar(); err != nil {
+		return err
+	}
+	return err
+}`,
+			want: []string{CheckNoInlineErr},
+		},
+		{
+			name:   "doc without period and unformatted",
+			checks: []string{CheckGofmt, CheckGodot},
+			src: `// Foo does things
+func Foo() {
+  bar()
+}`,
+			want: []string{CheckGodot, CheckGofmt},
+		},
+		{
+			name:   "too many lines",
+			checks: []string{CheckFunlen},
+			src:    "func Foo() {\n" + strings.Repeat("\t_ = 1\n", 101) + "}",
+			want:   []string{CheckFunlen},
+		},
+		{
+			name:   "disabled checks",
+			checks: nil,
+			src: `func Foo() (string, error) {
+	if err := bar(); err != nil {
+		return "", err
+	}
+	return "", nil
+}`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "", "package test\n\n"+tt.src, parser.ParseComments)
+			if err != nil {
+				t.Fatalf("Failed to parse code: %v", err)
+			}
+
+			decl, ok := file.Decls[0].(*ast.FuncDecl)
+			if !ok {
+				t.Fatal("No function declaration found")
+			}
+			start := fset.Position(decl.Pos()).Offset
+			end := fset.Position(decl.End()).Offset
+			src := []byte(("package test\n\n" + tt.src)[start:end])
+
+			got := New(tt.checks).CheckFunction(fset, decl, src)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("CheckFunction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVetOutput(t *testing.T) {
+	repoPath := t.TempDir()
+	output := `# example.com/x
+# [example.com/x]
+{
+	"example.com/x": {
+		"printf": [
+			{
+				"posn": "` + filepath.Join(repoPath, "x.go") + `:6:14",
+				"message": "fmt.Sprintf format %d has arg \"a\" of wrong type string"
+			}
+		]
+	}
+}
+vet: broken/y.go:3:1: expected declaration
+{
+	"example.com/y": {
+		"unusedresult": [
+			{
+				"posn": "y.go:10:2",
+				"message": "result of fmt.Sprint call not used"
+			}
+		],
+		"error": {
+			"error": "type-check failed"
+		}
+	}
+}
+`
+
+	findings, err := parseVetOutput([]byte(output), repoPath)
+	if err != nil {
+		t.Fatalf("parseVetOutput() error = %v", err)
+	}
+
+	xFindings := findings[filepath.Join(repoPath, "x.go")]
+	if len(xFindings) != 1 || xFindings[0].Rule != "govet/printf" || xFindings[0].Line != 6 {
+		t.Errorf("x.go findings = %+v, want govet/printf at line 6", xFindings)
+	}
+
+	yFindings := findings[filepath.Join(repoPath, "y.go")]
+	if len(yFindings) != 1 || yFindings[0].Rule != "govet/unusedresult" || yFindings[0].Line != 10 {
+		t.Errorf("y.go findings = %+v, want govet/unusedresult at line 10", yFindings)
+	}
+}
+
+func TestFindingsInRange(t *testing.T) {
+	findings := []Finding{
+		{Rule: "govet/printf", Line: 3},
+		{Rule: "govet/copylocks", Line: 5},
+		{Rule: "govet/printf", Line: 7},
+		{Rule: "govet/shadow", Line: 20},
+	}
+
+	got := FindingsInRange(findings, 3, 10)
+	want := []string{"govet/copylocks", "govet/printf"}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindingsInRange() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vetTimeout bounds a go vet run over one repository.
+const vetTimeout = 5 * time.Minute
+
+// Finding is a diagnostic reported at a line of a file.
+type Finding struct {
+	Rule string
+	Line int
+}
+
+// vetDiagnostic is one entry of go vet's JSON output.
+type vetDiagnostic struct {
+	Posn    string `json:"posn"`
+	Message string `json:"message"`
+}
+
+// VetRepo runs go vet over the module at repoPath and returns its findings
+// keyed by absolute file path. Rule IDs are "govet/<analyzer>". Packages that
+// fail to type-check are skipped, so a partial result is still returned.
+func VetRepo(ctx context.Context, repoPath string) (findings map[string][]Finding, err error) {
+	ctx, cancel := context.WithTimeout(ctx, vetTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "vet", "-json", "./...")
+	cmd.Dir = repoPath
+
+	// Depending on the Go version the JSON goes to stdout or stderr, so both
+	// are collected; parseVetOutput drops anything that isn't JSON.
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	// go vet -json exits zero even with diagnostics; a non-zero exit means
+	// some packages failed to load, which still leaves usable output.
+	runErr := cmd.Run()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("go vet timed out after %v: %w", vetTimeout, ctx.Err())
+		return findings, err
+	}
+
+	findings, err = parseVetOutput(output.Bytes(), repoPath)
+	if err != nil {
+		return findings, err
+	}
+
+	if runErr != nil && len(findings) == 0 {
+		err = fmt.Errorf("go vet failed: %w", runErr)
+		return findings, err
+	}
+
+	return findings, err
+}
+
+// parseVetOutput decodes go vet's JSON output: one indented JSON object per
+// package, interleaved with "# package" comments and plain-text load errors.
+// Only lines that can belong to the indented JSON are kept.
+func parseVetOutput(output []byte, repoPath string) (findings map[string][]Finding, err error) {
+	var jsonOnly bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || !(line[0] == '{' || line[0] == '}' || line[0] == '\t' || line[0] == ' ') {
+			continue
+		}
+		jsonOnly.WriteString(line)
+		jsonOnly.WriteByte('\n')
+	}
+
+	findings = make(map[string][]Finding)
+	decoder := json.NewDecoder(&jsonOnly)
+	for decoder.More() {
+		var packages map[string]map[string]json.RawMessage
+		err = decoder.Decode(&packages)
+		if err != nil {
+			err = fmt.Errorf("failed to decode go vet output: %w", err)
+			return findings, err
+		}
+
+		for _, analyzers := range packages {
+			for analyzer, raw := range analyzers {
+				var diagnostics []vetDiagnostic
+				if json.Unmarshal(raw, &diagnostics) != nil {
+					// Package load errors are objects, not diagnostic lists.
+					continue
+				}
+				for _, diagnostic := range diagnostics {
+					file, line := splitPosition(diagnostic.Posn, repoPath)
+					if file == "" {
+						continue
+					}
+					findings[file] = append(findings[file], Finding{Rule: CheckGovet + "/" + analyzer, Line: line})
+				}
+			}
+		}
+	}
+
+	return findings, err
+}
+
+// splitPosition parses a "file:line:col" position into an absolute file path
+// and line number.
+func splitPosition(posn string, repoPath string) (file string, line int) {
+	parts := strings.Split(posn, ":")
+	if len(parts) < 3 {
+		return file, line
+	}
+
+	var err error
+	line, err = strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		line = 0
+		return file, line
+	}
+
+	file = strings.Join(parts[:len(parts)-2], ":")
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(repoPath, file)
+	}
+
+	file, err = filepath.Abs(file)
+	if err != nil {
+		file = ""
+	}
+
+	return file, line
+}
+
+// FindingsInRange returns the sorted, de-duplicated rules of findings between
+// the start and end lines inclusive.
+func FindingsInRange(findings []Finding, start int, end int) (rules []string) {
+	seen := make(map[string]bool)
+	for _, finding := range findings {
+		if finding.Line < start || finding.Line > end || seen[finding.Rule] {
+			continue
+		}
+		seen[finding.Rule] = true
+		rules = append(rules, finding.Rule)
+	}
+
+	sort.Strings(rules)
+	return rules
+}
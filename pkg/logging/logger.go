@@ -1,4 +1,6 @@
-// Package logging provides a structured logging interface.
+// Package logging provides a structured logging interface. Messages logged
+// with a context carry the request ID stored in it, so every line logged
+// while serving a request can be found by its ID.
 package logging
 
 import (
@@ -16,6 +18,31 @@ type Logger interface {
 	ErrorContext(ctx context.Context, msg string, args ...any)
 }
 
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) (derived context.Context) {
+	derived = context.WithValue(ctx, requestIDKey{}, id)
+	return derived
+}
+
+// RequestID returns the request ID carried by ctx, or "" when there is none.
+func RequestID(ctx context.Context) (id string) {
+	id, _ = ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextArgs adds the request ID carried by ctx, if any, to args.
+func contextArgs(ctx context.Context, args []any) (withID []any) {
+	withID = args
+	id := RequestID(ctx)
+	if id != "" {
+		withID = append([]any{"request_id", id}, args...)
+	}
+	return withID
+}
+
 // SlogLogger wraps slog.Logger to implement our Logger interface.
 type SlogLogger struct {
 	logger *slog.Logger
@@ -42,17 +69,17 @@ func (l *SlogLogger) Error(msg string, args ...any) {
 	l.logger.Error(msg, args...)
 }
 
-// InfoContext logs an info level message with context.
+// InfoContext logs an info level message with context, tagged with its request ID.
 func (l *SlogLogger) InfoContext(ctx context.Context, msg string, args ...any) {
-	l.logger.InfoContext(ctx, msg, args...)
+	l.logger.InfoContext(ctx, msg, contextArgs(ctx, args)...)
 }
 
-// WarnContext logs a warning level message with context.
+// WarnContext logs a warning level message with context, tagged with its request ID.
 func (l *SlogLogger) WarnContext(ctx context.Context, msg string, args ...any) {
-	l.logger.WarnContext(ctx, msg, args...)
+	l.logger.WarnContext(ctx, msg, contextArgs(ctx, args)...)
 }
 
-// ErrorContext logs an error level message with context.
+// ErrorContext logs an error level message with context, tagged with its request ID.
 func (l *SlogLogger) ErrorContext(ctx context.Context, msg string, args ...any) {
-	l.logger.ErrorContext(ctx, msg, args...)
+	l.logger.ErrorContext(ctx, msg, contextArgs(ctx, args)...)
 }
@@ -0,0 +1,181 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Redacted replaces a secret in redacted text.
+const Redacted = "[REDACTED]"
+
+// minSecretLen is the shortest secret masked. Shorter values would mask
+// ordinary words and numbers throughout the logs.
+const minSecretLen = 4
+
+// urlCredentials matches the credentials in a URL's user info, such as a
+// token embedded in a clone URL.
+//
+//nolint:gochecknoglobals // compiled once
+var urlCredentials = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s@'"]+@`)
+
+// RedactURLs masks the credentials of every URL in s, leaving the host and
+// path so the URL can still be told apart.
+func RedactURLs(s string) (redacted string) {
+	redacted = urlCredentials.ReplaceAllString(s, "${1}"+Redacted+"@")
+	return redacted
+}
+
+// Redactor masks configured secrets, and the credentials of URLs, in text
+// about to be written.
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// NewRedactor creates a redactor for secrets. Empty values and those shorter
+// than four characters are ignored.
+func NewRedactor(secrets ...string) (r *Redactor) {
+	// Longer secrets first, so one containing another is masked whole.
+	secrets = slices.Clone(secrets)
+	slices.SortFunc(secrets, func(a string, b string) (order int) {
+		order = len(b) - len(a)
+		return order
+	})
+
+	var pairs []string
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLen {
+			pairs = append(pairs, secret, Redacted)
+		}
+	}
+
+	r = &Redactor{replacer: strings.NewReplacer(pairs...)}
+	return r
+}
+
+// String returns s with secrets and URL credentials masked.
+func (r *Redactor) String(s string) (redacted string) {
+	redacted = RedactURLs(r.replacer.Replace(s))
+	return redacted
+}
+
+// Writer returns a writer that masks secrets in what is written to w, for
+// output such as the standard logger's that doesn't go through a Logger.
+// Each write is masked on its own, so a secret split across writes isn't.
+func (r *Redactor) Writer(w io.Writer) (redacting io.Writer) {
+	redacting = redactingWriter{w: w, r: r}
+	return redacting
+}
+
+// redactingWriter masks secrets in each write before passing it on.
+type redactingWriter struct {
+	w io.Writer
+	r *Redactor
+}
+
+// Write masks secrets in p and writes the result, reporting all of p as
+// written when it succeeds.
+func (rw redactingWriter) Write(p []byte) (n int, err error) {
+	_, err = io.WriteString(rw.w, rw.r.String(string(p)))
+	if err == nil {
+		n = len(p)
+	}
+	return n, err
+}
+
+// Handler wraps h so secrets and URL credentials are masked in each record's
+// message and attribute values before it is written.
+func (r *Redactor) Handler(h slog.Handler) (handler slog.Handler) {
+	handler = &redactingHandler{next: h, r: r}
+	return handler
+}
+
+// redactingHandler is a slog.Handler masking secrets before the handler it
+// wraps sees them.
+type redactingHandler struct {
+	next slog.Handler
+	r    *Redactor
+}
+
+// Enabled reports whether the wrapped handler handles records at level.
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) (enabled bool) {
+	enabled = h.next.Enabled(ctx, level)
+	return enabled
+}
+
+// Handle masks the record and passes it on.
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) (err error) {
+	masked := slog.NewRecord(record.Time, record.Level, h.r.String(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		masked.AddAttrs(h.attr(attr))
+		return true
+	})
+
+	err = h.next.Handle(ctx, masked)
+	return err
+}
+
+// WithAttrs masks attrs and returns a handler adding them to every record.
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) (handler slog.Handler) {
+	masked := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		masked[i] = h.attr(attr)
+	}
+
+	handler = &redactingHandler{next: h.next.WithAttrs(masked), r: h.r}
+	return handler
+}
+
+// WithGroup returns a handler nesting later attributes under name.
+func (h *redactingHandler) WithGroup(name string) (handler slog.Handler) {
+	handler = &redactingHandler{next: h.next.WithGroup(name), r: h.r}
+	return handler
+}
+
+// attr masks an attribute's value. Strings, errors, and anything else
+// rendered as text are masked; numbers and other kinds can't hold a secret
+// and are kept as they are.
+func (h *redactingHandler) attr(attr slog.Attr) (masked slog.Attr) {
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		masked = slog.String(attr.Key, h.r.String(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		attrs := make([]any, len(group))
+		for i, member := range group {
+			attrs[i] = h.attr(member)
+		}
+		masked = slog.Group(attr.Key, attrs...)
+	case slog.KindAny:
+		masked = h.anyAttr(attr.Key, value.Any())
+	default:
+		masked = slog.Attr{Key: attr.Key, Value: value}
+	}
+	return masked
+}
+
+// anyAttr masks a value of any kind, rendering errors, Stringers, and string
+// slices as the handlers would, so what they print is what gets masked.
+func (h *redactingHandler) anyAttr(key string, value any) (masked slog.Attr) {
+	switch typed := value.(type) {
+	case error:
+		masked = slog.String(key, h.r.String(typed.Error()))
+	case []string:
+		strs := make([]string, len(typed))
+		for i, s := range typed {
+			strs[i] = h.r.String(s)
+		}
+		masked = slog.Any(key, strs)
+	case fmt.Stringer:
+		masked = slog.String(key, h.r.String(typed.String()))
+	default:
+		masked = slog.Any(key, value)
+	}
+	return masked
+}
@@ -2,65 +2,460 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-// Metrics holds Prometheus metrics for the code indexer.
+// maxExemplarRunes is the Prometheus limit on the combined length of an
+// exemplar's label names and values.
+const maxExemplarRunes = 128
+
+// Metrics holds Prometheus metrics for the code indexer. All but the HTTP
+// server's request, rejection, and SLO metrics are labelled with the tenant
+// they're for, empty for the default profile, which Prometheus leaves out;
+// ForTenant returns a tenant's.
 type Metrics struct {
-	FunctionsIndexed    *prometheus.CounterVec
-	ReposIndexed        prometheus.Counter
-	IndexingDuration    *prometheus.HistogramVec
-	ParseErrors         *prometheus.CounterVec
-	ESRequests          *prometheus.CounterVec
-	LastSuccessfulIndex *prometheus.GaugeVec
+	FunctionsIndexed     *prometheus.CounterVec
+	ReposIndexed         prometheus.Counter
+	IndexingDuration     prometheus.ObserverVec
+	ParseErrors          *prometheus.CounterVec
+	DocumentLimitHits    *prometheus.CounterVec
+	EnrichErrors         *prometheus.CounterVec
+	ESRequests           *prometheus.CounterVec
+	LastSuccessfulIndex  *prometheus.GaugeVec
+	Exports              *prometheus.CounterVec
+	LastSuccessfulExport prometheus.Gauge
+	SLORequests          *prometheus.CounterVec
+	SLORequestsGood      *prometheus.CounterVec
+	SLOLatencyThreshold  prometheus.Gauge
+	SLOObjective         prometheus.Gauge
+	RequestsRejected     *prometheus.CounterVec
+	RerankDuration       prometheus.ObserverVec
+	RewriteDuration      prometheus.ObserverVec
+	QueueJobs            *prometheus.CounterVec
+	DeadLetters          prometheus.Gauge
+	DeadLetterReplays    *prometheus.CounterVec
+	ESBreakerState       prometheus.Gauge
+	ESBreakerOpens       prometheus.Counter
+	HTTPRequestDuration  *prometheus.HistogramVec
+	SearchDuration       prometheus.ObserverVec
+	SearchResults        prometheus.ObserverVec
+	SearchZeroResults    *prometheus.CounterVec
+	ReindexTriggers      *prometheus.CounterVec
+	ParseMemoryReserved  prometheus.Gauge
+	EmbeddingCache       *prometheus.CounterVec
+	Summaries            *prometheus.CounterVec
+	IndexProgress        *prometheus.GaugeVec
+
+	tenant string
+	vecs   *tenantVecs
 }
 
-// New creates and registers new Prometheus metrics.
+// tenantVecs holds the metrics labelled by tenant, before they're curried
+// with one.
+type tenantVecs struct {
+	functionsIndexed     *prometheus.CounterVec
+	reposIndexed         *prometheus.CounterVec
+	indexingDuration     *prometheus.HistogramVec
+	parseErrors          *prometheus.CounterVec
+	documentLimitHits    *prometheus.CounterVec
+	enrichErrors         *prometheus.CounterVec
+	esRequests           *prometheus.CounterVec
+	lastSuccessfulIndex  *prometheus.GaugeVec
+	exports              *prometheus.CounterVec
+	lastSuccessfulExport *prometheus.GaugeVec
+	rerankDuration       *prometheus.HistogramVec
+	rewriteDuration      *prometheus.HistogramVec
+	queueJobs            *prometheus.CounterVec
+	deadLetters          *prometheus.GaugeVec
+	deadLetterReplays    *prometheus.CounterVec
+	esBreakerState       *prometheus.GaugeVec
+	esBreakerOpens       *prometheus.CounterVec
+	searchDuration       *prometheus.HistogramVec
+	searchResults        *prometheus.HistogramVec
+	searchZeroResults    *prometheus.CounterVec
+	reindexTriggers      *prometheus.CounterVec
+	parseMemoryReserved  *prometheus.GaugeVec
+	embeddingCache       *prometheus.CounterVec
+	summaries            *prometheus.CounterVec
+	indexProgress        *prometheus.GaugeVec
+}
+
+// New creates and registers new Prometheus metrics with the default registerer.
 func New() (metrics *Metrics) {
-	metrics = &Metrics{
-		FunctionsIndexed: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "code_indexer_functions_indexed_total",
-				Help: "Total number of functions indexed",
-			},
-			[]string{"repo"},
-		),
-		ReposIndexed: promauto.NewCounter(
-			prometheus.CounterOpts{
-				Name: "code_indexer_repos_indexed_total",
-				Help: "Total number of repositories indexed",
-			},
-		),
-		IndexingDuration: promauto.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Name:    "code_indexer_indexing_duration_seconds",
-				Help:    "Time taken to index a repository",
-				Buckets: prometheus.DefBuckets,
-			},
-			[]string{"repo"},
-		),
-		ParseErrors: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "code_indexer_parse_errors_total",
-				Help: "Total number of parse errors",
-			},
-			[]string{"repo", "file"},
-		),
-		ESRequests: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "code_indexer_elasticsearch_requests_total",
-				Help: "Total number of Elasticsearch requests",
-			},
-			[]string{"operation", "status"},
-		),
-		LastSuccessfulIndex: promauto.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "code_indexer_last_successful_index_timestamp",
-				Help: "Timestamp of last successful index",
-			},
-			[]string{"repo"},
-		),
-	}
+	metrics = NewWithRegisterer(prometheus.DefaultRegisterer)
+	return metrics
+}
+
+// NewWithRegisterer creates and registers new Prometheus metrics with the given
+// registerer, so tests can use an isolated registry.
+func NewWithRegisterer(reg prometheus.Registerer) (metrics *Metrics) {
+	factory := promauto.With(reg)
+
+	vecs := &tenantVecs{}
+	registerIndexingMetrics(factory, vecs)
+	registerQueueMetrics(factory, vecs)
+	registerElasticsearchMetrics(factory, vecs)
+	registerSearchMetrics(factory, vecs)
+
+	metrics = &Metrics{vecs: vecs}
+	registerServerMetrics(factory, metrics)
+	metrics.curry("")
 	return metrics
 }
+
+// registerIndexingMetrics registers the metrics of index runs and the files they parse.
+func registerIndexingMetrics(factory promauto.Factory, vecs *tenantVecs) {
+	vecs.functionsIndexed = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_functions_indexed_total",
+			Help: "Total number of functions indexed",
+		},
+		[]string{"repo", "tenant"},
+	)
+	vecs.reposIndexed = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_repos_indexed_total",
+			Help: "Total number of repositories indexed",
+		},
+		[]string{"tenant"},
+	)
+	vecs.indexingDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_indexer_indexing_duration_seconds",
+			Help:    "Time taken to index a repository",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"repo", "tenant"},
+	)
+	vecs.parseErrors = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_parse_errors_total",
+			Help: "Files that failed to parse and documents that failed to index, by repo and error class (syntax, read, encode, es_reject, or other)",
+		},
+		[]string{"repo", "class", "tenant"},
+	)
+	vecs.documentLimitHits = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_document_limit_hits_total",
+			Help: "Total number of index runs stopped by the per-repo document limit",
+		},
+		[]string{"repo", "tenant"},
+	)
+	vecs.enrichErrors = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_enrich_errors_total",
+			Help: "Total number of documents indexed without enrichment because the hook failed",
+		},
+		[]string{"repo", "tenant"},
+	)
+	vecs.lastSuccessfulIndex = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_last_successful_index_timestamp",
+			Help: "Timestamp of last successful index",
+		},
+		[]string{"repo", "tenant"},
+	)
+	vecs.parseMemoryReserved = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_parse_memory_reserved_bytes",
+			Help: "Memory reserved from INDEX_MEMORY_MB by files being parsed",
+		},
+		[]string{"tenant"},
+	)
+	vecs.summaries = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_summaries_total",
+			Help: "Declarations given a summary at index time, by result (generated, reused, or error)",
+		},
+		[]string{"result", "tenant"},
+	)
+	vecs.indexProgress = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_index_progress",
+			Help: "Progress of each repository's latest index run, by measure (files_processed, files_total, functions_indexed, or eta_seconds)",
+		},
+		[]string{"repo", "measure", "tenant"},
+	)
+}
+
+// registerQueueMetrics registers the metrics of the index queue, dead letters, and reindexes
+// requested through the API.
+func registerQueueMetrics(factory promauto.Factory, vecs *tenantVecs) {
+	vecs.queueJobs = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_queue_jobs_total",
+			Help: "Index queue jobs by result (enqueued, deduplicated, completed, retried, failed, or released)",
+		},
+		[]string{"result", "tenant"},
+	)
+	vecs.deadLetters = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_dead_letter_documents",
+			Help: "Documents that failed to index and are kept for retry",
+		},
+		[]string{"tenant"},
+	)
+	vecs.deadLetterReplays = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_dead_letter_replays_total",
+			Help: "Dead-lettered documents replayed, by status (success or error)",
+		},
+		[]string{"status", "tenant"},
+	)
+	vecs.reindexTriggers = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_reindex_triggers_total",
+			Help: "Reindexes requested through the API, by result (started, in_progress, shutting_down, or error)",
+		},
+		[]string{"result", "tenant"},
+	)
+}
+
+// registerElasticsearchMetrics registers the metrics of Elasticsearch requests, its
+// circuit breaker, and exports of the index.
+func registerElasticsearchMetrics(factory promauto.Factory, vecs *tenantVecs) {
+	vecs.esRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_elasticsearch_requests_total",
+			Help: "Total number of Elasticsearch requests",
+		},
+		[]string{"operation", "status", "tenant"},
+	)
+	vecs.esBreakerState = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_elasticsearch_breaker_state",
+			Help: "State of the Elasticsearch circuit breaker (0 closed, 1 open, 2 half-open)",
+		},
+		[]string{"tenant"},
+	)
+	vecs.esBreakerOpens = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_elasticsearch_breaker_opens_total",
+			Help: "Times the Elasticsearch circuit breaker opened",
+		},
+		[]string{"tenant"},
+	)
+	vecs.exports = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_exports_total",
+			Help: "Total number of index exports to object storage",
+		},
+		[]string{"status", "tenant"},
+	)
+	vecs.lastSuccessfulExport = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_last_successful_export_timestamp",
+			Help: "Timestamp of last successful index export",
+		},
+		[]string{"tenant"},
+	)
+}
+
+// registerSearchMetrics registers the metrics of searches and the stages they run.
+func registerSearchMetrics(factory promauto.Factory, vecs *tenantVecs) {
+	vecs.searchDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_indexer_search_duration_seconds",
+			Help:    "Time taken to run searches, reranking included, by endpoint and status (success or error)",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"endpoint", "status", "tenant"},
+	)
+	vecs.searchResults = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_indexer_search_results",
+			Help:    "Results returned by successful searches, by endpoint",
+			Buckets: []float64{0, 1, 2, 5, 10, 20, 50, 100},
+		},
+		[]string{"endpoint", "tenant"},
+	)
+	vecs.searchZeroResults = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_search_zero_results_total",
+			Help: "Successful searches that returned no results, by endpoint",
+		},
+		[]string{"endpoint", "tenant"},
+	)
+	vecs.rerankDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_indexer_rerank_duration_seconds",
+			Help:    "Time taken by the reranking stage of a search, by status (success or error)",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"status", "tenant"},
+	)
+	vecs.rewriteDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_indexer_rewrite_duration_seconds",
+			Help:    "Time taken by the query rewriting stage of a search, by status (success or error)",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"status", "tenant"},
+	)
+	vecs.embeddingCache = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_embedding_cache_lookups_total",
+			Help: "Texts looked up in the embedding cache, by cache (memory or index) and result (hit, miss, or error)",
+		},
+		[]string{"cache", "result", "tenant"},
+	)
+}
+
+// registerServerMetrics registers the HTTP server's metrics, which aren't
+// labelled by tenant.
+func registerServerMetrics(factory promauto.Factory, metrics *Metrics) {
+	metrics.SLORequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_slo_requests_total",
+			Help: "Total number of API requests counted toward the latency SLO",
+		},
+		[]string{"endpoint"},
+	)
+	metrics.SLORequestsGood = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_slo_requests_good_total",
+			Help: "API requests that succeeded within the SLO latency threshold",
+		},
+		[]string{"endpoint"},
+	)
+	metrics.SLOLatencyThreshold = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_slo_latency_threshold_seconds",
+			Help: "Latency under which an API request counts as good",
+		},
+	)
+	metrics.SLOObjective = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "code_indexer_slo_objective_ratio",
+			Help: "Target fraction of good API requests",
+		},
+	)
+	metrics.RequestsRejected = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_indexer_requests_rejected_total",
+			Help: "API requests rejected before being served, by endpoint and reason (rate_limited or body_too_large)",
+		},
+		[]string{"endpoint", "reason"},
+	)
+	metrics.HTTPRequestDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_indexer_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by route pattern, method, and status code",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "method", "status"},
+	)
+}
+
+// ForTenant returns the metrics of the named tenant: the same metrics, with
+// those labelled by tenant labelled with its name.
+func (m *Metrics) ForTenant(name string) (tenant *Metrics) {
+	tenant = &Metrics{}
+	*tenant = *m
+	tenant.curry(name)
+	return tenant
+}
+
+// curry points the tenant-labelled metrics at the tenant's series.
+func (m *Metrics) curry(tenant string) {
+	labels := prometheus.Labels{"tenant": tenant}
+	m.tenant = tenant
+	m.FunctionsIndexed = m.vecs.functionsIndexed.MustCurryWith(labels)
+	m.ReposIndexed = m.vecs.reposIndexed.WithLabelValues(tenant)
+	m.IndexingDuration = m.vecs.indexingDuration.MustCurryWith(labels)
+	m.ParseErrors = m.vecs.parseErrors.MustCurryWith(labels)
+	m.DocumentLimitHits = m.vecs.documentLimitHits.MustCurryWith(labels)
+	m.EnrichErrors = m.vecs.enrichErrors.MustCurryWith(labels)
+	m.ESRequests = m.vecs.esRequests.MustCurryWith(labels)
+	m.LastSuccessfulIndex = m.vecs.lastSuccessfulIndex.MustCurryWith(labels)
+	m.Exports = m.vecs.exports.MustCurryWith(labels)
+	m.LastSuccessfulExport = m.vecs.lastSuccessfulExport.WithLabelValues(tenant)
+	m.RerankDuration = m.vecs.rerankDuration.MustCurryWith(labels)
+	m.RewriteDuration = m.vecs.rewriteDuration.MustCurryWith(labels)
+	m.QueueJobs = m.vecs.queueJobs.MustCurryWith(labels)
+	m.DeadLetters = m.vecs.deadLetters.WithLabelValues(tenant)
+	m.DeadLetterReplays = m.vecs.deadLetterReplays.MustCurryWith(labels)
+	m.ESBreakerState = m.vecs.esBreakerState.WithLabelValues(tenant)
+	m.ESBreakerOpens = m.vecs.esBreakerOpens.WithLabelValues(tenant)
+	m.SearchDuration = m.vecs.searchDuration.MustCurryWith(labels)
+	m.SearchResults = m.vecs.searchResults.MustCurryWith(labels)
+	m.SearchZeroResults = m.vecs.searchZeroResults.MustCurryWith(labels)
+	m.ReindexTriggers = m.vecs.reindexTriggers.MustCurryWith(labels)
+	m.ParseMemoryReserved = m.vecs.parseMemoryReserved.WithLabelValues(tenant)
+	m.EmbeddingCache = m.vecs.embeddingCache.MustCurryWith(labels)
+	m.Summaries = m.vecs.summaries.MustCurryWith(labels)
+	m.IndexProgress = m.vecs.indexProgress.MustCurryWith(labels)
+}
+
+// ObserveParseError counts a parse error for the repo and error class. The
+// failing file is attached as an exemplar rather than a label so per-file
+// detail doesn't multiply the series count.
+func (m *Metrics) ObserveParseError(repo string, class string, file string) {
+	counter := m.ParseErrors.WithLabelValues(repo, class)
+
+	adder, ok := counter.(prometheus.ExemplarAdder)
+	if !ok {
+		counter.Inc()
+		return
+	}
+
+	adder.AddWithExemplar(1, prometheus.Labels{"file": truncateExemplarValue("file", file)})
+}
+
+// ObserveSLORequest counts an API request toward the endpoint's latency SLO,
+// and as good when it succeeded within the threshold. Both counters are
+// initialised together so the good/total ratio is defined from the first
+// request.
+func (m *Metrics) ObserveSLORequest(endpoint string, good bool) {
+	m.SLORequests.WithLabelValues(endpoint).Inc()
+	goodCounter := m.SLORequestsGood.WithLabelValues(endpoint)
+	if good {
+		goodCounter.Inc()
+	}
+}
+
+// ObserveSearch records a search run for the endpoint: its duration, and for
+// a successful one the number of results, counting empty results separately.
+func (m *Metrics) ObserveSearch(endpoint string, duration time.Duration, results int, failed bool) {
+	if failed {
+		m.SearchDuration.WithLabelValues(endpoint, "error").Observe(duration.Seconds())
+		return
+	}
+
+	m.SearchDuration.WithLabelValues(endpoint, "success").Observe(duration.Seconds())
+	m.SearchResults.WithLabelValues(endpoint).Observe(float64(results))
+	zero := m.SearchZeroResults.WithLabelValues(endpoint)
+	if results == 0 {
+		zero.Inc()
+	}
+}
+
+// ForgetRepo removes every series labelled with the repository, so a deleted
+// repository stops being reported.
+func (m *Metrics) ForgetRepo(repo string) {
+	labels := prometheus.Labels{"repo": repo, "tenant": m.tenant}
+	m.vecs.functionsIndexed.DeletePartialMatch(labels)
+	m.vecs.indexingDuration.DeletePartialMatch(labels)
+	m.vecs.parseErrors.DeletePartialMatch(labels)
+	m.vecs.documentLimitHits.DeletePartialMatch(labels)
+	m.vecs.enrichErrors.DeletePartialMatch(labels)
+	m.vecs.lastSuccessfulIndex.DeletePartialMatch(labels)
+	m.vecs.indexProgress.DeletePartialMatch(labels)
+}
+
+// truncateExemplarValue keeps the tail of value so that name and value fit in
+// an exemplar. The tail of a file path is the most identifying part.
+func truncateExemplarValue(name string, value string) (truncated string) {
+	runes := []rune(value)
+	limit := maxExemplarRunes - len([]rune(name))
+	if len(runes) <= limit {
+		truncated = value
+		return truncated
+	}
+
+	truncated = string(runes[len(runes)-limit:])
+	return truncated
+}
@@ -0,0 +1,187 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// charsPerToken approximates how many characters of code make up a token.
+// Real tokenizers vary by model; four is the usual rule of thumb for English
+// and code with GPT-style tokenizers.
+const charsPerToken = 4
+
+// minTruncatedLines is the fewest lines of code worth including when a
+// result has to be cut to fit the budget.
+const minTruncatedLines = 5
+
+// ContextSource is a result that contributed to a context block.
+type ContextSource struct {
+	ID           string  `json:"id,omitempty"`
+	Repo         string  `json:"repo"`
+	FilePath     string  `json:"file_path"`
+	FunctionName string  `json:"function_name"`
+	StartLine    int     `json:"start_line,omitempty"`
+	EndLine      int     `json:"end_line,omitempty"`
+	Commit       string  `json:"commit,omitempty"`
+	SourceURL    string  `json:"source_url,omitempty"`
+	Score        float64 `json:"score,omitempty"`
+	Truncated    bool    `json:"truncated,omitempty"`
+}
+
+// ContextBlock is search results assembled for injection into an LLM prompt.
+// Tokens is the estimated size of Context. Omitted counts results left out
+// because they repeat an included one or don't fit the budget.
+type ContextBlock struct {
+	Context string          `json:"context"`
+	Tokens  int             `json:"tokens"`
+	Sources []ContextSource `json:"sources"`
+	Omitted int             `json:"omitted"`
+}
+
+// EstimateTokens approximates the number of tokens in text.
+func EstimateTokens(text string) (tokens int) {
+	tokens = (len(text) + charsPerToken - 1) / charsPerToken
+	return tokens
+}
+
+// AssembleContext renders results, best first, as Markdown sections headed by
+// their repository, path, and name, until maxTokens is reached. Duplicates,
+// such as other chunks of an included function or copies of the same code,
+// are dropped. A result that doesn't fit is cut to the remaining budget if
+// enough of it fits to be useful, and assembly stops there.
+func AssembleContext(docs []elasticsearch.CodeDocument, maxTokens int) (block ContextBlock) {
+	block = AssembleContextWithHeaders(docs, nil, maxTokens)
+	return block
+}
+
+// AssembleContextWithHeaders assembles results like AssembleContext, with
+// the file document of each result's file, from headers keyed by FileKey,
+// placed before the first result from that file, so its package clause and
+// imports come with its code. Each header is included once, and counts
+// against the budget like a result; one that doesn't fit is left out while
+// its result is still tried. A file document among the results is its own
+// header.
+func AssembleContextWithHeaders(docs []elasticsearch.CodeDocument, headers map[string]elasticsearch.CodeDocument, maxTokens int) (block ContextBlock) {
+	block.Sources = []ContextSource{}
+
+	var b strings.Builder
+	seen := make(map[string]bool)
+	headed := make(map[string]bool)
+	for i, doc := range docs {
+		key := contextKey(doc)
+		if seen[key] {
+			block.Omitted++
+			continue
+		}
+		seen[key] = true
+
+		fileKey := doc.FileKey()
+		if doc.Kind == elasticsearch.KindFile {
+			headed[fileKey] = true
+		}
+		header, found := headers[fileKey]
+		if found && !headed[fileKey] {
+			headed[fileKey] = true
+			section := contextSection(header, header.Code)
+			if len(section) <= maxTokens*charsPerToken-b.Len() {
+				b.WriteString(section)
+				block.Sources = append(block.Sources, contextSource(header, false))
+				seen[contextKey(header)] = true
+			}
+		}
+
+		// The budget is checked in characters so the estimate for the whole
+		// block, not the sum of rounded-up sections, stays within it.
+		room := maxTokens*charsPerToken - b.Len()
+		section := contextSection(doc, doc.Code)
+		truncated := false
+		if len(section) > room {
+			section, truncated = truncatedSection(doc, room)
+			if !truncated {
+				block.Omitted++
+				continue
+			}
+		}
+
+		b.WriteString(section)
+		block.Sources = append(block.Sources, contextSource(doc, truncated))
+
+		if truncated {
+			block.Omitted += len(docs) - i - 1
+			break
+		}
+	}
+
+	block.Context = b.String()
+	block.Tokens = EstimateTokens(block.Context)
+	return block
+}
+
+// contextKey identifies the code a result holds, so the same function is
+// included once however many chunks or copies of it match.
+func contextKey(doc elasticsearch.CodeDocument) (key string) {
+	if doc.ContentHash != "" {
+		key = doc.Repo + "\x00" + doc.ContentHash
+		return key
+	}
+
+	key = fmt.Sprintf("%s\x00%s\x00%s\x00%d", doc.Repo, doc.FilePath, doc.FunctionName, doc.StartLine)
+	return key
+}
+
+// contextSection renders one result with the given code.
+func contextSection(doc elasticsearch.CodeDocument, code string) (section string) {
+	code = strings.TrimRight(code, "\n")
+	fence := codeFence(code)
+	section = fmt.Sprintf("## %s `%s`\n\n%s%s\n%s\n%s\n\n", location(doc), doc.FunctionName, fence, fenceLanguage(doc), code, fence)
+	return section
+}
+
+// truncatedMarker ends the code of a result cut to fit the budget.
+const truncatedMarker = "..."
+
+// truncatedSection renders as many leading lines of a result's code as fit
+// in room characters, followed by truncatedMarker, or reports false when
+// fewer than minTruncatedLines fit.
+func truncatedSection(doc elasticsearch.CodeDocument, room int) (section string, ok bool) {
+	lines := strings.SplitAfter(strings.TrimRight(doc.Code, "\n"), "\n")
+
+	// Count the lines that fit alongside the header, fences, and marker, then
+	// back off if a longer fence for the kept lines tips it over.
+	left := room - len(contextSection(doc, truncatedMarker))
+	fit := 0
+	for fit < len(lines)-1 && left >= len(lines[fit]) {
+		left -= len(lines[fit])
+		fit++
+	}
+
+	for ; fit >= minTruncatedLines; fit-- {
+		section = contextSection(doc, strings.Join(lines[:fit], "")+truncatedMarker)
+		if len(section) <= room {
+			ok = true
+			return section, ok
+		}
+	}
+
+	section = ""
+	return section, ok
+}
+
+// contextSource describes a result included in a context block.
+func contextSource(doc elasticsearch.CodeDocument, truncated bool) (source ContextSource) {
+	source = ContextSource{
+		ID:           doc.ID,
+		Repo:         doc.Repo,
+		FilePath:     doc.FilePath,
+		FunctionName: doc.FunctionName,
+		StartLine:    doc.StartLine,
+		EndLine:      doc.EndLine,
+		Commit:       doc.Commit,
+		SourceURL:    doc.SourceURL,
+		Score:        doc.Score,
+		Truncated:    truncated,
+	}
+	return source
+}
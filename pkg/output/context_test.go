@@ -0,0 +1,128 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestAssembleContext(t *testing.T) {
+	var long strings.Builder
+	long.WriteString("func Long() {\n")
+	for i := range 200 {
+		fmt.Fprintf(&long, "\tstep%d()\n", i)
+	}
+	long.WriteString("}")
+
+	docs := []elasticsearch.CodeDocument{
+		{ID: "1", Repo: "payments", FilePath: "charge.go", FunctionName: "Charge", StartLine: 10, EndLine: 12, Code: "func Charge() (err error) {\n\treturn err\n}", ContentHash: "a"},
+		{ID: "2", Repo: "payments", FilePath: "copy.go", FunctionName: "Charge", StartLine: 3, EndLine: 5, Code: "func Charge() (err error) {\n\treturn err\n}", ContentHash: "a"},
+		{ID: "3", Repo: "payments", FilePath: "long.go", FunctionName: "Long", StartLine: 1, EndLine: 202, Code: long.String(), ContentHash: "b"},
+		{ID: "4", Repo: "payments", FilePath: "README.md", DocType: elasticsearch.DocTypeMarkdown, FunctionName: "Usage", Code: "Run make."},
+	}
+
+	tests := []struct {
+		name          string
+		maxTokens     int
+		wantSources   []string
+		wantOmitted   int
+		wantTruncated bool
+		wantContains  []string
+	}{
+		{
+			name:        "everything fits",
+			maxTokens:   10000,
+			wantSources: []string{"1", "3", "4"},
+			wantOmitted: 1,
+			wantContains: []string{
+				"## payments/charge.go:10-12 `Charge`\n\n```go\nfunc Charge() (err error) {\n\treturn err\n}\n```\n",
+				"## payments/README.md `Usage`\n\n```markdown\nRun make.\n```\n",
+			},
+		},
+		{
+			name:          "long result cut to the budget",
+			maxTokens:     200,
+			wantSources:   []string{"1", "3"},
+			wantOmitted:   2,
+			wantTruncated: true,
+			wantContains:  []string{"\tstep0()\n", "\n...\n```\n"},
+		},
+		{
+			name:        "too little room to cut",
+			maxTokens:   40,
+			wantSources: []string{"1", "4"},
+			wantOmitted: 2,
+		},
+		{
+			name:        "nothing fits",
+			maxTokens:   5,
+			wantSources: []string{},
+			wantOmitted: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := AssembleContext(docs, tt.maxTokens)
+
+			var ids []string
+			for _, source := range block.Sources {
+				ids = append(ids, source.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantSources, ",") {
+				t.Errorf("sources = %v, want %v", ids, tt.wantSources)
+			}
+			if block.Omitted != tt.wantOmitted {
+				t.Errorf("omitted = %d, want %d", block.Omitted, tt.wantOmitted)
+			}
+			if block.Tokens > tt.maxTokens || block.Tokens != EstimateTokens(block.Context) {
+				t.Errorf("tokens = %d for %d estimated, budget %d", block.Tokens, EstimateTokens(block.Context), tt.maxTokens)
+			}
+			truncated := len(block.Sources) > 0 && block.Sources[len(block.Sources)-1].Truncated
+			if truncated != tt.wantTruncated {
+				t.Errorf("last source truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(block.Context, want) {
+					t.Errorf("context = %q, want it to contain %q", block.Context, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssembleContextWithHeaders(t *testing.T) {
+	header := elasticsearch.CodeDocument{ID: "h", Repo: "payments", FilePath: "charge.go", Kind: elasticsearch.KindFile, FunctionName: "charge.go", Code: "package payments\n\nimport \"errors\"\n", ContentHash: "h"}
+	docs := []elasticsearch.CodeDocument{
+		{ID: "1", Repo: "payments", FilePath: "charge.go", FunctionName: "Charge", StartLine: 10, EndLine: 12, Code: "func Charge() (err error) {\n\treturn errors.New(\"declined\")\n}", ContentHash: "a"},
+		{ID: "2", Repo: "payments", FilePath: "charge.go", FunctionName: "Refund", StartLine: 14, EndLine: 16, Code: "func Refund() (err error) {\n\treturn err\n}", ContentHash: "b"},
+		{ID: "3", Repo: "payments", FilePath: "ledger.go", FunctionName: "Post", StartLine: 3, EndLine: 5, Code: "func Post() {}", ContentHash: "c"},
+	}
+	headers := map[string]elasticsearch.CodeDocument{header.FileKey(): header}
+
+	block := AssembleContextWithHeaders(docs, headers, 10000)
+	var ids []string
+	for _, source := range block.Sources {
+		ids = append(ids, source.ID)
+	}
+	if strings.Join(ids, ",") != "h,1,2,3" {
+		t.Errorf("sources = %v, want the header once, before charge.go's results", ids)
+	}
+	if !strings.HasPrefix(block.Context, "## payments/charge.go `charge.go`\n\n```go\npackage payments\n") {
+		t.Errorf("context = %q, want it to open with charge.go's header", block.Context)
+	}
+
+	// A header that doesn't fit is left out, and its result still tried.
+	block = AssembleContextWithHeaders(docs[2:], map[string]elasticsearch.CodeDocument{docs[2].FileKey(): {ID: "big", Repo: "payments", FilePath: "ledger.go", Code: strings.Repeat("x", 400)}}, 30)
+	if len(block.Sources) != 1 || block.Sources[0].ID != "3" {
+		t.Errorf("sources = %+v, want ledger.go's result without its header", block.Sources)
+	}
+
+	// A file document among the results is its own header.
+	block = AssembleContextWithHeaders([]elasticsearch.CodeDocument{header, docs[0]}, headers, 10000)
+	if len(block.Sources) != 2 || strings.Count(block.Context, "package payments") != 1 {
+		t.Errorf("context = %q, want charge.go's header once", block.Context)
+	}
+}
@@ -0,0 +1,196 @@
+// Package output renders search results for the command line: as JSON or
+// YAML for other tools, Markdown for pasting into documents and LLM prompts,
+// or plain text for reading in a terminal. It also assembles results into
+// token-budgeted context blocks for retrieval-augmented generation.
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"go.yaml.in/yaml/v2"
+)
+
+// Output formats.
+const (
+	FormatJSON     = "json"
+	FormatYAML     = "yaml"
+	FormatMarkdown = "markdown"
+	FormatPlain    = "plain"
+)
+
+// ErrUnknownFormat is returned for a format other than those above.
+var ErrUnknownFormat = errors.New("unknown output format")
+
+// Formats lists the supported output formats.
+//
+//nolint:gochecknoglobals // fixed list of formats
+var Formats = []string{FormatJSON, FormatYAML, FormatMarkdown, FormatPlain}
+
+// fenceLanguages maps document languages to the Markdown code fence info
+// string that highlights them. Languages not listed are used as is.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var fenceLanguages = map[string]string{
+	"":          "go",
+	"terraform": "hcl",
+}
+
+// results is the document written by the JSON and YAML formats, shaped like
+// the API's search response.
+type results struct {
+	Query   string                       `json:"query"`
+	Results []elasticsearch.CodeDocument `json:"results"`
+}
+
+// Valid reports whether format is a supported output format.
+func Valid(format string) (valid bool) {
+	valid = slices.Contains(Formats, format)
+	return valid
+}
+
+// Write renders the results of query to w in format.
+func Write(w io.Writer, format string, query string, docs []elasticsearch.CodeDocument) (err error) {
+	if docs == nil {
+		docs = []elasticsearch.CodeDocument{}
+	}
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(results{Query: query, Results: docs})
+	case FormatYAML:
+		err = writeYAML(w, query, docs)
+	case FormatMarkdown:
+		err = writeMarkdown(w, query, docs)
+	case FormatPlain:
+		err = writePlain(w, docs)
+	default:
+		err = fmt.Errorf("%w %q: use one of %s", ErrUnknownFormat, format, strings.Join(Formats, ", "))
+	}
+	return err
+}
+
+// writeYAML renders the results as YAML with the field names and order of
+// the JSON output, by reading the JSON back as ordered YAML mappings.
+func writeYAML(w io.Writer, query string, docs []elasticsearch.CodeDocument) (err error) {
+	var data []byte
+	data, err = json.Marshal(results{Query: query, Results: docs})
+	if err != nil {
+		return err
+	}
+
+	var ordered yaml.MapSlice
+	err = yaml.Unmarshal(data, &ordered)
+	if err != nil {
+		return err
+	}
+
+	data, err = yaml.Marshal(ordered)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// writeMarkdown renders each result as a section with its location, score,
+// and metadata in a list and its code in a fenced block.
+func writeMarkdown(w io.Writer, query string, docs []elasticsearch.CodeDocument) (err error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Results for %q\n", query)
+	if len(docs) == 0 {
+		b.WriteString("\nNo results found.\n")
+	}
+
+	for i, doc := range docs {
+		fmt.Fprintf(&b, "\n## %d. `%s`\n\n", i+1, doc.FunctionName)
+		fmt.Fprintf(&b, "- Location: `%s`\n", location(doc))
+		if doc.Kind != "" {
+			fmt.Fprintf(&b, "- Kind: %s\n", doc.Kind)
+		}
+		fmt.Fprintf(&b, "- Score: %.3f\n", doc.Score)
+		for _, key := range slices.Sorted(maps.Keys(doc.Metadata)) {
+			fmt.Fprintf(&b, "- %s: %s\n", key, doc.Metadata[key])
+		}
+		if doc.SourceURL != "" {
+			fmt.Fprintf(&b, "- Source: %s\n", doc.SourceURL)
+		}
+
+		fence := codeFence(doc.Code)
+		fmt.Fprintf(&b, "\n%s%s\n%s\n%s\n", fence, fenceLanguage(doc), strings.TrimRight(doc.Code, "\n"), fence)
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// writePlain renders each result under a header line, followed by its score,
+// metadata, and code.
+func writePlain(w io.Writer, docs []elasticsearch.CodeDocument) (err error) {
+	var b strings.Builder
+	if len(docs) == 0 {
+		b.WriteString("No results found\n")
+	}
+
+	for i, doc := range docs {
+		fmt.Fprintf(&b, "\n=== Result %d: %s - %s ===\n", i+1, location(doc), doc.FunctionName)
+		fmt.Fprintf(&b, "Score: %.3f\n", doc.Score)
+		fmt.Fprintf(&b, "Named Returns: %v\n", doc.HasNamedReturns)
+		for _, key := range slices.Sorted(maps.Keys(doc.Metadata)) {
+			fmt.Fprintf(&b, "%s: %s\n", key, doc.Metadata[key])
+		}
+		fmt.Fprintf(&b, "\n%s\n", doc.Code)
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// location renders where a result is: its repository, file, and lines.
+func location(doc elasticsearch.CodeDocument) (loc string) {
+	loc = doc.Repo + "/" + doc.FilePath
+	if doc.StartLine > 0 {
+		loc += fmt.Sprintf(":%d-%d", doc.StartLine, doc.EndLine)
+	}
+	return loc
+}
+
+// fenceLanguage returns the code fence info string for a result.
+func fenceLanguage(doc elasticsearch.CodeDocument) (language string) {
+	if doc.DocType == elasticsearch.DocTypeMarkdown {
+		language = "markdown"
+		return language
+	}
+
+	language, mapped := fenceLanguages[doc.Language]
+	if !mapped {
+		language = doc.Language
+	}
+	return language
+}
+
+// codeFence returns a backtick fence longer than any run of backticks in
+// code, so code holding fences of its own doesn't end the block early.
+func codeFence(code string) (fence string) {
+	longest, run := 0, 0
+	for _, c := range code {
+		if c != '`' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+
+	fence = strings.Repeat("`", max(3, longest+1))
+	return fence
+}
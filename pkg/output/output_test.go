@@ -0,0 +1,155 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"go.yaml.in/yaml/v2"
+)
+
+// testResults are a Go function with metadata and a Markdown section whose
+// text holds a code fence.
+func testResults() (docs []elasticsearch.CodeDocument) {
+	docs = []elasticsearch.CodeDocument{
+		{
+			Repo:         "payments",
+			FilePath:     "charge.go",
+			Kind:         elasticsearch.KindFunction,
+			FunctionName: "Charge",
+			StartLine:    10,
+			EndLine:      12,
+			Code:         "func Charge() (err error) {\n\treturn err\n}",
+			Metadata:     map[string]string{"tier": "1", "team": "payments"},
+			Score:        12.5,
+		},
+		{
+			Repo:         "payments",
+			FilePath:     "README.md",
+			DocType:      elasticsearch.DocTypeMarkdown,
+			Kind:         elasticsearch.KindSection,
+			FunctionName: "Usage",
+			Code:         "Run:\n\n```\nmake\n```",
+			Score:        3,
+		},
+	}
+	return docs
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: FormatPlain,
+			want: []string{
+				"=== Result 1: payments/charge.go:10-12 - Charge ===\nScore: 12.500\nNamed Returns: false\nteam: payments\ntier: 1\n",
+				"=== Result 2: payments/README.md - Usage ===",
+			},
+		},
+		{
+			format: FormatMarkdown,
+			want: []string{
+				"# Results for \"charge a card\"\n",
+				"## 1. `Charge`\n\n- Location: `payments/charge.go:10-12`\n- Kind: function\n- Score: 12.500\n- team: payments\n- tier: 1\n",
+				"```go\nfunc Charge() (err error) {\n\treturn err\n}\n```\n",
+				"````markdown\nRun:\n\n```\nmake\n```\n````\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Write(&buf, tt.format, "charge a card", testResults())
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Write() = %q, want it to contain %q", buf.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteStructured(t *testing.T) {
+	tests := []struct {
+		format    string
+		unmarshal func(data []byte, v interface{}) error
+	}{
+		{format: FormatJSON, unmarshal: json.Unmarshal},
+		{format: FormatYAML, unmarshal: yaml.Unmarshal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Write(&buf, tt.format, "charge a card", testResults())
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			var got struct {
+				Query   string `json:"query" yaml:"query"`
+				Results []struct {
+					Name     string            `json:"function_name" yaml:"function_name"`
+					Code     string            `json:"code" yaml:"code"`
+					Score    float64           `json:"score" yaml:"score"`
+					Metadata map[string]string `json:"metadata" yaml:"metadata"`
+				} `json:"results" yaml:"results"`
+			}
+			err = tt.unmarshal(buf.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("output does not parse: %v\n%s", err, buf.String())
+			}
+
+			if got.Query != "charge a card" || len(got.Results) != 2 {
+				t.Fatalf("query, results = %q, %d, want the query and 2 results", got.Query, len(got.Results))
+			}
+			first := got.Results[0]
+			if first.Name != "Charge" || first.Score != 12.5 || first.Metadata["team"] != "payments" {
+				t.Errorf("first result = %+v", first)
+			}
+			if first.Code != testResults()[0].Code {
+				t.Errorf("Code = %q, want it unchanged", first.Code)
+			}
+		})
+	}
+}
+
+func TestWriteNoResults(t *testing.T) {
+	want := map[string]string{
+		FormatJSON:     `"results": []`,
+		FormatYAML:     "results: []",
+		FormatMarkdown: "No results found.",
+		FormatPlain:    "No results found",
+	}
+
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		err := Write(&buf, format, "nothing", nil)
+		if err != nil {
+			t.Fatalf("Write(%s) error = %v", format, err)
+		}
+		if !strings.Contains(buf.String(), want[format]) {
+			t.Errorf("Write(%s) = %q, want it to contain %q", format, buf.String(), want[format])
+		}
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, "xml", "query", testResults())
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Write() error = %v, want %v", err, ErrUnknownFormat)
+	}
+	if Valid("xml") || !Valid(FormatMarkdown) {
+		t.Error("Valid() disagrees with Formats")
+	}
+}
@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// markerPattern matches a TODO or FIXME tag opening a comment, or a line of
+// a block comment, with an optional owner in parentheses, and the text
+// after it up to any comment terminator.
+//
+//nolint:gochecknoglobals // compiled once
+var markerPattern = regexp.MustCompile(`(?://+|#+|/\*+|^\s*\*+|<!--)\s*(TODO|FIXME)\b(?:\([^)]*\))?:?\s*(.*?)\s*(?:\*/|-->)?\s*$`)
+
+// CommentMarkers finds the TODO and FIXME comments in code whose first line
+// is startLine. Tags must open the comment, so prose that mentions a TODO
+// in passing isn't one; a comment marker inside a string literal can
+// still be mistaken for a comment.
+func CommentMarkers(code string, startLine int) (markers []elasticsearch.Marker) {
+	for i, line := range strings.Split(code, "\n") {
+		if !strings.Contains(line, "TODO") && !strings.Contains(line, "FIXME") {
+			continue
+		}
+		match := markerPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		markers = append(markers, elasticsearch.Marker{Tag: match[1], Line: startLine + i, Text: match[2]})
+	}
+	return markers
+}
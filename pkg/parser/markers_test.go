@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestCommentMarkers(t *testing.T) {
+	code := "func Retry() {\n" + // 10
+		"\t// TODO: back off exponentially\n" + // 11
+		"\tlog.Print(\"TODO list\") // FIXME(nik) drop the log\n" + // 12
+		"\t/* TODO handle ctx */\n" + // 13
+		"\t * FIXME: block line\n" + // 14
+		"\t// see the TODO above\n" + // 15
+		"\t// TODOS are not tags\n" + // 16
+		"}\n" + // 17
+		"# TODO python style\n" + // 18
+		"<!-- FIXME: markup -->" // 19
+
+	got := CommentMarkers(code, 10)
+	want := []elasticsearch.Marker{
+		{Tag: "TODO", Line: 11, Text: "back off exponentially"},
+		{Tag: "FIXME", Line: 12, Text: "drop the log"},
+		{Tag: "TODO", Line: 13, Text: "handle ctx"},
+		{Tag: "FIXME", Line: 14, Text: "block line"},
+		{Tag: "TODO", Line: 18, Text: "python style"},
+		{Tag: "FIXME", Line: 19, Text: "markup"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("CommentMarkers() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPythonAnnotations(t *testing.T) {
+	src := `@warnings.deprecated("use load")
+def old_load(path):
+    # TODO: remove in 2.0
+    return load(path)
+
+
+class Store:
+    @deprecated("gone")
+    def get(self):
+        pass
+`
+
+	docs, err := Python{}.ParseFile("store.py", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	deprecated := map[string]bool{}
+	for _, doc := range docs {
+		deprecated[doc.FunctionName] = doc.Deprecated
+	}
+	if !deprecated["old_load"] || !deprecated["Store.get"] || deprecated["Store"] {
+		t.Errorf("deprecated = %v, want old_load and Store.get, not the class of a deprecated method", deprecated)
+	}
+	if want := []elasticsearch.Marker{{Tag: "TODO", Line: 3, Text: "remove in 2.0"}}; !slices.Equal(docs[0].Markers, want) {
+		t.Errorf("old_load Markers = %+v, want %+v", docs[0].Markers, want)
+	}
+}
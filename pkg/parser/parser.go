@@ -0,0 +1,85 @@
+// Package parser defines the language parsers that turn source files into
+// documents for the code index, and a registry that picks one by file
+// extension.
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// Language parses source files of one language into documents. Documents
+// carry their file path, kind, name, code, and line range; the indexer fills
+// in the repository and commit. A parser that recovers part of a malformed
+// file returns the documents it found along with the error.
+type Language interface {
+	Name() (name string)
+	Extensions() (extensions []string)
+	ParseFile(path string, content []byte) (docs []elasticsearch.CodeDocument, err error)
+}
+
+// Registry maps file extensions to the language that parses them.
+type Registry struct {
+	byExtension map[string]Language
+}
+
+// NewRegistry creates a registry of the given languages. When two languages
+// claim an extension, the later one wins.
+func NewRegistry(languages ...Language) (registry *Registry) {
+	registry = &Registry{byExtension: make(map[string]Language)}
+	for _, language := range languages {
+		for _, ext := range language.Extensions() {
+			registry.byExtension[strings.ToLower(ext)] = language
+		}
+	}
+	return registry
+}
+
+// ForFile returns the language for a file by its extension, or nil when no
+// registered language handles it.
+func (r *Registry) ForFile(path string) (language Language) {
+	if r == nil {
+		return language
+	}
+
+	language = r.byExtension[strings.ToLower(filepath.Ext(path))]
+	return language
+}
+
+// contentHash returns a hex-encoded SHA-256 of the given source. Parsers hash
+// everything after the declared name so renamed declarations keep their hash.
+func contentHash(src string) (hash string) {
+	sum := sha256.Sum256([]byte(src))
+	hash = hex.EncodeToString(sum[:])
+	return hash
+}
+
+// lineStarts returns the byte offset at which each line of content begins.
+func lineStarts(content []byte) (starts []int) {
+	starts = []int{0}
+	for i, c := range content {
+		if c == '\n' && i+1 < len(content) {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// lineOf returns the 1-based line containing the byte offset.
+func lineOf(starts []int, offset int) (line int) {
+	lo, hi := 0, len(starts)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if starts[mid] <= offset {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	line = lo + 1
+	return line
+}
@@ -0,0 +1,391 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// declSummary renders a document's kind, name, and line range for comparison.
+func declSummary(doc elasticsearch.CodeDocument) (summary string) {
+	summary = fmt.Sprintf("%s %s %d-%d", doc.Kind, doc.FunctionName, doc.StartLine, doc.EndLine)
+	return summary
+}
+
+func TestRegistryForFile(t *testing.T) {
+	registry := NewRegistry(Python{}, TypeScript{}, Terraform{}, Protobuf{})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "app/models.py", want: LanguagePython},
+		{path: "web/src/App.TSX", want: LanguageTypeScript},
+		{path: "infra/main.tf", want: LanguageTerraform},
+		{path: "api/v1/orders.proto", want: LanguageProtobuf},
+		{path: "main.go", want: ""},
+		{path: "Makefile", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := ""
+			language := registry.ForFile(tt.path)
+			if language != nil {
+				got = language.Name()
+			}
+			if got != tt.want {
+				t.Errorf("ForFile(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	var empty *Registry
+	if empty.ForFile("main.py") != nil {
+		t.Error("nil registry returned a language")
+	}
+}
+
+func TestPythonParseFile(t *testing.T) {
+	src := `"""Module docstring mentioning def fake():"""
+import os, sys as system
+from app.db import session
+
+
+def load(path):
+    """Load a file.
+
+def not_a_function():
+    """
+    try:
+        return open(path).read()
+    except OSError:
+        return None
+
+# Helpers below.
+
+@dataclass
+@register(
+    name="user",
+)
+class User(Base):
+    name: str = "def nope():"
+
+    def greet(self, other):
+        def inner():
+            pass
+        return f"hi {other}"
+
+    async def save(self,
+                   force=False):
+        await session.commit()
+
+
+async def main(): await load("x")
+`
+
+	docs, err := Python{}.ParseFile("app/user.py", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	var got []string
+	for _, doc := range docs {
+		got = append(got, declSummary(doc))
+	}
+	want := []string{
+		"function load 6-14",
+		"class User 18-32",
+		"method User.greet 25-28",
+		"method User.save 30-32",
+		"function main 35-35",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseFile() = %v, want %v", got, want)
+	}
+
+	if !docs[0].HasErrorHandling || docs[2].HasErrorHandling {
+		t.Error("HasErrorHandling should be set only where try/except is used")
+	}
+	if !slices.Equal(docs[0].Imports, []string{"os", "sys", "app.db"}) {
+		t.Errorf("Imports = %v, want [os sys app.db]", docs[0].Imports)
+	}
+	if docs[0].Language != LanguagePython || docs[0].FilePath != "app/user.py" {
+		t.Errorf("language, path = %q, %q", docs[0].Language, docs[0].FilePath)
+	}
+	if !docs[2].Exported {
+		t.Error("User.greet should be exported")
+	}
+	for _, name := range []string{"_load", "User._save", "_User.greet", "User.__init__"} {
+		if pythonPublic(name) {
+			t.Errorf("pythonPublic(%q) = true, want false for an underscored name", name)
+		}
+	}
+}
+
+func TestTypeScriptParseFile(t *testing.T) {
+	src := "import { Injectable } from '@angular/core';\n" + // 1
+		"import './polyfills';\n" + // 2
+		"\n" + // 3
+		"// function commented() {}\n" + // 4
+		"export interface Options {\n" + // 5
+		"  retries: number;\n" + // 6
+		"}\n" + // 7
+		"\n" + // 8
+		"export type Mode =\n" + // 9
+		"  | 'fast'\n" + // 10
+		"  | 'safe';\n" + // 11
+		"\n" + // 12
+		"const pattern = /[{]/g;\n" + // 13
+		"export const retry = async (fn: () => Promise<void>) => {\n" + // 14
+		"  try { await fn(); } catch (e) { console.log(`failed ${e} }`); }\n" + // 15
+		"};\n" + // 16
+		"\n" + // 17
+		"@Injectable({\n" + // 18
+		"  providedIn: 'root',\n" + // 19
+		"})\n" + // 20
+		"export class Client<T> extends Base implements Api {\n" + // 21
+		"  private url = '{';\n" + // 22
+		"  constructor(url: string) { super(); }\n" + // 23
+		"  abstract close(): void;\n" + // 24
+		"  async get(path: string): Promise<{ body: T }> {\n" + // 25
+		"    return fetch(this.url + path);\n" + // 26
+		"  }\n" + // 27
+		"}\n" + // 28
+		"\n" + // 29
+		"export function parse(input: string): { ok: boolean } {\n" + // 30
+		"  return { ok: input !== '}' };\n" + // 31
+		"}\n" + // 32
+		"declare function overload(a: string): void\n" + // 33
+		"export default function* ids() { yield 1; }\n" + // 34
+		"export class Store {\n" + // 35
+		"  private load() { return 1; }\n" + // 36
+		"  #reset() {}\n" + // 37
+		"  save() {}\n" + // 38
+		"}\n" + // 39
+		"class Cache {\n" + // 40
+		"  get(key: string) { return key; }\n" + // 41
+		"}\n" // 42
+
+	docs, err := TypeScript{}.ParseFile("src/client.ts", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	var got []string
+	for _, doc := range docs {
+		got = append(got, declSummary(doc))
+	}
+	want := []string{
+		"interface Options 5-7",
+		"type Mode 9-11",
+		"function retry 14-16",
+		"class Client 18-28",
+		"method Client.constructor 23-23",
+		"method Client.get 25-27",
+		"function parse 30-32",
+		"function overload 33-33",
+		"function ids 34-34",
+		"class Store 35-39",
+		"method Store.load 36-36",
+		"method Store.#reset 37-37",
+		"method Store.save 38-38",
+		"class Cache 40-42",
+		"method Cache.get 41-41",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseFile() = %v, want %v", got, want)
+	}
+
+	var exported []string
+	for _, doc := range docs {
+		if doc.Exported {
+			exported = append(exported, doc.FunctionName)
+		}
+	}
+	wantExported := []string{"Options", "Mode", "retry", "Client", "Client.constructor", "Client.get", "parse", "ids", "Store", "Store.save"}
+	if !slices.Equal(exported, wantExported) {
+		t.Errorf("exported = %v, want %v", exported, wantExported)
+	}
+
+	if !docs[2].HasErrorHandling || docs[5].HasErrorHandling {
+		t.Error("HasErrorHandling should be set only where try/catch is used")
+	}
+	if !slices.Equal(docs[0].Imports, []string{"@angular/core", "./polyfills"}) {
+		t.Errorf("Imports = %v, want [@angular/core ./polyfills]", docs[0].Imports)
+	}
+}
+
+func TestTerraformParseFile(t *testing.T) {
+	src := `terraform {
+  required_version = ">= 1.5"
+}
+
+# resource "commented" "out" {}
+provider "aws" {
+  region = var.region
+  alias  = "west"
+}
+
+variable "region" {
+  type    = string
+  default = "us-east-1" // "}" in a comment
+}
+
+resource "aws_s3_bucket" "logs" {
+  bucket   = "logs-${var.env}-{"
+  provider = aws.west
+
+  tags = {
+    Name = "logs"
+  }
+
+  lifecycle_rule {
+    enabled = true
+  }
+  lifecycle_rule {
+    enabled = false
+  }
+}
+
+data "aws_iam_policy_document" "read" {
+  statement {
+    actions = ["s3:GetObject"]
+  }
+}
+
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.1.0"
+}
+
+resource "aws_iam_policy" "read" {
+  policy = <<-EOT
+    { "Version": "2012-10-17" }
+  EOT
+}
+
+output "bucket_arn" {
+  value = aws_s3_bucket.logs.arn
+}
+`
+
+	docs, err := Terraform{}.ParseFile("infra/main.tf", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	var got []string
+	for _, doc := range docs {
+		got = append(got, declSummary(doc))
+	}
+	want := []string{
+		"provider aws 6-9",
+		"variable var.region 11-14",
+		"resource aws_s3_bucket.logs 16-30",
+		"data data.aws_iam_policy_document.read 32-36",
+		"module module.vpc 38-41",
+		"resource aws_iam_policy.read 43-47",
+		"output output.bucket_arn 49-51",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ParseFile() = %v, want %v", got, want)
+	}
+
+	if !docs[1].Exported || !docs[6].Exported || docs[2].Exported {
+		t.Error("only variables and outputs should be exported")
+	}
+
+	bucket := docs[2]
+	if bucket.ResourceType != "aws_s3_bucket" || bucket.Provider != "aws" || bucket.Language != LanguageTerraform {
+		t.Errorf("resource type, provider, language = %q, %q, %q", bucket.ResourceType, bucket.Provider, bucket.Language)
+	}
+	if !slices.Equal(bucket.Attributes, []string{"bucket", "provider", "tags", "lifecycle_rule"}) {
+		t.Errorf("Attributes = %v, want [bucket provider tags lifecycle_rule]", bucket.Attributes)
+	}
+	if docs[3].ResourceType != "aws_iam_policy_document" || docs[3].Provider != "aws" {
+		t.Errorf("data source type, provider = %q, %q", docs[3].ResourceType, docs[3].Provider)
+	}
+	if !slices.Equal(docs[4].Imports, []string{"terraform-aws-modules/vpc/aws"}) {
+		t.Errorf("module Imports = %v, want its source", docs[4].Imports)
+	}
+}
+
+func TestProtobufParseFile(t *testing.T) {
+	src := `syntax = "proto3";
+
+package shop.orders.v1;
+
+import "google/protobuf/timestamp.proto";
+
+// Order is a placed order. "}" in a comment.
+message Order {
+  string id = 1;
+  Status status = 2;
+  google.protobuf.Timestamp placed_at = 3;
+
+  message Line {
+    string sku = 1 [json_name = "sku{"];
+  }
+
+  enum Status {
+    STATUS_UNSPECIFIED = 0;
+  }
+
+  oneof payment {
+    string card = 4;
+  }
+}
+
+service OrderService {
+  option (shop.service_owner) = "orders";
+
+  rpc GetOrder(GetOrderRequest) returns (Order);
+  rpc WatchOrders (WatchOrdersRequest) returns (stream shop.orders.v1.Order) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+}
+`
+
+	docs, err := Protobuf{}.ParseFile("api/orders.proto", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+
+	var got []string
+	for _, doc := range docs {
+		got = append(got, declSummary(doc))
+	}
+	want := []string{
+		"message Order 8-24",
+		"message Order.Line 13-15",
+		"type Order.Status 17-19",
+		"service OrderService 26-33",
+		"rpc OrderService.GetOrder 29-29",
+		"rpc OrderService.WatchOrders 30-32",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ParseFile() = %v, want %v", got, want)
+	}
+
+	order := docs[0]
+	if order.Package != "shop.orders.v1" || order.Language != LanguageProtobuf {
+		t.Errorf("package, language = %q, %q", order.Package, order.Language)
+	}
+	if !slices.Equal(order.Imports, []string{"google/protobuf/timestamp.proto"}) {
+		t.Errorf("Imports = %v, want [google/protobuf/timestamp.proto]", order.Imports)
+	}
+
+	watch := docs[5]
+	if watch.ServiceName != "OrderService" || watch.MethodName != "WatchOrders" {
+		t.Errorf("service, method = %q, %q", watch.ServiceName, watch.MethodName)
+	}
+	if watch.RequestType != "WatchOrdersRequest" || watch.ResponseType != "shop.orders.v1.Order" {
+		t.Errorf("request, response = %q, %q", watch.RequestType, watch.ResponseType)
+	}
+	if docs[3].ServiceName != "OrderService" {
+		t.Errorf("service ServiceName = %q, want OrderService", docs[3].ServiceName)
+	}
+}
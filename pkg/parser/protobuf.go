@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// LanguageProtobuf is the Language name of the Protocol Buffers parser.
+const LanguageProtobuf = "protobuf"
+
+// protoBlockPattern matches a message, enum, or service declaration up to
+// its opening brace.
+//
+//nolint:gochecknoglobals // compiled once
+var protoBlockPattern = regexp.MustCompile(`^(message|enum|service)\s+([A-Za-z_]\w*)\s*\{`)
+
+// protoRPCPattern matches an rpc declaration up to its options body or
+// terminating semicolon.
+//
+//nolint:gochecknoglobals // compiled once
+var protoRPCPattern = regexp.MustCompile(`^rpc\s+([A-Za-z_]\w*)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*([{;])`)
+
+// protoPackagePattern matches the package statement.
+//
+//nolint:gochecknoglobals // compiled once
+var protoPackagePattern = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+
+// protoImportPattern matches import statements.
+//
+//nolint:gochecknoglobals // compiled once
+var protoImportPattern = regexp.MustCompile(`(?m)^\s*import\s+(?:(?:public|weak)\s+)?"([^"]*)"\s*;`)
+
+// Protobuf parses Protocol Buffers definitions by matching braces over the
+// source with comments and strings blanked out. Messages, enums, services,
+// and each service's rpcs become documents. Nested messages and enums are
+// named "Outer.Inner" and rpcs "Service.Method"; rpcs record their service,
+// method, and request and response types.
+type Protobuf struct{}
+
+// Name returns "protobuf".
+func (Protobuf) Name() (name string) {
+	name = LanguageProtobuf
+	return name
+}
+
+// Extensions returns the Protocol Buffers extension.
+func (Protobuf) Extensions() (extensions []string) {
+	extensions = []string{".proto"}
+	return extensions
+}
+
+// protoFile is a definition file prepared for scanning: code is the source
+// with comments and strings blanked.
+type protoFile struct {
+	path    string
+	src     string
+	code    string
+	starts  []int
+	pkg     string
+	imports []string
+}
+
+// ParseFile extracts the file's messages, enums, services, and rpcs.
+func (p Protobuf) ParseFile(path string, content []byte) (docs []elasticsearch.CodeDocument, err error) {
+	file := &protoFile{
+		path:   path,
+		src:    string(content),
+		code:   blankProtoNonCode(content),
+		starts: lineStarts(content),
+	}
+
+	match := protoPackagePattern.FindStringSubmatch(file.code)
+	if match != nil {
+		file.pkg = match[1]
+	}
+	// Import paths are blanked in code, so they are read from the source at
+	// the positions matched there.
+	for _, imp := range protoImportPattern.FindAllStringSubmatchIndex(file.code, -1) {
+		file.imports = append(file.imports, file.src[imp[2]:imp[3]])
+	}
+
+	docs = file.declarations(0, len(file.code), "", "")
+	return docs, err
+}
+
+// declarations finds the declarations directly in code[from:to], naming them
+// under scope. Inside a service, service names it and rpcs are found.
+func (f *protoFile) declarations(from int, to int, scope string, service string) (docs []elasticsearch.CodeDocument) {
+	depth := 0
+	for i := from; i < to; i++ {
+		switch f.code[i] {
+		case '{':
+			depth++
+			continue
+		case '}':
+			depth--
+			continue
+		}
+		if depth != 0 || (i > 0 && isIdentByte(f.code[i-1])) || !isIdentByte(f.code[i]) {
+			continue
+		}
+
+		rest := f.code[i:to]
+		if service != "" {
+			rpc := protoRPCPattern.FindStringSubmatchIndex(rest)
+			if rpc != nil {
+				end := i + rpc[1] - 1
+				if rest[rpc[12]] == '{' {
+					end = matchingBrace(f.code, end)
+				}
+				docs = append(docs, f.rpcDoc(rest, rpc, service, i, end))
+				i = end
+			}
+			continue
+		}
+
+		block := protoBlockPattern.FindStringSubmatchIndex(rest)
+		if block == nil {
+			continue
+		}
+
+		keyword := rest[block[2]:block[3]]
+		name := rest[block[4]:block[5]]
+		if scope != "" {
+			name = scope + "." + name
+		}
+		open := i + block[1] - 1
+		end := matchingBrace(f.code, open)
+
+		doc := f.newDoc(name, i, i+block[5], end)
+		switch keyword {
+		case "message":
+			doc.Kind = elasticsearch.KindMessage
+			docs = append(docs, doc)
+			docs = append(docs, f.declarations(open+1, end, name, "")...)
+		case "enum":
+			doc.Kind = elasticsearch.KindType
+			docs = append(docs, doc)
+		case "service":
+			doc.Kind = elasticsearch.KindService
+			doc.ServiceName = name
+			docs = append(docs, doc)
+			docs = append(docs, f.declarations(open+1, end, name, name)...)
+		}
+		i = end
+	}
+	return docs
+}
+
+// rpcDoc builds the document for an rpc matched in rest, which starts at
+// start in the file, ending at end.
+func (f *protoFile) rpcDoc(rest string, rpc []int, service string, start int, end int) (doc elasticsearch.CodeDocument) {
+	method := rest[rpc[2]:rpc[3]]
+	doc = f.newDoc(service+"."+method, start, start+rpc[3], end)
+	doc.Kind = elasticsearch.KindRPC
+	doc.ServiceName = service
+	doc.MethodName = method
+	doc.RequestType = rest[rpc[6]:rpc[7]]
+	doc.ResponseType = rest[rpc[10]:rpc[11]]
+	return doc
+}
+
+// newDoc creates the document for a declaration spanning start to end,
+// hashing what follows its name at nameEnd.
+func (f *protoFile) newDoc(name string, start int, nameEnd int, end int) (doc elasticsearch.CodeDocument) {
+	doc = elasticsearch.CodeDocument{
+		FilePath:     f.path,
+		DocType:      elasticsearch.DocTypeCode,
+		Language:     LanguageProtobuf,
+		FunctionName: name,
+		Exported:     true,
+		StartLine:    lineOf(f.starts, start),
+		EndLine:      lineOf(f.starts, end),
+		Code:         f.src[start : end+1],
+		Package:      f.pkg,
+		Imports:      f.imports,
+		ContentHash:  contentHash(f.src[nameEnd : end+1]),
+		IndexedAt:    time.Now(),
+	}
+	doc.Markers = CommentMarkers(doc.Code, doc.StartLine)
+	return doc
+}
+
+// isIdentByte reports whether c can appear in an identifier.
+func isIdentByte(c byte) (ident bool) {
+	ident = c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	return ident
+}
+
+// blankProtoNonCode replaces comments and string contents with spaces,
+// keeping newlines, so braces can be matched on what remains.
+func blankProtoNonCode(content []byte) (blanked string) {
+	out := []byte(string(content))
+	blank := func(from int, to int) {
+		for i := from; i < to && i < len(out); i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	for i := 0; i < len(content); i++ {
+		rest := string(content[i:])
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			blank(i, i+end)
+			i += end - 1
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest) - 2
+			}
+			blank(i, i+end+4)
+			i += end + 3
+		case content[i] == '"' || content[i] == '\'':
+			end := quotedEnd(content, i)
+			blank(i+1, end)
+			i = end
+		}
+	}
+
+	blanked = string(out)
+	return blanked
+}
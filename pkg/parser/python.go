@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// LanguagePython is the Language name of the Python parser.
+const LanguagePython = "python"
+
+// pythonHeaderPattern matches the start of a def or class statement.
+//
+//nolint:gochecknoglobals // compiled once
+var pythonHeaderPattern = regexp.MustCompile(`^(async\s+def|def|class)\s+([A-Za-z_]\w*)`)
+
+// pythonImportPattern matches import and from-import statements.
+//
+//nolint:gochecknoglobals // compiled once
+var pythonImportPattern = regexp.MustCompile(`^(?:from\s+([\w.]+)\s+import\b|import\s+(.+))`)
+
+// pythonErrorHandlingPattern matches try and except clauses.
+//
+//nolint:gochecknoglobals // compiled once
+var pythonErrorHandlingPattern = regexp.MustCompile(`(?m)^\s*(?:try\s*:|except\b)`)
+
+// pythonDeprecatedPattern matches a @deprecated decorator, such as
+// warnings.deprecated or typing_extensions.deprecated.
+//
+//nolint:gochecknoglobals // compiled once
+var pythonDeprecatedPattern = regexp.MustCompile(`(?m)^\s*@(?:[\w.]+\.)?deprecated\b`)
+
+// Python parses Python source by indentation, without executing or importing
+// it. Top-level functions and classes become documents, as do methods
+// defined directly in a class body; nested functions stay part of their
+// enclosing declaration. Decorators are kept with what they decorate.
+type Python struct{}
+
+// Name returns "python".
+func (Python) Name() (name string) {
+	name = LanguagePython
+	return name
+}
+
+// Extensions returns the Python source and stub extensions.
+func (Python) Extensions() (extensions []string) {
+	extensions = []string{".py", ".pyi"}
+	return extensions
+}
+
+// pythonLine is one physical line with what the scanner learned about it.
+// A statement line begins a logical statement; continuation lines (inside
+// brackets or a triple-quoted string, or after a backslash) and blank or
+// comment-only lines are neither statements nor block ends.
+type pythonLine struct {
+	text      string
+	indent    int
+	statement bool
+	blank     bool
+}
+
+// pythonDef is a def or class statement and the lines it spans.
+type pythonDef struct {
+	kind      string
+	name      string
+	header    string
+	startLine int
+	endLine   int
+}
+
+// ParseFile extracts the file's functions, classes, and methods.
+func (p Python) ParseFile(path string, content []byte) (docs []elasticsearch.CodeDocument, err error) {
+	lines := scanPythonLines(string(content))
+	imports := pythonImports(lines)
+
+	for _, def := range pythonDefs(lines, 0, len(lines), "") {
+		texts := make([]string, 0, def.endLine-def.startLine+1)
+		for _, line := range lines[def.startLine : def.endLine+1] {
+			texts = append(texts, line.text)
+		}
+		code := strings.Join(texts, "\n")
+
+		hashFrom := strings.Index(code, def.header) + len(def.header)
+		docs = append(docs, elasticsearch.CodeDocument{
+			FilePath:         path,
+			DocType:          elasticsearch.DocTypeCode,
+			Language:         LanguagePython,
+			Kind:             def.kind,
+			FunctionName:     def.name,
+			Exported:         pythonPublic(def.name),
+			StartLine:        def.startLine + 1,
+			EndLine:          def.endLine + 1,
+			Code:             code,
+			HasErrorHandling: pythonErrorHandlingPattern.MatchString(code),
+			Deprecated:       pythonDeprecatedPattern.MatchString(code[:hashFrom]),
+			Markers:          CommentMarkers(code, def.startLine+1),
+			Imports:          imports,
+			ContentHash:      contentHash(code[hashFrom:]),
+			IndexedAt:        time.Now(),
+		})
+	}
+
+	return docs, err
+}
+
+// pythonPublic reports whether a def or class, named "Class.method" for a
+// method, is public by convention: neither it nor its class has a name
+// starting with an underscore.
+func pythonPublic(name string) (public bool) {
+	for _, part := range strings.Split(name, ".") {
+		if strings.HasPrefix(part, "_") {
+			return public
+		}
+	}
+	public = true
+	return public
+}
+
+// scanPythonLines splits source into lines, tracking strings, comments, and
+// bracket depth across lines to tell statements from continuations.
+func scanPythonLines(src string) (lines []pythonLine) {
+	quote := ""
+	depth := 0
+	backslash := false
+
+	for _, text := range strings.Split(src, "\n") {
+		text = strings.TrimSuffix(text, "\r")
+		continuation := quote != "" || depth > 0 || backslash
+
+		trimmed := strings.TrimSpace(text)
+		line := pythonLine{text: text, indent: pythonIndent(text)}
+		line.blank = !continuation && (trimmed == "" || strings.HasPrefix(trimmed, "#"))
+		line.statement = !continuation && !line.blank
+		lines = append(lines, line)
+
+		backslash = false
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			if quote != "" {
+				switch {
+				case c == '\\':
+					i++
+				case strings.HasPrefix(text[i:], quote):
+					i += len(quote) - 1
+					quote = ""
+				}
+				continue
+			}
+
+			switch c {
+			case '#':
+				i = len(text)
+			case '\'', '"':
+				quote = string(c)
+				if strings.HasPrefix(text[i:], strings.Repeat(quote, 3)) {
+					quote = strings.Repeat(quote, 3)
+					i += 2
+				}
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth = max(depth-1, 0)
+			case '\\':
+				backslash = i == len(text)-1
+			}
+		}
+
+		// A single-quoted string can't span lines; drop it so one stray quote
+		// doesn't swallow the rest of the file.
+		if len(quote) == 1 {
+			quote = ""
+		}
+	}
+
+	return lines
+}
+
+// pythonIndent measures leading whitespace, with tabs advancing to the next
+// multiple of eight as in the Python tokenizer.
+func pythonIndent(text string) (indent int) {
+	for _, c := range text {
+		switch c {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 8 - indent%8
+		default:
+			return indent
+		}
+	}
+	return indent
+}
+
+// pythonDefs finds the def and class statements at the first statement's
+// indentation in lines[from:to], descending into classes for their methods,
+// which are named "Class.method".
+func pythonDefs(lines []pythonLine, from int, to int, class string) (defs []pythonDef) {
+	indent := -1
+	for i := from; i < to; i++ {
+		if lines[i].statement {
+			indent = lines[i].indent
+			break
+		}
+	}
+
+	decoratorStart := -1
+	for i := from; i < to; i++ {
+		line := lines[i]
+		if !line.statement || line.indent != indent {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line.text)
+		if strings.HasPrefix(trimmed, "@") {
+			if decoratorStart < 0 {
+				decoratorStart = i
+			}
+			continue
+		}
+
+		start := i
+		if decoratorStart >= 0 {
+			start = decoratorStart
+		}
+		decoratorStart = -1
+
+		match := pythonHeaderPattern.FindStringSubmatch(trimmed)
+		if match == nil {
+			continue
+		}
+
+		def := pythonDef{
+			kind:      elasticsearch.KindFunction,
+			name:      match[2],
+			header:    match[0],
+			startLine: start,
+			endLine:   pythonBlockEnd(lines, i, to),
+		}
+		switch {
+		case match[1] == "class":
+			def.kind = elasticsearch.KindClass
+		case class != "":
+			def.kind = elasticsearch.KindMethod
+			def.name = class + "." + def.name
+		}
+		defs = append(defs, def)
+
+		if def.kind == elasticsearch.KindClass {
+			defs = append(defs, pythonDefs(lines, i+1, def.endLine+1, def.name)...)
+		}
+	}
+
+	return defs
+}
+
+// pythonBlockEnd returns the last line of the block opened by the header at
+// lines[header]: the last non-blank line before the next statement indented
+// no deeper than the header. Trailing comments belong to what follows.
+func pythonBlockEnd(lines []pythonLine, header int, to int) (end int) {
+	end = header
+	for i := header + 1; i < to; i++ {
+		if lines[i].statement && lines[i].indent <= lines[header].indent {
+			break
+		}
+		if !lines[i].blank {
+			end = i
+		}
+	}
+	return end
+}
+
+// pythonImports lists the modules imported at the top level of the file.
+func pythonImports(lines []pythonLine) (imports []string) {
+	seen := make(map[string]bool)
+	add := func(module string) {
+		if module != "" && !seen[module] {
+			seen[module] = true
+			imports = append(imports, module)
+		}
+	}
+
+	for _, line := range lines {
+		if !line.statement || line.indent != 0 {
+			continue
+		}
+
+		match := pythonImportPattern.FindStringSubmatch(strings.TrimSpace(line.text))
+		if match == nil {
+			continue
+		}
+		if match[1] != "" {
+			add(match[1])
+			continue
+		}
+
+		names, _, _ := strings.Cut(match[2], "#")
+		for _, name := range strings.Split(names, ",") {
+			module, _, _ := strings.Cut(strings.TrimSpace(name), " ")
+			add(module)
+		}
+	}
+
+	return imports
+}
@@ -0,0 +1,357 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// LanguageTerraform is the Language name of the Terraform parser.
+const LanguageTerraform = "terraform"
+
+// hclBlockHeaderPattern matches a block header up to its opening brace: the
+// block type followed by quoted or bare labels.
+//
+//nolint:gochecknoglobals // compiled once
+var hclBlockHeaderPattern = regexp.MustCompile(`^\s*([A-Za-z_][\w-]*)((?:\s+(?:"(?:[^"\\]|\\.)*"|[A-Za-z_][\w-]*))*)\s*$`)
+
+// hclLabelPattern matches one quoted or bare block label.
+//
+//nolint:gochecknoglobals // compiled once
+var hclLabelPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"|([A-Za-z_][\w-]*)`)
+
+// hclBodyItemPattern matches an argument or nested block at the start of a
+// line in a block body. Labels of nested blocks are blanked by then.
+//
+//nolint:gochecknoglobals // compiled once
+var hclBodyItemPattern = regexp.MustCompile(`^\s*([A-Za-z_][\w-]*)\s*(=|\{)`)
+
+// hclArgumentValuePattern matches a bare or quoted argument value.
+//
+//nolint:gochecknoglobals // compiled once
+var hclArgumentValuePattern = regexp.MustCompile(`=\s*(?:"((?:[^"\\]|\\.)*)"|([\w.-]+))`)
+
+// hclHeredocPattern matches the opening of a heredoc, capturing its delimiter.
+//
+//nolint:gochecknoglobals // compiled once
+var hclHeredocPattern = regexp.MustCompile(`^<<-?([A-Za-z_][\w-]*)[ \t]*\r?\n`)
+
+// terraformBlocks maps the indexed block types to their kind, how many labels
+// they take, and the prefix of their Terraform address.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var terraformBlocks = map[string]struct {
+	kind   string
+	labels int
+	prefix string
+}{
+	"resource": {kind: elasticsearch.KindResource, labels: 2},
+	"data":     {kind: elasticsearch.KindData, labels: 2, prefix: "data."},
+	"module":   {kind: elasticsearch.KindModule, labels: 1, prefix: "module."},
+	"variable": {kind: elasticsearch.KindVariable, labels: 1, prefix: "var."},
+	"output":   {kind: elasticsearch.KindOutput, labels: 1, prefix: "output."},
+	"provider": {kind: elasticsearch.KindProvider, labels: 1},
+}
+
+// Terraform parses Terraform's HCL configuration by matching braces over the
+// source with its comments, strings, and heredocs blanked out. Resource,
+// data, module, variable, output, and provider blocks become documents named
+// by their Terraform address, such as aws_s3_bucket.logs or module.vpc.
+// Resources and data sources record their type and provider, modules their
+// source as an import, and every block the arguments and nested blocks set
+// in it.
+type Terraform struct{}
+
+// Name returns "terraform".
+func (Terraform) Name() (name string) {
+	name = LanguageTerraform
+	return name
+}
+
+// Extensions returns the Terraform configuration extension.
+func (Terraform) Extensions() (extensions []string) {
+	extensions = []string{".tf"}
+	return extensions
+}
+
+// ParseFile extracts the file's top-level blocks.
+func (t Terraform) ParseFile(path string, content []byte) (docs []elasticsearch.CodeDocument, err error) {
+	src := string(content)
+	code := blankHCLNonCode(content)
+	starts := lineStarts(content)
+
+	lineStart := 0
+	for i := 0; i < len(code); i++ {
+		switch code[i] {
+		case '\n':
+			lineStart = i + 1
+		case '{':
+			end := matchingBrace(code, i)
+			doc, found := terraformBlock(src, code, lineStart, i, end)
+			if found {
+				doc.FilePath = path
+				doc.StartLine = lineOf(starts, lineStart)
+				doc.EndLine = lineOf(starts, end)
+				doc.Markers = CommentMarkers(doc.Code, doc.StartLine)
+				docs = append(docs, doc)
+			}
+			i = end
+		}
+	}
+
+	return docs, err
+}
+
+// terraformBlock builds the document for the block whose header runs from
+// start to the brace at open and whose body closes at end. It reports false
+// for blocks that aren't indexed.
+func terraformBlock(src string, code string, start int, open int, end int) (doc elasticsearch.CodeDocument, found bool) {
+	header := hclBlockHeaderPattern.FindStringSubmatch(src[start:open])
+	if header == nil {
+		return doc, found
+	}
+
+	block, indexed := terraformBlocks[header[1]]
+	var labels []string
+	for _, match := range hclLabelPattern.FindAllStringSubmatch(header[2], -1) {
+		labels = append(labels, match[1]+match[2])
+	}
+	if !indexed || len(labels) != block.labels {
+		return doc, found
+	}
+
+	args := hclArguments(src, code, open+1, end)
+	doc = elasticsearch.CodeDocument{
+		DocType:      elasticsearch.DocTypeCode,
+		Language:     LanguageTerraform,
+		Kind:         block.kind,
+		FunctionName: block.prefix + strings.Join(labels, "."),
+		Code:         src[start : end+1],
+		ContentHash:  contentHash(src[open : end+1]),
+		IndexedAt:    time.Now(),
+	}
+	for _, arg := range args {
+		doc.Attributes = append(doc.Attributes, arg.name)
+	}
+
+	switch header[1] {
+	case "resource", "data":
+		doc.ResourceType = labels[0]
+		doc.Provider, _, _ = strings.Cut(labels[0], "_")
+		provider, explicit := argumentValue(args, "provider")
+		if explicit {
+			doc.Provider, _, _ = strings.Cut(provider, ".")
+		}
+	case "provider":
+		doc.Provider = labels[0]
+	case "variable", "output":
+		// A module's variables and outputs are its interface.
+		doc.Exported = true
+	case "module":
+		source, hasSource := argumentValue(args, "source")
+		if hasSource {
+			doc.Imports = []string{source}
+		}
+	}
+
+	found = true
+	return doc, found
+}
+
+// hclArgument is an argument or nested block type set in a block body, with
+// the argument's value when it is a literal or reference.
+type hclArgument struct {
+	name  string
+	value string
+}
+
+// hclArguments lists the arguments and nested block types set directly in
+// the block body between from and end, once each, in order.
+func hclArguments(src string, code string, from int, end int) (args []hclArgument) {
+	seen := make(map[string]bool)
+	for _, line := range hclBodyLines(code, from, end) {
+		if line.depth != 0 {
+			continue
+		}
+
+		match := hclBodyItemPattern.FindStringSubmatchIndex(code[line.start:line.end])
+		if match == nil {
+			continue
+		}
+
+		name := code[line.start+match[2] : line.start+match[3]]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		arg := hclArgument{name: name}
+		value := hclArgumentValuePattern.FindStringSubmatch(src[line.start+match[4] : line.end])
+		if code[line.start+match[4]] == '=' && value != nil {
+			arg.value = value[1] + value[2]
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// hclBodyLine is a line of a block body and the bracket depth, relative to
+// the body, at its start.
+type hclBodyLine struct {
+	start int
+	end   int
+	depth int
+}
+
+// hclBodyLines splits the body between from and end into lines.
+func hclBodyLines(code string, from int, end int) (lines []hclBodyLine) {
+	depth := 0
+	line := hclBodyLine{start: from}
+	for i := from; i < end && i < len(code); i++ {
+		switch code[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		case '\n':
+			line.end = i
+			lines = append(lines, line)
+			line = hclBodyLine{start: i + 1, depth: depth}
+		}
+	}
+
+	line.end = min(end, len(code))
+	lines = append(lines, line)
+	return lines
+}
+
+// argumentValue returns the value of the named argument, if it was set to a
+// literal or reference.
+func argumentValue(args []hclArgument, name string) (value string, found bool) {
+	for _, arg := range args {
+		if arg.name == name && arg.value != "" {
+			value = arg.value
+			found = true
+			return value, found
+		}
+	}
+	return value, found
+}
+
+// blankHCLNonCode replaces comments, string contents (template
+// interpolations included), and heredoc bodies with spaces, keeping
+// newlines, so braces can be matched on what remains.
+func blankHCLNonCode(content []byte) (blanked string) {
+	out := []byte(string(content))
+	blank := func(from int, to int) {
+		for i := from; i < to && i < len(out); i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	for i := 0; i < len(content); i++ {
+		rest := string(content[i:])
+		switch {
+		case content[i] == '#' || strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			blank(i, i+end)
+			i += end - 1
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest) - 2
+			}
+			blank(i, i+end+4)
+			i += end + 3
+		case content[i] == '"':
+			end := hclStringEnd(content, i)
+			blank(i+1, end)
+			i = end
+		case strings.HasPrefix(rest, "<<"):
+			end := hclHeredocEnd(rest)
+			blank(i, i+end)
+			i += max(end, 2) - 1
+		}
+	}
+
+	blanked = string(out)
+	return blanked
+}
+
+// hclStringEnd returns the offset of the quote closing the string opened at
+// start. Quotes inside ${...} and %{...} interpolations belong to nested
+// strings. A string left open at the end of its line ends there.
+func hclStringEnd(content []byte, start int) (end int) {
+	for end = start + 1; end < len(content); end++ {
+		switch {
+		case content[end] == '\\':
+			end++
+		case content[end] == '\n':
+			end--
+			return end
+		case content[end] == '"':
+			return end
+		case (content[end] == '$' || content[end] == '%') && end+1 < len(content) && content[end+1] == '{':
+			end = hclTemplateEnd(content, end+1)
+		}
+	}
+	end = len(content) - 1
+	return end
+}
+
+// hclTemplateEnd returns the offset of the brace closing the interpolation
+// opened at open, skipping strings nested in it.
+func hclTemplateEnd(content []byte, open int) (closing int) {
+	depth := 0
+	for closing = open; closing < len(content); closing++ {
+		switch content[closing] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return closing
+			}
+		case '"':
+			closing = hclStringEnd(content, closing)
+		case '\n':
+			closing--
+			return closing
+		}
+	}
+	closing = len(content) - 1
+	return closing
+}
+
+// hclHeredocEnd returns the length of the heredoc at the start of rest,
+// through its closing delimiter line, or 0 when rest doesn't open one. An
+// unterminated heredoc runs to the end of the file.
+func hclHeredocEnd(rest string) (length int) {
+	match := hclHeredocPattern.FindStringSubmatchIndex(rest)
+	if match == nil {
+		return length
+	}
+
+	delimiter := rest[match[2]:match[3]]
+	for offset := match[1]; offset < len(rest); {
+		lineEnd := strings.IndexByte(rest[offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(rest) - offset
+		}
+		if strings.TrimSpace(rest[offset:offset+lineEnd]) == delimiter {
+			length = offset + lineEnd
+			return length
+		}
+		offset += lineEnd + 1
+	}
+
+	length = len(rest)
+	return length
+}
@@ -0,0 +1,635 @@
+package parser
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// LanguageTypeScript is the Language name of the TypeScript parser.
+const LanguageTypeScript = "typescript"
+
+// tsDeclPattern matches a top-level declaration with its modifiers.
+//
+//nolint:gochecknoglobals // compiled once
+var tsDeclPattern = regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?(?:async\s+)?(function\b\s*\*?|(?:class|interface|type|const\s+enum|enum|const|let|var)\b)\s*([A-Za-z_$][\w$]*)`)
+
+// tsMethodPattern matches a method declaration in a class body, up to its
+// parameter list.
+//
+//nolint:gochecknoglobals // compiled once
+var tsMethodPattern = regexp.MustCompile(`^(?:(?:public|private|protected|static|readonly|abstract|override|async|declare|get|set)\s+)*\*?\s*([A-Za-z_$#][\w$]*)\s*(?:<[^(]*>)?\s*\(`)
+
+// tsPrivatePattern matches the modifiers that hide a class member from
+// other modules.
+//
+//nolint:gochecknoglobals // compiled once
+var tsPrivatePattern = regexp.MustCompile(`\b(?:private|protected)\s`)
+
+// tsImportPattern matches the module specifier of import and re-export
+// statements.
+//
+//nolint:gochecknoglobals // compiled once
+var tsImportPattern = regexp.MustCompile(`(?m)^\s*(?:import|export)\s(?:[^;'"]*?\bfrom\s*)?['"]([^'"]+)['"]`)
+
+// tsErrorHandlingPattern matches try/catch and promise catch handlers.
+//
+//nolint:gochecknoglobals // compiled once
+var tsErrorHandlingPattern = regexp.MustCompile(`\btry\s*\{|\.catch\s*\(`)
+
+// tsKeywords are names tsMethodPattern can match that are statements, not
+// methods.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var tsKeywords = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "function": true}
+
+// TypeScript parses TypeScript by matching braces over the source with its
+// strings, comments, and regular expressions blanked out. Top-level
+// functions, classes, interfaces, type aliases, enums, and variables
+// holding functions become documents, as do methods with bodies in class
+// bodies. Decorators are kept with the class they decorate.
+type TypeScript struct{}
+
+// Name returns "typescript".
+func (TypeScript) Name() (name string) {
+	name = LanguageTypeScript
+	return name
+}
+
+// Extensions returns the TypeScript source extensions.
+func (TypeScript) Extensions() (extensions []string) {
+	extensions = []string{".ts", ".tsx", ".mts", ".cts"}
+	return extensions
+}
+
+// tsDecl is a declaration's kind, name, and byte range in the source, and
+// whether other modules can import it.
+type tsDecl struct {
+	kind     string
+	name     string
+	start    int
+	nameEnd  int
+	end      int
+	exported bool
+}
+
+// tsFile is a source file prepared for declaration scanning: code is the
+// source with non-code blanked, and depths holds the bracket depth at the
+// start of each line.
+type tsFile struct {
+	src    string
+	code   string
+	starts []int
+	depths []int
+}
+
+// ParseFile extracts the file's declarations.
+func (t TypeScript) ParseFile(path string, content []byte) (docs []elasticsearch.CodeDocument, err error) {
+	file := newTSFile(content)
+
+	var imports []string
+	seen := make(map[string]bool)
+	for _, match := range tsImportPattern.FindAllStringSubmatch(file.src, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			imports = append(imports, match[1])
+		}
+	}
+
+	for _, decl := range file.declarations() {
+		code := file.src[decl.start : decl.end+1]
+		startLine := lineOf(file.starts, decl.start)
+		docs = append(docs, elasticsearch.CodeDocument{
+			FilePath:         path,
+			DocType:          elasticsearch.DocTypeCode,
+			Language:         LanguageTypeScript,
+			Kind:             decl.kind,
+			FunctionName:     decl.name,
+			Exported:         decl.exported,
+			StartLine:        startLine,
+			EndLine:          lineOf(file.starts, decl.end),
+			Code:             code,
+			HasErrorHandling: tsErrorHandlingPattern.MatchString(file.code[decl.start : decl.end+1]),
+			Markers:          CommentMarkers(code, startLine),
+			Imports:          imports,
+			ContentHash:      contentHash(file.src[decl.nameEnd : decl.end+1]),
+			IndexedAt:        time.Now(),
+		})
+	}
+
+	return docs, err
+}
+
+// newTSFile blanks the source's non-code and records line depths.
+func newTSFile(content []byte) (file *tsFile) {
+	file = &tsFile{
+		src:    string(content),
+		code:   blankTSNonCode(content),
+		starts: lineStarts(content),
+	}
+
+	depth := 0
+	line := 0
+	file.depths = make([]int, len(file.starts))
+	for i := 0; i < len(file.code); i++ {
+		if line+1 < len(file.starts) && i == file.starts[line+1] {
+			line++
+			file.depths[line] = depth
+		}
+		switch file.code[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth = max(depth-1, 0)
+		}
+	}
+	return file
+}
+
+// lineText returns the code of a line, without its newline.
+func (f *tsFile) lineText(line int) (text string) {
+	end := len(f.code)
+	if line+1 < len(f.starts) {
+		end = f.starts[line+1] - 1
+	}
+	text = f.code[f.starts[line]:end]
+	return text
+}
+
+// declarations finds the top-level declarations and the methods of classes.
+func (f *tsFile) declarations() (decls []tsDecl) {
+	decoratorStart := -1
+	for line := range f.starts {
+		if f.depths[line] != 0 {
+			continue
+		}
+
+		text := f.lineText(line)
+		trimmed := strings.TrimLeft(text, " \t")
+		offset := f.starts[line] + len(text) - len(trimmed)
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "@") {
+			if decoratorStart < 0 {
+				decoratorStart = offset
+			}
+			continue
+		}
+
+		start := offset
+		if decoratorStart >= 0 {
+			start = decoratorStart
+		}
+		decoratorStart = -1
+
+		match := tsDeclPattern.FindStringSubmatchIndex(trimmed)
+		if match == nil {
+			continue
+		}
+
+		decl := tsDecl{
+			name:     trimmed[match[4]:match[5]],
+			start:    start,
+			nameEnd:  offset + match[5],
+			exported: strings.HasPrefix(trimmed[:match[2]], "export"),
+		}
+
+		found := f.completeDecl(&decl, trimmed[match[2]:match[3]])
+		if !found {
+			continue
+		}
+		decls = append(decls, decl)
+
+		if decl.kind == elasticsearch.KindClass {
+			decls = append(decls, f.methods(decl)...)
+		}
+	}
+	return decls
+}
+
+// completeDecl sets the declaration's kind and end from its keyword. It
+// reports false for variables that don't hold functions.
+func (f *tsFile) completeDecl(decl *tsDecl, keyword string) (found bool) {
+	switch {
+	case strings.HasPrefix(keyword, "function"):
+		decl.kind = elasticsearch.KindFunction
+		decl.end, _ = f.bodyEnd(decl.nameEnd)
+	case strings.HasSuffix(keyword, "enum"):
+		decl.kind = elasticsearch.KindType
+		decl.end, _ = f.bodyEnd(decl.nameEnd)
+	case keyword == "class":
+		decl.kind = elasticsearch.KindClass
+		decl.end, _ = f.bodyEnd(decl.nameEnd)
+	case keyword == "interface":
+		decl.kind = elasticsearch.KindInterface
+		decl.end, _ = f.bodyEnd(decl.nameEnd)
+	case keyword == "type":
+		decl.kind = elasticsearch.KindType
+		decl.end = f.statementEnd(decl.nameEnd)
+	default:
+		decl.kind = elasticsearch.KindFunction
+		decl.end = f.statementEnd(decl.nameEnd)
+		if !f.holdsFunction(decl.nameEnd, decl.end) {
+			return found
+		}
+	}
+
+	found = true
+	return found
+}
+
+// holdsFunction reports whether a variable declaration between from and end
+// is initialised with a function expression or arrow function.
+func (f *tsFile) holdsFunction(from int, end int) (holds bool) {
+	depth := 0
+	for i := from; i <= end && i < len(f.code); i++ {
+		switch f.code[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		case '=':
+			if depth != 0 || strings.HasPrefix(f.code[i:], "=>") || strings.HasPrefix(f.code[i:], "==") {
+				continue
+			}
+
+			value := strings.TrimSpace(f.code[i+1 : end+1])
+			value = strings.TrimSpace(strings.TrimPrefix(value, "async"))
+			if strings.HasPrefix(value, "function") {
+				holds = true
+				return holds
+			}
+			holds = topLevelArrow(value)
+			return holds
+		}
+	}
+	return holds
+}
+
+// topLevelArrow reports whether an expression is an arrow function: an
+// "=>" outside any brackets, reached before anything else at that level.
+func topLevelArrow(expr string) (arrow bool) {
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		case '=':
+			if depth == 0 && strings.HasPrefix(expr[i:], "=>") {
+				arrow = true
+				return arrow
+			}
+		case ';', ',':
+			if depth == 0 {
+				return arrow
+			}
+		}
+	}
+	return arrow
+}
+
+// methods finds the methods with bodies declared directly in a class body,
+// naming them "Class.method". Methods of an exported class are exported
+// unless private, protected, or #private.
+func (f *tsFile) methods(class tsDecl) (methods []tsDecl) {
+	first := lineOf(f.starts, class.nameEnd)
+	last := lineOf(f.starts, class.end) - 1
+	for line := first; line < last && line < len(f.starts); line++ {
+		if f.depths[line] != 1 {
+			continue
+		}
+
+		text := f.lineText(line)
+		trimmed := strings.TrimLeft(text, " \t")
+		match := tsMethodPattern.FindStringSubmatchIndex(trimmed)
+		if match == nil || tsKeywords[trimmed[match[2]:match[3]]] {
+			continue
+		}
+
+		offset := f.starts[line] + len(text) - len(trimmed)
+		end, hasBody := f.bodyEnd(offset + match[1] - 1)
+		if !hasBody {
+			continue
+		}
+
+		name := trimmed[match[2]:match[3]]
+		methods = append(methods, tsDecl{
+			kind:     elasticsearch.KindMethod,
+			name:     class.name + "." + name,
+			start:    offset,
+			nameEnd:  offset + match[3],
+			end:      end,
+			exported: class.exported && !strings.HasPrefix(name, "#") && !tsPrivatePattern.MatchString(trimmed[:match[2]]),
+		})
+	}
+	return methods
+}
+
+// bodyEnd finds the body of a function, class, interface, or enum whose
+// header starts at from, returning the offset of its closing brace. A brace
+// following ':', '|', '&', ',', '<', or '=' opens a type literal, not the
+// body. A header ending in ';' or running into the next top-level line
+// without a body, such as an overload, ends there with hasBody false.
+func (f *tsFile) bodyEnd(from int) (end int, hasBody bool) {
+	parens := 0
+	angles := 0
+	for i := from; i < len(f.code); i++ {
+		c := f.code[i]
+		switch {
+		case c == '(' || c == '[':
+			parens++
+		case c == ')' || c == ']':
+			parens--
+		case c == '<' && parens == 0:
+			angles++
+		case c == '>' && parens == 0 && angles > 0 && f.code[i-1] != '=':
+			angles--
+		case c == ';' && parens == 0 && angles == 0:
+			end = i
+			return end, hasBody
+		case c == '\n' && parens == 0 && angles == 0 && i+1 < len(f.code) && f.startsTopLevel(i+1):
+			end = lastCode(f.code, i)
+			return end, hasBody
+		case c == '{' && parens == 0 && angles == 0:
+			closing := matchingBrace(f.code, i)
+			if strings.ContainsRune(":|&,<=", rune(lastCodeByte(f.code, i))) {
+				i = closing
+				continue
+			}
+			end = closing
+			hasBody = true
+			return end, hasBody
+		}
+	}
+
+	end = lastCode(f.code, len(f.code))
+	return end, hasBody
+}
+
+// startsTopLevel reports whether the line starting at offset begins a new
+// top-level declaration.
+func (f *tsFile) startsTopLevel(offset int) (starts bool) {
+	line := lineOf(f.starts, offset)
+	if f.starts[line-1] != offset {
+		return starts
+	}
+
+	trimmed := strings.TrimLeft(f.lineText(line-1), " \t")
+	starts = strings.HasPrefix(trimmed, "@") || tsDeclPattern.MatchString(trimmed)
+	return starts
+}
+
+// statementEnd returns the offset of the last character of the statement
+// starting at from: a ';' outside brackets, or the end of a line that
+// completes the statement, as automatic semicolon insertion would see it.
+func (f *tsFile) statementEnd(from int) (end int) {
+	depth := 0
+	for i := from; i < len(f.code); i++ {
+		switch f.code[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		case ';':
+			if depth == 0 {
+				end = i
+				return end
+			}
+		case '\n':
+			if depth != 0 {
+				continue
+			}
+			if strings.ContainsRune("=,(+-*/&|?:.<[{", rune(lastCodeByte(f.code, i))) {
+				continue
+			}
+			next := strings.TrimLeft(f.code[i+1:], " \t\r\n")
+			if next != "" && (strings.ContainsRune(".?:|&)]", rune(next[0])) || strings.HasPrefix(next, "=>")) {
+				continue
+			}
+			end = lastCode(f.code, i)
+			return end
+		}
+	}
+
+	end = lastCode(f.code, len(f.code))
+	return end
+}
+
+// matchingBrace returns the offset of the brace closing the one at open, or
+// the last offset when the file ends first.
+func matchingBrace(code string, open int) (closing int) {
+	depth := 0
+	for i := open; i < len(code); i++ {
+		switch code[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				closing = i
+				return closing
+			}
+		}
+	}
+
+	closing = len(code) - 1
+	return closing
+}
+
+// lastCode returns the offset of the last non-space character before
+// offset.
+func lastCode(code string, offset int) (last int) {
+	last = offset - 1
+	for last > 0 && strings.ContainsRune(" \t\r\n", rune(code[last])) {
+		last--
+	}
+	return last
+}
+
+// lastCodeByte returns the last non-space character before offset, or 0.
+func lastCodeByte(code string, offset int) (c byte) {
+	last := lastCode(code, offset)
+	if last >= 0 {
+		c = code[last]
+	}
+	return c
+}
+
+// blankTSNonCode replaces comments, string and template literal text, and
+// regular expression literals with spaces, keeping newlines and the code in
+// template substitutions, so braces can be matched on what remains.
+// Single-quoted strings and regular expressions end at a newline, which
+// contains the damage from an apostrophe in JSX text.
+func blankTSNonCode(content []byte) (blanked string) {
+	out := []byte(string(content))
+	blank := func(from int, to int) {
+		for i := from; i < to && i < len(out); i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	var templates []int
+	depth := 0
+	inTemplate := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		if inTemplate {
+			end, substitution := templateTextEnd(content, i)
+			blank(i, end+1)
+			if substitution {
+				templates = append(templates, depth)
+				depth++
+			}
+			i = end
+			inTemplate = false
+			continue
+		}
+
+		switch {
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			end := lineCommentEnd(content, i)
+			blank(i, end+1)
+			i = end
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := blockCommentEnd(content, i)
+			blank(i, end+1)
+			i = end
+		case c == '\'' || c == '"':
+			end := quotedEnd(content, i)
+			blank(i, end+1)
+			i = end
+		case c == '`':
+			blank(i, i+1)
+			inTemplate = true
+		case c == '/' && regexAllowed(out, i):
+			end := regexEnd(content, i)
+			blank(i, end+1)
+			i = end
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if len(templates) > 0 && templates[len(templates)-1] == depth {
+				templates = templates[:len(templates)-1]
+				blank(i, i+1)
+				inTemplate = true
+			}
+		}
+	}
+
+	blanked = string(out)
+	return blanked
+}
+
+// lineCommentEnd returns the offset of the last character of the line
+// comment opened at start.
+func lineCommentEnd(content []byte, start int) (end int) {
+	end = len(content) - 1
+	newline := bytes.IndexByte(content[start:], '\n')
+	if newline >= 0 {
+		end = start + newline - 1
+	}
+	return end
+}
+
+// blockCommentEnd returns the offset of the '/' closing the block comment
+// opened at start, or of the end of the content when it's unterminated.
+func blockCommentEnd(content []byte, start int) (end int) {
+	end = len(content) - 1
+	closing := bytes.Index(content[start+2:], []byte("*/"))
+	if closing >= 0 {
+		end = start + 2 + closing + 1
+	}
+	return end
+}
+
+// templateTextEnd returns the offset of the backtick closing the template
+// literal text starting at start, or of the '{' opening a substitution,
+// reporting which. Unterminated text runs to the end of the content.
+func templateTextEnd(content []byte, start int) (end int, substitution bool) {
+	for end = start; end < len(content); end++ {
+		switch {
+		case content[end] == '\\':
+			end++
+		case content[end] == '`':
+			return end, substitution
+		case content[end] == '$' && end+1 < len(content) && content[end+1] == '{':
+			end++
+			substitution = true
+			return end, substitution
+		}
+	}
+	end = len(content) - 1
+	return end, substitution
+}
+
+// quotedEnd returns the offset of the quote closing the string opened at
+// start, or of the end of the line when it's unterminated.
+func quotedEnd(content []byte, start int) (end int) {
+	for end = start + 1; end < len(content); end++ {
+		switch content[end] {
+		case '\\':
+			end++
+		case '\n':
+			end--
+			return end
+		case content[start]:
+			return end
+		}
+	}
+	end = len(content) - 1
+	return end
+}
+
+// regexAllowed reports whether a '/' at offset starts a regular expression
+// rather than dividing, judging by the code before it.
+func regexAllowed(code []byte, offset int) (allowed bool) {
+	i := offset - 1
+	for i >= 0 && strings.ContainsRune(" \t\r\n", rune(code[i])) {
+		i--
+	}
+	if i < 0 {
+		allowed = true
+		return allowed
+	}
+
+	allowed = strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", rune(code[i])) ||
+		strings.HasSuffix(string(code[:i+1]), "return") ||
+		strings.HasSuffix(string(code[:i+1]), "typeof")
+	return allowed
+}
+
+// regexEnd returns the offset of the '/' closing the regular expression
+// opened at start, skipping character classes and escapes, or of the end of
+// the line when it's unterminated.
+func regexEnd(content []byte, start int) (end int) {
+	class := false
+	for end = start + 1; end < len(content); end++ {
+		switch content[end] {
+		case '\\':
+			end++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '\n':
+			end--
+			return end
+		case '/':
+			if !class {
+				return end
+			}
+		}
+	}
+	end = len(content) - 1
+	return end
+}
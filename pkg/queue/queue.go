@@ -0,0 +1,362 @@
+// Package queue distributes per-repository index jobs through a Redis stream,
+// so that a coordinator can enqueue repositories and any number of worker
+// processes can index them.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+)
+
+// ErrNotConfigured is returned when the queue is used without QUEUE_URL.
+var ErrNotConfigured = errors.New("QUEUE_URL must be set for queue-backed indexing")
+
+// dedupTTL bounds how long a repository's queued marker outlives a job lost
+// with its stream, so such a repository isn't kept out of the queue for good.
+const dedupTTL = 24 * time.Hour
+
+// Job results counted by the queue jobs metric.
+const (
+	resultEnqueued     = "enqueued"
+	resultDeduplicated = "deduplicated"
+	resultCompleted    = "completed"
+	resultRetried      = "retried"
+	resultFailed       = "failed"
+	resultReleased     = "released"
+)
+
+// Job is a request to index one repository, as delivered to a worker.
+type Job struct {
+	// ID is the job's stream entry ID.
+	ID string
+	// Repo is the repository to index, as named in GIT_REPOS.
+	Repo string
+	// Attempt counts deliveries of the job, from 1.
+	Attempt int
+}
+
+// Queue is a Redis stream of index jobs read by a consumer group of workers.
+// A job a worker stops acknowledging for longer than the visibility timeout
+// is taken back and retried, and a repository already queued or being
+// indexed isn't queued again.
+type Queue struct {
+	client      *redisClient
+	stream      string
+	group       string
+	visibility  time.Duration
+	maxAttempts int
+	metrics     *metrics.Metrics
+	logger      logging.Logger
+
+	groupMu    sync.Mutex
+	groupReady bool
+}
+
+// New creates a queue from cfg. It returns ErrNotConfigured when QUEUE_URL
+// is unset. No connection is made until the queue is used.
+func New(cfg config.Config, m *metrics.Metrics, logger logging.Logger) (q *Queue, err error) {
+	if cfg.QueueURL == "" {
+		err = ErrNotConfigured
+		return q, err
+	}
+
+	var client *redisClient
+	client, err = newRedisClient(cfg.QueueURL)
+	if err != nil {
+		return q, err
+	}
+
+	q = &Queue{
+		client:      client,
+		stream:      cfg.QueueStream,
+		group:       cfg.QueueGroup,
+		visibility:  cfg.QueueVisibility,
+		maxAttempts: cfg.QueueMaxAttempts,
+		metrics:     m,
+		logger:      logger,
+	}
+	return q, err
+}
+
+// Close closes the connection to Redis.
+func (q *Queue) Close() (err error) {
+	err = q.client.Close()
+	return err
+}
+
+// pendingKey is the key marking a repository as queued or being indexed.
+func (q *Queue) pendingKey(repo string) (key string) {
+	key = q.stream + ":pending:" + repo
+	return key
+}
+
+// Enqueue queues a job to index repo. It returns false, without queueing
+// anything, when the repository is already queued or being indexed.
+func (q *Queue) Enqueue(ctx context.Context, repo string) (enqueued bool, err error) {
+	var reply any
+	reply, err = q.client.do(ctx, commandTimeout, "SET", q.pendingKey(repo), strconv.FormatInt(time.Now().Unix(), 10),
+		"NX", "PX", strconv.FormatInt(dedupTTL.Milliseconds(), 10))
+	if err != nil {
+		err = fmt.Errorf("failed to enqueue %s: %w", repo, err)
+		return enqueued, err
+	}
+	if reply == nil {
+		q.metrics.QueueJobs.WithLabelValues(resultDeduplicated).Inc()
+		return enqueued, err
+	}
+
+	err = q.add(ctx, repo, 1)
+	if err != nil {
+		// Don't leave the repository marked as queued with no job for it.
+		_, _ = q.client.do(context.WithoutCancel(ctx), commandTimeout, "DEL", q.pendingKey(repo))
+		err = fmt.Errorf("failed to enqueue %s: %w", repo, err)
+		return enqueued, err
+	}
+
+	enqueued = true
+	q.metrics.QueueJobs.WithLabelValues(resultEnqueued).Inc()
+	return enqueued, err
+}
+
+// add appends a job entry to the stream.
+func (q *Queue) add(ctx context.Context, repo string, attempt int) (err error) {
+	_, err = q.client.do(ctx, commandTimeout, "XADD", q.stream, "*", "repo", repo, "attempt", strconv.Itoa(attempt))
+	return err
+}
+
+// ensureGroup creates the stream and its consumer group if they don't exist.
+func (q *Queue) ensureGroup(ctx context.Context) (err error) {
+	q.groupMu.Lock()
+	defer q.groupMu.Unlock()
+
+	if q.groupReady {
+		return err
+	}
+
+	_, err = q.client.do(ctx, commandTimeout, "XGROUP", "CREATE", q.stream, q.group, "0", "MKSTREAM")
+	if hasPrefix(err, "BUSYGROUP") {
+		err = nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to create consumer group %s: %w", q.group, err)
+		return err
+	}
+
+	q.groupReady = true
+	return err
+}
+
+// resetGroup makes the next claim create the consumer group again, after
+// the stream was deleted from under it.
+func (q *Queue) resetGroup(err error) {
+	if hasPrefix(err, "NOGROUP") {
+		q.groupMu.Lock()
+		q.groupReady = false
+		q.groupMu.Unlock()
+	}
+}
+
+// Claim delivers the next job to consumer, waiting up to block for one. Jobs
+// abandoned by a worker for longer than the visibility timeout are retried
+// first. found is false when no job arrived in time.
+func (q *Queue) Claim(ctx context.Context, consumer string, block time.Duration) (job Job, found bool, err error) {
+	err = q.ensureGroup(ctx)
+	if err != nil {
+		return job, found, err
+	}
+
+	err = q.reclaimStale(ctx, consumer)
+	if err != nil {
+		q.resetGroup(err)
+		return job, found, err
+	}
+
+	var reply any
+	reply, err = q.client.do(ctx, block+commandTimeout, "XREADGROUP", "GROUP", q.group, consumer,
+		"COUNT", "1", "BLOCK", strconv.FormatInt(block.Milliseconds(), 10), "STREAMS", q.stream, ">")
+	if err != nil {
+		q.resetGroup(err)
+		err = fmt.Errorf("failed to read jobs: %w", err)
+		return job, found, err
+	}
+
+	// [[stream, [[id, [field, value, ...]]]]], or nil on timeout.
+	streams, _ := reply.([]any)
+	if len(streams) == 0 {
+		return job, found, err
+	}
+	stream, _ := streams[0].([]any)
+	if len(stream) < 2 {
+		return job, found, err
+	}
+	entries, _ := stream[1].([]any)
+	if len(entries) == 0 {
+		return job, found, err
+	}
+
+	job, err = parseEntry(entries[0])
+	if err != nil {
+		return job, found, err
+	}
+	found = true
+	return job, found, err
+}
+
+// reclaimStale takes over jobs whose worker stopped heartbeating and queues
+// them for another attempt.
+func (q *Queue) reclaimStale(ctx context.Context, consumer string) (err error) {
+	var reply any
+	reply, err = q.client.do(ctx, commandTimeout, "XAUTOCLAIM", q.stream, q.group, consumer,
+		strconv.FormatInt(q.visibility.Milliseconds(), 10), "0-0", "COUNT", "10")
+	if err != nil {
+		err = fmt.Errorf("failed to reclaim stale jobs: %w", err)
+		return err
+	}
+
+	// [next-id, [[id, [field, value, ...]], ...], deleted-ids]
+	parts, _ := reply.([]any)
+	if len(parts) < 2 {
+		return err
+	}
+	entries, _ := parts[1].([]any)
+	for _, entry := range entries {
+		job, parseErr := parseEntry(entry)
+		if parseErr != nil {
+			q.logger.Warn("Dropping malformed queue entry", "error", parseErr)
+			if job.ID != "" {
+				err = q.remove(ctx, job)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		q.logger.Warn("Reclaiming job from unresponsive worker", "repo", job.Repo, "attempt", job.Attempt)
+		_, err = q.Fail(ctx, job, errors.New("worker stopped responding"))
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// parseEntry reads a job from a stream entry.
+func parseEntry(entry any) (job Job, err error) {
+	fields, _ := entry.([]any)
+	if len(fields) < 2 {
+		err = fmt.Errorf("malformed queue entry %v", entry)
+		return job, err
+	}
+
+	job.ID, _ = fields[0].(string)
+	values, _ := fields[1].([]any)
+	for i := 0; i+1 < len(values); i += 2 {
+		name, _ := values[i].(string)
+		value, _ := values[i+1].(string)
+		switch name {
+		case "repo":
+			job.Repo = value
+		case "attempt":
+			job.Attempt, _ = strconv.Atoi(value)
+		}
+	}
+
+	if job.ID == "" || job.Repo == "" {
+		err = fmt.Errorf("malformed queue entry %v", entry)
+		return job, err
+	}
+	if job.Attempt < 1 {
+		job.Attempt = 1
+	}
+	return job, err
+}
+
+// Heartbeat tells the queue consumer is still working on job, so it isn't
+// reclaimed as abandoned.
+func (q *Queue) Heartbeat(ctx context.Context, job Job, consumer string) (err error) {
+	_, err = q.client.do(ctx, commandTimeout, "XCLAIM", q.stream, q.group, consumer, "0", job.ID, "JUSTID")
+	if err != nil {
+		err = fmt.Errorf("failed to extend job %s: %w", job.ID, err)
+	}
+	return err
+}
+
+// Complete removes a finished job, so the repository can be queued again.
+func (q *Queue) Complete(ctx context.Context, job Job) (err error) {
+	err = q.remove(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.client.do(ctx, commandTimeout, "DEL", q.pendingKey(job.Repo))
+	if err != nil {
+		err = fmt.Errorf("failed to complete job %s: %w", job.ID, err)
+		return err
+	}
+
+	q.metrics.QueueJobs.WithLabelValues(resultCompleted).Inc()
+	return err
+}
+
+// Fail queues a failed job for another attempt, or drops it once
+// QUEUE_MAX_ATTEMPTS attempts have failed. retrying reports which.
+func (q *Queue) Fail(ctx context.Context, job Job, cause error) (retrying bool, err error) {
+	if job.Attempt < q.maxAttempts {
+		// Queue the retry before removing the failed entry, so a crash in
+		// between repeats the job rather than loses it.
+		err = q.add(ctx, job.Repo, job.Attempt+1)
+		if err != nil {
+			err = fmt.Errorf("failed to retry job %s: %w", job.ID, err)
+			return retrying, err
+		}
+		retrying = true
+		q.metrics.QueueJobs.WithLabelValues(resultRetried).Inc()
+		q.logger.Warn("Index job failed, retrying", "repo", job.Repo, "attempt", job.Attempt, "max_attempts", q.maxAttempts, "error", cause)
+	} else {
+		_, err = q.client.do(ctx, commandTimeout, "DEL", q.pendingKey(job.Repo))
+		if err != nil {
+			err = fmt.Errorf("failed to drop job %s: %w", job.ID, err)
+			return retrying, err
+		}
+		q.metrics.QueueJobs.WithLabelValues(resultFailed).Inc()
+		q.logger.Error("Index job failed, giving up", "repo", job.Repo, "attempts", job.Attempt, "error", cause)
+	}
+
+	err = q.remove(ctx, job)
+	return retrying, err
+}
+
+// Release hands a job back unfinished, without counting the attempt, for a
+// worker that is shutting down.
+func (q *Queue) Release(ctx context.Context, job Job) (err error) {
+	err = q.add(ctx, job.Repo, job.Attempt)
+	if err != nil {
+		err = fmt.Errorf("failed to release job %s: %w", job.ID, err)
+		return err
+	}
+
+	q.metrics.QueueJobs.WithLabelValues(resultReleased).Inc()
+	err = q.remove(ctx, job)
+	return err
+}
+
+// remove acknowledges a job's entry and deletes it from the stream.
+func (q *Queue) remove(ctx context.Context, job Job) (err error) {
+	_, err = q.client.do(ctx, commandTimeout, "XACK", q.stream, q.group, job.ID)
+	if err == nil {
+		_, err = q.client.do(ctx, commandTimeout, "XDEL", q.stream, job.ID)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to remove job %s: %w", job.ID, err)
+	}
+	return err
+}
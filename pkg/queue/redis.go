@@ -0,0 +1,275 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandTimeout bounds a Redis command that doesn't block server-side.
+const commandTimeout = 10 * time.Second
+
+// redisError is an error reply from Redis.
+type redisError string
+
+// Error returns the error reply's message.
+func (e redisError) Error() (msg string) {
+	msg = "redis: " + string(e)
+	return msg
+}
+
+// hasPrefix reports whether err is an error reply starting with code, such as
+// BUSYGROUP or NOGROUP.
+func hasPrefix(err error, code string) (matches bool) {
+	var replyErr redisError
+	matches = errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), code)
+	return matches
+}
+
+// redisClient speaks just enough RESP2 over one connection for the stream
+// commands the queue uses. Commands are serialized; a connection that fails
+// is dropped and redialled by the next command.
+type redisClient struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newRedisClient parses a redis:// or rediss:// URL, with optional
+// credentials and a database number as the path.
+func newRedisClient(rawURL string) (client *redisClient, err error) {
+	var u *url.URL
+	u, err = url.Parse(rawURL)
+	if err != nil {
+		err = fmt.Errorf("invalid queue URL: %w", err)
+		return client, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		err = fmt.Errorf("invalid queue URL scheme %q: use redis or rediss", u.Scheme)
+		return client, err
+	}
+
+	client = &redisClient{
+		addr:   u.Host,
+		useTLS: u.Scheme == "rediss",
+	}
+	if u.Port() == "" {
+		client.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		client.username = u.User.Username()
+		client.password, _ = u.User.Password()
+	}
+
+	db := strings.TrimPrefix(u.Path, "/")
+	if db != "" {
+		client.db, err = strconv.Atoi(db)
+		if err != nil {
+			err = fmt.Errorf("invalid queue URL database %q: %w", db, err)
+			return client, err
+		}
+	}
+
+	return client, err
+}
+
+// do sends a command and returns its reply: a string, an int64, nil, or a
+// []any of those. An error reply is returned as a redisError. The
+// connection's deadline is the earlier of ctx's and timeout from now.
+func (c *redisClient) do(ctx context.Context, timeout time.Duration, args ...string) (reply any, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		err = c.dial(ctx)
+		if err != nil {
+			return reply, err
+		}
+	}
+
+	reply, err = c.roundTrip(ctx, timeout, args)
+
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.closeConn()
+		if ctx.Err() != nil {
+			err = fmt.Errorf("redis %s: %w", args[0], ctx.Err())
+			return reply, err
+		}
+		err = fmt.Errorf("redis %s: %w", args[0], err)
+	}
+	return reply, err
+}
+
+// dial connects and authenticates. The caller holds c.mu.
+func (c *redisClient) dial(ctx context.Context) (err error) {
+	dialer := &net.Dialer{Timeout: commandTimeout}
+
+	var conn net.Conn
+	if c.useTLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{MinVersion: tls.VersionTLS12}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to connect to redis at %s: %w", c.addr, err)
+		return err
+	}
+
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		_, err = c.roundTrip(ctx, commandTimeout, args)
+		if err != nil {
+			c.closeConn()
+			err = fmt.Errorf("redis authentication failed: %w", err)
+			return err
+		}
+	}
+
+	if c.db != 0 {
+		_, err = c.roundTrip(ctx, commandTimeout, []string{"SELECT", strconv.Itoa(c.db)})
+		if err != nil {
+			c.closeConn()
+			err = fmt.Errorf("failed to select redis database %d: %w", c.db, err)
+			return err
+		}
+	}
+
+	return err
+}
+
+// roundTrip writes one command and reads its reply. The caller holds c.mu.
+func (c *redisClient) roundTrip(ctx context.Context, timeout time.Duration, args []string) (reply any, err error) {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	err = c.conn.SetDeadline(deadline)
+	if err != nil {
+		return reply, err
+	}
+
+	// Unblock the read when ctx is cancelled.
+	conn := c.conn
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	_, err = c.conn.Write(encodeCommand(args))
+	if err != nil {
+		return reply, err
+	}
+
+	reply, err = readReply(c.reader)
+	return reply, err
+}
+
+// closeConn drops the connection. The caller holds c.mu.
+func (c *redisClient) closeConn() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.conn = nil
+	c.reader = nil
+}
+
+// Close closes the connection.
+func (c *redisClient) Close() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closeConn()
+	return err
+}
+
+// encodeCommand encodes a command as a RESP array of bulk strings.
+func encodeCommand(args []string) (encoded []byte) {
+	encoded = fmt.Appendf(encoded, "*%d\r\n", len(args))
+	for _, arg := range args {
+		encoded = fmt.Appendf(encoded, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return encoded
+}
+
+// readReply reads one RESP2 reply.
+func readReply(reader *bufio.Reader) (reply any, err error) {
+	var line string
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		return reply, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		err = fmt.Errorf("malformed redis reply %q", line)
+		return reply, err
+	}
+
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		reply = body
+	case '-':
+		err = redisError(body)
+	case ':':
+		reply, err = strconv.ParseInt(body, 10, 64)
+	case '$':
+		var size int
+		size, err = strconv.Atoi(body)
+		if err != nil || size < 0 {
+			return reply, err
+		}
+		data := make([]byte, size+2)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return reply, err
+		}
+		reply = string(data[:size])
+	case '*':
+		var count int
+		count, err = strconv.Atoi(body)
+		if err != nil || count < 0 {
+			return reply, err
+		}
+		// Read the whole array even past an error reply in it, so the
+		// connection stays in step.
+		items := make([]any, count)
+		for i := range items {
+			var itemErr error
+			items[i], itemErr = readReply(reader)
+			var replyErr redisError
+			if itemErr != nil && !errors.As(itemErr, &replyErr) {
+				err = itemErr
+				return reply, err
+			}
+			if err == nil {
+				err = itemErr
+			}
+		}
+		reply = items
+	default:
+		err = fmt.Errorf("unknown redis reply type %q", kind)
+	}
+	return reply, err
+}
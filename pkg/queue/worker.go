@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// claimBlock is how long a worker waits for a job per claim, which bounds
+// how long it takes to notice shutdown.
+const claimBlock = 5 * time.Second
+
+// retryBackoff is how long a worker waits after failing to claim a job
+// before trying again.
+const retryBackoff = 5 * time.Second
+
+// Indexer indexes the repository of a job.
+type Indexer interface {
+	// UpdateAndIndexRepo fetches or clones the repository and indexes it.
+	UpdateAndIndexRepo(ctx context.Context, repo string) (count int, err error)
+	// Draining reports whether the process is shutting down.
+	Draining() (draining bool)
+}
+
+// RunWorker indexes jobs one at a time as consumer until ctx ends or idx
+// starts draining. The job being indexed is heartbeated so it isn't
+// reclaimed, and is handed back if shutdown cuts it short.
+func (q *Queue) RunWorker(ctx context.Context, idx Indexer, consumer string) {
+	q.logger.Info("Starting queue worker", "consumer", consumer, "stream", q.stream, "group", q.group)
+
+	for ctx.Err() == nil && !idx.Draining() {
+		job, found, err := q.Claim(ctx, consumer, claimBlock)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			q.logger.Error("Failed to claim job", "error", err)
+			sleep(ctx, retryBackoff)
+			continue
+		}
+		if !found {
+			continue
+		}
+
+		q.process(ctx, idx, consumer, job)
+	}
+
+	q.logger.Info("Queue worker stopped", "consumer", consumer)
+}
+
+// process indexes a claimed job's repository and records the outcome.
+func (q *Queue) process(ctx context.Context, idx Indexer, consumer string, job Job) {
+	// Bookkeeping goes through even when ctx was cancelled mid-job.
+	recordCtx := context.WithoutCancel(ctx)
+
+	if idx.Draining() {
+		q.release(recordCtx, job)
+		return
+	}
+
+	q.logger.Info("Indexing queued repository", "repo", job.Repo, "attempt", job.Attempt)
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	go q.heartbeat(heartbeatCtx, job, consumer)
+	count, err := idx.UpdateAndIndexRepo(ctx, job.Repo)
+	stopHeartbeat()
+
+	switch {
+	case err == nil:
+		q.logger.Info("Indexed queued repository", "repo", job.Repo, "functions", count)
+		completeErr := q.Complete(recordCtx, job)
+		if completeErr != nil {
+			q.logger.Error("Failed to complete job", "repo", job.Repo, "error", completeErr)
+		}
+	case ctx.Err() != nil || idx.Draining():
+		q.release(recordCtx, job)
+	default:
+		_, failErr := q.Fail(recordCtx, job, err)
+		if failErr != nil {
+			q.logger.Error("Failed to record job failure", "repo", job.Repo, "error", failErr)
+		}
+	}
+}
+
+// release hands a job back for another worker, logging any failure; the
+// job is reclaimed after the visibility timeout regardless.
+func (q *Queue) release(ctx context.Context, job Job) {
+	err := q.Release(ctx, job)
+	if err != nil {
+		q.logger.Warn("Failed to release job", "repo", job.Repo, "error", err)
+		return
+	}
+	q.logger.Info("Shutting down, released job", "repo", job.Repo)
+}
+
+// heartbeat extends the job's claim a few times per visibility timeout
+// until ctx ends.
+func (q *Queue) heartbeat(ctx context.Context, job Job, consumer string) {
+	ticker := time.NewTicker(q.visibility / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := q.Heartbeat(ctx, job, consumer)
+			if err != nil && ctx.Err() == nil {
+				q.logger.Warn("Failed to heartbeat job", "repo", job.Repo, "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunCoordinator enqueues every repository repos returns now and then every
+// interval until ctx ends, asking for the list on each tick so repositories
+// discovered since are picked up. Ticks are skipped while paused reports
+// true.
+func (q *Queue) RunCoordinator(ctx context.Context, repos func(ctx context.Context) (repos []string), interval time.Duration, paused func() (paused bool)) {
+	q.logger.Info("Starting queue coordinator", "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if paused() {
+			q.logger.Info("Indexing paused, not enqueueing repositories")
+		} else {
+			q.enqueueAll(ctx, repos(ctx))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			q.logger.Info("Queue coordinator stopped")
+			return
+		}
+	}
+}
+
+// enqueueAll enqueues each repository, logging failures.
+func (q *Queue) enqueueAll(ctx context.Context, repos []string) {
+	var enqueued, alreadyQueued int
+	for _, repo := range repos {
+		added, err := q.Enqueue(ctx, repo)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			q.logger.Error("Failed to enqueue repository", "repo", repo, "error", err)
+			continue
+		}
+		if added {
+			enqueued++
+		} else {
+			alreadyQueued++
+		}
+	}
+	q.logger.Info("Enqueued repositories", "enqueued", enqueued, "already_queued", alreadyQueued)
+}
+
+// sleep waits for d or until ctx ends.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,174 @@
+// Package rerank reorders search results with a cross-encoder reranking API:
+// Cohere's (also served by Jina), Voyage AI's, or Hugging Face Text
+// Embeddings Inference for models hosted locally.
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// ErrNotConfigured is returned when reranking is requested without RERANK_URL.
+var ErrNotConfigured = errors.New("RERANK_URL must be set for reranking")
+
+// Client scores documents against a query with a reranking API.
+type Client struct {
+	url    string
+	api    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+// hostedRequest is the request body of the Cohere and Voyage APIs, which
+// differ only in the name of the result count.
+type hostedRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+	TopK      int      `json:"top_k,omitempty"`
+}
+
+// teiRequest is the request body of the Text Embeddings Inference API.
+type teiRequest struct {
+	Query    string   `json:"query"`
+	Texts    []string `json:"texts"`
+	Truncate bool     `json:"truncate"`
+}
+
+// score is one document's relevance in any of the APIs' responses.
+type score struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+	Score          float64 `json:"score"`
+}
+
+// hostedResponse is the subset of the Cohere and Voyage responses used here.
+type hostedResponse struct {
+	Results []score `json:"results"`
+	Data    []score `json:"data"`
+}
+
+// New creates a reranking client from cfg. It returns ErrNotConfigured when
+// no endpoint is set.
+func New(cfg config.Config) (client *Client, err error) {
+	if cfg.RerankURL == "" {
+		err = ErrNotConfigured
+		return client, err
+	}
+
+	client = &Client{
+		url:    cfg.RerankURL,
+		api:    cfg.RerankAPI,
+		model:  cfg.RerankModel,
+		apiKey: cfg.RerankAPIKey,
+		client: &http.Client{
+			Timeout: cfg.RerankTimeout,
+		},
+	}
+	return client, err
+}
+
+// Rerank returns the relevance of each document to query, in document order.
+func (c *Client) Rerank(ctx context.Context, query string, documents []string) (scores []float64, err error) {
+	var payload any
+	switch c.api {
+	case config.RerankAPITEI:
+		payload = teiRequest{Query: query, Texts: documents, Truncate: true}
+	case config.RerankAPIVoyage:
+		payload = hostedRequest{Model: c.model, Query: query, Documents: documents, TopK: len(documents)}
+	default:
+		payload = hostedRequest{Model: c.model, Query: query, Documents: documents, TopN: len(documents)}
+	}
+
+	var data []byte
+	data, err = json.Marshal(payload)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal rerank request: %w", err)
+		return scores, err
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("failed to create rerank request: %w", err)
+		return scores, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	var resp *http.Response
+	resp, err = c.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to request reranking: %w", err)
+		return scores, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("rerank API returned status %d: %s", resp.StatusCode, body)
+		return scores, err
+	}
+
+	var results []score
+	results, err = c.decode(resp.Body)
+	if err != nil {
+		return scores, err
+	}
+
+	if len(results) != len(documents) {
+		err = fmt.Errorf("rerank API returned %d scores for %d documents", len(results), len(documents))
+		return scores, err
+	}
+
+	scores = make([]float64, len(documents))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			err = fmt.Errorf("rerank API returned out-of-range index %d", result.Index)
+			return scores, err
+		}
+		scores[result.Index] = result.RelevanceScore
+		if c.api == config.RerankAPITEI {
+			scores[result.Index] = result.Score
+		}
+	}
+
+	return scores, err
+}
+
+// decode reads the scores from the API's response: a bare array from Text
+// Embeddings Inference, results from Cohere, data from Voyage.
+func (c *Client) decode(body io.Reader) (results []score, err error) {
+	if c.api == config.RerankAPITEI {
+		err = json.NewDecoder(body).Decode(&results)
+		if err != nil {
+			err = fmt.Errorf("failed to decode rerank response: %w", err)
+		}
+		return results, err
+	}
+
+	var parsed hostedResponse
+	err = json.NewDecoder(body).Decode(&parsed)
+	if err != nil {
+		err = fmt.Errorf("failed to decode rerank response: %w", err)
+		return results, err
+	}
+
+	results = parsed.Results
+	if c.api == config.RerankAPIVoyage {
+		results = parsed.Data
+	}
+	return results, err
+}
@@ -0,0 +1,118 @@
+package rerank
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestRerank(t *testing.T) {
+	tests := []struct {
+		name     string
+		api      string
+		response string
+		wantBody map[string]any
+	}{
+		{
+			name:     "cohere",
+			api:      config.RerankAPICohere,
+			response: `{"results":[{"index":1,"relevance_score":0.9},{"index":0,"relevance_score":0.2}]}`,
+			wantBody: map[string]any{"model": "rerank-v3", "top_n": float64(2)},
+		},
+		{
+			name:     "voyage",
+			api:      config.RerankAPIVoyage,
+			response: `{"data":[{"index":1,"relevance_score":0.9},{"index":0,"relevance_score":0.2}]}`,
+			wantBody: map[string]any{"model": "rerank-v3", "top_k": float64(2)},
+		},
+		{
+			name:     "text embeddings inference",
+			api:      config.RerankAPITEI,
+			response: `[{"index":1,"score":0.9},{"index":0,"score":0.2}]`,
+			wantBody: map[string]any{"truncate": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAuth string
+			var gotBody map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = r.Header.Get("Authorization")
+				_ = json.NewDecoder(r.Body).Decode(&gotBody)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			client, err := New(config.Config{RerankURL: srv.URL, RerankAPI: tt.api, RerankModel: "rerank-v3", RerankAPIKey: "key", RerankTimeout: time.Second})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			scores, err := client.Rerank(t.Context(), "retry", []string{"first", "second"})
+			if err != nil {
+				t.Fatalf("Rerank() error = %v", err)
+			}
+
+			if len(scores) != 2 || scores[0] != 0.2 || scores[1] != 0.9 {
+				t.Errorf("Rerank() = %v, want scores in document order", scores)
+			}
+			if gotAuth != "Bearer key" {
+				t.Errorf("Authorization = %q, want bearer API key", gotAuth)
+			}
+			if gotBody["query"] != "retry" {
+				t.Errorf("query = %v, want retry", gotBody["query"])
+			}
+			for key, want := range tt.wantBody {
+				if gotBody[key] != want {
+					t.Errorf("%s = %v, want %v", key, gotBody[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRerankErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: `{"message":"boom"}`},
+		{name: "count mismatch", status: http.StatusOK, body: `{"results":[{"index":0,"relevance_score":0.5}]}`},
+		{name: "index out of range", status: http.StatusOK, body: `{"results":[{"index":0,"relevance_score":0.5},{"index":7,"relevance_score":0.1}]}`},
+		{name: "not json", status: http.StatusOK, body: `ok`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			client, err := New(config.Config{RerankURL: srv.URL, RerankAPI: config.RerankAPICohere, RerankModel: "m", RerankTimeout: time.Second})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = client.Rerank(t.Context(), "retry", []string{"first", "second"})
+			if err == nil {
+				t.Error("Rerank() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNewNotConfigured(t *testing.T) {
+	_, err := New(config.Config{})
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("New() error = %v, want %v", err, ErrNotConfigured)
+	}
+}
@@ -0,0 +1,174 @@
+// Package rewrite expands natural-language searches into keyword searches
+// with a language model behind an OpenAI-compatible chat completions API, as
+// served by OpenAI, Ollama, vLLM, and LocalAI.
+package rewrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// ErrNotConfigured is returned when rewriting is requested without REWRITE_URL.
+var ErrNotConfigured = errors.New("REWRITE_URL and REWRITE_MODEL must be set for query rewriting")
+
+// instructions tells the model how to rewrite a query; %d is the most
+// queries it may return.
+const instructions = `You turn natural-language searches over an index of source code into keyword searches.
+Reply with only a JSON object of the form {"queries": ["..."]}, holding at most %d short keyword queries.
+Each query lists identifiers, API and package names, and terms likely to appear in matching code,
+e.g. "functions that retry HTTP calls" becomes {"queries": ["retry backoff", "http.Client Do retry"]}.`
+
+// Client rewrites queries with a chat completions API.
+type Client struct {
+	url        string
+	model      string
+	apiKey     string
+	maxQueries int
+	client     *http.Client
+}
+
+// chatMessage is one message of a chat completions conversation.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest is the request body of the chat completions API.
+type chatRequest struct {
+	Model          string            `json:"model"`
+	Messages       []chatMessage     `json:"messages"`
+	Temperature    float64           `json:"temperature"`
+	ResponseFormat map[string]string `json:"response_format"`
+}
+
+// chatResponse is the subset of the chat completions response used here.
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// rewritten is the JSON object the model is asked to reply with.
+type rewritten struct {
+	Queries []string `json:"queries"`
+}
+
+// New creates a rewriting client from cfg. It returns ErrNotConfigured when
+// no endpoint or model is set.
+func New(cfg config.Config) (client *Client, err error) {
+	if cfg.RewriteURL == "" || cfg.RewriteModel == "" {
+		err = ErrNotConfigured
+		return client, err
+	}
+
+	client = &Client{
+		url:        cfg.RewriteURL,
+		model:      cfg.RewriteModel,
+		apiKey:     cfg.RewriteAPIKey,
+		maxQueries: max(cfg.RewriteMaxQueries, 1),
+		client: &http.Client{
+			Timeout: cfg.RewriteTimeout,
+		},
+	}
+	return client, err
+}
+
+// Rewrite returns up to REWRITE_MAX_QUERIES keyword queries for query,
+// without blanks, repeats, or the query itself.
+func (c *Client) Rewrite(ctx context.Context, query string) (queries []string, err error) {
+	var data []byte
+	data, err = json.Marshal(chatRequest{
+		Model: c.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: fmt.Sprintf(instructions, c.maxQueries)},
+			{Role: "user", Content: query},
+		},
+		ResponseFormat: map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to marshal rewrite request: %w", err)
+		return queries, err
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("failed to create rewrite request: %w", err)
+		return queries, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	var resp *http.Response
+	resp, err = c.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to request rewrite: %w", err)
+		return queries, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("rewrite API returned status %d: %s", resp.StatusCode, body)
+		return queries, err
+	}
+
+	var parsed chatResponse
+	err = json.NewDecoder(resp.Body).Decode(&parsed)
+	if err != nil {
+		err = fmt.Errorf("failed to decode rewrite response: %w", err)
+		return queries, err
+	}
+	if len(parsed.Choices) == 0 {
+		err = errors.New("rewrite API returned no choices")
+		return queries, err
+	}
+
+	var reply rewritten
+	err = json.Unmarshal([]byte(stripCodeFence(parsed.Choices[0].Message.Content)), &reply)
+	if err != nil {
+		err = fmt.Errorf("rewrite model did not reply with JSON: %w", err)
+		return queries, err
+	}
+
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	for _, candidate := range reply.Queries {
+		candidate = strings.TrimSpace(candidate)
+		key := strings.ToLower(candidate)
+		if candidate == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		queries = append(queries, candidate)
+		if len(queries) == c.maxQueries {
+			break
+		}
+	}
+	return queries, err
+}
+
+// stripCodeFence returns content without the Markdown code fence models
+// often wrap JSON in despite being told not to.
+func stripCodeFence(content string) (stripped string) {
+	stripped = strings.TrimSpace(content)
+	if !strings.HasPrefix(stripped, "```") {
+		return stripped
+	}
+
+	stripped = strings.TrimPrefix(stripped, "```")
+	stripped = strings.TrimPrefix(stripped, "json")
+	stripped = strings.TrimSuffix(strings.TrimSpace(stripped), "```")
+	stripped = strings.TrimSpace(stripped)
+	return stripped
+}
@@ -0,0 +1,88 @@
+package rewrite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(config.Config{})
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("New() error = %v, want ErrNotConfigured", err)
+	}
+
+	_, err = New(config.Config{RewriteURL: "http://localhost:11434/v1/chat/completions", RewriteModel: "llama3.2"})
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{name: "queries", status: http.StatusOK, content: `{"queries": ["retry backoff", "http.Client Do"]}`, want: []string{"retry backoff", "http.Client Do"}},
+		{name: "blanks, repeats and the original dropped", status: http.StatusOK, content: `{"queries": [" ", "Retry HTTP", "retry backoff", "RETRY BACKOFF"]}`, want: []string{"retry backoff"}},
+		{name: "limited", status: http.StatusOK, content: `{"queries": ["a", "b", "c", "d"]}`, want: []string{"a", "b"}},
+		{name: "code fence", status: http.StatusOK, content: "```json\n{\"queries\": [\"retry\"]}\n```", want: []string{"retry"}},
+		{name: "not JSON", status: http.StatusOK, content: "retry backoff", wantErr: true},
+		{name: "API error", status: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got chatRequest
+			var auth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				_ = json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"choices": []map[string]interface{}{{"message": chatMessage{Role: "assistant", Content: tt.content}}},
+				})
+			}))
+			defer server.Close()
+
+			client, err := New(config.Config{
+				RewriteURL:        server.URL,
+				RewriteModel:      "gpt-4o-mini",
+				RewriteAPIKey:     "secret",
+				RewriteTimeout:    time.Second,
+				RewriteMaxQueries: 2,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			queries, err := client.Rewrite(context.Background(), "retry HTTP")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rewrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(queries, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Rewrite() = %q, want %q", queries, tt.want)
+			}
+
+			if auth != "Bearer secret" {
+				t.Errorf("Authorization = %q, want the API key", auth)
+			}
+			if got.Model != "gpt-4o-mini" || len(got.Messages) != 2 || got.Messages[1].Content != "retry HTTP" {
+				t.Errorf("request = %+v, want the model and the query as the user message", got)
+			}
+			if !strings.Contains(got.Messages[0].Content, "at most 2") {
+				t.Errorf("instructions = %q, want the query limit", got.Messages[0].Content)
+			}
+		})
+	}
+}
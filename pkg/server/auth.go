@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+var (
+	errMissingCredentials = errors.New("missing credentials")
+	errInvalidCredentials = errors.New("invalid credentials")
+)
+
+// authenticator validates static API keys and JWT bearer tokens.
+// When neither is configured, all requests are allowed. Admin keys are also
+// valid API keys and additionally unlock debug options.
+type authenticator struct {
+	apiKeys   [][]byte
+	adminKeys [][]byte
+	jwt       *jwtVerifier
+}
+
+// newAuthenticator builds an authenticator from the API key and JWT configuration.
+func newAuthenticator(cfg config.Config) (auth *authenticator) {
+	auth = &authenticator{}
+
+	for _, key := range cfg.APIKeys {
+		auth.apiKeys = append(auth.apiKeys, []byte(key))
+	}
+
+	for _, key := range cfg.AdminAPIKeys {
+		auth.apiKeys = append(auth.apiKeys, []byte(key))
+		auth.adminKeys = append(auth.adminKeys, []byte(key))
+	}
+
+	if cfg.JWTJWKSURL != "" {
+		auth.jwt = newJWTVerifier(cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTJWKSURL)
+	}
+
+	return auth
+}
+
+// enabled reports whether any authentication method is configured.
+func (a *authenticator) enabled() (enabled bool) {
+	enabled = len(a.apiKeys) > 0 || a.jwt != nil
+	return enabled
+}
+
+// authenticate checks the request for a valid API key or bearer token.
+// API keys are accepted in the X-API-Key header or as a bearer token. The
+// returned principal names the verified caller: a hash of the API key, or of
+// the token's issuer and subject, so credentials aren't held in memory beyond
+// the request.
+func (a *authenticator) authenticate(r *http.Request) (principal string, err error) {
+	apiKey := r.Header.Get("X-Api-Key")
+	if apiKey != "" {
+		if !a.validAPIKey(apiKey) {
+			err = errInvalidCredentials
+			return principal, err
+		}
+		principal = hashedPrincipal("key", apiKey)
+		return principal, err
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	token, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || token == "" {
+		err = errMissingCredentials
+		return principal, err
+	}
+
+	if a.validAPIKey(token) {
+		principal = hashedPrincipal("key", token)
+		return principal, err
+	}
+
+	if a.jwt == nil {
+		err = errInvalidCredentials
+		return principal, err
+	}
+
+	claims, verifyErr := a.jwt.verify(r.Context(), token)
+	if verifyErr != nil {
+		err = verifyErr
+		return principal, err
+	}
+
+	subject := claims.Issuer + "\x00" + claims.Subject
+	if claims.Subject == "" {
+		subject = token
+	}
+	principal = hashedPrincipal("jwt", subject)
+	return principal, err
+}
+
+// hashedPrincipal names a verified caller by a short hash of its identity.
+func hashedPrincipal(kind string, identity string) (principal string) {
+	sum := sha256.Sum256([]byte(identity))
+	principal = kind + ":" + hex.EncodeToString(sum[:8])
+	return principal
+}
+
+// principalKey is the context key for the caller requireAuth verified.
+type principalKey struct{}
+
+// withPrincipal returns a copy of ctx carrying the verified caller.
+func withPrincipal(ctx context.Context, principal string) (derived context.Context) {
+	derived = context.WithValue(ctx, principalKey{}, principal)
+	return derived
+}
+
+// principalFrom returns the caller requireAuth verified for the request, or
+// an empty string when no credential was verified.
+func principalFrom(ctx context.Context) (principal string) {
+	principal, _ = ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// validAPIKey compares the key against each configured key in constant time.
+func (a *authenticator) validAPIKey(key string) (valid bool) {
+	valid = containsKey(a.apiKeys, key)
+	return valid
+}
+
+// admin reports whether the request carries an admin API key. With
+// authentication disabled every caller is treated as an admin.
+func (a *authenticator) admin(r *http.Request) (isAdmin bool) {
+	if a == nil || !a.enabled() {
+		isAdmin = true
+		return isAdmin
+	}
+
+	key := r.Header.Get("X-Api-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	isAdmin = key != "" && containsKey(a.adminKeys, key)
+	return isAdmin
+}
+
+// containsKey compares the key against each candidate in constant time.
+func containsKey(candidates [][]byte, key string) (found bool) {
+	for _, candidate := range candidates {
+		if subtle.ConstantTimeCompare(candidate, []byte(key)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+// requireAuth wraps a handler so that it is only reachable with valid credentials.
+func (s *Server) requireAuth(next http.HandlerFunc) (handler http.HandlerFunc) {
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil || !s.auth.enabled() {
+			next(w, r)
+			return
+		}
+
+		principal, authErr := s.auth.authenticate(r)
+		if authErr != nil {
+			s.logger.WarnContext(r.Context(), "Authentication failed", "path", r.URL.Path, "remote", r.RemoteAddr, "error", authErr)
+			w.Header().Set("Www-Authenticate", `Bearer realm="rag-indexer"`)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+			return
+		}
+
+		next(w, r.WithContext(withPrincipal(r.Context(), principal)))
+	}
+	return handler
+}
@@ -0,0 +1,385 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestRequireAuthAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		headers map[string]string
+		want    int
+	}{
+		{
+			name:    "auth disabled",
+			keys:    nil,
+			headers: map[string]string{},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "missing credentials",
+			keys:    []string{"secret"},
+			headers: map[string]string{},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "valid X-API-Key",
+			keys:    []string{"other", "secret"},
+			headers: map[string]string{"X-API-Key": "secret"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "invalid X-API-Key",
+			keys:    []string{"secret"},
+			headers: map[string]string{"X-API-Key": "wrong"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "valid bearer API key",
+			keys:    []string{"secret"},
+			headers: map[string]string{"Authorization": "Bearer secret"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "invalid bearer API key",
+			keys:    []string{"secret"},
+			headers: map[string]string{"Authorization": "Bearer wrong"},
+			want:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &Server{
+				logger: &mockLogger{},
+				auth:   newAuthenticator(config.Config{APIKeys: tt.keys}),
+			}
+
+			handler := server.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/search", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		headers map[string]string
+		want    bool
+	}{
+		{
+			name:    "auth disabled",
+			cfg:     config.Config{},
+			headers: map[string]string{},
+			want:    true,
+		},
+		{
+			name:    "regular key",
+			cfg:     config.Config{APIKeys: []string{"user"}, AdminAPIKeys: []string{"admin"}},
+			headers: map[string]string{"X-API-Key": "user"},
+			want:    false,
+		},
+		{
+			name:    "admin key header",
+			cfg:     config.Config{APIKeys: []string{"user"}, AdminAPIKeys: []string{"admin"}},
+			headers: map[string]string{"X-API-Key": "admin"},
+			want:    true,
+		},
+		{
+			name:    "admin key bearer",
+			cfg:     config.Config{AdminAPIKeys: []string{"admin"}},
+			headers: map[string]string{"Authorization": "Bearer admin"},
+			want:    true,
+		},
+		{
+			name:    "no credentials",
+			cfg:     config.Config{AdminAPIKeys: []string{"admin"}},
+			headers: map[string]string{},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newAuthenticator(tt.cfg)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/search", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			if auth.admin(req) != tt.want {
+				t.Errorf("admin() = %v, want %v", !tt.want, tt.want)
+			}
+
+			// Admin keys must also pass regular authentication.
+			if tt.want && auth.enabled() {
+				if _, authErr := auth.authenticate(req); authErr != nil {
+					t.Error("authenticate() rejected an admin key")
+				}
+			}
+		})
+	}
+}
+
+func TestRequireAuthJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set := jsonWebKeySet{Keys: []jsonWebKey{{
+			KeyType: "RSA",
+			KeyID:   "test-key",
+			N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer jwks.Close()
+
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		want   int
+	}{
+		{
+			name:   "valid token",
+			claims: map[string]any{"iss": "https://issuer", "aud": "rag-indexer", "exp": now.Add(time.Hour).Unix()},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "audience array",
+			claims: map[string]any{"iss": "https://issuer", "aud": []string{"other", "rag-indexer"}, "exp": now.Add(time.Hour).Unix()},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "expired token",
+			claims: map[string]any{"iss": "https://issuer", "aud": "rag-indexer", "exp": now.Add(-time.Hour).Unix()},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "missing expiry",
+			claims: map[string]any{"iss": "https://issuer", "aud": "rag-indexer"},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong issuer",
+			claims: map[string]any{"iss": "https://evil", "aud": "rag-indexer", "exp": now.Add(time.Hour).Unix()},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong audience",
+			claims: map[string]any{"iss": "https://issuer", "aud": "other", "exp": now.Add(time.Hour).Unix()},
+			want:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				JWTIssuer:   "https://issuer",
+				JWTAudience: "rag-indexer",
+				JWTJWKSURL:  jwks.URL,
+			}
+			server := &Server{
+				logger: &mockLogger{},
+				auth:   newAuthenticator(cfg),
+			}
+
+			handler := server.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/search", nil)
+			req.Header.Set("Authorization", "Bearer "+signTestToken(t, key, "test-key", tt.claims))
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate P-256 key: %v", err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate P-384 key: %v", err)
+	}
+
+	signed := []byte("header.payload")
+	digest256 := sha256.Sum256(signed)
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest256[:])
+	if err != nil {
+		t.Fatalf("Failed to sign with RSA: %v", err)
+	}
+	digest384 := sha512.Sum384(signed)
+
+	tests := []struct {
+		name      string
+		alg       string
+		key       crypto.PublicKey
+		signature []byte
+		want      error
+	}{
+		{
+			name:      "RS256 with an RSA key",
+			alg:       "RS256",
+			key:       &rsaKey.PublicKey,
+			signature: rsaSignature,
+			want:      nil,
+		},
+		{
+			name:      "ES256 with a P-256 key",
+			alg:       "ES256",
+			key:       &p256Key.PublicKey,
+			signature: signECDSA(t, p256Key, digest256[:]),
+			want:      nil,
+		},
+		{
+			name:      "ES384 with a P-384 key",
+			alg:       "ES384",
+			key:       &p384Key.PublicKey,
+			signature: signECDSA(t, p384Key, digest384[:]),
+			want:      nil,
+		},
+		{
+			name:      "ES256 with an RSA key",
+			alg:       "ES256",
+			key:       &rsaKey.PublicKey,
+			signature: rsaSignature,
+			want:      errUnsupportedAlgorithm,
+		},
+		{
+			name:      "RS256 with a P-256 key",
+			alg:       "RS256",
+			key:       &p256Key.PublicKey,
+			signature: signECDSA(t, p256Key, digest256[:]),
+			want:      errUnsupportedAlgorithm,
+		},
+		{
+			name:      "ES384 with a P-256 key",
+			alg:       "ES384",
+			key:       &p256Key.PublicKey,
+			signature: signECDSA(t, p256Key, digest384[:]),
+			want:      errUnsupportedAlgorithm,
+		},
+		{
+			name:      "ES256 with a P-384 key",
+			alg:       "ES256",
+			key:       &p384Key.PublicKey,
+			signature: signECDSA(t, p384Key, digest256[:]),
+			want:      errUnsupportedAlgorithm,
+		},
+		{
+			name:      "unsigned",
+			alg:       "none",
+			key:       &rsaKey.PublicKey,
+			signature: nil,
+			want:      errUnsupportedAlgorithm,
+		},
+		{
+			name:      "tampered signature",
+			alg:       "RS256",
+			key:       &rsaKey.PublicKey,
+			signature: append([]byte{rsaSignature[0] ^ 1}, rsaSignature[1:]...),
+			want:      errInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := verifySignature(tt.alg, tt.key, signed, tt.signature)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("verifySignature() error = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// signECDSA signs the digest in the JWS form: r and s as fixed-size
+// big-endian integers, one after the other.
+func signECDSA(t *testing.T, key *ecdsa.PrivateKey, digest []byte) (signature []byte) {
+	t.Helper()
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatalf("Failed to sign with ECDSA: %v", err)
+	}
+
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature = make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, keyID string, claims map[string]any) (token string) {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		t.Fatalf("Failed to marshal header: %v", err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to marshal claims: %v", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	token = signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return token
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipMinBytes is the smallest response worth compressing.
+const gzipMinBytes = 1024
+
+// compressResponses gzips responses for clients that send Accept-Encoding:
+// gzip, when HTTP_COMPRESSION is on. Responses shorter than gzipMinBytes,
+// bodiless ones, and those already encoded are sent as they are. /metrics
+// negotiates its own compression.
+func (s *Server) compressResponses(next http.Handler) (handler http.Handler) {
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.config.HTTPCompression || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(gw, r)
+		gw.finish()
+	})
+	return handler
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) (accepts bool) {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+			if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+				accepts = true
+				return accepts
+			}
+		}
+	}
+	return accepts
+}
+
+// gzipResponseWriter holds back the start of a response until it knows
+// whether the response is large enough to compress, then either gzips it or
+// passes it through unchanged.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	status  int
+	started bool
+	decided bool
+	buf     bytes.Buffer
+	zw      *gzip.Writer
+}
+
+// WriteHeader records the status; it is sent with the first body bytes.
+// Statuses without a body are passed straight through.
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.started {
+		return
+	}
+	g.started = true
+	g.status = status
+
+	if status == http.StatusNoContent || status == http.StatusNotModified || status < http.StatusOK {
+		g.decide(false)
+	}
+}
+
+// Write buffers the response until gzipMinBytes have been written, then
+// compresses it.
+func (g *gzipResponseWriter) Write(data []byte) (n int, err error) {
+	g.started = true
+	if !g.decided {
+		n, _ = g.buf.Write(data)
+		if g.buf.Len() < gzipMinBytes {
+			return n, err
+		}
+		g.decide(true)
+		return n, err
+	}
+
+	if g.zw != nil {
+		n, err = g.zw.Write(data)
+		return n, err
+	}
+	n, err = g.ResponseWriter.Write(data)
+	return n, err
+}
+
+// Flush sends what has been written so far, compressed, so streamed
+// responses aren't held back.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		g.decide(true)
+	}
+	if g.zw != nil {
+		_ = g.zw.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (g *gzipResponseWriter) Unwrap() (w http.ResponseWriter) {
+	w = g.ResponseWriter
+	return w
+}
+
+// decide sends the header, gzipped if compress is set and the handler didn't
+// encode the response itself, followed by anything buffered.
+func (g *gzipResponseWriter) decide(compress bool) {
+	g.decided = true
+
+	header := g.Header()
+	if header.Get("Content-Encoding") != "" {
+		compress = false
+	}
+	if compress {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(g.buf.Bytes()))
+		}
+		g.zw = gzip.NewWriter(g.ResponseWriter)
+	}
+
+	g.ResponseWriter.WriteHeader(g.status)
+	if g.buf.Len() == 0 {
+		return
+	}
+	if g.zw != nil {
+		_, _ = g.zw.Write(g.buf.Bytes())
+	} else {
+		_, _ = g.ResponseWriter.Write(g.buf.Bytes())
+	}
+	g.buf.Reset()
+}
+
+// finish sends a response too short to compress as it is, or ends the gzip
+// stream.
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		if !g.started {
+			return
+		}
+		g.decide(false)
+	}
+	if g.zw != nil {
+		_ = g.zw.Close()
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// ErrorCode identifies the kind of failure an API error response reports, so
+// clients can branch on it rather than on the message, which may change.
+type ErrorCode string
+
+// Error codes of API error responses.
+const (
+	// CodeInvalidRequest is a malformed body, a missing field, or an invalid
+	// parameter.
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	// CodeUnauthorized is a request without valid credentials.
+	CodeUnauthorized ErrorCode = "unauthorized"
+	// CodeClientCertRequired is a request without a trusted TLS client
+	// certificate under mutual TLS.
+	CodeClientCertRequired ErrorCode = "client_certificate_required"
+	// CodeForbidden is a request needing an admin API key.
+	CodeForbidden ErrorCode = "forbidden"
+	// CodeNotFound is a document, job, or repository that doesn't exist.
+	CodeNotFound ErrorCode = "not_found"
+	// CodeMethodNotAllowed is a method the endpoint doesn't support.
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	// CodeConflict is work already in progress, such as a reindex.
+	CodeConflict ErrorCode = "conflict"
+	// CodeRequestTooLarge is a body over MAX_REQUEST_BODY_KB.
+	CodeRequestTooLarge ErrorCode = "request_too_large"
+	// CodeRateLimited is a client over its rate limit.
+	CodeRateLimited ErrorCode = "rate_limited"
+	// CodeInternal is an unexpected failure of the server.
+	CodeInternal ErrorCode = "internal_error"
+	// CodeNotConfigured is a feature, such as embeddings, that isn't set up.
+	CodeNotConfigured ErrorCode = "not_configured"
+	// CodeUpstreamFailed is a failure of a service the server calls, such as
+	// the embedding endpoint.
+	CodeUpstreamFailed ErrorCode = "upstream_error"
+	// CodeUnavailable is Elasticsearch being unavailable; retry later.
+	CodeUnavailable ErrorCode = "unavailable"
+	// CodeTimeout is Elasticsearch timing out; retry later.
+	CodeTimeout ErrorCode = "timeout"
+	// CodeShuttingDown is a request refused while the server drains.
+	CodeShuttingDown ErrorCode = "shutting_down"
+)
+
+// apiError describes a failed request.
+type apiError struct {
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// errorResponse is the JSON body of every API error.
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// writeError writes an error response with status and a JSON body carrying
+// code, msg, and the request's ID.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: apiError{
+		Code:      code,
+		Message:   msg,
+		RequestID: logging.RequestID(r.Context()),
+	}})
+}
+
+// statusErrorCode is the error code for a failure reported with status.
+func statusErrorCode(status int) (code ErrorCode) {
+	switch status {
+	case http.StatusBadRequest:
+		code = CodeInvalidRequest
+	case http.StatusNotFound:
+		code = CodeNotFound
+	case http.StatusConflict:
+		code = CodeConflict
+	case http.StatusServiceUnavailable:
+		code = CodeUnavailable
+	case http.StatusGatewayTimeout:
+		code = CodeTimeout
+	default:
+		code = CodeInternal
+	}
+	return code
+}
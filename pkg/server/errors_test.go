@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// decodeError decodes an error response body, failing the test unless it is
+// the JSON error envelope.
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) (apiErr apiError) {
+	t.Helper()
+
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", w.Header().Get("Content-Type"))
+	}
+
+	var body errorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatalf("body = %q, want the error envelope: %v", w.Body.String(), err)
+	}
+	apiErr = body.Error
+	return apiErr
+}
+
+func TestErrorResponses(t *testing.T) {
+	s := &Server{
+		config: config.Config{ReposPath: t.TempDir()},
+		logger: logging.New(slog.New(slog.DiscardHandler)),
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			path:       "/api/v1/search",
+			handler:    s.handleSearch,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantCode:   CodeMethodNotAllowed,
+		},
+		{
+			name:       "missing query",
+			method:     http.MethodPost,
+			path:       "/api/v1/search",
+			body:       `{}`,
+			handler:    s.handleSearch,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidRequest,
+		},
+		{
+			name:       "similar without embeddings",
+			method:     http.MethodPost,
+			path:       "/api/v1/similar",
+			body:       `{"code":"func main() {}","mode":"vector"}`,
+			handler:    s.handleSimilar,
+			wantStatus: http.StatusNotImplemented,
+			wantCode:   CodeNotConfigured,
+		},
+		{
+			name:   "panic",
+			method: http.MethodGet,
+			path:   "/api/v1/stats",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {
+				panic("nil map")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(requestIDHeader, "trace-abc-123")
+			w := httptest.NewRecorder()
+
+			s.middleware(tt.handler).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			apiErr := decodeError(t, w)
+			if apiErr.Code != tt.wantCode || apiErr.Message == "" || apiErr.RequestID != "trace-abc-123" {
+				t.Errorf("error = %+v, want code %q with a message and the request ID", apiErr, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWriteESError(t *testing.T) {
+	tests := []struct {
+		err            error
+		wantStatus     int
+		wantCode       ErrorCode
+		wantRetryAfter string
+	}{
+		{err: elasticsearch.ErrBadRequest, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{err: elasticsearch.ErrUnavailable, wantStatus: http.StatusServiceUnavailable, wantCode: CodeUnavailable, wantRetryAfter: "5"},
+		{err: elasticsearch.ErrTimeout, wantStatus: http.StatusGatewayTimeout, wantCode: CodeTimeout, wantRetryAfter: "5"},
+		{err: fmt.Errorf("decode: %w", elasticsearch.ErrEncode), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.wantCode), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeESError(w, httptest.NewRequest(http.MethodPost, "/api/v1/search", nil), "Search failed", tt.err)
+
+			if w.Code != tt.wantStatus || w.Header().Get("Retry-After") != tt.wantRetryAfter {
+				t.Errorf("status = %d, Retry-After %q, want %d, %q", w.Code, w.Header().Get("Retry-After"), tt.wantStatus, tt.wantRetryAfter)
+			}
+			apiErr := decodeError(t, w)
+			if apiErr.Code != tt.wantCode || apiErr.Message != "Search failed" || apiErr.RequestID != "" {
+				t.Errorf("error = %+v, want %q Search failed without a request ID", apiErr, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// searchETag returns a weak ETag for the results of req against the index as
+// it is now, keyed on the request and the index generation. It returns ""
+// when the generation can't be read, so the response goes out without one.
+func (s *Server) searchETag(ctx context.Context, req elasticsearch.SearchRequest) (etag string) {
+	generation, err := s.es.IndexGeneration(ctx)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to read index generation, sending search without ETag", "error", err)
+		return etag
+	}
+
+	// Marshaling sorts map keys, so equal requests hash alike.
+	key, err := json.Marshal(req)
+	if err != nil {
+		return etag
+	}
+
+	sum := sha256.New()
+	sum.Write(key)
+	sum.Write([]byte{0})
+	sum.Write([]byte(generation))
+	etag = `W/"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+	return etag
+}
+
+// etagMatches reports whether an If-None-Match header names etag, using the
+// weak comparison If-None-Match calls for.
+func etagMatches(ifNoneMatch string, etag string) (matches bool) {
+	if ifNoneMatch == "" || etag == "" {
+		return matches
+	}
+
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == opaque {
+			matches = true
+			return matches
+		}
+	}
+	return matches
+}
+
+// writeNotModified answers a conditional request whose cached copy is still
+// current.
+func writeNotModified(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+)
+
+// eventKeepAlive is how often an idle event stream gets a comment, so
+// proxies don't close it between progress reports.
+const eventKeepAlive = 15 * time.Second
+
+// handleReindexEvents streams a reindex job's progress as server-sent events:
+// GET /api/v1/reindex/{id}/events. The stream opens with a job event holding
+// the job's status, sends a progress event each time a repository reports,
+// and ends with a job event holding its final status once the job finishes.
+// It outlasts HTTP_WRITE_TIMEOUT, staying open as long as the job runs or
+// until the server shuts down.
+func (s *Server) handleReindexEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.PathValue("id")
+	events, unsubscribe, found := s.indexer.JobEvents(id)
+	if !found {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	}
+	defer unsubscribe()
+
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	job, _ := s.indexer.Job(id)
+	err := writeEvent(w, "job", job)
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for err == nil {
+		err = controller.Flush()
+		if err != nil {
+			return
+		}
+
+		select {
+		case event, open := <-events:
+			if !open {
+				job, _ = s.indexer.Job(id)
+				err = writeEvent(w, "job", job)
+				if err == nil {
+					_ = controller.Flush()
+				}
+				return
+			}
+			err = writeEvent(w, "progress", event)
+
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+
+		case <-r.Context().Done():
+			return
+
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// handleEvents streams notifications of changes to the index as server-sent
+// events: GET /api/v1/events. Each event is named for its notification type
+// and holds the notification. ?repo= keeps a repository's notifications and
+// those for the whole index, and ?types= takes a comma-separated list of the
+// types to keep. A client that falls behind is disconnected, so it can
+// reconnect and start from fresh state rather than miss a change unknowingly.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	repo := r.URL.Query().Get("repo")
+	var types []string
+	if value := r.URL.Query().Get("types"); value != "" {
+		for name := range strings.SplitSeq(value, ",") {
+			name = strings.TrimSpace(name)
+			if !slices.Contains(indexer.NotificationTypes, name) {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Unknown event type %q", name))
+				return
+			}
+			types = append(types, name)
+		}
+	}
+
+	events, unsubscribe := s.indexer.Notifications()
+	defer unsubscribe()
+
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	var err error
+	for err == nil {
+		err = controller.Flush()
+		if err != nil {
+			return
+		}
+
+		select {
+		case notification, open := <-events:
+			if !open {
+				return
+			}
+			if repo != "" && notification.Repo != "" && notification.Repo != repo {
+				continue
+			}
+			if len(types) > 0 && !slices.Contains(types, notification.Type) {
+				continue
+			}
+			err = writeEvent(w, notification.Type, notification)
+
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+
+		case <-r.Context().Done():
+			return
+
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// writeEvent writes one server-sent event with data encoded as JSON.
+func writeEvent(w io.Writer, name string, data any) (err error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+	return err
+}
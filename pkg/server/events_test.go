@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandleReindexEvents(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080", ReposPath: t.TempDir()}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/reindex/missing/events", nil)
+	req.SetPathValue("id", "missing")
+	w := httptest.NewRecorder()
+
+	server.handleReindexEvents(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	job, err := server.indexer.StartReindex(context.Background(), indexer.ReindexOptions{})
+	if err != nil {
+		t.Fatalf("StartReindex() error = %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/reindex/"+job.ID+"/events", nil)
+	req.SetPathValue("id", job.ID)
+	w = httptest.NewRecorder()
+
+	// The stream ends once the job, which has no repositories, finishes.
+	server.handleReindexEvents(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("events = %q, want the job's status at the start and the end", events)
+	}
+	name, data, _ := strings.Cut(events[1], "\n")
+	if name != "event: job" {
+		t.Fatalf("last event = %q, want a job event", events[1])
+	}
+
+	var finished indexer.Job
+	err = json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &finished)
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if finished.ID != job.ID || finished.State != indexer.JobCompleted {
+		t.Errorf("final job = %s %s, want %s completed", finished.ID, finished.State, job.ID)
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"deleted":7}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index", ReposPath: t.TempDir()}
+	logger := &mockLogger{}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server := &Server{
+		indexer: indexer.New(cfg, client, m, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/events?types=repo_indexed,bogus", nil)
+	w := httptest.NewRecorder()
+	server.handleEvents(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown type: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	api := httptest.NewServer(http.HandlerFunc(server.handleEvents))
+	defer api.Close()
+
+	resp, err := http.Get(api.URL + "?repo=api&types=documents_deleted")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	// The stream is subscribed once its headers arrive. The other
+	// repository's deletion is filtered out.
+	for _, repo := range []string{"web", "api"} {
+		_, err = server.indexer.DeleteRepo(context.Background(), repo)
+		if err != nil {
+			t.Fatalf("DeleteRepo(%s) error = %v", repo, err)
+		}
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	name, _ := reader.ReadString('\n')
+	data, _ := reader.ReadString('\n')
+	if name != "event: documents_deleted\n" {
+		t.Fatalf("event = %q, want documents_deleted", name)
+	}
+
+	var notification indexer.Notification
+	err = json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &notification)
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if notification.Repo != "api" || notification.Deleted != 7 {
+		t.Errorf("notification = %+v, want 7 documents of api deleted", notification)
+	}
+
+	// Shutting down ends the stream.
+	close(server.closing)
+	_, _ = reader.ReadString('\n')
+	_, err = reader.ReadString('\n')
+	if err == nil {
+		t.Error("stream still open after shutdown")
+	}
+}
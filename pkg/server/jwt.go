@@ -0,0 +1,391 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jwksRefreshInterval = 10 * time.Minute
+	jwksMinRefreshDelay = 30 * time.Second
+	jwtClockLeeway      = time.Minute
+)
+
+var (
+	errMalformedToken       = errors.New("malformed token")
+	errUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	errUnknownKey           = errors.New("unknown signing key")
+	errInvalidSignature     = errors.New("invalid token signature")
+	errTokenExpired         = errors.New("token expired")
+	errTokenNotYetValid     = errors.New("token not yet valid")
+	errInvalidIssuer        = errors.New("invalid token issuer")
+	errInvalidAudience      = errors.New("invalid token audience")
+)
+
+// jwtHeader is the decoded JOSE header of a token.
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwtClaims holds the registered claims checked during validation.
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt float64         `json:"exp"`
+	NotBefore float64         `json:"nbf"`
+}
+
+// jsonWebKey is a single entry of a JWKS document.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// jsonWebKeySet is a JWKS document.
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jwtVerifier validates RS* and ES* signed JWTs against keys from a JWKS endpoint.
+type jwtVerifier struct {
+	issuer    string
+	audience  string
+	jwksURL   string
+	client    *http.Client
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// newJWTVerifier creates a verifier. Keys are fetched lazily on first use.
+func newJWTVerifier(issuer string, audience string, jwksURL string) (verifier *jwtVerifier) {
+	verifier = &jwtVerifier{
+		issuer:   issuer,
+		audience: audience,
+		jwksURL:  jwksURL,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		keys: make(map[string]crypto.PublicKey),
+	}
+	return verifier
+}
+
+// verify checks the token's signature and registered claims.
+func (v *jwtVerifier) verify(ctx context.Context, token string) (claims jwtClaims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		err = errMalformedToken
+		return claims, err
+	}
+
+	var header jwtHeader
+	err = decodeSegment(parts[0], &header)
+	if err != nil {
+		return claims, err
+	}
+
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return claims, err
+	}
+
+	var signature []byte
+	signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		err = errMalformedToken
+		return claims, err
+	}
+
+	var key crypto.PublicKey
+	key, err = v.key(ctx, header.KeyID)
+	if err != nil {
+		return claims, err
+	}
+
+	err = verifySignature(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return claims, err
+	}
+
+	err = v.validateClaims(claims, time.Now())
+	return claims, err
+}
+
+// validateClaims checks expiry, not-before, issuer, and audience.
+func (v *jwtVerifier) validateClaims(claims jwtClaims, now time.Time) (err error) {
+	if claims.ExpiresAt == 0 || now.Add(-jwtClockLeeway).After(time.Unix(int64(claims.ExpiresAt), 0)) {
+		err = errTokenExpired
+		return err
+	}
+
+	if claims.NotBefore != 0 && now.Add(jwtClockLeeway).Before(time.Unix(int64(claims.NotBefore), 0)) {
+		err = errTokenNotYetValid
+		return err
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		err = errInvalidIssuer
+		return err
+	}
+
+	if v.audience != "" && !audienceContains(claims.Audience, v.audience) {
+		err = errInvalidAudience
+		return err
+	}
+
+	return err
+}
+
+// key returns the public key for a key ID, refreshing the JWKS when the key is
+// unknown or the cached set is stale.
+func (v *jwtVerifier) key(ctx context.Context, keyID string) (key crypto.PublicKey, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, found := v.keys[keyID]
+	stale := time.Since(v.fetchedAt) > jwksRefreshInterval
+	if found && !stale {
+		return key, err
+	}
+
+	if !stale && time.Since(v.fetchedAt) < jwksMinRefreshDelay {
+		err = errUnknownKey
+		return key, err
+	}
+
+	err = v.refresh(ctx)
+	if err != nil {
+		return key, err
+	}
+
+	key, found = v.keys[keyID]
+	if !found {
+		err = errUnknownKey
+		return key, err
+	}
+
+	return key, err
+}
+
+// refresh fetches and parses the JWKS document. Callers must hold v.mu.
+func (v *jwtVerifier) refresh(ctx context.Context) (err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create JWKS request: %w", err)
+		return err
+	}
+
+	var resp *http.Response
+	resp, err = v.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch JWKS: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+		return err
+	}
+
+	var set jsonWebKeySet
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		err = fmt.Errorf("failed to decode JWKS: %w", err)
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, parseErr := jwk.publicKey()
+		if parseErr != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return err
+}
+
+// publicKey converts a JWK into an RSA or ECDSA public key.
+func (k jsonWebKey) publicKey() (key crypto.PublicKey, err error) {
+	switch k.KeyType {
+	case "RSA":
+		var n, e []byte
+		n, err = base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return key, err
+		}
+		e, err = base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return key, err
+		}
+		key = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return key, err
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			err = fmt.Errorf("unsupported curve %q", k.Curve)
+			return key, err
+		}
+		var x, y []byte
+		x, err = base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return key, err
+		}
+		y, err = base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return key, err
+		}
+		key = &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		return key, err
+
+	default:
+		err = fmt.Errorf("unsupported key type %q", k.KeyType)
+		return key, err
+	}
+}
+
+// verifySignature verifies a JWS signature for the RS256/384/512 and ES256/384
+// algorithms. The algorithm must match the key: RS* an RSA key, ES256 an EC
+// key on P-256, and ES384 one on P-384.
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) (err error) {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		err = errUnsupportedAlgorithm
+		return err
+	}
+
+	if !algorithmMatchesKey(alg, key) {
+		err = errUnsupportedAlgorithm
+		return err
+	}
+
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, hash, digest, signature) != nil {
+			err = errInvalidSignature
+			return err
+		}
+		return err
+
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			err = errInvalidSignature
+			return err
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		sig := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, sig) {
+			err = errInvalidSignature
+			return err
+		}
+		return err
+
+	default:
+		err = errUnsupportedAlgorithm
+		return err
+	}
+}
+
+// algorithmMatchesKey reports whether a token's alg is one the key is for,
+// so a token's signature is never checked with a key of another type or
+// curve.
+func algorithmMatchesKey(alg string, key crypto.PublicKey) (matches bool) {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		matches = alg == "RS256" || alg == "RS384" || alg == "RS512"
+	case *ecdsa.PublicKey:
+		matches = (alg == "ES256" && pub.Curve == elliptic.P256()) ||
+			(alg == "ES384" && pub.Curve == elliptic.P384())
+	}
+	return matches
+}
+
+// decodeSegment base64url-decodes a token segment and unmarshals it as JSON.
+func decodeSegment(segment string, target any) (err error) {
+	var data []byte
+	data, err = base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		err = errMalformedToken
+		return err
+	}
+
+	err = json.Unmarshal(data, target)
+	if err != nil {
+		err = errMalformedToken
+		return err
+	}
+
+	return err
+}
+
+// audienceContains reports whether the aud claim, a string or array of strings, contains want.
+func audienceContains(raw json.RawMessage, want string) (found bool) {
+	if len(raw) == 0 {
+		return found
+	}
+
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		found = single == want
+		return found
+	}
+
+	var multiple []string
+	if json.Unmarshal(raw, &multiple) == nil {
+		found = slices.Contains(multiple, want)
+		return found
+	}
+
+	return found
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// defaultMarkersLimit is how many markers a markers request returns when it
+// doesn't set limit.
+const defaultMarkersLimit = 100
+
+// MarkerEntry is a TODO or FIXME comment and the declaration it is in.
+type MarkerEntry struct {
+	Tag          string `json:"tag"`
+	Text         string `json:"text,omitempty"`
+	FilePath     string `json:"file_path"`
+	Line         int    `json:"line,omitempty"`
+	FunctionName string `json:"function_name"`
+	Kind         string `json:"kind"`
+	Commit       string `json:"commit,omitempty"`
+	SourceURL    string `json:"source_url,omitempty"`
+}
+
+// MarkersResponse lists a repository's technical-debt markers, with how
+// many of those listed carry each tag.
+type MarkersResponse struct {
+	Repo    string         `json:"repo"`
+	Counts  map[string]int `json:"counts"`
+	Markers []MarkerEntry  `json:"markers"`
+}
+
+// handleMarkers lists the TODO and FIXME comments in a repository's
+// declarations: GET /api/v1/markers?repo=api, optionally only those with
+// the tags named by tag parameters and at most limit of them, in order of
+// file and line.
+func (s *Server) handleMarkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	repo := params.Get("repo")
+	if !validFilterValue(repo) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "repo is required")
+		return
+	}
+
+	var tags []string
+	for _, tag := range params["tag"] {
+		tag = strings.ToUpper(tag)
+		if tag != elasticsearch.MarkerTodo && tag != elasticsearch.MarkerFixme {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "tag must be TODO or FIXME")
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	limit, msg := s.queryLimit(params.Get("limit"), defaultMarkersLimit)
+	if msg != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, msg)
+		return
+	}
+
+	docs, err := s.es.MarkedDocuments(r.Context(), repo, tags, limit)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "Markers error", "repo", repo, "error", err)
+		writeESError(w, r, "Failed to find markers", err)
+		return
+	}
+
+	resp := MarkersResponse{Repo: repo, Counts: map[string]int{}, Markers: s.markers(docs, tags, limit)}
+	for _, marker := range resp.Markers {
+		resp.Counts[marker.Tag]++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// markers lists the markers of declarations, in order of file and line, with
+// the given tags when any are, up to limit. A marker in both a class and one
+// of its methods, or in several chunks of a declaration, is listed once,
+// under the innermost declaration: docs come in order of file and start line,
+// so the last to carry it.
+func (s *Server) markers(docs []elasticsearch.CodeDocument, tags []string, limit int) (markers []MarkerEntry) {
+	markers = []MarkerEntry{}
+	listed := make(map[string]int)
+	for _, doc := range docs {
+		for _, marker := range doc.Markers {
+			if len(tags) > 0 && !slices.Contains(tags, marker.Tag) {
+				continue
+			}
+
+			entry := MarkerEntry{
+				Tag:          marker.Tag,
+				Text:         marker.Text,
+				FilePath:     doc.FilePath,
+				Line:         marker.Line,
+				FunctionName: doc.FunctionName,
+				Kind:         doc.Kind,
+				Commit:       doc.Commit,
+				SourceURL: s.sourceURL(elasticsearch.CodeDocument{
+					Repo:      doc.Repo,
+					FilePath:  doc.FilePath,
+					StartLine: marker.Line,
+					EndLine:   marker.Line,
+					Commit:    doc.Commit,
+				}),
+			}
+
+			key := fmt.Sprintf("%s:%d", doc.FilePath, marker.Line)
+			i, found := listed[key]
+			if found {
+				markers[i] = entry
+				continue
+			}
+			listed[key] = len(markers)
+			markers = append(markers, entry)
+		}
+	}
+
+	slices.SortStableFunc(markers, func(a MarkerEntry, b MarkerEntry) (order int) {
+		order = cmp.Or(strings.Compare(a.FilePath, b.FilePath), cmp.Compare(a.Line, b.Line))
+		return order
+	})
+	if len(markers) > limit {
+		markers = markers[:limit]
+	}
+	return markers
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandleMarkers(t *testing.T) {
+	var query string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		query = string(body)
+		_, _ = w.Write([]byte(`{"hits":{"hits":[` +
+			`{"_id":"c","_source":{"repo":"api","file_path":"app/store.py","function_name":"Store","kind":"class","start_line":1,"commit":"abc",` +
+			`"markers":[{"tag":"TODO","line":4,"text":"cache"},{"tag":"FIXME","line":9,"text":"locking"}]}},` +
+			`{"_id":"g","_source":{"repo":"api","file_path":"app/store.py","function_name":"Store.get","kind":"method","start_line":3,"commit":"abc",` +
+			`"markers":[{"tag":"TODO","line":4,"text":"cache"}]}},` +
+			`{"_id":"d","_source":{"repo":"api","file_path":"app/db.py","function_name":"connect","kind":"function","start_line":1,"commit":"abc",` +
+			`"markers":[{"tag":"TODO","line":2,"text":"pool"}]}}]}}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{ESHost: es.URL, ESIndex: "test-index", SearchMaxLimit: 50, SourceURLTemplate: "https://git.example.com/{repo}/{path}#L{start_line}"}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	logger := &mockLogger{}
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		es:      client,
+		config:  cfg,
+		metrics: m,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	for _, target := range []string{"/api/v1/markers", "/api/v1/markers?repo=api&tag=XXX", "/api/v1/markers?repo=api&limit=51"} {
+		w := httptest.NewRecorder()
+		server.handleMarkers(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.handleMarkers(w, httptest.NewRequest(http.MethodGet, "/api/v1/markers?repo=api&tag=todo&tag=FIXME", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp MarkersResponse
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	var got []string
+	for _, marker := range resp.Markers {
+		got = append(got, marker.FilePath+":"+marker.FunctionName+":"+marker.Tag)
+	}
+	want := "app/db.py:connect:TODO app/store.py:Store.get:TODO app/store.py:Store:FIXME"
+	if strings.Join(got, " ") != want {
+		t.Errorf("markers = %v, want %s, the class's TODO under its method", got, want)
+	}
+	if resp.Counts["TODO"] != 2 || resp.Counts["FIXME"] != 1 {
+		t.Errorf("Counts = %v, want 2 TODOs and 1 FIXME", resp.Counts)
+	}
+	if resp.Markers[0].SourceURL == "" {
+		t.Error("marker has no source URL")
+	}
+	for _, part := range []string{`{"term":{"repo":"api"}}`, `{"terms":{"markers.tag":["TODO","FIXME"]}}`, `"size":50`} {
+		if !strings.Contains(query, part) {
+			t.Errorf("query = %s, want %s", query, part)
+		}
+	}
+}
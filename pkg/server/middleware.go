@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// requestIDHeader carries the request ID in requests and responses.
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// unloggedPaths are probed or scraped every few seconds; logging them would
+// bury the API requests.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var unloggedPaths = map[string]bool{
+	"/health":  true,
+	"/ready":   true,
+	"/metrics": true,
+}
+
+// knownMethods are the methods reported as themselves in request metrics;
+// any other method a client sends is reported as "other".
+//
+//nolint:gochecknoglobals // fixed lookup table
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// middleware wraps the mux with the stack every request passes through:
+// request IDs outermost, so recovered panics are logged with the ID, then
+// request logging, then the client certificate check, then response
+// compression, then request metrics, then panic recovery, so a panic is
+// logged and counted as a 500.
+func (s *Server) middleware(next http.Handler) (handler http.Handler) {
+	handler = s.withRequestID(s.logRequests(s.requireClientCert(s.compressResponses(s.observeRequests(s.recoverPanics(next))))))
+	return handler
+}
+
+// withRequestID tags the request with an ID, the client's X-Request-Id when
+// it sends a usable one, else a random one. The ID is echoed in the response
+// and carried in the request's context, which adds it to every message
+// logged with that context.
+func (s *Server) withRequestID(next http.Handler) (handler http.Handler) {
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+	return handler
+}
+
+// logRequests logs each request's method, path, status, and duration once
+// it has been served.
+func (s *Server) logRequests(next http.Handler) (handler http.Handler) {
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unloggedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		s.logger.InfoContext(r.Context(), "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote", r.RemoteAddr)
+	})
+	return handler
+}
+
+// observeRequests records each request's duration by route, method, and
+// status. The route is the mux pattern that served the request, so path
+// parameters don't multiply the series; requests no pattern matched are
+// grouped as "unmatched". It relies on the mux setting the pattern on the
+// request it was passed, so nothing between them may copy the request.
+func (s *Server) observeRequests(next http.Handler) (handler http.Handler) {
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.metrics == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		method := r.Method
+		if !knownMethods[method] {
+			method = "other"
+		}
+		s.metrics.HTTPRequestDuration.WithLabelValues(route, method, strconv.Itoa(recorder.status)).Observe(time.Since(start).Seconds())
+	})
+	return handler
+}
+
+// recoverPanics turns a panicking handler into a 500 response, logging the
+// panic and its stack, instead of dropping the connection. A response
+// already under way can't be replaced and is cut short. http.ErrAbortHandler
+// is passed on, since it aborts the response deliberately.
+func (s *Server) recoverPanics(next http.Handler) (handler http.Handler) {
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			recoveredErr, isErr := recovered.(error)
+			if isErr && errors.Is(recoveredErr, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			s.logger.ErrorContext(r.Context(), "Panic serving request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"error", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()))
+			if recorder.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(recorder, r, http.StatusInternalServerError, CodeInternal, "Internal server error")
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+	return handler
+}
+
+// validRequestID reports whether a client's request ID is safe to log and
+// echo: non-empty, bounded, and printable ASCII without spaces.
+func validRequestID(id string) (valid bool) {
+	if id == "" || len(id) > maxRequestIDLength {
+		return valid
+	}
+
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return valid
+		}
+	}
+
+	valid = true
+	return valid
+}
+
+// newRequestID returns a random 16-byte request ID in hex.
+func newRequestID() (id string) {
+	raw := make([]byte, 16)
+	_, _ = rand.Read(raw)
+	id = hex.EncodeToString(raw)
+	return id
+}
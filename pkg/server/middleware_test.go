@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// logLines decodes the JSON log lines written to buf.
+func logLines(t *testing.T, buf *bytes.Buffer) (lines []map[string]interface{}) {
+	t.Helper()
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		requestID  string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantID     string
+		wantLogs   []string
+	}{
+		{
+			name: "request ID in the handler's context",
+			path: "/api/v1/search",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Seen-Id", logging.RequestID(r.Context()))
+				w.WriteHeader(http.StatusAccepted)
+			},
+			wantStatus: http.StatusAccepted,
+			wantLogs:   []string{"HTTP request"},
+		},
+		{
+			name:      "client request ID kept",
+			path:      "/api/v1/stats",
+			requestID: "trace-abc-123",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+			wantID:     "trace-abc-123",
+			wantLogs:   []string{"HTTP request"},
+		},
+		{
+			name:      "unusable request ID replaced",
+			path:      "/api/v1/stats",
+			requestID: "has spaces\tand tabs",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			wantStatus: http.StatusNoContent,
+			wantLogs:   []string{"HTTP request"},
+		},
+		{
+			name: "panic recovered",
+			path: "/api/v1/search",
+			handler: func(_ http.ResponseWriter, _ *http.Request) {
+				panic("nil map")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantLogs:   []string{"Panic serving request", "HTTP request"},
+		},
+		{
+			name: "probes not logged",
+			path: "/health",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := &Server{logger: logging.New(slog.New(slog.NewJSONHandler(&buf, nil)))}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			s.middleware(tt.handler).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			id := w.Header().Get(requestIDHeader)
+			if tt.wantID != "" && id != tt.wantID {
+				t.Errorf("request ID = %q, want %q", id, tt.wantID)
+			}
+			if !validRequestID(id) {
+				t.Errorf("request ID = %q, want a valid ID", id)
+			}
+			seen := w.Header().Get("X-Seen-Id")
+			if seen != "" && seen != id {
+				t.Errorf("handler saw request ID %q, response has %q", seen, id)
+			}
+
+			lines := logLines(t, &buf)
+			if len(lines) != len(tt.wantLogs) {
+				t.Fatalf("logged %d lines, want %d: %s", len(lines), len(tt.wantLogs), buf.String())
+			}
+			for i, line := range lines {
+				if line["msg"] != tt.wantLogs[i] {
+					t.Errorf("log %d = %v, want %q", i, line["msg"], tt.wantLogs[i])
+				}
+				if line["request_id"] != id {
+					t.Errorf("log %d request_id = %v, want %q", i, line["request_id"], id)
+				}
+			}
+			if len(lines) > 0 {
+				last := lines[len(lines)-1]
+				if last["status"] != float64(tt.wantStatus) || last["path"] != tt.path || last["method"] != http.MethodGet {
+					t.Errorf("request log = %v", last)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverPanicsAfterResponseStarted(t *testing.T) {
+	var buf bytes.Buffer
+	s := &Server{logger: logging.New(slog.New(slog.NewJSONHandler(&buf, nil)))}
+
+	handler := s.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("late failure")
+	}))
+
+	defer func() {
+		recovered := recover()
+		if recovered != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", recovered)
+		}
+		if !strings.Contains(buf.String(), "late failure") {
+			t.Errorf("panic not logged: %s", buf.String())
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/search", nil))
+}
+
+func TestCompressResponses(t *testing.T) {
+	large := strings.Repeat(`{"function_name":"Handle"}`, 100)
+
+	tests := []struct {
+		name           string
+		disabled       bool
+		acceptEncoding string
+		body           string
+		status         int
+		wantGzip       bool
+	}{
+		{
+			name:           "large response gzipped",
+			acceptEncoding: "br, gzip",
+			body:           large,
+			status:         http.StatusOK,
+			wantGzip:       true,
+		},
+		{
+			name:           "small response sent as is",
+			acceptEncoding: "gzip",
+			body:           `{"ok":true}`,
+			status:         http.StatusOK,
+		},
+		{
+			name:   "client without gzip",
+			body:   large,
+			status: http.StatusOK,
+		},
+		{
+			name:           "gzip refused",
+			acceptEncoding: "gzip;q=0",
+			body:           large,
+			status:         http.StatusOK,
+		},
+		{
+			name:           "disabled",
+			disabled:       true,
+			acceptEncoding: "gzip",
+			body:           large,
+			status:         http.StatusOK,
+		},
+		{
+			name:           "not modified",
+			acceptEncoding: "gzip",
+			status:         http.StatusNotModified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{config: config.Config{HTTPCompression: !tt.disabled}}
+			handler := s.compressResponses(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				// Written in pieces, as a JSON encoder might.
+				for chunk := range slices.Chunk([]byte(tt.body), 300) {
+					_, _ = w.Write(chunk)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/search", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q, want gzip %v", w.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+
+			body := w.Body.Bytes()
+			if gzipped {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				body, err = io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("failed to decompress: %v", err)
+				}
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestObserveRequests(t *testing.T) {
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	s := &Server{metrics: m, logger: logging.New(slog.New(slog.DiscardHandler))}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/{name}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/api/v1/search", func(_ http.ResponseWriter, _ *http.Request) {
+		panic("nil map")
+	})
+	handler := s.middleware(mux)
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodDelete, path: "/api/v1/repos/api"},
+		{method: http.MethodDelete, path: "/api/v1/repos/web"},
+		{method: http.MethodPost, path: "/api/v1/search"},
+		{method: "BREW", path: "/coffee"},
+	}
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	// The two deletes share a series, keyed by pattern rather than path.
+	if got := testutil.CollectAndCount(m.HTTPRequestDuration); got != 3 {
+		t.Errorf("request duration series = %d, want 3", got)
+	}
+	for _, labels := range [][]string{
+		{"/api/v1/repos/{name}", http.MethodDelete, "404"},
+		{"/api/v1/search", http.MethodPost, "500"},
+		{"unmatched", "other", "404"},
+	} {
+		if !m.HTTPRequestDuration.DeleteLabelValues(labels...) {
+			t.Errorf("no series for %v", labels)
+		}
+	}
+}
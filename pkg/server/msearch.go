@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// multiSearchRequest is a set of searches run together. With Dedupe set, a
+// document is returned only by the first search that finds it.
+type multiSearchRequest struct {
+	Searches []elasticsearch.SearchRequest `json:"searches"`
+	Dedupe   bool                          `json:"dedupe"`
+}
+
+// MultiSearchResponse holds the response to each search of a multi-search,
+// in the order of the searches.
+type MultiSearchResponse struct {
+	Responses []SearchResponse `json:"responses"`
+}
+
+// handleMultiSearch runs several searches, such as the variations of a
+// question an agent tries, in one Elasticsearch round trip.
+func (s *Server) handleMultiSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req multiSearchRequest
+	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if s.bodyTooLarge(w, r, "/api/v1/msearch", decodeErr) {
+		return
+	}
+	if decodeErr != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
+		return
+	}
+
+	msg := s.multiSearchError(req.Searches)
+	if msg != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, msg)
+		return
+	}
+
+	start := time.Now()
+	results, searchErr := s.es.MultiSearch(r.Context(), req.Searches)
+	total := 0
+	for _, docs := range results {
+		total += len(docs)
+	}
+	s.observeSearch("msearch", start, total, searchErr)
+	if searchErr != nil {
+		s.logger.ErrorContext(r.Context(), "Multi-search error", "searches", len(req.Searches), "error", searchErr)
+		writeESError(w, r, "Search failed", searchErr)
+		return
+	}
+
+	if req.Dedupe {
+		results = dedupeResults(results)
+	}
+
+	resp := MultiSearchResponse{Responses: make([]SearchResponse, len(results))}
+	for i, docs := range results {
+		resp.Responses[i] = s.searchResponse(r.Context(), docs)
+		s.usage.Record(req.Searches[i].Query, slices.Collect(maps.Keys(resp.Responses[i].Repos)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// multiSearchError validates the searches of a multi-search as handleSearch
+// does, normalizing their queries in place, and checks their number against
+// SEARCH_MAX_QUERIES. It describes the first problem found, naming the search
+// by its position, or returns "" when the searches are valid. Reranking,
+// rewriting, context, and debug output aren't supported, since they work on
+// one search at a time.
+func (s *Server) multiSearchError(searches []elasticsearch.SearchRequest) (msg string) {
+	if len(searches) == 0 {
+		msg = "searches is required"
+		return msg
+	}
+	maxQueries := s.config.SearchMaxQueries
+	if maxQueries > 0 && len(searches) > maxQueries {
+		msg = fmt.Sprintf("Too many searches: at most %d", maxQueries)
+		return msg
+	}
+
+	for i := range searches {
+		search := &searches[i]
+
+		msg = s.searchBoundsError(search, true)
+		switch {
+		case msg != "":
+		case search.Sort != "" && search.Sort != elasticsearch.SortComplexity:
+			msg = "Invalid sort"
+		case search.Rerank:
+			msg = "rerank is not supported in a multi-search"
+		case search.Rewrite:
+			msg = "rewrite is not supported in a multi-search"
+		case search.IncludeContext:
+			msg = "include_context is not supported in a multi-search"
+		case search.IncludeTests:
+			msg = "include_tests is not supported in a multi-search"
+		case search.Debug:
+			msg = "debug is not supported in a multi-search"
+		default:
+			msg = searchFilterError(*search)
+		}
+		if msg != "" {
+			msg = fmt.Sprintf("searches[%d]: %s", i, msg)
+			return msg
+		}
+	}
+
+	return msg
+}
+
+// dedupeResults drops each document from the results of every search after
+// the first to return it, so overlapping searches don't repeat results.
+func dedupeResults(results [][]elasticsearch.CodeDocument) (deduped [][]elasticsearch.CodeDocument) {
+	seen := make(map[string]bool)
+	deduped = make([][]elasticsearch.CodeDocument, len(results))
+	for i, docs := range results {
+		deduped[i] = []elasticsearch.CodeDocument{}
+		for _, doc := range docs {
+			if seen[doc.ID] {
+				continue
+			}
+			seen[doc.ID] = true
+			deduped[i] = append(deduped[i], doc)
+		}
+	}
+	return deduped
+}
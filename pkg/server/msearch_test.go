@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandleMultiSearch(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test-index/_msearch" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"responses":[` +
+			`{"status":200,"hits":{"hits":[{"_id":"a","_source":{"repo":"api"}},{"_id":"b","_source":{"repo":"api"}}]}},` +
+			`{"status":200,"hits":{"hits":[{"_id":"b","_source":{"repo":"api"}},{"_id":"c","_source":{"repo":"web"}}]}}]}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{ESHost: es.URL, ESIndex: "test-index", SearchMaxQueries: 2}
+	client, err := elasticsearch.NewClient(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	logger := &mockLogger{}
+	server := &Server{indexer: indexer.New(cfg, nil, nil, logger), es: client, config: cfg, logger: logger}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantIDs    [][]string
+		wantErr    string
+	}{
+		{
+			name:       "results in order",
+			body:       `{"searches":[{"query":"retry"},{"query":"backoff"}]}`,
+			wantStatus: http.StatusOK,
+			wantIDs:    [][]string{{"a", "b"}, {"b", "c"}},
+		},
+		{
+			name:       "deduplicated",
+			body:       `{"searches":[{"query":"retry"},{"query":"backoff"}],"dedupe":true}`,
+			wantStatus: http.StatusOK,
+			wantIDs:    [][]string{{"a", "b"}, {"c"}},
+		},
+		{
+			name:       "no searches",
+			body:       `{"searches":[]}`,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "searches is required",
+		},
+		{
+			name:       "too many searches",
+			body:       `{"searches":[{"query":"a"},{"query":"b"},{"query":"c"}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "Too many searches: at most 2",
+		},
+		{
+			name:       "invalid search",
+			body:       `{"searches":[{"query":"retry"},{"query":"backoff","kinds":["widget"]}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "searches[1]: Invalid kind",
+		},
+		{
+			name:       "rerank",
+			body:       `{"searches":[{"query":"retry","rerank":true}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "searches[0]: rerank is not supported in a multi-search",
+		},
+		{
+			name:       "include context",
+			body:       `{"searches":[{"query":"retry"},{"query":"backoff","include_context":true}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "searches[1]: include_context is not supported in a multi-search",
+		},
+		{
+			name:       "include tests",
+			body:       `{"searches":[{"query":"retry","include_tests":true}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "searches[0]: include_tests is not supported in a multi-search",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.handleMultiSearch(w, httptest.NewRequest(http.MethodPost, "/api/v1/msearch", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantErr != "" {
+				apiErr := decodeError(t, w)
+				if apiErr.Message != tt.wantErr {
+					t.Errorf("message = %q, want %q", apiErr.Message, tt.wantErr)
+				}
+				return
+			}
+
+			var resp MultiSearchResponse
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if len(resp.Responses) != len(tt.wantIDs) {
+				t.Fatalf("Responses = %d, want %d", len(resp.Responses), len(tt.wantIDs))
+			}
+			for i, want := range tt.wantIDs {
+				var got []string
+				for _, doc := range resp.Responses[i].Results {
+					got = append(got, doc.ID)
+				}
+				if strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Errorf("Responses[%d] = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
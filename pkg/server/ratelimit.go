@@ -0,0 +1,170 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often buckets of clients that have gone
+// quiet are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a token bucket per client. Each bucket holds up to burst
+// requests and refills at rate per second, so a client can send a burst at
+// once and then rate requests a second.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// tokenBucket is one client's remaining requests as of updated.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests a second with
+// bursts of burst, or nil when rate is zero and limiting is disabled.
+func newRateLimiter(rate float64, burst int) (limiter *rateLimiter) {
+	if rate <= 0 {
+		return limiter
+	}
+
+	limiter = &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+	return limiter
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it
+// reports false with how long until the next token.
+func (l *rateLimiter) allow(client string) (allowed bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	bucket := l.buckets[client]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[client] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		allowed = true
+		return allowed, retryAfter
+	}
+
+	retryAfter = time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return allowed, retryAfter
+}
+
+// sweep drops the buckets that have refilled completely, since a new bucket
+// for the same client would be identical. It runs at most once a sweep
+// interval.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateLimitSweepInterval {
+		return
+	}
+	l.swept = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rateLimitClient identifies the caller a request counts against: the
+// principal requireAuth verified, or its IP address when no credential was
+// verified. Unverified credentials are ignored, so a client can't escape its
+// limit by sending a fresh made-up key with every request.
+func rateLimitClient(r *http.Request) (client string) {
+	client = principalFrom(r.Context())
+	if client != "" {
+		return client
+	}
+
+	host, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+	if splitErr != nil {
+		host = r.RemoteAddr
+	}
+	client = "ip:" + host
+	return client
+}
+
+// limit wraps an endpoint with the per-client rate limit and the request
+// body size limit. Rejected requests get a 429 with Retry-After, or a 413,
+// and a JSON error body. Bodies sent without a length are cut off at the
+// limit as they are read; handlers decoding them check for
+// http.MaxBytesError.
+func (s *Server) limit(endpoint string, next http.HandlerFunc) (handler http.HandlerFunc) {
+	maxBody := int64(s.config.MaxRequestBodyKB) * 1024
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter != nil {
+			allowed, retryAfter := s.limiter.allow(rateLimitClient(r))
+			if !allowed {
+				s.observeRejected(endpoint, "rate_limited")
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				writeError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+				return
+			}
+		}
+
+		if maxBody > 0 {
+			if r.ContentLength > maxBody {
+				s.observeRejected(endpoint, "body_too_large")
+				writeError(w, r, http.StatusRequestEntityTooLarge, CodeRequestTooLarge, requestTooLargeMessage(maxBody))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		}
+
+		next(w, r)
+	}
+	return handler
+}
+
+// bodyTooLarge reports whether err is from reading past the body size limit,
+// writing the 413 response if so.
+func (s *Server) bodyTooLarge(w http.ResponseWriter, r *http.Request, endpoint string, err error) (tooLarge bool) {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return tooLarge
+	}
+
+	s.observeRejected(endpoint, "body_too_large")
+	writeError(w, r, http.StatusRequestEntityTooLarge, CodeRequestTooLarge, requestTooLargeMessage(maxErr.Limit))
+	tooLarge = true
+	return tooLarge
+}
+
+// observeRejected counts a request rejected by a limit.
+func (s *Server) observeRejected(endpoint string, reason string) {
+	if s.metrics != nil {
+		s.metrics.RequestsRejected.WithLabelValues(endpoint, reason).Inc()
+	}
+}
+
+// requestTooLargeMessage describes the body size limit.
+func requestTooLargeMessage(limit int64) (msg string) {
+	msg = "Request body exceeds " + strconv.FormatInt(limit/1024, 10) + " KB"
+	return msg
+}
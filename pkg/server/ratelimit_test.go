@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	// The burst is available at once, then requests refill at 2 a second.
+	for i := range 3 {
+		allowed, _ := limiter.allow("key:a")
+		if !allowed {
+			t.Fatalf("request %d of the burst rejected", i+1)
+		}
+	}
+
+	allowed, retryAfter := limiter.allow("key:a")
+	if allowed || retryAfter != 500*time.Millisecond {
+		t.Errorf("allow() past the burst = %v, %v, want false, 500ms", allowed, retryAfter)
+	}
+
+	other, _ := limiter.allow("key:b")
+	if !other {
+		t.Error("another client was limited by the first one's requests")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = limiter.allow("key:a")
+	if !allowed {
+		t.Error("allow() after refilling a token = false, want true")
+	}
+
+	// Buckets that have refilled are dropped once a sweep is due.
+	now = now.Add(rateLimitSweepInterval)
+	_, _ = limiter.allow("key:c")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("%d buckets after sweep, want 1", len(limiter.buckets))
+	}
+
+	if newRateLimiter(0, 10) != nil {
+		t.Error("newRateLimiter(0) should disable limiting")
+	}
+}
+
+func TestRateLimitClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		headers map[string]string
+		remote  string
+		want    string
+	}{
+		{name: "api key", keys: []string{"secret"}, headers: map[string]string{"X-Api-Key": "secret"}, remote: "10.0.0.1:5000", want: "key:"},
+		{name: "bearer token", keys: []string{"secret"}, headers: map[string]string{"Authorization": "Bearer secret"}, remote: "10.0.0.1:5000", want: "key:"},
+		{name: "address", remote: "10.0.0.1:5000", want: "ip:10.0.0.1"},
+		{name: "ipv6 address", remote: "[::1]:5000", want: "ip:::1"},
+		{name: "unverified key with auth disabled", headers: map[string]string{"X-Api-Key": "made-up"}, remote: "10.0.0.1:5000", want: "ip:10.0.0.1"},
+		{name: "unverified bearer with auth disabled", headers: map[string]string{"Authorization": "Bearer made-up"}, remote: "10.0.0.1:5000", want: "ip:10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := authenticatedClient(t, tt.keys, tt.headers, tt.remote)
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("rateLimitClient() = %q, want prefix %q", got, tt.want)
+			}
+			if strings.Contains(got, "secret") {
+				t.Errorf("rateLimitClient() = %q exposes the credential", got)
+			}
+		})
+	}
+
+	keys := []string{"secret"}
+	apiKey := authenticatedClient(t, keys, map[string]string{"X-Api-Key": "secret"}, "10.0.0.1:5000")
+	bearer := authenticatedClient(t, keys, map[string]string{"Authorization": "Bearer secret"}, "10.0.0.2:5000")
+	if apiKey != bearer {
+		t.Error("the same key sent in different headers counts as different clients")
+	}
+}
+
+// authenticatedClient runs a request through requireAuth with the given API
+// keys and returns the client it counts against for rate limiting.
+func authenticatedClient(t *testing.T, keys []string, headers map[string]string, remote string) (client string) {
+	t.Helper()
+
+	s := &Server{
+		logger: &mockLogger{},
+		auth:   newAuthenticator(config.Config{APIKeys: keys}),
+	}
+	handler := s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		client = rateLimitClient(r)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/search", nil)
+	req.RemoteAddr = remote
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	handler(httptest.NewRecorder(), req)
+
+	if client == "" {
+		t.Fatalf("request with headers %v was not authenticated", headers)
+	}
+	return client
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool
+		requests   int
+		wantStatus int
+		wantReason string
+		wantCode   ErrorCode
+	}{
+		{name: "within limits", body: `{"query":"retry"}`, requests: 2, wantStatus: http.StatusOK},
+		{name: "rate limited", body: `{"query":"retry"}`, requests: 3, wantStatus: http.StatusTooManyRequests, wantReason: "rate_limited", wantCode: CodeRateLimited},
+		{name: "declared body too large", body: `{"query":"` + strings.Repeat("x", 2048) + `"}`, requests: 1, wantStatus: http.StatusRequestEntityTooLarge, wantReason: "body_too_large", wantCode: CodeRequestTooLarge},
+		{name: "streamed body too large", body: `{"query":"` + strings.Repeat("x", 2048) + `"}`, chunked: true, requests: 1, wantStatus: http.StatusRequestEntityTooLarge, wantReason: "body_too_large", wantCode: CodeRequestTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			s := &Server{
+				config:  config.Config{MaxRequestBodyKB: 1},
+				metrics: metrics.NewWithRegisterer(reg),
+				limiter: newRateLimiter(1, 2),
+			}
+
+			// Decodes the body as the search handler does.
+			handler := s.limit("/api/v1/search", func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]string
+				decodeErr := json.NewDecoder(r.Body).Decode(&req)
+				if s.bodyTooLarge(w, r, "/api/v1/search", decodeErr) {
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			var w *httptest.ResponseRecorder
+			for range tt.requests {
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/search", bytes.NewReader([]byte(tt.body)))
+				if tt.chunked {
+					req.ContentLength = -1
+				}
+				w = httptest.NewRecorder()
+				handler(w, req)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantReason == "" {
+				return
+			}
+
+			var body errorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &body)
+			if err != nil || body.Error.Message == "" || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("body = %q, want a JSON error", w.Body.String())
+			}
+			if body.Error.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Error.Code, tt.wantCode)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+				t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+			}
+			// Only one reason is hit per case, so the endpoint's series is it.
+			rejected := counterValue(t, reg, "code_indexer_requests_rejected_total", "/api/v1/search")
+			if rejected != 1 {
+				t.Errorf("rejected %s = %v, want 1", tt.wantReason, rejected)
+			}
+		})
+	}
+}
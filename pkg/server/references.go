@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// defaultReferencesLimit is how many declarations a references request
+// returns when it doesn't set limit.
+const defaultReferencesLimit = 100
+
+// symbolPattern matches a package-qualified symbol: a package name and one
+// or two identifiers, such as retry.Do or retry.Policy.Next.
+//
+//nolint:gochecknoglobals // compiled once
+var symbolPattern = regexp.MustCompile(`^[A-Za-z_]\w*(\.[A-Za-z_]\w*){1,2}$`)
+
+// Reference types.
+const (
+	ReferenceCall  = "call"
+	ReferenceUsage = "reference"
+)
+
+// Reference is a declaration that uses a symbol. Type is ReferenceCall when
+// it calls the symbol and ReferenceUsage when it only refers to it, such as
+// a type in its signature or a function passed as a value. Lines lists the
+// lines the symbol's name appears on.
+type Reference struct {
+	ID           string `json:"id,omitempty"`
+	Repo         string `json:"repo"`
+	FilePath     string `json:"file_path"`
+	FunctionName string `json:"function_name"`
+	Kind         string `json:"kind"`
+	StartLine    int    `json:"start_line,omitempty"`
+	EndLine      int    `json:"end_line,omitempty"`
+	Commit       string `json:"commit,omitempty"`
+	SourceURL    string `json:"source_url,omitempty"`
+	Type         string `json:"type"`
+	Lines        []int  `json:"lines,omitempty"`
+}
+
+// ReferencesResponse lists the references to a symbol.
+type ReferencesResponse struct {
+	Symbol     string      `json:"symbol"`
+	References []Reference `json:"references"`
+}
+
+// handleReferences answers who calls or uses a symbol:
+// GET /api/v1/references?symbol=retry.Do lists the indexed declarations
+// that do, optionally only in the repositories named by repo parameters and
+// at most limit of them. The chunks of a chunked declaration are merged
+// into one reference.
+func (s *Server) handleReferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	symbol := strings.TrimSpace(params.Get("symbol"))
+	if !symbolPattern.MatchString(symbol) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "symbol must be package-qualified, such as retry.Do or retry.Policy.Next")
+		return
+	}
+
+	limit, msg := s.queryLimit(params.Get("limit"), defaultReferencesLimit)
+	if msg != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, msg)
+		return
+	}
+
+	docs, err := s.es.References(r.Context(), symbol, params["repo"], limit)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "References error", "symbol", symbol, "error", err)
+		writeESError(w, r, "Failed to find references", err)
+		return
+	}
+
+	resp := ReferencesResponse{Symbol: symbol, References: s.references(symbol, docs)}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// queryLimit parses a limit query parameter, returning defaultLimit when
+// it's empty. Neither may exceed SEARCH_MAX_LIMIT. It describes a limit
+// that isn't a number in range, or returns "" when it's valid.
+func (s *Server) queryLimit(raw string, defaultLimit int) (limit int, msg string) {
+	maxLimit := s.config.SearchMaxLimit
+	limit = defaultLimit
+	if maxLimit > 0 {
+		limit = min(limit, maxLimit)
+	}
+	if raw == "" {
+		return limit, msg
+	}
+
+	parsed, parseErr := strconv.Atoi(raw)
+	if parseErr != nil || parsed < 1 || (maxLimit > 0 && parsed > maxLimit) {
+		msg = "limit must be a positive number"
+		if maxLimit > 0 {
+			msg = fmt.Sprintf("limit must be between 1 and %d", maxLimit)
+		}
+		return limit, msg
+	}
+	limit = parsed
+	return limit, msg
+}
+
+// references turns the declarations using symbol into references, merging
+// the chunks and copies of each declaration.
+func (s *Server) references(symbol string, docs []elasticsearch.CodeDocument) (refs []Reference) {
+	refs = []Reference{}
+	name := symbol[strings.LastIndex(symbol, ".")+1:]
+	word := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+
+	merged := make(map[string]int)
+	for _, doc := range docs {
+		lines := usageLines(doc, word)
+
+		key := doc.Repo + "\x00" + doc.FilePath + "\x00" + doc.FunctionName + "\x00" + doc.ContentHash
+		i, found := merged[key]
+		if found {
+			ref := &refs[i]
+			ref.StartLine = min(ref.StartLine, doc.StartLine)
+			ref.EndLine = max(ref.EndLine, doc.EndLine)
+			for _, line := range lines {
+				if !slices.Contains(ref.Lines, line) {
+					ref.Lines = append(ref.Lines, line)
+				}
+			}
+			slices.Sort(ref.Lines)
+			continue
+		}
+		merged[key] = len(refs)
+
+		refType := ReferenceUsage
+		if slices.Contains(doc.Callees, symbol) {
+			refType = ReferenceCall
+		}
+		refs = append(refs, Reference{
+			ID:           doc.ID,
+			Repo:         doc.Repo,
+			FilePath:     doc.FilePath,
+			FunctionName: doc.FunctionName,
+			Kind:         doc.Kind,
+			StartLine:    doc.StartLine,
+			EndLine:      doc.EndLine,
+			Commit:       doc.Commit,
+			SourceURL:    s.sourceURL(doc),
+			Type:         refType,
+			Lines:        lines,
+		})
+	}
+	return refs
+}
+
+// usageLines returns the lines of a declaration's code that mention a
+// symbol's name as a whole word, or none when its start line isn't known.
+func usageLines(doc elasticsearch.CodeDocument, word *regexp.Regexp) (lines []int) {
+	if doc.StartLine == 0 {
+		return lines
+	}
+
+	for i, line := range strings.Split(doc.Code, "\n") {
+		if word.MatchString(line) {
+			lines = append(lines, doc.StartLine+i)
+		}
+	}
+	return lines
+}
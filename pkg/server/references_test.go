@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandleReferences(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"hits":{"hits":[` +
+			`{"_id":"h","_source":{"repo":"api","file_path":"server/handler.go","function_name":"Handle","kind":"function","start_line":10,"end_line":14,"commit":"abc","content_hash":"x","callees":["retry.Do"],` +
+			`"code":"func Handle() error {\n\treturn retry.Do(work)\n}"}},` +
+			`{"_id":"w0","_source":{"repo":"api","file_path":"worker/worker.go","function_name":"Run","kind":"function","start_line":20,"end_line":40,"content_hash":"y","chunk_index":0,"uses":["retry.Do"],` +
+			`"code":"func Run() {\n\tf := retry.Do"}},` +
+			`{"_id":"w1","_source":{"repo":"api","file_path":"worker/worker.go","function_name":"Run","kind":"function","start_line":41,"end_line":60,"content_hash":"y","chunk_index":1,"uses":["retry.Do"],` +
+			`"code":"\tg := retry.Do\n}"}}]}}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{ESHost: es.URL, ESIndex: "test-index", SearchMaxLimit: 50, SourceURLTemplate: "https://git.example.com/{repo}/{path}"}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	logger := &mockLogger{}
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		es:      client,
+		config:  cfg,
+		metrics: m,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	for _, target := range []string{"/api/v1/references", "/api/v1/references?symbol=Do", "/api/v1/references?symbol=retry.Do&limit=51", "/api/v1/references?symbol=retry.Do&limit=x"} {
+		w := httptest.NewRecorder()
+		server.handleReferences(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.handleReferences(w, httptest.NewRequest(http.MethodGet, "/api/v1/references?symbol=retry.Do&repo=api", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp ReferencesResponse
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Symbol != "retry.Do" || len(resp.References) != 2 {
+		t.Fatalf("Response = %+v, want Handle and Run's chunks merged", resp)
+	}
+	handle, run := resp.References[0], resp.References[1]
+	if handle.Type != ReferenceCall || len(handle.Lines) != 1 || handle.Lines[0] != 11 || !strings.HasPrefix(handle.SourceURL, "https://git.example.com/api/") {
+		t.Errorf("Handle = %+v, want a call on line 11 with a source URL", handle)
+	}
+	if run.Type != ReferenceUsage || run.StartLine != 20 || run.EndLine != 60 || len(run.Lines) != 2 || run.Lines[0] != 21 || run.Lines[1] != 41 {
+		t.Errorf("Run = %+v, want a reference on lines 21 and 41 spanning 20-60", run)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// maxRerankTextBytes caps the text sent to the reranker per document. Cross
+// encoders only read a few hundred tokens, so the rest would be wasted
+// bandwidth.
+const maxRerankTextBytes = 4096
+
+// search runs a search request, rewriting its query first when Rewrite is
+// set. With Rerank set, the top RERANK_TOP_K results are scored by the
+// reranker against the original query and the best Limit returned in its
+// order. If the reranker fails, the search degrades to Elasticsearch's order
+// rather than failing, and reranked is false.
+func (s *Server) search(ctx context.Context, req elasticsearch.SearchRequest) (results []elasticsearch.CodeDocument, reranked bool, rewrites []string, err error) {
+	if !req.Rerank || s.reranker == nil {
+		results, rewrites, err = s.retrieve(ctx, req)
+		return results, reranked, rewrites, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	candidates := req
+	candidates.Limit = max(limit, s.config.RerankTopK)
+	results, rewrites, err = s.retrieve(ctx, candidates)
+	if err != nil || len(results) == 0 {
+		return results, reranked, rewrites, err
+	}
+
+	texts := make([]string, len(results))
+	for i, doc := range results {
+		texts[i] = rerankText(doc)
+	}
+
+	start := time.Now()
+	scores, rerankErr := s.reranker.Rerank(ctx, req.Query, texts)
+	s.observeRerank(time.Since(start), rerankErr)
+	if rerankErr != nil {
+		s.logger.WarnContext(ctx, "Reranking failed, returning results unreranked", "query", req.Query, "error", rerankErr)
+		results = results[:min(limit, len(results))]
+		return results, reranked, rewrites, err
+	}
+
+	for i := range results {
+		results[i].RerankScore = scores[i]
+	}
+	slices.SortStableFunc(results, func(a, b elasticsearch.CodeDocument) int {
+		return cmp.Compare(b.RerankScore, a.RerankScore)
+	})
+
+	results = results[:min(limit, len(results))]
+	reranked = true
+	return results, reranked, rewrites, err
+}
+
+// rerankText is the text a document is scored by: its qualified name and
+// the start of its code.
+func rerankText(doc elasticsearch.CodeDocument) (text string) {
+	text = doc.EmbeddingText()
+	if len(text) > maxRerankTextBytes {
+		text = strings.ToValidUTF8(text[:maxRerankTextBytes], "")
+	}
+	return text
+}
+
+// observeRerank records the latency of a reranking call.
+func (s *Server) observeRerank(elapsed time.Duration, err error) {
+	if s.metrics == nil {
+		return
+	}
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	s.metrics.RerankDuration.WithLabelValues(status).Observe(elapsed.Seconds())
+}
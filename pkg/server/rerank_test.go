@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHandleSearchRerank(t *testing.T) {
+	var esQuery string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test-index/_search" {
+			body, _ := io.ReadAll(r.Body)
+			esQuery = string(body)
+			_, _ = w.Write([]byte(`{"hits":{"hits":[
+				{"_score":3,"_source":{"function_name":"First","code":"a"}},
+				{"_score":2,"_source":{"function_name":"Second","code":"b"}},
+				{"_score":1,"_source":{"function_name":"Third","code":"c"}}
+			]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer es.Close()
+
+	rerankStatus := http.StatusOK
+	reranker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(rerankStatus)
+		_, _ = w.Write([]byte(`{"results":[{"index":0,"relevance_score":0.1},{"index":1,"relevance_score":0.5},{"index":2,"relevance_score":0.9}]}`))
+	}))
+	defer reranker.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index", RerankTopK: 30, RerankTimeout: time.Second}
+	withReranker := cfg
+	withReranker.RerankURL = reranker.URL
+	withReranker.RerankAPI = config.RerankAPICohere
+	withReranker.RerankModel = "rerank-v3"
+
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		cfg          config.Config
+		rerankStatus int
+		wantStatus   int
+		wantReranked bool
+		wantNames    []string
+	}{
+		{name: "reordered", cfg: withReranker, rerankStatus: http.StatusOK, wantStatus: http.StatusOK, wantReranked: true, wantNames: []string{"Third", "Second"}},
+		{name: "reranker down", cfg: withReranker, rerankStatus: http.StatusServiceUnavailable, wantStatus: http.StatusOK, wantNames: []string{"First", "Second"}},
+		{name: "not configured", cfg: cfg, wantStatus: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rerankStatus = tt.rerankStatus
+			logger := &mockLogger{}
+			server := New(indexer.New(tt.cfg, nil, nil, logger), client, tt.cfg, m, logger)
+
+			body := []byte(`{"query": "retry", "limit": 2, "rerank": true}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/search", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			server.handleSearch(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !strings.Contains(esQuery, `"size":30`) {
+				t.Errorf("ES query = %s, want RERANK_TOP_K candidates", esQuery)
+			}
+
+			var resp SearchResponse
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if resp.Reranked != tt.wantReranked {
+				t.Errorf("Reranked = %v, want %v", resp.Reranked, tt.wantReranked)
+			}
+			var names []string
+			for _, result := range resp.Results {
+				names = append(names, result.FunctionName)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("results = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+
+	if testutil.CollectAndCount(m.RerankDuration) != 2 {
+		t.Errorf("rerank duration series = %d, want success and error", testutil.CollectAndCount(m.RerankDuration))
+	}
+}
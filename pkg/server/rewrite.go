@@ -0,0 +1,95 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// fusionK damps the weight reciprocal rank fusion gives to the top ranks, so
+// a document ranked well by several searches beats one ranked first by one.
+const fusionK = 60
+
+// retrieve runs a search request. With Rewrite set, the query is rewritten
+// into keyword queries, which are searched along with the original in one
+// multi-search and their results fused by reciprocal rank. If rewriting
+// fails, only the original query is searched, and rewrites is empty.
+func (s *Server) retrieve(ctx context.Context, req elasticsearch.SearchRequest) (results []elasticsearch.CodeDocument, rewrites []string, err error) {
+	if !req.Rewrite || s.rewriter == nil {
+		results, err = s.es.SearchWithOptions(ctx, req)
+		return results, rewrites, err
+	}
+
+	start := time.Now()
+	rewrites, err = s.rewriter.Rewrite(ctx, req.Query)
+	s.observeRewrite(time.Since(start), err)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Query rewriting failed, searching the original query", "query", req.Query, "error", err)
+		rewrites = nil
+		err = nil
+	}
+	if len(rewrites) == 0 {
+		results, err = s.es.SearchWithOptions(ctx, req)
+		return results, rewrites, err
+	}
+
+	searches := make([]elasticsearch.SearchRequest, 0, len(rewrites)+1)
+	searches = append(searches, req)
+	for _, query := range rewrites {
+		rewritten := req
+		rewritten.Query = query
+		searches = append(searches, rewritten)
+	}
+
+	var ranked [][]elasticsearch.CodeDocument
+	ranked, err = s.es.MultiSearch(ctx, searches)
+	if err != nil {
+		return results, rewrites, err
+	}
+
+	results = fuseResults(ranked, req.Limit)
+	return results, rewrites, err
+}
+
+// fuseResults merges ranked result lists by reciprocal rank fusion: each
+// document scores the sum of 1/(fusionK+rank) over the lists it appears in,
+// and the best limit are returned. A document found by several searches
+// keeps the copy, and Elasticsearch score, of the first list it appears in.
+func fuseResults(ranked [][]elasticsearch.CodeDocument, limit int) (results []elasticsearch.CodeDocument) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	scores := map[string]float64{}
+	for _, list := range ranked {
+		for rank, doc := range list {
+			if _, seen := scores[doc.ID]; !seen {
+				results = append(results, doc)
+			}
+			scores[doc.ID] += 1 / float64(fusionK+rank+1)
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b elasticsearch.CodeDocument) int {
+		return cmp.Compare(scores[b.ID], scores[a.ID])
+	})
+
+	results = results[:min(limit, len(results))]
+	return results
+}
+
+// observeRewrite records the latency of a rewriting call.
+func (s *Server) observeRewrite(elapsed time.Duration, err error) {
+	if s.metrics == nil {
+		return
+	}
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	s.metrics.RewriteDuration.WithLabelValues(status).Observe(elapsed.Seconds())
+}
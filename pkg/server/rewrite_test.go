@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFuseResults(t *testing.T) {
+	docs := func(ids ...string) (list []elasticsearch.CodeDocument) {
+		for _, id := range ids {
+			list = append(list, elasticsearch.CodeDocument{ID: id})
+		}
+		return list
+	}
+
+	tests := []struct {
+		name   string
+		ranked [][]elasticsearch.CodeDocument
+		limit  int
+		want   []string
+	}{
+		{name: "single list keeps its order", ranked: [][]elasticsearch.CodeDocument{docs("a", "b", "c")}, limit: 10, want: []string{"a", "b", "c"}},
+		{name: "agreement beats one top rank", ranked: [][]elasticsearch.CodeDocument{docs("a", "b"), docs("c", "b")}, limit: 10, want: []string{"b", "a", "c"}},
+		{name: "limited", ranked: [][]elasticsearch.CodeDocument{docs("a", "b"), docs("c", "d")}, limit: 2, want: []string{"a", "c"}},
+		{name: "empty", ranked: [][]elasticsearch.CodeDocument{nil, nil}, limit: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			for _, doc := range fuseResults(tt.ranked, tt.limit) {
+				ids = append(ids, doc.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("fuseResults() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSearchRewrite(t *testing.T) {
+	var searches int
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/test-index/_msearch":
+			searches = strings.Count(r.Header.Get("Content-Type"), "ndjson")
+			_, _ = w.Write([]byte(`{"responses":[
+				{"status":200,"hits":{"hits":[{"_id":"1","_score":2,"_source":{"function_name":"Retry"}},{"_id":"2","_score":1,"_source":{"function_name":"Backoff"}}]}},
+				{"status":200,"hits":{"hits":[{"_id":"2","_score":5,"_source":{"function_name":"Backoff"}}]}},
+				{"status":200,"hits":{"hits":[{"_id":"2","_score":4,"_source":{"function_name":"Backoff"}},{"_id":"3","_score":3,"_source":{"function_name":"Do"}}]}}
+			]}`))
+		case "/test-index/_search":
+			_, _ = w.Write([]byte(`{"hits":{"hits":[{"_id":"1","_score":2,"_source":{"function_name":"Retry"}}]}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	rewriteStatus := http.StatusOK
+	var prompt string
+	rewriter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		w.WriteHeader(rewriteStatus)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"queries\":[\"retry backoff\",\"http Do retry\"]}"}}]}`))
+	}))
+	defer rewriter.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index"}
+	withRewriter := cfg
+	withRewriter.RewriteURL = rewriter.URL
+	withRewriter.RewriteModel = "gpt-4o-mini"
+	withRewriter.RewriteTimeout = time.Second
+	withRewriter.RewriteMaxQueries = 3
+
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		rewriteStatus int
+		wantStatus    int
+		wantRewrites  []string
+		wantNames     []string
+	}{
+		{name: "rewritten and fused", cfg: withRewriter, rewriteStatus: http.StatusOK, wantStatus: http.StatusOK, wantRewrites: []string{"retry backoff", "http Do retry"}, wantNames: []string{"Backoff", "Retry", "Do"}},
+		{name: "rewriter down", cfg: withRewriter, rewriteStatus: http.StatusServiceUnavailable, wantStatus: http.StatusOK, wantNames: []string{"Retry"}},
+		{name: "not configured", cfg: cfg, wantStatus: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewriteStatus = tt.rewriteStatus
+			searches = 0
+			logger := &mockLogger{}
+			server := New(indexer.New(tt.cfg, nil, nil, logger), client, tt.cfg, m, logger)
+
+			body := []byte(`{"query": "functions that retry HTTP calls", "limit": 5, "rewrite": true}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/search", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			server.handleSearch(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if prompt != "functions that retry HTTP calls" {
+				t.Errorf("rewrite prompt = %q, want the original query", prompt)
+			}
+			if w.Header().Get("ETag") != "" {
+				t.Errorf("ETag = %q, want none for a rewritten search", w.Header().Get("ETag"))
+			}
+			if (searches > 0) != (len(tt.wantRewrites) > 0) {
+				t.Errorf("multi-search used = %v, want %v", searches > 0, len(tt.wantRewrites) > 0)
+			}
+
+			var resp SearchResponse
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if strings.Join(resp.Rewrites, ",") != strings.Join(tt.wantRewrites, ",") {
+				t.Errorf("Rewrites = %v, want %v", resp.Rewrites, tt.wantRewrites)
+			}
+			var names []string
+			for _, result := range resp.Results {
+				names = append(names, result.FunctionName)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("results = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+
+	if testutil.CollectAndCount(m.RewriteDuration) != 2 {
+		t.Errorf("rewrite duration series = %d, want success and error", testutil.CollectAndCount(m.RewriteDuration))
+	}
+}
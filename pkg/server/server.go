@@ -6,31 +6,69 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nikogura/rag-indexer/pkg/config"
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/embedding"
 	"github.com/nikogura/rag-indexer/pkg/indexer"
 	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/nikogura/rag-indexer/pkg/output"
+	"github.com/nikogura/rag-indexer/pkg/rerank"
+	"github.com/nikogura/rag-indexer/pkg/rewrite"
+	"github.com/nikogura/rag-indexer/pkg/usage"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Server handles HTTP API requests.
 type Server struct {
-	indexer *indexer.Indexer
-	es      *elasticsearch.Client
-	config  config.Config
-	logger  logging.Logger
+	indexer  *indexer.Indexer
+	es       *elasticsearch.Client
+	config   config.Config
+	metrics  *metrics.Metrics
+	logger   logging.Logger
+	auth     *authenticator
+	usage    *usage.Recorder
+	limiter  *rateLimiter
+	embedder *embedding.Client
+	reranker *rerank.Client
+	rewriter *rewrite.Client
+	tenants  map[string]*Server
+	// closing is closed when the server shuts down, ending event streams,
+	// which would otherwise hold up the shutdown.
+	closing chan struct{}
 }
 
 // New creates a new HTTP server instance.
-func New(idx *indexer.Indexer, es *elasticsearch.Client, cfg config.Config, logger logging.Logger) (server *Server) {
+func New(idx *indexer.Indexer, es *elasticsearch.Client, cfg config.Config, m *metrics.Metrics, logger logging.Logger) (server *Server) {
+	// Without EMBEDDING_URL the embedder stays nil and vector similarity is
+	// unavailable. Query snippets aren't worth keeping in the cache index.
+	embedder, _ := embedding.New(cfg, m, nil)
+	reranker, _ := rerank.New(cfg)
+	rewriter, _ := rewrite.New(cfg)
+
 	server = &Server{
-		indexer: idx,
-		es:      es,
-		config:  cfg,
-		logger:  logger,
+		indexer:  idx,
+		es:       es,
+		config:   cfg,
+		metrics:  m,
+		logger:   logger,
+		auth:     newAuthenticator(cfg),
+		usage:    usage.New(cfg),
+		limiter:  newRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst),
+		embedder: embedder,
+		reranker: reranker,
+		rewriter: rewriter,
+		closing:  make(chan struct{}),
 	}
 	return server
 }
@@ -39,15 +77,103 @@ func New(idx *indexer.Indexer, es *elasticsearch.Client, cfg config.Config, logg
 func (s *Server) Start(ctx context.Context) (err error) {
 	mux := http.NewServeMux()
 
+	// API endpoints require authentication and count toward the latency SLO.
+	// Those that reach Elasticsearch or start work are also rate limited.
+	// Each is served for a tenant too, under /t/{tenant} or with X-Tenant.
+	bind := func(t *Server, handler func(*Server, http.ResponseWriter, *http.Request)) (h http.HandlerFunc) {
+		h = func(w http.ResponseWriter, r *http.Request) { handler(t, w, r) }
+		return h
+	}
+	api := func(pattern string, handler func(*Server, http.ResponseWriter, *http.Request)) {
+		s.handleTenants(mux, pattern, func(t *Server) (h http.HandlerFunc) {
+			h = t.observeSLO(pattern, t.requireAuth(bind(t, handler)))
+			return h
+		})
+	}
+	limitedAPI := func(pattern string, handler func(*Server, http.ResponseWriter, *http.Request)) {
+		s.handleTenants(mux, pattern, func(t *Server) (h http.HandlerFunc) {
+			h = t.observeSLO(pattern, t.requireAuth(t.limit(pattern, bind(t, handler))))
+			return h
+		})
+	}
+	// Event streams stay open as long as what they follow, so they don't
+	// count toward the latency SLO.
+	stream := func(pattern string, handler func(*Server, http.ResponseWriter, *http.Request)) {
+		s.handleTenants(mux, pattern, func(t *Server) (h http.HandlerFunc) {
+			h = t.requireAuth(bind(t, handler))
+			return h
+		})
+	}
+
 	mux.HandleFunc("/health", s.handleHealth)
 	mux.HandleFunc("/ready", s.handleReady)
-	mux.HandleFunc("/api/v1/search", s.handleSearch)
-	mux.HandleFunc("/api/v1/reindex", s.handleReindex)
-	mux.Handle("/metrics", promhttp.Handler())
+	api("/healthz/detail", (*Server).handleHealthDetail)
+	limitedAPI("/api/v1/search", (*Server).handleSearch)
+	limitedAPI("/api/v1/msearch", (*Server).handleMultiSearch)
+	limitedAPI("/api/v1/facets", (*Server).handleFacets)
+	limitedAPI("/api/v1/similar", (*Server).handleSimilar)
+	limitedAPI("/api/v1/documents/{id}", (*Server).handleDocument)
+	limitedAPI("/api/v1/context", (*Server).handleContext)
+	limitedAPI("/api/v1/references", (*Server).handleReferences)
+	limitedAPI("/api/v1/markers", (*Server).handleMarkers)
+	limitedAPI("/api/v1/reindex", (*Server).handleReindex)
+	api("/api/v1/reindex/{id}", (*Server).handleReindexStatus)
+	stream("/api/v1/reindex/{id}/events", (*Server).handleReindexEvents)
+	stream("/api/v1/events", (*Server).handleEvents)
+	limitedAPI("/api/v1/files", (*Server).handleIndexFile)
+	limitedAPI("/api/v1/repos/{name...}", (*Server).handleDeleteRepo)
+	api("/api/v1/parse-errors", (*Server).handleParseErrors)
+	api("/api/v1/deadletter", (*Server).handleDeadLetters)
+	limitedAPI("/api/v1/deadletter/replay", (*Server).handleReplayDeadLetters)
+	api("/api/v1/stats", (*Server).handleStats)
+	api("/api/v1/indexing", (*Server).handleIndexingStatus)
+	api("/api/v1/indexing/pause", (*Server).handlePause)
+	api("/api/v1/indexing/resume", (*Server).handleResume)
+	api("/api/v1/embeddings/backfill", (*Server).handleBackfill)
+	api("/api/v1/usage", (*Server).handleUsage)
+	api("/api/v1/snapshots", (*Server).handleSnapshots)
+	api("/api/v1/snapshots/{name}/restore", (*Server).handleRestoreSnapshot)
+	mux.Handle("/metrics", metricsHandler())
+
+	if s.metrics != nil {
+		s.metrics.SLOLatencyThreshold.Set(s.config.SLOLatencyThreshold.Seconds())
+		s.metrics.SLOObjective.Set(s.config.SLOObjective)
+	}
+
+	err = s.serve(ctx, mux)
+	return err
+}
+
+// StartMetrics serves only /health and /metrics on HTTP_ADDR, for queue
+// workers, which take no API requests. It blocks until ctx ends.
+func (s *Server) StartMetrics(ctx context.Context) (err error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.Handle("/metrics", metricsHandler())
+
+	err = s.serve(ctx, mux)
+	return err
+}
+
+// serve runs the HTTP server on HTTP_ADDR, over TLS when configured, until
+// ctx ends.
+func (s *Server) serve(ctx context.Context, mux *http.ServeMux) (err error) {
+	tlsConfig, err := newTLSConfig(s.config)
+	if err != nil {
+		return err
+	}
 
 	srv := &http.Server{
-		Addr:    s.config.HTTPAddr,
-		Handler: mux,
+		Addr:         s.config.HTTPAddr,
+		TLSConfig:    tlsConfig,
+		Handler:      s.middleware(mux),
+		ReadTimeout:  s.config.HTTPReadTimeout,
+		WriteTimeout: s.config.HTTPWriteTimeout,
+		IdleTimeout:  s.config.HTTPIdleTimeout,
+	}
+
+	if s.closing != nil {
+		srv.RegisterOnShutdown(func() { close(s.closing) })
 	}
 
 	go func() {
@@ -57,8 +183,14 @@ func (s *Server) Start(ctx context.Context) (err error) {
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	s.logger.Info("Starting HTTP server", "address", s.config.HTTPAddr)
-	err = srv.ListenAndServe()
+	if tlsConfig != nil {
+		s.logger.Info("Starting HTTPS server", "address", s.config.HTTPAddr, "client_certs", s.config.TLSClientCAFile != "")
+		// The certificate comes from TLSConfig.GetCertificate.
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		s.logger.Info("Starting HTTP server", "address", s.config.HTTPAddr)
+		err = srv.ListenAndServe()
+	}
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		err = fmt.Errorf("server error: %w", err)
 		return err
@@ -67,17 +199,82 @@ func (s *Server) Start(ctx context.Context) (err error) {
 	return err
 }
 
+// metricsHandler serves the default registry with OpenMetrics negotiation enabled
+// so exemplars, such as the failing file on parse errors, reach scrapers that ask for them.
+func metricsHandler() (handler http.Handler) {
+	handler = promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	)
+	return handler
+}
+
+// esErrorStatus maps an Elasticsearch error class to the HTTP status returned to clients.
+func esErrorStatus(err error) (status int) {
+	switch {
+	case errors.Is(err, elasticsearch.ErrBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, elasticsearch.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, elasticsearch.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, elasticsearch.ErrUnavailable):
+		status = http.StatusServiceUnavailable
+	default:
+		status = http.StatusInternalServerError
+	}
+	return status
+}
+
+// observeSearch records a search for the endpoint that started at start.
+func (s *Server) observeSearch(endpoint string, start time.Time, results int, err error) {
+	if s.metrics != nil {
+		s.metrics.ObserveSearch(endpoint, time.Since(start), results, err != nil)
+	}
+}
+
+// observeReindexTrigger counts a reindex requested through the API by the
+// outcome of starting it.
+func (s *Server) observeReindexTrigger(err error) {
+	if s.metrics == nil {
+		return
+	}
+
+	result := "started"
+	switch {
+	case errors.Is(err, indexer.ErrReindexInProgress):
+		result = "in_progress"
+	case errors.Is(err, indexer.ErrShuttingDown):
+		result = "shutting_down"
+	case err != nil:
+		result = "error"
+	}
+	s.metrics.ReindexTriggers.WithLabelValues(result).Inc()
+}
+
+// writeESError writes msg with the status and error code matching the
+// Elasticsearch error, adding Retry-After when the failure is transient.
+func writeESError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	status := esErrorStatus(err)
+	if status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout {
+		w.Header().Set("Retry-After", "5")
+	}
+	writeError(w, r, status, statusErrorCode(status), msg)
+}
+
 // handleHealth is the liveness probe endpoint.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = fmt.Fprintf(w, "OK")
 }
 
-// handleReady is the readiness probe endpoint.
+// handleReady is the readiness probe endpoint. It fails while shutting down so
+// traffic moves elsewhere during the drain, and, with READY_FAIL_STALE, while
+// a repository's index is stale.
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
-	readyErr := s.es.Ping()
-	if readyErr != nil {
-		http.Error(w, "Elasticsearch unavailable", http.StatusServiceUnavailable)
+	detail := s.health(r.Context())
+	if detail.Status == healthUnavailable {
+		http.Error(w, detail.Reason, http.StatusServiceUnavailable)
 		return
 	}
 
@@ -85,52 +282,1057 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(w, "READY")
 }
 
+// Statuses of the detailed health report.
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"
+	healthUnavailable = "unavailable"
+)
+
+// healthDetail is the detailed health report: whether the server is ready,
+// and if not why, along with the freshness of each repository's index.
+type healthDetail struct {
+	Status        string               `json:"status"`
+	Reason        string               `json:"reason,omitempty"`
+	Elasticsearch string               `json:"elasticsearch"`
+	Draining      bool                 `json:"draining"`
+	StaleAfter    string               `json:"stale_after,omitempty"`
+	Repos         []indexer.RepoHealth `json:"repos"`
+}
+
+// health checks what readiness depends on. The status is unavailable while
+// draining, without Elasticsearch, or with a stale repository under
+// READY_FAIL_STALE; degraded with a stale repository otherwise; and ok
+// when none of those hold.
+func (s *Server) health(ctx context.Context) (detail healthDetail) {
+	detail = healthDetail{
+		Status:        healthOK,
+		Elasticsearch: "connected",
+		Repos:         []indexer.RepoHealth{},
+	}
+	if s.config.IndexStaleAfter > 0 {
+		detail.StaleAfter = s.config.IndexStaleAfter.String()
+	}
+
+	var stale []string
+	if s.indexer != nil {
+		detail.Draining = s.indexer.Draining()
+		detail.Repos = s.indexer.RepoHealth(ctx, time.Now())
+		for _, repo := range detail.Repos {
+			if repo.Stale {
+				stale = append(stale, repo.Repo)
+			}
+		}
+	}
+
+	switch {
+	case !s.es.Ready():
+		detail.Elasticsearch = "not_connected"
+	case s.es.Ping() != nil:
+		detail.Elasticsearch = "unavailable"
+	}
+
+	switch {
+	case detail.Draining:
+		detail.Status, detail.Reason = healthUnavailable, "Shutting down"
+	case detail.Elasticsearch == "not_connected":
+		detail.Status, detail.Reason = healthUnavailable, "Elasticsearch not connected"
+	case detail.Elasticsearch == "unavailable":
+		detail.Status, detail.Reason = healthUnavailable, "Elasticsearch unavailable"
+	case len(stale) > 0 && s.config.ReadyFailStale:
+		detail.Status, detail.Reason = healthUnavailable, "Index stale: "+strings.Join(stale, ", ")
+	case len(stale) > 0:
+		detail.Status, detail.Reason = healthDegraded, "Index stale: "+strings.Join(stale, ", ")
+	}
+	return detail
+}
+
+// handleHealthDetail reports readiness as JSON, with the freshness of each
+// repository's index. It responds 503 whenever /ready would.
+func (s *Server) handleHealthDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	detail := s.health(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if detail.Status == healthUnavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(detail)
+}
+
 // handleSearch handles search requests.
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req elasticsearch.SearchRequest
 	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if s.bodyTooLarge(w, r, "/api/v1/search", decodeErr) {
+		return
+	}
 	if decodeErr != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
 		return
 	}
 
-	if req.Query == "" {
-		http.Error(w, "Query is required", http.StatusBadRequest)
+	if req.Debug && !s.auth.admin(r) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Debug requires an admin API key")
 		return
 	}
 
-	results, searchErr := s.es.Search(r.Context(), req.Query, req.Limit)
+	if !s.validSearch(w, r, &req) {
+		return
+	}
+
+	// A model may rewrite the same query differently each time, so
+	// rewritten searches get no ETag.
+	etag := ""
+	if !req.Rewrite {
+		etag = s.searchETag(r.Context(), req)
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		writeNotModified(w, etag)
+		return
+	}
+
+	start := time.Now()
+	results, reranked, rewrites, searchErr := s.search(r.Context(), req)
+	s.observeSearch("search", start, len(results), searchErr)
 	if searchErr != nil {
-		s.logger.Error("Search error", "query", req.Query, "error", searchErr)
-		http.Error(w, "Search failed", http.StatusInternalServerError)
+		s.logger.ErrorContext(r.Context(), "Search error", "query", req.Query, "error", searchErr)
+		writeESError(w, r, "Search failed", searchErr)
 		return
 	}
 
+	results, expanded, withTests := s.expandResults(r.Context(), req, results)
+
+	resp := s.searchResponse(r.Context(), results)
+	resp.Reranked = reranked
+	resp.Rewrites = rewrites
+	s.usage.Record(req.Query, slices.Collect(maps.Keys(resp.Repos)))
+
+	// Results that fell back from a failed rerank, context, or tests lookup
+	// aren't the ones the ETag stands for.
+	if etag != "" && reranked == req.Rerank && expanded == req.IncludeContext && withTests == req.IncludeTests {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	if req.Debug {
+		resp.Debug = &SearchDebug{
+			Index: s.config.ESIndex,
+			Query: s.es.SearchQuery(req),
+		}
+		s.logger.InfoContext(r.Context(), "Search debug", "query", req.Query, "index", resp.Debug.Index, "es_query", resp.Debug.Query, "results", len(results))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(results)
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
-// handleReindex triggers a background reindex operation.
+// validSearch reports whether a search can be served, writing the error
+// response when it can't. Like searchBoundsError, it normalizes the query in
+// place.
+func (s *Server) validSearch(w http.ResponseWriter, r *http.Request, req *elasticsearch.SearchRequest) (valid bool) {
+	boundsErr := s.searchBoundsError(req, true)
+	if boundsErr != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, boundsErr)
+		return valid
+	}
+
+	if req.Sort != "" && req.Sort != elasticsearch.SortComplexity {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid sort")
+		return valid
+	}
+
+	filterErr := searchFilterError(*req)
+	if filterErr != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, filterErr)
+		return valid
+	}
+
+	if req.Rerank && s.reranker == nil {
+		writeError(w, r, http.StatusNotImplemented, CodeNotConfigured, "Reranking is not configured")
+		return valid
+	}
+
+	if req.Rewrite && s.rewriter == nil {
+		writeError(w, r, http.StatusNotImplemented, CodeNotConfigured, "Query rewriting is not configured")
+		return valid
+	}
+
+	valid = true
+	return valid
+}
+
+// expandResults adds the context and tests a search asked for to its
+// results, reporting which were added. Results are still worth returning
+// without their context or tests, so a failed lookup leaves them out.
+func (s *Server) expandResults(ctx context.Context, req elasticsearch.SearchRequest, results []elasticsearch.CodeDocument) (expanded []elasticsearch.CodeDocument, withContext bool, withTests bool) {
+	expanded = results
+	if req.IncludeContext {
+		contextResults, contextErr := s.es.IncludeContext(ctx, expanded)
+		if contextErr != nil {
+			s.logger.WarnContext(ctx, "Failed to look up result context", "query", req.Query, "error", contextErr)
+		} else {
+			expanded = contextResults
+			withContext = true
+		}
+	}
+	if req.IncludeTests {
+		linked, testsErr := s.es.IncludeTests(ctx, expanded)
+		if testsErr != nil {
+			s.logger.WarnContext(ctx, "Failed to look up result tests", "query", req.Query, "error", testsErr)
+		} else {
+			expanded = linked
+			withTests = true
+		}
+	}
+	return expanded, withContext, withTests
+}
+
+// searchFilterError describes the first invalid filter in a search request,
+// or returns "" when the filters are valid.
+func searchFilterError(req elasticsearch.SearchRequest) (msg string) {
+	for _, kind := range req.Kinds {
+		switch kind {
+		case elasticsearch.KindFunction, elasticsearch.KindMethod, elasticsearch.KindType, elasticsearch.KindClass,
+			elasticsearch.KindInterface, elasticsearch.KindConst, elasticsearch.KindVar, elasticsearch.KindSection,
+			elasticsearch.KindResource, elasticsearch.KindData, elasticsearch.KindModule, elasticsearch.KindVariable,
+			elasticsearch.KindOutput, elasticsearch.KindProvider, elasticsearch.KindMessage, elasticsearch.KindService,
+			elasticsearch.KindRPC, elasticsearch.KindFile, elasticsearch.KindPackage:
+		default:
+			msg = "Invalid kind"
+			return msg
+		}
+	}
+
+	for _, docType := range req.Types {
+		if docType != elasticsearch.DocTypeCode && docType != elasticsearch.DocTypeMarkdown {
+			msg = "Invalid type"
+			return msg
+		}
+	}
+
+	for key := range req.Metadata {
+		if !elasticsearch.ValidMetadataKey(key) {
+			msg = "Invalid metadata field"
+			return msg
+		}
+	}
+
+	if req.MaxCyclomaticComplexity < 0 || req.MaxCognitiveComplexity < 0 {
+		msg = "Complexity limits must not be negative"
+		return msg
+	}
+
+	if !elasticsearch.ValidRanking(req.Ranking) {
+		msg = "Invalid ranking"
+		return msg
+	}
+
+	for field, weight := range req.FieldBoosts {
+		if !elasticsearch.ValidBoostField(field) || weight <= 0 {
+			msg = "Invalid field boost"
+			return msg
+		}
+	}
+
+	for flag, weight := range req.FlagBoosts {
+		if !elasticsearch.ValidBoostFlag(flag) || weight <= 0 {
+			msg = "Invalid flag boost"
+			return msg
+		}
+	}
+
+	return msg
+}
+
+// handleFacets counts the documents matching a search by repository, package,
+// and import. The query and filters come from the URL: query, and repeatable
+// repo, package, import, kind, and type parameters. An empty query counts the
+// whole index.
+func (s *Server) handleFacets(w http.ResponseWriter, r *http.Request) {
+	const maxFacetSize = 100
+
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	req := elasticsearch.SearchRequest{
+		Query:    params.Get("query"),
+		Repos:    params["repo"],
+		Packages: params["package"],
+		Imports:  params["import"],
+		Kinds:    params["kind"],
+		Types:    params["type"],
+	}
+
+	boundsErr := s.searchBoundsError(&req, false)
+	if boundsErr != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, boundsErr)
+		return
+	}
+
+	filterErr := searchFilterError(req)
+	if filterErr != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, filterErr)
+		return
+	}
+
+	size := elasticsearch.DefaultFacetSize
+	sizeStr := params.Get("size")
+	if sizeStr != "" {
+		parsed, parseErr := strconv.Atoi(sizeStr)
+		if parseErr != nil || parsed <= 0 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid size")
+			return
+		}
+		size = min(parsed, maxFacetSize)
+	}
+
+	facets, facetsErr := s.es.Facets(r.Context(), req, size)
+	if facetsErr != nil {
+		s.logger.ErrorContext(r.Context(), "Facets error", "query", req.Query, "error", facetsErr)
+		writeESError(w, r, "Failed to get facets", facetsErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(facets)
+}
+
+// handleSimilar finds indexed code resembling a snippet or an indexed
+// document, for "has someone already written this?" questions. Results use
+// the search response envelope.
+func (s *Server) handleSimilar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req elasticsearch.SimilarRequest
+	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if s.bodyTooLarge(w, r, "/api/v1/similar", decodeErr) {
+		return
+	}
+	if decodeErr != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
+		return
+	}
+
+	if !s.validSimilar(w, r, req) {
+		return
+	}
+
+	text, vector, model, ok := s.similarInput(w, r, req)
+	if !ok {
+		return
+	}
+
+	start := time.Now()
+	results, similarErr := s.es.SimilarDocuments(r.Context(), req, text, vector, model)
+	s.observeSearch("similar", start, len(results), similarErr)
+	if similarErr != nil {
+		s.logger.ErrorContext(r.Context(), "Similar code error", "mode", req.Mode, "error", similarErr)
+		writeESError(w, r, "Similar code search failed", similarErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.searchResponse(r.Context(), results))
+}
+
+// validSimilar reports whether a similar-code request can be served, writing
+// the error response when it can't. Its limit and filters are checked as a
+// search's would be.
+func (s *Server) validSimilar(w http.ResponseWriter, r *http.Request, req elasticsearch.SimilarRequest) (valid bool) {
+	if (req.Code == "") == (req.ID == "") {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Exactly one of code and id is required")
+		return valid
+	}
+
+	if req.Mode != "" && req.Mode != elasticsearch.SimilarText && req.Mode != elasticsearch.SimilarVector {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid mode")
+		return valid
+	}
+
+	bounds := elasticsearch.SearchRequest{Limit: req.Limit, Repos: req.Repos, Kinds: req.Kinds, Types: req.Types}
+	boundsErr := s.searchBoundsError(&bounds, false)
+	if boundsErr != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, boundsErr)
+		return valid
+	}
+
+	filterErr := searchFilterError(bounds)
+	if filterErr != "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, filterErr)
+		return valid
+	}
+
+	if req.Mode == elasticsearch.SimilarVector && s.embedder == nil {
+		writeError(w, r, http.StatusNotImplemented, CodeNotConfigured, "Embeddings are not configured")
+		return valid
+	}
+
+	valid = true
+	return valid
+}
+
+// similarInput returns what a similar-code request compares against: the
+// text, and for vectors its embedding and the model that made it. A snippet
+// is compared as given. An indexed document is compared by its code, or,
+// for vectors, by the same text the backfill embedded. On failure it writes
+// the error response and returns ok false.
+func (s *Server) similarInput(w http.ResponseWriter, r *http.Request, req elasticsearch.SimilarRequest) (text string, vector []float32, model string, ok bool) {
+	text = req.Code
+	if req.ID != "" {
+		doc, docErr := s.es.Document(r.Context(), req.ID)
+		if errors.Is(docErr, elasticsearch.ErrDocumentNotFound) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "Document not found")
+			return text, vector, model, ok
+		}
+		if docErr != nil {
+			s.logger.ErrorContext(r.Context(), "Similar document lookup error", "id", req.ID, "error", docErr)
+			writeESError(w, r, "Failed to get document", docErr)
+			return text, vector, model, ok
+		}
+		text = doc.Code
+		if req.Mode == elasticsearch.SimilarVector {
+			text = doc.EmbeddingText()
+		}
+	}
+
+	if req.Mode == elasticsearch.SimilarVector {
+		vectors, embedErr := s.embedder.Embed(r.Context(), []string{text})
+		if embedErr == nil && len(vectors[0]) == 0 {
+			embedErr = errors.New("embedding model returned an empty vector")
+		}
+		if embedErr != nil {
+			s.logger.ErrorContext(r.Context(), "Similar embedding error", "error", embedErr)
+			writeError(w, r, http.StatusBadGateway, CodeUpstreamFailed, "Failed to embed code")
+			return text, vector, model, ok
+		}
+		vector = vectors[0]
+		model = s.embedder.Model()
+	}
+
+	ok = true
+	return text, vector, model, ok
+}
+
+// handleDocument returns an indexed document by ID with its Elasticsearch
+// metadata, so a client holding only the IDs of cited results can fetch
+// their code later without searching again.
+func (s *Server) handleDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.PathValue("id")
+	fetched, fetchErr := s.es.FetchDocument(r.Context(), id)
+	if errors.Is(fetchErr, elasticsearch.ErrDocumentNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Document not found")
+		return
+	}
+	if fetchErr != nil {
+		s.logger.ErrorContext(r.Context(), "Document fetch error", "id", id, "error", fetchErr)
+		writeESError(w, r, "Failed to get document", fetchErr)
+		return
+	}
+	fetched.Document.SourceURL = s.sourceURL(fetched.Document)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(fetched)
+}
+
+// contextRequest is a search whose results are assembled into a context
+// block of at most MaxTokens estimated tokens, with the header of each
+// result's file before it when FileHeaders is set.
+type contextRequest struct {
+	elasticsearch.SearchRequest
+
+	MaxTokens   int  `json:"max_tokens"`
+	FileHeaders bool `json:"file_headers"`
+}
+
+// ContextResponse is a context block assembled for a query. Reranked is true
+// when the reranker ordered the results, and Rewrites lists the keyword
+// queries searched besides the original when it was rewritten.
+type ContextResponse struct {
+	Query     string   `json:"query"`
+	MaxTokens int      `json:"max_tokens"`
+	Reranked  bool     `json:"reranked,omitempty"`
+	Rewrites  []string `json:"rewrites,omitempty"`
+	output.ContextBlock
+}
+
+// handleContext runs a search and assembles the results into a Markdown
+// context block for an LLM prompt, deduplicated and trimmed to the token
+// budget, with the documents it cites.
+func (s *Server) handleContext(w http.ResponseWriter, r *http.Request) {
+	const (
+		defaultMaxTokens  = 4000
+		maxMaxTokens      = 100000
+		defaultCandidates = 20
+	)
+
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req contextRequest
+	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if s.bodyTooLarge(w, r, "/api/v1/context", decodeErr) {
+		return
+	}
+	if decodeErr != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
+		return
+	}
+
+	if !s.validSearch(w, r, &req.SearchRequest) {
+		return
+	}
+
+	if req.MaxTokens < 0 || req.MaxTokens > maxMaxTokens {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("max_tokens must be between 1 and %d", maxMaxTokens))
+		return
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = defaultMaxTokens
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultCandidates
+	}
+	req.Debug = false
+	req.IncludeContext = false
+	req.IncludeTests = false
+
+	start := time.Now()
+	results, reranked, rewrites, searchErr := s.search(r.Context(), req.SearchRequest)
+	s.observeSearch("context", start, len(results), searchErr)
+	if searchErr != nil {
+		s.logger.ErrorContext(r.Context(), "Context search error", "query", req.Query, "error", searchErr)
+		writeESError(w, r, "Search failed", searchErr)
+		return
+	}
+
+	resp := s.contextResponse(r.Context(), req, results)
+	resp.Reranked = reranked
+	resp.Rewrites = rewrites
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// contextResponse assembles a context search's results into its context
+// block. Without its headers the block is still useful, so a failure to
+// fetch them leaves them out.
+func (s *Server) contextResponse(ctx context.Context, req contextRequest, results []elasticsearch.CodeDocument) (resp ContextResponse) {
+	search := s.searchResponse(ctx, results)
+	s.usage.Record(req.Query, slices.Collect(maps.Keys(search.Repos)))
+
+	var headers map[string]elasticsearch.CodeDocument
+	if req.FileHeaders {
+		var headersErr error
+		headers, headersErr = s.es.FileDocuments(ctx, search.Results)
+		if headersErr != nil {
+			s.logger.WarnContext(ctx, "Failed to fetch file headers", "query", req.Query, "error", headersErr)
+		}
+	}
+
+	resp = ContextResponse{
+		Query:        req.Query,
+		MaxTokens:    req.MaxTokens,
+		ContextBlock: output.AssembleContextWithHeaders(search.Results, headers, req.MaxTokens),
+	}
+	return resp
+}
+
+// SearchResponse is the search API envelope. Repos reports when each repository
+// in the results was last indexed, and at which commit, so clients can flag
+// results that may be stale relative to the repository's current HEAD.
+// Reranked is true when the reranker ordered the results, and Rewrites lists
+// the keyword queries searched besides the original when it was rewritten.
+type SearchResponse struct {
+	Results  []elasticsearch.CodeDocument     `json:"results"`
+	Repos    map[string]indexer.RepoFreshness `json:"repos"`
+	Reranked bool                             `json:"reranked,omitempty"`
+	Rewrites []string                         `json:"rewrites,omitempty"`
+	Debug    *SearchDebug                     `json:"debug,omitempty"`
+}
+
+// SearchDebug echoes the Elasticsearch request behind a search so relevance
+// and filter problems can be diagnosed without server logs.
+type SearchDebug struct {
+	Index string                 `json:"index"`
+	Query map[string]interface{} `json:"query"`
+}
+
+// searchResponse wraps results with the freshness of their repositories.
+func (s *Server) searchResponse(ctx context.Context, results []elasticsearch.CodeDocument) (resp SearchResponse) {
+	var repos []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if !seen[result.Repo] {
+			seen[result.Repo] = true
+			repos = append(repos, result.Repo)
+		}
+	}
+
+	for i := range results {
+		results[i].SourceURL = s.sourceURL(results[i])
+		for j := range results[i].Context {
+			results[i].Context[j].SourceURL = s.sourceURL(results[i].Context[j])
+		}
+		for j := range results[i].Tests {
+			results[i].Tests[j].SourceURL = s.sourceURL(results[i].Tests[j])
+		}
+		for j, dup := range results[i].Duplicates {
+			results[i].Duplicates[j].SourceURL = s.sourceURL(elasticsearch.CodeDocument{
+				Repo:      dup.Repo,
+				FilePath:  dup.FilePath,
+				StartLine: dup.StartLine,
+				EndLine:   dup.EndLine,
+				Commit:    dup.Commit,
+			})
+		}
+	}
+
+	resp = SearchResponse{
+		Results: results,
+		Repos:   s.indexer.RepoFreshness(ctx, repos),
+	}
+	if resp.Results == nil {
+		resp.Results = []elasticsearch.CodeDocument{}
+	}
+	return resp
+}
+
+// sourceURL renders the source URL template of a result's source, or
+// SOURCE_URL_TEMPLATE, as a permalink pinned to the commit it was indexed at. Results without a commit or line range get no
+// link, since it would point at a moving target or the wrong lines.
+func (s *Server) sourceURL(doc elasticsearch.CodeDocument) (url string) {
+	source, repo, found := s.config.RepoSource(doc.Repo)
+	template := source.SourceURLTemplate
+	if template == "" {
+		template = s.config.SourceURLTemplate
+	}
+	if !found {
+		repo = doc.Repo
+	}
+
+	if template == "" || doc.Commit == "" || doc.StartLine == 0 {
+		return url
+	}
+
+	path := doc.FilePath
+	rel, relErr := filepath.Rel(filepath.Join(s.config.ReposPath, doc.Repo), doc.FilePath)
+	if relErr == nil && !strings.HasPrefix(rel, "..") {
+		path = filepath.ToSlash(rel)
+	}
+
+	url = strings.NewReplacer(
+		"{host}", source.Host,
+		"{org}", source.Org,
+		"{repo}", repo,
+		"{commit}", doc.Commit,
+		"{path}", path,
+		"{start_line}", strconv.Itoa(doc.StartLine),
+		"{end_line}", strconv.Itoa(doc.EndLine),
+	).Replace(template)
+	return url
+}
+
+// indexFileRequest is the body of a single-file index request: a file's path
+// from the root of a repository cloned under REPOS_PATH, and its content.
+type indexFileRequest struct {
+	Repo    string `json:"repo"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// handleIndexFile indexes one file from the content posted, such as an
+// editor buffer, replacing the file's documents so the change is searchable
+// at once. A file that fails to parse keeps what was recovered from it and
+// reports the failure in the response's error field.
+func (s *Server) handleIndexFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req indexFileRequest
+	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if s.bodyTooLarge(w, r, "/api/v1/files", decodeErr) {
+		return
+	}
+	if decodeErr != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
+		return
+	}
+	if req.Repo == "" || req.Path == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "repo and path are required")
+		return
+	}
+
+	result, indexErr := s.indexer.IndexFile(r.Context(), req.Repo, "", req.Path, []byte(req.Content))
+	if errors.Is(indexErr, indexer.ErrInvalidFilePath) || errors.Is(indexErr, indexer.ErrUnsupportedFile) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, indexErr.Error())
+		return
+	}
+	if indexErr != nil {
+		s.logger.ErrorContext(r.Context(), "Index file error", "repo", req.Repo, "path", req.Path, "error", indexErr)
+		writeESError(w, r, "Failed to index file", indexErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// handleReindex starts a tracked background reindex and returns its job. An
+// optional body of {"rebuild": true} rebuilds into a new index generation,
+// which requires an admin key. With ?dry_run=true or {"dry_run": true}, the
+// job parses every repository and reports what would change in the index
+// without writing to it.
 func (s *Server) handleReindex(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	go func() {
-		count, indexErr := s.indexer.IndexAllRepos(context.Background())
-		if indexErr != nil {
-			s.logger.Error("Reindex error", "error", indexErr)
-		} else {
-			s.logger.Info("Reindex complete", "functions", count)
+	// An empty body means a plain reindex.
+	var opts indexer.ReindexOptions
+	decodeErr := json.NewDecoder(r.Body).Decode(&opts)
+	if s.bodyTooLarge(w, r, "/api/v1/reindex", decodeErr) {
+		return
+	}
+	if decodeErr != nil && !errors.Is(decodeErr, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
+		return
+	}
+
+	if dryRun := r.URL.Query().Get("dry_run"); dryRun != "" {
+		var parseErr error
+		opts.DryRun, parseErr = strconv.ParseBool(dryRun)
+		if parseErr != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "dry_run must be true or false")
+			return
 		}
-	}()
+	}
+	if opts.DryRun && opts.Rebuild {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "dry_run can't be combined with rebuild")
+		return
+	}
+	if opts.Rebuild && !s.auth.admin(r) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Rebuilding the index requires an admin API key")
+		return
+	}
+
+	job, startErr := s.indexer.StartReindex(context.Background(), opts)
+	s.observeReindexTrigger(startErr)
+	if errors.Is(startErr, indexer.ErrReindexInProgress) {
+		w.Header().Set("Location", "/api/v1/reindex/"+job.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(job)
+		return
+	}
+	if errors.Is(startErr, indexer.ErrShuttingDown) {
+		writeError(w, r, http.StatusServiceUnavailable, CodeShuttingDown, "Shutting down")
+		return
+	}
+	if startErr != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to start reindex", "error", startErr)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to start reindex")
+		return
+	}
 
+	w.Header().Set("Location", "/api/v1/reindex/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	_, _ = fmt.Fprintf(w, "Reindex triggered")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// handleReindexStatus reports the state of a reindex job.
+func (s *Server) handleReindexStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	job, found := s.indexer.Job(r.PathValue("id"))
+	if !found {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// handleDeleteRepo removes a repository's documents and clone. With
+// authentication enabled it needs an admin API key.
+func (s *Server) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !s.auth.admin(r) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Deleting a repository requires an admin API key")
+		return
+	}
+
+	repo := r.PathValue("name")
+	deletion, deleteErr := s.indexer.DeleteRepo(r.Context(), repo)
+	switch {
+	case errors.Is(deleteErr, indexer.ErrInvalidRepoName):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, deleteErr.Error())
+		return
+	case errors.Is(deleteErr, indexer.ErrRepoNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Repository not found")
+		return
+	case errors.Is(deleteErr, indexer.ErrReindexInProgress):
+		writeError(w, r, http.StatusConflict, CodeConflict, "Indexing in progress, retry when it finishes")
+		return
+	case deleteErr != nil:
+		s.logger.ErrorContext(r.Context(), "Delete repository error", "repo", repo, "error", deleteErr)
+		writeESError(w, r, "Failed to delete repository", deleteErr)
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), "Deleted repository", "repo", repo, "documents", deletion.Deleted, "clone_removed", deletion.CloneRemoved)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(deletion)
+}
+
+// handleParseErrors lists files quarantined because they failed to parse.
+func (s *Server) handleParseErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	failures := s.indexer.ParseFailures(r.URL.Query().Get("repo"))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(failures)
+}
+
+// handleDeadLetters lists the documents that failed to index and are kept
+// for retry on GET, and discards them on DELETE, which requires an admin
+// key. Both take an optional repo parameter.
+func (s *Server) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	repo := r.URL.Query().Get("repo")
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.indexer.DeadLetters(repo))
+
+	case http.MethodDelete:
+		if !s.auth.admin(r) {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "Discarding dead letters requires an admin API key")
+			return
+		}
+
+		discarded := s.indexer.DiscardDeadLetters(repo)
+		s.logger.InfoContext(r.Context(), "Discarded dead letters", "repo", repo, "documents", discarded)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"discarded": discarded})
+
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleReplayDeadLetters indexes the dead letters again, for the repo
+// parameter's repository or all of them, and reports how many went through.
+// It requires an admin key.
+func (s *Server) handleReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !s.auth.admin(r) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Replaying dead letters requires an admin API key")
+		return
+	}
+
+	repo := r.URL.Query().Get("repo")
+	result, err := s.indexer.ReplayDeadLetters(r.Context(), repo)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "Dead letter replay error", "repo", repo, "error", err)
+		writeESError(w, r, "Dead letter replay interrupted", err)
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), "Replayed dead letters", "repo", repo, "replayed", result.Replayed, "failed", result.Failed)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// handleIndexingStatus reports whether indexing is paused.
+func (s *Server) handleIndexingStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.indexer.PauseStatus())
+}
+
+// handlePause pauses indexing until resumed. It requires an admin key.
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !s.auth.admin(r) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Pausing indexing requires an admin API key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.indexer.Pause())
+}
+
+// handleResume lifts an operator pause on indexing. It requires an admin key.
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !s.auth.admin(r) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Resuming indexing requires an admin API key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.indexer.Resume())
+}
+
+// handleStats reports per-repo and overall index statistics.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	stats, statsErr := s.indexer.Stats(r.Context())
+	if statsErr != nil {
+		s.logger.ErrorContext(r.Context(), "Stats error", "error", statsErr)
+		writeESError(w, r, "Failed to get index statistics", statsErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+// backfillRequest is the body of an embedding backfill request.
+type backfillRequest struct {
+	TargetIndex string `json:"target_index"`
+}
+
+// handleBackfill starts an embedding backfill on POST, which requires an
+// admin key, and reports the latest backfill on GET.
+func (s *Server) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status := s.indexer.EmbeddingBackfillStatus()
+		if status.State == "" {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "No backfill has run")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(status)
+
+	case http.MethodPost:
+		if !s.auth.admin(r) {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "Starting a backfill requires an admin API key")
+			return
+		}
+
+		var req backfillRequest
+		if r.ContentLength != 0 {
+			decodeErr := json.NewDecoder(r.Body).Decode(&req)
+			if decodeErr != nil {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
+				return
+			}
+		}
+
+		status, startErr := s.indexer.StartEmbeddingBackfill(context.Background(), req.TargetIndex)
+		switch {
+		case errors.Is(startErr, embedding.ErrNotConfigured):
+			writeError(w, r, http.StatusNotImplemented, CodeNotConfigured, "Embeddings are not configured")
+			return
+		case errors.Is(startErr, indexer.ErrBackfillInProgress):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(status)
+			return
+		case startErr != nil:
+			s.logger.ErrorContext(r.Context(), "Failed to start embedding backfill", "error", startErr)
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to start backfill")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(status)
+
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleUsage reports aggregated search usage when USAGE_STATS is enabled.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	const (
+		defaultTop = 20
+		maxTop     = 100
+	)
+
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !s.usage.Enabled() {
+		writeError(w, r, http.StatusNotImplemented, CodeNotConfigured, "Usage statistics are disabled")
+		return
+	}
+
+	top := defaultTop
+	topStr := r.URL.Query().Get("top")
+	if topStr != "" {
+		parsed, parseErr := strconv.Atoi(topStr)
+		if parseErr != nil || parsed <= 0 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid top")
+			return
+		}
+		top = min(parsed, maxTop)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.usage.Report(top))
 }
@@ -4,12 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/nikogura/rag-indexer/pkg/config"
 	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/nikogura/rag-indexer/pkg/usage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 type mockLogger struct{}
@@ -114,6 +125,65 @@ func TestHandleSearchEmptyQuery(t *testing.T) {
 	}
 }
 
+func TestHandleSearchInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		req  elasticsearch.SearchRequest
+	}{
+		{
+			name: "unknown sort",
+			req:  elasticsearch.SearchRequest{Query: "handler", Sort: "newest"},
+		},
+		{
+			name: "unknown kind",
+			req:  elasticsearch.SearchRequest{Query: "handler", Kinds: []string{"struct"}},
+		},
+		{
+			name: "invalid metadata field",
+			req:  elasticsearch.SearchRequest{Query: "handler", Metadata: map[string]string{"owner.team": "payments"}},
+		},
+		{
+			name: "negative complexity",
+			req:  elasticsearch.SearchRequest{Query: "handler", MaxCognitiveComplexity: -1},
+		},
+		{
+			name: "unknown ranking",
+			req:  elasticsearch.SearchRequest{Query: "handler", Ranking: "newest"},
+		},
+		{
+			name: "unknown boost field",
+			req:  elasticsearch.SearchRequest{Query: "handler", FieldBoosts: map[string]float64{"repo": 2}},
+		},
+		{
+			name: "non-positive flag boost",
+			req:  elasticsearch.SearchRequest{Query: "handler", FlagBoosts: map[string]float64{"has_namedreturns": 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &Server{
+				config: config.Config{HTTPAddr: ":8080"},
+				logger: &mockLogger{},
+			}
+
+			body, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatalf("Failed to marshal request: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/search", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			server.handleSearch(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
 func TestHandleReindexInvalidMethod(t *testing.T) {
 	cfg := config.Config{HTTPAddr: ":8080"}
 	logger := &mockLogger{}
@@ -178,3 +248,1384 @@ func TestSearchRequestValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleParseErrors(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080"}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/parse-errors", nil)
+	w := httptest.NewRecorder()
+
+	server.handleParseErrors(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var failures []indexer.ParseFailure
+	err := json.Unmarshal(w.Body.Bytes(), &failures)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(failures) != 0 {
+		t.Errorf("Failures = %d, want 0", len(failures))
+	}
+}
+
+func TestHandleParseErrorsInvalidMethod(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080"}
+	logger := &mockLogger{}
+
+	server := &Server{
+		config: cfg,
+		logger: logger,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/parse-errors", nil)
+	w := httptest.NewRecorder()
+
+	server.handleParseErrors(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandleReindexStatus(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080", ReposPath: t.TempDir()}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/reindex/missing", nil)
+	req.SetPathValue("id", "missing")
+	w := httptest.NewRecorder()
+
+	server.handleReindexStatus(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/reindex", strings.NewReader(`{"rebuild": "yes"}`))
+	w = httptest.NewRecorder()
+
+	server.handleReindex(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/reindex", nil)
+	w = httptest.NewRecorder()
+
+	server.handleReindex(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	var job indexer.Job
+	err := json.Unmarshal(w.Body.Bytes(), &job)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if job.ID == "" {
+		t.Fatal("Job ID is empty")
+	}
+	if w.Header().Get("Location") != "/api/v1/reindex/"+job.ID {
+		t.Errorf("Location = %q, want %q", w.Header().Get("Location"), "/api/v1/reindex/"+job.ID)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/reindex/"+job.ID, nil)
+	req.SetPathValue("id", job.ID)
+	w = httptest.NewRecorder()
+
+	server.handleReindexStatus(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHandleReindexDryRun(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080", ReposPath: t.TempDir()}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{name: "invalid dry_run", target: "/api/v1/reindex?dry_run=maybe", wantStatus: http.StatusBadRequest},
+		{name: "dry run with rebuild", target: "/api/v1/reindex?dry_run=true", body: `{"rebuild": true}`, wantStatus: http.StatusBadRequest},
+		{name: "dry run", target: "/api/v1/reindex?dry_run=true", wantStatus: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			server.handleReindex(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusAccepted {
+				return
+			}
+
+			var job indexer.Job
+			err := json.Unmarshal(w.Body.Bytes(), &job)
+			if err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !job.DryRun {
+				t.Error("job isn't a dry run")
+			}
+		})
+	}
+}
+
+func TestHandlePauseResume(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080"}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+	}
+
+	steps := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		wantStatus int
+		wantPaused bool
+	}{
+		{name: "initial status", handler: server.handleIndexingStatus, method: http.MethodGet, wantStatus: http.StatusOK, wantPaused: false},
+		{name: "pause", handler: server.handlePause, method: http.MethodPost, wantStatus: http.StatusOK, wantPaused: true},
+		{name: "paused status", handler: server.handleIndexingStatus, method: http.MethodGet, wantStatus: http.StatusOK, wantPaused: true},
+		{name: "resume", handler: server.handleResume, method: http.MethodPost, wantStatus: http.StatusOK, wantPaused: false},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, "/api/v1/indexing", nil)
+		w := httptest.NewRecorder()
+
+		step.handler(w, req)
+
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s: Status = %d, want %d", step.name, w.Code, step.wantStatus)
+		}
+
+		var status indexer.PauseStatus
+		err := json.Unmarshal(w.Body.Bytes(), &status)
+		if err != nil {
+			t.Fatalf("%s: failed to decode response: %v", step.name, err)
+		}
+		if status.Paused != step.wantPaused {
+			t.Errorf("%s: Paused = %v, want %v", step.name, status.Paused, step.wantPaused)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/indexing/pause", nil)
+	w := httptest.NewRecorder()
+	server.handlePause(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandleBackfill(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080"}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{name: "no backfill yet", method: http.MethodGet, wantStatus: http.StatusNotFound},
+		{name: "not configured", method: http.MethodPost, body: `{"target_index":"code-index-v2"}`, wantStatus: http.StatusNotImplemented},
+		{name: "invalid body", method: http.MethodPost, body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodDelete, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/embeddings/backfill", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			server.handleBackfill(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestIndexingControlRequiresAdmin(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080", APIKeys: []string{"user"}, AdminAPIKeys: []string{"admin"}}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		target     string
+		body       string
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "rebuild with regular key", handler: server.handleReindex, target: "/api/v1/reindex", body: `{"rebuild": true}`, apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "pause with regular key", handler: server.handlePause, target: "/api/v1/indexing/pause", apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "resume with regular key", handler: server.handleResume, target: "/api/v1/indexing/resume", apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "backfill with regular key", handler: server.handleBackfill, target: "/api/v1/embeddings/backfill", apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "dead letter replay with regular key", handler: server.handleReplayDeadLetters, target: "/api/v1/deadletter/replay", apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "pause with admin key", handler: server.handlePause, target: "/api/v1/indexing/pause", apiKey: "admin", wantStatus: http.StatusOK},
+		{name: "resume with admin key", handler: server.handleResume, target: "/api/v1/indexing/resume", apiKey: "admin", wantStatus: http.StatusOK},
+		{name: "backfill with admin key", handler: server.handleBackfill, target: "/api/v1/embeddings/backfill", apiKey: "admin", wantStatus: http.StatusNotImplemented},
+		{name: "dead letter replay with admin key", handler: server.handleReplayDeadLetters, target: "/api/v1/deadletter/replay", apiKey: "admin", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("X-API-Key", tt.apiKey)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSearchResponse(t *testing.T) {
+	cfg := config.Config{
+		HTTPAddr:          ":8080",
+		GitOrg:            "acme",
+		SourceURLTemplate: "https://github.com/{org}/{repo}/blob/{commit}/{path}#L{start_line}-L{end_line}",
+	}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+	}
+
+	resp := server.searchResponse(t.Context(), []elasticsearch.CodeDocument{
+		{Repo: "api", FunctionName: "Handle", Duplicates: []elasticsearch.Duplicate{
+			{ID: "b", Repo: "fork", FilePath: "vendor/h.go", StartLine: 3, EndLine: 9, Commit: "abc123"},
+		}},
+		{Repo: "web", FunctionName: "Render"},
+		{Repo: "api", FunctionName: "Serve"},
+	})
+
+	if len(resp.Results) != 3 {
+		t.Errorf("Results length = %d, want 3", len(resp.Results))
+	}
+	if len(resp.Repos) != 2 {
+		t.Errorf("Repos = %v, want entries for api and web", resp.Repos)
+	}
+	wantURL := "https://github.com/acme/fork/blob/abc123/vendor/h.go#L3-L9"
+	if resp.Results[0].Duplicates[0].SourceURL != wantURL {
+		t.Errorf("duplicate SourceURL = %q, want %q", resp.Results[0].Duplicates[0].SourceURL, wantURL)
+	}
+
+	empty := server.searchResponse(t.Context(), nil)
+	data, err := json.Marshal(empty)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(data) != `{"results":[],"repos":{}}` {
+		t.Errorf("empty response = %s, want empty results and repos", data)
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	const github = "https://github.com/{org}/{repo}/blob/{commit}/{path}#L{start_line}-L{end_line}"
+	located := elasticsearch.CodeDocument{Repo: "api", FilePath: "/repos/api/pkg/handlers/auth.go", Commit: "4f9c2e1", StartLine: 10, EndLine: 24}
+
+	tests := []struct {
+		name     string
+		template string
+		doc      elasticsearch.CodeDocument
+		want     string
+	}{
+		{
+			name:     "github permalink",
+			template: github,
+			doc:      located,
+			want:     "https://github.com/acme/api/blob/4f9c2e1/pkg/handlers/auth.go#L10-L24",
+		},
+		{
+			name:     "gitlab permalink",
+			template: "https://gitlab.com/{org}/{repo}/-/blob/{commit}/{path}#L{start_line}-{end_line}",
+			doc:      located,
+			want:     "https://gitlab.com/acme/api/-/blob/4f9c2e1/pkg/handlers/auth.go#L10-24",
+		},
+		{
+			name:     "no template",
+			template: "",
+			doc:      located,
+			want:     "",
+		},
+		{
+			name:     "no commit",
+			template: github,
+			doc:      elasticsearch.CodeDocument{Repo: "api", FilePath: "/repos/api/main.go", StartLine: 1, EndLine: 3},
+			want:     "",
+		},
+		{
+			name:     "indexed before line ranges",
+			template: github,
+			doc:      elasticsearch.CodeDocument{Repo: "api", FilePath: "/repos/api/main.go", Commit: "4f9c2e1"},
+			want:     "",
+		},
+		{
+			name:     "source template",
+			template: github,
+			doc:      elasticsearch.CodeDocument{Repo: "gitlab/deploy", FilePath: "/repos/gitlab/deploy/main.go", Commit: "4f9c2e1", StartLine: 1, EndLine: 3},
+			want:     "https://gitlab.example.com/platform/deploy/-/blob/4f9c2e1/main.go#L1-3",
+		},
+		{
+			name:     "source without template",
+			template: github,
+			doc:      elasticsearch.CodeDocument{Repo: "partner/sdk", FilePath: "/repos/partner/sdk/main.go", Commit: "4f9c2e1", StartLine: 1, EndLine: 3},
+			want:     "https://github.com/partner-co/sdk/blob/4f9c2e1/main.go#L1-L3",
+		},
+	}
+
+	sources := []config.SourceConfig{
+		{
+			Name:              "gitlab",
+			Host:              "gitlab.example.com",
+			Org:               "platform",
+			SourceURLTemplate: "https://{host}/{org}/{repo}/-/blob/{commit}/{path}#L{start_line}-{end_line}",
+		},
+		{Name: "partner", Host: "github.com", Org: "partner-co"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &Server{config: config.Config{ReposPath: "/repos", GitOrg: "acme", SourceURLTemplate: tt.template, Sources: sources}}
+
+			got := server.sourceURL(tt.doc)
+			if got != tt.want {
+				t.Errorf("sourceURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestESErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "bad request", err: fmt.Errorf("search: %w", elasticsearch.ErrBadRequest), want: http.StatusBadRequest},
+		{name: "conflict", err: elasticsearch.ErrConflict, want: http.StatusConflict},
+		{name: "unavailable", err: elasticsearch.ErrUnavailable, want: http.StatusServiceUnavailable},
+		{name: "timeout", err: elasticsearch.ErrTimeout, want: http.StatusGatewayTimeout},
+		{name: "unclassified", err: errors.New("boom"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := esErrorStatus(tt.err)
+			if got != tt.want {
+				t.Errorf("esErrorStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		usageStats bool
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{
+			name:       "disabled",
+			usageStats: false,
+			method:     http.MethodGet,
+			target:     "/api/v1/usage",
+			wantStatus: http.StatusNotImplemented,
+		},
+		{
+			name:       "report",
+			usageStats: true,
+			method:     http.MethodGet,
+			target:     "/api/v1/usage?top=5",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid top",
+			usageStats: true,
+			method:     http.MethodGet,
+			target:     "/api/v1/usage?top=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid method",
+			usageStats: true,
+			method:     http.MethodPost,
+			target:     "/api/v1/usage",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{HTTPAddr: ":8080", UsageStats: tt.usageStats}
+			logger := &mockLogger{}
+
+			server := &Server{
+				config: cfg,
+				logger: logger,
+				usage:  usage.New(cfg),
+			}
+			server.usage.Record("http handler", []string{"api"})
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			w := httptest.NewRecorder()
+
+			server.handleUsage(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var report usage.Report
+			err := json.Unmarshal(w.Body.Bytes(), &report)
+			if err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if report.Queries != 1 || len(report.TopQueries) != 1 {
+				t.Errorf("Report = %+v, want one recorded query", report)
+			}
+		})
+	}
+}
+
+func TestHandleSearchDebug(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test-index/_search" {
+			_, _ = w.Write([]byte(`{"hits":{"hits":[{"_source":{"repo":"api","function_name":"Handle"}}]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index", AdminAPIKeys: []string{"admin"}, APIKeys: []string{"user"}}
+	logger := &mockLogger{}
+
+	client, err := elasticsearch.NewClient(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantStatus int
+	}{
+		{
+			name:       "regular key",
+			apiKey:     "user",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin key",
+			apiKey:     "admin",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"query": "handler", "max_cognitive_complexity": 5, "debug": true}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/search", bytes.NewReader(body))
+			req.Header.Set("X-API-Key", tt.apiKey)
+			w := httptest.NewRecorder()
+
+			server.handleSearch(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp SearchResponse
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if len(resp.Results) != 1 {
+				t.Errorf("Results = %d, want 1", len(resp.Results))
+			}
+			if resp.Debug == nil || resp.Debug.Index != "test-index" {
+				t.Fatalf("Debug = %+v, want echo for test-index", resp.Debug)
+			}
+			query, _ := resp.Debug.Query["query"].(map[string]interface{})
+			scored, _ := query["function_score"].(map[string]interface{})
+			query, _ = scored["query"].(map[string]interface{})
+			_, hasBool := query["bool"]
+			if !hasBool {
+				t.Errorf("Debug query = %v, want boosted bool query with complexity filter", resp.Debug.Query["query"])
+			}
+		})
+	}
+}
+
+func TestHandleDocument(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/test-index/_doc/abc":
+			_, _ = w.Write([]byte(`{"_index":"test-index-000002","_id":"abc","_version":3,"_seq_no":41,"_primary_term":2,"found":true,` +
+				`"_source":{"repo":"api","file_path":"main.go","start_line":10,"end_line":20,"commit":"abc123","code":"func Handle() {}"}}`))
+		case "/test-index/_doc/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		case "/test-index/_doc/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"found":false}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	cfg := config.Config{
+		ESHost:            es.URL,
+		ESIndex:           "test-index",
+		GitOrg:            "acme",
+		SourceURLTemplate: "https://github.com/{org}/{repo}/blob/{commit}/{path}#L{start_line}-L{end_line}",
+	}
+	client, err := elasticsearch.NewClient(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	server := &Server{es: client, config: cfg, logger: &mockLogger{}}
+
+	tests := []struct {
+		name       string
+		method     string
+		id         string
+		wantStatus int
+	}{
+		{name: "found", method: http.MethodGet, id: "abc", wantStatus: http.StatusOK},
+		{name: "missing", method: http.MethodGet, id: "missing", wantStatus: http.StatusNotFound},
+		{name: "rejected by elasticsearch", method: http.MethodGet, id: "bad", wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, id: "abc", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/documents/"+tt.id, nil)
+			req.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+
+			server.handleDocument(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var fetched elasticsearch.FetchedDocument
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &fetched)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if fetched.ID != "abc" || fetched.Index != "test-index-000002" || fetched.Version != 3 || fetched.SeqNo != 41 || fetched.PrimaryTerm != 2 {
+				t.Errorf("Metadata = %+v, want abc in test-index-000002 at version 3", fetched)
+			}
+			if fetched.Document.Code != "func Handle() {}" || fetched.Document.ID != "abc" {
+				t.Errorf("Document = %+v, want the stored code with its ID", fetched.Document)
+			}
+			wantURL := "https://github.com/acme/api/blob/abc123/main.go#L10-L20"
+			if fetched.Document.SourceURL != wantURL {
+				t.Errorf("SourceURL = %q, want %q", fetched.Document.SourceURL, wantURL)
+			}
+		})
+	}
+}
+
+func TestHandleSearchIncludeContext(t *testing.T) {
+	var lookupFails atomic.Bool
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path != "/test-index/_search":
+			_, _ = w.Write([]byte(`{}`))
+		case !strings.Contains(string(body), `{"term":{"function_name":"Policy"}}`):
+			_, _ = w.Write([]byte(`{"hits":{"hits":[{"_id":"d","_source":{"repo":"api","file_path":"retry/retry.go","package":"retry","kind":"function","function_name":"Do","references":["Policy"]}}]}}`))
+		case lookupFails.Load():
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			_, _ = w.Write([]byte(`{"hits":{"hits":[{"_id":"p","_source":{"repo":"api","file_path":"retry/policy.go","package":"retry","kind":"type","function_name":"Policy","start_line":3,"end_line":6,"commit":"abc"}}]}}`))
+		}
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index", SourceURLTemplate: "https://git.example.com/{repo}/{path}"}
+	logger := &mockLogger{}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		es:      client,
+		config:  cfg,
+		metrics: m,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	search := func() (resp SearchResponse, w *httptest.ResponseRecorder) {
+		w = httptest.NewRecorder()
+		server.handleSearch(w, httptest.NewRequest(http.MethodPost, "/api/v1/search", strings.NewReader(`{"query": "retry", "include_context": true}`)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+		if decodeErr != nil {
+			t.Fatalf("Failed to decode response: %v", decodeErr)
+		}
+		return resp, w
+	}
+
+	resp, _ := search()
+	if len(resp.Results) != 1 || len(resp.Results[0].Context) != 1 || resp.Results[0].Context[0].FunctionName != "Policy" {
+		t.Fatalf("Results = %+v, want Do with Policy as its context", resp.Results)
+	}
+	if resp.Results[0].Context[0].SourceURL == "" {
+		t.Error("context declaration has no source URL")
+	}
+
+	// A failed lookup still returns the results, without an ETag.
+	lookupFails.Store(true)
+	resp, w := search()
+	if len(resp.Results) != 1 || resp.Results[0].Context != nil || w.Header().Get("ETag") != "" {
+		t.Errorf("after a failed lookup: results %+v, ETag %q; want Do alone without an ETag", resp.Results, w.Header().Get("ETag"))
+	}
+}
+
+func TestHandleSearchETag(t *testing.T) {
+	var searches, indexed atomic.Int32
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/test-index/_search":
+			searches.Add(1)
+			_, _ = w.Write([]byte(`{"hits":{"hits":[{"_source":{"repo":"api","function_name":"Handle"}}]}}`))
+		case "/test-index/_stats/docs,indexing":
+			_, _ = fmt.Fprintf(w, `{"indices":{"test-index":{"primaries":{"docs":{"count":%d},"indexing":{"index_total":%d}}}}}`, indexed.Load(), indexed.Load())
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index"}
+	logger := &mockLogger{}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		es:      client,
+		config:  cfg,
+		metrics: m,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	search := func(query string, ifNoneMatch string) (w *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/search", strings.NewReader(`{"query": "`+query+`"}`))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w = httptest.NewRecorder()
+		server.handleSearch(w, req)
+		return w
+	}
+
+	first := search("handler", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("first search = %d with ETag %q, want 200 with a weak ETag", first.Code, etag)
+	}
+
+	cached := search("handler", etag)
+	if cached.Code != http.StatusNotModified || cached.Body.Len() != 0 || cached.Header().Get("ETag") != etag {
+		t.Errorf("repeat search = %d with ETag %q, want 304 with the same ETag", cached.Code, cached.Header().Get("ETag"))
+	}
+	if searches.Load() != 1 {
+		t.Errorf("searches = %d, want the repeat answered without searching", searches.Load())
+	}
+
+	if other := search("router", etag); other.Code != http.StatusOK || other.Header().Get("ETag") == etag {
+		t.Errorf("different query = %d with ETag %q, want 200 with another ETag", other.Code, other.Header().Get("ETag"))
+	}
+
+	indexed.Store(5)
+	if changed := search("handler", etag); changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Errorf("search after indexing = %d with ETag %q, want 200 with a new ETag", changed.Code, changed.Header().Get("ETag"))
+	}
+	// Searches answered with 304 aren't run, so aren't measured.
+	if got := testutil.CollectAndCount(m.SearchDuration); got != 1 {
+		t.Errorf("search duration series = %d, want one for successful searches", got)
+	}
+	if got := testutil.ToFloat64(m.SearchZeroResults.WithLabelValues("search")); got != 0 {
+		t.Errorf("zero-result searches = %v, want 0", got)
+	}
+}
+
+func TestHandleFacets(t *testing.T) {
+	var esQuery string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		esQuery = string(body)
+		_, _ = w.Write([]byte(`{"hits":{"total":{"value":3}},"aggregations":{"repos":{"buckets":[{"key":"api","doc_count":3}]}}}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index"}
+	client, err := elasticsearch.NewClient(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server := &Server{
+		es:     client,
+		config: cfg,
+		logger: &mockLogger{},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantQuery  string
+	}{
+		{name: "drill-down", method: http.MethodGet, target: "/api/v1/facets?query=handler&repo=api&import=net/http&size=500", wantStatus: http.StatusOK, wantQuery: `"size":100`},
+		{name: "whole index", method: http.MethodGet, target: "/api/v1/facets", wantStatus: http.StatusOK, wantQuery: "match_all"},
+		{name: "invalid size", method: http.MethodGet, target: "/api/v1/facets?size=0", wantStatus: http.StatusBadRequest},
+		{name: "invalid kind", method: http.MethodGet, target: "/api/v1/facets?kind=struct", wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, target: "/api/v1/facets", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			esQuery = ""
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			w := httptest.NewRecorder()
+
+			server.handleFacets(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !strings.Contains(esQuery, tt.wantQuery) {
+				t.Errorf("ES query = %s, want it to contain %s", esQuery, tt.wantQuery)
+			}
+
+			var facets elasticsearch.Facets
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &facets)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if facets.Total != 3 || len(facets.Repos) != 1 || facets.Packages == nil {
+				t.Errorf("Facets = %+v, want 3 documents in repo api", facets)
+			}
+		})
+	}
+}
+
+func TestHandleSimilar(t *testing.T) {
+	var esQuery string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/test-index/_doc/abc":
+			_, _ = w.Write([]byte(`{"found":true,"_source":{"repo":"api","package":"retry","function_name":"Do","code":"func Do() {}"}}`))
+		case "/test-index/_search":
+			body, _ := io.ReadAll(r.Body)
+			esQuery = string(body)
+			_, _ = w.Write([]byte(`{"hits":{"hits":[{"_score":2.5,"_source":{"repo":"web","function_name":"Retry"}}]}}`))
+		case "/":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"found":false}`))
+		}
+	}))
+	defer es.Close()
+
+	embedder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"index":0,"embedding":[0.1,0.2]}]}`))
+	}))
+	defer embedder.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index"}
+	client, err := elasticsearch.NewClient(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	withEmbeddings := cfg
+	withEmbeddings.EmbeddingURL = embedder.URL
+	withEmbeddings.EmbeddingModel = "test-model"
+
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		body       string
+		wantStatus int
+		wantQuery  string
+	}{
+		{name: "snippet", cfg: cfg, body: `{"code": "func Retry() {}"}`, wantStatus: http.StatusOK, wantQuery: "more_like_this"},
+		{name: "document", cfg: cfg, body: `{"id": "abc"}`, wantStatus: http.StatusOK, wantQuery: `"must_not"`},
+		{name: "vector", cfg: withEmbeddings, body: `{"id": "abc", "mode": "vector"}`, wantStatus: http.StatusOK, wantQuery: `"query_vector":[0.1,0.2]`},
+		{name: "missing document", cfg: cfg, body: `{"id": "missing"}`, wantStatus: http.StatusNotFound},
+		{name: "code and id", cfg: cfg, body: `{"code": "x", "id": "abc"}`, wantStatus: http.StatusBadRequest},
+		{name: "neither code nor id", cfg: cfg, body: `{"limit": 5}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown mode", cfg: cfg, body: `{"code": "x", "mode": "fuzzy"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown kind", cfg: cfg, body: `{"code": "x", "kinds": ["struct"]}`, wantStatus: http.StatusBadRequest},
+		{name: "vector without embeddings", cfg: cfg, body: `{"code": "x", "mode": "vector"}`, wantStatus: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &mockLogger{}
+			server := New(indexer.New(tt.cfg, nil, nil, logger), client, tt.cfg, nil, logger)
+
+			esQuery = ""
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/similar", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			server.handleSimilar(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !strings.Contains(esQuery, tt.wantQuery) {
+				t.Errorf("ES query = %s, want it to contain %s", esQuery, tt.wantQuery)
+			}
+
+			var resp SearchResponse
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if len(resp.Results) != 1 || resp.Results[0].FunctionName != "Retry" {
+				t.Errorf("Results = %+v, want Retry", resp.Results)
+			}
+		})
+	}
+}
+
+func TestHandleContext(t *testing.T) {
+	var esQuery string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test-index/_search" {
+			body, _ := io.ReadAll(r.Body)
+			esQuery = string(body)
+			_, _ = w.Write([]byte(`{"hits":{"hits":[
+				{"_id":"a","_score":3,"_source":{"repo":"api","file_path":"retry.go","function_name":"Retry","start_line":4,"end_line":6,"code":"func Retry() {\n}","content_hash":"h1"}},
+				{"_id":"b","_score":2,"_source":{"repo":"api","file_path":"copy.go","function_name":"Retry","start_line":1,"end_line":3,"code":"func Retry() {\n}","content_hash":"h1"}}
+			]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index"}
+	client, err := elasticsearch.NewClient(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	logger := &mockLogger{}
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+	}
+
+	tests := []struct {
+		name          string
+		body          string
+		wantStatus    int
+		wantMaxTokens int
+	}{
+		{name: "default budget", body: `{"query": "retry"}`, wantStatus: http.StatusOK, wantMaxTokens: 4000},
+		{name: "explicit budget", body: `{"query": "retry", "max_tokens": 500, "repos": ["api"]}`, wantStatus: http.StatusOK, wantMaxTokens: 500},
+		{name: "missing query", body: `{"max_tokens": 500}`, wantStatus: http.StatusBadRequest},
+		{name: "negative budget", body: `{"query": "retry", "max_tokens": -1}`, wantStatus: http.StatusBadRequest},
+		{name: "budget too large", body: `{"query": "retry", "max_tokens": 1000000}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown kind", body: `{"query": "retry", "kinds": ["struct"]}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/context", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			server.handleContext(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !strings.Contains(esQuery, `"size":20`) {
+				t.Errorf("ES query = %s, want 20 candidates", esQuery)
+			}
+
+			var resp ContextResponse
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if resp.MaxTokens != tt.wantMaxTokens {
+				t.Errorf("MaxTokens = %d, want %d", resp.MaxTokens, tt.wantMaxTokens)
+			}
+			if len(resp.Sources) != 1 || resp.Sources[0].ID != "a" || resp.Omitted != 1 {
+				t.Errorf("Sources = %+v, omitted %d, want a alone with its copy omitted", resp.Sources, resp.Omitted)
+			}
+			if !strings.HasPrefix(resp.Context, "## api/retry.go:4-6 `Retry`\n") {
+				t.Errorf("Context = %q, want it headed by the first result", resp.Context)
+			}
+		})
+	}
+}
+
+func TestHandleContextFileHeaders(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `{"term":{"kind":"file"}}`) {
+			_, _ = w.Write([]byte(`{"hits":{"hits":[
+				{"_id":"f","_source":{"repo":"api","file_path":"retry.go","kind":"file","function_name":"retry.go","code":"package retry\n","content_hash":"f1"}}
+			]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"hits":{"hits":[
+			{"_id":"a","_score":3,"_source":{"repo":"api","file_path":"retry.go","function_name":"Retry","start_line":4,"end_line":6,"code":"func Retry() {\n}","content_hash":"h1"}}
+		]}}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index"}
+	client, err := elasticsearch.NewClient(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	logger := &mockLogger{}
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/context", strings.NewReader(`{"query": "retry", "file_headers": true}`))
+	w := httptest.NewRecorder()
+	server.handleContext(w, req)
+
+	var resp ContextResponse
+	decodeErr := json.Unmarshal(w.Body.Bytes(), &resp)
+	if decodeErr != nil {
+		t.Fatalf("Failed to decode response: %v", decodeErr)
+	}
+	if len(resp.Sources) != 2 || resp.Sources[0].ID != "f" || resp.Sources[1].ID != "a" {
+		t.Errorf("Sources = %+v, want retry.go's header, then its result", resp.Sources)
+	}
+	if !strings.HasPrefix(resp.Context, "## api/retry.go `retry.go`\n\n```go\npackage retry\n") {
+		t.Errorf("Context = %q, want it to open with the file header", resp.Context)
+	}
+}
+
+func TestHandleReadyBeforeBootstrap(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: "http://127.0.0.1:1", ESIndex: "test-index"}
+
+	client, err := elasticsearch.New(cfg, metrics.NewWithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	server := &Server{
+		es:     client,
+		config: cfg,
+		logger: &mockLogger{},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	w := httptest.NewRecorder()
+
+	server.handleReady(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleHealthDetail(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer es.Close()
+
+	tests := []struct {
+		name       string
+		staleAfter time.Duration
+		failStale  bool
+		wantStatus string
+		wantCode   int
+	}{
+		{name: "fresh", staleAfter: time.Hour, wantStatus: "ok", wantCode: http.StatusOK},
+		{name: "stale degrades", staleAfter: time.Nanosecond, wantStatus: "degraded", wantCode: http.StatusOK},
+		{name: "stale fails readiness", staleAfter: time.Nanosecond, failStale: true, wantStatus: "unavailable", wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{ESHost: es.URL, ESIndex: "test-index", GitRepos: []string{"api"}, IndexStaleAfter: tt.staleAfter, ReadyFailStale: tt.failStale}
+			logger := &mockLogger{}
+			m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+			client, err := elasticsearch.NewClient(cfg, m)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			server := &Server{indexer: indexer.New(cfg, client, m, logger), es: client, config: cfg, logger: logger}
+			time.Sleep(time.Millisecond)
+
+			w := httptest.NewRecorder()
+			server.handleHealthDetail(w, httptest.NewRequest(http.MethodGet, "/healthz/detail", nil))
+
+			var detail healthDetail
+			decodeErr := json.NewDecoder(w.Body).Decode(&detail)
+			if decodeErr != nil {
+				t.Fatalf("failed to decode response: %v", decodeErr)
+			}
+			if w.Code != tt.wantCode || detail.Status != tt.wantStatus {
+				t.Errorf("health = %d %+v, want %d %s", w.Code, detail, tt.wantCode, tt.wantStatus)
+			}
+			if len(detail.Repos) != 1 || detail.Repos[0].Repo != "api" || detail.Elasticsearch != "connected" {
+				t.Errorf("health = %+v, want api and a connected cluster", detail)
+			}
+
+			w = httptest.NewRecorder()
+			server.handleReady(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if w.Code != tt.wantCode {
+				t.Errorf("ready status = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandleReadyWhileDraining(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index"}
+	logger := &mockLogger{}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server := &Server{
+		indexer: indexer.New(cfg, client, m, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+	}
+
+	drainErr := server.indexer.Drain(t.Context())
+	if drainErr != nil {
+		t.Fatalf("Drain() error = %v", drainErr)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	w := httptest.NewRecorder()
+	server.handleReady(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ready status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/reindex", nil)
+	w = httptest.NewRecorder()
+	server.handleReindex(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("reindex status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleIndexFile(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test-index/_delete_by_query" {
+			_, _ = w.Write([]byte(`{"deleted":1}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index", ReposPath: "/repos", Languages: []string{"go"}}
+	logger := &mockLogger{}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server := &Server{
+		indexer: indexer.New(cfg, client, m, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		body        string
+		wantStatus  int
+		wantIndexed int
+	}{
+		{
+			name:        "go file",
+			method:      http.MethodPost,
+			body:        `{"repo": "api", "path": "pkg/server/handler.go", "content": "package server\n\nfunc Handle() {}\n"}`,
+			wantStatus:  http.StatusOK,
+			wantIndexed: 1,
+		},
+		{name: "escaping path", method: http.MethodPost, body: `{"repo": "api", "path": "../secrets/main.go", "content": ""}`, wantStatus: http.StatusBadRequest},
+		{name: "unsupported file", method: http.MethodPost, body: `{"repo": "api", "path": "README.txt", "content": "hello"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing repo", method: http.MethodPost, body: `{"path": "main.go", "content": "package main\n"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid json", method: http.MethodPost, body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/files", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			server.handleIndexFile(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result indexer.FileResult
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &result)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if result.Indexed != tt.wantIndexed || result.Deleted != 1 || result.FilePath != "/repos/api/pkg/server/handler.go" {
+				t.Errorf("result = %+v, want %d indexed and 1 deleted at /repos/api/pkg/server/handler.go", result, tt.wantIndexed)
+			}
+		})
+	}
+}
+
+func TestHandleDeleteRepo(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query struct {
+				Term map[string]string `json:"term"`
+			} `json:"query"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Query.Term["repo"] == "api" {
+			_, _ = w.Write([]byte(`{"deleted":7}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"deleted":0}`))
+	}))
+	defer es.Close()
+
+	cfg := config.Config{HTTPAddr: ":8080", ESHost: es.URL, ESIndex: "test-index", ReposPath: t.TempDir(), AdminAPIKeys: []string{"admin"}, APIKeys: []string{"user"}}
+	logger := &mockLogger{}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server := &Server{
+		indexer: indexer.New(cfg, client, m, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		repo       string
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "admin key", method: http.MethodDelete, repo: "api", apiKey: "admin", wantStatus: http.StatusOK},
+		{name: "regular key", method: http.MethodDelete, repo: "api", apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "unknown repo", method: http.MethodDelete, repo: "missing", apiKey: "admin", wantStatus: http.StatusNotFound},
+		{name: "invalid name", method: http.MethodDelete, repo: "..", apiKey: "admin", wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodGet, repo: "api", apiKey: "admin", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/repos/"+tt.repo, nil)
+			req.SetPathValue("name", tt.repo)
+			req.Header.Set("X-API-Key", tt.apiKey)
+			w := httptest.NewRecorder()
+
+			server.handleDeleteRepo(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var deletion indexer.RepoDeletion
+			decodeErr := json.Unmarshal(w.Body.Bytes(), &deletion)
+			if decodeErr != nil {
+				t.Fatalf("Failed to decode response: %v", decodeErr)
+			}
+			if deletion.Repo != "api" || deletion.Deleted != 7 {
+				t.Errorf("deletion = %+v, want 7 documents of api", deletion)
+			}
+		})
+	}
+}
+
+func TestHandleDeadLetters(t *testing.T) {
+	cfg := config.Config{HTTPAddr: ":8080", ESIndex: "test-index", ReposPath: t.TempDir(), AdminAPIKeys: []string{"admin"}, APIKeys: []string{"user"}}
+	logger := &mockLogger{}
+
+	server := &Server{
+		indexer: indexer.New(cfg, nil, nil, logger),
+		config:  cfg,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		apiKey     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "list", method: http.MethodGet, apiKey: "user", wantStatus: http.StatusOK, wantBody: "[]\n"},
+		{name: "discard as admin", method: http.MethodDelete, apiKey: "admin", wantStatus: http.StatusOK, wantBody: `{"discarded":0}` + "\n"},
+		{name: "discard with regular key", method: http.MethodDelete, apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "wrong method", method: http.MethodPut, apiKey: "admin", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/deadletter?repo=api", nil)
+			req.Header.Set("X-API-Key", tt.apiKey)
+			w := httptest.NewRecorder()
+
+			server.handleDeadLetters(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("Body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// statusRecorder captures the status code a handler writes, and whether it
+// has started the response.
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader records the status before passing it on.
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write notes that the response has started, with an implicit 200 if no
+// status was written.
+func (r *statusRecorder) Write(data []byte) (n int, err error) {
+	r.wroteHeader = true
+	n, err = r.ResponseWriter.Write(data)
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() (w http.ResponseWriter) {
+	w = r.ResponseWriter
+	return w
+}
+
+// observeSLO counts each request to the endpoint toward the latency SLO. A
+// request is good when it finishes within SLO_LATENCY_THRESHOLD without a
+// server error; client errors are the caller's fault and count as good. The
+// counters let burn-rate alerts use the good/total ratio directly instead of
+// recording rules over latency histograms.
+func (s *Server) observeSLO(endpoint string, next http.HandlerFunc) (handler http.HandlerFunc) {
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		if s.metrics == nil {
+			next(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		good := recorder.status < http.StatusInternalServerError && time.Since(start) <= s.config.SLOLatencyThreshold
+		s.metrics.ObserveSLORequest(endpoint, good)
+	}
+	return handler
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestObserveSLO(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		delay    time.Duration
+		wantGood float64
+	}{
+		{name: "fast success", status: http.StatusOK, wantGood: 1},
+		{name: "fast client error", status: http.StatusBadRequest, wantGood: 1},
+		{name: "fast server error", status: http.StatusServiceUnavailable, wantGood: 0},
+		{name: "slow success", status: http.StatusOK, delay: 20 * time.Millisecond, wantGood: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			s := &Server{
+				config:  config.Config{SLOLatencyThreshold: 10 * time.Millisecond},
+				metrics: metrics.NewWithRegisterer(reg),
+				logger:  &mockLogger{},
+			}
+
+			handler := s.observeSLO("/api/v1/search", func(w http.ResponseWriter, _ *http.Request) {
+				time.Sleep(tt.delay)
+				w.WriteHeader(tt.status)
+			})
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/search", nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+
+			total := counterValue(t, reg, "code_indexer_slo_requests_total", "/api/v1/search")
+			good := counterValue(t, reg, "code_indexer_slo_requests_good_total", "/api/v1/search")
+			if total != 1 || good != tt.wantGood {
+				t.Errorf("total, good = %v, %v, want 1, %v", total, good, tt.wantGood)
+			}
+		})
+	}
+}
+
+// counterValue reads the counter series with the given endpoint label,
+// failing the test when it doesn't exist.
+func counterValue(t *testing.T, reg *prometheus.Registry, name string, endpoint string) (value float64) {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "endpoint" && label.GetValue() == endpoint {
+					value = metric.GetCounter().GetValue()
+					return value
+				}
+			}
+		}
+	}
+
+	t.Fatalf("no %s series for endpoint %s", name, endpoint)
+	return value
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+)
+
+// SnapshotsResponse lists the snapshots in SNAPSHOT_REPOSITORY.
+type SnapshotsResponse struct {
+	Repository string                       `json:"repository"`
+	Snapshots  []elasticsearch.SnapshotInfo `json:"snapshots"`
+}
+
+// handleSnapshots lists the snapshots in SNAPSHOT_REPOSITORY on GET, newest
+// first, and snapshots the index on POST, which requires an admin key.
+func (s *Server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		snapshots, err := s.indexer.Snapshots(r.Context())
+		if s.snapshotError(w, r, "Failed to list snapshots", err) {
+			return
+		}
+		if snapshots == nil {
+			snapshots = []elasticsearch.SnapshotInfo{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SnapshotsResponse{Repository: s.config.SnapshotRepository, Snapshots: snapshots})
+
+	case http.MethodPost:
+		if !s.auth.admin(r) {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "Taking a snapshot requires an admin API key")
+			return
+		}
+
+		info, err := s.indexer.Snapshot(r.Context(), indexer.SnapshotManual)
+		if errors.Is(err, elasticsearch.ErrNoIndex) {
+			writeError(w, r, http.StatusConflict, CodeConflict, "The index does not exist yet")
+			return
+		}
+		if s.snapshotError(w, r, "Snapshot failed", err) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(info)
+
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleRestoreSnapshot restores a snapshot as a new index generation and
+// points the index alias at it. It requires an admin key.
+func (s *Server) handleRestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !s.auth.admin(r) {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Restoring a snapshot requires an admin API key")
+		return
+	}
+
+	name := r.PathValue("name")
+	restored, err := s.indexer.RestoreSnapshot(r.Context(), name)
+	switch {
+	case errors.Is(err, elasticsearch.ErrSnapshotNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Snapshot not found")
+		return
+	case errors.Is(err, indexer.ErrReindexInProgress):
+		writeError(w, r, http.StatusConflict, CodeConflict, "Indexing in progress, retry when it finishes")
+		return
+	}
+	if s.snapshotError(w, r, "Restore failed", err) {
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), "Restored snapshot", "snapshot", name, "index", restored.Index, "previous", restored.Previous)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(restored)
+}
+
+// snapshotError writes the response for a failed snapshot operation and
+// reports whether there was one.
+func (s *Server) snapshotError(w http.ResponseWriter, r *http.Request, msg string, err error) (failed bool) {
+	switch {
+	case err == nil:
+		return failed
+	case errors.Is(err, indexer.ErrSnapshotsDisabled):
+		writeError(w, r, http.StatusNotImplemented, CodeNotConfigured, "Snapshots are not configured")
+	default:
+		s.logger.ErrorContext(r.Context(), msg, "error", err)
+		writeESError(w, r, msg, err)
+	}
+	failed = true
+	return failed
+}
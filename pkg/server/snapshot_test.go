@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandleSnapshots(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_snapshot/backups/_all":
+			_, _ = w.Write([]byte(`{"snapshots":[{"snapshot":"test-index-manual-1","state":"SUCCESS","indices":["test-index"]}]}`))
+		case r.URL.Path == "/_snapshot/backups/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/_snapshot/backups/snap-1":
+			_, _ = w.Write([]byte(`{"snapshots":[{"snapshot":"snap-1","indices":["test-index"]}]}`))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_snapshot/backups/"):
+			_, _ = w.Write([]byte(`{"snapshot":{"snapshot":"test-index-manual-1","state":"SUCCESS","indices":["test-index"]}}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer es.Close()
+
+	cfg := config.Config{
+		ESHost:             es.URL,
+		ESIndex:            "test-index",
+		ESGenerationFormat: "2006-01-02-150405",
+		ESGenerationsKept:  2,
+		SnapshotRepository: "backups",
+		AdminAPIKeys:       []string{"admin"},
+		APIKeys:            []string{"user"},
+	}
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	client, err := elasticsearch.NewClient(cfg, m)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	logger := &mockLogger{}
+	server := &Server{
+		indexer: indexer.New(cfg, client, m, logger),
+		es:      client,
+		config:  cfg,
+		logger:  logger,
+		auth:    newAuthenticator(cfg),
+	}
+
+	disabledCfg := cfg
+	disabledCfg.SnapshotRepository = ""
+	disabled := &Server{
+		indexer: indexer.New(disabledCfg, client, m, logger),
+		es:      client,
+		config:  disabledCfg,
+		logger:  logger,
+		auth:    newAuthenticator(disabledCfg),
+	}
+
+	tests := []struct {
+		name       string
+		server     *Server
+		method     string
+		restore    string
+		apiKey     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "list", server: server, method: http.MethodGet, apiKey: "user", wantStatus: http.StatusOK, wantBody: `"snapshot":"test-index-manual-1"`},
+		{name: "create", server: server, method: http.MethodPost, apiKey: "admin", wantStatus: http.StatusCreated, wantBody: `"state":"SUCCESS"`},
+		{name: "create without admin key", server: server, method: http.MethodPost, apiKey: "user", wantStatus: http.StatusForbidden},
+		{name: "not configured", server: disabled, method: http.MethodGet, apiKey: "user", wantStatus: http.StatusNotImplemented},
+		{name: "wrong method", server: server, method: http.MethodDelete, apiKey: "admin", wantStatus: http.StatusMethodNotAllowed},
+		{name: "restore", server: server, method: http.MethodPost, restore: "snap-1", apiKey: "admin", wantStatus: http.StatusOK, wantBody: `"snapshot":"snap-1"`},
+		{name: "restore missing snapshot", server: server, method: http.MethodPost, restore: "missing", apiKey: "admin", wantStatus: http.StatusNotFound},
+		{name: "restore without admin key", server: server, method: http.MethodPost, restore: "snap-1", apiKey: "user", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if tt.restore != "" {
+				req := httptest.NewRequest(tt.method, "/api/v1/snapshots/"+tt.restore+"/restore", nil)
+				req.SetPathValue("name", tt.restore)
+				req.Header.Set("X-API-Key", tt.apiKey)
+				tt.server.handleRestoreSnapshot(w, req)
+			} else {
+				req := httptest.NewRequest(tt.method, "/api/v1/snapshots", nil)
+				req.Header.Set("X-API-Key", tt.apiKey)
+				tt.server.handleSnapshots(w, req)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
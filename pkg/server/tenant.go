@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/embedding"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/rerank"
+	"github.com/nikogura/rag-indexer/pkg/rewrite"
+	"github.com/nikogura/rag-indexer/pkg/usage"
+)
+
+// TenantHeader selects the tenant a request is for, as an alternative to the
+// /t/{tenant} path prefix.
+const TenantHeader = "X-Tenant"
+
+// AddTenant serves the named tenant's index through idx and es. Its
+// requests are authenticated with the tenant's keys and recorded in its
+// metrics and usage statistics; the rate limiter is shared. Call it before
+// Start.
+func (s *Server) AddTenant(name string, idx *indexer.Indexer, es *elasticsearch.Client, cfg config.Config) {
+	tenant := *s
+	if s.metrics != nil {
+		tenant.metrics = s.metrics.ForTenant(name)
+	}
+
+	embedder, _ := embedding.New(cfg, tenant.metrics, nil)
+	reranker, _ := rerank.New(cfg)
+	rewriter, _ := rewrite.New(cfg)
+
+	tenant.indexer = idx
+	tenant.es = es
+	tenant.config = cfg
+	tenant.auth = newAuthenticator(cfg)
+	tenant.usage = usage.New(cfg)
+	tenant.embedder = embedder
+	tenant.reranker = reranker
+	tenant.rewriter = rewriter
+	tenant.tenants = nil
+
+	if s.tenants == nil {
+		s.tenants = map[string]*Server{}
+	}
+	s.tenants[name] = &tenant
+}
+
+// handleTenants registers the handler handler builds for each tenant, and
+// the default profile, under pattern and under /t/{tenant}pattern.
+func (s *Server) handleTenants(mux *http.ServeMux, pattern string, handler func(*Server) http.HandlerFunc) {
+	handlers := map[string]http.HandlerFunc{"": handler(s)}
+	for name, tenant := range s.tenants {
+		handlers[name] = handler(tenant)
+	}
+
+	route := tenantRoute(handlers)
+	mux.HandleFunc(pattern, route)
+	mux.HandleFunc("/t/{tenant}"+pattern, route)
+}
+
+// tenantRoute returns a handler passing each request to the handler of the
+// tenant the path or X-Tenant names, or of the default profile when neither
+// does.
+func tenantRoute(handlers map[string]http.HandlerFunc) (route http.HandlerFunc) {
+	route = func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("tenant")
+		header := r.Header.Get(TenantHeader)
+		if name != "" && header != "" && header != name {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "X-Tenant does not match the tenant in the path")
+			return
+		}
+		if name == "" {
+			name = header
+		}
+
+		handler, found := handlers[name]
+		if !found {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "Unknown tenant")
+			return
+		}
+		handler(w, r)
+	}
+	return route
+}
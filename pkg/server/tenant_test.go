@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTenantRouting(t *testing.T) {
+	m := metrics.NewWithRegisterer(prometheus.NewRegistry())
+	cfg := config.Config{ESIndex: "code-index", APIKeys: []string{"shared"}}
+	server := &Server{config: cfg, metrics: m, logger: &mockLogger{}, auth: newAuthenticator(cfg)}
+	server.AddTenant("team-a", nil, nil, config.Config{ESIndex: "code-index-team-a", Tenant: "team-a", APIKeys: []string{"team-a-key"}})
+
+	mux := http.NewServeMux()
+	server.handleTenants(mux, "/api/v1/stats", func(s *Server) (h http.HandlerFunc) {
+		h = s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			s.metrics.ReindexTriggers.WithLabelValues("started").Inc()
+			_, _ = w.Write([]byte(s.config.ESIndex))
+		})
+		return h
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		apiKey     string
+		wantStatus int
+		wantIndex  string
+	}{
+		{name: "default profile", path: "/api/v1/stats", apiKey: "shared", wantStatus: http.StatusOK, wantIndex: "code-index"},
+		{name: "path prefix", path: "/t/team-a/api/v1/stats", apiKey: "team-a-key", wantStatus: http.StatusOK, wantIndex: "code-index-team-a"},
+		{name: "header", path: "/api/v1/stats", header: "team-a", apiKey: "team-a-key", wantStatus: http.StatusOK, wantIndex: "code-index-team-a"},
+		{name: "path and matching header", path: "/t/team-a/api/v1/stats", header: "team-a", apiKey: "team-a-key", wantStatus: http.StatusOK, wantIndex: "code-index-team-a"},
+		{name: "path and other header", path: "/t/team-a/api/v1/stats", header: "team-b", apiKey: "team-a-key", wantStatus: http.StatusBadRequest},
+		{name: "unknown tenant", path: "/t/team-b/api/v1/stats", apiKey: "shared", wantStatus: http.StatusNotFound},
+		{name: "another tenant's key", path: "/t/team-a/api/v1/stats", apiKey: "shared", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-API-Key", tt.apiKey)
+			if tt.header != "" {
+				req.Header.Set(TenantHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantIndex != "" && w.Body.String() != tt.wantIndex {
+				t.Errorf("served by %s, want %s", w.Body.String(), tt.wantIndex)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(m.ForTenant("team-a").ReindexTriggers.WithLabelValues("started")); got != 3 {
+		t.Errorf("team-a reindex triggers = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(m.ReindexTriggers.WithLabelValues("started")); got != 1 {
+		t.Errorf("default reindex triggers = %v, want 1", got)
+	}
+}
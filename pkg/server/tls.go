@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// probePaths answer without a client certificate, since kubelet and load
+// balancer health checks don't present one.
+//
+//nolint:gochecknoglobals // fixed lookup table
+var probePaths = map[string]bool{
+	"/health": true,
+	"/ready":  true,
+}
+
+// newTLSConfig builds the server's TLS configuration from TLS_CERT_FILE and
+// TLS_KEY_FILE, or returns nil when TLS is not configured. With
+// TLS_CLIENT_CA_FILE, client certificates signed by those CAs are verified
+// during the handshake; requireClientCert rejects requests without one.
+func newTLSConfig(cfg config.Config) (tlsConfig *tls.Config, err error) {
+	if cfg.TLSCertFile == "" {
+		return tlsConfig, err
+	}
+
+	loader := &certificateLoader{certFile: cfg.TLSCertFile, keyFile: cfg.TLSKeyFile}
+	_, err = loader.load()
+	if err != nil {
+		return tlsConfig, err
+	}
+
+	tlsConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: loader.getCertificate,
+	}
+
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, err
+	}
+
+	var pem []byte
+	pem, err = os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		err = fmt.Errorf("failed to read TLS_CLIENT_CA_FILE: %w", err)
+		return tlsConfig, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("no certificates found in TLS_CLIENT_CA_FILE %s", cfg.TLSClientCAFile)
+		return tlsConfig, err
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, err
+}
+
+// requireClientCert rejects requests that didn't present a client
+// certificate verified against TLS_CLIENT_CA_FILE, except health probes.
+// Certificates that fail verification never get this far; the handshake
+// fails.
+func (s *Server) requireClientCert(next http.Handler) (handler http.Handler) {
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.TLSClientCAFile == "" || probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			s.logger.WarnContext(r.Context(), "Client certificate required", "path", r.URL.Path, "remote", r.RemoteAddr)
+			writeError(w, r, http.StatusUnauthorized, CodeClientCertRequired, "Client certificate required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+	return handler
+}
+
+// certificateLoader serves the certificate and key files, reloading them
+// when either changes so rotated certificates, such as those renewed by
+// cert-manager, are picked up without a restart.
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// getCertificate returns the current certificate for a handshake. If the
+// files changed but can't be loaded, for example mid-rotation, the previous
+// certificate is served until they can.
+func (l *certificateLoader) getCertificate(_ *tls.ClientHelloInfo) (cert *tls.Certificate, err error) {
+	cert, err = l.load()
+	if err != nil && cert != nil {
+		err = nil
+	}
+	return cert, err
+}
+
+// load returns the certificate, reading the files again when either has been
+// modified since they were last read.
+func (l *certificateLoader) load() (cert *tls.Certificate, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cert = l.cert
+	var modTime time.Time
+	for _, path := range []string{l.certFile, l.keyFile} {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			err = fmt.Errorf("failed to read TLS certificate: %w", statErr)
+			return cert, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if l.cert != nil && !modTime.After(l.modTime) {
+		return cert, err
+	}
+
+	loaded, loadErr := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if loadErr != nil {
+		err = fmt.Errorf("failed to load TLS certificate: %w", loadErr)
+		return cert, err
+	}
+	if len(loaded.Certificate) == 0 {
+		err = errors.New("failed to load TLS certificate: no certificate in TLS_CERT_FILE")
+		return cert, err
+	}
+
+	l.cert = &loaded
+	l.modTime = modTime
+	cert = l.cert
+	return cert, err
+}
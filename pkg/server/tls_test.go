@@ -0,0 +1,279 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// testCert is a certificate and key issued for a test.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// issueCert creates a certificate named name, signed by parent or
+// self-signed when parent is nil.
+func issueCert(t *testing.T, name string, isCA bool, parent *testCert) (issued *testCert) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	issued = &testCert{
+		cert: cert,
+		key:  key,
+		tls:  tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}
+	return issued
+}
+
+// writePEM writes the certificate, and its key when keyPath is set, as PEM.
+func (c *testCert) writePEM(t *testing.T, certPath string, keyPath string) {
+	t.Helper()
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	err := os.WriteFile(certPath, certPEM, 0o600)
+	if err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if keyPath == "" {
+		return
+	}
+
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "test-ca", true, nil)
+	serverCert := issueCert(t, "code-indexer", false, ca)
+	clientCert := issueCert(t, "client", false, ca)
+	otherCA := issueCert(t, "other-ca", true, nil)
+	strangerCert := issueCert(t, "stranger", false, otherCA)
+
+	cfg := config.Config{
+		TLSCertFile:     filepath.Join(dir, "tls.crt"),
+		TLSKeyFile:      filepath.Join(dir, "tls.key"),
+		TLSClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	serverCert.writePEM(t, cfg.TLSCertFile, cfg.TLSKeyFile)
+	ca.writePEM(t, cfg.TLSClientCAFile, "")
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("newTLSConfig() error = %v", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", tlsConfig.MinVersion)
+	}
+
+	s := &Server{config: cfg, logger: logging.New(slog.New(slog.NewTextHandler(io.Discard, nil)))}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := &http.Server{
+		Handler: s.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		name       string
+		clientCert *testCert
+		path       string
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "client certificate accepted", clientCert: clientCert, path: "/api/v1/stats", wantStatus: http.StatusOK},
+		{name: "missing client certificate rejected", path: "/api/v1/stats", wantStatus: http.StatusUnauthorized},
+		{name: "metrics need a client certificate", path: "/metrics", wantStatus: http.StatusUnauthorized},
+		{name: "probes need no client certificate", path: "/ready", wantStatus: http.StatusOK},
+		{name: "untrusted client certificate fails the handshake", clientCert: strangerCert, path: "/health", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientTLS := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+			if tt.clientCert != nil {
+				// Sent even when its issuer isn't one the server asks for.
+				clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &tt.clientCert.tls, nil
+				}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}, Timeout: 5 * time.Second}
+			defer client.CloseIdleConnections()
+
+			resp, reqErr := client.Get("https://" + listener.Addr().String() + tt.path)
+			if tt.wantErr {
+				if reqErr == nil {
+					_ = resp.Body.Close()
+					t.Fatal("request succeeded, want a handshake failure")
+				}
+				return
+			}
+			if reqErr != nil {
+				t.Fatalf("request error = %v", reqErr)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	issueCert(t, "code-indexer", false, nil).writePEM(t, certFile, keyFile)
+
+	notPEM := filepath.Join(dir, "not.pem")
+	err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		wantNil    bool
+		wantClient bool
+		wantErr    bool
+	}{
+		{name: "tls disabled", wantNil: true},
+		{name: "server certificate", cfg: config.Config{TLSCertFile: certFile, TLSKeyFile: keyFile}},
+		{name: "client certificates", cfg: config.Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: certFile}, wantClient: true},
+		{name: "missing certificate", cfg: config.Config{TLSCertFile: filepath.Join(dir, "missing.crt"), TLSKeyFile: keyFile}, wantErr: true},
+		{name: "unreadable certificate", cfg: config.Config{TLSCertFile: notPEM, TLSKeyFile: keyFile}, wantErr: true},
+		{name: "client ca without certificates", cfg: config.Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: notPEM}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTLSConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("newTLSConfig() = %v, want nil %v", got, tt.wantNil)
+			}
+			if got == nil {
+				return
+			}
+			wantAuth := tls.NoClientCert
+			if tt.wantClient {
+				wantAuth = tls.VerifyClientCertIfGiven
+			}
+			if got.ClientAuth != wantAuth || (got.ClientCAs != nil) != tt.wantClient {
+				t.Errorf("ClientAuth = %v, ClientCAs set %v, want client certificates %v", got.ClientAuth, got.ClientCAs != nil, tt.wantClient)
+			}
+		})
+	}
+}
+
+func TestCertificateLoaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	first := issueCert(t, "first", false, nil)
+	first.writePEM(t, certFile, keyFile)
+
+	loader := &certificateLoader{certFile: certFile, keyFile: keyFile}
+	got, err := loader.getCertificate(nil)
+	if err != nil || got.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("getCertificate() = %v, %v, want the first certificate", got, err)
+	}
+
+	// A rotated certificate is served once the files change.
+	issueCert(t, "second", false, nil).writePEM(t, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		err = os.Chtimes(path, later, later)
+		if err != nil {
+			t.Fatalf("failed to touch %s: %v", path, err)
+		}
+	}
+	got, err = loader.getCertificate(nil)
+	if err != nil || got.Leaf.Subject.CommonName != "second" {
+		t.Fatalf("getCertificate() after rotation = %v, %v, want the second certificate", got, err)
+	}
+
+	// A half-written rotation keeps serving the last good certificate.
+	err = os.WriteFile(keyFile, []byte("partial"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	later = later.Add(time.Minute)
+	err = os.Chtimes(keyFile, later, later)
+	if err != nil {
+		t.Fatalf("failed to touch key: %v", err)
+	}
+	got, err = loader.getCertificate(nil)
+	if err != nil || got.Leaf.Subject.CommonName != "second" {
+		t.Errorf("getCertificate() mid-rotation = %v, %v, want the second certificate", got, err)
+	}
+}
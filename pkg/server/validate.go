@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// maxFilterValueLength bounds each filter value, such as a repository name or
+// import path, in bytes.
+const maxFilterValueLength = 256
+
+// normalizeQuery turns the whitespace control characters of a query, such as
+// tabs and newlines pasted with it, into spaces and trims the result. valid
+// is false for a query with other control characters or invalid UTF-8,
+// which no code search means.
+func normalizeQuery(query string) (normalized string, valid bool) {
+	if !utf8.ValidString(query) {
+		return normalized, valid
+	}
+
+	var b strings.Builder
+	for _, r := range query {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case unicode.IsControl(r):
+			return normalized, valid
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	normalized = strings.TrimSpace(b.String())
+	valid = true
+	return normalized, valid
+}
+
+// validFilterValue reports whether a filter value is non-empty, bounded, and
+// free of control characters.
+func validFilterValue(value string) (valid bool) {
+	valid = value != "" && len(value) <= maxFilterValueLength && utf8.ValidString(value) &&
+		!strings.ContainsFunc(value, unicode.IsControl)
+	return valid
+}
+
+// searchBoundsError normalizes a search's query in place and checks it, its
+// limit, and its filter values against SEARCH_MAX_QUERY_LENGTH,
+// SEARCH_MAX_LIMIT, and SEARCH_MAX_FILTER_VALUES, keeping pathological
+// requests away from Elasticsearch. It describes the first problem found, or
+// returns "" when the search is within bounds. A bound of 0 isn't checked.
+func (s *Server) searchBoundsError(req *elasticsearch.SearchRequest, queryRequired bool) (msg string) {
+	query, valid := normalizeQuery(req.Query)
+	if !valid {
+		msg = "Query contains control characters or invalid UTF-8"
+		return msg
+	}
+	req.Query = query
+
+	if queryRequired && req.Query == "" {
+		msg = "Query is required"
+		return msg
+	}
+
+	maxLength := s.config.SearchMaxQueryLength
+	if maxLength > 0 && utf8.RuneCountInString(req.Query) > maxLength {
+		msg = fmt.Sprintf("Query exceeds %d characters", maxLength)
+		return msg
+	}
+
+	if req.Limit < 0 {
+		msg = "limit must not be negative"
+		return msg
+	}
+	maxLimit := s.config.SearchMaxLimit
+	if maxLimit > 0 && req.Limit > maxLimit {
+		msg = fmt.Sprintf("limit must be at most %d", maxLimit)
+		return msg
+	}
+
+	metadata := make([]string, 0, len(req.Metadata))
+	for _, value := range req.Metadata {
+		metadata = append(metadata, value)
+	}
+
+	var platform []string
+	if req.Platform != "" {
+		platform = []string{req.Platform}
+	}
+
+	filters := []struct {
+		name   string
+		values []string
+	}{
+		{name: "repos", values: req.Repos},
+		{name: "packages", values: req.Packages},
+		{name: "imports", values: req.Imports},
+		{name: "modules", values: req.Modules},
+		{name: "dependencies", values: req.Dependencies},
+		{name: "implements", values: req.Implements},
+		{name: "platform", values: platform},
+		{name: "calls", values: req.Calls},
+		{name: "prefer_calls", values: req.PreferCalls},
+		{name: "kinds", values: req.Kinds},
+		{name: "types", values: req.Types},
+		{name: "metadata", values: metadata},
+	}
+
+	maxValues := s.config.SearchMaxFilterValues
+	for _, filter := range filters {
+		if maxValues > 0 && len(filter.values) > maxValues {
+			msg = fmt.Sprintf("Too many %s values: at most %d", filter.name, maxValues)
+			return msg
+		}
+		for _, value := range filter.values {
+			if !validFilterValue(value) {
+				msg = fmt.Sprintf("Invalid %s value", filter.name)
+				return msg
+			}
+		}
+	}
+
+	return msg
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestSearchBoundsError(t *testing.T) {
+	s := &Server{config: config.Config{SearchMaxQueryLength: 20, SearchMaxLimit: 50, SearchMaxFilterValues: 2}}
+
+	tests := []struct {
+		name      string
+		req       elasticsearch.SearchRequest
+		optional  bool
+		wantQuery string
+		wantErr   string
+	}{
+		{name: "valid", req: elasticsearch.SearchRequest{Query: "retry logic", Limit: 50, Repos: []string{"api", "web"}}, wantQuery: "retry logic"},
+		{name: "whitespace normalized", req: elasticsearch.SearchRequest{Query: "\tretry\r\nlogic "}, wantQuery: "retry  logic"},
+		{name: "multibyte within length", req: elasticsearch.SearchRequest{Query: strings.Repeat("é", 20)}, wantQuery: strings.Repeat("é", 20)},
+		{name: "empty query allowed", req: elasticsearch.SearchRequest{}, optional: true},
+		{name: "blank query", req: elasticsearch.SearchRequest{Query: " \n "}, wantErr: "Query is required"},
+		{name: "control character", req: elasticsearch.SearchRequest{Query: "retry\x00"}, wantErr: "Query contains control characters or invalid UTF-8"},
+		{name: "invalid UTF-8", req: elasticsearch.SearchRequest{Query: "retry\xff"}, wantErr: "Query contains control characters or invalid UTF-8"},
+		{name: "query too long", req: elasticsearch.SearchRequest{Query: strings.Repeat("x", 21)}, wantErr: "Query exceeds 20 characters"},
+		{name: "negative limit", req: elasticsearch.SearchRequest{Query: "retry", Limit: -1}, wantErr: "limit must not be negative"},
+		{name: "limit too large", req: elasticsearch.SearchRequest{Query: "retry", Limit: 51}, wantErr: "limit must be at most 50"},
+		{name: "too many repos", req: elasticsearch.SearchRequest{Query: "retry", Repos: []string{"a", "b", "c"}}, wantErr: "Too many repos values: at most 2"},
+		{name: "empty import", req: elasticsearch.SearchRequest{Query: "retry", Imports: []string{""}}, wantErr: "Invalid imports value"},
+		{name: "long package", req: elasticsearch.SearchRequest{Query: "retry", Packages: []string{strings.Repeat("p", maxFilterValueLength+1)}}, wantErr: "Invalid packages value"},
+		{name: "metadata control character", req: elasticsearch.SearchRequest{Query: "retry", Metadata: map[string]string{"team": "core\n"}}, wantErr: "Invalid metadata value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			got := s.searchBoundsError(&req, !tt.optional)
+			if got != tt.wantErr {
+				t.Fatalf("searchBoundsError() = %q, want %q", got, tt.wantErr)
+			}
+			if tt.wantErr == "" && req.Query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", req.Query, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestHandleSearchBounds(t *testing.T) {
+	s := &Server{config: config.Config{SearchMaxQueryLength: 1000, SearchMaxLimit: 100, SearchMaxFilterValues: 50}}
+
+	body := `{"query":"` + strings.Repeat("a", 100*1024) + `"}`
+	w := httptest.NewRecorder()
+	s.handleSearch(w, httptest.NewRequest(http.MethodPost, "/api/v1/search", strings.NewReader(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	apiErr := decodeError(t, w)
+	if apiErr.Code != CodeInvalidRequest || apiErr.Message != "Query exceeds 1000 characters" {
+		t.Errorf("error = %+v, want invalid_request for the query length", apiErr)
+	}
+}
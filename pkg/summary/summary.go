@@ -0,0 +1,224 @@
+// Package summary describes code in natural language at index time with a
+// language model behind an OpenAI-compatible chat completions API, as served
+// by OpenAI, Ollama, vLLM, and LocalAI. Summaries are searched alongside the
+// code, so questions phrased in prose match code that never uses their words.
+package summary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// ErrNotConfigured is returned when summaries are requested without
+// SUMMARY_URL.
+var ErrNotConfigured = errors.New("SUMMARY_URL and SUMMARY_MODEL must be set for summaries")
+
+// maxCodeBytes caps the code sent to the model per declaration; the start of
+// a long function says enough about what it does.
+const maxCodeBytes = 16 * 1024
+
+// maxSummaryBytes caps the summary kept per declaration, in case the model
+// ignores its instructions.
+const maxSummaryBytes = 2048
+
+// instructions tells the model how to summarize a declaration.
+const instructions = `You summarize source code for a code search index.
+Reply with one paragraph of plain prose, at most three sentences, saying what the code does, what it is used for, and any notable behavior such as retries, caching, or side effects.
+Do not repeat the code, list parameters, or use Markdown.`
+
+// Client summarizes code with a chat completions API, sending at most
+// SUMMARY_RPS requests a second.
+type Client struct {
+	url     string
+	model   string
+	apiKey  string
+	client  *http.Client
+	limiter *limiter
+}
+
+// chatMessage is one message of a chat completions conversation.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest is the request body of the chat completions API.
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+// chatResponse is the subset of the chat completions response used here.
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// New creates a summarizing client from cfg. It returns ErrNotConfigured
+// when no endpoint or model is set.
+func New(cfg config.Config) (client *Client, err error) {
+	if cfg.SummaryURL == "" || cfg.SummaryModel == "" {
+		err = ErrNotConfigured
+		return client, err
+	}
+
+	client = &Client{
+		url:    cfg.SummaryURL,
+		model:  cfg.SummaryModel,
+		apiKey: cfg.SummaryAPIKey,
+		client: &http.Client{
+			Timeout: cfg.SummaryTimeout,
+		},
+		limiter: newLimiter(cfg.SummaryRPS, time.Now),
+	}
+	return client, err
+}
+
+// Model returns the model the client summarizes with.
+func (c *Client) Model() (model string) {
+	model = c.model
+	return model
+}
+
+// Summarize returns a one-paragraph description of the declaration, waiting
+// its turn under the rate limit first.
+func (c *Client) Summarize(ctx context.Context, doc elasticsearch.CodeDocument) (summary string, err error) {
+	err = c.limiter.wait(ctx)
+	if err != nil {
+		return summary, err
+	}
+
+	var data []byte
+	data, err = json.Marshal(chatRequest{
+		Model: c.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: instructions},
+			{Role: "user", Content: prompt(doc)},
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to marshal summary request: %w", err)
+		return summary, err
+	}
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("failed to create summary request: %w", err)
+		return summary, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	var resp *http.Response
+	resp, err = c.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to request summary: %w", err)
+		return summary, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("summary API returned status %d: %s", resp.StatusCode, body)
+		return summary, err
+	}
+
+	var parsed chatResponse
+	err = json.NewDecoder(resp.Body).Decode(&parsed)
+	if err != nil {
+		err = fmt.Errorf("failed to decode summary response: %w", err)
+		return summary, err
+	}
+	if len(parsed.Choices) == 0 {
+		err = errors.New("summary API returned no choices")
+		return summary, err
+	}
+
+	summary = strings.Join(strings.Fields(parsed.Choices[0].Message.Content), " ")
+	if len(summary) > maxSummaryBytes {
+		summary = strings.ToValidUTF8(summary[:maxSummaryBytes], "")
+	}
+	if summary == "" {
+		err = errors.New("summary model returned an empty summary")
+		return summary, err
+	}
+	return summary, err
+}
+
+// prompt is the user message describing a declaration: where it lives and
+// the start of its code.
+func prompt(doc elasticsearch.CodeDocument) (text string) {
+	code := doc.Code
+	if len(code) > maxCodeBytes {
+		code = strings.ToValidUTF8(code[:maxCodeBytes], "")
+	}
+
+	name := doc.FunctionName
+	if doc.Package != "" {
+		name = doc.Package + "." + name
+	}
+
+	text = fmt.Sprintf("Language: %s\nFile: %s\n%s: %s\n\n%s", doc.Language, doc.FilePath, doc.Kind, name, code)
+	return text
+}
+
+// limiter spaces requests evenly at rate a second.
+type limiter struct {
+	interval time.Duration
+	now      func() time.Time
+	mu       sync.Mutex
+	next     time.Time
+}
+
+// newLimiter returns a limiter allowing rate requests a second.
+func newLimiter(rate float64, now func() time.Time) (l *limiter) {
+	l = &limiter{
+		interval: time.Duration(float64(time.Second) / rate),
+		now:      now,
+	}
+	return l
+}
+
+// wait blocks until the next request may be sent, or ctx is done.
+func (l *limiter) wait(ctx context.Context) (err error) {
+	l.mu.Lock()
+	now := l.now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return err
+}
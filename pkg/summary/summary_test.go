@@ -0,0 +1,123 @@
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(config.Config{})
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("New() error = %v, want ErrNotConfigured", err)
+	}
+
+	_, err = New(config.Config{SummaryURL: "http://localhost:11434/v1/chat/completions", SummaryModel: "llama3.2", SummaryRPS: 1})
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "summary", status: http.StatusOK, content: "Retries an HTTP call with exponential backoff.", want: "Retries an HTTP call with exponential backoff."},
+		{name: "one paragraph", status: http.StatusOK, content: "  Retries a call.\n\nGives up after five attempts.\n", want: "Retries a call. Gives up after five attempts."},
+		{name: "empty", status: http.StatusOK, content: " \n", wantErr: true},
+		{name: "API error", status: http.StatusTooManyRequests, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got chatRequest
+			var auth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				_ = json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"choices": []map[string]interface{}{{"message": chatMessage{Role: "assistant", Content: tt.content}}},
+				})
+			}))
+			defer server.Close()
+
+			client, err := New(config.Config{
+				SummaryURL:     server.URL,
+				SummaryModel:   "gpt-4o-mini",
+				SummaryAPIKey:  "secret",
+				SummaryTimeout: time.Second,
+				SummaryRPS:     1000,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			doc := elasticsearch.CodeDocument{
+				FilePath:     "pkg/retry/retry.go",
+				Language:     "go",
+				Kind:         elasticsearch.KindFunction,
+				Package:      "retry",
+				FunctionName: "Do",
+				Code:         "func Do(ctx context.Context, fn func() error) (err error) {}",
+			}
+			summary, err := client.Summarize(context.Background(), doc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Summarize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if summary != tt.want {
+				t.Errorf("Summarize() = %q, want %q", summary, tt.want)
+			}
+
+			if auth != "Bearer secret" {
+				t.Errorf("Authorization = %q, want the API key", auth)
+			}
+			if got.Model != "gpt-4o-mini" || len(got.Messages) != 2 {
+				t.Fatalf("request = %+v, want the model with instructions and code", got)
+			}
+			for _, part := range []string{"File: pkg/retry/retry.go", "function: retry.Do", doc.Code} {
+				if !strings.Contains(got.Messages[1].Content, part) {
+					t.Errorf("prompt = %q, want %q", got.Messages[1].Content, part)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newLimiter(2, func() time.Time { return now })
+
+	err := l.wait(context.Background())
+	if err != nil {
+		t.Fatalf("first wait() error = %v", err)
+	}
+	if !l.next.Equal(now.Add(500 * time.Millisecond)) {
+		t.Errorf("next slot = %v, want half a second on", l.next)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = l.wait(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("wait() before the next slot error = %v, want context.Canceled", err)
+	}
+
+	now = now.Add(10 * time.Second)
+	err = l.wait(ctx)
+	if err != nil {
+		t.Errorf("wait() after the slot error = %v, want none", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package usage aggregates anonymous search statistics in memory so operators
+// can see which queries and repositories need better retrieval. Nothing is
+// sent anywhere; the report is only served locally.
+package usage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+// maxTrackedQueries bounds the number of distinct queries kept. Queries first
+// seen after the limit still count toward the totals.
+const maxTrackedQueries = 10000
+
+// QueryStat counts how often a normalized query was searched.
+type QueryStat struct {
+	Query       string `json:"query"`
+	Count       int64  `json:"count"`
+	ZeroResults int64  `json:"zero_results"`
+}
+
+// RepoStat counts how many searches returned results from a repository.
+type RepoStat struct {
+	Repo string `json:"repo"`
+	Hits int64  `json:"hits"`
+}
+
+// Report summarizes search usage since the server started.
+type Report struct {
+	Since                time.Time   `json:"since"`
+	Queries              int64       `json:"queries"`
+	ZeroResultQueries    int64       `json:"zero_result_queries"`
+	ZeroResultRate       float64     `json:"zero_result_rate"`
+	UntrackedQueries     int64       `json:"untracked_queries"`
+	TopQueries           []QueryStat `json:"top_queries"`
+	TopZeroResultQueries []QueryStat `json:"top_zero_result_queries"`
+	Repos                []RepoStat  `json:"repos"`
+}
+
+// Recorder aggregates search usage. A nil Recorder records nothing.
+type Recorder struct {
+	mu          sync.Mutex
+	since       time.Time
+	queries     int64
+	zeroResults int64
+	untracked   int64
+	byQuery     map[string]*QueryStat
+	repoHits    map[string]int64
+}
+
+// New creates a Recorder when USAGE_STATS is enabled and returns nil otherwise.
+func New(cfg config.Config) (recorder *Recorder) {
+	if !cfg.UsageStats {
+		return recorder
+	}
+
+	recorder = &Recorder{
+		since:    time.Now(),
+		byQuery:  make(map[string]*QueryStat),
+		repoHits: make(map[string]int64),
+	}
+	return recorder
+}
+
+// Enabled reports whether usage is being recorded.
+func (r *Recorder) Enabled() (enabled bool) {
+	enabled = r != nil
+	return enabled
+}
+
+// Record notes a search and the repositories its results came from. Only the
+// normalized query text is kept; nothing identifies the caller.
+func (r *Recorder) Record(query string, repos []string) {
+	if r == nil {
+		return
+	}
+
+	query = normalizeQuery(query)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.queries++
+	zero := len(repos) == 0
+	if zero {
+		r.zeroResults++
+	}
+
+	stat, ok := r.byQuery[query]
+	if !ok {
+		if len(r.byQuery) >= maxTrackedQueries {
+			r.untracked++
+		} else {
+			stat = &QueryStat{Query: query}
+			r.byQuery[query] = stat
+		}
+	}
+	if stat != nil {
+		stat.Count++
+		if zero {
+			stat.ZeroResults++
+		}
+	}
+
+	for _, repo := range repos {
+		r.repoHits[repo]++
+	}
+}
+
+// Report returns the aggregated usage with the top n queries by count and by
+// zero-result count. Repositories are sorted by hits.
+func (r *Recorder) Report(n int) (report Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report = Report{
+		Since:                r.since,
+		Queries:              r.queries,
+		ZeroResultQueries:    r.zeroResults,
+		UntrackedQueries:     r.untracked,
+		TopQueries:           []QueryStat{},
+		TopZeroResultQueries: []QueryStat{},
+		Repos:                []RepoStat{},
+	}
+	if r.queries > 0 {
+		report.ZeroResultRate = float64(r.zeroResults) / float64(r.queries)
+	}
+
+	stats := make([]QueryStat, 0, len(r.byQuery))
+	for _, stat := range r.byQuery {
+		stats = append(stats, *stat)
+	}
+
+	sort.Slice(stats, func(i, j int) (less bool) {
+		less = stats[i].Count > stats[j].Count || (stats[i].Count == stats[j].Count && stats[i].Query < stats[j].Query)
+		return less
+	})
+	report.TopQueries = append(report.TopQueries, stats[:min(n, len(stats))]...)
+
+	sort.Slice(stats, func(i, j int) (less bool) {
+		less = stats[i].ZeroResults > stats[j].ZeroResults || (stats[i].ZeroResults == stats[j].ZeroResults && stats[i].Query < stats[j].Query)
+		return less
+	})
+	for _, stat := range stats {
+		if stat.ZeroResults == 0 || len(report.TopZeroResultQueries) >= n {
+			break
+		}
+		report.TopZeroResultQueries = append(report.TopZeroResultQueries, stat)
+	}
+
+	for repo, hits := range r.repoHits {
+		report.Repos = append(report.Repos, RepoStat{Repo: repo, Hits: hits})
+	}
+	sort.Slice(report.Repos, func(i, j int) (less bool) {
+		less = report.Repos[i].Hits > report.Repos[j].Hits || (report.Repos[i].Hits == report.Repos[j].Hits && report.Repos[i].Repo < report.Repos[j].Repo)
+		return less
+	})
+
+	return report
+}
+
+// normalizeQuery lowercases the query and collapses whitespace so trivially
+// different spellings aggregate together.
+func normalizeQuery(query string) (normalized string) {
+	normalized = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	return normalized
+}
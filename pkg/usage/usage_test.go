@@ -0,0 +1,73 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+)
+
+func TestNewDisabled(t *testing.T) {
+	recorder := New(config.Config{})
+	if recorder.Enabled() {
+		t.Fatal("Enabled() = true, want false when USAGE_STATS is off")
+	}
+
+	// Recording on a disabled recorder is a no-op.
+	recorder.Record("http handler", []string{"api"})
+}
+
+func TestReport(t *testing.T) {
+	recorder := New(config.Config{UsageStats: true})
+
+	recorder.Record("HTTP  handler", []string{"api", "web"})
+	recorder.Record("http handler", []string{"api"})
+	recorder.Record("retry backoff", nil)
+	recorder.Record("retry backoff", nil)
+	recorder.Record("context timeout", []string{"web"})
+	recorder.Record("kafka consumer", nil)
+
+	report := recorder.Report(2)
+
+	if report.Queries != 6 {
+		t.Errorf("Queries = %d, want 6", report.Queries)
+	}
+	if report.ZeroResultQueries != 3 {
+		t.Errorf("ZeroResultQueries = %d, want 3", report.ZeroResultQueries)
+	}
+	if report.ZeroResultRate != 0.5 {
+		t.Errorf("ZeroResultRate = %v, want 0.5", report.ZeroResultRate)
+	}
+
+	wantTop := []QueryStat{
+		{Query: "http handler", Count: 2},
+		{Query: "retry backoff", Count: 2, ZeroResults: 2},
+	}
+	if len(report.TopQueries) != len(wantTop) {
+		t.Fatalf("TopQueries = %+v, want %+v", report.TopQueries, wantTop)
+	}
+	for i := range wantTop {
+		if report.TopQueries[i] != wantTop[i] {
+			t.Errorf("TopQueries[%d] = %+v, want %+v", i, report.TopQueries[i], wantTop[i])
+		}
+	}
+
+	wantZero := []string{"retry backoff", "kafka consumer"}
+	if len(report.TopZeroResultQueries) != len(wantZero) {
+		t.Fatalf("TopZeroResultQueries = %+v, want %v", report.TopZeroResultQueries, wantZero)
+	}
+	for i := range wantZero {
+		if report.TopZeroResultQueries[i].Query != wantZero[i] {
+			t.Errorf("TopZeroResultQueries[%d] = %q, want %q", i, report.TopZeroResultQueries[i].Query, wantZero[i])
+		}
+	}
+
+	wantRepos := []RepoStat{{Repo: "api", Hits: 2}, {Repo: "web", Hits: 2}}
+	if len(report.Repos) != len(wantRepos) {
+		t.Fatalf("Repos = %+v, want %+v", report.Repos, wantRepos)
+	}
+	for i := range wantRepos {
+		if report.Repos[i] != wantRepos[i] {
+			t.Errorf("Repos[%d] = %+v, want %+v", i, report.Repos[i], wantRepos[i])
+		}
+	}
+}
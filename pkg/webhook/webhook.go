@@ -0,0 +1,186 @@
+// Package webhook sends index run notifications to configured HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+// Payload formats.
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+)
+
+// Run and repository statuses.
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// RepoResult is the outcome of indexing one repository during a run.
+type RepoResult struct {
+	Repo            string  `json:"repo"`
+	Status          string  `json:"status"`
+	Functions       int     `json:"functions"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// RunEvent describes a finished index run.
+type RunEvent struct {
+	Status          string       `json:"status"`
+	JobID           string       `json:"job_id,omitempty"`
+	Functions       int          `json:"functions"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	StartedAt       time.Time    `json:"started_at"`
+	FinishedAt      time.Time    `json:"finished_at"`
+	Repos           []RepoResult `json:"repos"`
+	Error           string       `json:"error,omitempty"`
+}
+
+// Notifier posts run events to webhook URLs.
+type Notifier struct {
+	urls         []string
+	format       string
+	failuresOnly bool
+	client       *http.Client
+	logger       logging.Logger
+}
+
+// New creates a Notifier from the webhook settings in cfg.
+func New(cfg config.Config, logger logging.Logger) (notifier *Notifier) {
+	notifier = &Notifier{
+		urls:         cfg.WebhookURLs,
+		format:       cfg.WebhookFormat,
+		failuresOnly: cfg.WebhookFailuresOnly,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		logger: logger,
+	}
+	return notifier
+}
+
+// Notify posts the event to every configured URL. Delivery failures are
+// logged and joined into the returned error; a nil Notifier does nothing.
+func (n *Notifier) Notify(ctx context.Context, event RunEvent) (err error) {
+	if n == nil || len(n.urls) == 0 {
+		return err
+	}
+
+	if n.failuresOnly && event.Status != StatusFailed {
+		return err
+	}
+
+	var payload []byte
+	payload, err = n.payload(event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, target := range n.urls {
+		postErr := n.post(ctx, target, payload)
+		if postErr != nil {
+			n.logger.Warn("Webhook delivery failed", "url", redactURL(target), "error", postErr)
+			errs = append(errs, postErr)
+		}
+	}
+
+	err = errors.Join(errs...)
+	return err
+}
+
+// payload encodes the event in the configured format.
+func (n *Notifier) payload(event RunEvent) (payload []byte, err error) {
+	var body any = event
+	if n.format == FormatSlack {
+		body = map[string]string{"text": slackText(event)}
+	}
+
+	payload, err = json.Marshal(body)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal webhook payload: %w", err)
+		return payload, err
+	}
+
+	return payload, err
+}
+
+// post sends the payload to a single URL.
+func (n *Notifier) post(ctx context.Context, target string, payload []byte) (err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		err = fmt.Errorf("failed to create webhook request: %w", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp *http.Response
+	resp, err = n.client.Do(req)
+	if err != nil {
+		// Drop the URL from the error so secrets in it don't reach the logs.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		err = fmt.Errorf("failed to send webhook: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		return err
+	}
+
+	return err
+}
+
+// slackText renders the event as a Slack message.
+func slackText(event RunEvent) (text string) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "rag-indexer run %s: %d functions across %d repositories in %.1fs",
+		event.Status, event.Functions, len(event.Repos), event.DurationSeconds)
+
+	if event.Error != "" {
+		fmt.Fprintf(&b, "\nError: %s", event.Error)
+	}
+
+	for _, repo := range event.Repos {
+		if repo.Status == StatusFailed {
+			fmt.Fprintf(&b, "\n• %s failed: %s", repo.Repo, repo.Error)
+		}
+	}
+
+	text = b.String()
+	return text
+}
+
+// redactURL reduces a URL to its scheme and host for logging, since webhook
+// URLs commonly embed secrets in the path.
+func redactURL(target string) (redacted string) {
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Host == "" {
+		redacted = "invalid URL"
+		return redacted
+	}
+
+	redacted = parsed.Scheme + "://" + parsed.Host
+	return redacted
+}
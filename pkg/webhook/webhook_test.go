@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+)
+
+func TestNotify(t *testing.T) {
+	failedRun := RunEvent{
+		Status:    StatusFailed,
+		Functions: 12,
+		Repos: []RepoResult{
+			{Repo: "api", Status: StatusCompleted, Functions: 12},
+			{Repo: "web", Status: StatusFailed, Error: "walk failed"},
+		},
+	}
+	completedRun := RunEvent{Status: StatusCompleted, Functions: 3, Repos: []RepoResult{}}
+
+	tests := []struct {
+		name         string
+		format       string
+		failuresOnly bool
+		event        RunEvent
+		wantSent     bool
+		check        func(t *testing.T, body []byte)
+	}{
+		{
+			name:     "json payload",
+			format:   FormatJSON,
+			event:    failedRun,
+			wantSent: true,
+			check: func(t *testing.T, body []byte) {
+				var got RunEvent
+				err := json.Unmarshal(body, &got)
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				if got.Status != StatusFailed || len(got.Repos) != 2 || got.Repos[1].Error != "walk failed" {
+					t.Errorf("payload = %+v, want failed run with 2 repos", got)
+				}
+			},
+		},
+		{
+			name:     "slack payload",
+			format:   FormatSlack,
+			event:    failedRun,
+			wantSent: true,
+			check: func(t *testing.T, body []byte) {
+				var got map[string]string
+				err := json.Unmarshal(body, &got)
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				if !strings.Contains(got["text"], "web failed: walk failed") {
+					t.Errorf("text = %q, want failed repo listed", got["text"])
+				}
+			},
+		},
+		{
+			name:         "failures only skips completed run",
+			format:       FormatJSON,
+			failuresOnly: true,
+			event:        completedRun,
+			wantSent:     false,
+		},
+		{
+			name:         "failures only sends failed run",
+			format:       FormatJSON,
+			failuresOnly: true,
+			event:        failedRun,
+			wantSent:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received [][]byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = append(received, body)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+
+			notifier := New(config.Config{
+				WebhookURLs:         []string{srv.URL + "/hooks/secret"},
+				WebhookFormat:       tt.format,
+				WebhookFailuresOnly: tt.failuresOnly,
+			}, logging.New(slog.New(slog.DiscardHandler)))
+
+			err := notifier.Notify(t.Context(), tt.event)
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			if (len(received) == 1) != tt.wantSent {
+				t.Fatalf("webhooks received = %d, wantSent %v", len(received), tt.wantSent)
+			}
+			if tt.check != nil {
+				tt.check(t, received[0])
+			}
+		})
+	}
+}
+
+func TestNotifyErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	notifier := New(config.Config{
+		WebhookURLs:   []string{srv.URL},
+		WebhookFormat: FormatJSON,
+	}, logging.New(slog.New(slog.DiscardHandler)))
+
+	err := notifier.Notify(t.Context(), RunEvent{Status: StatusCompleted})
+	if err == nil {
+		t.Error("Notify() error = nil, want error for 500 response")
+	}
+
+	var nilNotifier *Notifier
+	err = nilNotifier.Notify(t.Context(), RunEvent{})
+	if err != nil {
+		t.Errorf("nil Notify() error = %v", err)
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "https://hooks.slack.com/services/T000/B000/XXXX", want: "https://hooks.slack.com"},
+		{input: "http://localhost:9000/notify?token=abc", want: "http://localhost:9000"},
+		{input: "not a url", want: "invalid URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := redactURL(tt.input)
+			if got != tt.want {
+				t.Errorf("redactURL(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
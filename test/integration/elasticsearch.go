@@ -0,0 +1,155 @@
+// Package integration runs the indexer end to end against a real
+// Elasticsearch: repositories are cloned from local fixtures, indexed, and
+// searched through the same code paths as the binary. It is importable so
+// programs embedding the indexer can test their own pipelines with it.
+//
+// Elasticsearch comes from INTEGRATION_ES_HOST when set, or from a
+// single-node container started with the docker CLI. The tests in this
+// package need the "integration" build tag:
+//
+//	go test -tags integration ./test/integration/...
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultImage is the Elasticsearch image started when no host is given.
+const DefaultImage = "docker.elastic.co/elasticsearch/elasticsearch:8.11.0"
+
+// EnvESHost names the variable pointing the harness at an existing cluster
+// instead of starting a container.
+const EnvESHost = "INTEGRATION_ES_HOST"
+
+// ErrDockerUnavailable is returned when a container is needed but the docker
+// CLI isn't installed or its daemon isn't running.
+var ErrDockerUnavailable = errors.New("docker is not available; set " + EnvESHost + " to use an existing cluster")
+
+// Elasticsearch is a cluster for one test run: an existing one from
+// INTEGRATION_ES_HOST, or a container the harness started and stops.
+type Elasticsearch struct {
+	URL       string
+	container string
+}
+
+// StartElasticsearch returns the cluster at INTEGRATION_ES_HOST, or starts
+// image (DefaultImage when empty) as a single-node container with security
+// disabled on a free local port. It waits until the cluster answers.
+func StartElasticsearch(ctx context.Context, image string) (es *Elasticsearch, err error) {
+	host := os.Getenv(EnvESHost)
+	if host != "" {
+		es = &Elasticsearch{URL: strings.TrimSuffix(host, "/")}
+		err = es.waitReady(ctx, time.Minute)
+		return es, err
+	}
+
+	if image == "" {
+		image = DefaultImage
+	}
+
+	_, err = docker(ctx, "version", "--format", "{{.Server.Version}}")
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrDockerUnavailable, err)
+		return es, err
+	}
+
+	var id string
+	id, err = docker(ctx, "run", "--detach", "--rm",
+		"--publish", "127.0.0.1::9200",
+		"--env", "discovery.type=single-node",
+		"--env", "xpack.security.enabled=false",
+		"--env", "ES_JAVA_OPTS=-Xms512m -Xmx512m",
+		image)
+	if err != nil {
+		err = fmt.Errorf("failed to start Elasticsearch container: %w", err)
+		return es, err
+	}
+	es = &Elasticsearch{container: id}
+
+	var port string
+	port, err = docker(ctx, "port", id, "9200/tcp")
+	if err != nil {
+		_ = es.Stop(context.WithoutCancel(ctx))
+		err = fmt.Errorf("failed to find Elasticsearch port: %w", err)
+		return es, err
+	}
+	// docker port prints one address per line, IPv4 first.
+	port, _, _ = strings.Cut(port, "\n")
+	es.URL = "http://" + strings.TrimSpace(port)
+
+	err = es.waitReady(ctx, 3*time.Minute)
+	if err != nil {
+		_ = es.Stop(context.WithoutCancel(ctx))
+	}
+	return es, err
+}
+
+// Stop removes the container, if the harness started one.
+func (e *Elasticsearch) Stop(ctx context.Context) (err error) {
+	if e.container == "" {
+		return err
+	}
+
+	_, err = docker(ctx, "rm", "--force", e.container)
+	if err != nil {
+		err = fmt.Errorf("failed to remove Elasticsearch container: %w", err)
+	}
+	return err
+}
+
+// waitReady polls cluster health until the cluster is at least yellow.
+func (e *Elasticsearch) waitReady(ctx context.Context, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	url := e.URL + "/_cluster/health?wait_for_status=yellow&timeout=5s"
+	for {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return err
+		}
+
+		var resp *http.Response
+		resp, err = http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return err
+			}
+			err = fmt.Errorf("cluster health returned %s", resp.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("elasticsearch at %s not ready after %v: %w", e.URL, timeout, err)
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// docker runs the docker CLI, returning its trimmed output.
+func docker(ctx context.Context, args ...string) (output string, err error) {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+
+	var out []byte
+	out, err = cmd.Output()
+	output = strings.TrimSpace(string(out))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return output, err
+	}
+
+	return output, err
+}
@@ -0,0 +1,227 @@
+package integration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+	"github.com/nikogura/rag-indexer/pkg/indexer"
+	"github.com/nikogura/rag-indexer/pkg/logging"
+	"github.com/nikogura/rag-indexer/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fixtureOrg is the organization directory fixture repositories live under.
+const fixtureOrg = "fixtures"
+
+// Options configures a Harness.
+type Options struct {
+	// Index names the index to write; a random "integration-" name when
+	// empty. The index is deleted by Close.
+	Index string
+	// Dir holds the fixture repositories and clones. It must exist.
+	Dir string
+	// Configure, if set, adjusts the configuration before the indexer is
+	// built, for example to enable more languages.
+	Configure func(cfg *config.Config)
+	// Logger receives the indexer's logs; they are discarded when nil.
+	Logger *slog.Logger
+}
+
+// Harness runs the clone, index, and search pipeline against one index.
+// Repositories added with AddRepo are cloned into the harness's repos path
+// exactly as configured GIT_REPOS would be. Config, ES, and Indexer are the
+// components the pipeline runs on, for tests that need to reach past the
+// harness.
+type Harness struct {
+	Config  config.Config
+	ES      *elasticsearch.Client
+	Indexer *indexer.Indexer
+	Metrics *metrics.Metrics
+	cluster *Elasticsearch
+	origin  string
+	logger  logging.Logger
+}
+
+// New creates a harness writing to a fresh index on cluster. The
+// configuration starts from the environment, as the binary's does, and
+// points Elasticsearch, the repos path, and git at the harness.
+func New(ctx context.Context, cluster *Elasticsearch, opts Options) (harness *Harness, err error) {
+	var cfg config.Config
+	cfg, err = config.Load()
+	if err != nil {
+		return harness, err
+	}
+
+	if opts.Index == "" {
+		suffix := make([]byte, 4)
+		_, _ = rand.Read(suffix)
+		opts.Index = "integration-" + hex.EncodeToString(suffix)
+	}
+
+	origin := filepath.Join(opts.Dir, "origin")
+	cfg.ESHost = cluster.URL
+	cfg.ESIndex = opts.Index
+	cfg.ESUsername = ""
+	cfg.ESPassword = ""
+	cfg.ESIndexTemplate = ""
+	cfg.ReposPath = filepath.Join(opts.Dir, "repos")
+	cfg.GitOrg = fixtureOrg
+	cfg.GitRepos = nil
+	cfg.GitURLFormat = filepath.Join(origin, "{org}", "{repo}")
+	cfg.GitToken = ""
+	cfg.GitSSHKeyPath = ""
+	if opts.Configure != nil {
+		opts.Configure(&cfg)
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	harness = &Harness{
+		Config:  cfg,
+		Metrics: metrics.NewWithRegisterer(prometheus.NewRegistry()),
+		cluster: cluster,
+		origin:  origin,
+		logger:  logging.New(logger),
+	}
+
+	harness.ES, err = elasticsearch.New(cfg, harness.Metrics)
+	if err != nil {
+		return harness, err
+	}
+
+	err = harness.ES.Bootstrap(ctx, elasticsearch.BootstrapOptions{Timeout: cfg.ESStartupTimeout, Backoff: cfg.ESStartupBackoff})
+	if err != nil {
+		err = fmt.Errorf("failed to bootstrap index %s: %w", cfg.ESIndex, err)
+		return harness, err
+	}
+
+	harness.Indexer = indexer.New(cfg, harness.ES, harness.Metrics, harness.logger)
+	return harness, err
+}
+
+// AddRepo creates a git repository with the given files, keyed by path
+// relative to the repository root, and adds it to the repositories the
+// harness clones. The Indexer is rebuilt with the new repository list.
+// Adding a repository again commits the files as a new revision, which the
+// next Clone fetches.
+func (h *Harness) AddRepo(ctx context.Context, name string, files map[string]string) (err error) {
+	dir := filepath.Join(h.origin, fixtureOrg, name)
+	for path, content := range files {
+		target := filepath.Join(dir, path)
+		err = os.MkdirAll(filepath.Dir(target), 0o755)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(target, []byte(content), 0o600)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "--all"},
+		{"-c", "user.name=integration", "-c", "user.email=integration@example.com", "commit", "--quiet", "--message", "fixture"},
+	} {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+		output, runErr := cmd.CombinedOutput()
+		if runErr != nil {
+			err = fmt.Errorf("git %s failed: %w: %s", args[0], runErr, output)
+			return err
+		}
+	}
+
+	if slices.Contains(h.Config.GitRepos, name) {
+		return err
+	}
+
+	h.Config.GitRepos = append(h.Config.GitRepos, name)
+	h.Indexer = indexer.New(h.Config, h.ES, h.Metrics, h.logger)
+	return err
+}
+
+// Clone clones or updates every repository added to the harness.
+func (h *Harness) Clone(ctx context.Context) (err error) {
+	err = h.Indexer.CloneRepos(ctx)
+	if err != nil {
+		return err
+	}
+
+	// CloneRepos logs per-repository failures and carries on; check for the
+	// clones so a test fails at the step that broke.
+	for _, repo := range h.Config.GitRepos {
+		_, statErr := os.Stat(filepath.Join(h.Config.ReposPath, repo, ".git"))
+		if statErr != nil {
+			err = fmt.Errorf("repository %s was not cloned: %w", repo, statErr)
+			return err
+		}
+	}
+	return err
+}
+
+// Index indexes every cloned repository and refreshes the index so the
+// documents are searchable, returning how many were indexed.
+func (h *Harness) Index(ctx context.Context) (count int, err error) {
+	count, err = h.Indexer.IndexAllRepos(ctx)
+	if err != nil {
+		return count, err
+	}
+
+	err = h.ES.Refresh(ctx)
+	return count, err
+}
+
+// Search runs a search as the API does.
+func (h *Harness) Search(ctx context.Context, req elasticsearch.SearchRequest) (results []elasticsearch.CodeDocument, err error) {
+	results, err = h.ES.SearchWithOptions(ctx, req)
+	return results, err
+}
+
+// Run clones, indexes, and refreshes in one step, as an index-mode run
+// would, returning how many documents were indexed.
+func (h *Harness) Run(ctx context.Context) (count int, err error) {
+	err = h.Clone(ctx)
+	if err != nil {
+		return count, err
+	}
+
+	count, err = h.Index(ctx)
+	return count, err
+}
+
+// Close deletes the harness's index. The cluster is left running for other
+// harnesses; stop it separately.
+func (h *Harness) Close(ctx context.Context) (err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodDelete, h.cluster.URL+"/"+h.Config.ESIndex, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	var resp *http.Response
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to delete index %s: %w", h.Config.ESIndex, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices && resp.StatusCode != http.StatusNotFound {
+		err = fmt.Errorf("failed to delete index %s: %s", h.Config.ESIndex, resp.Status)
+	}
+	return err
+}
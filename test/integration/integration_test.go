@@ -0,0 +1,141 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/nikogura/rag-indexer/pkg/config"
+	"github.com/nikogura/rag-indexer/pkg/elasticsearch"
+)
+
+// cluster is shared by every test in the package.
+//
+//nolint:gochecknoglobals // started once in TestMain
+var cluster *Elasticsearch
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	var err error
+	cluster, err = StartElasticsearch(ctx, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "integration: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	err = cluster.Stop(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "integration: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+// newHarness creates a harness in a temporary directory, deleting its index
+// when the test ends.
+func newHarness(t *testing.T, configure func(cfg *config.Config)) (harness *Harness) {
+	t.Helper()
+
+	harness, err := New(t.Context(), cluster, Options{Dir: t.TempDir(), Configure: configure})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() {
+		closeErr := harness.Close(context.Background())
+		if closeErr != nil {
+			t.Errorf("Close() error = %v", closeErr)
+		}
+	})
+	return harness
+}
+
+func TestCloneIndexSearch(t *testing.T) {
+	harness := newHarness(t, nil)
+
+	err := harness.AddRepo(t.Context(), "payments", map[string]string{
+		"go.mod": "module example.com/payments\n",
+		"charge.go": `package payments
+
+import "errors"
+
+// ChargeCard charges a card, refusing non-positive amounts.
+func ChargeCard(amount int) (receipt string, err error) {
+	if amount <= 0 {
+		err = errors.New("amount must be positive")
+		return receipt, err
+	}
+	receipt = "ok"
+	return receipt, err
+}
+`,
+		"vendor/dep/dep.go": "package dep\n\nfunc Vendored() {}\n",
+	})
+	if err != nil {
+		t.Fatalf("AddRepo() error = %v", err)
+	}
+
+	count, err := harness.Run(t.Context())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Run() indexed %d documents, want 1", count)
+	}
+
+	results, err := harness.Search(t.Context(), elasticsearch.SearchRequest{Query: "ChargeCard", Limit: 5})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Search() = %d results, want 1", len(results))
+	}
+
+	doc := results[0]
+	if doc.Repo != "payments" || doc.FilePath != "charge.go" || !doc.HasNamedReturns || !doc.HasErrorHandling {
+		t.Errorf("result = repo %q file %q named returns %v error handling %v", doc.Repo, doc.FilePath, doc.HasNamedReturns, doc.HasErrorHandling)
+	}
+	if doc.Commit == "" {
+		t.Error("result has no commit")
+	}
+}
+
+func TestReindexPicksUpNewCommits(t *testing.T) {
+	harness := newHarness(t, func(cfg *config.Config) {
+		cfg.Languages = []string{"go", "python"}
+	})
+
+	files := map[string]string{"app/jobs.py": "def enqueue(job):\n    return job\n"}
+	err := harness.AddRepo(t.Context(), "worker", files)
+	if err != nil {
+		t.Fatalf("AddRepo() error = %v", err)
+	}
+
+	_, err = harness.Run(t.Context())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	files["app/retry.py"] = "def retry_later(job, delay):\n    return delay\n"
+	err = harness.AddRepo(t.Context(), "worker", files)
+	if err != nil {
+		t.Fatalf("AddRepo() error = %v", err)
+	}
+
+	_, err = harness.Run(t.Context())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	results, err := harness.Search(t.Context(), elasticsearch.SearchRequest{Query: "retry_later", Kinds: []string{elasticsearch.KindFunction}})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) == 0 || results[0].Language != "python" {
+		t.Fatalf("Search() = %+v, want the new Python function", results)
+	}
+}